@@ -1,7 +1,7 @@
 'use client';
 
 import { useCallback, useEffect, useMemo, useRef } from 'react';
-import { useParams, useRouter } from 'next/navigation';
+import { useParams, useRouter, useSearchParams } from 'next/navigation';
 import { useAuth } from '@/app/contexts/AuthContext';
 import 'katex/dist/katex.min.css';
 import { agentInfoMap } from './[sessionId]/constants';
@@ -24,7 +24,10 @@ export default function ChatPageClient() {
   const { user, loading, authenticatedFetch } = useAuth();
   const routeSessionId = params.sessionId;
   const urlSessionId = Array.isArray(routeSessionId) ? routeSessionId[0] : routeSessionId as string | undefined;
-  const agentId = 'assistant';
+  // Scheduled task runs are opened with ?agent=scheduler so their sessions
+  // load from the scheduler app.
+  const agentParam = useSearchParams().get('agent');
+  const agentId = agentParam && agentParam in agentInfoMap ? agentParam : 'assistant';
   const agentInfo = agentInfoMap[agentId];
 
   // Shared refs — created here so both useSessionData and useScrollManager can use them
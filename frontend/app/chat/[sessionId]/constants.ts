@@ -9,6 +9,13 @@ export const agentInfoMap: Record<string, AgentInfo> = {
     icon: '🔍',
     color: 'bg-blue-500',
   },
+  scheduler: {
+    id: 'scheduler',
+    name: '定时任务',
+    description: '定时任务的执行记录',
+    icon: '⏰',
+    color: 'bg-amber-500',
+  },
 };
 
 // 文件上传限制（与后端保持一致）
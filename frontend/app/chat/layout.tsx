@@ -1,13 +1,15 @@
 'use client';
 
-import type { ReactNode } from 'react';
+import { Suspense, type ReactNode } from 'react';
 import ChatPageClient from './ChatPageClient';
 
 export default function ChatLayout({ children }: { children: ReactNode }) {
   return (
     <>
       {children}
-      <ChatPageClient />
+      <Suspense fallback={null}>
+        <ChatPageClient />
+      </Suspense>
     </>
   );
 }
@@ -0,0 +1,229 @@
+'use client';
+
+import { useCallback, useEffect, useState } from 'react';
+import { useRouter } from 'next/navigation';
+import { Bell, CheckCheck, Settings } from 'lucide-react';
+import { Button } from '@/app/components/ui/button';
+import { useAuth } from '@/app/contexts/AuthContext';
+import {
+  DropdownMenu,
+  DropdownMenuContent,
+  DropdownMenuItem,
+  DropdownMenuSeparator,
+  DropdownMenuTrigger,
+} from '@/app/components/ui/dropdown-menu';
+
+export interface AppNotification {
+  id: number;
+  kind: string;
+  title: string;
+  body: string;
+  link?: string;
+  read_at?: string;
+  created_at: string;
+}
+
+interface ListNotificationsResponse {
+  notifications: AppNotification[];
+  total: number;
+  unread_count: number;
+}
+
+const NOTIFICATION_LIMIT = 20;
+const RECONNECT_DELAY_MS = 5000;
+
+function formatTime(value: string) {
+  return new Date(value).toLocaleString('zh-CN', {
+    month: '2-digit',
+    day: '2-digit',
+    hour: '2-digit',
+    minute: '2-digit',
+  });
+}
+
+// parseSSEChunk splits buffered SSE text into complete events and returns
+// the unfinished remainder.
+function parseSSEChunk(buffer: string): { events: { event: string; data: string }[]; rest: string } {
+  const blocks = buffer.split('\n\n');
+  const rest = blocks.pop() ?? '';
+  const events = blocks.map((block) => {
+    let event = 'message';
+    const data: string[] = [];
+    for (const line of block.split('\n')) {
+      if (line.startsWith('event:')) {
+        event = line.slice(6).trim();
+      } else if (line.startsWith('data:')) {
+        data.push(line.slice(5));
+      }
+    }
+    return { event, data: data.join('\n') };
+  });
+  return { events, rest };
+}
+
+export default function NotificationBell() {
+  const router = useRouter();
+  const { authenticatedFetch } = useAuth();
+  const [notifications, setNotifications] = useState<AppNotification[]>([]);
+  const [unreadCount, setUnreadCount] = useState(0);
+
+  const loadNotifications = useCallback(async () => {
+    try {
+      const response = await authenticatedFetch(`/api/assistant/notifications?limit=${NOTIFICATION_LIMIT}`);
+      if (!response.ok) return;
+      const data: ListNotificationsResponse = await response.json();
+      setNotifications(data.notifications || []);
+      setUnreadCount(data.unread_count || 0);
+    } catch (error) {
+      console.error('Failed to load notifications:', error);
+    }
+  }, [authenticatedFetch]);
+
+  // Keep a stream open for pushed notifications and reconnect when it drops.
+  useEffect(() => {
+    const controller = new AbortController();
+    let reconnectTimer: ReturnType<typeof setTimeout> | undefined;
+
+    const connect = async () => {
+      try {
+        const response = await authenticatedFetch('/api/assistant/notifications/stream', {
+          signal: controller.signal,
+        });
+        const reader = response.ok ? response.body?.getReader() : undefined;
+        if (reader) {
+          // Reload on every (re)connect so nothing missed while offline is lost.
+          await loadNotifications();
+          const decoder = new TextDecoder();
+          let buffer = '';
+          while (true) {
+            const { done, value } = await reader.read();
+            if (done) break;
+            const parsed = parseSSEChunk(buffer + decoder.decode(value, { stream: true }));
+            buffer = parsed.rest;
+            for (const { event, data } of parsed.events) {
+              if (event === 'unread_count') {
+                setUnreadCount(JSON.parse(data).unread_count || 0);
+              } else if (event === 'notification') {
+                const notification: AppNotification = JSON.parse(data);
+                setNotifications((prev) => [notification, ...prev.filter((n) => n.id !== notification.id)].slice(0, NOTIFICATION_LIMIT));
+                setUnreadCount((prev) => prev + 1);
+              }
+            }
+          }
+        }
+      } catch (error) {
+        if (controller.signal.aborted) return;
+        console.error('Notification stream failed:', error);
+      }
+      if (!controller.signal.aborted) {
+        reconnectTimer = setTimeout(connect, RECONNECT_DELAY_MS);
+      }
+    };
+
+    connect();
+    return () => {
+      controller.abort();
+      if (reconnectTimer) clearTimeout(reconnectTimer);
+    };
+  }, [authenticatedFetch, loadNotifications]);
+
+  const markRead = useCallback(async (notification: AppNotification) => {
+    if (!notification.read_at) {
+      try {
+        const response = await authenticatedFetch(`/api/assistant/notifications/${notification.id}/read`, { method: 'POST' });
+        if (response.ok) {
+          const updated: AppNotification = await response.json();
+          setNotifications((prev) => prev.map((n) => (n.id === updated.id ? updated : n)));
+          setUnreadCount((prev) => Math.max(0, prev - 1));
+        }
+      } catch (error) {
+        console.error('Failed to mark notification read:', error);
+      }
+    }
+    if (notification.link) {
+      window.open(notification.link, '_blank');
+    }
+  }, [authenticatedFetch]);
+
+  const markAllRead = useCallback(async () => {
+    try {
+      const response = await authenticatedFetch('/api/assistant/notifications/read', { method: 'POST' });
+      if (response.ok) {
+        const now = new Date().toISOString();
+        setNotifications((prev) => prev.map((n) => (n.read_at ? n : { ...n, read_at: now })));
+        setUnreadCount(0);
+      }
+    } catch (error) {
+      console.error('Failed to mark notifications read:', error);
+    }
+  }, [authenticatedFetch]);
+
+  return (
+    <DropdownMenu>
+      <DropdownMenuTrigger asChild>
+        <Button
+          variant="ghost"
+          size="icon"
+          className="relative text-zinc-400 hover:text-zinc-100 hover:bg-zinc-900 h-8 w-8 flex-shrink-0"
+          aria-label="通知"
+        >
+          <Bell className="h-5 w-5" />
+          {unreadCount > 0 && (
+            <span className="absolute -top-0.5 -right-0.5 min-w-4 h-4 px-1 rounded-full bg-red-500 text-[10px] leading-4 text-white text-center">
+              {unreadCount > 99 ? '99+' : unreadCount}
+            </span>
+          )}
+        </Button>
+      </DropdownMenuTrigger>
+      <DropdownMenuContent align="start" side="top" className="w-80 bg-zinc-900 border-zinc-800 text-zinc-100">
+        <div className="flex items-center justify-between px-2 py-1.5">
+          <span className="text-sm font-medium">通知</span>
+          <div className="flex items-center gap-3">
+            <button
+              type="button"
+              onClick={markAllRead}
+              disabled={unreadCount === 0}
+              className="flex items-center gap-1 text-xs text-zinc-400 hover:text-zinc-100 disabled:opacity-40 disabled:hover:text-zinc-400"
+            >
+              <CheckCheck className="h-3.5 w-3.5" />
+              全部已读
+            </button>
+            <button
+              type="button"
+              onClick={() => router.push('/settings/notifications')}
+              className="text-zinc-400 hover:text-zinc-100"
+              aria-label="通知设置"
+            >
+              <Settings className="h-3.5 w-3.5" />
+            </button>
+          </div>
+        </div>
+        <DropdownMenuSeparator />
+        <div className="max-h-96 overflow-y-auto">
+          {notifications.length === 0 ? (
+            <div className="px-2 py-6 text-center text-sm text-zinc-500">暂无通知</div>
+          ) : (
+            notifications.map((notification) => (
+              <DropdownMenuItem
+                key={notification.id}
+                className="cursor-pointer flex flex-col items-start gap-0.5 py-2"
+                onClick={() => markRead(notification)}
+              >
+                <div className="flex w-full items-center gap-2">
+                  {!notification.read_at && <span className="h-1.5 w-1.5 rounded-full bg-blue-500 flex-shrink-0" />}
+                  <span className={notification.read_at ? 'text-sm text-zinc-400 truncate' : 'text-sm text-zinc-100 truncate'}>
+                    {notification.title}
+                  </span>
+                  <span className="ml-auto text-[11px] text-zinc-500 flex-shrink-0">{formatTime(notification.created_at)}</span>
+                </div>
+                {notification.body && (
+                  <p className="text-xs text-zinc-500 line-clamp-2 whitespace-pre-wrap break-words">{notification.body}</p>
+                )}
+              </DropdownMenuItem>
+            ))
+          )}
+        </div>
+      </DropdownMenuContent>
+    </DropdownMenu>
+  );
+}
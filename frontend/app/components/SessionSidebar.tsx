@@ -2,10 +2,11 @@
 
 import { useState, useMemo, memo, useEffect, useCallback } from 'react';
 import { Button } from '@/app/components/ui/button';
-import { Plus, ChevronLeft, ChevronRight, Trash2, LogOut, FolderOpen, MoreHorizontal, Pencil, Brain, Share2, Terminal, Clock, Calendar } from 'lucide-react';
+import { Plus, ChevronLeft, ChevronRight, Trash2, LogOut, FolderOpen, MoreHorizontal, Pencil, Brain, Share2, Terminal, Clock, Calendar, Zap, MessageCircle, KeyRound, UserRound, UserPlus, ShieldCheck } from 'lucide-react';
 import { cn } from '@/app/lib/utils';
 import { useAuth } from '@/app/contexts/AuthContext';
 import { Avatar, AvatarFallback, AvatarImage } from '@/app/components/ui/avatar';
+import NotificationBell from '@/app/components/NotificationBell';
 import {
   DropdownMenu,
   DropdownMenuContent,
@@ -509,6 +510,52 @@ const SessionSidebar = memo(({
                   <Clock className="mr-2 h-4 w-4" />
                   <span>定时任务</span>
                 </DropdownMenuItem>
+                <DropdownMenuItem
+                  className="cursor-pointer"
+                  onClick={() => openPage('/triggers')}
+                >
+                  <Zap className="mr-2 h-4 w-4" />
+                  <span>事件触发器</span>
+                </DropdownMenuItem>
+                <DropdownMenuItem
+                  className="cursor-pointer"
+                  onClick={() => openPage('/settings/chat-bots')}
+                >
+                  <MessageCircle className="mr-2 h-4 w-4" />
+                  <span>聊天机器人</span>
+                </DropdownMenuItem>
+                <DropdownMenuItem
+                  className="cursor-pointer"
+                  onClick={() => openPage('/settings/api-tokens')}
+                >
+                  <KeyRound className="mr-2 h-4 w-4" />
+                  <span>API 令牌</span>
+                </DropdownMenuItem>
+                <DropdownMenuItem
+                  className="cursor-pointer"
+                  onClick={() => openPage('/settings/login-methods')}
+                >
+                  <UserRound className="mr-2 h-4 w-4" />
+                  <span>登录方式</span>
+                </DropdownMenuItem>
+                {user?.role === 'admin' && (
+                  <>
+                    <DropdownMenuItem
+                      className="cursor-pointer"
+                      onClick={() => openPage('/settings/invites')}
+                    >
+                      <UserPlus className="mr-2 h-4 w-4" />
+                      <span>邀请与账户</span>
+                    </DropdownMenuItem>
+                    <DropdownMenuItem
+                      className="cursor-pointer"
+                      onClick={() => openPage('/settings/admin')}
+                    >
+                      <ShieldCheck className="mr-2 h-4 w-4" />
+                      <span>用户管理</span>
+                    </DropdownMenuItem>
+                  </>
+                )}
                 <DropdownMenuItem
                   className="cursor-pointer"
                   onClick={() => openPage('/settings/google-calendar')}
@@ -527,6 +574,7 @@ const SessionSidebar = memo(({
               </DropdownMenuContent>
             </DropdownMenu>
           </div>
+          <NotificationBell />
           <Button
             onClick={() => setIsCollapsed(true)}
             variant="ghost"
@@ -8,12 +8,13 @@ interface User {
   email: string;
   name: string;
   picture?: string;
+  role: 'admin' | 'member' | 'read_only';
 }
 
 interface AuthContextType {
   user: User | null;
   loading: boolean;
-  login: () => void;
+  login: (provider?: string) => void;
   logout: () => void;
   checkAuth: () => Promise<void>;
   handleUnauthorized: () => void;
@@ -32,6 +33,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     if (
       typeof window !== 'undefined' &&
       window.location.pathname !== '/login' &&
+      window.location.pathname !== '/reset-password' &&
       !window.location.pathname.startsWith('/share/')
     ) {
       router.push('/login');
@@ -94,15 +96,15 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     }
   }, [authenticatedFetch, handleUnauthorized]);
 
-  const login = async () => {
+  const login = async (provider = 'google') => {
     try {
-      const response = await fetch('/api/auth/login/google', {
+      const response = await fetch(`/api/auth/login/${encodeURIComponent(provider)}`, {
         credentials: 'include',
       });
 
       if (response.ok) {
         const data = await response.json();
-        // Redirect to Google OAuth URL
+        // Redirect to the provider's authorization URL
         window.location.href = data.url;
       } else {
         console.error('Failed to get login URL');
@@ -1,17 +1,177 @@
 'use client';
 
-import { Suspense, useEffect } from 'react';
+import { Suspense, useEffect, useState, type FormEvent } from 'react';
 import { useRouter, useSearchParams } from 'next/navigation';
 import { useAuth } from '@/app/contexts/AuthContext';
 import { Button } from '@/app/components/ui/button';
+import { Input } from '@/app/components/ui/input';
 import { AlertCircle } from 'lucide-react';
 import { Alert, AlertDescription } from '@/app/components/ui/alert';
 
+interface LoginProvider {
+  name: string;
+  display_name: string;
+}
+
+interface LocalAccounts {
+  enabled: boolean;
+  registration: 'invite' | 'open' | 'closed';
+  password_reset: boolean;
+}
+
+type PasswordMode = 'login' | 'register' | 'forgot';
+
+function PasswordForm({ settings, onSuccess }: { settings: LocalAccounts; onSuccess: () => void }) {
+  const [mode, setMode] = useState<PasswordMode>('login');
+  const [email, setEmail] = useState('');
+  const [password, setPassword] = useState('');
+  const [name, setName] = useState('');
+  const [inviteCode, setInviteCode] = useState('');
+  const [submitting, setSubmitting] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+  const [message, setMessage] = useState<string | null>(null);
+
+  const openRegistration = mode === 'register' && settings.registration === 'open';
+
+  const switchMode = (next: PasswordMode) => {
+    setMode(next);
+    setError(null);
+    setMessage(null);
+  };
+
+  const handleSubmit = async (e: FormEvent) => {
+    e.preventDefault();
+    setSubmitting(true);
+    setError(null);
+    setMessage(null);
+    try {
+      if (mode === 'forgot') {
+        const res = await fetch('/api/auth/local/password-reset', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ email }),
+        });
+        if (!res.ok) throw new Error('发送失败，请稍后重试');
+        setMessage('如果该邮箱已注册，重置密码的链接已发送到邮箱。');
+        return;
+      }
+
+      const res = await fetch(mode === 'login' ? '/api/auth/local/login' : '/api/auth/local/register', {
+        method: 'POST',
+        credentials: 'include',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(
+          mode === 'login' ? { email, password } : { email, password, name, invite_code: inviteCode }
+        ),
+      });
+      if (res.status === 202) {
+        // 开放注册需通过邮件中的链接设置密码，确认邮箱归属后才能登录
+        setMessage('设置密码的链接已发送到邮箱，请通过链接设置密码以完成注册。');
+        return;
+      }
+      if (res.ok) {
+        onSuccess();
+        return;
+      }
+      if (mode === 'login' && res.status === 403) {
+        const data = await res.json();
+        throw new Error(data.error === 'email is not allowed' ? '该邮箱不在允许登录的列表中，请联系管理员' : '您的账户已被停用，请联系管理员');
+      }
+      if (res.status === 503) throw new Error('未配置系统邮件，暂时无法注册，请联系管理员');
+      switch (res.status) {
+        case 401:
+          throw new Error('邮箱或密码错误');
+        case 429:
+          throw new Error('密码错误次数过多，请 15 分钟后再试');
+        case 409:
+          throw new Error('该邮箱已注册');
+        default:
+          throw new Error((await res.json()).error || '请求失败');
+      }
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <form onSubmit={handleSubmit} className="grid gap-3">
+      {error && (
+        <Alert variant="destructive" className="rounded-lg shadow-sm">
+          <div className="flex items-center gap-2">
+            <AlertCircle className="h-4 w-4" />
+            <AlertDescription className="text-xs">{error}</AlertDescription>
+          </div>
+        </Alert>
+      )}
+      {message && <p className="text-center text-sm text-muted-foreground">{message}</p>}
+
+      <Input type="email" placeholder="邮箱" value={email} onChange={(e) => setEmail(e.target.value)} required autoComplete="email" />
+      {mode !== 'forgot' && (
+        <Input
+          type="password"
+          placeholder={
+            mode === 'login' ? '密码' : openRegistration ? '密码（仅首个账户需要，之后通过邮件设置）' : '密码（至少 8 个字符）'
+          }
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+          required={!openRegistration}
+          minLength={mode === 'register' ? 8 : undefined}
+          autoComplete={mode === 'register' ? 'new-password' : 'current-password'}
+        />
+      )}
+      {mode === 'register' && (
+        <>
+          <Input placeholder="名称（可选）" value={name} onChange={(e) => setName(e.target.value)} autoComplete="name" />
+          {settings.registration === 'invite' && (
+            <Input placeholder="邀请码（首个账户无需填写）" value={inviteCode} onChange={(e) => setInviteCode(e.target.value)} />
+          )}
+        </>
+      )}
+
+      <Button type="submit" variant="outline" className="w-full" disabled={submitting}>
+        {mode === 'login' ? '使用邮箱密码登录' : mode === 'register' ? '注册' : '发送重置链接'}
+      </Button>
+
+      <div className="flex justify-center gap-4 text-xs text-muted-foreground">
+        {mode !== 'login' && (
+          <button type="button" className="hover:text-foreground" onClick={() => switchMode('login')}>
+            返回登录
+          </button>
+        )}
+        {mode === 'login' && settings.registration !== 'closed' && (
+          <button type="button" className="hover:text-foreground" onClick={() => switchMode('register')}>
+            注册账户
+          </button>
+        )}
+        {mode === 'login' && settings.password_reset && (
+          <button type="button" className="hover:text-foreground" onClick={() => switchMode('forgot')}>
+            忘记密码
+          </button>
+        )}
+      </div>
+    </form>
+  );
+}
+
 function LoginForm() {
   const router = useRouter();
   const searchParams = useSearchParams();
   const error = searchParams.get('error');
-  const { user, loading, login } = useAuth();
+  const { user, loading, login, checkAuth } = useAuth();
+  const [providers, setProviders] = useState<LoginProvider[] | null>(null);
+  const [localAccounts, setLocalAccounts] = useState<LocalAccounts | null>(null);
+
+  useEffect(() => {
+    fetch('/api/auth/providers')
+      .then((res) => (res.ok ? res.json() : Promise.reject(res)))
+      .then((data) => {
+        setProviders(data.providers);
+        setLocalAccounts(data.local_accounts);
+      })
+      .catch(() => setProviders([]));
+  }, []);
 
   useEffect(() => {
     if (user && !loading) {
@@ -54,12 +214,55 @@ function LoginForm() {
             </Alert>
           )}
 
-          <Button
-            onClick={login}
-            className="w-full h-10 px-4 py-2 bg-primary text-primary-foreground hover:bg-primary/90 rounded-md text-sm font-medium transition-colors shadow-sm"
-          >
-            使用 Google 账号继续
-          </Button>
+          {error === 'disabled' && (
+            <Alert variant="destructive" className="rounded-lg shadow-sm">
+              <div className="flex items-center gap-2">
+                <AlertCircle className="h-4 w-4" />
+                <AlertDescription className="text-xs">
+                  您的账户已被停用，请联系管理员。
+                </AlertDescription>
+              </div>
+            </Alert>
+          )}
+
+          {error === 'session_expired' && (
+            <Alert variant="destructive" className="rounded-lg shadow-sm">
+              <div className="flex items-center gap-2">
+                <AlertCircle className="h-4 w-4" />
+                <AlertDescription className="text-xs">
+                  登录已过期，请重新登录后再关联登录方式。
+                </AlertDescription>
+              </div>
+            </Alert>
+          )}
+
+          <div className="grid gap-3">
+            {providers?.map((provider) => (
+              <Button
+                key={provider.name}
+                onClick={() => login(provider.name)}
+                className="w-full h-10 px-4 py-2 bg-primary text-primary-foreground hover:bg-primary/90 rounded-md text-sm font-medium transition-colors shadow-sm"
+              >
+                使用 {provider.display_name} 账号继续
+              </Button>
+            ))}
+            {providers?.length === 0 && !localAccounts?.enabled && (
+              <p className="text-center text-sm text-muted-foreground">服务器未配置登录方式，请联系管理员。</p>
+            )}
+          </div>
+
+          {localAccounts?.enabled && (
+            <>
+              {providers && providers.length > 0 && (
+                <div className="flex items-center gap-3 text-xs text-muted-foreground">
+                  <div className="h-px flex-1 bg-border"></div>
+                  或
+                  <div className="h-px flex-1 bg-border"></div>
+                </div>
+              )}
+              <PasswordForm settings={localAccounts} onSuccess={checkAuth} />
+            </>
+          )}
         </div>
       </div>
 
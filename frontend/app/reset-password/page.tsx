@@ -0,0 +1,105 @@
+'use client';
+
+import { Suspense, useState, type FormEvent } from 'react';
+import Link from 'next/link';
+import { useSearchParams } from 'next/navigation';
+import { Button } from '@/app/components/ui/button';
+import { Input } from '@/app/components/ui/input';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { AlertCircle } from 'lucide-react';
+
+function ResetPasswordForm() {
+  const searchParams = useSearchParams();
+  const token = searchParams.get('token') ?? '';
+  const [password, setPassword] = useState('');
+  const [confirm, setConfirm] = useState('');
+  const [submitting, setSubmitting] = useState(false);
+  const [done, setDone] = useState(false);
+  const [error, setError] = useState<string | null>(token ? null : '链接无效，请重新申请重置密码。');
+
+  const handleSubmit = async (e: FormEvent) => {
+    e.preventDefault();
+    if (password !== confirm) {
+      setError('两次输入的密码不一致');
+      return;
+    }
+    setSubmitting(true);
+    setError(null);
+    try {
+      const res = await fetch('/api/auth/local/password-reset/confirm', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token, password }),
+      });
+      if (!res.ok) {
+        const data = await res.json();
+        throw new Error(data.error === 'invalid or expired token' ? '链接已失效，请重新申请重置密码。' : data.error || '设置密码失败');
+      }
+      setDone(true);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex flex-col items-center justify-center bg-background p-6">
+      <div className="w-full max-w-[350px] space-y-6">
+        <div className="flex flex-col space-y-2 text-center text-zinc-950 dark:text-zinc-50">
+          <h1 className="text-2xl font-semibold tracking-tight">设置密码</h1>
+          <p className="text-sm text-muted-foreground">为你的 AIGuide 账户设置新密码</p>
+        </div>
+
+        {error && (
+          <Alert variant="destructive" className="rounded-lg shadow-sm">
+            <div className="flex items-center gap-2">
+              <AlertCircle className="h-4 w-4" />
+              <AlertDescription className="text-xs">{error}</AlertDescription>
+            </div>
+          </Alert>
+        )}
+
+        {done ? (
+          <div className="grid gap-3 text-center">
+            <p className="text-sm text-muted-foreground">密码已设置，请使用新密码登录。</p>
+            <Button asChild className="w-full">
+              <Link href="/login">前往登录</Link>
+            </Button>
+          </div>
+        ) : (
+          <form onSubmit={handleSubmit} className="grid gap-3">
+            <Input
+              type="password"
+              placeholder="新密码（至少 8 个字符）"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              required
+              minLength={8}
+              autoComplete="new-password"
+            />
+            <Input
+              type="password"
+              placeholder="确认新密码"
+              value={confirm}
+              onChange={(e) => setConfirm(e.target.value)}
+              required
+              autoComplete="new-password"
+            />
+            <Button type="submit" className="w-full" disabled={submitting || !token}>
+              设置密码
+            </Button>
+          </form>
+        )}
+      </div>
+    </div>
+  );
+}
+
+export default function ResetPasswordPage() {
+  return (
+    <Suspense>
+      <ResetPasswordForm />
+    </Suspense>
+  );
+}
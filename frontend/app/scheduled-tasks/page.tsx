@@ -7,10 +7,10 @@ import { useAuth } from '@/app/contexts/AuthContext';
 import { Button } from '@/app/components/ui/button';
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
 import { Alert, AlertDescription } from '@/app/components/ui/alert';
-import { CalendarClock, ChevronLeft, Trash2 } from 'lucide-react';
+import { CalendarClock, ChevronLeft, History, Play, Trash2 } from 'lucide-react';
 import { cn } from '@/app/lib/utils';
 
-type ScheduleType = 'once' | 'daily' | 'weekly';
+type ScheduleType = 'once' | 'daily' | 'weekly' | 'workdays' | 'monthly' | 'interval' | 'cron';
 
 interface ScheduledTaskInfo {
   id: number;
@@ -19,15 +19,95 @@ interface ScheduledTaskInfo {
   schedule_type: ScheduleType;
   run_at: string;
   weekday: number;
+  month_day?: number;
+  week_of_month?: number;
+  interval_minutes?: number;
+  cron_expr?: string;
   timezone: string;
   target_email?: string;
   enabled: boolean;
+  max_runtime_minutes: number;
+  max_retries: number;
+  failure_threshold: number;
+  consecutive_failures: number;
+  blackout_dates: string[];
+  missed_run_policy: MissedRunPolicy;
   last_run_at?: string;
   next_run_at: string;
   created_at: string;
   updated_at: string;
 }
 
+type MissedRunPolicy = 'run_once' | 'skip' | 'run_all';
+
+type ScheduledRunStatus = 'running' | 'succeeded' | 'failed' | 'skipped';
+
+interface ScheduledRunToolCall {
+  name: string;
+  author?: string;
+  args?: Record<string, unknown>;
+  response?: string;
+}
+
+type DeliveryChannel = 'email' | 'webhook' | 'in_app' | 'web_push' | 'chat_bot';
+
+interface ScheduledRunDelivery {
+  channel: DeliveryChannel;
+  target?: string;
+  error?: string;
+}
+
+interface ScheduledTaskDeliveryInfo {
+  id: number;
+  channel: DeliveryChannel;
+  provider?: string;
+  target?: string;
+  has_secret: boolean;
+  created_at: string;
+}
+
+interface ListScheduledTaskDeliveriesResponse {
+  deliveries: ScheduledTaskDeliveryInfo[];
+}
+
+interface DeliveryForm {
+  channel: DeliveryChannel;
+  provider: string;
+  target: string;
+  secret: string;
+}
+
+const EMPTY_DELIVERY_FORM: DeliveryForm = { channel: 'in_app', provider: 'telegram', target: '', secret: '' };
+
+const DELIVERY_CHANNEL_LABELS: Record<DeliveryChannel, string> = {
+  email: '邮件',
+  webhook: 'Webhook',
+  in_app: '站内通知',
+  web_push: '浏览器推送',
+  chat_bot: '聊天机器人',
+};
+
+interface ScheduledTaskRunInfo {
+  id: number;
+  scheduled_task_id: number;
+  attempt: number;
+  trigger: 'schedule' | 'manual';
+  status: ScheduledRunStatus;
+  started_at: string;
+  finished_at?: string;
+  error?: string;
+  output: string;
+  tool_calls: ScheduledRunToolCall[];
+  deliveries: ScheduledRunDelivery[];
+  session_id: string;
+  app_name: string;
+}
+
+interface ListScheduledTaskRunsResponse {
+  runs: ScheduledTaskRunInfo[];
+  total: number;
+}
+
 interface ListScheduledTasksResponse {
   tasks: ScheduledTaskInfo[];
   total: number;
@@ -51,6 +131,14 @@ function getScheduleTypeLabel(type: ScheduleType) {
       return '每日';
     case 'weekly':
       return '每周';
+    case 'workdays':
+      return '工作日';
+    case 'monthly':
+      return '每月';
+    case 'interval':
+      return '间隔';
+    case 'cron':
+      return 'Cron';
     default:
       return type;
   }
@@ -63,6 +151,20 @@ function formatRunAt(task: ScheduledTaskInfo) {
   if (task.schedule_type === 'weekly') {
     return `${WEEKDAY_LABELS[task.weekday] ?? ''} ${task.run_at}`;
   }
+  if (task.schedule_type === 'monthly') {
+    if (task.week_of_month) {
+      const week = task.week_of_month === -1 ? '最后一个' : `第${task.week_of_month}个`;
+      return `${week}${WEEKDAY_LABELS[task.weekday] ?? ''} ${task.run_at}`;
+    }
+    return `${task.month_day}日 ${task.run_at}`;
+  }
+  if (task.schedule_type === 'interval') {
+    const minutes = task.interval_minutes ?? 0;
+    return minutes % 60 === 0 ? `每 ${minutes / 60} 小时` : `每 ${minutes} 分钟`;
+  }
+  if (task.schedule_type === 'cron') {
+    return task.cron_expr ?? '';
+  }
   return task.run_at;
 }
 
@@ -80,6 +182,19 @@ function formatDate(value?: string) {
   }).format(date);
 }
 
+const MISSED_RUN_POLICY_LABELS: Record<MissedRunPolicy, string> = {
+  run_once: '补执行一次',
+  skip: '跳过',
+  run_all: '逐次补执行',
+};
+
+const RUN_STATUS_STYLES: Record<ScheduledRunStatus, { label: string; className: string }> = {
+  running: { label: '执行中', className: 'border-sky-800 text-sky-400' },
+  succeeded: { label: '成功', className: 'border-emerald-800 text-emerald-400' },
+  failed: { label: '失败', className: 'border-red-900 text-red-400' },
+  skipped: { label: '已跳过', className: 'border-zinc-700 text-zinc-400' },
+};
+
 function getStatusBadge(task: ScheduledTaskInfo) {
   if (!task.enabled) {
     return { label: '已停用', className: 'border-zinc-700 text-zinc-400' };
@@ -100,6 +215,11 @@ export default function ScheduledTasksPage() {
   const [errorMessage, setErrorMessage] = useState('');
   const [toasts, setToasts] = useState<ToastMessage[]>([]);
   const [backPath, setBackPath] = useState('/chat');
+  const [expandedTaskId, setExpandedTaskId] = useState<number | null>(null);
+  const [runs, setRuns] = useState<ScheduledTaskRunInfo[]>([]);
+  const [isRunsLoading, setIsRunsLoading] = useState(false);
+  const [deliveries, setDeliveries] = useState<ScheduledTaskDeliveryInfo[]>([]);
+  const [deliveryForm, setDeliveryForm] = useState<DeliveryForm>(EMPTY_DELIVERY_FORM);
   const toastIdRef = useRef(0);
 
   useEffect(() => {
@@ -170,6 +290,85 @@ export default function ScheduledTasksPage() {
     }
   };
 
+  const handleToggleRuns = async (task: ScheduledTaskInfo) => {
+    if (expandedTaskId === task.id) {
+      setExpandedTaskId(null);
+      return;
+    }
+    setExpandedTaskId(task.id);
+    setRuns([]);
+    setDeliveries([]);
+    setDeliveryForm(EMPTY_DELIVERY_FORM);
+    setIsRunsLoading(true);
+    try {
+      const [runsResponse, deliveriesResponse] = await Promise.all([
+        authenticatedFetch(`/api/assistant/scheduled-tasks/${task.id}/runs?limit=20`),
+        authenticatedFetch(`/api/assistant/scheduled-tasks/${task.id}/deliveries`),
+      ]);
+      if (!runsResponse.ok || !deliveriesResponse.ok) {
+        throw new Error('加载执行记录失败');
+      }
+      const data: ListScheduledTaskRunsResponse = await runsResponse.json();
+      setRuns(data.runs || []);
+      const deliveryData: ListScheduledTaskDeliveriesResponse = await deliveriesResponse.json();
+      setDeliveries(deliveryData.deliveries || []);
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '加载执行记录失败', 'error');
+    } finally {
+      setIsRunsLoading(false);
+    }
+  };
+
+  const handleAddDelivery = async (task: ScheduledTaskInfo) => {
+    try {
+      const response = await authenticatedFetch(`/api/assistant/scheduled-tasks/${task.id}/deliveries`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(deliveryForm),
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '添加失败' }));
+        throw new Error(data.error || '添加失败');
+      }
+      const created: ScheduledTaskDeliveryInfo = await response.json();
+      setDeliveries((prev) => [...prev, created]);
+      setDeliveryForm(EMPTY_DELIVERY_FORM);
+      notify('投递目标已添加', 'success');
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '添加失败', 'error');
+    }
+  };
+
+  const handleDeleteDelivery = async (task: ScheduledTaskInfo, delivery: ScheduledTaskDeliveryInfo) => {
+    try {
+      const response = await authenticatedFetch(`/api/assistant/scheduled-tasks/${task.id}/deliveries/${delivery.id}`, {
+        method: 'DELETE',
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '删除失败' }));
+        throw new Error(data.error || '删除失败');
+      }
+      setDeliveries((prev) => prev.filter((d) => d.id !== delivery.id));
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '删除失败', 'error');
+    }
+  };
+
+  const handleRunNow = async (task: ScheduledTaskInfo) => {
+    try {
+      const response = await authenticatedFetch(`/api/assistant/scheduled-tasks/${task.id}/run`, {
+        method: 'POST',
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '执行失败' }));
+        throw new Error(data.error || '执行失败');
+      }
+      notify('已开始执行，稍后可在执行记录中查看结果', 'success');
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '执行失败', 'error');
+    }
+  };
+
   const handleToggleEnabled = async (task: ScheduledTaskInfo) => {
     try {
       const response = await authenticatedFetch(`/api/assistant/scheduled-tasks/${task.id}`, {
@@ -263,10 +462,41 @@ export default function ScheduledTasksPage() {
                               {task.last_run_at && <span>上次执行：{formatDate(task.last_run_at)}</span>}
                               {task.target_email && <span>目标邮箱：{task.target_email}</span>}
                               <span>时区：{task.timezone}</span>
+                              {task.missed_run_policy !== 'run_once' && (
+                                <span>错过执行：{MISSED_RUN_POLICY_LABELS[task.missed_run_policy] ?? task.missed_run_policy}</span>
+                              )}
+                              {task.blackout_dates.length > 0 && (
+                                <span>暂停日期：{task.blackout_dates.map((date) => date.replace('/', ' 至 ')).join('、')}</span>
+                              )}
+                              {task.consecutive_failures > 0 && (
+                                <span className="text-red-400">
+                                  连续失败 {task.consecutive_failures}/{task.failure_threshold} 次
+                                </span>
+                              )}
                             </div>
                           </div>
 
                           <div className="flex shrink-0 gap-2">
+                            <Button
+                              type="button"
+                              variant="ghost"
+                              size="sm"
+                              onClick={() => handleRunNow(task)}
+                              className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                            >
+                              <Play className="mr-1.5 h-3.5 w-3.5" />
+                              立即执行
+                            </Button>
+                            <Button
+                              type="button"
+                              variant="ghost"
+                              size="sm"
+                              onClick={() => handleToggleRuns(task)}
+                              className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                            >
+                              <History className="mr-1.5 h-3.5 w-3.5" />
+                              执行记录
+                            </Button>
                             <Button
                               type="button"
                               variant="ghost"
@@ -288,6 +518,130 @@ export default function ScheduledTasksPage() {
                             </Button>
                           </div>
                         </div>
+                        {expandedTaskId === task.id && (
+                          <div className="mt-4 space-y-2">
+                            <div className="rounded-lg border border-zinc-800 bg-zinc-950 px-4 py-3 text-xs text-zinc-400">
+                              <div className="mb-2 text-zinc-300">结果投递</div>
+                              <div className="space-y-1">
+                                {task.target_email && <div>邮件：{task.target_email}</div>}
+                                {deliveries.map((delivery) => (
+                                  <div key={delivery.id} className="flex items-center gap-2">
+                                    <span>
+                                      {DELIVERY_CHANNEL_LABELS[delivery.channel] ?? delivery.channel}
+                                      {delivery.provider && ` (${delivery.provider})`}
+                                      {delivery.target && `：${delivery.target}`}
+                                    </span>
+                                    <button
+                                      type="button"
+                                      onClick={() => handleDeleteDelivery(task, delivery)}
+                                      className="text-zinc-500 hover:text-red-400"
+                                    >
+                                      移除
+                                    </button>
+                                  </div>
+                                ))}
+                                {!task.target_email && deliveries.length === 0 && <div className="text-zinc-500">暂无投递目标</div>}
+                              </div>
+                              <div className="mt-3 flex flex-wrap items-center gap-2">
+                                <select
+                                  value={deliveryForm.channel}
+                                  onChange={(e) => setDeliveryForm({ ...EMPTY_DELIVERY_FORM, channel: e.target.value as DeliveryChannel })}
+                                  className="rounded-md border border-zinc-700 bg-zinc-900 px-2 py-1 text-zinc-200"
+                                >
+                                  {(Object.keys(DELIVERY_CHANNEL_LABELS) as DeliveryChannel[]).map((channel) => (
+                                    <option key={channel} value={channel}>
+                                      {DELIVERY_CHANNEL_LABELS[channel]}
+                                    </option>
+                                  ))}
+                                </select>
+                                {deliveryForm.channel === 'chat_bot' && (
+                                  <select
+                                    value={deliveryForm.provider}
+                                    onChange={(e) => setDeliveryForm({ ...deliveryForm, provider: e.target.value })}
+                                    className="rounded-md border border-zinc-700 bg-zinc-900 px-2 py-1 text-zinc-200"
+                                  >
+                                    <option value="telegram">Telegram</option>
+                                    <option value="slack">Slack</option>
+                                  </select>
+                                )}
+                                {deliveryForm.channel !== 'in_app' && deliveryForm.channel !== 'web_push' && (
+                                  <input
+                                    value={deliveryForm.target}
+                                    onChange={(e) => setDeliveryForm({ ...deliveryForm, target: e.target.value })}
+                                    placeholder={
+                                      deliveryForm.channel === 'email'
+                                        ? '邮箱地址'
+                                        : deliveryForm.channel === 'webhook'
+                                          ? 'https://example.com/hook'
+                                          : 'Chat ID / Channel ID'
+                                    }
+                                    className="min-w-[200px] flex-1 rounded-md border border-zinc-700 bg-zinc-900 px-2 py-1 text-zinc-200"
+                                  />
+                                )}
+                                {(deliveryForm.channel === 'webhook' || deliveryForm.channel === 'chat_bot') && (
+                                  <input
+                                    type="password"
+                                    value={deliveryForm.secret}
+                                    onChange={(e) => setDeliveryForm({ ...deliveryForm, secret: e.target.value })}
+                                    placeholder={deliveryForm.channel === 'webhook' ? '签名密钥' : 'Bot Token'}
+                                    className="rounded-md border border-zinc-700 bg-zinc-900 px-2 py-1 text-zinc-200"
+                                  />
+                                )}
+                                <Button
+                                  type="button"
+                                  variant="ghost"
+                                  size="sm"
+                                  onClick={() => handleAddDelivery(task)}
+                                  className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                                >
+                                  添加
+                                </Button>
+                              </div>
+                            </div>
+                            {isRunsLoading ? (
+                              <div className="text-xs text-zinc-500">正在加载执行记录...</div>
+                            ) : runs.length === 0 ? (
+                              <div className="text-xs text-zinc-500">暂无执行记录</div>
+                            ) : (
+                              runs.map((run) => {
+                                const runStatus = RUN_STATUS_STYLES[run.status] ?? RUN_STATUS_STYLES.running;
+                                return (
+                                  <div key={run.id} className="rounded-lg border border-zinc-800 bg-zinc-950 px-4 py-3">
+                                    <div className="flex flex-wrap items-center gap-x-3 gap-y-1 text-xs text-zinc-500">
+                                      <span className={cn('rounded-full border px-2 py-0.5', runStatus.className)}>{runStatus.label}</span>
+                                      <span>开始：{formatDate(run.started_at)}</span>
+                                      {run.trigger === 'manual' && <span>手动执行</span>}
+                                      {run.attempt > 1 && <span>第 {run.attempt} 次尝试</span>}
+                                      {run.finished_at && <span>结束：{formatDate(run.finished_at)}</span>}
+                                      {run.tool_calls.length > 0 && (
+                                        <span>工具调用：{run.tool_calls.map((call) => call.name).join('、')}</span>
+                                      )}
+                                      {run.session_id && (
+                                        <Link
+                                          href={`/chat/${run.session_id}?agent=${run.app_name}`}
+                                          className="ml-auto text-zinc-300 underline-offset-2 hover:text-zinc-100 hover:underline"
+                                        >
+                                          查看会话
+                                        </Link>
+                                      )}
+                                    </div>
+                                    {run.error && (
+                                      <p className={cn('mt-2 text-xs', run.status === 'skipped' ? 'text-zinc-400' : 'text-red-400')}>{run.error}</p>
+                                    )}
+                                    {run.deliveries
+                                      .filter((delivery) => delivery.error)
+                                      .map((delivery, index) => (
+                                        <p key={index} className="mt-1 text-xs text-amber-400">
+                                          {DELIVERY_CHANNEL_LABELS[delivery.channel] ?? delivery.channel}投递失败：{delivery.error}
+                                        </p>
+                                      ))}
+                                    {run.output && <p className="mt-2 whitespace-pre-wrap text-xs text-zinc-300 line-clamp-4">{run.output}</p>}
+                                  </div>
+                                );
+                              })
+                            )}
+                          </div>
+                        )}
                       </div>
                     );
                   })}
@@ -0,0 +1,350 @@
+'use client';
+
+import { useState, useEffect, useCallback } from 'react';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Input } from '@/app/components/ui/input';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ArrowLeft, AlertTriangle, BarChart3, Mail, Plus, RotateCcw, ShieldCheck, Trash2 } from 'lucide-react';
+
+type Role = 'admin' | 'member' | 'read_only';
+
+interface AdminUser {
+  id: number;
+  email: string;
+  name: string;
+  role: Role;
+  providers: string[];
+  disabled_at: string | null;
+  last_login_at: string | null;
+  created_at: string;
+}
+
+interface UserUsage {
+  sessions: number;
+  last_session_at: string | null;
+  projects: number;
+  memories: number;
+  scheduled_tasks: number;
+  event_triggers: number;
+  api_tokens: number;
+  files: number;
+  file_bytes: number;
+}
+
+interface AllowedEmail {
+  id: number;
+  email: string;
+  created_at: string;
+}
+
+const ROLE_OPTIONS: { value: Role; label: string }[] = [
+  { value: 'admin', label: '管理员' },
+  { value: 'member', label: '成员' },
+  { value: 'read_only', label: '只读' },
+];
+
+const formatTime = (value: string | null) => (value ? new Date(value).toLocaleString('zh-CN') : '从未');
+
+const formatBytes = (bytes: number) => {
+  if (bytes < 1024) return `${bytes} B`;
+  if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+  return `${(bytes / 1024 / 1024).toFixed(1)} MB`;
+};
+
+function UsageSummary({ usage }: { usage: UserUsage }) {
+  const items = [
+    ['会话', usage.sessions],
+    ['项目', usage.projects],
+    ['记忆', usage.memories],
+    ['定时任务', usage.scheduled_tasks],
+    ['事件触发器', usage.event_triggers],
+    ['API 令牌', usage.api_tokens],
+    ['文件', `${usage.files}（${formatBytes(usage.file_bytes)}）`],
+  ];
+  return (
+    <div className="mt-2 rounded-md bg-muted/50 p-3 text-xs space-y-1">
+      <div className="grid grid-cols-2 gap-x-4 gap-y-1">
+        {items.map(([label, value]) => (
+          <span key={label}>
+            <span className="text-muted-foreground">{label}：</span>
+            {value}
+          </span>
+        ))}
+      </div>
+      <p className="text-muted-foreground">最近会话：{formatTime(usage.last_session_at)}</p>
+    </div>
+  );
+}
+
+export default function AdminSettingsPage() {
+  const router = useRouter();
+  const { user, authenticatedFetch } = useAuth();
+  const [users, setUsers] = useState<AdminUser[]>([]);
+  const [allowedEmails, setAllowedEmails] = useState<AllowedEmail[]>([]);
+  const [usage, setUsage] = useState<Record<number, UserUsage>>({});
+  const [newEmail, setNewEmail] = useState('');
+  const [loading, setLoading] = useState(true);
+  const [actionLoading, setActionLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+  const [message, setMessage] = useState<string | null>(null);
+
+  const fetchData = useCallback(async () => {
+    try {
+      const [userRes, emailRes] = await Promise.all([
+        authenticatedFetch('/api/admin/users'),
+        authenticatedFetch('/api/admin/allowed-emails'),
+      ]);
+      if (userRes.status === 403) throw new Error('只有管理员可以访问此页面');
+      if (!userRes.ok || !emailRes.ok) throw new Error('加载用户失败');
+      setUsers((await userRes.json()).users);
+      setAllowedEmails((await emailRes.json()).allowed_emails);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setLoading(false);
+    }
+  }, [authenticatedFetch]);
+
+  useEffect(() => {
+    if (user) fetchData();
+  }, [user, fetchData]);
+
+  // 执行操作并刷新列表，失败时显示服务器返回的错误
+  const runAction = async (action: () => Promise<Response>, fallbackError: string, successMessage?: string) => {
+    setActionLoading(true);
+    setError(null);
+    setMessage(null);
+    try {
+      const res = await action();
+      if (!res.ok) throw new Error((await res.json()).error || fallbackError);
+      if (successMessage) setMessage(successMessage);
+      await fetchData();
+      return res;
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const updateUser = (target: AdminUser, body: { role?: Role; disabled?: boolean }) =>
+    runAction(
+      () =>
+        authenticatedFetch(`/api/admin/users/${target.id}`, {
+          method: 'PATCH',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify(body),
+        }),
+      '修改用户失败'
+    );
+
+  const handleDeleteUser = (target: AdminUser) => {
+    if (!confirm(`确定删除用户 ${target.email || target.id} 吗？其会话记录、设置与任务将一并删除，且无法恢复。`)) return;
+    runAction(() => authenticatedFetch(`/api/admin/users/${target.id}`, { method: 'DELETE' }), '删除用户失败');
+  };
+
+  const handleToggleUsage = async (target: AdminUser) => {
+    if (usage[target.id]) {
+      setUsage((prev) => {
+        const next = { ...prev };
+        delete next[target.id];
+        return next;
+      });
+      return;
+    }
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/admin/users/${target.id}/usage`);
+      if (!res.ok) throw new Error('加载用量失败');
+      const data: UserUsage = await res.json();
+      setUsage((prev) => ({ ...prev, [target.id]: data }));
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    }
+  };
+
+  const handleResetQuota = (target: AdminUser) =>
+    runAction(
+      () => authenticatedFetch(`/api/admin/users/${target.id}/quota/reset`, { method: 'POST' }),
+      '重置配额失败',
+      `已重置 ${target.email || target.id} 的请求配额`
+    );
+
+  const handleAddEmail = async () => {
+    const addEmail = (confirmed: boolean) =>
+      authenticatedFetch('/api/admin/allowed-emails', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email: newEmail.trim(), confirm: confirmed }),
+      });
+    const res = await runAction(async () => {
+      const res = await addEmail(false);
+      if (res.status !== 409) return res;
+      // 添加首个邮箱需要确认，服务端返回将无法登录的用户数
+      const { affected_users: affected } = await res.clone().json();
+      if (typeof affected !== 'number') return res;
+      if (!confirm(`添加首个邮箱后，只有列表中的邮箱和管理员可以登录，${affected} 个现有用户将无法登录。确定添加吗？`)) {
+        throw new Error('已取消添加');
+      }
+      return addEmail(true);
+    }, '添加邮箱失败');
+    if (res) setNewEmail('');
+  };
+
+  const handleDeleteEmail = (entry: AllowedEmail) =>
+    runAction(() => authenticatedFetch(`/api/admin/allowed-emails/${entry.id}`, { method: 'DELETE' }), '删除邮箱失败');
+
+  return (
+    <div className="min-h-screen bg-background p-6">
+      <div className="max-w-3xl mx-auto space-y-6">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="sm" onClick={() => router.back()}>
+            <ArrowLeft className="h-4 w-4 mr-1" />
+            返回
+          </Button>
+          <div className="flex items-center gap-2">
+            <ShieldCheck className="h-5 w-5" />
+            <h1 className="text-xl font-semibold">用户管理</h1>
+          </div>
+        </div>
+
+        {error && (
+          <Alert variant="destructive">
+            <AlertTriangle className="h-4 w-4" />
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+        {message && (
+          <Alert>
+            <AlertDescription>{message}</AlertDescription>
+          </Alert>
+        )}
+
+        <Card>
+          <CardHeader>
+            <CardTitle>用户</CardTitle>
+            <CardDescription>
+              管理员可以管理用户与允许登录的邮箱；成员可以正常使用；只读成员只能查看，不能发起对话或修改数据。停用后用户立即无法访问。
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            {loading ? (
+              <p className="text-sm text-muted-foreground">加载中...</p>
+            ) : (
+              users.map((target) => {
+                const isSelf = String(target.id) === String(user?.user_id);
+                return (
+                  <div key={target.id} className="rounded-md border p-3 text-sm">
+                    <div className="flex flex-wrap items-center gap-3">
+                      <div className="min-w-0 flex-1">
+                        <p className="truncate font-medium">
+                          {target.name || target.email}
+                          {isSelf && <span className="ml-2 text-xs text-muted-foreground">（我）</span>}
+                          {target.disabled_at && <span className="ml-2 text-xs text-destructive">已停用</span>}
+                        </p>
+                        <p className="truncate text-xs text-muted-foreground">
+                          {target.email} · {target.providers.join('、') || '无登录方式'} · 最近登录 {formatTime(target.last_login_at)}
+                        </p>
+                      </div>
+                      <select
+                        className="rounded-md border bg-background px-2 py-1 text-sm"
+                        value={target.role}
+                        disabled={isSelf || actionLoading}
+                        onChange={(e) => updateUser(target, { role: e.target.value as Role })}
+                        aria-label="角色"
+                      >
+                        {ROLE_OPTIONS.map((option) => (
+                          <option key={option.value} value={option.value}>
+                            {option.label}
+                          </option>
+                        ))}
+                      </select>
+                      <Button
+                        variant="outline"
+                        size="sm"
+                        disabled={isSelf || actionLoading}
+                        onClick={() => updateUser(target, { disabled: !target.disabled_at })}
+                      >
+                        {target.disabled_at ? '启用' : '停用'}
+                      </Button>
+                      <Button variant="ghost" size="sm" onClick={() => handleToggleUsage(target)} aria-label="查看用量">
+                        <BarChart3 className="h-4 w-4" />
+                      </Button>
+                      <Button
+                        variant="ghost"
+                        size="sm"
+                        disabled={actionLoading}
+                        onClick={() => handleResetQuota(target)}
+                        aria-label="重置请求配额"
+                      >
+                        <RotateCcw className="h-4 w-4" />
+                      </Button>
+                      <Button
+                        variant="ghost"
+                        size="sm"
+                        disabled={isSelf || actionLoading}
+                        onClick={() => handleDeleteUser(target)}
+                        className="text-destructive hover:text-destructive"
+                        aria-label="删除用户"
+                      >
+                        <Trash2 className="h-4 w-4" />
+                      </Button>
+                    </div>
+                    {usage[target.id] && <UsageSummary usage={usage[target.id]} />}
+                  </div>
+                );
+              })
+            )}
+          </CardContent>
+        </Card>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>允许登录的邮箱</CardTitle>
+            <CardDescription>
+              列表为空时任何人都可以登录；添加邮箱后只有列表中的邮箱可以登录或注册，管理员不受限制，且列表至少保留一个邮箱。修改立即生效。
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            <div className="flex gap-2">
+              <Input
+                type="email"
+                value={newEmail}
+                onChange={(e) => setNewEmail(e.target.value)}
+                placeholder="user@example.com"
+              />
+              <Button onClick={handleAddEmail} disabled={actionLoading || !newEmail.trim()}>
+                <Plus className="h-4 w-4 mr-2" />
+                添加
+              </Button>
+            </div>
+            {allowedEmails.length ? (
+              allowedEmails.map((entry) => (
+                <div key={entry.id} className="flex items-center gap-3 rounded-md border p-3 text-sm">
+                  <Mail className="h-4 w-4 text-muted-foreground flex-shrink-0" />
+                  <span className="min-w-0 flex-1 truncate">{entry.email}</span>
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    onClick={() => handleDeleteEmail(entry)}
+                    disabled={actionLoading || allowedEmails.length === 1}
+                    title={allowedEmails.length === 1 ? '至少保留一个邮箱' : undefined}
+                    className="text-destructive hover:text-destructive"
+                    aria-label="删除邮箱"
+                  >
+                    <Trash2 className="h-4 w-4" />
+                  </Button>
+                </div>
+              ))
+            ) : (
+              !loading && <p className="text-sm text-muted-foreground">列表为空，任何人都可以登录。</p>
+            )}
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,277 @@
+'use client';
+
+import { useState, useEffect, useCallback } from 'react';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Input } from '@/app/components/ui/input';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ArrowLeft, AlertTriangle, Ban, Copy, KeyRound, Trash2 } from 'lucide-react';
+
+type Scope = 'chat' | 'files' | 'memories' | 'scheduled_tasks' | 'admin';
+
+interface APIToken {
+  id: number;
+  name: string;
+  prefix: string;
+  token?: string;
+  scopes: Scope[];
+  expires_at: string | null;
+  last_used_at: string | null;
+  revoked_at: string | null;
+  created_at: string;
+}
+
+const SCOPES: { value: Scope; label: string; description: string }[] = [
+  { value: 'chat', label: '对话', description: '对话、会话、项目、MCP 与 OpenAI 兼容接口' },
+  { value: 'files', label: '文件', description: '下载生成与上传的文件' },
+  { value: 'memories', label: '记忆', description: '读取和管理记忆' },
+  { value: 'scheduled_tasks', label: '定时任务', description: '定时任务与事件触发器' },
+  { value: 'admin', label: '管理', description: '全部接口，包括设置与令牌管理' },
+];
+
+const EXPIRY_OPTIONS = [
+  { days: 30, label: '30 天' },
+  { days: 90, label: '90 天' },
+  { days: 365, label: '1 年' },
+  { days: 0, label: '永不过期' },
+];
+
+const formatTime = (value: string | null) => (value ? new Date(value).toLocaleString('zh-CN') : '—');
+
+export default function APITokenSettingsPage() {
+  const router = useRouter();
+  const { user, authenticatedFetch } = useAuth();
+  const [tokens, setTokens] = useState<APIToken[]>([]);
+  const [name, setName] = useState('');
+  const [scopes, setScopes] = useState<Scope[]>(['chat']);
+  const [expiryDays, setExpiryDays] = useState(90);
+  const [created, setCreated] = useState<APIToken | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [actionLoading, setActionLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  const fetchTokens = useCallback(async () => {
+    try {
+      const res = await authenticatedFetch('/api/api_tokens');
+      if (!res.ok) throw new Error('加载 API 令牌失败');
+      setTokens((await res.json()).tokens);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setLoading(false);
+    }
+  }, [authenticatedFetch]);
+
+  useEffect(() => {
+    if (user) fetchTokens();
+  }, [user, fetchTokens]);
+
+  const toggleScope = (scope: Scope) => {
+    setScopes((prev) => (prev.includes(scope) ? prev.filter((s) => s !== scope) : [...prev, scope]));
+  };
+
+  const handleCreate = async () => {
+    setActionLoading(true);
+    setError(null);
+    try {
+      const expiresAt = expiryDays > 0 ? new Date(Date.now() + expiryDays * 24 * 60 * 60 * 1000).toISOString() : null;
+      const res = await authenticatedFetch('/api/api_tokens', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name: name.trim(), scopes, expires_at: expiresAt }),
+      });
+      if (!res.ok) throw new Error((await res.json()).error || '创建 API 令牌失败');
+      setCreated(await res.json());
+      setName('');
+      await fetchTokens();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleRevoke = async (token: APIToken) => {
+    if (!confirm(`确定撤销令牌「${token.name}」吗？使用它的脚本将无法再访问。`)) return;
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/api_tokens/${token.id}/revoke`, { method: 'POST' });
+      if (!res.ok) throw new Error('撤销令牌失败');
+      await fetchTokens();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleDelete = async (token: APIToken) => {
+    if (!confirm(`确定删除令牌「${token.name}」吗？`)) return;
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/api_tokens/${token.id}`, { method: 'DELETE' });
+      if (!res.ok) throw new Error('删除令牌失败');
+      await fetchTokens();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const tokenStatus = (token: APIToken) => {
+    if (token.revoked_at) return '已撤销';
+    if (token.expires_at && new Date(token.expires_at) <= new Date()) return '已过期';
+    return null;
+  };
+
+  return (
+    <div className="min-h-screen bg-background p-6">
+      <div className="max-w-2xl mx-auto space-y-6">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="sm" onClick={() => router.back()}>
+            <ArrowLeft className="h-4 w-4 mr-1" />
+            返回
+          </Button>
+          <div className="flex items-center gap-2">
+            <KeyRound className="h-5 w-5" />
+            <h1 className="text-xl font-semibold">API 令牌</h1>
+          </div>
+        </div>
+
+        {error && (
+          <Alert variant="destructive">
+            <AlertTriangle className="h-4 w-4" />
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        <Card>
+          <CardHeader>
+            <CardTitle>创建令牌</CardTitle>
+            <CardDescription>
+              在脚本或自动化工具中通过 <code>Authorization: Bearer &lt;令牌&gt;</code> 访问接口，令牌只能访问所选权限范围内的接口。
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            <div>
+              <label className="block text-sm font-medium mb-2">名称</label>
+              <Input value={name} onChange={(e) => setName(e.target.value)} placeholder="例如：备份脚本" />
+            </div>
+            <div>
+              <label className="block text-sm font-medium mb-2">权限范围</label>
+              <div className="space-y-2">
+                {SCOPES.map((scope) => (
+                  <label key={scope.value} className="flex items-start gap-2 text-sm">
+                    <input
+                      type="checkbox"
+                      className="mt-1"
+                      checked={scopes.includes(scope.value)}
+                      onChange={() => toggleScope(scope.value)}
+                    />
+                    <span>
+                      {scope.label}
+                      <span className="ml-2 text-muted-foreground">{scope.description}</span>
+                    </span>
+                  </label>
+                ))}
+              </div>
+            </div>
+            <div>
+              <label className="block text-sm font-medium mb-2">有效期</label>
+              <select
+                className="w-full rounded-md border bg-background px-3 py-2 text-sm"
+                value={expiryDays}
+                onChange={(e) => setExpiryDays(Number(e.target.value))}
+              >
+                {EXPIRY_OPTIONS.map((option) => (
+                  <option key={option.days} value={option.days}>
+                    {option.label}
+                  </option>
+                ))}
+              </select>
+            </div>
+            <Button onClick={handleCreate} disabled={actionLoading || !name.trim() || scopes.length === 0}>
+              <KeyRound className="h-4 w-4 mr-2" />
+              创建令牌
+            </Button>
+            {created?.token && (
+              <div className="rounded-md border p-4 space-y-2">
+                <div className="flex items-center gap-2">
+                  <code className="text-sm font-mono break-all">{created.token}</code>
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    onClick={() => navigator.clipboard.writeText(created.token ?? '')}
+                    aria-label="复制令牌"
+                  >
+                    <Copy className="h-4 w-4" />
+                  </Button>
+                </div>
+                <p className="text-sm text-muted-foreground">请立即复制并妥善保存，令牌只显示这一次。</p>
+              </div>
+            )}
+          </CardContent>
+        </Card>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>我的令牌</CardTitle>
+            <CardDescription>撤销后令牌立即失效，但仍保留在列表中以便查看最近使用时间。</CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            {loading ? (
+              <p className="text-sm text-muted-foreground">加载中...</p>
+            ) : tokens.length ? (
+              tokens.map((token) => (
+                <div key={token.id} className="flex items-center gap-3 rounded-md border p-3 text-sm">
+                  <KeyRound className="h-4 w-4 text-muted-foreground flex-shrink-0" />
+                  <div className="min-w-0 flex-1">
+                    <p className="truncate">
+                      {token.name}
+                      <code className="ml-2 text-muted-foreground">{token.prefix}…</code>
+                      {tokenStatus(token) && <span className="ml-2 text-destructive">{tokenStatus(token)}</span>}
+                    </p>
+                    <p className="text-xs text-muted-foreground">
+                      权限：{token.scopes.map((s) => SCOPES.find((scope) => scope.value === s)?.label ?? s).join('、')}
+                    </p>
+                    <p className="text-xs text-muted-foreground">
+                      过期：{token.expires_at ? formatTime(token.expires_at) : '永不过期'} · 最近使用：{formatTime(token.last_used_at)}
+                    </p>
+                  </div>
+                  {!token.revoked_at && (
+                    <Button
+                      variant="ghost"
+                      size="sm"
+                      onClick={() => handleRevoke(token)}
+                      disabled={actionLoading}
+                      aria-label="撤销令牌"
+                    >
+                      <Ban className="h-4 w-4" />
+                    </Button>
+                  )}
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    onClick={() => handleDelete(token)}
+                    disabled={actionLoading}
+                    className="text-destructive hover:text-destructive"
+                    aria-label="删除令牌"
+                  >
+                    <Trash2 className="h-4 w-4" />
+                  </Button>
+                </div>
+              ))
+            ) : (
+              <p className="text-sm text-muted-foreground">还没有创建 API 令牌。</p>
+            )}
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
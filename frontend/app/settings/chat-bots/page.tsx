@@ -0,0 +1,194 @@
+'use client';
+
+import { useState, useEffect, useCallback } from 'react';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ArrowLeft, AlertTriangle, Copy, KeyRound, MessageCircle, Trash2 } from 'lucide-react';
+
+interface ChatBotLink {
+  id: number;
+  provider: string;
+  external_user_id: string;
+  external_name: string;
+  created_at: string;
+}
+
+interface ChatBotStatus {
+  providers: string[];
+  links: ChatBotLink[];
+}
+
+interface PairingCode {
+  code: string;
+  expires_at: string;
+}
+
+const PROVIDER_LABELS: Record<string, string> = {
+  telegram: 'Telegram',
+  slack: 'Slack',
+};
+
+export default function ChatBotSettingsPage() {
+  const router = useRouter();
+  const { user, authenticatedFetch } = useAuth();
+  const [status, setStatus] = useState<ChatBotStatus | null>(null);
+  const [pairing, setPairing] = useState<PairingCode | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [actionLoading, setActionLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  const fetchStatus = useCallback(async () => {
+    try {
+      const res = await authenticatedFetch('/api/assistant/chat-bots');
+      if (!res.ok) throw new Error('加载聊天机器人设置失败');
+      setStatus(await res.json());
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setLoading(false);
+    }
+  }, [authenticatedFetch]);
+
+  useEffect(() => {
+    if (user) fetchStatus();
+  }, [user, fetchStatus]);
+
+  const handleCreateCode = async () => {
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch('/api/assistant/chat-bots/pairing-codes', { method: 'POST' });
+      if (!res.ok) throw new Error((await res.json()).error || '生成配对码失败');
+      setPairing(await res.json());
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleUnlink = async (link: ChatBotLink) => {
+    if (!confirm(`确定解除与 ${PROVIDER_LABELS[link.provider] ?? link.provider} 账号 ${link.external_name || link.external_user_id} 的关联吗？`)) return;
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/assistant/chat-bots/links/${link.id}`, { method: 'DELETE' });
+      if (!res.ok) throw new Error('解除关联失败');
+      await fetchStatus();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const enabled = (status?.providers.length ?? 0) > 0;
+
+  return (
+    <div className="min-h-screen bg-background p-6">
+      <div className="max-w-2xl mx-auto space-y-6">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="sm" onClick={() => router.back()}>
+            <ArrowLeft className="h-4 w-4 mr-1" />
+            返回
+          </Button>
+          <div className="flex items-center gap-2">
+            <MessageCircle className="h-5 w-5" />
+            <h1 className="text-xl font-semibold">聊天机器人</h1>
+          </div>
+        </div>
+
+        {error && (
+          <Alert variant="destructive">
+            <AlertTriangle className="h-4 w-4" />
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        <Card>
+          <CardHeader>
+            <CardTitle>关联聊天账号</CardTitle>
+            <CardDescription>
+              关联后可以在 {status?.providers.map((p) => PROVIDER_LABELS[p] ?? p).join(' / ') || 'Telegram 或 Slack'} 中直接与助手对话，
+              支持发送图片、PDF 和音频文件，对话记录同步显示在会话列表中。
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {loading ? (
+              <p className="text-sm text-muted-foreground">加载中...</p>
+            ) : !enabled ? (
+              <p className="text-sm text-muted-foreground">服务器未启用聊天机器人，请联系管理员配置 chat_bots。</p>
+            ) : (
+              <div className="space-y-4">
+                <Button onClick={handleCreateCode} disabled={actionLoading}>
+                  <KeyRound className="h-4 w-4 mr-2" />
+                  生成配对码
+                </Button>
+                {pairing && (
+                  <div className="rounded-md border p-4 space-y-2">
+                    <div className="flex items-center gap-2">
+                      <code className="text-2xl font-mono tracking-widest">{pairing.code}</code>
+                      <Button
+                        variant="ghost"
+                        size="sm"
+                        onClick={() => navigator.clipboard.writeText(`/pair ${pairing.code}`)}
+                        aria-label="复制配对命令"
+                      >
+                        <Copy className="h-4 w-4" />
+                      </Button>
+                    </div>
+                    <p className="text-sm text-muted-foreground">
+                      向机器人发送 <code>/pair {pairing.code}</code>（Slack 中发送 <code>pair {pairing.code}</code>）完成关联，
+                      配对码将于 {new Date(pairing.expires_at).toLocaleTimeString('zh-CN')} 失效，且只能使用一次。
+                    </p>
+                  </div>
+                )}
+                <p className="text-sm text-muted-foreground">
+                  关联后发送 <code>/new</code> 可开始新的对话。在 Slack 频道中 @机器人 时，每个消息串是一段独立的对话。
+                </p>
+              </div>
+            )}
+          </CardContent>
+        </Card>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>已关联的账号</CardTitle>
+            <CardDescription>解除关联后机器人将不再回复该账号的消息。</CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            {status?.links.length ? (
+              status.links.map((link) => (
+                <div key={link.id} className="flex items-center gap-3 rounded-md border p-3 text-sm">
+                  <MessageCircle className="h-4 w-4 text-muted-foreground flex-shrink-0" />
+                  <div className="min-w-0 flex-1">
+                    <p className="truncate">
+                      {PROVIDER_LABELS[link.provider] ?? link.provider}
+                      <span className="ml-2 text-muted-foreground">{link.external_name || link.external_user_id}</span>
+                    </p>
+                    <p className="text-xs text-muted-foreground">关联于：{new Date(link.created_at).toLocaleString('zh-CN')}</p>
+                  </div>
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    onClick={() => handleUnlink(link)}
+                    disabled={actionLoading}
+                    className="text-destructive hover:text-destructive"
+                    aria-label="解除关联"
+                  >
+                    <Trash2 className="h-4 w-4" />
+                  </Button>
+                </div>
+              ))
+            ) : (
+              <p className="text-sm text-muted-foreground">还没有关联的聊天账号。</p>
+            )}
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,275 @@
+'use client';
+
+import { useState, useEffect, useCallback } from 'react';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Input } from '@/app/components/ui/input';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ArrowLeft, AlertTriangle, Copy, Ticket, Trash2, UserPlus } from 'lucide-react';
+
+interface Invite {
+  id: number;
+  prefix: string;
+  email: string;
+  expires_at: string;
+  used_at: string | null;
+  created_at: string;
+}
+
+interface CreatedAccount {
+  user_id: number;
+  setup_url: string;
+  expires_at: string;
+}
+
+const EXPIRY_OPTIONS = [
+  { days: 1, label: '1 天' },
+  { days: 7, label: '7 天' },
+  { days: 30, label: '30 天' },
+];
+
+const formatTime = (value: string) => new Date(value).toLocaleString('zh-CN');
+
+function CopyableValue({ value, label }: { value: string; label: string }) {
+  return (
+    <div className="flex items-center gap-2">
+      <code className="text-sm font-mono break-all">{value}</code>
+      <Button variant="ghost" size="sm" onClick={() => navigator.clipboard.writeText(value)} aria-label={label}>
+        <Copy className="h-4 w-4" />
+      </Button>
+    </div>
+  );
+}
+
+export default function InviteSettingsPage() {
+  const router = useRouter();
+  const { user, authenticatedFetch } = useAuth();
+  const [enabled, setEnabled] = useState(true);
+  const [invites, setInvites] = useState<Invite[]>([]);
+  const [inviteEmail, setInviteEmail] = useState('');
+  const [expiryDays, setExpiryDays] = useState(7);
+  const [createdCode, setCreatedCode] = useState<string | null>(null);
+  const [accountEmail, setAccountEmail] = useState('');
+  const [accountName, setAccountName] = useState('');
+  const [createdAccount, setCreatedAccount] = useState<CreatedAccount | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [actionLoading, setActionLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  const fetchInvites = useCallback(async () => {
+    try {
+      const [inviteRes, providerRes] = await Promise.all([
+        authenticatedFetch('/api/auth/invites'),
+        fetch('/api/auth/providers'),
+      ]);
+      if (!inviteRes.ok || !providerRes.ok) throw new Error('加载邀请码失败');
+      setInvites((await inviteRes.json()).invites);
+      setEnabled((await providerRes.json()).local_accounts?.enabled ?? false);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setLoading(false);
+    }
+  }, [authenticatedFetch]);
+
+  useEffect(() => {
+    if (user) fetchInvites();
+  }, [user, fetchInvites]);
+
+  const handleCreateInvite = async () => {
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch('/api/auth/invites', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email: inviteEmail.trim(), expires_in_days: expiryDays }),
+      });
+      if (!res.ok) throw new Error((await res.json()).error || '创建邀请码失败');
+      setCreatedCode((await res.json()).code);
+      setInviteEmail('');
+      await fetchInvites();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleDeleteInvite = async (invite: Invite) => {
+    if (!confirm(`确定删除邀请码 ${invite.prefix}-… 吗？`)) return;
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/auth/invites/${invite.id}`, { method: 'DELETE' });
+      if (!res.ok) throw new Error('删除邀请码失败');
+      await fetchInvites();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleCreateAccount = async () => {
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch('/api/auth/local/accounts', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email: accountEmail.trim(), name: accountName.trim() }),
+      });
+      if (res.status === 409) throw new Error('该邮箱已注册');
+      if (!res.ok) throw new Error((await res.json()).error || '创建账户失败');
+      setCreatedAccount(await res.json());
+      setAccountEmail('');
+      setAccountName('');
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const inviteStatus = (invite: Invite) => {
+    if (invite.used_at) return `已于 ${formatTime(invite.used_at)} 使用`;
+    if (new Date(invite.expires_at) <= new Date()) return '已过期';
+    return `有效期至 ${formatTime(invite.expires_at)}`;
+  };
+
+  return (
+    <div className="min-h-screen bg-background p-6">
+      <div className="max-w-2xl mx-auto space-y-6">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="sm" onClick={() => router.back()}>
+            <ArrowLeft className="h-4 w-4 mr-1" />
+            返回
+          </Button>
+          <div className="flex items-center gap-2">
+            <UserPlus className="h-5 w-5" />
+            <h1 className="text-xl font-semibold">邀请与账户</h1>
+          </div>
+        </div>
+
+        {error && (
+          <Alert variant="destructive">
+            <AlertTriangle className="h-4 w-4" />
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        {!loading && !enabled ? (
+          <p className="text-sm text-muted-foreground">服务器未启用本地账号（local_accounts），无法邀请或创建账户。</p>
+        ) : (
+          <>
+            <Card>
+              <CardHeader>
+                <CardTitle>创建邀请码</CardTitle>
+                <CardDescription>对方在登录页注册账户时填写邀请码，每个邀请码只能使用一次。</CardDescription>
+              </CardHeader>
+              <CardContent className="space-y-4">
+                <div>
+                  <label className="block text-sm font-medium mb-2">限定邮箱（可选）</label>
+                  <Input
+                    type="email"
+                    value={inviteEmail}
+                    onChange={(e) => setInviteEmail(e.target.value)}
+                    placeholder="留空则任意邮箱可用"
+                  />
+                </div>
+                <div>
+                  <label className="block text-sm font-medium mb-2">有效期</label>
+                  <select
+                    className="w-full rounded-md border bg-background px-3 py-2 text-sm"
+                    value={expiryDays}
+                    onChange={(e) => setExpiryDays(Number(e.target.value))}
+                  >
+                    {EXPIRY_OPTIONS.map((option) => (
+                      <option key={option.days} value={option.days}>
+                        {option.label}
+                      </option>
+                    ))}
+                  </select>
+                </div>
+                <Button onClick={handleCreateInvite} disabled={actionLoading}>
+                  <Ticket className="h-4 w-4 mr-2" />
+                  创建邀请码
+                </Button>
+                {createdCode && (
+                  <div className="rounded-md border p-4 space-y-2">
+                    <CopyableValue value={createdCode} label="复制邀请码" />
+                    <p className="text-sm text-muted-foreground">请立即复制并发送给对方，邀请码只显示这一次。</p>
+                  </div>
+                )}
+              </CardContent>
+            </Card>
+
+            <Card>
+              <CardHeader>
+                <CardTitle>我的邀请码</CardTitle>
+              </CardHeader>
+              <CardContent className="space-y-2">
+                {loading ? (
+                  <p className="text-sm text-muted-foreground">加载中...</p>
+                ) : invites.length ? (
+                  invites.map((invite) => (
+                    <div key={invite.id} className="flex items-center gap-3 rounded-md border p-3 text-sm">
+                      <Ticket className="h-4 w-4 text-muted-foreground flex-shrink-0" />
+                      <div className="min-w-0 flex-1">
+                        <p className="truncate">
+                          <code>{invite.prefix}-…</code>
+                          <span className="ml-2 text-muted-foreground">{invite.email || '任意邮箱'}</span>
+                        </p>
+                        <p className="text-xs text-muted-foreground">{inviteStatus(invite)}</p>
+                      </div>
+                      <Button
+                        variant="ghost"
+                        size="sm"
+                        onClick={() => handleDeleteInvite(invite)}
+                        disabled={actionLoading}
+                        className="text-destructive hover:text-destructive"
+                        aria-label="删除邀请码"
+                      >
+                        <Trash2 className="h-4 w-4" />
+                      </Button>
+                    </div>
+                  ))
+                ) : (
+                  <p className="text-sm text-muted-foreground">还没有创建邀请码。</p>
+                )}
+              </CardContent>
+            </Card>
+
+            <Card>
+              <CardHeader>
+                <CardTitle>创建账户</CardTitle>
+                <CardDescription>
+                  直接为对方创建账户，并生成 7 天内有效的设置密码链接。服务器配置了 SMTP 时链接会同时发送到对方邮箱。
+                </CardDescription>
+              </CardHeader>
+              <CardContent className="space-y-4">
+                <Input type="email" value={accountEmail} onChange={(e) => setAccountEmail(e.target.value)} placeholder="邮箱" />
+                <Input value={accountName} onChange={(e) => setAccountName(e.target.value)} placeholder="名称（可选）" />
+                <Button onClick={handleCreateAccount} disabled={actionLoading || !accountEmail.trim()}>
+                  <UserPlus className="h-4 w-4 mr-2" />
+                  创建账户
+                </Button>
+                {createdAccount && (
+                  <div className="rounded-md border p-4 space-y-2">
+                    <CopyableValue value={createdAccount.setup_url} label="复制设置密码链接" />
+                    <p className="text-sm text-muted-foreground">
+                      设置密码链接有效期至 {formatTime(createdAccount.expires_at)}，只显示这一次。
+                    </p>
+                  </div>
+                )}
+              </CardContent>
+            </Card>
+          </>
+        )}
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,242 @@
+'use client';
+
+import { Suspense, useState, useEffect, useCallback, type FormEvent } from 'react';
+import { useRouter, useSearchParams } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Input } from '@/app/components/ui/input';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ArrowLeft, AlertTriangle, KeyRound, Link2, Trash2, UserRound } from 'lucide-react';
+
+interface LoginProvider {
+  name: string;
+  display_name: string;
+}
+
+interface Identity {
+  id: number;
+  provider: string;
+  display_name: string;
+  email: string;
+  name: string;
+  created_at: string;
+}
+
+function LoginMethodsSettings() {
+  const router = useRouter();
+  const searchParams = useSearchParams();
+  const { user, authenticatedFetch } = useAuth();
+  const [identities, setIdentities] = useState<Identity[]>([]);
+  const [providers, setProviders] = useState<LoginProvider[]>([]);
+  const [localEnabled, setLocalEnabled] = useState(false);
+  const [currentPassword, setCurrentPassword] = useState('');
+  const [newPassword, setNewPassword] = useState('');
+  const [passwordMessage, setPasswordMessage] = useState<string | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [actionLoading, setActionLoading] = useState(false);
+  const [error, setError] = useState<string | null>(
+    searchParams.get('error') === 'identity_in_use' ? '该账号已关联到其他用户，请先使用它登录并解除关联。' : null
+  );
+
+  const fetchIdentities = useCallback(async () => {
+    try {
+      const [identityRes, providerRes] = await Promise.all([
+        authenticatedFetch('/api/auth/identities'),
+        fetch('/api/auth/providers'),
+      ]);
+      if (!identityRes.ok || !providerRes.ok) throw new Error('加载登录方式失败');
+      setIdentities((await identityRes.json()).identities);
+      const providerData = await providerRes.json();
+      setProviders(providerData.providers);
+      setLocalEnabled(providerData.local_accounts?.enabled ?? false);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setLoading(false);
+    }
+  }, [authenticatedFetch]);
+
+  useEffect(() => {
+    if (user) fetchIdentities();
+  }, [user, fetchIdentities]);
+
+  const handleLink = async (provider: LoginProvider) => {
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/auth/identities/${encodeURIComponent(provider.name)}`, { method: 'POST' });
+      if (!res.ok) throw new Error((await res.json()).error || '关联失败');
+      window.location.href = (await res.json()).url;
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+      setActionLoading(false);
+    }
+  };
+
+  const handleUnlink = async (identity: Identity) => {
+    if (!confirm(`确定解除 ${identity.display_name} 账号 ${identity.email || identity.name} 的关联吗？解除后将无法使用它登录。`)) return;
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/auth/identities/${identity.id}`, { method: 'DELETE' });
+      if (res.status === 409) throw new Error('至少需要保留一个登录方式');
+      if (!res.ok) throw new Error('解除关联失败');
+      await fetchIdentities();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const hasPassword = identities.some((identity) => identity.provider === 'local');
+
+  const handleChangePassword = async (e: FormEvent) => {
+    e.preventDefault();
+    setActionLoading(true);
+    setError(null);
+    setPasswordMessage(null);
+    try {
+      const res = await authenticatedFetch('/api/auth/local/password', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ current_password: currentPassword, new_password: newPassword }),
+      });
+      if (res.status === 403) throw new Error('当前密码错误');
+      if (res.status === 409) throw new Error('账户邮箱已被其他账户用于密码登录');
+      if (!res.ok) throw new Error((await res.json()).error || '设置密码失败');
+      setCurrentPassword('');
+      setNewPassword('');
+      setPasswordMessage(hasPassword ? '密码已修改' : '密码已设置，现在可以使用账户邮箱和密码登录');
+      await fetchIdentities();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-background p-6">
+      <div className="max-w-2xl mx-auto space-y-6">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="sm" onClick={() => router.back()}>
+            <ArrowLeft className="h-4 w-4 mr-1" />
+            返回
+          </Button>
+          <div className="flex items-center gap-2">
+            <UserRound className="h-5 w-5" />
+            <h1 className="text-xl font-semibold">登录方式</h1>
+          </div>
+        </div>
+
+        {error && (
+          <Alert variant="destructive">
+            <AlertTriangle className="h-4 w-4" />
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        <Card>
+          <CardHeader>
+            <CardTitle>已关联的账号</CardTitle>
+            <CardDescription>可以使用以下任意账号登录，它们对应同一个 AIGuide 账户。</CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            {loading ? (
+              <p className="text-sm text-muted-foreground">加载中...</p>
+            ) : (
+              identities.map((identity) => (
+                <div key={identity.id} className="flex items-center gap-3 rounded-md border p-3 text-sm">
+                  <UserRound className="h-4 w-4 text-muted-foreground flex-shrink-0" />
+                  <div className="min-w-0 flex-1">
+                    <p className="truncate">
+                      {identity.display_name}
+                      <span className="ml-2 text-muted-foreground">{identity.email || identity.name}</span>
+                    </p>
+                    <p className="text-xs text-muted-foreground">关联于：{new Date(identity.created_at).toLocaleString('zh-CN')}</p>
+                  </div>
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    onClick={() => handleUnlink(identity)}
+                    disabled={actionLoading || identities.length <= 1}
+                    className="text-destructive hover:text-destructive"
+                    aria-label="解除关联"
+                  >
+                    <Trash2 className="h-4 w-4" />
+                  </Button>
+                </div>
+              ))
+            )}
+          </CardContent>
+        </Card>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>关联新的登录方式</CardTitle>
+            <CardDescription>将跳转到对应的登录页面完成授权，授权后即可使用该账号登录。</CardDescription>
+          </CardHeader>
+          <CardContent className="flex flex-wrap gap-2">
+            {providers.map((provider) => (
+              <Button key={provider.name} variant="outline" onClick={() => handleLink(provider)} disabled={actionLoading}>
+                <Link2 className="h-4 w-4 mr-2" />
+                {provider.display_name}
+              </Button>
+            ))}
+          </CardContent>
+        </Card>
+
+        {localEnabled && (
+          <Card>
+            <CardHeader>
+              <CardTitle>{hasPassword ? '修改密码' : '设置密码'}</CardTitle>
+              <CardDescription>
+                {hasPassword ? '修改使用邮箱密码登录时的密码。' : '设置密码后可以使用账户邮箱和密码登录。'}
+              </CardDescription>
+            </CardHeader>
+            <CardContent>
+              <form onSubmit={handleChangePassword} className="space-y-3">
+                {hasPassword && (
+                  <Input
+                    type="password"
+                    placeholder="当前密码"
+                    value={currentPassword}
+                    onChange={(e) => setCurrentPassword(e.target.value)}
+                    required
+                    autoComplete="current-password"
+                  />
+                )}
+                <Input
+                  type="password"
+                  placeholder="新密码（至少 8 个字符）"
+                  value={newPassword}
+                  onChange={(e) => setNewPassword(e.target.value)}
+                  required
+                  minLength={8}
+                  autoComplete="new-password"
+                />
+                <div className="flex items-center gap-3">
+                  <Button type="submit" variant="outline" disabled={actionLoading}>
+                    <KeyRound className="h-4 w-4 mr-2" />
+                    {hasPassword ? '修改密码' : '设置密码'}
+                  </Button>
+                  {passwordMessage && <span className="text-sm text-muted-foreground">{passwordMessage}</span>}
+                </div>
+              </form>
+            </CardContent>
+          </Card>
+        )}
+      </div>
+    </div>
+  );
+}
+
+export default function LoginMethodsSettingsPage() {
+  return (
+    <Suspense>
+      <LoginMethodsSettings />
+    </Suspense>
+  );
+}
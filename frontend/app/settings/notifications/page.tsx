@@ -0,0 +1,263 @@
+'use client';
+
+import { useState, useEffect, useCallback } from 'react';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ArrowLeft, AlertTriangle, Bell, BellOff, Monitor, Trash2 } from 'lucide-react';
+
+interface PushSubscriptionInfo {
+  id: number;
+  endpoint: string;
+  device_name: string;
+  last_success_at?: string;
+  created_at: string;
+}
+
+interface PushStatus {
+  enabled: boolean;
+  public_key?: string;
+  subscriptions: PushSubscriptionInfo[];
+}
+
+interface NotificationPreference {
+  kind: string;
+  web_push: boolean;
+}
+
+const KIND_LABELS: Record<string, string> = {
+  scheduled_task_run: '定时任务执行结果',
+  event_trigger_run: '事件触发器运行',
+  audio_transcription: '长音频转写完成',
+  video_generation: '视频生成完成',
+};
+
+// urlBase64ToUint8Array converts the VAPID public key for PushManager.subscribe().
+function urlBase64ToUint8Array(value: string) {
+  const padded = (value + '='.repeat((4 - (value.length % 4)) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+  const raw = atob(padded);
+  return Uint8Array.from(raw, (c) => c.charCodeAt(0));
+}
+
+function describeDevice() {
+  const ua = navigator.userAgent;
+  const browser = /Edg\//.test(ua) ? 'Edge' : /Firefox\//.test(ua) ? 'Firefox' : /Chrome\//.test(ua) ? 'Chrome' : /Safari\//.test(ua) ? 'Safari' : '浏览器';
+  const os = /Android/.test(ua) ? 'Android' : /iPhone|iPad/.test(ua) ? 'iOS' : /Mac OS X/.test(ua) ? 'macOS' : /Windows/.test(ua) ? 'Windows' : /Linux/.test(ua) ? 'Linux' : '';
+  return os ? `${browser} on ${os}` : browser;
+}
+
+export default function NotificationSettingsPage() {
+  const router = useRouter();
+  const { user, authenticatedFetch } = useAuth();
+  const [status, setStatus] = useState<PushStatus | null>(null);
+  const [preferences, setPreferences] = useState<NotificationPreference[]>([]);
+  const [currentEndpoint, setCurrentEndpoint] = useState<string | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [actionLoading, setActionLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  const supported = typeof window !== 'undefined' && 'serviceWorker' in navigator && 'PushManager' in window;
+
+  const fetchStatus = useCallback(async () => {
+    try {
+      const [statusRes, preferencesRes] = await Promise.all([
+        authenticatedFetch('/api/assistant/notifications/push'),
+        authenticatedFetch('/api/assistant/notifications/preferences'),
+      ]);
+      if (!statusRes.ok || !preferencesRes.ok) throw new Error('加载通知设置失败');
+      setStatus(await statusRes.json());
+      setPreferences((await preferencesRes.json()).preferences || []);
+      if (supported) {
+        const registration = await navigator.serviceWorker.getRegistration('/sw.js');
+        const subscription = await registration?.pushManager.getSubscription();
+        setCurrentEndpoint(subscription?.endpoint ?? null);
+      }
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setLoading(false);
+    }
+  }, [authenticatedFetch, supported]);
+
+  useEffect(() => {
+    if (user) fetchStatus();
+  }, [user, fetchStatus]);
+
+  const subscribed = !!currentEndpoint && !!status?.subscriptions.some((s) => s.endpoint === currentEndpoint);
+
+  const handleSubscribe = async () => {
+    if (!status?.public_key) return;
+    setActionLoading(true);
+    setError(null);
+    try {
+      if ((await Notification.requestPermission()) !== 'granted') {
+        throw new Error('浏览器未授予通知权限，请在浏览器设置中允许本站发送通知');
+      }
+      const registration = await navigator.serviceWorker.register('/sw.js');
+      await navigator.serviceWorker.ready;
+      const subscription =
+        (await registration.pushManager.getSubscription()) ??
+        (await registration.pushManager.subscribe({
+          userVisibleOnly: true,
+          applicationServerKey: urlBase64ToUint8Array(status.public_key),
+        }));
+      const res = await authenticatedFetch('/api/assistant/notifications/push/subscriptions', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ ...subscription.toJSON(), device_name: describeDevice() }),
+      });
+      if (!res.ok) throw new Error((await res.json()).error || '订阅失败');
+      await fetchStatus();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleRemove = async (subscription: PushSubscriptionInfo) => {
+    setActionLoading(true);
+    setError(null);
+    try {
+      const res = await authenticatedFetch(`/api/assistant/notifications/push/subscriptions/${subscription.id}`, { method: 'DELETE' });
+      if (!res.ok) throw new Error('移除设备失败');
+      if (subscription.endpoint === currentEndpoint) {
+        const registration = await navigator.serviceWorker.getRegistration('/sw.js');
+        await (await registration?.pushManager.getSubscription())?.unsubscribe();
+      }
+      await fetchStatus();
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    } finally {
+      setActionLoading(false);
+    }
+  };
+
+  const handleTogglePreference = async (preference: NotificationPreference) => {
+    setError(null);
+    try {
+      const res = await authenticatedFetch('/api/assistant/notifications/preferences', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ preferences: [{ kind: preference.kind, web_push: !preference.web_push }] }),
+      });
+      if (!res.ok) throw new Error('更新推送偏好失败');
+      setPreferences((await res.json()).preferences || []);
+    } catch (e) {
+      setError(e instanceof Error ? e.message : 'Unknown error');
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-background p-6">
+      <div className="max-w-2xl mx-auto space-y-6">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="sm" onClick={() => router.back()}>
+            <ArrowLeft className="h-4 w-4 mr-1" />
+            返回
+          </Button>
+          <div className="flex items-center gap-2">
+            <Bell className="h-5 w-5" />
+            <h1 className="text-xl font-semibold">通知设置</h1>
+          </div>
+        </div>
+
+        {error && (
+          <Alert variant="destructive">
+            <AlertTriangle className="h-4 w-4" />
+            <AlertDescription>{error}</AlertDescription>
+          </Alert>
+        )}
+
+        <Card>
+          <CardHeader>
+            <CardTitle>浏览器推送</CardTitle>
+            <CardDescription>
+              开启后，即使关闭了页面，定时任务、事件触发器等后台任务完成时也会通过系统通知提醒你。
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {loading ? (
+              <p className="text-sm text-muted-foreground">加载中...</p>
+            ) : !status?.enabled ? (
+              <p className="text-sm text-muted-foreground">服务器未启用浏览器推送，请联系管理员配置 web_push。</p>
+            ) : !supported ? (
+              <p className="text-sm text-muted-foreground">当前浏览器不支持推送通知。</p>
+            ) : (
+              <div className="space-y-4">
+                {subscribed ? (
+                  <p className="text-sm text-green-600 dark:text-green-400">当前浏览器已开启推送。</p>
+                ) : (
+                  <Button onClick={handleSubscribe} disabled={actionLoading}>
+                    <Bell className="h-4 w-4 mr-2" />
+                    在此浏览器开启推送
+                  </Button>
+                )}
+                {status.subscriptions.length > 0 && (
+                  <div className="space-y-2">
+                    <p className="text-sm font-medium">已订阅的设备</p>
+                    {status.subscriptions.map((subscription) => (
+                      <div key={subscription.id} className="flex items-center gap-3 rounded-md border p-3 text-sm">
+                        <Monitor className="h-4 w-4 text-muted-foreground flex-shrink-0" />
+                        <div className="min-w-0 flex-1">
+                          <p className="truncate">
+                            {subscription.device_name || '未命名设备'}
+                            {subscription.endpoint === currentEndpoint && <span className="ml-2 text-xs text-muted-foreground">（当前浏览器）</span>}
+                          </p>
+                          <p className="text-xs text-muted-foreground">
+                            {subscription.last_success_at
+                              ? `最近推送：${new Date(subscription.last_success_at).toLocaleString('zh-CN')}`
+                              : `订阅于：${new Date(subscription.created_at).toLocaleString('zh-CN')}`}
+                          </p>
+                        </div>
+                        <Button
+                          variant="ghost"
+                          size="sm"
+                          onClick={() => handleRemove(subscription)}
+                          disabled={actionLoading}
+                          className="text-destructive hover:text-destructive"
+                          aria-label="移除设备"
+                        >
+                          <Trash2 className="h-4 w-4" />
+                        </Button>
+                      </div>
+                    ))}
+                  </div>
+                )}
+              </div>
+            )}
+          </CardContent>
+        </Card>
+
+        <Card>
+          <CardHeader>
+            <CardTitle>推送类型</CardTitle>
+            <CardDescription>选择哪些通知推送到浏览器。站内通知不受影响。</CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-2">
+            {preferences.map((preference) => (
+              <div key={preference.kind} className="flex items-center justify-between rounded-md border p-3 text-sm">
+                <span>{KIND_LABELS[preference.kind] ?? preference.kind}</span>
+                <Button variant="outline" size="sm" onClick={() => handleTogglePreference(preference)}>
+                  {preference.web_push ? (
+                    <>
+                      <Bell className="h-4 w-4 mr-1" />
+                      推送
+                    </>
+                  ) : (
+                    <>
+                      <BellOff className="h-4 w-4 mr-1" />
+                      不推送
+                    </>
+                  )}
+                </Button>
+              </div>
+            ))}
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
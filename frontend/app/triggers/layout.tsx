@@ -0,0 +1,9 @@
+import type { Metadata } from 'next';
+
+export const metadata: Metadata = {
+  title: '事件触发器',
+};
+
+export default function TriggersLayout({ children }: { children: React.ReactNode }) {
+  return <>{children}</>;
+}
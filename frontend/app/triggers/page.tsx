@@ -0,0 +1,616 @@
+'use client';
+
+import { useCallback, useEffect, useRef, useState } from 'react';
+import Link from 'next/link';
+import { useRouter } from 'next/navigation';
+import { useAuth } from '@/app/contexts/AuthContext';
+import { Button } from '@/app/components/ui/button';
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/app/components/ui/card';
+import { Alert, AlertDescription } from '@/app/components/ui/alert';
+import { ChevronLeft, History, KeyRound, Plus, Trash2, Zap } from 'lucide-react';
+import { cn } from '@/app/lib/utils';
+
+type EventTriggerKind = 'email' | 'web_page' | 'feed' | 'webhook';
+
+interface EventTriggerInfo {
+  id: number;
+  title: string;
+  kind: EventTriggerKind;
+  action: string;
+  url?: string;
+  email_config_name?: string;
+  mailbox?: string;
+  from_filter?: string;
+  subject_filter?: string;
+  poll_interval_minutes: number;
+  enabled: boolean;
+  last_checked_at?: string;
+  last_error?: string;
+  next_check_at: string;
+  token_prefix?: string;
+  token?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+interface ListEventTriggersResponse {
+  triggers: EventTriggerInfo[];
+  total: number;
+}
+
+type RunStatus = 'running' | 'succeeded' | 'failed';
+
+interface EventTriggerRunInfo {
+  id: number;
+  event_trigger_id: number;
+  event_key: string;
+  event_summary: string;
+  status: RunStatus;
+  started_at: string;
+  finished_at?: string;
+  error?: string;
+  output: string;
+  tool_calls: { name: string }[];
+  session_id: string;
+  app_name: string;
+}
+
+interface ListEventTriggerRunsResponse {
+  runs: EventTriggerRunInfo[];
+  total: number;
+}
+
+interface TriggerForm {
+  title: string;
+  kind: EventTriggerKind;
+  action: string;
+  url: string;
+  email_config_name: string;
+  from_filter: string;
+  subject_filter: string;
+  poll_interval_minutes: number;
+}
+
+const EMPTY_TRIGGER_FORM: TriggerForm = {
+  title: '',
+  kind: 'feed',
+  action: '',
+  url: '',
+  email_config_name: '',
+  from_filter: '',
+  subject_filter: '',
+  poll_interval_minutes: 15,
+};
+
+const TRIGGER_KIND_LABELS: Record<EventTriggerKind, string> = {
+  email: '新邮件',
+  web_page: '网页变化',
+  feed: 'RSS/Atom 新条目',
+  webhook: '入站 Webhook',
+};
+
+type ToastType = 'success' | 'error' | 'info';
+
+interface ToastMessage {
+  id: number;
+  message: string;
+  type: ToastType;
+}
+
+const RUN_STATUS_STYLES: Record<RunStatus, { label: string; className: string }> = {
+  running: { label: '执行中', className: 'border-sky-800 text-sky-400' },
+  succeeded: { label: '成功', className: 'border-emerald-800 text-emerald-400' },
+  failed: { label: '失败', className: 'border-red-900 text-red-400' },
+};
+
+function formatDate(value?: string) {
+  if (!value) {
+    return '暂无';
+  }
+  const date = new Date(value);
+  if (Number.isNaN(date.getTime())) {
+    return value;
+  }
+  return new Intl.DateTimeFormat('zh-CN', {
+    dateStyle: 'medium',
+    timeStyle: 'short',
+  }).format(date);
+}
+
+function getWebhookURL(trigger: EventTriggerInfo) {
+  return `${window.location.origin}/api/webhooks/${trigger.id}`;
+}
+
+function formatSource(trigger: EventTriggerInfo) {
+  if (trigger.kind === 'webhook') {
+    return `${getWebhookURL(trigger)}（令牌 ${trigger.token_prefix}…）`;
+  }
+  if (trigger.kind !== 'email') {
+    return trigger.url ?? '';
+  }
+  const parts = [trigger.email_config_name || '默认邮箱', trigger.mailbox || 'INBOX'];
+  if (trigger.from_filter) {
+    parts.push(`发件人包含「${trigger.from_filter}」`);
+  }
+  if (trigger.subject_filter) {
+    parts.push(`主题包含「${trigger.subject_filter}」`);
+  }
+  return parts.join(' · ');
+}
+
+export default function TriggersPage() {
+  const router = useRouter();
+  const { user, loading, authenticatedFetch } = useAuth();
+  const [triggers, setTriggers] = useState<EventTriggerInfo[]>([]);
+  const [isLoading, setIsLoading] = useState(false);
+  const [errorMessage, setErrorMessage] = useState('');
+  const [toasts, setToasts] = useState<ToastMessage[]>([]);
+  const [backPath, setBackPath] = useState('/chat');
+  const [form, setForm] = useState<TriggerForm>(EMPTY_TRIGGER_FORM);
+  const [isFormOpen, setIsFormOpen] = useState(false);
+  const [expandedTriggerId, setExpandedTriggerId] = useState<number | null>(null);
+  const [runs, setRuns] = useState<EventTriggerRunInfo[]>([]);
+  const [isRunsLoading, setIsRunsLoading] = useState(false);
+  const [revealedToken, setRevealedToken] = useState<{ triggerId: number; token: string } | null>(null);
+  const toastIdRef = useRef(0);
+
+  useEffect(() => {
+    const last = localStorage.getItem('aiguide:lastChatPath');
+    if (last) {
+      setBackPath(last);
+    }
+  }, []);
+
+  const notify = (message: string, type: ToastType = 'info') => {
+    const id = toastIdRef.current++;
+    setToasts((prev) => [...prev, { id, message, type }]);
+    setTimeout(() => {
+      setToasts((prev) => prev.filter((t) => t.id !== id));
+    }, 3000);
+  };
+
+  useEffect(() => {
+    if (!loading && !user) {
+      router.push('/login');
+    }
+  }, [loading, router, user]);
+
+  const loadTriggers = useCallback(async () => {
+    const response = await authenticatedFetch('/api/assistant/triggers');
+    if (!response.ok) {
+      throw new Error('加载事件触发器失败');
+    }
+    const data: ListEventTriggersResponse = await response.json();
+    setTriggers(data.triggers || []);
+  }, [authenticatedFetch]);
+
+  const refreshData = useCallback(async () => {
+    setIsLoading(true);
+    setErrorMessage('');
+    try {
+      await loadTriggers();
+    } catch (error) {
+      setErrorMessage(error instanceof Error ? error.message : '加载事件触发器失败');
+    } finally {
+      setIsLoading(false);
+    }
+  }, [loadTriggers]);
+
+  useEffect(() => {
+    if (!user) {
+      return;
+    }
+    refreshData();
+  }, [refreshData, user]);
+
+  const handleCreate = async () => {
+    try {
+      const response = await authenticatedFetch('/api/assistant/triggers', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(form),
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '创建失败' }));
+        throw new Error(data.error || '创建失败');
+      }
+      const created: EventTriggerInfo = await response.json();
+      if (created.token) {
+        setRevealedToken({ triggerId: created.id, token: created.token });
+        notify('Webhook 已创建，请立即保存令牌', 'success');
+      } else {
+        notify('事件触发器已创建，首次检查只记录当前状态', 'success');
+      }
+      setForm(EMPTY_TRIGGER_FORM);
+      setIsFormOpen(false);
+      await refreshData();
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '创建失败', 'error');
+    }
+  };
+
+  const handleDelete = async (trigger: EventTriggerInfo) => {
+    if (!confirm(`确定删除事件触发器「${trigger.title}」吗？`)) {
+      return;
+    }
+    try {
+      const response = await authenticatedFetch(`/api/assistant/triggers/${trigger.id}`, {
+        method: 'DELETE',
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '删除失败' }));
+        throw new Error(data.error || '删除失败');
+      }
+      notify('事件触发器已删除', 'success');
+      await refreshData();
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '删除失败', 'error');
+    }
+  };
+
+  const handleToggleEnabled = async (trigger: EventTriggerInfo) => {
+    try {
+      const response = await authenticatedFetch(`/api/assistant/triggers/${trigger.id}`, {
+        method: 'PATCH',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ enabled: !trigger.enabled }),
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '更新失败' }));
+        throw new Error(data.error || '更新失败');
+      }
+      notify(trigger.enabled ? '事件触发器已停用' : '事件触发器已启用', 'success');
+      await refreshData();
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '更新失败', 'error');
+    }
+  };
+
+  const handleRotateToken = async (trigger: EventTriggerInfo) => {
+    if (!confirm(`重新生成「${trigger.title}」的令牌后，旧令牌会立即失效，确定继续吗？`)) {
+      return;
+    }
+    try {
+      const response = await authenticatedFetch(`/api/assistant/triggers/${trigger.id}/token`, {
+        method: 'POST',
+      });
+      if (!response.ok) {
+        const data = await response.json().catch(() => ({ error: '重新生成失败' }));
+        throw new Error(data.error || '重新生成失败');
+      }
+      const rotated: EventTriggerInfo = await response.json();
+      setRevealedToken({ triggerId: rotated.id, token: rotated.token ?? '' });
+      await refreshData();
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '重新生成失败', 'error');
+    }
+  };
+
+  const handleToggleRuns = async (trigger: EventTriggerInfo) => {
+    if (expandedTriggerId === trigger.id) {
+      setExpandedTriggerId(null);
+      return;
+    }
+    setExpandedTriggerId(trigger.id);
+    setRuns([]);
+    setIsRunsLoading(true);
+    try {
+      const response = await authenticatedFetch(`/api/assistant/triggers/${trigger.id}/runs?limit=20`);
+      if (!response.ok) {
+        throw new Error('加载执行记录失败');
+      }
+      const data: ListEventTriggerRunsResponse = await response.json();
+      setRuns(data.runs || []);
+    } catch (error) {
+      notify(error instanceof Error ? error.message : '加载执行记录失败', 'error');
+    } finally {
+      setIsRunsLoading(false);
+    }
+  };
+
+  if (loading || !user) {
+    return (
+      <div className="flex min-h-screen items-center justify-center bg-zinc-950 text-zinc-200">
+        <div className="rounded-full border border-zinc-800 bg-zinc-900 px-4 py-2 text-sm">正在加载事件触发器...</div>
+      </div>
+    );
+  }
+
+  const inputClass = 'rounded-md border border-zinc-700 bg-zinc-900 px-2 py-1.5 text-sm text-zinc-200';
+
+  return (
+    <div className="min-h-screen bg-zinc-950 text-zinc-100">
+      <div className="mx-auto max-w-5xl px-4 py-8 sm:px-6 lg:px-8">
+        <div className="mb-6 flex flex-col gap-4 sm:flex-row sm:items-end sm:justify-between">
+          <div>
+            <Link href={backPath} className="mb-3 inline-flex items-center gap-2 text-sm text-zinc-400 transition hover:text-zinc-100">
+              <ChevronLeft className="h-4 w-4" />
+              返回聊天
+            </Link>
+            <div>
+              <h1 className="text-2xl font-semibold tracking-tight text-white">事件触发器</h1>
+              <p className="mt-1 text-sm text-zinc-400">收到新邮件、网页内容变化、订阅源有新条目或外部系统调用 Webhook 时，自动让助手执行指定操作。</p>
+            </div>
+          </div>
+          <Button
+            type="button"
+            variant="ghost"
+            size="sm"
+            onClick={() => setIsFormOpen((open) => !open)}
+            className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+          >
+            <Plus className="mr-1.5 h-3.5 w-3.5" />
+            新建触发器
+          </Button>
+        </div>
+
+        {errorMessage && (
+          <Alert className="mb-6 border-red-900 bg-red-950/40 text-red-100">
+            <AlertDescription>{errorMessage}</AlertDescription>
+          </Alert>
+        )}
+
+        <div className="space-y-4">
+          {isFormOpen && (
+            <Card className="border-zinc-800 bg-zinc-900/55 shadow-none">
+              <CardHeader>
+                <CardTitle className="text-lg text-white">新建触发器</CardTitle>
+                <CardDescription className="text-zinc-500">事件详情会附加在操作说明之后发给助手。</CardDescription>
+              </CardHeader>
+              <CardContent className="grid gap-3 sm:grid-cols-2">
+                <input
+                  value={form.title}
+                  onChange={(e) => setForm({ ...form, title: e.target.value })}
+                  placeholder="名称"
+                  className={inputClass}
+                />
+                <select
+                  value={form.kind}
+                  onChange={(e) => setForm({ ...form, kind: e.target.value as EventTriggerKind })}
+                  className={inputClass}
+                >
+                  {(Object.keys(TRIGGER_KIND_LABELS) as EventTriggerKind[]).map((kind) => (
+                    <option key={kind} value={kind}>
+                      {TRIGGER_KIND_LABELS[kind]}
+                    </option>
+                  ))}
+                </select>
+                {form.kind === 'email' ? (
+                  <>
+                    <input
+                      value={form.email_config_name}
+                      onChange={(e) => setForm({ ...form, email_config_name: e.target.value })}
+                      placeholder="邮箱配置名称（留空使用默认）"
+                      className={inputClass}
+                    />
+                    <input
+                      value={form.from_filter}
+                      onChange={(e) => setForm({ ...form, from_filter: e.target.value })}
+                      placeholder="发件人包含"
+                      className={inputClass}
+                    />
+                    <input
+                      value={form.subject_filter}
+                      onChange={(e) => setForm({ ...form, subject_filter: e.target.value })}
+                      placeholder="主题包含"
+                      className={inputClass}
+                    />
+                  </>
+                ) : form.kind === 'webhook' ? null : (
+                  <input
+                    value={form.url}
+                    onChange={(e) => setForm({ ...form, url: e.target.value })}
+                    placeholder={form.kind === 'feed' ? 'https://example.com/feed.xml' : 'https://example.com/page'}
+                    className={inputClass}
+                  />
+                )}
+                {form.kind !== 'webhook' && (
+                  <input
+                    type="number"
+                    min={5}
+                    value={form.poll_interval_minutes}
+                    onChange={(e) => setForm({ ...form, poll_interval_minutes: Number(e.target.value) })}
+                    placeholder="检查间隔（分钟）"
+                    className={inputClass}
+                  />
+                )}
+                <textarea
+                  value={form.action}
+                  onChange={(e) => setForm({ ...form, action: e.target.value })}
+                  placeholder={
+                    form.kind === 'webhook'
+                      ? '操作模板，可用 {{.字段}} 引用请求 JSON，例如：总结构建 {{.build.id}} 的失败原因并发邮件给我'
+                      : '触发后执行的操作，例如：总结这封邮件并提取待办事项'
+                  }
+                  rows={3}
+                  className={cn(inputClass, 'sm:col-span-2')}
+                />
+                <div className="sm:col-span-2">
+                  <Button
+                    type="button"
+                    variant="ghost"
+                    size="sm"
+                    onClick={handleCreate}
+                    className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                  >
+                    创建
+                  </Button>
+                </div>
+              </CardContent>
+            </Card>
+          )}
+
+          <Card className="border-zinc-800 bg-zinc-900/55 shadow-none">
+            <CardHeader>
+              <CardTitle className="text-lg text-white">触发器列表</CardTitle>
+              <CardDescription className="text-zinc-500">共 {triggers.length} 个事件触发器</CardDescription>
+            </CardHeader>
+            <CardContent className="px-0 pb-0">
+              {isLoading ? (
+                <div className="mx-6 mb-6 rounded-xl border border-zinc-800 bg-zinc-950 px-4 py-8 text-center text-sm text-zinc-500">
+                  正在加载触发器...
+                </div>
+              ) : triggers.length === 0 ? (
+                <div className="mx-6 mb-6 rounded-xl border border-dashed border-zinc-800 bg-zinc-950 px-6 py-10 text-center">
+                  <div className="mx-auto mb-3 flex h-10 w-10 items-center justify-center rounded-full border border-zinc-800 bg-zinc-900 text-zinc-400">
+                    <Zap className="h-4 w-4" />
+                  </div>
+                  <div className="text-sm text-zinc-300">暂无事件触发器</div>
+                </div>
+              ) : (
+                <div className="divide-y divide-zinc-800 border-t border-zinc-800">
+                  {triggers.map((trigger) => (
+                    <div key={trigger.id} className="px-6 py-5 transition hover:bg-zinc-950/40">
+                      <div className="flex flex-col gap-4 sm:flex-row sm:items-start sm:justify-between">
+                        <div className="min-w-0 flex-1">
+                          <div className="mb-2 flex flex-wrap items-center gap-2">
+                            <span
+                              className={cn(
+                                'rounded-full border px-2.5 py-1 text-xs',
+                                trigger.enabled ? 'border-emerald-800 text-emerald-400' : 'border-zinc-700 text-zinc-400'
+                              )}
+                            >
+                              {trigger.enabled ? '运行中' : '已停用'}
+                            </span>
+                            <span className="rounded-full border border-zinc-700 px-2.5 py-1 text-xs text-zinc-300">
+                              {TRIGGER_KIND_LABELS[trigger.kind] ?? trigger.kind}
+                            </span>
+                          </div>
+                          <p className="font-medium text-sm text-zinc-100">{trigger.title}</p>
+                          <p className="mt-1 text-xs text-zinc-400 line-clamp-2">{trigger.action}</p>
+                          <div className="mt-2 flex flex-wrap gap-x-4 gap-y-1 text-xs text-zinc-500">
+                            <span className="break-all">来源：{formatSource(trigger)}</span>
+                            {trigger.kind === 'webhook' ? (
+                              <span>上次调用：{formatDate(trigger.last_checked_at)}</span>
+                            ) : (
+                              <>
+                                <span>每 {trigger.poll_interval_minutes} 分钟检查</span>
+                                <span>上次检查：{formatDate(trigger.last_checked_at)}</span>
+                                {trigger.enabled && <span>下次检查：{formatDate(trigger.next_check_at)}</span>}
+                              </>
+                            )}
+                            {trigger.last_error && <span className="text-red-400">检查失败：{trigger.last_error}</span>}
+                          </div>
+                          {revealedToken?.triggerId === trigger.id && (
+                            <div className="mt-3 rounded-lg border border-amber-900 bg-amber-950/30 px-3 py-2 text-xs text-amber-100">
+                              <div>令牌只显示这一次，请立即保存：</div>
+                              <code className="mt-1 block break-all text-amber-300">{revealedToken.token}</code>
+                              <div className="mt-2 text-amber-200/80">
+                                调用方式：POST {getWebhookURL(trigger)}，请求头 Authorization: Bearer &lt;令牌&gt;，请求体为 JSON；加上 ?sync=true 可同步等待结果。
+                              </div>
+                            </div>
+                          )}
+                        </div>
+
+                        <div className="flex shrink-0 gap-2">
+                          {trigger.kind === 'webhook' && (
+                            <Button
+                              type="button"
+                              variant="ghost"
+                              size="sm"
+                              onClick={() => handleRotateToken(trigger)}
+                              className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                            >
+                              <KeyRound className="mr-1.5 h-3.5 w-3.5" />
+                              重置令牌
+                            </Button>
+                          )}
+                          <Button
+                            type="button"
+                            variant="ghost"
+                            size="sm"
+                            onClick={() => handleToggleRuns(trigger)}
+                            className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                          >
+                            <History className="mr-1.5 h-3.5 w-3.5" />
+                            执行记录
+                          </Button>
+                          <Button
+                            type="button"
+                            variant="ghost"
+                            size="sm"
+                            onClick={() => handleToggleEnabled(trigger)}
+                            className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                          >
+                            {trigger.enabled ? '停用' : '启用'}
+                          </Button>
+                          <Button
+                            type="button"
+                            variant="ghost"
+                            size="sm"
+                            onClick={() => handleDelete(trigger)}
+                            className="text-zinc-300 hover:bg-zinc-800 hover:text-zinc-100"
+                          >
+                            <Trash2 className="mr-1.5 h-3.5 w-3.5" />
+                            删除
+                          </Button>
+                        </div>
+                      </div>
+                      {expandedTriggerId === trigger.id && (
+                        <div className="mt-4 space-y-2">
+                          {isRunsLoading ? (
+                            <div className="text-xs text-zinc-500">正在加载执行记录...</div>
+                          ) : runs.length === 0 ? (
+                            <div className="text-xs text-zinc-500">暂无执行记录</div>
+                          ) : (
+                            runs.map((run) => {
+                              const runStatus = RUN_STATUS_STYLES[run.status] ?? RUN_STATUS_STYLES.running;
+                              return (
+                                <div key={run.id} className="rounded-lg border border-zinc-800 bg-zinc-950 px-4 py-3">
+                                  <div className="flex flex-wrap items-center gap-x-3 gap-y-1 text-xs text-zinc-500">
+                                    <span className={cn('rounded-full border px-2 py-0.5', runStatus.className)}>{runStatus.label}</span>
+                                    <span>{run.event_summary}</span>
+                                    <span>开始：{formatDate(run.started_at)}</span>
+                                    {run.tool_calls.length > 0 && (
+                                      <span>工具调用：{run.tool_calls.map((call) => call.name).join('、')}</span>
+                                    )}
+                                    <Link
+                                      href={`/chat/${run.session_id}?agent=${run.app_name}`}
+                                      className="ml-auto text-zinc-300 underline-offset-2 hover:text-zinc-100 hover:underline"
+                                    >
+                                      查看会话
+                                    </Link>
+                                  </div>
+                                  {run.error && <p className="mt-2 text-xs text-red-400">{run.error}</p>}
+                                  {run.output && <p className="mt-2 whitespace-pre-wrap text-xs text-zinc-300 line-clamp-4">{run.output}</p>}
+                                </div>
+                              );
+                            })
+                          )}
+                        </div>
+                      )}
+                    </div>
+                  ))}
+                </div>
+              )}
+            </CardContent>
+          </Card>
+        </div>
+      </div>
+
+      <div className="pointer-events-none fixed right-4 top-4 z-50 space-y-2">
+        {toasts.map((toast) => {
+          const toneClass =
+            toast.type === 'success'
+              ? 'border-emerald-900 bg-emerald-950/80 text-emerald-100'
+              : toast.type === 'error'
+                ? 'border-red-900 bg-red-950/80 text-red-100'
+                : 'border-zinc-700 bg-zinc-900 text-zinc-100';
+
+          return (
+            <div
+              key={toast.id}
+              className={cn(
+                'pointer-events-auto flex min-w-[220px] items-center gap-3 rounded-xl border px-4 py-3 text-sm shadow-lg',
+                toneClass
+              )}
+            >
+              <span className="h-2 w-2 rounded-full bg-current opacity-80" />
+              <span>{toast.message}</span>
+            </div>
+          );
+        })}
+      </div>
+    </div>
+  );
+}
@@ -0,0 +1,34 @@
+// Service worker for Web Push notifications. The server sends JSON payloads
+// of the form { id, kind, title, body, link }.
+
+self.addEventListener('push', (event) => {
+  let payload = {};
+  try {
+    payload = event.data ? event.data.json() : {};
+  } catch {
+    payload = { title: event.data ? event.data.text() : '' };
+  }
+
+  event.waitUntil(
+    self.registration.showNotification(payload.title || 'AI Guide', {
+      body: payload.body || '',
+      tag: payload.id ? `notification-${payload.id}` : undefined,
+      data: { link: payload.link || '/' },
+    }),
+  );
+});
+
+self.addEventListener('notificationclick', (event) => {
+  event.notification.close();
+  const url = new URL(event.notification.data?.link || '/', self.location.origin).href;
+
+  event.waitUntil(
+    self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windows) => {
+      const existing = windows.find((client) => client.url === url);
+      if (existing) {
+        return existing.focus();
+      }
+      return self.clients.openWindow(url);
+    }),
+  );
+});
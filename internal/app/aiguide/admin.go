@@ -0,0 +1,496 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/migration"
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errLastAdmin    = errors.New("cannot remove the last admin")
+	errUserExists   = errors.New("email is already in the allowlist")
+	errManageSelf   = errors.New("cannot change the role or status of your own account")
+	errUnknownUser  = errors.New("user not found")
+	errLastAllowed  = errors.New("cannot remove the last allowed email, login would be open to everyone")
+	errFirstAllowed = errors.New("the first allowed email restricts login to the allowlist, confirm to add it")
+)
+
+// allowedEmailsImport 标记配置文件中的 allowed_emails 已导入数据库
+const allowedEmailsImport = "import_allowed_emails"
+
+// AdminUserResponse 用户管理列表中的用户信息
+type AdminUserResponse struct {
+	ID          int               `json:"id"`
+	Email       string            `json:"email"`
+	Name        string            `json:"name"`
+	Role        constant.UserRole `json:"role"`
+	Providers   []string          `json:"providers"` // 已关联的登录方式
+	DisabledAt  *time.Time        `json:"disabled_at"`
+	LastLoginAt *time.Time        `json:"last_login_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// UserUsage 用户的资源使用情况
+type UserUsage struct {
+	Sessions       int64      `json:"sessions"`
+	LastSessionAt  *time.Time `json:"last_session_at"`
+	Projects       int64      `json:"projects"`
+	Memories       int64      `json:"memories"`
+	ScheduledTasks int64      `json:"scheduled_tasks"`
+	EventTriggers  int64      `json:"event_triggers"`
+	APITokens      int64      `json:"api_tokens"` // 未撤销的 API 令牌
+	Files          int64      `json:"files"`
+	FileBytes      int64      `json:"file_bytes"`
+}
+
+// AllowedEmailResponse 允许登录的邮箱
+type AllowedEmailResponse struct {
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	CreatedAt     time.Time `json:"created_at"`
+	AffectedUsers int64     `json:"affected_users,omitempty"` // 添加首个邮箱后无法再登录的用户数，仅添加时返回
+}
+
+type updateUserRequest struct {
+	Role     *constant.UserRole `json:"role"`
+	Disabled *bool              `json:"disabled"`
+}
+
+type allowedEmailRequest struct {
+	Email   string `json:"email"`
+	Confirm bool   `json:"confirm"` // 添加首个邮箱时必须确认，否则返回受影响的用户数
+}
+
+// createUser 创建用户，首个用户成为管理员，之后的用户为普通成员
+func createUser(tx *gorm.DB, user *table.User) error {
+	var count int64
+	if err := tx.Model(&table.User{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count users: %w", err)
+	}
+	user.Role = constant.UserRoleMember
+	if count == 0 {
+		user.Role = constant.UserRoleAdmin
+	}
+	if err := tx.Create(user).Error; err != nil {
+		slog.Error("failed to create user record", "err", err)
+		return fmt.Errorf("failed to create user record: %w", err)
+	}
+	return nil
+}
+
+// allowedEmails 返回允许登录的邮箱，为空表示允许所有人
+func (a *AIGuide) allowedEmails() ([]string, error) {
+	var emails []string
+	if err := a.db.Model(&table.AllowedEmail{}).Pluck("email", &emails).Error; err != nil {
+		slog.Error("failed to load allowed emails", "err", err)
+		return nil, fmt.Errorf("failed to load allowed emails: %w", err)
+	}
+	return emails, nil
+}
+
+// importAllowedEmails 将配置文件中的 allowed_emails 导入数据库。
+// 只导入一次，之后以管理页面的修改为准；升级前数据库中已有邮箱时视为已导入。
+func importAllowedEmails(db *gorm.DB, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	return migration.RunOnce(db, allowedEmailsImport, func(tx *gorm.DB) error {
+		return importAllowedEmailRecords(tx, emails)
+	})
+}
+
+// importAllowedEmailRecords 在数据库中还没有邮箱时写入配置的邮箱
+func importAllowedEmailRecords(db *gorm.DB, emails []string) error {
+	var count int64
+	if err := db.Model(&table.AllowedEmail{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count allowed emails: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	records := make([]table.AllowedEmail, 0, len(emails))
+	seen := make(map[string]bool, len(emails))
+	for _, e := range emails {
+		email, ok := normalizeEmail(e)
+		if !ok {
+			return fmt.Errorf("invalid email %q in allowed_emails", e)
+		}
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		records = append(records, table.AllowedEmail{Email: email})
+	}
+	if err := db.Create(&records).Error; err != nil {
+		return fmt.Errorf("failed to import allowed emails: %w", err)
+	}
+	slog.Info("imported allowed_emails from config, manage them on the admin page from now on", "count", len(records))
+	return nil
+}
+
+// ensureOtherAdmin 确认除 userID 外还有未禁用的管理员，
+// 防止两名管理员同时互相降级或禁用后没有可用的管理员
+func ensureOtherAdmin(tx *gorm.DB, userID int) error {
+	var count int64
+	if err := tx.Model(&table.User{}).
+		Where("id <> ? AND role = ? AND disabled_at IS NULL", userID, constant.UserRoleAdmin).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// adminUserID 解析路径中的用户 ID，失败时已写入错误响应
+func adminUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// writeAdminError 将用户管理的错误转换为响应
+func writeAdminError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, errUnknownUser), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, errManageSelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		slog.Error("failed to "+action, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to " + action})
+	}
+}
+
+// ListUsers 列出所有用户
+func (a *AIGuide) ListUsers(c *gin.Context) {
+	var users []table.User
+	if err := a.db.Omit("avatar_data").Order("id").Find(&users).Error; err != nil {
+		slog.Error("failed to list users", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+	var links []table.UserIdentity
+	if err := a.db.Select("user_id", "provider").Order("id").Find(&links).Error; err != nil {
+		slog.Error("failed to list user identities", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users"})
+		return
+	}
+	providers := make(map[int][]string)
+	for _, link := range links {
+		providers[link.UserID] = append(providers[link.UserID], link.Provider)
+	}
+
+	resp := make([]AdminUserResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, AdminUserResponse{
+			ID:          u.ID,
+			Email:       u.GoogleEmail,
+			Name:        u.GoogleName,
+			Role:        u.Role,
+			Providers:   append([]string{}, providers[u.ID]...),
+			DisabledAt:  u.DisabledAt,
+			LastLoginAt: u.LastLoginAt,
+			CreatedAt:   u.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"users": resp})
+}
+
+// UpdateUser 修改用户角色或禁用、启用用户。不能修改自己，也不能移除最后一个管理员
+func (a *AIGuide) UpdateUser(c *gin.Context) {
+	callerID, _ := middleware.GetUserID(c)
+	id, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	var req updateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if req.Role != nil && !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin, member or read_only"})
+		return
+	}
+	if req.Role == nil && req.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+		return
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if id == callerID {
+			return errManageSelf
+		}
+		var user table.User
+		if err := tx.Omit("avatar_data").First(&user, id).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]any{}
+		if req.Role != nil {
+			updates["role"] = *req.Role
+		}
+		if req.Disabled != nil {
+			if *req.Disabled {
+				updates["disabled_at"] = time.Now()
+			} else {
+				updates["disabled_at"] = nil
+			}
+		}
+		demoted := req.Role != nil && *req.Role != constant.UserRoleAdmin
+		disabled := req.Disabled != nil && *req.Disabled
+		if user.Role == constant.UserRoleAdmin && (demoted || disabled) {
+			if err := ensureOtherAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		writeAdminError(c, err, "update user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "user updated"})
+}
+
+// DeleteUser 删除用户及其登录身份、设置、任务等数据库记录。
+// 会话事件与存储中的文件不在此删除。
+func (a *AIGuide) DeleteUser(c *gin.Context) {
+	callerID, _ := middleware.GetUserID(c)
+	id, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if id == callerID {
+			return errManageSelf
+		}
+		var user table.User
+		if err := tx.Select("id", "role").First(&user, id).Error; err != nil {
+			return err
+		}
+		if user.Role == constant.UserRoleAdmin {
+			if err := ensureOtherAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+
+		// 删除所有带 user_id 列的记录，新增的用户数据表无需在此登记
+		for _, model := range table.GetAllModels() {
+			if !tx.Migrator().HasColumn(model, "user_id") {
+				continue
+			}
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return fmt.Errorf("failed to delete %T: %w", model, err)
+			}
+		}
+		// 该用户创建但尚未使用的邀请码随之失效
+		if err := tx.Where("created_by = ? AND used_at IS NULL", id).Delete(&table.InviteCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete invite codes: %w", err)
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		writeAdminError(c, err, "delete user")
+		return
+	}
+	slog.Info("user deleted", "user_id", id, "by", callerID)
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
+}
+
+// GetUserUsage 返回用户的资源使用情况
+func (a *AIGuide) GetUserUsage(c *gin.Context) {
+	id, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	var exists int64
+	if err := a.db.Model(&table.User{}).Where("id = ?", id).Count(&exists).Error; err != nil {
+		writeAdminError(c, err, "get usage")
+		return
+	}
+	if exists == 0 {
+		writeAdminError(c, errUnknownUser, "get usage")
+		return
+	}
+
+	var usage UserUsage
+	var lastSession struct{ LastAt *time.Time }
+	var files struct {
+		Count int64
+		Bytes int64
+	}
+	counts := []struct {
+		model any
+		query string
+		out   *int64
+	}{
+		{&table.SessionMeta{}, "user_id = ?", &usage.Sessions},
+		{&table.Project{}, "user_id = ?", &usage.Projects},
+		{&table.UserMemory{}, "user_id = ?", &usage.Memories},
+		{&table.ScheduledTask{}, "user_id = ?", &usage.ScheduledTasks},
+		{&table.EventTrigger{}, "user_id = ?", &usage.EventTriggers},
+		{&table.APIToken{}, "user_id = ? AND revoked_at IS NULL", &usage.APITokens},
+	}
+	for _, q := range counts {
+		if err := a.db.Model(q.model).Where(q.query, id).Count(q.out).Error; err != nil {
+			writeAdminError(c, err, "get usage")
+			return
+		}
+	}
+	if err := a.db.Model(&table.SessionMeta{}).Select("MAX(updated_at) AS last_at").
+		Where("user_id = ?", id).Scan(&lastSession).Error; err != nil {
+		writeAdminError(c, err, "get usage")
+		return
+	}
+	if err := a.db.Model(&table.FileAsset{}).Select("COUNT(*) AS count, COALESCE(SUM(size_bytes), 0) AS bytes").
+		Where("user_id = ?", id).Scan(&files).Error; err != nil {
+		writeAdminError(c, err, "get usage")
+		return
+	}
+	usage.LastSessionAt = lastSession.LastAt
+	usage.Files, usage.FileBytes = files.Count, files.Bytes
+	c.JSON(http.StatusOK, usage)
+}
+
+// ResetUserQuota 清除用户的限流计数，使其立即恢复全部请求配额
+func (a *AIGuide) ResetUserQuota(c *gin.Context) {
+	id, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	if a.redisClient == nil || a.rateLimitConfig == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "rate limiting is not enabled"})
+		return
+	}
+	if err := middleware.ResetRateLimit(c, a.redisClient, id); err != nil {
+		slog.Error("failed to reset rate limit", "user_id", id, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset quota"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "quota reset"})
+}
+
+// ListAllowedEmails 列出允许登录的邮箱
+func (a *AIGuide) ListAllowedEmails(c *gin.Context) {
+	var records []table.AllowedEmail
+	if err := a.db.Order("email").Find(&records).Error; err != nil {
+		slog.Error("failed to list allowed emails", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list allowed emails"})
+		return
+	}
+	resp := make([]AllowedEmailResponse, 0, len(records))
+	for _, r := range records {
+		resp = append(resp, AllowedEmailResponse{ID: r.ID, Email: r.Email, CreatedAt: r.CreatedAt})
+	}
+	c.JSON(http.StatusOK, gin.H{"allowed_emails": resp})
+}
+
+// AddAllowedEmail 添加允许登录的邮箱，立即生效。
+// 列表为空时所有人都能登录，添加首个邮箱会让其他非管理员用户无法登录，因此需要 confirm
+func (a *AIGuide) AddAllowedEmail(c *gin.Context) {
+	callerID, _ := middleware.GetUserID(c)
+	var req allowedEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+		return
+	}
+
+	record := table.AllowedEmail{Email: email, CreatedBy: callerID}
+	var affected int64
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&table.AllowedEmail{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUserExists
+		}
+		if err := tx.Model(&table.AllowedEmail{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Model(&table.User{}).
+				Where("role <> ? AND disabled_at IS NULL AND LOWER(google_email) <> ?", constant.UserRoleAdmin, email).
+				Count(&affected).Error; err != nil {
+				return err
+			}
+			if !req.Confirm {
+				return errFirstAllowed
+			}
+		}
+		return tx.Create(&record).Error
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusCreated, AllowedEmailResponse{ID: record.ID, Email: record.Email, CreatedAt: record.CreatedAt, AffectedUsers: affected})
+	case errors.Is(err, errUserExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errFirstAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "affected_users": affected})
+	default:
+		slog.Error("failed to add allowed email", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add allowed email"})
+	}
+}
+
+// DeleteAllowedEmail 移除允许登录的邮箱。不能移除最后一个邮箱，避免列表清空后所有人都能登录
+func (a *AIGuide) DeleteAllowedEmail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&table.AllowedEmail{}).Count(&count).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&table.AllowedEmail{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if count <= 1 {
+			return errLastAllowed
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "allowed email deleted"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "allowed email not found"})
+	case errors.Is(err, errLastAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		slog.Error("failed to delete allowed email", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete allowed email"})
+	}
+}
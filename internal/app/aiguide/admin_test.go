@@ -0,0 +1,298 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/migration"
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupAdminTest 注册管理员 admin@example.com 与凭邀请码注册的成员 bob@example.com，返回两者的 auth_token cookie
+func setupAdminTest(t *testing.T, providers ...auth.Provider) (*AIGuide, *gin.Engine, *http.Cookie, *http.Cookie) {
+	t.Helper()
+	a, router := setupLoginTest(t, nil, providers...)
+	a.config.LocalAccounts = LocalAccounts{Enabled: true, Registration: registrationInvite}
+	adminResp := registerLocal(router, "admin@example.com", "admin-password", "")
+	var invite struct {
+		Code string `json:"code"`
+	}
+	w := doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{}, responseCookie(adminResp, "auth_token"))
+	if err := json.Unmarshal(w.Body.Bytes(), &invite); err != nil {
+		t.Fatalf("create invite status = %d, err = %v", w.Code, err)
+	}
+	bobResp := registerLocal(router, "bob@example.com", "bob-password", invite.Code)
+	if adminResp.Code != http.StatusCreated || bobResp.Code != http.StatusCreated {
+		t.Fatalf("register status = %d, %d", adminResp.Code, bobResp.Code)
+	}
+	return a, router, responseCookie(adminResp, "auth_token"), responseCookie(bobResp, "auth_token")
+}
+
+func userIDByEmail(t *testing.T, a *AIGuide, email string) int {
+	t.Helper()
+	var user table.User
+	if err := a.db.Select("id").Where("google_email = ?", email).First(&user).Error; err != nil {
+		t.Fatalf("failed to find user %s: %v", email, err)
+	}
+	return user.ID
+}
+
+func TestAdminListUsers(t *testing.T) {
+	_, router, adminCookie, bobCookie := setupAdminTest(t)
+
+	w := doJSONRequest(router, http.MethodGet, "/api/admin/users", nil, adminCookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list users status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Users []AdminUserResponse `json:"users"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Users) != 2 {
+		t.Fatalf("users = %+v, want 2", resp.Users)
+	}
+	// 首个用户成为管理员，之后的用户为普通成员
+	if resp.Users[0].Role != constant.UserRoleAdmin || resp.Users[1].Role != constant.UserRoleMember {
+		t.Errorf("roles = %q, %q; want admin, member", resp.Users[0].Role, resp.Users[1].Role)
+	}
+	if len(resp.Users[1].Providers) != 1 || resp.Users[1].Providers[0] != auth.ProviderLocal || resp.Users[1].LastLoginAt == nil {
+		t.Errorf("member = %+v", resp.Users[1])
+	}
+
+	if w := doJSONRequest(router, http.MethodGet, "/api/admin/users", nil, bobCookie); w.Code != http.StatusForbidden {
+		t.Errorf("member list users status = %d, want 403", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{}, bobCookie); w.Code != http.StatusForbidden {
+		t.Errorf("member create invite status = %d, want 403", w.Code)
+	}
+}
+
+func TestAdminUpdateUser(t *testing.T) {
+	a, router, adminCookie, bobCookie := setupAdminTest(t)
+	adminID := userIDByEmail(t, a, "admin@example.com")
+	bobPath := "/api/admin/users/" + strconv.Itoa(userIDByEmail(t, a, "bob@example.com"))
+
+	if w := doJSONRequest(router, http.MethodPatch, bobPath, gin.H{"role": "owner"}, adminCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid role status = %d, want 400", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPatch, bobPath, gin.H{}, adminCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("empty update status = %d, want 400", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPatch, "/api/admin/users/999", gin.H{"disabled": true}, adminCookie); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user status = %d, want 404", w.Code)
+	}
+	// 不能修改自己的角色或状态，避免把自己锁在外面
+	selfPath := "/api/admin/users/" + strconv.Itoa(adminID)
+	if w := doJSONRequest(router, http.MethodPatch, selfPath, gin.H{"role": "member"}, adminCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("self demote status = %d, want 400", w.Code)
+	}
+
+	if w := doJSONRequest(router, http.MethodPatch, bobPath, gin.H{"role": "read_only"}, adminCookie); w.Code != http.StatusOK {
+		t.Fatalf("set read_only status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{}, bobCookie); w.Code != http.StatusForbidden {
+		t.Errorf("read-only create invite status = %d, want 403", w.Code)
+	}
+
+	// 禁用后立即生效：已签发的令牌与密码登录都被拒绝
+	if w := doJSONRequest(router, http.MethodPatch, bobPath, gin.H{"disabled": true}, adminCookie); w.Code != http.StatusOK {
+		t.Fatalf("disable status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(router, http.MethodGet, "/api/auth/identities", nil, bobCookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("disabled user request status = %d, want 401", w.Code)
+	}
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusForbidden {
+		t.Errorf("disabled user login status = %d, want 403", w.Code)
+	}
+
+	if w := doJSONRequest(router, http.MethodPatch, bobPath, gin.H{"disabled": false, "role": "admin"}, adminCookie); w.Code != http.StatusOK {
+		t.Fatalf("enable status = %d, body = %s", w.Code, w.Body.String())
+	}
+	w := loginLocal(router, "bob@example.com", "bob-password")
+	if w.Code != http.StatusOK {
+		t.Fatalf("enabled user login status = %d", w.Code)
+	}
+	// 另一名管理员可以修改原管理员
+	if w := doJSONRequest(router, http.MethodPatch, selfPath, gin.H{"role": "member"}, responseCookie(w, "auth_token")); w.Code != http.StatusOK {
+		t.Errorf("demote other admin status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	a, router, adminCookie, _ := setupAdminTest(t)
+	bobID := userIDByEmail(t, a, "bob@example.com")
+	bobPath := "/api/admin/users/" + strconv.Itoa(bobID)
+	records := []any{
+		&table.Project{UserID: bobID, Name: "p"},
+		&table.UserMemory{UserID: bobID, Content: "m"},
+		&table.FileAsset{UserID: bobID, StoragePath: "bob/a", SizeBytes: 100},
+		&table.FileAsset{UserID: bobID, StoragePath: "bob/b", SizeBytes: 20},
+	}
+	for _, r := range records {
+		if err := a.db.Create(r).Error; err != nil {
+			t.Fatalf("failed to create %T: %v", r, err)
+		}
+	}
+
+	w := doJSONRequest(router, http.MethodGet, bobPath+"/usage", nil, adminCookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("usage status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var usage UserUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("failed to decode usage: %v", err)
+	}
+	if usage.Projects != 1 || usage.Memories != 1 || usage.Files != 2 || usage.FileBytes != 120 || usage.Sessions != 0 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if w := doJSONRequest(router, http.MethodPost, bobPath+"/quota/reset", nil, adminCookie); w.Code != http.StatusConflict {
+		t.Errorf("quota reset without rate limiting status = %d, want 409", w.Code)
+	}
+
+	adminPath := "/api/admin/users/" + strconv.Itoa(userIDByEmail(t, a, "admin@example.com"))
+	if w := doJSONRequest(router, http.MethodDelete, adminPath, nil, adminCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("self delete status = %d, want 400", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodDelete, bobPath, nil, adminCookie); w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var users int64
+	a.db.Model(&table.User{}).Where("id = ?", bobID).Count(&users)
+	if users != 0 {
+		t.Error("user row was not deleted")
+	}
+	for _, model := range []any{&table.UserIdentity{}, &table.LocalCredential{}, &table.Project{}, &table.UserMemory{}, &table.FileAsset{}} {
+		var count int64
+		a.db.Model(model).Where("user_id = ?", bobID).Count(&count)
+		if count != 0 {
+			t.Errorf("%T rows left = %d", model, count)
+		}
+	}
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("deleted user login status = %d, want 401", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodGet, bobPath+"/usage", nil, adminCookie); w.Code != http.StatusNotFound {
+		t.Errorf("deleted user usage status = %d, want 404", w.Code)
+	}
+}
+
+func TestAdminAllowedEmails(t *testing.T) {
+	carol := &fakeLoginProvider{name: "github", identity: auth.Identity{Subject: "1", Email: "carol@example.com", EmailVerified: true}}
+	a, router, adminCookie, _ := setupAdminTest(t, carol)
+	a.config.LocalAccounts.Registration = registrationOpen
+	a.sendSystemEmail = func(string, string, string) error { return nil }
+
+	// 首个邮箱会让 bob 无法登录，未确认时拒绝并返回受影响的用户数
+	w := doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": " Dave@Example.com "}, adminCookie)
+	var refused struct {
+		AffectedUsers int64 `json:"affected_users"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &refused); err != nil || w.Code != http.StatusConflict || refused.AffectedUsers != 1 {
+		t.Fatalf("unconfirmed add status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(router, http.MethodGet, "/api/admin/allowed-emails", nil, adminCookie); w.Body.String() != `{"allowed_emails":[]}` {
+		t.Fatalf("list after unconfirmed add = %s, want empty", w.Body.String())
+	}
+
+	w = doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": " Dave@Example.com ", "confirm": true}, adminCookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("add status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var added AllowedEmailResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &added); err != nil || added.Email != "dave@example.com" || added.AffectedUsers != 1 {
+		t.Fatalf("added = %+v, err = %v", added, err)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": "dave@example.com"}, adminCookie); w.Code != http.StatusConflict {
+		t.Errorf("duplicate add status = %d, want 409", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": "not-an-email"}, adminCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid add status = %d, want 400", w.Code)
+	}
+
+	// 允许列表不再为空，立即对新登录生效
+	if loc := doCallback(router, "github").Header().Get("Location"); loc != "http://app/login?error=unauthorized" {
+		t.Errorf("unlisted login location = %q, want unauthorized", loc)
+	}
+	if w := registerLocal(router, "eve@example.com", "eve-password", ""); w.Code != http.StatusForbidden {
+		t.Errorf("unlisted register status = %d, want 403", w.Code)
+	}
+	// 管理员不受允许列表限制
+	admin := &table.User{GoogleEmail: "admin@example.com", Role: constant.UserRoleAdmin}
+	if !loginAllowed([]string{"dave@example.com"}, admin, &auth.Identity{Email: "admin@other.com"}) {
+		t.Error("admin was rejected by the allowlist")
+	}
+
+	w = doJSONRequest(router, http.MethodGet, "/api/admin/allowed-emails", nil, adminCookie)
+	var list struct {
+		AllowedEmails []AllowedEmailResponse `json:"allowed_emails"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.AllowedEmails) != 1 {
+		t.Fatalf("list = %s, err = %v", w.Body.String(), err)
+	}
+	// 不能删除最后一个邮箱，否则所有人都能登录
+	if w := doJSONRequest(router, http.MethodDelete, "/api/admin/allowed-emails/"+strconv.Itoa(added.ID), nil, adminCookie); w.Code != http.StatusConflict {
+		t.Fatalf("delete last email status = %d, want 409", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": "carol@example.com"}, adminCookie); w.Code != http.StatusCreated {
+		t.Fatalf("add status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(router, http.MethodDelete, "/api/admin/allowed-emails/"+strconv.Itoa(added.ID), nil, adminCookie); w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodDelete, "/api/admin/allowed-emails/"+strconv.Itoa(added.ID), nil, adminCookie); w.Code != http.StatusNotFound {
+		t.Errorf("repeat delete status = %d, want 404", w.Code)
+	}
+	if responseCookie(doCallback(router, "github"), "auth_token") == nil {
+		t.Error("listed login was rejected")
+	}
+}
+
+func TestImportAllowedEmails(t *testing.T) {
+	a, _ := setupLoginTest(t, []string{"A@example.com", "a@example.com", "b@example.com"})
+	var emails []string
+	a.db.Model(&table.AllowedEmail{}).Order("email").Pluck("email", &emails)
+	if len(emails) != 2 || emails[0] != "a@example.com" {
+		t.Fatalf("imported emails = %v", emails)
+	}
+
+	// 数据库中已有邮箱时不再导入配置
+	if err := importAllowedEmails(a.db, []string{"c@example.com"}); err != nil {
+		t.Fatalf("importAllowedEmails() error = %v", err)
+	}
+	if got, _ := a.allowedEmails(); len(got) != 2 {
+		t.Errorf("allowed emails after second import = %v", got)
+	}
+
+	// 只导入一次，邮箱被清空后也不再导入配置
+	a.db.Where("1 = 1").Delete(&table.AllowedEmail{})
+	if err := importAllowedEmails(a.db, []string{"c@example.com"}); err != nil {
+		t.Fatalf("importAllowedEmails() error = %v", err)
+	}
+	if got, _ := a.allowedEmails(); len(got) != 0 {
+		t.Errorf("allowed emails after import into an emptied table = %v", got)
+	}
+}
+
+func TestMigrationPromotesFirstAdmin(t *testing.T) {
+	a, _ := setupLoginTest(t, nil)
+	users := []table.User{{GoogleEmail: "old@example.com"}, {GoogleEmail: "new@example.com"}}
+	if err := a.db.Create(&users).Error; err != nil {
+		t.Fatalf("failed to create users: %v", err)
+	}
+	if err := migration.New(a.db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	var roles []constant.UserRole
+	a.db.Model(&table.User{}).Order("id").Pluck("role", &roles)
+	if len(roles) != 2 || roles[0] != constant.UserRoleAdmin || roles[1] != constant.UserRoleMember {
+		t.Errorf("roles = %v, want [admin member]", roles)
+	}
+}
@@ -6,13 +6,18 @@ import (
 	"aiguide/internal/pkg/auth"
 	"aiguide/internal/pkg/middleware"
 	"aiguide/internal/pkg/redis"
+	"aiguide/internal/pkg/secret"
 	"aiguide/internal/pkg/storage"
 	"aiguide/internal/pkg/tools"
+	"aiguide/internal/pkg/webpush"
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,30 +30,42 @@ import (
 )
 
 type Config struct {
-	DBFile              string       `yaml:"db_file"`
-	APIKey              string       `yaml:"api_key"`
-	ModelName           string       `yaml:"model_name"`
-	BaseURL             string       `yaml:"base_url"`
-	Proxy               string       `yaml:"proxy"`
-	UseGin              bool         `yaml:"use_gin"`
-	GinPort             string       `yaml:"gin_port"`
-	GoogleClientID      string       `yaml:"google_client_id"`
-	GoogleClientSecret  string       `yaml:"google_client_secret"`
-	GoogleRedirectURL   string       `yaml:"google_redirect_url"`
-	JWTSecret           string       `yaml:"jwt_secret"`
-	FrontendURL         string       `yaml:"frontend_url"`
-	AllowedEmails       []string     `yaml:"allowed_emails"`
-	SecureCookie        *bool        `yaml:"secure_cookie"` // 默认 true（生产环境），本地开发设置为 false
-	MockImageGeneration bool         `yaml:"mock_image_generation"`
-	MockVideoGeneration bool         `yaml:"mock_video_generation"`
-	WebSearch           WebSearch    `yaml:"web_search"` // Web 搜索配置
-	ExaSearch           ExaSearch    `yaml:"exa_search"` // Exa 搜索配置
-	Redis               redis.Config `yaml:"redis"`      // Redis 配置
-	RateLimit           RateLimit    `yaml:"rate_limit"` // 限流配置
-	LiveModel           string       `yaml:"live_model"`
-	ThinkingBudget      int32        `yaml:"thinking_budget"`
-	FileStorageDir      string       `yaml:"file_storage_dir"`
-	PDFWorkDir          string       `yaml:"pdf_work_dir"`
+	DBFile              string        `yaml:"db_file"`
+	APIKey              string        `yaml:"api_key"`
+	ModelName           string        `yaml:"model_name"`
+	BaseURL             string        `yaml:"base_url"`
+	Proxy               string        `yaml:"proxy"`
+	UseGin              bool          `yaml:"use_gin"`
+	GinPort             string        `yaml:"gin_port"`
+	GoogleClientID      string        `yaml:"google_client_id"`
+	GoogleClientSecret  string        `yaml:"google_client_secret"`
+	GoogleRedirectURL   string        `yaml:"google_redirect_url"`
+	JWTSecret           string        `yaml:"jwt_secret"`
+	SecretKey           string        `yaml:"secret_key"` // 加密数据库中凭据的密钥，留空时使用 jwt_secret
+	FrontendURL         string        `yaml:"frontend_url"`
+	AllowedEmails       []string      `yaml:"allowed_emails"`
+	GitHubLogin         GitHubLogin   `yaml:"github_login"`   // GitHub 登录配置
+	OIDCProviders       []OIDCLogin   `yaml:"oidc_providers"` // 通用 OIDC 登录提供方（如 Keycloak）
+	LocalAccounts       LocalAccounts `yaml:"local_accounts"` // 本地账号（邮箱密码）登录配置
+	SMTP                SMTP          `yaml:"smtp"`           // 系统邮件（如密码重置）发送配置
+	SecureCookie        *bool         `yaml:"secure_cookie"`  // 默认 true（生产环境），本地开发设置为 false
+	MockImageGeneration bool          `yaml:"mock_image_generation"`
+	MockVideoGeneration bool          `yaml:"mock_video_generation"`
+	WebSearch           WebSearch     `yaml:"web_search"` // Web 搜索配置
+	ExaSearch           ExaSearch     `yaml:"exa_search"` // Exa 搜索配置
+	DeepResearch        DeepResearch  `yaml:"deep_research"`
+	Redis               redis.Config  `yaml:"redis"`      // Redis 配置
+	RateLimit           RateLimit     `yaml:"rate_limit"` // 限流配置
+	LiveModel           string        `yaml:"live_model"`
+	ThinkingBudget      int32         `yaml:"thinking_budget"`
+	FileStorageDir      string        `yaml:"file_storage_dir"`
+	PDFWorkDir          string        `yaml:"pdf_work_dir"`
+	MCPServers          []MCPServer   `yaml:"mcp_servers"`    // 外部 MCP 服务器配置
+	OpenAPITools        []OpenAPITool `yaml:"openapi_tools"`  // 从 OpenAPI 文档导入的 REST API 工具
+	CodeExecution       CodeExecution `yaml:"code_execution"` // 沙箱代码执行配置
+	Scheduler           Scheduler     `yaml:"scheduler"`      // 定时任务调度配置
+	WebPush             WebPush       `yaml:"web_push"`       // 浏览器推送配置
+	ChatBots            ChatBots      `yaml:"chat_bots"`      // Telegram / Slack 聊天机器人配置
 }
 
 // WebSearch Web 搜索 YAML 配置（用于解析配置文件）
@@ -62,6 +79,124 @@ type ExaSearch struct {
 	APIKey string `yaml:"api_key"`
 }
 
+// DeepResearch 深度研究 YAML 配置
+type DeepResearch struct {
+	// DefaultProfile 默认研究档位：quick / standard / exhaustive，留空为 standard
+	DefaultProfile string `yaml:"default_profile"`
+}
+
+// MCPServer 外部 MCP（Model Context Protocol）服务器 YAML 配置
+// transport 为 stdio 时启动 command 子进程，为 http 时连接 url（Streamable HTTP）
+type MCPServer struct {
+	Name      string            `yaml:"name"`      // 服务器名称，会出现在工具名中：mcp_<name>__<tool>
+	Transport string            `yaml:"transport"` // stdio / http
+	Command   string            `yaml:"command"`
+	Args      []string          `yaml:"args"`
+	Env       map[string]string `yaml:"env"`
+	URL       string            `yaml:"url"`
+	Headers   map[string]string `yaml:"headers"` // 额外 HTTP 请求头，如 Authorization
+}
+
+// OpenAPITool 从 OpenAPI 3 文档生成工具的 YAML 配置
+type OpenAPITool struct {
+	Name       string      `yaml:"name"`       // API 名称，会出现在工具名中：api_<name>__<operationId>
+	SpecFile   string      `yaml:"spec_file"`  // OpenAPI 文档路径（JSON 或 YAML），启动时读取
+	BaseURL    string      `yaml:"base_url"`   // 覆盖文档中的 servers 地址
+	Auth       OpenAPIAuth `yaml:"auth"`       // 认证方式
+	Operations []string    `yaml:"operations"` // 需要暴露的 operationId，留空表示全部
+}
+
+// OpenAPIAuth OpenAPI 工具的认证配置
+type OpenAPIAuth struct {
+	Type     string `yaml:"type"`     // none / header / bearer / basic
+	Header   string `yaml:"header"`   // type 为 header 时的请求头名称，如 X-API-Key
+	Username string `yaml:"username"` // type 为 basic 时的用户名
+	Secret   string `yaml:"secret"`   // 请求头的值、bearer token 或 basic 密码
+}
+
+// CodeExecution code_execute 工具的 YAML 配置
+// 代码在独立的 Linux 命名空间中运行（无网络），并受 CPU、内存和运行时间限制
+type CodeExecution struct {
+	Enabled        bool     `yaml:"enabled"`         // 默认关闭，仅支持 Linux
+	PythonPath     string   `yaml:"python_path"`     // 默认使用 PATH 中的 python3
+	NodePath       string   `yaml:"node_path"`       // 默认使用 PATH 中的 node
+	WorkDir        string   `yaml:"work_dir"`        // 每次运行的临时工作目录，默认系统临时目录下的 aiguide-code
+	TimeoutSeconds int      `yaml:"timeout_seconds"` // 单次运行超时（秒），默认 30
+	MemoryMB       int64    `yaml:"memory_mb"`       // 单次运行内存上限（MB），默认 512
+	MaxProcesses   int      `yaml:"max_processes"`   // 单次运行的进程与线程数上限，默认 64
+	ReadOnlyPaths  []string `yaml:"read_only_paths"` // 额外只读挂载的目录，如 /usr 之外的解释器或虚拟环境
+}
+
+// Scheduler 定时任务调度 YAML 配置
+// 多个后端实例可共享同一数据库运行，到期任务通过条件更新认领，只会被一个实例执行
+type Scheduler struct {
+	Workers int `yaml:"workers"` // 单个实例同时执行的定时任务数，默认 4
+}
+
+// WebPush 浏览器推送（Web Push）YAML 配置
+// 未配置私钥时首次启动自动生成 VAPID 密钥对，加密保存在数据库中供所有实例共用
+type WebPush struct {
+	Subject    string `yaml:"subject"`     // 推送服务联系方式（mailto: 或 https: 地址），默认使用 https 的 frontend_url
+	PublicKey  string `yaml:"public_key"`  // VAPID 公钥（base64url），留空时由私钥推导
+	PrivateKey string `yaml:"private_key"` // VAPID 私钥（base64url）
+}
+
+// ChatBots 聊天机器人 YAML 配置
+// 用户在设置页生成配对码，向机器人发送 /pair 配对码 关联账号后即可对话
+type ChatBots struct {
+	Telegram TelegramBot `yaml:"telegram"`
+	Slack    SlackBot    `yaml:"slack"`
+}
+
+// TelegramBot Telegram 机器人配置，token 留空时不启用
+type TelegramBot struct {
+	Token         string `yaml:"token"`          // BotFather 签发的机器人令牌
+	WebhookSecret string `yaml:"webhook_secret"` // Webhook 密钥令牌，Telegram 每次回调时携带，启用时必填
+	WebhookURL    string `yaml:"webhook_url"`    // 启动时通过 setWebhook 注册的地址，如 https://example.com/api/chat-bots/telegram/webhook；留空时需手动注册
+}
+
+// SlackBot Slack 应用配置，bot_token 留空时不启用
+// 事件订阅地址为 /api/chat-bots/slack/events，需订阅 message.im 与 app_mention 事件
+type SlackBot struct {
+	BotToken      string `yaml:"bot_token"`      // Bot User OAuth Token（xoxb-...）
+	SigningSecret string `yaml:"signing_secret"` // 校验事件请求签名的 Signing Secret，启用时必填
+}
+
+// GitHubLogin GitHub OAuth App 登录配置，client_id 留空时不启用
+// OAuth App 的回调地址为 /api/auth/callback/github
+type GitHubLogin struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+}
+
+// OIDCLogin 通用 OpenID Connect 登录提供方配置
+// 端点通过 {issuer}/.well-known/openid-configuration 自动发现，回调地址为 /api/auth/callback/{name}
+type OIDCLogin struct {
+	Name         string   `yaml:"name"`         // 提供方标识，仅限小写字母、数字、- 和 _，不能为 google 或 github
+	DisplayName  string   `yaml:"display_name"` // 登录按钮上显示的名称，留空时使用 name
+	Issuer       string   `yaml:"issuer"`       // 如 https://keycloak.example.com/realms/company
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"` // 默认 openid email profile
+}
+
+// LocalAccounts 本地账号配置，用于无法访问 Google 等 OAuth 提供方的部署
+// 首个账户无需邀请码即可注册
+type LocalAccounts struct {
+	Enabled      bool   `yaml:"enabled"`
+	Registration string `yaml:"registration"` // invite：凭邀请码注册（默认）；open：开放注册；closed：关闭自助注册，只能由已登录用户创建账户
+}
+
+// SMTP 系统邮件发送配置，server 留空时无法通过邮件重置密码
+type SMTP struct {
+	Server   string `yaml:"server"`   // 如 smtp.example.com:587，端口 465 使用 TLS，其他端口在服务器支持时使用 STARTTLS
+	Username string `yaml:"username"` // 同时作为发件人地址
+	Password string `yaml:"password"`
+	FromName string `yaml:"from_name"` // 发件人名称，默认 AIGuide
+}
+
 // RateLimit 基于 Redis 令牌桶的限流 YAML 配置
 type RateLimit struct {
 	// Rate 令牌桶容量：每个 period 内允许的最大请求数
@@ -77,8 +212,12 @@ type AIGuide struct {
 	db              *gorm.DB
 	assistant       *assistant.Assistant
 	authService     *auth.AuthService
+	loginProviders  []auth.Provider               // 已启用的登录提供方，按登录页显示顺序排列
 	redisClient     *redis.Client                 // nil 表示未配置 Redis
 	rateLimitConfig *middleware.RateLimiterConfig // nil 表示禁用限流
+	cipher          *secret.Cipher                // 加密用户保存的凭据
+	// sendSystemEmail 通过配置的 SMTP 发送系统邮件，nil 表示未配置 SMTP
+	sendSystemEmail func(to, subject, body string) error
 }
 
 // secureCookie 返回 cookie 的 secure 标志值，默认为 true（生产环境）
@@ -134,8 +273,6 @@ func New(ctx context.Context, config *Config) (*AIGuide, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	migrator := migration.New(db)
-
 	// 转换 WebSearch 配置为 tools.WebSearchConfig
 	// 默认值（语言、超时等）已在 websearch.go 中硬编码
 	webSearchConfig := tools.WebSearchConfig{
@@ -145,22 +282,77 @@ func New(ctx context.Context, config *Config) (*AIGuide, error) {
 	}
 
 	assistantConfig := &assistant.Config{
-		Model:           model,
-		ModelName:       config.ModelName,
-		DB:              db,
-		GenaiClient:     genaiClient,
-		MockImageGen:    config.MockImageGeneration,
-		MockVideoGen:    config.MockVideoGeneration,
-		FrontendURL:     config.FrontendURL,
-		WebSearchConfig: webSearchConfig,
-		ExaConfig:       tools.ExaConfig{APIKey: config.ExaSearch.APIKey},
-		APIKey:          config.APIKey,
-		BaseURL:         config.BaseURL,
-		HTTPClient:      httpClient,
-		LiveModel:       config.LiveModel,
-		ThinkingBudget:  config.ThinkingBudget,
+		Model:            model,
+		ModelName:        config.ModelName,
+		DB:               db,
+		GenaiClient:      genaiClient,
+		MockImageGen:     config.MockImageGeneration,
+		MockVideoGen:     config.MockVideoGeneration,
+		FrontendURL:      config.FrontendURL,
+		WebSearchConfig:  webSearchConfig,
+		ExaConfig:        tools.ExaConfig{APIKey: config.ExaSearch.APIKey},
+		APIKey:           config.APIKey,
+		BaseURL:          config.BaseURL,
+		HTTPClient:       httpClient,
+		LiveModel:        config.LiveModel,
+		ThinkingBudget:   config.ThinkingBudget,
+		ResearchProfile:  config.DeepResearch.DefaultProfile,
+		SchedulerWorkers: config.Scheduler.Workers,
+		WebPushSubject:   config.WebPush.Subject,
+		VAPIDKeys:        webpush.Keys{PublicKey: config.WebPush.PublicKey, PrivateKey: config.WebPush.PrivateKey},
+		ChatBots: assistant.ChatBotConfig{
+			TelegramToken:         config.ChatBots.Telegram.Token,
+			TelegramWebhookSecret: config.ChatBots.Telegram.WebhookSecret,
+			TelegramWebhookURL:    config.ChatBots.Telegram.WebhookURL,
+			SlackBotToken:         config.ChatBots.Slack.BotToken,
+			SlackSigningSecret:    config.ChatBots.Slack.SigningSecret,
+		},
+	}
+
+	// 转换 MCP 服务器配置
+	for _, server := range config.MCPServers {
+		assistantConfig.MCPServers = append(assistantConfig.MCPServers, tools.MCPServerConfig{
+			Name:      server.Name,
+			Transport: server.Transport,
+			Command:   server.Command,
+			Args:      server.Args,
+			Env:       server.Env,
+			URL:       server.URL,
+			Headers:   server.Headers,
+		})
+	}
+
+	// 转换 OpenAPI 工具配置，读取失败的文档记录日志后跳过
+	for _, api := range config.OpenAPITools {
+		spec, err := os.ReadFile(api.SpecFile)
+		if err != nil {
+			slog.Error("failed to read openapi spec, skipping", "api", api.Name, "spec_file", api.SpecFile, "err", err)
+			continue
+		}
+		assistantConfig.OpenAPITools = append(assistantConfig.OpenAPITools, tools.OpenAPIConfig{
+			Name:         api.Name,
+			Spec:         spec,
+			BaseURL:      api.BaseURL,
+			AuthType:     api.Auth.Type,
+			AuthHeader:   api.Auth.Header,
+			AuthUsername: api.Auth.Username,
+			AuthSecret:   api.Auth.Secret,
+			Operations:   api.Operations,
+		})
 	}
 
+	secretKey := config.SecretKey
+	if secretKey == "" {
+		slog.Warn("secret_key is not set, using jwt_secret to encrypt stored credentials")
+		secretKey = config.JWTSecret
+	}
+	cipher, err := secret.NewCipher(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret cipher: %w", err)
+	}
+	assistantConfig.SecretCipher = cipher
+	migrator := migration.New(db).WithCipher(cipher)
+
 	fileStorageDir := config.FileStorageDir
 	if fileStorageDir == "" {
 		fileStorageDir = "data/files"
@@ -177,6 +369,20 @@ func New(ctx context.Context, config *Config) (*AIGuide, error) {
 	}
 	assistantConfig.PDFWorkDir = pdfWorkDir
 
+	if config.CodeExecution.Enabled {
+		// 沙箱只挂载系统目录，这里再屏蔽服务端的数据目录，以防它们位于挂载的目录之下
+		assistantConfig.CodeSandbox = &tools.CodeSandboxConfig{
+			PythonPath:    config.CodeExecution.PythonPath,
+			NodePath:      config.CodeExecution.NodePath,
+			WorkDir:       config.CodeExecution.WorkDir,
+			Timeout:       time.Duration(config.CodeExecution.TimeoutSeconds) * time.Second,
+			MemoryBytes:   config.CodeExecution.MemoryMB << 20,
+			MaxProcesses:  config.CodeExecution.MaxProcesses,
+			ReadOnlyPaths: config.CodeExecution.ReadOnlyPaths,
+			HiddenPaths:   []string{fileStorageDir, pdfWorkDir, filepath.Dir(config.DBFile)},
+		}
+	}
+
 	authConfig := &auth.Config{
 		ClientID:     config.GoogleClientID,
 		ClientSecret: config.GoogleClientSecret,
@@ -186,23 +392,46 @@ func New(ctx context.Context, config *Config) (*AIGuide, error) {
 	authService := auth.NewAuthService(authConfig)
 	assistantConfig.OAuthConfig = authService.GetOAuthConfig()
 
-	assistant, err := assistant.New(assistantConfig)
+	loginProviders, err := newLoginProviders(config, authService)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create assistant: %w", err)
+		return nil, err
 	}
-
-	guide := &AIGuide{
-		config:      config,
-		db:          db,
-		migrator:    migrator,
-		assistant:   assistant,
-		authService: authService,
+	if err := validateLocalAccounts(config.LocalAccounts); err != nil {
+		return nil, err
 	}
 
+	// Redis 需在 assistant 之前创建，站内通知经由 Redis 发布/订阅在多实例间分发
 	rdb, err := redis.New(ctx, config.Redis)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create redis client: %w", err)
 	}
+	assistantConfig.Redis = rdb
+
+	assistant, err := assistant.New(assistantConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create assistant: %w", err)
+	}
+
+	guide := &AIGuide{
+		config:         config,
+		db:             db,
+		migrator:       migrator,
+		assistant:      assistant,
+		authService:    authService,
+		loginProviders: loginProviders,
+		cipher:         cipher,
+	}
+	if config.SMTP.Server != "" {
+		smtpConfig := tools.SMTPConfig{
+			Server:   config.SMTP.Server,
+			Username: config.SMTP.Username,
+			Password: config.SMTP.Password,
+			FromName: cmp.Or(config.SMTP.FromName, "AIGuide"),
+		}
+		guide.sendSystemEmail = func(to, subject, body string) error {
+			return tools.SendSystemEmail(smtpConfig, to, subject, body)
+		}
+	}
 
 	guide.redisClient = rdb
 	guide.rateLimitConfig = &middleware.RateLimiterConfig{
@@ -242,6 +471,9 @@ func (a *AIGuide) Run(ctx context.Context) error {
 	if err := a.migrator.Run(); err != nil {
 		return fmt.Errorf("failed to run database migration: %w", err)
 	}
+	if err := importAllowedEmails(a.db, a.config.AllowedEmails); err != nil {
+		return err
+	}
 
 	if err := a.assistant.Run(ctx); err != nil {
 		return fmt.Errorf("failed to start assistant: %w", err)
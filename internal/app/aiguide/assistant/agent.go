@@ -28,9 +28,9 @@ func NewAssistantAgent(config *Config) (agent.Agent, error) {
 		return nil, err
 	}
 
-	partition := partitionTools(allTools)
+	partition := partitionTools(allTools, config.MCPToolsets, config.OpenAPIToolsets)
 
-	subAgents, err := buildSubAgents(partition, config.Model, config.ThinkingBudget)
+	subAgents, err := buildSubAgents(partition, config.Model, config.ThinkingBudget, config.ResearchProfile, config.ToolConfirmation)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build sub-agents: %w", err)
 	}
@@ -123,7 +123,13 @@ func createAssistantTools(config *Config) ([]tool.Tool, error) {
 		return nil, fmt.Errorf("failed to create pdf_generate_document tool: %w", err)
 	}
 
-	audioTranscribeTool, err := tools.NewAudioTranscribeTool(config.DB, config.FileStore, config.GenaiClient, config.PDFWorkDir)
+	// A nil hub must not become a non-nil tools.Notifier.
+	var notifier tools.Notifier
+	if config.Notifications != nil {
+		notifier = config.Notifications
+	}
+
+	audioTranscribeTool, err := tools.NewAudioTranscribeTool(config.DB, config.FileStore, config.GenaiClient, config.PDFWorkDir, notifier)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create audio_transcribe tool: %w", err)
 	}
@@ -133,7 +139,7 @@ func createAssistantTools(config *Config) ([]tool.Tool, error) {
 		return nil, fmt.Errorf("failed to create image gen tool: %w", err)
 	}
 
-	videoGenTool, err := tools.NewVideoGenTool(config.GenaiClient, config.DB, config.FileStore, config.MockVideoGen)
+	videoGenTool, err := tools.NewVideoGenTool(config.GenaiClient, config.DB, config.FileStore, config.MockVideoGen, notifier)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create video gen tool: %w", err)
 	}
@@ -216,5 +222,14 @@ func createAssistantTools(config *Config) ([]tool.Tool, error) {
 		toolList = append(toolList, calendarTool)
 	}
 
+	// Code execution is opt-in and needs a working sandbox.
+	if config.CodeSandbox != nil {
+		codeExecuteTool, err := tools.NewCodeExecuteTool(config.DB, config.FileStore, *config.CodeSandbox)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create code_execute tool: %w", err)
+		}
+		toolList = append(toolList, codeExecuteTool)
+	}
+
 	return toolList, nil
 }
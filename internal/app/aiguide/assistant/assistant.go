@@ -2,14 +2,22 @@ package assistant
 
 import (
 	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/notification"
+	"aiguide/internal/pkg/redis"
+	"aiguide/internal/pkg/secret"
 	"aiguide/internal/pkg/storage"
 	"aiguide/internal/pkg/tools"
+	"aiguide/internal/pkg/webpush"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"golang.org/x/oauth2"
 	"google.golang.org/adk/model"
 	"google.golang.org/adk/runner"
@@ -35,14 +43,24 @@ type Assistant struct {
 	fileStore           storage.FileStore
 	pdfWorkDir          string
 	oauthConfig         *oauth2.Config
+	codeSandbox         *tools.CodeSandboxConfig
+	secretCipher        *secret.Cipher
+	webPushSubject      string
+	vapidKeys           webpush.Keys
 
 	runner         *runner.Runner
 	executorRunner *runner.Runner
+	apiRunner      *runner.Runner // chat bots and the OpenAI-compatible API
 	scheduler      *Scheduler
+	triggerWatcher *TriggerWatcher
+	chatBots       *ChatBotGateway // nil when no bot is configured
+	notifications  *notification.Hub
+	planExecutor   *planExecutor
 
 	authService *auth.AuthService
 
-	thinkingBudget int32
+	thinkingBudget  int32
+	researchProfile string
 
 	liveClient     *genai.Client
 	liveClientOnce sync.Once
@@ -53,6 +71,14 @@ type Assistant struct {
 	baseURL        string
 	httpClient     *http.Client
 	liveTools      []adktool.Tool
+
+	mcpToolsets     []adktool.Toolset
+	mcpServer       *mcp.Server
+	openAPIToolsets []adktool.Toolset
+
+	toolNames       []string // names of the built-in tools custom agents may whitelist
+	customRunners   map[int]customRunnerEntry
+	customRunnersMu sync.Mutex
 }
 
 type Config struct {
@@ -73,7 +99,21 @@ type Config struct {
 	HTTPClient        *http.Client
 	LiveModel         string
 	ThinkingBudget    int32
+	ResearchProfile   string                 // default deep research profile: quick, standard or exhaustive
+	ToolConfirmation  tools.ConfirmationMode // how side-effecting tools are confirmed; set per runner
 	OAuthConfig       *oauth2.Config
+	MCPServers        []tools.MCPServerConfig  // external MCP servers declared in the YAML config
+	MCPToolsets       []adktool.Toolset        // connected toolsets for MCPServers plus the per-user servers; built by New
+	OpenAPITools      []tools.OpenAPIConfig    // OpenAPI documents declared in the YAML config
+	SecretCipher      *secret.Cipher           // encrypts credentials of the per-user MCP servers, OpenAPI configs and scheduled task deliveries
+	OpenAPIToolsets   []adktool.Toolset        // toolsets for OpenAPITools plus the per-user configs; built by New
+	CodeSandbox       *tools.CodeSandboxConfig // enables code_execute when set
+	SchedulerWorkers  int                      // concurrent scheduled task runs per process; 0 uses the default
+	Redis             *redis.Client            // fans notifications out across instances; nil keeps them in-process
+	Notifications     *notification.Hub        // publishes in-app notifications of long running tools; built by New
+	WebPushSubject    string                   // VAPID contact; defaults to an https FrontendURL
+	VAPIDKeys         webpush.Keys             // generated and stored in the database when empty
+	ChatBots          ChatBotConfig            // Telegram and Slack bots; disabled without tokens
 }
 
 func New(config *Config) (*Assistant, error) {
@@ -85,6 +125,16 @@ func New(config *Config) (*Assistant, error) {
 		slog.Error("config.DB is nil")
 		return nil, fmt.Errorf("config.DB cannot be nil")
 	}
+	if !ValidResearchProfile(config.ResearchProfile) {
+		slog.Error("invalid research profile", "profile", config.ResearchProfile)
+		return nil, fmt.Errorf("invalid research profile: %s", config.ResearchProfile)
+	}
+	if config.ChatBots.TelegramToken != "" && config.ChatBots.TelegramWebhookSecret == "" {
+		return nil, fmt.Errorf("a webhook secret is required for the telegram bot")
+	}
+	if config.ChatBots.SlackBotToken != "" && config.ChatBots.SlackSigningSecret == "" {
+		return nil, fmt.Errorf("a signing secret is required for the slack bot")
+	}
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 		NamingStrategy: schema.NamingStrategy{
@@ -116,12 +166,22 @@ func New(config *Config) (*Assistant, error) {
 		fileStore:           config.FileStore,
 		pdfWorkDir:          config.PDFWorkDir,
 		thinkingBudget:      config.ThinkingBudget,
+		researchProfile:     config.ResearchProfile,
 		liveModel:           config.LiveModel,
 		apiKey:              config.APIKey,
 		baseURL:             config.BaseURL,
 		httpClient:          config.HTTPClient,
 		oauthConfig:         config.OAuthConfig,
+		codeSandbox:         config.CodeSandbox,
+		secretCipher:        config.SecretCipher,
+		webPushSubject:      config.WebPushSubject,
+		vapidKeys:           config.VAPIDKeys,
+		notifications:       notification.NewHub(config.DB, config.Redis),
 	}
+	config.Notifications = assistant.notifications
+
+	assistant.mcpToolsets = newMCPToolsets(config.MCPServers, config.DB, config.SecretCipher, config.HTTPClient)
+	assistant.openAPIToolsets = newOpenAPIToolsets(config.OpenAPITools, config.DB, config.SecretCipher, config.HTTPClient)
 
 	allTools, err := createAssistantTools(config)
 	if err != nil {
@@ -136,27 +196,168 @@ func New(config *Config) (*Assistant, error) {
 		}
 	}
 
+	assistant.mcpServer = newMCPServer(allTools, config.DB)
+	for _, t := range allTools {
+		assistant.toolNames = append(assistant.toolNames, t.Name())
+	}
+
 	runner, err := assistant.createRunner()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create runner: %w", err)
 	}
 	assistant.runner = runner
 
-	executorRunner, err := assistant.createExecutorRunner()
+	executorRunner, err := assistant.createExecutorRunner(tools.ConfirmationOff)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create executor runner: %w", err)
 	}
 	assistant.executorRunner = executorRunner
-	assistant.scheduler = newScheduler(config.DB, executorRunner, session)
+	assistant.scheduler = newScheduler(config.DB, executorRunner, session, config.SchedulerWorkers)
+	assistant.scheduler.cipher = config.SecretCipher
+	assistant.scheduler.httpClient = config.HTTPClient
+	assistant.scheduler.notifications = assistant.notifications
+	triggerRunner, err := assistant.createExecutorRunner(tools.ConfirmationDeny)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trigger runner: %w", err)
+	}
+	assistant.triggerWatcher = newTriggerWatcher(config.DB, triggerRunner, session, config.HTTPClient)
+	assistant.triggerWatcher.notifications = assistant.notifications
+
+	apiRunner, err := assistant.createAPIRunner()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api runner: %w", err)
+	}
+	assistant.apiRunner = apiRunner
+
+	if config.ChatBots.TelegramToken != "" || config.ChatBots.SlackBotToken != "" {
+		assistant.chatBots = newChatBotGateway(config.DB, apiRunner, session, config.ChatBots, config.HTTPClient)
+		assistant.chatBots.fileStore = config.FileStore
+		assistant.chatBots.claimSession = assistant.claimSessionMeta
+		assistant.chatBots.memories = assistant.fetchUserMemories
+		assistant.chatBots.generateTitle = assistant.generateTitle
+	}
+
+	plannerRunner, err := assistant.createPlannerRunner()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create planner runner: %w", err)
+	}
+	planTaskRunner, err := assistant.createExecutorRunner(tools.ConfirmationAsk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan task runner: %w", err)
+	}
+	assistant.planExecutor = &planExecutor{
+		db:       config.DB,
+		session:  session,
+		planner:  plannerRunner,
+		executor: planTaskRunner,
+	}
 
 	return assistant, nil
 }
 
 func (a *Assistant) Run(ctx context.Context) error {
+	if err := a.enableWebPush(); err != nil {
+		return err
+	}
+	a.notifications.Start(ctx)
 	a.scheduler.Start(ctx)
+	a.triggerWatcher.Start(ctx)
+	if a.chatBots != nil {
+		a.chatBots.Start(ctx)
+	}
+	go func() {
+		<-ctx.Done()
+		closeMCPToolsets(a.mcpToolsets)
+	}()
+	return nil
+}
+
+// enableWebPush sets up browser push for the notification hub. Without a
+// configured key pair one is generated and stored on first start; without a
+// mailto: or https: subject web push stays disabled.
+func (a *Assistant) enableWebPush() error {
+	subject := a.webPushSubject
+	if subject == "" && strings.HasPrefix(a.frontendURL, "https://") {
+		subject = a.frontendURL
+	}
+	if subject == "" {
+		slog.Warn("web push is disabled: set web_push.subject or an https frontend_url")
+		return nil
+	}
+	keys := a.vapidKeys
+	if keys.PrivateKey == "" {
+		if a.secretCipher == nil {
+			slog.Warn("web push is disabled: a secret key is required to store the vapid keys")
+			return nil
+		}
+		var err error
+		if keys, err = notification.LoadVAPIDKeys(a.db, a.secretCipher); err != nil {
+			return err
+		}
+	}
+	sender, err := webpush.NewSender(keys, subject, a.httpClient)
+	if err != nil {
+		return fmt.Errorf("invalid web push config: %w", err)
+	}
+	a.notifications.SetWebPush(notification.NewWebPusher(a.db, sender))
+	slog.Info("web push enabled", "subject", subject)
 	return nil
 }
 
+// mcpConnectTimeout bounds the startup connection to each configured MCP server.
+const mcpConnectTimeout = 30 * time.Second
+
+// newMCPToolsets connects to the configured MCP servers and discovers their
+// tools. A server that cannot be reached is logged and kept: its tools are
+// discovered once it becomes available. The per-user toolset is always added.
+func newMCPToolsets(servers []tools.MCPServerConfig, db *gorm.DB, cipher *secret.Cipher, httpClient *http.Client) []adktool.Toolset {
+	toolsets := make([]adktool.Toolset, 0, len(servers)+1)
+	for _, server := range servers {
+		set, err := tools.NewMCPToolset(server, tools.MCPToolPrefix, httpClient)
+		if err != nil {
+			slog.Error("invalid mcp server config, skipping", "server", server.Name, "err", err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+		if err := set.Connect(ctx); err != nil {
+			slog.Error("failed to connect to mcp server, will retry on demand", "server", server.Name, "err", err)
+		}
+		cancel()
+		toolsets = append(toolsets, set)
+	}
+	return append(toolsets, tools.NewUserMCPToolset(db, cipher, httpClient))
+}
+
+// newOpenAPIToolsets builds a toolset for each configured OpenAPI document,
+// skipping invalid ones, plus the per-user toolset when a cipher is set.
+func newOpenAPIToolsets(configs []tools.OpenAPIConfig, db *gorm.DB, cipher *secret.Cipher, httpClient *http.Client) []adktool.Toolset {
+	toolsets := make([]adktool.Toolset, 0, len(configs)+1)
+	for _, cfg := range configs {
+		set, err := tools.NewOpenAPIToolset(cfg, httpClient)
+		if err != nil {
+			slog.Error("invalid openapi tool config, skipping", "api", cfg.Name, "err", err)
+			continue
+		}
+		toolsets = append(toolsets, set)
+	}
+	if cipher == nil {
+		return toolsets
+	}
+	return append(toolsets, tools.NewUserOpenAPIToolset(db, cipher, httpClient))
+}
+
+func closeMCPToolsets(toolsets []adktool.Toolset) {
+	for _, ts := range toolsets {
+		closer, ok := ts.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			slog.Warn("failed to close mcp toolset", "toolset", ts.Name(), "err", err)
+		}
+	}
+}
+
 func (a *Assistant) getLiveClient(ctx context.Context) (*genai.Client, error) {
 	a.liveClientOnce.Do(func() {
 		a.liveClient, a.liveClientErr = newLiveClient(ctx, a.apiKey, a.baseURL, a.httpClient)
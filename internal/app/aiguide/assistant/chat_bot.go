@@ -0,0 +1,571 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/chatbot"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/storage"
+	"aiguide/internal/pkg/tools"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// chatBotPayloadLimit caps the body of a webhook call from a platform.
+	chatBotPayloadLimit = 1 << 20
+	// defaultChatBotWorkers is the number of bot messages one process
+	// answers concurrently; further messages wait for a free worker.
+	defaultChatBotWorkers = 4
+	// chatBotProgressInterval throttles the edits of the placeholder reply
+	// that show the tool being called.
+	chatBotProgressInterval = 2 * time.Second
+)
+
+// Replies of the bots. Like the rest of the assistant they are in Chinese.
+const (
+	chatBotThinkingText = "⏳ 正在思考…"
+	chatBotUnlinkedText = "你好！使用前请先关联 AIGuide 账号：在 AIGuide 的「设置 → 聊天机器人」页面生成配对码，然后发送 /pair 配对码。"
+	chatBotHelpText     = "直接发送消息即可与助手对话，支持图片、PDF 和音频文件。\n/new 开始新的对话\n/pair 配对码 关联 AIGuide 账号"
+	chatBotPairedText   = "✅ 已关联到你的 AIGuide 账号，现在可以直接发消息和我对话了。"
+	chatBotBadCodeText  = "配对码无效或已过期，请在 AIGuide 的「设置 → 聊天机器人」页面重新生成。"
+	chatBotNewText      = "已开始新的对话。"
+	chatBotNoReplyText  = "（助手没有生成回复）"
+	chatBotDeniedText   = "你的 AIGuide 账号已被停用或为只读，无法与助手对话，请联系管理员。"
+)
+
+// ChatBotConfig enables the Telegram and Slack bots. A bot is enabled when
+// its token is set.
+type ChatBotConfig struct {
+	TelegramToken         string
+	TelegramWebhookSecret string // checked on every webhook call; required with TelegramToken
+	TelegramWebhookURL    string // registered with setWebhook on start when set
+	SlackBotToken         string
+	SlackSigningSecret    string // required with SlackBotToken
+	TelegramAPIURL        string // defaults to chatbot.TelegramAPIURL; replaced in tests
+	SlackAPIURL           string // defaults to chatbot.SlackAPIURL; replaced in tests
+}
+
+// ChatBotGateway answers messages sent to the Telegram and Slack bots. Each
+// chat, or thread within a chat, maps to an assistant session per linked
+// user, so a conversation continues until the user sends /new.
+type ChatBotGateway struct {
+	db        *gorm.DB
+	runner    *runner.Runner
+	session   session.Service
+	fileStore storage.FileStore
+
+	bots               map[string]chatbot.Bot
+	telegram           *chatbot.Telegram
+	telegramSecret     string
+	telegramWebhookURL string
+	slackSigningSecret string
+
+	slots chan struct{}
+	wg    sync.WaitGroup
+	// locks serializes the messages of one conversation so that replies
+	// follow each other in the session.
+	locks sync.Map
+	// baseCtx is the context passed to Start; runs inherit it so they
+	// outlive the webhook call that started them.
+	baseCtx context.Context
+	// maxRuntime bounds each agent run.
+	maxRuntime time.Duration
+
+	// claimSession, memories and generateTitle set up new sessions like
+	// the web chat does; generateTitle is nil in tests.
+	claimSession  func(sessionID string, userID int) error
+	memories      func(userID int) (string, error)
+	generateTitle func(ctx context.Context, sessionID, firstMessage string) error
+}
+
+func newChatBotGateway(db *gorm.DB, r *runner.Runner, s session.Service, cfg ChatBotConfig, httpClient *http.Client) *ChatBotGateway {
+	g := &ChatBotGateway{
+		db:                 db,
+		runner:             r,
+		session:            s,
+		bots:               map[string]chatbot.Bot{},
+		telegramSecret:     cfg.TelegramWebhookSecret,
+		telegramWebhookURL: cfg.TelegramWebhookURL,
+		slackSigningSecret: cfg.SlackSigningSecret,
+		slots:              make(chan struct{}, defaultChatBotWorkers),
+		baseCtx:            context.Background(),
+		maxRuntime:         tools.DefaultScheduledTaskMaxRuntimeMinutes * time.Minute,
+	}
+	if cfg.TelegramToken != "" {
+		g.telegram = chatbot.NewTelegram(cfg.TelegramAPIURL, cfg.TelegramToken, httpClient)
+		g.bots[constant.ChatBotProviderTelegram] = g.telegram
+	}
+	if cfg.SlackBotToken != "" {
+		g.bots[constant.ChatBotProviderSlack] = chatbot.NewSlack(cfg.SlackAPIURL, cfg.SlackBotToken, httpClient)
+	}
+	return g
+}
+
+// Start registers the Telegram webhook when a webhook URL is configured.
+// Messages arriving after ctx is cancelled are no longer answered.
+func (g *ChatBotGateway) Start(ctx context.Context) {
+	g.baseCtx = ctx
+	if g.telegram != nil && g.telegramWebhookURL != "" {
+		if err := g.telegram.SetWebhook(ctx, g.telegramWebhookURL, g.telegramSecret); err != nil {
+			slog.Error("chat bot: failed to register telegram webhook", "err", err)
+		} else {
+			slog.Info("chat bot: telegram webhook registered", "url", g.telegramWebhookURL)
+		}
+	}
+}
+
+// Providers returns the providers of the enabled bots.
+func (g *ChatBotGateway) Providers() []string {
+	providers := make([]string, 0, len(g.bots))
+	for _, provider := range []string{constant.ChatBotProviderTelegram, constant.ChatBotProviderSlack} {
+		if g.bots[provider] != nil {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// TelegramWebhook receives updates of the Telegram bot. It is a public route
+// authenticated by the secret token registered with setWebhook. Messages
+// are answered in the background so Telegram gets its 200 right away.
+func (a *Assistant) TelegramWebhook(ctx *gin.Context) {
+	g := a.chatBots
+	if g == nil || g.bots[constant.ChatBotProviderTelegram] == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "telegram bot is not enabled"})
+		return
+	}
+	if err := chatbot.VerifyTelegramRequest(g.telegramSecret, ctx.Request.Header); err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	body, ok := readChatBotPayload(ctx)
+	if !ok {
+		return
+	}
+	msg, err := chatbot.ParseTelegramUpdate(body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg != nil {
+		g.dispatch(msg)
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// SlackEvents receives Events API requests of the Slack app. It is a public
+// route authenticated by the request signature. Slack redelivers events
+// not acknowledged within 3 seconds; those retries are acknowledged without
+// answering the message again.
+func (a *Assistant) SlackEvents(ctx *gin.Context) {
+	g := a.chatBots
+	if g == nil || g.bots[constant.ChatBotProviderSlack] == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "slack bot is not enabled"})
+		return
+	}
+	body, ok := readChatBotPayload(ctx)
+	if !ok {
+		return
+	}
+	if err := chatbot.VerifySlackRequest(g.slackSigningSecret, ctx.Request.Header, body, time.Now()); err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	msg, challenge, err := chatbot.ParseSlackEvent(body)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if challenge != "" {
+		ctx.JSON(http.StatusOK, gin.H{"challenge": challenge})
+		return
+	}
+	if msg != nil && ctx.GetHeader(chatbot.SlackRetryHeader) == "" {
+		g.dispatch(msg)
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// readChatBotPayload reads the body of a webhook call, answering 400 or 413
+// itself when it cannot be used.
+func readChatBotPayload(ctx *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, chatBotPayloadLimit+1))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return nil, false
+	}
+	if len(body) > chatBotPayloadLimit {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("payload exceeds %d bytes", chatBotPayloadLimit)})
+		return nil, false
+	}
+	return body, true
+}
+
+// dispatch answers msg on a background worker.
+func (g *ChatBotGateway) dispatch(msg *chatbot.Message) {
+	g.wg.Go(func() {
+		select {
+		case g.slots <- struct{}{}:
+		case <-g.baseCtx.Done():
+			return
+		}
+		defer func() { <-g.slots }()
+		g.handle(msg)
+	})
+}
+
+// handle answers one message: bot commands, pairing, or a turn of the
+// conversation with the assistant.
+func (g *ChatBotGateway) handle(msg *chatbot.Message) {
+	bot := g.bots[msg.Provider]
+	ctx, cancel := context.WithTimeout(g.baseCtx, g.maxRuntime)
+	defer cancel()
+	logAttrs := []any{"provider", msg.Provider, "chat_id", msg.ChatID, "sender_id", msg.SenderID}
+
+	command, arg := parseChatBotCommand(msg.Text)
+	if command == "pair" || (command == "start" && arg != "") {
+		g.reply(ctx, bot, msg, "", g.pair(msg, arg))
+		return
+	}
+
+	var link table.ChatBotLink
+	err := g.db.Where("provider = ? AND external_user_id = ?", msg.Provider, msg.SenderID).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		g.reply(ctx, bot, msg, "", chatBotUnlinkedText)
+		return
+	}
+	if err != nil {
+		slog.Error("chat bot: failed to find account link", append(logAttrs, "err", err)...)
+		g.reply(ctx, bot, msg, "", "❌ 处理失败，请稍后再试。")
+		return
+	}
+
+	switch command {
+	case "new":
+		err := g.db.Where("provider = ? AND chat_id = ? AND thread_id = ? AND user_id = ?",
+			msg.Provider, msg.ChatID, msg.ThreadID, link.UserID).Delete(&table.ChatBotThread{}).Error
+		if err != nil {
+			slog.Error("chat bot: failed to reset conversation", append(logAttrs, "err", err)...)
+		}
+		g.reply(ctx, bot, msg, "", chatBotNewText)
+		return
+	case "start", "help":
+		g.reply(ctx, bot, msg, "", chatBotHelpText)
+		return
+	}
+
+	// Bot turns bypass the HTTP middleware, so the account is checked on
+	// every message: disabling it or making it read-only takes effect at once.
+	if err := middleware.VerifyUserCanRun(ctx, g.db, link.UserID); err != nil {
+		slog.Warn("chat bot: skipped message", append(logAttrs, "user_id", link.UserID, "err", err)...)
+		if errors.Is(err, middleware.ErrUserCannotRun) {
+			g.reply(ctx, bot, msg, "", chatBotDeniedText)
+		} else {
+			g.reply(ctx, bot, msg, "", "❌ 处理失败，请稍后再试。")
+		}
+		return
+	}
+
+	lockKey := strings.Join([]string{msg.Provider, msg.ChatID, msg.ThreadID, strconv.Itoa(link.UserID)}, "\x00")
+	lock, _ := g.locks.LoadOrStore(lockKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if err := g.converse(ctx, bot, msg, link.UserID); err != nil {
+		slog.Error("chat bot: failed to answer message", append(logAttrs, "err", err)...)
+	}
+}
+
+// parseChatBotCommand recognizes /pair CODE, /start [CODE], /new and /help.
+// Telegram appends the bot name to commands in groups (/new@my_bot), and
+// Slack reserves the slash for its own commands, so the bare words are
+// accepted too when they make up the whole message.
+func parseChatBotCommand(text string) (string, string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	name, slash := strings.CutPrefix(fields[0], "/")
+	name, _, _ = strings.Cut(strings.ToLower(name), "@")
+	arg := ""
+	if len(fields) > 1 {
+		arg = fields[1]
+	}
+	switch name {
+	case "pair":
+		if len(fields) == 2 {
+			return name, arg
+		}
+	case "start":
+		if slash && len(fields) <= 2 {
+			return name, arg
+		}
+	case "new", "help":
+		if len(fields) == 1 {
+			return name, ""
+		}
+	}
+	return "", ""
+}
+
+// pair links the sender's account to the user who generated code and
+// returns the reply. A used code is deleted; an account linked before is
+// moved to the new user.
+func (g *ChatBotGateway) pair(msg *chatbot.Message, code string) string {
+	hash := auth.HashAPIToken(strings.ToUpper(strings.TrimSpace(code)))
+	var userID int
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		var pairing table.ChatBotPairingCode
+		if err := tx.Where("code_hash = ? AND expires_at > ?", hash, time.Now()).First(&pairing).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&pairing).Error; err != nil {
+			return err
+		}
+		userID = pairing.UserID
+		link := table.ChatBotLink{
+			UserID:         pairing.UserID,
+			Provider:       msg.Provider,
+			ExternalUserID: msg.SenderID,
+			ExternalName:   truncateRunes(msg.SenderName, 255),
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "provider"}, {Name: "external_user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "external_name", "updated_at"}),
+		}).Create(&link).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return chatBotBadCodeText
+	}
+	if err != nil {
+		slog.Error("chat bot: failed to link account", "err", err, "provider", msg.Provider, "sender_id", msg.SenderID)
+		return "❌ 关联失败，请稍后再试。"
+	}
+	slog.Info("chat bot: account linked", "provider", msg.Provider, "sender_id", msg.SenderID, "user_id", userID)
+	return chatBotPairedText
+}
+
+// converse runs msg through the assistant in the session of its chat and
+// posts the reply. A placeholder is posted first and edited to show the
+// tools being called, then replaced by the reply.
+func (g *ChatBotGateway) converse(ctx context.Context, bot chatbot.Bot, msg *chatbot.Message, userID int) error {
+	sessionID, isNew, err := g.resolveSession(ctx, msg, userID)
+	if err != nil {
+		g.reply(ctx, bot, msg, "", "❌ 处理失败，请稍后再试。")
+		return err
+	}
+	parts, err := g.buildMessageParts(ctx, bot, msg, userID, sessionID)
+	if err != nil {
+		g.reply(ctx, bot, msg, "", "❌ "+err.Error())
+		return err
+	}
+	if isNew {
+		if memoryContext, err := g.memories(userID); err != nil {
+			slog.Warn("chat bot: fetchUserMemories failed, skipping memory injection", "err", err, "user_id", userID)
+		} else if memoryContext != "" {
+			parts = prependMemoryContext(parts, memoryContext)
+		}
+		if g.generateTitle != nil {
+			titleMessage := msg.Text
+			if titleMessage == "" {
+				titleMessage = fmt.Sprintf("用户发送了 %d 个文件", len(msg.Files))
+			}
+			go func() {
+				if err := g.generateTitle(context.Background(), sessionID, titleMessage); err != nil {
+					slog.Error("a.generateTitle failed", "err", err)
+				}
+			}()
+		}
+	}
+
+	placeholderID, err := bot.SendMessage(ctx, msg.ChatID, msg.ReplyThreadID, chatBotThinkingText)
+	if err != nil {
+		slog.Warn("chat bot: failed to post placeholder", "err", err, "provider", msg.Provider)
+	}
+	var lastProgress time.Time
+	progress := func(label string) {
+		if placeholderID == "" || time.Since(lastProgress) < chatBotProgressInterval {
+			return
+		}
+		lastProgress = time.Now()
+		if err := bot.EditMessage(ctx, msg.ChatID, placeholderID, "⏳ "+label); err != nil {
+			slog.Warn("chat bot: failed to update placeholder", "err", err, "provider", msg.Provider)
+		}
+	}
+
+	output, runErr := g.run(ctx, userID, sessionID, genai.NewContentFromParts(parts, genai.RoleUser), progress)
+	switch {
+	case runErr != nil:
+		output = "❌ 处理失败：" + runErr.Error()
+	case output == "":
+		output = chatBotNoReplyText
+	}
+	g.reply(ctx, bot, msg, placeholderID, output)
+	return runErr
+}
+
+// resolveSession returns the session of the conversation msg belongs to,
+// creating one when the chat has none or its session was deleted.
+func (g *ChatBotGateway) resolveSession(ctx context.Context, msg *chatbot.Message, userID int) (string, bool, error) {
+	userIDStr := strconv.Itoa(userID)
+	var thread table.ChatBotThread
+	err := g.db.Where("provider = ? AND chat_id = ? AND thread_id = ? AND user_id = ?",
+		msg.Provider, msg.ChatID, msg.ThreadID, userID).First(&thread).Error
+	switch {
+	case err == nil:
+		_, err := g.session.Get(ctx, &session.GetRequest{
+			AppName:   constant.AppNameAssistant.String(),
+			UserID:    userIDStr,
+			SessionID: thread.SessionID,
+		})
+		if err == nil {
+			return thread.SessionID, false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", false, fmt.Errorf("failed to get session: %w", err)
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return "", false, fmt.Errorf("failed to find chat bot thread: %w", err)
+	default:
+		thread = table.ChatBotThread{Provider: msg.Provider, ChatID: msg.ChatID, ThreadID: msg.ThreadID, UserID: userID}
+	}
+
+	thread.SessionID = generateSessionID()
+	_, err = g.session.Create(ctx, &session.CreateRequest{
+		AppName:   constant.AppNameAssistant.String(),
+		UserID:    userIDStr,
+		SessionID: thread.SessionID,
+		State:     map[string]any{},
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create session: %w", err)
+	}
+	if err := g.claimSession(thread.SessionID, userID); err != nil {
+		return "", false, err
+	}
+	if err := g.db.Save(&thread).Error; err != nil {
+		return "", false, fmt.Errorf("failed to save chat bot thread: %w", err)
+	}
+	return thread.SessionID, true, nil
+}
+
+// buildMessageParts downloads the attachments of msg and builds the user
+// message like the web chat does: PDFs and audio are stored as file assets,
+// images are sent inline.
+func (g *ChatBotGateway) buildMessageParts(ctx context.Context, bot chatbot.Bot, msg *chatbot.Message, userID int, sessionID string) ([]*genai.Part, error) {
+	if len(msg.Files) > maxUserFileCount {
+		return nil, fmt.Errorf("一次最多发送 %d 个文件", maxUserFileCount)
+	}
+	var (
+		parts     []*genai.Part
+		fileNames []string
+	)
+	for _, file := range msg.Files {
+		mimeType, _, _ := strings.Cut(file.MimeType, ";")
+		mimeType = strings.TrimSpace(mimeType)
+		if alias, ok := imageMimeAliases[mimeType]; ok {
+			mimeType = alias
+		}
+		if !allowedUserUploadMimeTypes[mimeType] {
+			return nil, fmt.Errorf("不支持的文件类型：%s", cmp.Or(mimeType, "未知"))
+		}
+		maxSize := userUploadSizeLimit(mimeType)
+		data, err := bot.DownloadFile(ctx, file, int64(maxSize))
+		if errors.Is(err, chatbot.ErrFileTooLarge) {
+			return nil, fmt.Errorf("文件 %s 超过 %d MB 的大小限制", file.Name, maxSize>>20)
+		}
+		if err != nil {
+			slog.Error("chat bot: failed to download file", "err", err, "provider", msg.Provider, "name", file.Name)
+			return nil, fmt.Errorf("文件 %s 下载失败", file.Name)
+		}
+		if err := validateUserUpload(data, mimeType); err != nil {
+			return nil, err
+		}
+		parts, err = appendUserUploadPart(ctx, parts, g.db, g.fileStore, strconv.Itoa(userID), sessionID, file.Name, data, mimeType, true)
+		if err != nil {
+			return nil, err
+		}
+		fileNames = append(fileNames, file.Name)
+	}
+	// Like buildUserMessageParts, the text goes first.
+	parts = append(appendTextPart(nil, msg.Text, fileNames, len(fileNames)), parts...)
+	if err := ensureUserMessageParts(parts); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// run runs message through the chat bot runner in sessionID and returns the
+// final text reply. progress is called with a label for each tool call.
+func (g *ChatBotGateway) run(ctx context.Context, userID int, sessionID string, message *genai.Content, progress func(label string)) (string, error) {
+	// Like runBackgroundAgent, tools read the user, the db connection and the
+	// session from the context.
+	runCtx := context.WithValue(ctx, constant.ContextKeyUserID, userID)
+	runCtx = context.WithValue(runCtx, constant.ContextKeyTx, g.db)
+	runCtx = context.WithValue(runCtx, constant.ContextKeySessionID, sessionID)
+
+	runConfig := agent.RunConfig{StreamingMode: agent.StreamingModeNone}
+	var output string
+	for event, err := range g.runner.Run(runCtx, strconv.Itoa(userID), sessionID, message, runConfig) {
+		if err != nil {
+			return output, fmt.Errorf("runner error: %w", err)
+		}
+		if event == nil || event.Content == nil || event.Partial {
+			continue
+		}
+		var text strings.Builder
+		for _, part := range event.Content.Parts {
+			if call := part.FunctionCall; call != nil && !shouldHideToolCall(call.Name, event.Author) {
+				progress(toolCallLabel(constant.LocaleZH, call.Name, call.Args))
+			}
+			if part.Text != "" && !part.Thought && !isResearchIntermediateAgent(event.Author) {
+				text.WriteString(part.Text)
+			}
+		}
+		// Keep the latest text reply as the answer.
+		if text.Len() > 0 {
+			output = text.String()
+		}
+	}
+	return output, nil
+}
+
+// reply posts text to the conversation of msg, split to the message limit of
+// bot. With a placeholderID the first part replaces the placeholder.
+func (g *ChatBotGateway) reply(ctx context.Context, bot chatbot.Bot, msg *chatbot.Message, placeholderID, text string) {
+	// The reply is posted even when the run timed out.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deliveryTimeout)
+	defer cancel()
+	for i, chunk := range chatbot.SplitMessage(text, bot.MessageLimit()) {
+		if i == 0 && placeholderID != "" {
+			err := bot.EditMessage(ctx, msg.ChatID, placeholderID, chunk)
+			if err == nil {
+				continue
+			}
+			slog.Warn("chat bot: failed to replace placeholder, posting the reply instead", "err", err, "provider", msg.Provider)
+		}
+		if _, err := bot.SendMessage(ctx, msg.ChatID, msg.ReplyThreadID, chunk); err != nil {
+			slog.Error("chat bot: failed to post reply", "err", err, "provider", msg.Provider, "chat_id", msg.ChatID)
+			return
+		}
+	}
+}
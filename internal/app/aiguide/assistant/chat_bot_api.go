@@ -0,0 +1,151 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// chatBotPairingCodeTTL is how long a pairing code can be sent to a bot.
+	chatBotPairingCodeTTL = 10 * time.Minute
+	// chatBotPairingCodeLength is the number of characters of a pairing code.
+	chatBotPairingCodeLength = 8
+	// chatBotPairingCodeAlphabet leaves out characters that are easily
+	// confused when typed (0/O, 1/I).
+	chatBotPairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// ChatBotLinkInfo is the API response shape for a linked chat account.
+type ChatBotLinkInfo struct {
+	ID             int       `json:"id"`
+	Provider       string    `json:"provider"`
+	ExternalUserID string    `json:"external_user_id"`
+	ExternalName   string    `json:"external_name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ChatBotStatusResponse lists the enabled bots and the current user's linked
+// chat accounts.
+type ChatBotStatusResponse struct {
+	Providers []string          `json:"providers"`
+	Links     []ChatBotLinkInfo `json:"links"`
+}
+
+// ChatBotPairingCodeResponse is the response of creating a pairing code. The
+// code is only returned once.
+type ChatBotPairingCodeResponse struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetChatBotStatus returns the enabled bots and the current user's linked
+// chat accounts.
+func (a *Assistant) GetChatBotStatus(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var links []table.ChatBotLink
+	if err := a.db.Where("user_id = ?", userID).Order("id").Find(&links).Error; err != nil {
+		slog.Error("failed to query chat bot links", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load chat bot links"})
+		return
+	}
+	response := ChatBotStatusResponse{Providers: []string{}, Links: make([]ChatBotLinkInfo, 0, len(links))}
+	if a.chatBots != nil {
+		response.Providers = a.chatBots.Providers()
+	}
+	for _, link := range links {
+		response.Links = append(response.Links, ChatBotLinkInfo{
+			ID:             link.ID,
+			Provider:       link.Provider,
+			ExternalUserID: link.ExternalUserID,
+			ExternalName:   link.ExternalName,
+			CreatedAt:      link.CreatedAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateChatBotPairingCode creates a pairing code for the current user and
+// invalidates the previous ones. Sending "/pair <code>" to a bot links the
+// sender's chat account to the user.
+func (a *Assistant) CreateChatBotPairingCode(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if a.chatBots == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "no chat bot is enabled"})
+		return
+	}
+
+	code := newChatBotPairingCode()
+	pairing := table.ChatBotPairingCode{
+		UserID:    userID,
+		CodeHash:  auth.HashAPIToken(code),
+		ExpiresAt: time.Now().Add(chatBotPairingCodeTTL),
+	}
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? OR expires_at <= ?", userID, time.Now()).Delete(&table.ChatBotPairingCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&pairing).Error
+	})
+	if err != nil {
+		slog.Error("failed to create chat bot pairing code", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create pairing code"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, ChatBotPairingCodeResponse{Code: code, ExpiresAt: pairing.ExpiresAt})
+}
+
+// DeleteChatBotLink unlinks a chat account of the current user. The bot
+// stops answering it until it is paired again.
+func (a *Assistant) DeleteChatBotLink(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	linkID, err := strconv.Atoi(ctx.Param("linkId"))
+	if err != nil || linkID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid link id"})
+		return
+	}
+
+	result := a.db.Where("id = ? AND user_id = ?", linkID, userID).Delete(&table.ChatBotLink{})
+	if result.Error != nil {
+		slog.Error("failed to delete chat bot link", "err", result.Error, "link_id", linkID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete chat bot link"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "chat bot link not found"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// newChatBotPairingCode returns a random code of chatBotPairingCodeLength
+// characters. The alphabet has 32 characters, so each random byte maps to
+// one without bias.
+func newChatBotPairingCode() string {
+	b := make([]byte, chatBotPairingCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = chatBotPairingCodeAlphabet[int(b[i])%len(chatBotPairingCodeAlphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,363 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/chatbot"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+// fakeTelegramAPI records the messages sent and edited through the Bot API.
+type fakeTelegramAPI struct {
+	mu     sync.Mutex
+	nextID int
+	sent   []map[string]any
+	edited []map[string]any
+}
+
+func (f *fakeTelegramAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/bottg-token/sendMessage":
+		f.nextID++
+		f.sent = append(f.sent, body)
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, f.nextID)
+	case "/bottg-token/editMessageText":
+		f.edited = append(f.edited, body)
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"ok":false,"description":"Not Found"}`))
+	}
+}
+
+// texts returns the texts of the sent and the edited messages and clears
+// them.
+func (f *fakeTelegramAPI) texts() ([]string, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	collect := func(bodies []map[string]any) []string {
+		var texts []string
+		for _, body := range bodies {
+			texts = append(texts, body["text"].(string))
+		}
+		return texts
+	}
+	sent, edited := collect(f.sent), collect(f.edited)
+	f.sent, f.edited = nil, nil
+	return sent, edited
+}
+
+// newFakeChatBotRunner returns an assistant runner that calls current_time
+// and answers "echo: <message>".
+func newFakeChatBotRunner(t *testing.T, svc session.Service) *runner.Runner {
+	t.Helper()
+	return newScriptedRunner(t, svc, constant.AppNameAssistant, func(ctx agent.InvocationContext) ([]model.LLMResponse, error) {
+		var text strings.Builder
+		for _, part := range ctx.UserContent().Parts {
+			text.WriteString(part.Text)
+		}
+		return []model.LLMResponse{
+			{Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "c1", Name: "current_time"}}}}},
+			{Content: &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "c1", Name: "current_time", Response: map[string]any{"time": "09:00"}}}}}},
+			{Content: genai.NewContentFromText("echo: "+text.String(), genai.RoleModel)},
+		}, nil
+	})
+}
+
+func setupChatBotTestAssistant(t *testing.T, cfg ChatBotConfig) (*Assistant, *gorm.DB) {
+	t.Helper()
+	db := setupSchedulerTestDB(t)
+	if err := db.AutoMigrate(&table.SessionMeta{}, &table.UserMemory{}, &table.ChatBotLink{}, &table.ChatBotThread{}, &table.ChatBotPairingCode{}); err != nil {
+		t.Fatalf("AutoMigrate() error: %v", err)
+	}
+	svc := session.InMemoryService()
+	a := &Assistant{db: db, session: svc}
+	a.chatBots = newChatBotGateway(db, newFakeChatBotRunner(t, svc), svc, cfg, nil)
+	a.chatBots.claimSession = a.claimSessionMeta
+	a.chatBots.memories = a.fetchUserMemories
+	return a, db
+}
+
+func TestChatBotGateway_PairAndConverse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	assistant, db := setupChatBotTestAssistant(t, ChatBotConfig{
+		TelegramToken: "tg-token", TelegramWebhookSecret: "hook-secret", TelegramAPIURL: server.URL,
+	})
+	g := assistant.chatBots
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/chat-bots", assistant.GetChatBotStatus)
+		router.POST("/api/assistant/chat-bots/pairing-codes", assistant.CreateChatBotPairingCode)
+		router.DELETE("/api/assistant/chat-bots/links/:linkId", assistant.DeleteChatBotLink)
+	})
+	message := func(text string) *chatbot.Message {
+		return &chatbot.Message{Provider: constant.ChatBotProviderTelegram, ChatID: "42", SenderID: "1001", SenderName: "ada", Text: text}
+	}
+
+	g.handle(message("hello"))
+	if sent, _ := api.texts(); len(sent) != 1 || sent[0] != chatBotUnlinkedText {
+		t.Fatalf("unlinked reply = %q", sent)
+	}
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/chat-bots/pairing-codes", nil)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create pairing code status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var pairing ChatBotPairingCodeResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &pairing); err != nil || len(pairing.Code) != chatBotPairingCodeLength {
+		t.Fatalf("pairing code = %+v, %v", pairing, err)
+	}
+
+	g.handle(message("/pair WRONG123"))
+	if sent, _ := api.texts(); len(sent) != 1 || sent[0] != chatBotBadCodeText {
+		t.Fatalf("wrong code reply = %q", sent)
+	}
+	g.handle(message("/pair " + strings.ToLower(pairing.Code)))
+	if sent, _ := api.texts(); len(sent) != 1 || sent[0] != chatBotPairedText {
+		t.Fatalf("pair reply = %q", sent)
+	}
+	g.handle(message("/pair " + pairing.Code))
+	if sent, _ := api.texts(); len(sent) != 1 || sent[0] != chatBotBadCodeText {
+		t.Fatalf("reused code reply = %q, want the code to be single use", sent)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/chat-bots", nil)
+	var status ChatBotStatusResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if len(status.Providers) != 1 || status.Providers[0] != constant.ChatBotProviderTelegram ||
+		len(status.Links) != 1 || status.Links[0].ExternalUserID != "1001" || status.Links[0].ExternalName != "ada" {
+		t.Fatalf("status = %+v", status)
+	}
+
+	g.handle(message("hello"))
+	sent, edited := api.texts()
+	if len(sent) != 1 || sent[0] != chatBotThinkingText {
+		t.Fatalf("sent = %q, want the placeholder", sent)
+	}
+	if len(edited) != 2 || !strings.HasPrefix(edited[0], "⏳ ") || edited[1] != "echo: hello" {
+		t.Fatalf("edited = %q, want the tool progress and then the reply", edited)
+	}
+	var thread table.ChatBotThread
+	if err := db.Where("provider = ? AND chat_id = ? AND user_id = ?", constant.ChatBotProviderTelegram, "42", 1).First(&thread).Error; err != nil {
+		t.Fatalf("thread not recorded: %v", err)
+	}
+	var meta table.SessionMeta
+	if err := db.Where("session_id = ?", thread.SessionID).First(&meta).Error; err != nil || meta.UserID != 1 {
+		t.Fatalf("session meta = %+v, %v", meta, err)
+	}
+
+	g.handle(message("again"))
+	api.texts()
+	var threads []table.ChatBotThread
+	db.Find(&threads)
+	if len(threads) != 1 || threads[0].SessionID != thread.SessionID {
+		t.Fatalf("threads = %+v, want the session reused", threads)
+	}
+
+	g.handle(message("/new"))
+	if sent, _ := api.texts(); len(sent) != 1 || sent[0] != chatBotNewText {
+		t.Fatalf("/new reply = %q", sent)
+	}
+	g.handle(message("fresh start"))
+	api.texts()
+	db.Find(&threads)
+	if len(threads) != 1 || threads[0].SessionID == thread.SessionID {
+		t.Fatalf("threads = %+v, want a new session after /new", threads)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodDelete, "/api/assistant/chat-bots/links/"+strconv.Itoa(status.Links[0].ID), nil)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("delete link status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	g.handle(message("hello"))
+	if sent, _ := api.texts(); len(sent) != 1 || sent[0] != chatBotUnlinkedText {
+		t.Fatalf("reply after unlinking = %q", sent)
+	}
+}
+
+func TestChatBotGateway_RejectsUnsupportedFiles(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	assistant, db := setupChatBotTestAssistant(t, ChatBotConfig{
+		TelegramToken: "tg-token", TelegramWebhookSecret: "hook-secret", TelegramAPIURL: server.URL,
+	})
+	link := table.ChatBotLink{UserID: 1, Provider: constant.ChatBotProviderTelegram, ExternalUserID: "1001"}
+	if err := db.Create(&link).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	assistant.chatBots.handle(&chatbot.Message{
+		Provider: constant.ChatBotProviderTelegram, ChatID: "42", SenderID: "1001",
+		Files: []chatbot.File{{ID: "f1", Name: "archive.zip", MimeType: "application/zip"}},
+	})
+	sent, _ := api.texts()
+	if len(sent) != 1 || !strings.Contains(sent[0], "application/zip") {
+		t.Fatalf("reply = %q, want the unsupported type reported", sent)
+	}
+}
+
+func TestChatBotGateway_RefusesReadOnlyAccount(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	assistant, db := setupChatBotTestAssistant(t, ChatBotConfig{
+		TelegramToken: "tg-token", TelegramWebhookSecret: "hook-secret", TelegramAPIURL: server.URL,
+	})
+	link := table.ChatBotLink{UserID: 1, Provider: constant.ChatBotProviderTelegram, ExternalUserID: "1001"}
+	if err := db.Create(&link).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	if err := db.Model(&table.User{}).Where("id = ?", 1).Update("role", constant.UserRoleReadOnly).Error; err != nil {
+		t.Fatalf("db.Update() error: %v", err)
+	}
+
+	assistant.chatBots.handle(&chatbot.Message{Provider: constant.ChatBotProviderTelegram, ChatID: "42", SenderID: "1001", Text: "hello"})
+	sent, _ := api.texts()
+	if len(sent) != 1 || sent[0] != chatBotDeniedText {
+		t.Fatalf("reply = %q, want the account refusal", sent)
+	}
+	var threads int64
+	db.Model(&table.ChatBotThread{}).Count(&threads)
+	if threads != 0 {
+		t.Fatalf("got %d threads, want no conversation started", threads)
+	}
+}
+
+func TestChatBotGateway_RejectsToolsNeedingConfirmation(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	assistant, db := setupChatBotTestAssistant(t, ChatBotConfig{
+		TelegramToken: "tg-token", TelegramWebhookSecret: "hook-secret", TelegramAPIURL: server.URL,
+	})
+	if err := db.AutoMigrate(&table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error: %v", err)
+	}
+	var sentTo []string
+	g := assistant.chatBots
+	g.runner = newConfirmingRunner(t, assistant.session, constant.AppNameAssistant, tools.ConfirmationReject, &sentTo)
+	link := table.ChatBotLink{UserID: 1, Provider: constant.ChatBotProviderTelegram, ExternalUserID: "1001"}
+	if err := db.Create(&link).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	message := &chatbot.Message{Provider: constant.ChatBotProviderTelegram, ChatID: "42", SenderID: "1001", Text: "tell bob"}
+
+	g.handle(message)
+	_, edited := api.texts()
+	if len(sentTo) != 0 || len(edited) == 0 || !strings.Contains(edited[len(edited)-1], "requires confirmation in the web app") {
+		t.Fatalf("sent to %v, replies %q; want send_email rejected by default", sentTo, edited)
+	}
+
+	// A user who turned confirmation off can send from the bot.
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 1, ToolName: "send_email", Required: false}).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	g.handle(message)
+	api.texts()
+	if len(sentTo) != 1 || sentTo[0] != "bob@example.com" {
+		t.Fatalf("sent to %v, want bob once confirmation is off", sentTo)
+	}
+}
+
+func TestChatBotWebhooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant, _ := setupChatBotTestAssistant(t, ChatBotConfig{
+		TelegramToken: "tg-token", TelegramWebhookSecret: "hook-secret", TelegramAPIURL: "http://127.0.0.1:1",
+		SlackBotToken: "xoxb-token", SlackSigningSecret: "signing", SlackAPIURL: "http://127.0.0.1:1",
+	})
+	router := gin.New()
+	router.POST("/api/chat-bots/telegram/webhook", assistant.TelegramWebhook)
+	router.POST("/api/chat-bots/slack/events", assistant.SlackEvents)
+
+	post := func(path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	update := `{"update_id":1,"edited_message":{"text":"x"}}`
+	if resp := post("/api/chat-bots/telegram/webhook", update, nil); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("telegram without secret status = %d", resp.Code)
+	}
+	header := http.Header{chatbot.TelegramSecretHeader: {"hook-secret"}}
+	if resp := post("/api/chat-bots/telegram/webhook", update, header); resp.Code != http.StatusOK {
+		t.Fatalf("telegram status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+
+	body := `{"type":"url_verification","challenge":"abc"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("signing"))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	signed := http.Header{
+		chatbot.SlackTimestampHeader: {timestamp},
+		chatbot.SlackSignatureHeader: {"v0=" + hex.EncodeToString(mac.Sum(nil))},
+	}
+	resp := post("/api/chat-bots/slack/events", body, signed)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"challenge":"abc"`) {
+		t.Fatalf("slack url_verification = %d %s", resp.Code, resp.Body.String())
+	}
+	signed.Set(chatbot.SlackSignatureHeader, "v0=00")
+	if resp := post("/api/chat-bots/slack/events", body, signed); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("slack with a bad signature status = %d", resp.Code)
+	}
+
+	assistant.chatBots = nil
+	if resp := post("/api/chat-bots/telegram/webhook", update, header); resp.Code != http.StatusNotFound {
+		t.Fatalf("telegram without bot status = %d", resp.Code)
+	}
+}
+
+func TestParseChatBotCommand(t *testing.T) {
+	tests := []struct {
+		text, command, arg string
+	}{
+		{"/pair ABCD2345", "pair", "ABCD2345"},
+		{"pair ABCD2345", "pair", "ABCD2345"},
+		{"/start ABCD2345", "start", "ABCD2345"},
+		{"/new@aiguide_bot", "new", ""},
+		{"new", "new", ""},
+		{"new ideas for dinner", "", ""},
+		{"start the report", "", ""},
+		{"help me", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		command, arg := parseChatBotCommand(tt.text)
+		if command != tt.command || arg != tt.arg {
+			t.Errorf("parseChatBotCommand(%q) = %q, %q, want %q, %q", tt.text, command, arg, tt.command, tt.arg)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/model/gemini"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+// customAgentIDPrefix prefixes the agent ID of custom agents in the
+// /:agentId routes and the session app name, e.g. "custom-12".
+const customAgentIDPrefix = "custom-"
+
+// customAgentSubAgents are the sub-agents a custom agent may delegate to.
+var customAgentSubAgents = []string{
+	"web_agent",
+	"deep_research_agent",
+	"comms_agent",
+	"media_agent",
+	"file_agent",
+	"task_agent",
+	"system_agent",
+	"mcp_agent",
+	"api_agent",
+}
+
+var errAgentNotFound = errors.New("agent not found")
+
+// CustomAgentDefinition describes a user-defined agent built from a subset of
+// the assistant's tools and sub-agents.
+type CustomAgentDefinition struct {
+	Name        string
+	Description string
+	Instruction string
+	Tools       []string // tools the agent calls directly
+	SubAgents   []string // sub-agents it may transfer to
+}
+
+// customAgentID returns the agent ID used in routes and as session app name.
+func customAgentID(id int) string {
+	return customAgentIDPrefix + strconv.Itoa(id)
+}
+
+// parseCustomAgentID returns the table ID of a custom agent ID.
+func parseCustomAgentID(agentID string) (int, bool) {
+	raw, ok := strings.CutPrefix(agentID, customAgentIDPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// parseNameList decodes a JSON array column such as CustomAgent.Tools.
+func parseNameList(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(raw), &names); err != nil {
+		return nil, fmt.Errorf("invalid name list: %w", err)
+	}
+	return names, nil
+}
+
+// NewCustomAgent creates a root agent with the definition's instruction that
+// only sees the whitelisted tools and sub-agents.
+func NewCustomAgent(config *Config, def CustomAgentDefinition) (agent.Agent, error) {
+	if config == nil {
+		slog.Error("config parameter is nil")
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	allTools, err := createAssistantTools(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var agentTools []tool.Tool
+	for _, t := range allTools {
+		if slices.Contains(def.Tools, t.Name()) {
+			agentTools = append(agentTools, t)
+		}
+	}
+
+	var subAgents []agent.Agent
+	if len(def.SubAgents) > 0 {
+		partition := partitionTools(allTools, config.MCPToolsets, config.OpenAPIToolsets)
+		all, err := buildSubAgents(partition, config.Model, config.ThinkingBudget, config.ResearchProfile, config.ToolConfirmation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build sub-agents: %w", err)
+		}
+		for _, sub := range all {
+			if slices.Contains(def.SubAgents, sub.Name()) {
+				subAgents = append(subAgents, sub)
+			}
+		}
+	}
+
+	beforeToolCallbacks := confirmationCallbacks(config.ToolConfirmation)
+
+	a, err := llmagent.New(llmagent.Config{
+		Name:        "custom_agent",
+		Model:       config.Model,
+		Description: def.Description,
+		Instruction: def.Instruction,
+		GenerateContentConfig: &genai.GenerateContentConfig{
+			ThinkingConfig: newThinkingConfig(config.ThinkingBudget),
+		},
+		Tools:               agentTools,
+		SubAgents:           subAgents,
+		BeforeToolCallbacks: beforeToolCallbacks,
+	})
+	if err != nil {
+		slog.Error("failed to create custom agent", "name", def.Name, "err", err)
+		return nil, fmt.Errorf("failed to create custom agent: %w", err)
+	}
+	return a, nil
+}
+
+// customRunnerEntry is a cached runner of a custom agent, valid while the
+// agent's row has not been updated.
+type customRunnerEntry struct {
+	updatedAt time.Time
+	runner    *runner.Runner
+}
+
+// runnerForAgent returns the runner that serves agentID for the user: the
+// built-in assistant, or a custom agent owned by the user. Custom runners are
+// built on first use and cached until the agent changes.
+func (a *Assistant) runnerForAgent(ctx context.Context, agentID string, userID int) (*runner.Runner, error) {
+	if agentID == "" || agentID == constant.AppNameAssistant.String() {
+		return a.runner, nil
+	}
+	id, ok := parseCustomAgentID(agentID)
+	if !ok {
+		return nil, errAgentNotFound
+	}
+
+	var row table.CustomAgent
+	if err := a.db.Where("id = ? AND user_id = ?", id, userID).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errAgentNotFound
+		}
+		slog.Error("failed to load custom agent", "agent_id", agentID, "user_id", userID, "err", err)
+		return nil, fmt.Errorf("failed to load custom agent: %w", err)
+	}
+
+	a.customRunnersMu.Lock()
+	defer a.customRunnersMu.Unlock()
+	if entry, ok := a.customRunners[id]; ok && entry.updatedAt.Equal(row.UpdatedAt) {
+		return entry.runner, nil
+	}
+
+	r, err := a.createCustomRunner(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	if a.customRunners == nil {
+		a.customRunners = make(map[int]customRunnerEntry)
+	}
+	a.customRunners[id] = customRunnerEntry{updatedAt: row.UpdatedAt, runner: r}
+	slog.Info("custom agent runner created", "agent_id", agentID, "user_id", userID)
+	return r, nil
+}
+
+// evictCustomRunner drops the cached runner of a custom agent.
+func (a *Assistant) evictCustomRunner(id int) {
+	a.customRunnersMu.Lock()
+	defer a.customRunnersMu.Unlock()
+	delete(a.customRunners, id)
+}
+
+func (a *Assistant) createCustomRunner(ctx context.Context, row table.CustomAgent) (*runner.Runner, error) {
+	toolNames, err := parseNameList(row.Tools)
+	if err != nil {
+		return nil, err
+	}
+	subAgentNames, err := parseNameList(row.SubAgents)
+	if err != nil {
+		return nil, err
+	}
+	m, err := a.modelFor(ctx, row.ModelName)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := a.baseAgentConfig()
+	cfg.Model = m
+	cfg.ToolConfirmation = tools.ConfirmationAsk
+	if row.ThinkingBudget > 0 {
+		cfg.ThinkingBudget = row.ThinkingBudget
+	}
+
+	customAgent, err := NewCustomAgent(cfg, CustomAgentDefinition{
+		Name:        row.Name,
+		Description: row.Description,
+		Instruction: row.Instruction,
+		Tools:       toolNames,
+		SubAgents:   subAgentNames,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := runner.New(runner.Config{
+		AppName:        customAgentID(row.ID),
+		Agent:          customAgent,
+		SessionService: a.session,
+	})
+	if err != nil {
+		slog.Error("failed to create custom agent runner", "agent_id", row.ID, "err", err)
+		return nil, fmt.Errorf("failed to create custom agent runner: %w", err)
+	}
+	return r, nil
+}
+
+// modelFor returns the assistant's model, or a Gemini model with the same
+// credentials when a different model name is requested.
+func (a *Assistant) modelFor(ctx context.Context, modelName string) (model.LLM, error) {
+	if modelName == "" || modelName == a.modelName {
+		return a.model, nil
+	}
+	cfg := &genai.ClientConfig{
+		APIKey:     a.apiKey,
+		HTTPClient: a.httpClient,
+	}
+	if a.baseURL != "" {
+		cfg.HTTPOptions.BaseURL = a.baseURL
+	}
+	m, err := gemini.NewModel(ctx, modelName, cfg)
+	if err != nil {
+		slog.Error("failed to create gemini model", "model", modelName, "err", err)
+		return nil, fmt.Errorf("failed to create model %q: %w", modelName, err)
+	}
+	return m, nil
+}
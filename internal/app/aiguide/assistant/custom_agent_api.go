@@ -0,0 +1,370 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCustomAgentNameLength        = 100
+	maxCustomAgentDescriptionLength = 500
+	maxCustomAgentInstructionLength = 20000
+	maxCustomAgentThinkingBudget    = 32768
+)
+
+type CustomAgentInfo struct {
+	ID             int       `json:"id"`
+	AgentID        string    `json:"agent_id"` // use in the /:agentId routes
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Instruction    string    `json:"instruction"`
+	ModelName      string    `json:"model_name"`
+	ThinkingBudget int32     `json:"thinking_budget"`
+	Tools          []string  `json:"tools"`
+	SubAgents      []string  `json:"sub_agents"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type CreateCustomAgentRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Description    string   `json:"description"`
+	Instruction    string   `json:"instruction" binding:"required"`
+	ModelName      string   `json:"model_name"`
+	ThinkingBudget int32    `json:"thinking_budget"`
+	Tools          []string `json:"tools"`
+	SubAgents      []string `json:"sub_agents"`
+}
+
+type UpdateCustomAgentRequest struct {
+	Name           *string   `json:"name"`
+	Description    *string   `json:"description"`
+	Instruction    *string   `json:"instruction"`
+	ModelName      *string   `json:"model_name"`
+	ThinkingBudget *int32    `json:"thinking_budget"`
+	Tools          *[]string `json:"tools"`
+	SubAgents      *[]string `json:"sub_agents"`
+}
+
+type CustomAgentOptionsResponse struct {
+	Tools     []string `json:"tools"`
+	SubAgents []string `json:"sub_agents"`
+}
+
+// GetCustomAgentOptions 返回自定义 Agent 可选的工具和子 Agent。
+func (a *Assistant) GetCustomAgentOptions(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, CustomAgentOptionsResponse{
+		Tools:     a.toolNames,
+		SubAgents: customAgentSubAgents,
+	})
+}
+
+// ListCustomAgents 返回当前用户的自定义 Agent 列表。
+func (a *Assistant) ListCustomAgents(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var agents []table.CustomAgent
+	if err := a.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&agents).Error; err != nil {
+		slog.Error("failed to query custom agents", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load custom agents"})
+		return
+	}
+
+	response := make([]CustomAgentInfo, 0, len(agents))
+	for _, row := range agents {
+		response = append(response, newCustomAgentInfo(row))
+	}
+	ctx.JSON(http.StatusOK, gin.H{"agents": response})
+}
+
+// GetCustomAgent 返回当前用户的一个自定义 Agent。
+func (a *Assistant) GetCustomAgent(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	row, ok := a.findCustomAgent(ctx, userID)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, newCustomAgentInfo(row))
+}
+
+// CreateCustomAgent 为当前用户创建自定义 Agent。
+func (a *Assistant) CreateCustomAgent(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateCustomAgentRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind request body", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	row := table.CustomAgent{
+		UserID:         userID,
+		Name:           strings.TrimSpace(req.Name),
+		Description:    strings.TrimSpace(req.Description),
+		Instruction:    strings.TrimSpace(req.Instruction),
+		ModelName:      strings.TrimSpace(req.ModelName),
+		ThinkingBudget: req.ThinkingBudget,
+	}
+	if err := a.setCustomAgentLists(&row, req.Tools, req.SubAgents); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCustomAgent(row); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if taken, err := a.customAgentNameTaken(row); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save custom agent"})
+		return
+	} else if taken {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "a custom agent with this name already exists"})
+		return
+	}
+
+	if err := a.db.Create(&row).Error; err != nil {
+		slog.Error("failed to create custom agent", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create custom agent"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newCustomAgentInfo(row))
+}
+
+// UpdateCustomAgent 更新当前用户的自定义 Agent，缓存的 runner 会在下次对话时重建。
+func (a *Assistant) UpdateCustomAgent(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req UpdateCustomAgentRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind request body", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	row, ok := a.findCustomAgent(ctx, userID)
+	if !ok {
+		return
+	}
+
+	if req.Name != nil {
+		row.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		row.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Instruction != nil {
+		row.Instruction = strings.TrimSpace(*req.Instruction)
+	}
+	if req.ModelName != nil {
+		row.ModelName = strings.TrimSpace(*req.ModelName)
+	}
+	if req.ThinkingBudget != nil {
+		row.ThinkingBudget = *req.ThinkingBudget
+	}
+	if req.Tools != nil || req.SubAgents != nil {
+		toolNames, _ := parseNameList(row.Tools)
+		subAgents, _ := parseNameList(row.SubAgents)
+		if req.Tools != nil {
+			toolNames = *req.Tools
+		}
+		if req.SubAgents != nil {
+			subAgents = *req.SubAgents
+		}
+		if err := a.setCustomAgentLists(&row, toolNames, subAgents); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := validateCustomAgent(row); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if taken, err := a.customAgentNameTaken(row); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save custom agent"})
+		return
+	} else if taken {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "a custom agent with this name already exists"})
+		return
+	}
+
+	if err := a.db.Save(&row).Error; err != nil {
+		slog.Error("failed to save custom agent", "err", err, "user_id", userID, "custom_agent_id", row.ID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update custom agent"})
+		return
+	}
+	a.evictCustomRunner(row.ID)
+
+	ctx.JSON(http.StatusOK, newCustomAgentInfo(row))
+}
+
+// DeleteCustomAgent 删除当前用户的自定义 Agent。
+func (a *Assistant) DeleteCustomAgent(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(ctx.Param("customAgentId"))
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid custom agent id"})
+		return
+	}
+
+	result := a.db.Where("id = ? AND user_id = ?", id, userID).Delete(&table.CustomAgent{})
+	if result.Error != nil {
+		slog.Error("failed to delete custom agent", "err", result.Error, "user_id", userID, "custom_agent_id", id)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete custom agent"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "custom agent not found"})
+		return
+	}
+	a.evictCustomRunner(id)
+
+	ctx.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// findCustomAgent loads the agent named by the customAgentId parameter and
+// writes the error response when it does not belong to the user.
+func (a *Assistant) findCustomAgent(ctx *gin.Context, userID int) (table.CustomAgent, bool) {
+	var row table.CustomAgent
+	id, err := strconv.Atoi(ctx.Param("customAgentId"))
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid custom agent id"})
+		return row, false
+	}
+
+	if err := a.db.Where("id = ? AND user_id = ?", id, userID).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "custom agent not found"})
+			return row, false
+		}
+		slog.Error("failed to find custom agent", "err", err, "user_id", userID, "custom_agent_id", id)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load custom agent"})
+		return row, false
+	}
+	return row, true
+}
+
+// setCustomAgentLists checks the whitelists against the available tools and
+// sub-agents and stores them on row.
+func (a *Assistant) setCustomAgentLists(row *table.CustomAgent, toolNames, subAgents []string) error {
+	for _, name := range toolNames {
+		if !slices.Contains(a.toolNames, name) {
+			return fmt.Errorf("unknown tool: %s", name)
+		}
+	}
+	for _, name := range subAgents {
+		if !slices.Contains(customAgentSubAgents, name) {
+			return fmt.Errorf("unknown sub-agent: %s", name)
+		}
+	}
+
+	row.Tools = ""
+	if len(toolNames) > 0 {
+		data, err := json.Marshal(toolNames)
+		if err != nil {
+			return err
+		}
+		row.Tools = string(data)
+	}
+	row.SubAgents = ""
+	if len(subAgents) > 0 {
+		data, err := json.Marshal(subAgents)
+		if err != nil {
+			return err
+		}
+		row.SubAgents = string(data)
+	}
+	return nil
+}
+
+// customAgentNameTaken reports whether another agent of the same user already
+// uses row's name.
+func (a *Assistant) customAgentNameTaken(row table.CustomAgent) (bool, error) {
+	var count int64
+	if err := a.db.Model(&table.CustomAgent{}).
+		Where("user_id = ? AND name = ? AND id <> ?", row.UserID, row.Name, row.ID).
+		Count(&count).Error; err != nil {
+		slog.Error("failed to check custom agent name", "err", err, "user_id", row.UserID)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func validateCustomAgent(row table.CustomAgent) error {
+	if row.Name == "" || len([]rune(row.Name)) > maxCustomAgentNameLength {
+		return errors.New("invalid custom agent name")
+	}
+	if len([]rune(row.Description)) > maxCustomAgentDescriptionLength {
+		return errors.New("description is too long")
+	}
+	if row.Instruction == "" || len([]rune(row.Instruction)) > maxCustomAgentInstructionLength {
+		return errors.New("invalid instruction")
+	}
+	if row.ThinkingBudget < 0 || row.ThinkingBudget > maxCustomAgentThinkingBudget {
+		return errors.New("invalid thinking budget")
+	}
+	return nil
+}
+
+func newCustomAgentInfo(row table.CustomAgent) CustomAgentInfo {
+	toolNames, err := parseNameList(row.Tools)
+	if err != nil {
+		slog.Warn("failed to parse custom agent tools", "custom_agent_id", row.ID, "err", err)
+	}
+	subAgents, err := parseNameList(row.SubAgents)
+	if err != nil {
+		slog.Warn("failed to parse custom agent sub-agents", "custom_agent_id", row.ID, "err", err)
+	}
+	if toolNames == nil {
+		toolNames = []string{}
+	}
+	if subAgents == nil {
+		subAgents = []string{}
+	}
+	return CustomAgentInfo{
+		ID:             row.ID,
+		AgentID:        customAgentID(row.ID),
+		Name:           row.Name,
+		Description:    row.Description,
+		Instruction:    row.Instruction,
+		ModelName:      row.ModelName,
+		ThinkingBudget: row.ThinkingBudget,
+		Tools:          toolNames,
+		SubAgents:      subAgents,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+	}
+}
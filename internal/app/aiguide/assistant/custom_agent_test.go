@@ -0,0 +1,103 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/session"
+)
+
+func TestNewCustomAgentUsesWhitelist(t *testing.T) {
+	customAgent, err := NewCustomAgent(&Config{
+		DB:                setupTestDB(t),
+		MockImageGen:      true,
+		MockEmailIMAPConn: true,
+		FileStore:         mustTestFileStore(t),
+		PDFWorkDir:        t.TempDir(),
+	}, CustomAgentDefinition{
+		Name:        "Researcher",
+		Instruction: "You research things.",
+		Tools:       []string{"current_time"},
+		SubAgents:   []string{"web_agent", "file_agent"},
+	})
+	if err != nil {
+		t.Fatalf("NewCustomAgent() error = %v", err)
+	}
+
+	var names []string
+	for _, sub := range customAgent.SubAgents() {
+		names = append(names, sub.Name())
+	}
+	if len(names) != 2 || names[0] != "web_agent" || names[1] != "file_agent" {
+		t.Fatalf("SubAgents() = %v, want [web_agent file_agent]", names)
+	}
+}
+
+func TestParseCustomAgentID(t *testing.T) {
+	tests := []struct {
+		agentID string
+		wantID  int
+		wantOK  bool
+	}{
+		{"custom-12", 12, true},
+		{"custom-0", 0, false},
+		{"custom-abc", 0, false},
+		{"assistant", 0, false},
+	}
+	for _, tt := range tests {
+		id, ok := parseCustomAgentID(tt.agentID)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("parseCustomAgentID(%q) = %d, %v, want %d, %v", tt.agentID, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestRunnerForAgentCachesCustomRunners(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.CustomAgent{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	row := table.CustomAgent{UserID: 1, Name: "Helper", Instruction: "Be helpful.", Tools: `["current_time"]`}
+	if err := db.Create(&row).Error; err != nil {
+		t.Fatalf("failed to create custom agent: %v", err)
+	}
+
+	a := &Assistant{
+		db:         db,
+		session:    session.InMemoryService(),
+		fileStore:  mustTestFileStore(t),
+		pdfWorkDir: t.TempDir(),
+	}
+	ctx := context.Background()
+	agentID := customAgentID(row.ID)
+
+	first, err := a.runnerForAgent(ctx, agentID, 1)
+	if err != nil {
+		t.Fatalf("runnerForAgent() error = %v", err)
+	}
+	second, err := a.runnerForAgent(ctx, agentID, 1)
+	if err != nil {
+		t.Fatalf("runnerForAgent() error = %v", err)
+	}
+	if first != second {
+		t.Fatal("runnerForAgent() rebuilt the runner of an unchanged agent")
+	}
+
+	a.evictCustomRunner(row.ID)
+	third, err := a.runnerForAgent(ctx, agentID, 1)
+	if err != nil {
+		t.Fatalf("runnerForAgent() error = %v", err)
+	}
+	if third == first {
+		t.Fatal("runnerForAgent() returned an evicted runner")
+	}
+
+	if _, err := a.runnerForAgent(ctx, agentID, 2); !errors.Is(err, errAgentNotFound) {
+		t.Fatalf("runnerForAgent() for another user error = %v, want errAgentNotFound", err)
+	}
+	if _, err := a.runnerForAgent(ctx, "unknown", 1); !errors.Is(err, errAgentNotFound) {
+		t.Fatalf("runnerForAgent() for unknown agent error = %v, want errAgentNotFound", err)
+	}
+}
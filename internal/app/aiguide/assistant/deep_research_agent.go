@@ -31,30 +31,13 @@ var reportWriterInstruction string
 // buildDeepResearchAgent creates a SequentialAgent that orchestrates deep research:
 //
 //	research_planner → parallel_research(breadth, depth, verify) → report_writer
-func buildDeepResearchAgent(researchTools []tool.Tool, m model.LLM, thinkingBudget int32) (agent.Agent, error) {
+//
+// How many researchers take part and how many searches, fetches and seconds
+// each may spend is decided per run by a ResearchProfile; defaultProfile is
+// used when the request does not name one.
+func buildDeepResearchAgent(researchTools []tool.Tool, m model.LLM, thinkingBudget int32, defaultProfile string) (agent.Agent, error) {
 	thinkingCfg := newThinkingConfig(thinkingBudget)
 
-	var plannerTools []tool.Tool
-	for _, t := range researchTools {
-		if t.Name() == "current_time" {
-			plannerTools = append(plannerTools, t)
-		}
-	}
-
-	planner, err := llmagent.New(llmagent.Config{
-		Name:        "research_planner",
-		Model:       m,
-		Description: "Breaks research questions into structured sub-topics and search strategies",
-		Instruction: researchPlannerInstruction,
-		GenerateContentConfig: &genai.GenerateContentConfig{
-			ThinkingConfig: thinkingCfg,
-		},
-		Tools: plannerTools,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create research_planner: %w", err)
-	}
-
 	type researcherDef struct {
 		name        string
 		description string
@@ -79,6 +62,34 @@ func buildDeepResearchAgent(researchTools []tool.Tool, m model.LLM, thinkingBudg
 		},
 	}
 
+	researcherNames := make([]string, 0, len(researchers))
+	for _, def := range researchers {
+		researcherNames = append(researcherNames, def.name)
+	}
+	budgets := newResearchBudgetTracker(defaultProfile, researcherNames)
+
+	var plannerTools []tool.Tool
+	for _, t := range researchTools {
+		if t.Name() == "current_time" {
+			plannerTools = append(plannerTools, t)
+		}
+	}
+
+	planner, err := llmagent.New(llmagent.Config{
+		Name:        "research_planner",
+		Model:       m,
+		Description: "Breaks research questions into structured sub-topics and search strategies",
+		Instruction: researchPlannerInstruction,
+		GenerateContentConfig: &genai.GenerateContentConfig{
+			ThinkingConfig: thinkingCfg,
+		},
+		Tools:                plannerTools,
+		BeforeAgentCallbacks: []agent.BeforeAgentCallback{budgets.startRun},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create research_planner: %w", err)
+	}
+
 	researcherAgents := make([]agent.Agent, 0, len(researchers))
 	for _, def := range researchers {
 		a, err := llmagent.New(llmagent.Config{
@@ -89,7 +100,9 @@ func buildDeepResearchAgent(researchTools []tool.Tool, m model.LLM, thinkingBudg
 			GenerateContentConfig: &genai.GenerateContentConfig{
 				ThinkingConfig: thinkingCfg,
 			},
-			Tools: researchTools,
+			Tools:                researchTools,
+			BeforeModelCallbacks: []llmagent.BeforeModelCallback{budgets.beforeResearcherModel},
+			BeforeToolCallbacks:  []llmagent.BeforeToolCallback{budgets.beforeResearcherTool},
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create %s: %w", def.name, err)
@@ -115,6 +128,8 @@ func buildDeepResearchAgent(researchTools []tool.Tool, m model.LLM, thinkingBudg
 		GenerateContentConfig: &genai.GenerateContentConfig{
 			ThinkingConfig: thinkingCfg,
 		},
+		BeforeAgentCallbacks: []agent.BeforeAgentCallback{budgets.startReport},
+		AfterAgentCallbacks:  []agent.AfterAgentCallback{budgets.finishRun},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create report_writer: %w", err)
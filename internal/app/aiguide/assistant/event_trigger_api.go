@@ -0,0 +1,490 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxTriggerCheckMinutes caps poll_interval_minutes at one day.
+const maxTriggerCheckMinutes = 24 * 60
+
+// EventTriggerInfo is the API response shape for a single event trigger.
+type EventTriggerInfo struct {
+	ID                  int                       `json:"id"`
+	Title               string                    `json:"title"`
+	Kind                constant.EventTriggerKind `json:"kind"`
+	Action              string                    `json:"action"`
+	URL                 string                    `json:"url,omitempty"`
+	EmailConfigName     string                    `json:"email_config_name,omitempty"`
+	Mailbox             string                    `json:"mailbox,omitempty"`
+	FromFilter          string                    `json:"from_filter,omitempty"`
+	SubjectFilter       string                    `json:"subject_filter,omitempty"`
+	PollIntervalMinutes int                       `json:"poll_interval_minutes"`
+	Enabled             bool                      `json:"enabled"`
+	LastCheckedAt       *time.Time                `json:"last_checked_at,omitempty"`
+	LastError           string                    `json:"last_error,omitempty"`
+	NextCheckAt         time.Time                 `json:"next_check_at"`
+	TokenPrefix         string                    `json:"token_prefix,omitempty"`
+	Token               string                    `json:"token,omitempty"` // Only set when a webhook token is created; it cannot be retrieved later
+	CreatedAt           time.Time                 `json:"created_at"`
+	UpdatedAt           time.Time                 `json:"updated_at"`
+}
+
+// ListEventTriggersResponse is the response for listing event triggers.
+type ListEventTriggersResponse struct {
+	Triggers []EventTriggerInfo `json:"triggers"`
+	Total    int64              `json:"total"`
+}
+
+// EventTriggerRunInfo is the API response shape for one run of an event
+// trigger. SessionID and AppName address the run's conversation in the
+// /:agentId/sessions routes.
+type EventTriggerRunInfo struct {
+	ID             int                         `json:"id"`
+	EventTriggerID int                         `json:"event_trigger_id"`
+	EventKey       string                      `json:"event_key"`
+	EventSummary   string                      `json:"event_summary"`
+	Status         constant.ScheduledRunStatus `json:"status"`
+	StartedAt      time.Time                   `json:"started_at"`
+	FinishedAt     *time.Time                  `json:"finished_at,omitempty"`
+	Error          string                      `json:"error,omitempty"`
+	Output         string                      `json:"output"`
+	ToolCalls      []ScheduledRunToolCall      `json:"tool_calls"`
+	SessionID      string                      `json:"session_id"`
+	AppName        string                      `json:"app_name"`
+}
+
+// ListEventTriggerRunsResponse is the response for listing trigger runs.
+type ListEventTriggerRunsResponse struct {
+	Runs  []EventTriggerRunInfo `json:"runs"`
+	Total int64                 `json:"total"`
+}
+
+// CreateEventTriggerRequest creates an event trigger. URL is required for
+// web_page and feed triggers; the email fields only apply to email triggers.
+// For webhook triggers Action is a text/template rendered with the JSON
+// payload of each call.
+type CreateEventTriggerRequest struct {
+	Title               string                    `json:"title"`
+	Kind                constant.EventTriggerKind `json:"kind"`
+	Action              string                    `json:"action"`
+	URL                 string                    `json:"url"`
+	EmailConfigName     string                    `json:"email_config_name"`
+	Mailbox             string                    `json:"mailbox"`
+	FromFilter          string                    `json:"from_filter"`
+	SubjectFilter       string                    `json:"subject_filter"`
+	PollIntervalMinutes int                       `json:"poll_interval_minutes"`
+}
+
+// UpdateEventTriggerRequest supports toggling enabled status and changing
+// the action, the source and the poll interval. Omitted fields keep their
+// current values.
+type UpdateEventTriggerRequest struct {
+	Enabled             *bool   `json:"enabled"`
+	Title               *string `json:"title"`
+	Action              *string `json:"action"`
+	URL                 *string `json:"url"`
+	EmailConfigName     *string `json:"email_config_name"`
+	Mailbox             *string `json:"mailbox"`
+	FromFilter          *string `json:"from_filter"`
+	SubjectFilter       *string `json:"subject_filter"`
+	PollIntervalMinutes *int    `json:"poll_interval_minutes"`
+}
+
+// hasSourceChanges reports whether the request touches any field that
+// selects the watched source, which invalidates the dedup state.
+func (r UpdateEventTriggerRequest) hasSourceChanges() bool {
+	return r.URL != nil || r.EmailConfigName != nil || r.Mailbox != nil || r.FromFilter != nil || r.SubjectFilter != nil
+}
+
+// ListEventTriggers returns all event triggers for the current user.
+func (a *Assistant) ListEventTriggers(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var triggers []table.EventTrigger
+	if err := a.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&triggers).Error; err != nil {
+		slog.Error("failed to query event triggers", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load event triggers"})
+		return
+	}
+
+	response := make([]EventTriggerInfo, 0, len(triggers))
+	for _, trigger := range triggers {
+		response = append(response, newEventTriggerInfo(trigger))
+	}
+	ctx.JSON(http.StatusOK, ListEventTriggersResponse{Triggers: response, Total: int64(len(triggers))})
+}
+
+// CreateEventTrigger creates an enabled event trigger. Its first check only
+// records the current state of the source, so existing mail, page content
+// and feed items do not fire. Webhook triggers get a secret token that is
+// returned once in the response.
+func (a *Assistant) CreateEventTrigger(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CreateEventTriggerRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind request body", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	trigger := table.EventTrigger{
+		UserID:              userID,
+		Title:               req.Title,
+		Kind:                req.Kind,
+		Action:              req.Action,
+		URL:                 req.URL,
+		EmailConfigName:     req.EmailConfigName,
+		Mailbox:             req.Mailbox,
+		FromFilter:          req.FromFilter,
+		SubjectFilter:       req.SubjectFilter,
+		PollIntervalMinutes: req.PollIntervalMinutes,
+		Enabled:             true,
+		NextCheckAt:         time.Now(),
+	}
+	if err := normalizeEventTrigger(&trigger); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var token string
+	if trigger.Kind == constant.EventTriggerKindWebhook {
+		var err error
+		if token, err = setWebhookToken(&trigger); err != nil {
+			slog.Error("failed to generate webhook token", "err", err, "user_id", userID)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create event trigger"})
+			return
+		}
+	}
+	if err := a.db.Create(&trigger).Error; err != nil {
+		slog.Error("failed to create event trigger", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create event trigger"})
+		return
+	}
+
+	info := newEventTriggerInfo(trigger)
+	info.Token = token
+	ctx.JSON(http.StatusCreated, info)
+}
+
+// UpdateEventTrigger updates an event trigger. Changing the source resets
+// its dedup state and schedules a new baseline check.
+func (a *Assistant) UpdateEventTrigger(ctx *gin.Context) {
+	userID, triggerID, ok := parseEventTriggerID(ctx)
+	if !ok {
+		return
+	}
+
+	var req UpdateEventTriggerRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind request body", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Enabled == nil && req.Title == nil && req.Action == nil && req.PollIntervalMinutes == nil && !req.hasSourceChanges() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+		return
+	}
+
+	var trigger table.EventTrigger
+	if err := a.db.Where("id = ? AND user_id = ?", triggerID, userID).First(&trigger).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "event trigger not found"})
+			return
+		}
+		slog.Error("failed to find event trigger", "err", err, "user_id", userID, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load event trigger"})
+		return
+	}
+
+	before := trigger
+	if req.Title != nil {
+		trigger.Title = *req.Title
+	}
+	if req.Action != nil {
+		trigger.Action = *req.Action
+	}
+	if req.URL != nil {
+		trigger.URL = *req.URL
+	}
+	if req.EmailConfigName != nil {
+		trigger.EmailConfigName = *req.EmailConfigName
+	}
+	if req.Mailbox != nil {
+		trigger.Mailbox = *req.Mailbox
+	}
+	if req.FromFilter != nil {
+		trigger.FromFilter = *req.FromFilter
+	}
+	if req.SubjectFilter != nil {
+		trigger.SubjectFilter = *req.SubjectFilter
+	}
+	if req.PollIntervalMinutes != nil {
+		trigger.PollIntervalMinutes = *req.PollIntervalMinutes
+	}
+	if err := normalizeEventTrigger(&trigger); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sourceChanged := trigger.URL != before.URL || trigger.EmailConfigName != before.EmailConfigName ||
+		trigger.Mailbox != before.Mailbox || trigger.FromFilter != before.FromFilter || trigger.SubjectFilter != before.SubjectFilter
+	if sourceChanged {
+		trigger.State = ""
+		trigger.LastError = ""
+		trigger.NextCheckAt = time.Now()
+	}
+	if req.Enabled != nil {
+		if *req.Enabled && !trigger.Enabled {
+			// The source may have changed while the trigger was off; take a
+			// new baseline instead of firing for everything that happened.
+			trigger.State = ""
+			trigger.NextCheckAt = time.Now()
+		}
+		trigger.Enabled = *req.Enabled
+	}
+	if err := a.db.Save(&trigger).Error; err != nil {
+		slog.Error("failed to save event trigger", "err", err, "user_id", userID, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update event trigger"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newEventTriggerInfo(trigger))
+}
+
+// DeleteEventTrigger deletes an event trigger and its run history.
+func (a *Assistant) DeleteEventTrigger(ctx *gin.Context) {
+	userID, triggerID, ok := parseEventTriggerID(ctx)
+	if !ok {
+		return
+	}
+
+	var rowsAffected int64
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", triggerID, userID).Delete(&table.EventTrigger{})
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		if rowsAffected == 0 {
+			return nil
+		}
+		return tx.Where("event_trigger_id = ?", triggerID).Delete(&table.EventTriggerRun{}).Error
+	})
+	if err != nil {
+		slog.Error("failed to delete event trigger", "err", err, "user_id", userID, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete event trigger"})
+		return
+	}
+	if rowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "event trigger not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"id": triggerID})
+}
+
+// RotateWebhookToken replaces the secret token of a webhook trigger. The
+// old token stops working immediately; the new one is returned once.
+func (a *Assistant) RotateWebhookToken(ctx *gin.Context) {
+	userID, triggerID, ok := parseEventTriggerID(ctx)
+	if !ok {
+		return
+	}
+
+	var trigger table.EventTrigger
+	if err := a.db.Where("id = ? AND user_id = ? AND kind = ?", triggerID, userID, constant.EventTriggerKindWebhook).
+		First(&trigger).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "webhook trigger not found"})
+			return
+		}
+		slog.Error("failed to find event trigger", "err", err, "user_id", userID, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load event trigger"})
+		return
+	}
+
+	token, err := setWebhookToken(&trigger)
+	if err != nil {
+		slog.Error("failed to generate webhook token", "err", err, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate webhook token"})
+		return
+	}
+	if err := a.db.Model(&trigger).Updates(map[string]any{"token_hash": trigger.TokenHash, "token_prefix": trigger.TokenPrefix}).Error; err != nil {
+		slog.Error("failed to save webhook token", "err", err, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rotate webhook token"})
+		return
+	}
+
+	info := newEventTriggerInfo(trigger)
+	info.Token = token
+	ctx.JSON(http.StatusOK, info)
+}
+
+// ListEventTriggerRuns returns the run history of an event trigger, newest
+// first. Supports limit and offset query parameters.
+func (a *Assistant) ListEventTriggerRuns(ctx *gin.Context) {
+	userID, triggerID, ok := parseEventTriggerID(ctx)
+	if !ok {
+		return
+	}
+
+	var count int64
+	if err := a.db.Model(&table.EventTrigger{}).Where("id = ? AND user_id = ?", triggerID, userID).Count(&count).Error; err != nil {
+		slog.Error("failed to find event trigger", "err", err, "user_id", userID, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load event trigger"})
+		return
+	}
+	if count == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "event trigger not found"})
+		return
+	}
+
+	limit, offset := parsePagination(ctx)
+	query := a.db.Model(&table.EventTriggerRun{}).Where("event_trigger_id = ? AND user_id = ?", triggerID, userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.Error("failed to count event trigger runs", "err", err, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load event trigger runs"})
+		return
+	}
+	var runs []table.EventTriggerRun
+	if err := query.Order("started_at DESC, id DESC").Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		slog.Error("failed to query event trigger runs", "err", err, "trigger_id", triggerID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load event trigger runs"})
+		return
+	}
+
+	response := make([]EventTriggerRunInfo, 0, len(runs))
+	for _, run := range runs {
+		response = append(response, newEventTriggerRunInfo(run))
+	}
+	ctx.JSON(http.StatusOK, ListEventTriggerRunsResponse{Runs: response, Total: total})
+}
+
+// parseEventTriggerID returns the current user and the :triggerId parameter,
+// writing the error response when either is missing.
+func parseEventTriggerID(ctx *gin.Context) (int, int, bool) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, 0, false
+	}
+
+	triggerID, err := strconv.Atoi(ctx.Param("triggerId"))
+	if err != nil || triggerID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid trigger id"})
+		return 0, 0, false
+	}
+	return userID, triggerID, true
+}
+
+// normalizeEventTrigger trims and validates the user-editable fields of
+// trigger and clears the fields its kind does not use.
+func normalizeEventTrigger(trigger *table.EventTrigger) error {
+	trigger.Title = strings.TrimSpace(trigger.Title)
+	trigger.Action = strings.TrimSpace(trigger.Action)
+	trigger.URL = strings.TrimSpace(trigger.URL)
+	if trigger.Title == "" {
+		return errors.New("title is required")
+	}
+	if trigger.Action == "" {
+		return errors.New("action is required")
+	}
+
+	interval := cmp.Or(trigger.PollIntervalMinutes, defaultTriggerCheckMinutes)
+	if interval < minTriggerCheckMinutes || interval > maxTriggerCheckMinutes {
+		return fmt.Errorf("poll_interval_minutes must be between %d and %d", minTriggerCheckMinutes, maxTriggerCheckMinutes)
+	}
+	trigger.PollIntervalMinutes = interval
+
+	switch trigger.Kind {
+	case constant.EventTriggerKindEmail:
+		trigger.URL = ""
+		trigger.EmailConfigName = strings.TrimSpace(trigger.EmailConfigName)
+		trigger.Mailbox = strings.TrimSpace(trigger.Mailbox)
+		trigger.FromFilter = strings.TrimSpace(trigger.FromFilter)
+		trigger.SubjectFilter = strings.TrimSpace(trigger.SubjectFilter)
+	case constant.EventTriggerKindWebPage, constant.EventTriggerKindFeed:
+		target, err := url.Parse(trigger.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return errors.New("invalid url, expected an http or https url")
+		}
+		trigger.EmailConfigName, trigger.Mailbox, trigger.FromFilter, trigger.SubjectFilter = "", "", "", ""
+	case constant.EventTriggerKindWebhook:
+		if _, err := parseWebhookTemplate(trigger.Action); err != nil {
+			return fmt.Errorf("invalid action template: %w", err)
+		}
+		trigger.URL, trigger.EmailConfigName, trigger.Mailbox, trigger.FromFilter, trigger.SubjectFilter = "", "", "", "", ""
+	default:
+		return fmt.Errorf("invalid trigger kind: %s, expected email, web_page, feed or webhook", trigger.Kind)
+	}
+	return nil
+}
+
+func newEventTriggerRunInfo(run table.EventTriggerRun) EventTriggerRunInfo {
+	toolCalls := []ScheduledRunToolCall{}
+	if run.ToolCalls != "" {
+		if err := json.Unmarshal([]byte(run.ToolCalls), &toolCalls); err != nil {
+			slog.Warn("failed to decode event trigger run tool calls", "err", err, "run_id", run.ID)
+		}
+	}
+	return EventTriggerRunInfo{
+		ID:             run.ID,
+		EventTriggerID: run.EventTriggerID,
+		EventKey:       run.EventKey,
+		EventSummary:   run.EventSummary,
+		Status:         run.Status,
+		StartedAt:      run.StartedAt,
+		FinishedAt:     run.FinishedAt,
+		Error:          run.Error,
+		Output:         run.Output,
+		ToolCalls:      toolCalls,
+		SessionID:      run.SessionID,
+		AppName:        constant.AppNameScheduler.String(),
+	}
+}
+
+func newEventTriggerInfo(trigger table.EventTrigger) EventTriggerInfo {
+	return EventTriggerInfo{
+		ID:                  trigger.ID,
+		Title:               trigger.Title,
+		Kind:                trigger.Kind,
+		Action:              trigger.Action,
+		URL:                 trigger.URL,
+		EmailConfigName:     trigger.EmailConfigName,
+		Mailbox:             trigger.Mailbox,
+		FromFilter:          trigger.FromFilter,
+		SubjectFilter:       trigger.SubjectFilter,
+		PollIntervalMinutes: cmp.Or(trigger.PollIntervalMinutes, defaultTriggerCheckMinutes),
+		Enabled:             trigger.Enabled,
+		LastCheckedAt:       trigger.LastCheckedAt,
+		LastError:           trigger.LastError,
+		NextCheckAt:         trigger.NextCheckAt,
+		TokenPrefix:         trigger.TokenPrefix,
+		CreatedAt:           trigger.CreatedAt,
+		UpdatedAt:           trigger.UpdatedAt,
+	}
+}
@@ -0,0 +1,122 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventTriggerAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := &Assistant{db: setupSchedulerTestDB(t)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/triggers", assistant.ListEventTriggers)
+		router.POST("/api/assistant/triggers", assistant.CreateEventTrigger)
+		router.GET("/api/assistant/triggers/:triggerId/runs", assistant.ListEventTriggerRuns)
+		router.PATCH("/api/assistant/triggers/:triggerId", assistant.UpdateEventTrigger)
+		router.DELETE("/api/assistant/triggers/:triggerId", assistant.DeleteEventTrigger)
+	})
+
+	for _, body := range []map[string]any{
+		{"title": "t", "kind": "sms", "action": "a"},
+		{"title": "t", "kind": "feed", "action": "a", "url": "ftp://example.com/feed"},
+		{"title": "t", "kind": "web_page", "action": ""},
+		{"title": "t", "kind": "email", "action": "a", "poll_interval_minutes": 1},
+	} {
+		if resp := doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/triggers", body); resp.Code != http.StatusBadRequest {
+			t.Fatalf("create %v status = %d, want 400", body, resp.Code)
+		}
+	}
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/triggers", map[string]any{
+		"title": "invoices", "kind": "email", "action": "file the invoice",
+		"subject_filter": " invoice ", "url": "https://ignored.example.com",
+	})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	var created EventTriggerInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !created.Enabled || created.SubjectFilter != "invoice" || created.URL != "" || created.PollIntervalMinutes != defaultTriggerCheckMinutes {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// Give the trigger a baseline, then change its source: the state must be
+	// reset so the next check takes a new baseline.
+	if err := assistant.db.Model(&table.EventTrigger{}).Where("id = ?", created.ID).
+		Updates(map[string]any{"state": `{"uid_validity":1,"last_uid":9}`, "next_check_at": time.Now().Add(time.Hour)}).Error; err != nil {
+		t.Fatalf("db.Updates() error: %v", err)
+	}
+	path := fmt.Sprintf("/api/assistant/triggers/%d", created.ID)
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"from_filter": "billing@example.com"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	var saved table.EventTrigger
+	if err := assistant.db.First(&saved, created.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if saved.State != "" || saved.FromFilter != "billing@example.com" || saved.NextCheckAt.After(time.Now()) {
+		t.Fatalf("trigger after source change = %+v", saved)
+	}
+
+	if resp := doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("empty update status = %d, want 400", resp.Code)
+	}
+
+	run := table.EventTriggerRun{
+		EventTriggerID: created.ID, UserID: 1, SessionID: "trigger-1-1", EventKey: "uid:1:10",
+		Status: constant.ScheduledRunStatusSucceeded, StartedAt: time.Now(), ToolCalls: `[{"name":"email_query"}]`,
+	}
+	if err := assistant.db.Create(&run).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodGet, path+"/runs", nil)
+	var runs ListEventTriggerRunsResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &runs); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if runs.Total != 1 || runs.Runs[0].EventKey != "uid:1:10" || len(runs.Runs[0].ToolCalls) != 1 ||
+		runs.Runs[0].AppName != constant.AppNameScheduler.String() {
+		t.Fatalf("runs = %+v", runs)
+	}
+
+	other := table.EventTrigger{UserID: 2, Title: "theirs", Kind: constant.EventTriggerKindFeed, Action: "a", URL: "https://example.com/feed", NextCheckAt: time.Now()}
+	if err := assistant.db.Create(&other).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/triggers", nil)
+	var list ListEventTriggersResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if list.Total != 1 || list.Triggers[0].ID != created.ID {
+		t.Fatalf("list = %+v, want only the own trigger", list)
+	}
+	otherPath := fmt.Sprintf("/api/assistant/triggers/%d", other.ID)
+	if resp := doSessionTaskRequest(t, router, http.MethodGet, otherPath+"/runs", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("runs of other user's trigger status = %d, want 404", resp.Code)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodDelete, otherPath, nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("delete other user's trigger status = %d, want 404", resp.Code)
+	}
+
+	if resp := doSessionTaskRequest(t, router, http.MethodDelete, path, nil); resp.Code != http.StatusOK {
+		t.Fatalf("delete status = %d", resp.Code)
+	}
+	var count int64
+	if err := assistant.db.Model(&table.EventTriggerRun{}).Where("event_trigger_id = ?", created.ID).Count(&count).Error; err != nil {
+		t.Fatalf("db.Count() error: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("%d runs left after delete, want 0", count)
+	}
+}
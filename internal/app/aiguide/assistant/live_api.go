@@ -74,7 +74,7 @@ func (a *Assistant) VoiceCall(ctx *gin.Context) {
 	slog.Info("VoiceCall: WebSocket connected", "userID", userID, "sessionID", sessionID)
 
 	userIDStr := strconv.Itoa(userID)
-	if _, err := a.ensureSession(ctx, userIDStr, sessionID); err != nil {
+	if _, err := a.ensureSession(ctx, constant.AppNameAssistant.String(), userIDStr, sessionID); err != nil {
 		slog.Error("VoiceCall: ensureSession failed", "err", err)
 		writeWSError(conn, "failed to ensure session: "+err.Error())
 		return
@@ -756,7 +756,7 @@ func (a *Assistant) buildHistoryContext(ctx context.Context, userIDStr, sessionI
 			if _, transcript, ok := extractVoiceAudioMetadata(text); ok {
 				text = transcript
 			}
-			text = stripUserContext(strings.TrimSpace(text))
+			text = stripInjectedContext(strings.TrimSpace(text))
 			if text != "" {
 				textParts = append(textParts, text)
 			}
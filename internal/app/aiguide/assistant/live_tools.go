@@ -1,8 +1,10 @@
 package assistant
 
 import (
+	"aiguide/internal/pkg/tools"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -65,8 +67,15 @@ func executeLiveTool(ctx context.Context, registry liveToolRegistry, call *genai
 		}
 	}
 
+	toolCtx := &liveToolContext{Context: ctx, functionCallID: call.ID}
+	// A voice call cannot show a confirmation prompt, so calls the user wants
+	// confirmed are refused like in the chat bots.
+	if rejected, _ := tools.RejectUnconfirmedToolCall(toolCtx, rt, call.Args); rejected != nil {
+		return &genai.FunctionResponse{ID: call.ID, Name: call.Name, Response: rejected}
+	}
+
 	slog.Info("executeLiveTool", "tool", call.Name)
-	result, err := rt.Run(&liveToolContext{Context: ctx}, call.Args)
+	result, err := rt.Run(toolCtx, call.Args)
 	if err != nil {
 		slog.Error("executeLiveTool: failed", "tool", call.Name, "err", err)
 		return &genai.FunctionResponse{
@@ -95,9 +104,11 @@ func executeLiveTool(ctx context.Context, registry liveToolRegistry, call *genai
 
 // liveToolContext is a minimal tool.Context for executing tools outside the ADK agent framework.
 // Our tools only read context values (user ID, session ID) via context.Context — all ADK-specific
-// methods are stubbed with safe zero values.
+// methods are stubbed with safe zero values. Confirmations cannot be requested;
+// executeLiveTool refuses the calls that would need one.
 type liveToolContext struct {
 	context.Context
+	functionCallID string
 }
 
 func (c *liveToolContext) UserContent() *genai.Content          { return nil }
@@ -110,13 +121,15 @@ func (c *liveToolContext) SessionID() string                    { return "" }
 func (c *liveToolContext) Branch() string                       { return "" }
 func (c *liveToolContext) Artifacts() agent.Artifacts           { return nil }
 func (c *liveToolContext) State() session.State                 { return nil }
-func (c *liveToolContext) FunctionCallID() string               { return "" }
+func (c *liveToolContext) FunctionCallID() string               { return c.functionCallID }
 func (c *liveToolContext) Actions() *session.EventActions       { return &session.EventActions{} }
 func (c *liveToolContext) SearchMemory(_ context.Context, _ string) (*memory.SearchResponse, error) {
 	return nil, nil
 }
 func (c *liveToolContext) ToolConfirmation() *toolconfirmation.ToolConfirmation { return nil }
-func (c *liveToolContext) RequestConfirmation(_ string, _ any) error            { return nil }
+func (c *liveToolContext) RequestConfirmation(_ string, _ any) error {
+	return errors.New("tool confirmation is not available in voice calls")
+}
 
 func summarizeToolResponse(ctx context.Context, client *genai.Client, modelName, toolName string, data []byte) (map[string]any, error) {
 	if client == nil || modelName == "" {
@@ -0,0 +1,37 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"context"
+	"testing"
+
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+)
+
+func TestExecuteLiveTool_RejectsToolsNeedingConfirmation(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	var sentTo []string
+	registry := buildLiveToolRegistry([]tool.Tool{newFakeSendEmailTool(t, &sentTo)})
+	ctx := context.WithValue(context.Background(), constant.ContextKeyUserID, 1)
+	ctx = context.WithValue(ctx, constant.ContextKeyTx, db)
+	call := &genai.FunctionCall{ID: "call-1", Name: "send_email", Args: map[string]any{"to": "bob@example.com"}}
+
+	resp := executeLiveTool(ctx, registry, call, nil, "")
+	if len(sentTo) != 0 || resp.Response["success"] != false {
+		t.Fatalf("sent to %v, response %v; want the voice send_email call refused", sentTo, resp.Response)
+	}
+
+	// A user who turned confirmation off can send during a voice call.
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 1, ToolName: "send_email", Required: false}).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+	resp = executeLiveTool(ctx, registry, call, nil, "")
+	if len(sentTo) != 1 || resp.Response["success"] != true {
+		t.Fatalf("sent to %v, response %v; want bob once confirmation is off", sentTo, resp.Response)
+	}
+}
@@ -0,0 +1,139 @@
+package assistant
+
+import (
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/adk/tool"
+	"gorm.io/gorm"
+)
+
+// mcpServedTools are the user-scoped tools exposed to external MCP clients.
+// Tools that depend on an agent session (tasks, media generation) are not
+// served. Calls of confirmable tools only run when the user turned their
+// confirmation off.
+var mcpServedTools = map[string]bool{
+	"manage_memory":         true,
+	"file_list":             true,
+	"file_get":              true,
+	"file_download":         true,
+	"pdf_extract_text":      true,
+	"scheduled_task_create": true,
+	"scheduled_task_list":   true,
+	"ssh_list_servers":      true,
+	"ssh_execute":           true,
+	"query_emails":          true,
+	"send_email":            true,
+}
+
+// mcpSessionPrefix prefixes the session ID recorded on files created over MCP.
+const mcpSessionPrefix = "mcp-"
+
+// newMCPServer builds an MCP server that serves the allowed tools from
+// allTools. Each call runs with the authenticated user's ID and the DB in its
+// context, like requests that pass middleware.Auth.
+func newMCPServer(allTools []tool.Tool, db *gorm.DB) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "aiguide", Version: "1.0.0"}, nil)
+	for _, t := range allTools {
+		if !mcpServedTools[t.Name()] {
+			continue
+		}
+		rt, ok := t.(localRunnableTool)
+		if !ok {
+			continue
+		}
+		decl := rt.Declaration()
+		mcpTool := &mcp.Tool{
+			Name:        decl.Name,
+			Description: decl.Description,
+			InputSchema: mcpInputSchema(decl.ParametersJsonSchema),
+		}
+		if tools.IsConfirmableTool(t.Name()) {
+			destructive := true
+			mcpTool.Annotations = &mcp.ToolAnnotations{DestructiveHint: &destructive}
+		}
+		server.AddTool(mcpTool, mcpToolHandler(rt, db))
+	}
+	return server
+}
+
+// mcpInputSchema returns schema if it is a JSON object schema, and an empty
+// object schema otherwise, since MCP requires tool inputs to be objects.
+func mcpInputSchema(schema any) any {
+	var m map[string]any
+	if schema != nil {
+		if data, err := json.Marshal(schema); err == nil && json.Unmarshal(data, &m) == nil && m["type"] == "object" {
+			return m
+		}
+	}
+	return map[string]any{"type": "object"}
+}
+
+func mcpToolHandler(rt localRunnableTool, db *gorm.DB) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if req.Extra == nil || req.Extra.TokenInfo == nil {
+			return nil, fmt.Errorf("unauthenticated mcp request")
+		}
+		userID, err := strconv.Atoi(req.Extra.TokenInfo.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id in token: %w", err)
+		}
+
+		args := map[string]any{}
+		if len(req.Params.Arguments) > 0 {
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
+				return mcpErrorResult(fmt.Errorf("invalid arguments: %w", err)), nil
+			}
+		}
+
+		toolCtx := context.WithValue(ctx, constant.ContextKeyUserID, userID)
+		toolCtx = context.WithValue(toolCtx, constant.ContextKeySessionID, mcpSessionPrefix+req.Session.ID())
+		toolCtx = context.WithValue(toolCtx, constant.ContextKeyTx, db)
+
+		runCtx := &liveToolContext{Context: toolCtx}
+		// MCP clients cannot answer a confirmation prompt, so calls the user
+		// wants confirmed are refused like in the chat bots and /v1.
+		if rejected, _ := tools.RejectUnconfirmedToolCall(runCtx, rt, args); rejected != nil {
+			return mcpErrorResult(fmt.Errorf("%v", rejected["error"])), nil
+		}
+
+		slog.Info("executing mcp tool call", "tool", rt.Name(), "user_id", userID)
+		result, err := rt.Run(runCtx, args)
+		if err != nil {
+			slog.Error("mcp tool call failed", "tool", rt.Name(), "user_id", userID, "err", err)
+			return mcpErrorResult(err), nil
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return mcpErrorResult(fmt.Errorf("failed to encode result: %w", err)), nil
+		}
+		return &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: string(data)}},
+			StructuredContent: result,
+		}, nil
+	}
+}
+
+func mcpErrorResult(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		IsError: true,
+	}
+}
+
+// MCPHandler serves the assistant's tools over streamable HTTP. The caller
+// must authenticate requests, e.g. with auth.RequireBearerToken, so that
+// each call carries the user's token info.
+func (a *Assistant) MCPHandler() http.Handler {
+	return mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return a.mcpServer
+	}, nil)
+}
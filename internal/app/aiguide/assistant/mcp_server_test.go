@@ -0,0 +1,139 @@
+package assistant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/adk/tool"
+)
+
+// bearerRoundTripper adds a fixed bearer token to every request.
+type bearerRoundTripper struct {
+	token string
+}
+
+func (b bearerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// connectTestMCPClient serves server behind a bearer token check and returns
+// a client session authenticated as user 7.
+func connectTestMCPClient(t *testing.T, server *mcp.Server) *mcp.ClientSession {
+	t.Helper()
+	a := &Assistant{mcpServer: server}
+	verifier := func(_ context.Context, token string, _ *http.Request) (*mcpauth.TokenInfo, error) {
+		if token != "user-7" {
+			return nil, mcpauth.ErrInvalidToken
+		}
+		return &mcpauth.TokenInfo{UserID: "7", Expiration: time.Now().Add(time.Hour)}, nil
+	}
+	srv := httptest.NewServer(mcpauth.RequireBearerToken(verifier, nil)(a.MCPHandler()))
+	t.Cleanup(srv.Close)
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{
+		Endpoint:   srv.URL,
+		HTTPClient: &http.Client{Transport: bearerRoundTripper{token: "user-7"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+func TestMCPServerServesUserScopedTools(t *testing.T) {
+	db := setupTestDB(t)
+	memoryTool, err := tools.NewMemoryTool(db)
+	if err != nil {
+		t.Fatalf("NewMemoryTool() error = %v", err)
+	}
+	currentTimeTool, err := tools.NewCurrentTimeTool()
+	if err != nil {
+		t.Fatalf("NewCurrentTimeTool() error = %v", err)
+	}
+	if err := db.Create(&table.UserMemory{UserID: 7, MemoryType: constant.MemoryTypeFact, Content: "likes Go", Importance: 5}).Error; err != nil {
+		t.Fatalf("failed to create memory: %v", err)
+	}
+
+	session := connectTestMCPClient(t, newMCPServer([]tool.Tool{memoryTool, currentTimeTool}, db))
+
+	listed, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	if len(listed.Tools) != 1 || listed.Tools[0].Name != "manage_memory" {
+		t.Fatalf("ListTools() = %+v, want only manage_memory", listed.Tools)
+	}
+
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "manage_memory",
+		Arguments: map[string]any{"action": "retrieve"},
+	})
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("CallTool() returned error result: %+v", res.Content)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if !strings.Contains(text, "likes Go") {
+		t.Fatalf("CallTool() = %s, want the user's memory", text)
+	}
+}
+
+func TestMCPServerRejectsToolsNeedingConfirmation(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	var sentTo []string
+	session := connectTestMCPClient(t, newMCPServer([]tool.Tool{newFakeSendEmailTool(t, &sentTo)}, db))
+	call := &mcp.CallToolParams{Name: "send_email", Arguments: map[string]any{"to": "bob@example.com"}}
+
+	res, err := session.CallTool(context.Background(), call)
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if !res.IsError || len(sentTo) != 0 || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "requires confirmation") {
+		t.Fatalf("CallTool() = %+v, sent to %v; want send_email refused", res.Content, sentTo)
+	}
+
+	// A user who turned confirmation off can send over MCP.
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 7, ToolName: "send_email", Required: false}).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+	if res, err := session.CallTool(context.Background(), call); err != nil || res.IsError || len(sentTo) != 1 {
+		t.Fatalf("CallTool() = %+v, %v, sent to %v; want bob once confirmation is off", res, err, sentTo)
+	}
+}
+
+func TestMCPEndpointRejectsMissingToken(t *testing.T) {
+	a := &Assistant{mcpServer: newMCPServer(nil, nil)}
+	verifier := func(context.Context, string, *http.Request) (*mcpauth.TokenInfo, error) {
+		return nil, mcpauth.ErrInvalidToken
+	}
+	srv := httptest.NewServer(mcpauth.RequireBearerToken(verifier, nil)(a.MCPHandler()))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+}
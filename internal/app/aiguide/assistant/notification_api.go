@@ -0,0 +1,206 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/notification"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// notificationHeartbeatInterval keeps idle notification streams open
+// through proxies.
+const notificationHeartbeatInterval = 30 * time.Second
+
+// NotificationInfo is the API response shape for a single notification.
+type NotificationInfo struct {
+	ID        int                       `json:"id"`
+	Kind      constant.NotificationKind `json:"kind"`
+	Title     string                    `json:"title"`
+	Body      string                    `json:"body"`
+	Link      string                    `json:"link,omitempty"`
+	ReadAt    *time.Time                `json:"read_at,omitempty"`
+	CreatedAt time.Time                 `json:"created_at"`
+}
+
+// ListNotificationsResponse is the response for listing notifications.
+type ListNotificationsResponse struct {
+	Notifications []NotificationInfo `json:"notifications"`
+	Total         int64              `json:"total"`
+	UnreadCount   int64              `json:"unread_count"`
+}
+
+// ListNotifications returns the current user's notifications, newest first.
+// With unread=true only unread notifications are returned.
+func (a *Assistant) ListNotifications(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	unreadCount, err := a.countUnreadNotifications(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notifications"})
+		return
+	}
+
+	limit, offset := parsePagination(ctx)
+	query := a.db.Model(&table.Notification{}).Where("user_id = ?", userID)
+	if unread, _ := strconv.ParseBool(ctx.Query("unread")); unread {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.Error("failed to count notifications", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notifications"})
+		return
+	}
+	var notifications []table.Notification
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&notifications).Error; err != nil {
+		slog.Error("failed to query notifications", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notifications"})
+		return
+	}
+
+	response := make([]NotificationInfo, 0, len(notifications))
+	for _, n := range notifications {
+		response = append(response, newNotificationInfo(n))
+	}
+	ctx.JSON(http.StatusOK, ListNotificationsResponse{Notifications: response, Total: total, UnreadCount: unreadCount})
+}
+
+// MarkNotificationRead marks one notification of the current user as read.
+func (a *Assistant) MarkNotificationRead(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	notificationID, err := strconv.Atoi(ctx.Param("notificationId"))
+	if err != nil || notificationID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification id"})
+		return
+	}
+
+	var n table.Notification
+	if err := a.db.Where("id = ? AND user_id = ?", notificationID, userID).First(&n).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+			return
+		}
+		slog.Error("failed to find notification", "err", err, "user_id", userID, "notification_id", notificationID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notification"})
+		return
+	}
+	if n.ReadAt == nil {
+		now := time.Now()
+		if err := a.db.Model(&n).Update("read_at", now).Error; err != nil {
+			slog.Error("failed to mark notification read", "err", err, "notification_id", n.ID)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update notification"})
+			return
+		}
+		n.ReadAt = &now
+	}
+	ctx.JSON(http.StatusOK, newNotificationInfo(n))
+}
+
+// MarkAllNotificationsRead marks every unread notification of the current
+// user as read and returns how many were updated.
+func (a *Assistant) MarkAllNotificationsRead(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	result := a.db.Model(&table.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		slog.Error("failed to mark notifications read", "err", result.Error, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update notifications"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"updated": result.RowsAffected})
+}
+
+// StreamNotifications pushes the current user's new notifications as SSE
+// "notification" events until the client disconnects. The stream opens
+// with an "unread_count" event so clients can sync their badge.
+func (a *Assistant) StreamNotifications(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if a.notifications == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "notifications are not available"})
+		return
+	}
+
+	// Subscribe before counting so nothing created in between is missed.
+	messages, cancel := a.notifications.Subscribe(userID)
+	defer cancel()
+
+	unreadCount, err := a.countUnreadNotifications(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notifications"})
+		return
+	}
+
+	a.setupSSEResponse(ctx)
+	sendSSE(ctx, "unread_count", gin.H{"unread_count": unreadCount})
+
+	heartbeat := time.NewTicker(notificationHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case msg := <-messages:
+			sendSSE(ctx, "notification", newNotificationInfoFromMessage(msg))
+		case <-heartbeat.C:
+			sendSSE(ctx, "heartbeat", gin.H{"timestamp": time.Now().Unix()})
+		}
+	}
+}
+
+func (a *Assistant) countUnreadNotifications(userID int) (int64, error) {
+	var count int64
+	if err := a.db.Model(&table.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error; err != nil {
+		slog.Error("failed to count unread notifications", "err", err, "user_id", userID)
+		return 0, err
+	}
+	return count, nil
+}
+
+func newNotificationInfo(n table.Notification) NotificationInfo {
+	return NotificationInfo{
+		ID:        n.ID,
+		Kind:      n.Kind,
+		Title:     n.Title,
+		Body:      n.Body,
+		Link:      n.Link,
+		ReadAt:    n.ReadAt,
+		CreatedAt: n.CreatedAt,
+	}
+}
+
+func newNotificationInfoFromMessage(msg notification.Message) NotificationInfo {
+	return NotificationInfo{
+		ID:        msg.ID,
+		Kind:      msg.Kind,
+		Title:     msg.Title,
+		Body:      msg.Body,
+		Link:      msg.Link,
+		CreatedAt: msg.CreatedAt,
+	}
+}
@@ -0,0 +1,158 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/notification"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotificationAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupSchedulerTestDB(t)
+	assistant := &Assistant{db: db, notifications: notification.NewHub(db, nil)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/notifications", assistant.ListNotifications)
+		router.POST("/api/assistant/notifications/read", assistant.MarkAllNotificationsRead)
+		router.POST("/api/assistant/notifications/:notificationId/read", assistant.MarkNotificationRead)
+	})
+
+	for i, userID := range []int{1, 1, 1, 2} {
+		n := table.Notification{UserID: userID, Kind: constant.NotificationKindScheduledTaskRun, Title: fmt.Sprintf("n%d", i+1)}
+		if err := assistant.notifications.Notify(context.Background(), n); err != nil {
+			t.Fatalf("Notify() error: %v", err)
+		}
+	}
+
+	list := func(query string) ListNotificationsResponse {
+		t.Helper()
+		resp := doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/notifications"+query, nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("list status = %d, body = %s", resp.Code, resp.Body.String())
+		}
+		var result ListNotificationsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	result := list("")
+	if result.Total != 3 || result.UnreadCount != 3 || len(result.Notifications) != 3 || result.Notifications[0].Title != "n3" {
+		t.Fatalf("list = %+v", result)
+	}
+	newest := result.Notifications[0]
+
+	if resp := doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/notifications/4/read", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("mark notification of another user status = %d, want 404", resp.Code)
+	}
+	resp := doSessionTaskRequest(t, router, http.MethodPost, fmt.Sprintf("/api/assistant/notifications/%d/read", newest.ID), nil)
+	var marked NotificationInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &marked); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Code != http.StatusOK || marked.ReadAt == nil {
+		t.Fatalf("mark read status = %d, notification = %+v", resp.Code, marked)
+	}
+
+	result = list("?unread=true")
+	if result.Total != 2 || result.UnreadCount != 2 || len(result.Notifications) != 2 || result.Notifications[0].Title != "n2" {
+		t.Fatalf("unread list = %+v", result)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/notifications/read", nil)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"updated":2`) {
+		t.Fatalf("mark all read status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	if result := list(""); result.Total != 3 || result.UnreadCount != 0 {
+		t.Fatalf("list after mark all read = %+v", result)
+	}
+
+	var other table.Notification
+	if err := db.Where("user_id = ?", 2).First(&other).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if other.ReadAt != nil {
+		t.Fatal("notification of another user was marked read")
+	}
+}
+
+func TestStreamNotifications(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupSchedulerTestDB(t)
+	assistant := &Assistant{db: db, notifications: notification.NewHub(db, nil)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/notifications/stream", assistant.StreamNotifications)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	if err := db.Create(&table.Notification{UserID: 1, Kind: constant.NotificationKindScheduledTaskRun, Title: "old"}).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/assistant/notifications/stream", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest() error: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream request error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("stream status = %d, content type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	nextEvent := func() (string, string) {
+		t.Helper()
+		var event, data string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read stream: %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				data = strings.TrimPrefix(line, "data:")
+			case line == "" && event != "":
+				return event, data
+			}
+		}
+	}
+
+	if event, data := nextEvent(); event != "unread_count" || data != `{"unread_count":1}` {
+		t.Fatalf("first event = %s %s", event, data)
+	}
+
+	if err := assistant.notifications.Notify(context.Background(), table.Notification{UserID: 2, Kind: constant.NotificationKindVideoGeneration, Title: "not mine"}); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+	if err := assistant.notifications.Notify(context.Background(), table.Notification{UserID: 1, Kind: constant.NotificationKindVideoGeneration, Title: "video ready", Link: "/chat/s1"}); err != nil {
+		t.Fatalf("Notify() error: %v", err)
+	}
+	event, data := nextEvent()
+	var pushed NotificationInfo
+	if err := json.Unmarshal([]byte(data), &pushed); err != nil {
+		t.Fatalf("failed to decode event %s: %v", data, err)
+	}
+	if event != "notification" || pushed.Title != "video ready" || pushed.Link != "/chat/s1" || pushed.ID == 0 {
+		t.Fatalf("pushed event = %s %+v", event, pushed)
+	}
+}
@@ -0,0 +1,257 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/notification"
+	"aiguide/internal/pkg/webpush"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// maxDeviceNameLength caps the device name shown in the subscription list.
+const maxDeviceNameLength = 255
+
+// WebPushSubscriptionInfo is the API response shape for a subscribed device.
+type WebPushSubscriptionInfo struct {
+	ID            int        `json:"id"`
+	Endpoint      string     `json:"endpoint"`
+	DeviceName    string     `json:"device_name"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// WebPushStatusResponse tells the browser whether web push is available and
+// which VAPID key to subscribe with.
+type WebPushStatusResponse struct {
+	Enabled       bool                      `json:"enabled"`
+	PublicKey     string                    `json:"public_key,omitempty"`
+	Subscriptions []WebPushSubscriptionInfo `json:"subscriptions"`
+}
+
+// CreateWebPushSubscriptionRequest is the PushSubscription.toJSON() output
+// of the browser plus a name for the device.
+type CreateWebPushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" binding:"required"`
+	Keys     struct {
+		P256dh string `json:"p256dh" binding:"required"`
+		Auth   string `json:"auth" binding:"required"`
+	} `json:"keys"`
+	DeviceName string `json:"device_name"`
+}
+
+// NotificationPreferenceItem describes whether one notification kind is
+// pushed to the user's browsers.
+type NotificationPreferenceItem struct {
+	Kind    constant.NotificationKind `json:"kind" binding:"required"`
+	WebPush bool                      `json:"web_push"`
+}
+
+// NotificationPreferencesRequest is the request body for updating
+// notification preferences.
+type NotificationPreferencesRequest struct {
+	Preferences []NotificationPreferenceItem `json:"preferences" binding:"required,dive"`
+}
+
+// GetWebPushStatus returns the VAPID public key and the current user's
+// subscribed devices.
+func (a *Assistant) GetWebPushStatus(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var subscriptions []table.WebPushSubscription
+	if err := a.db.Where("user_id = ?", userID).Order("id").Find(&subscriptions).Error; err != nil {
+		slog.Error("failed to query push subscriptions", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load push subscriptions"})
+		return
+	}
+	response := WebPushStatusResponse{Subscriptions: make([]WebPushSubscriptionInfo, 0, len(subscriptions))}
+	if pusher := a.notifications.WebPush(); pusher != nil {
+		response.Enabled = true
+		response.PublicKey = pusher.PublicKey()
+	}
+	for _, sub := range subscriptions {
+		response.Subscriptions = append(response.Subscriptions, newWebPushSubscriptionInfo(sub))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateWebPushSubscription stores the push subscription of the current
+// browser. Subscribing an endpoint again updates its keys and owner.
+func (a *Assistant) CreateWebPushSubscription(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if a.notifications.WebPush() == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "web push is not enabled"})
+		return
+	}
+	var req CreateWebPushSubscriptionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	sub := webpush.Subscription{Endpoint: strings.TrimSpace(req.Endpoint), P256dh: req.Keys.P256dh, Auth: req.Keys.Auth}
+	if err := sub.Validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(sub.Endpoint) > 1024 || len(sub.P256dh) > 128 || len(sub.Auth) > 64 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "push subscription is too long"})
+		return
+	}
+
+	row := table.WebPushSubscription{
+		UserID:     userID,
+		Endpoint:   sub.Endpoint,
+		P256dh:     sub.P256dh,
+		Auth:       sub.Auth,
+		DeviceName: truncateRunes(strings.TrimSpace(req.DeviceName), maxDeviceNameLength),
+	}
+	if err := a.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "p256dh", "auth", "device_name", "failure_count", "updated_at"}),
+	}).Create(&row).Error; err != nil {
+		slog.Error("failed to save push subscription", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save push subscription"})
+		return
+	}
+	if err := a.db.Where("endpoint = ?", row.Endpoint).First(&row).Error; err != nil {
+		slog.Error("failed to load push subscription", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load push subscription"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, newWebPushSubscriptionInfo(row))
+}
+
+// DeleteWebPushSubscription removes a subscribed device of the current user.
+func (a *Assistant) DeleteWebPushSubscription(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	subscriptionID, err := strconv.Atoi(ctx.Param("subscriptionId"))
+	if err != nil || subscriptionID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription id"})
+		return
+	}
+
+	result := a.db.Where("id = ? AND user_id = ?", subscriptionID, userID).Delete(&table.WebPushSubscription{})
+	if result.Error != nil {
+		slog.Error("failed to delete push subscription", "err", result.Error, "subscription_id", subscriptionID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete push subscription"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "push subscription not found"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListNotificationPreferences returns, for every notification kind, whether
+// it is pushed to the current user's browsers.
+func (a *Assistant) ListNotificationPreferences(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	items, err := a.loadNotificationPreferences(userID)
+	if err != nil {
+		slog.Error("failed to query notification preferences", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notification preferences"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"preferences": items})
+}
+
+// UpdateNotificationPreferences sets which notification kinds are pushed to
+// the current user's browsers. Kinds not present in the request keep their
+// current preference.
+func (a *Assistant) UpdateNotificationPreferences(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req NotificationPreferencesRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	rows := make([]table.NotificationPreference, 0, len(req.Preferences))
+	for _, item := range req.Preferences {
+		if !slices.Contains(notification.Kinds, item.Kind) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "unsupported notification kind: " + string(item.Kind)})
+			return
+		}
+		rows = append(rows, table.NotificationPreference{UserID: userID, Kind: item.Kind, WebPush: item.WebPush})
+	}
+	if len(rows) > 0 {
+		if err := a.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "kind"}},
+			DoUpdates: clause.AssignmentColumns([]string{"web_push", "updated_at"}),
+		}).Create(&rows).Error; err != nil {
+			slog.Error("failed to save notification preferences", "err", err, "user_id", userID)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update notification preferences"})
+			return
+		}
+	}
+
+	items, err := a.loadNotificationPreferences(userID)
+	if err != nil {
+		slog.Error("failed to query notification preferences", "err", err, "user_id", userID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load notification preferences"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"preferences": items})
+}
+
+// loadNotificationPreferences returns one item per notification kind,
+// filling in the default (pushed) for kinds the user has not configured.
+func (a *Assistant) loadNotificationPreferences(userID int) ([]NotificationPreferenceItem, error) {
+	var rows []table.NotificationPreference
+	if err := a.db.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	stored := make(map[constant.NotificationKind]bool, len(rows))
+	for _, row := range rows {
+		stored[row.Kind] = row.WebPush
+	}
+
+	items := make([]NotificationPreferenceItem, 0, len(notification.Kinds))
+	for _, kind := range notification.Kinds {
+		webPush, ok := stored[kind]
+		if !ok {
+			webPush = true
+		}
+		items = append(items, NotificationPreferenceItem{Kind: kind, WebPush: webPush})
+	}
+	return items, nil
+}
+
+func newWebPushSubscriptionInfo(sub table.WebPushSubscription) WebPushSubscriptionInfo {
+	return WebPushSubscriptionInfo{
+		ID:            sub.ID,
+		Endpoint:      sub.Endpoint,
+		DeviceName:    sub.DeviceName,
+		LastSuccessAt: sub.LastSuccessAt,
+		CreatedAt:     sub.CreatedAt,
+	}
+}
@@ -0,0 +1,226 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/notification"
+	"aiguide/internal/pkg/webpush"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func setupWebPushTestAssistant(t *testing.T) (*Assistant, *gorm.DB) {
+	t.Helper()
+	db := setupSchedulerTestDB(t)
+	if err := db.AutoMigrate(&table.WebPushSubscription{}, &table.NotificationPreference{}); err != nil {
+		t.Fatalf("AutoMigrate() error: %v", err)
+	}
+	return &Assistant{db: db, notifications: notification.NewHub(db, nil)}, db
+}
+
+func newTestWebPusher(t *testing.T, db *gorm.DB) *notification.WebPusher {
+	t.Helper()
+	keys, err := webpush.GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error: %v", err)
+	}
+	sender, err := webpush.NewSender(keys, "mailto:admin@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewSender() error: %v", err)
+	}
+	return notification.NewWebPusher(db, sender)
+}
+
+func TestWebPushSubscriptionAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant, db := setupWebPushTestAssistant(t)
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/notifications/push", assistant.GetWebPushStatus)
+		router.POST("/api/assistant/notifications/push/subscriptions", assistant.CreateWebPushSubscription)
+		router.DELETE("/api/assistant/notifications/push/subscriptions/:subscriptionId", assistant.DeleteWebPushSubscription)
+	})
+
+	client, err := webpush.GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error: %v", err)
+	}
+	subscribe := func(endpoint, p256dh, deviceName string) *httptest.ResponseRecorder {
+		return doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/notifications/push/subscriptions", map[string]any{
+			"endpoint":    endpoint,
+			"keys":        map[string]string{"p256dh": p256dh, "auth": "BTBZMqHH6r4Tts7J_aSIgg"},
+			"device_name": deviceName,
+		})
+	}
+	status := func() WebPushStatusResponse {
+		t.Helper()
+		resp := doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/notifications/push", nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+		}
+		var result WebPushStatusResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	if result := status(); result.Enabled || result.PublicKey != "" {
+		t.Fatalf("status without web push = %+v", result)
+	}
+	if resp := subscribe("https://push.example.net/a", client.PublicKey, "Firefox"); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("subscribe without web push status = %d, want 503", resp.Code)
+	}
+
+	pusher := newTestWebPusher(t, db)
+	assistant.notifications.SetWebPush(pusher)
+	if resp := subscribe("http://push.example.net/a", client.PublicKey, "Firefox"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("subscribe with http endpoint status = %d, want 400", resp.Code)
+	}
+	if resp := subscribe("https://push.example.net/a", "bm90IGEga2V5", "Firefox"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("subscribe with invalid key status = %d, want 400", resp.Code)
+	}
+	if resp := subscribe("https://push.example.net/a", client.PublicKey, "Firefox"); resp.Code != http.StatusCreated {
+		t.Fatalf("subscribe status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	// Subscribing the same endpoint again updates it instead of adding a device.
+	db.Model(&table.WebPushSubscription{}).Where("endpoint = ?", "https://push.example.net/a").Update("failure_count", 3)
+	resp := subscribe("https://push.example.net/a", client.PublicKey, "Firefox on Linux")
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("resubscribe status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	var created WebPushSubscriptionInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	result := status()
+	if !result.Enabled || result.PublicKey != pusher.PublicKey() || len(result.Subscriptions) != 1 ||
+		result.Subscriptions[0].ID != created.ID || result.Subscriptions[0].DeviceName != "Firefox on Linux" {
+		t.Fatalf("status = %+v", result)
+	}
+	var stored table.WebPushSubscription
+	if err := db.First(&stored, created.ID).Error; err != nil || stored.FailureCount != 0 {
+		t.Fatalf("stored subscription = %+v, err = %v", stored, err)
+	}
+
+	other := table.WebPushSubscription{UserID: 2, Endpoint: "https://push.example.net/b", P256dh: client.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/assistant/notifications/push/subscriptions/%d", other.ID), nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("delete subscription of another user status = %d, want 404", resp.Code)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/assistant/notifications/push/subscriptions/%d", created.ID), nil); resp.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	if result := status(); len(result.Subscriptions) != 0 {
+		t.Fatalf("subscriptions after delete = %+v", result.Subscriptions)
+	}
+}
+
+func TestNotificationPreferencesAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant, _ := setupWebPushTestAssistant(t)
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/notifications/preferences", assistant.ListNotificationPreferences)
+		router.PUT("/api/assistant/notifications/preferences", assistant.UpdateNotificationPreferences)
+	})
+
+	decode := func(resp *httptest.ResponseRecorder) map[constant.NotificationKind]bool {
+		t.Helper()
+		if resp.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+		}
+		var result struct {
+			Preferences []NotificationPreferenceItem `json:"preferences"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		preferences := make(map[constant.NotificationKind]bool, len(result.Preferences))
+		for _, item := range result.Preferences {
+			preferences[item.Kind] = item.WebPush
+		}
+		return preferences
+	}
+
+	preferences := decode(doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/notifications/preferences", nil))
+	if len(preferences) != len(notification.Kinds) || !preferences[constant.NotificationKindVideoGeneration] {
+		t.Fatalf("default preferences = %v", preferences)
+	}
+
+	update := func(kind constant.NotificationKind, webPush bool) *httptest.ResponseRecorder {
+		return doSessionTaskRequest(t, router, http.MethodPut, "/api/assistant/notifications/preferences", map[string]any{
+			"preferences": []NotificationPreferenceItem{{Kind: kind, WebPush: webPush}},
+		})
+	}
+	if resp := update("unknown", false); resp.Code != http.StatusBadRequest {
+		t.Fatalf("update unknown kind status = %d, want 400", resp.Code)
+	}
+	preferences = decode(update(constant.NotificationKindVideoGeneration, false))
+	if preferences[constant.NotificationKindVideoGeneration] || !preferences[constant.NotificationKindScheduledTaskRun] {
+		t.Fatalf("updated preferences = %v", preferences)
+	}
+	enabled, err := notification.WebPushEnabled(assistant.db, 1, constant.NotificationKindVideoGeneration)
+	if err != nil || enabled {
+		t.Fatalf("WebPushEnabled() = %v, %v, want false", enabled, err)
+	}
+}
+
+func TestScheduler_Deliver_WebPush(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	if err := db.AutoMigrate(&table.WebPushSubscription{}, &table.NotificationPreference{}); err != nil {
+		t.Fatalf("AutoMigrate() error: %v", err)
+	}
+	s := newScheduler(db, nil, nil, 0)
+	task := table.ScheduledTask{UserID: 3, Title: "time check"}
+	target := table.ScheduledTaskDelivery{Channel: constant.DeliveryChannelWebPush}
+
+	if err := s.deliver(context.Background(), task, table.ScheduledTaskRun{}, target, "It is 09:00.", time.Now()); err == nil {
+		t.Fatal("deliver() expected error when web push is disabled")
+	}
+
+	s.notifications.SetWebPush(newTestWebPusher(t, db))
+	if err := s.deliver(context.Background(), task, table.ScheduledTaskRun{}, target, "It is 09:00.", time.Now()); err == nil {
+		t.Fatal("deliver() expected error without subscriptions")
+	}
+
+	var pushes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	client, err := webpush.GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error: %v", err)
+	}
+	sub := table.WebPushSubscription{UserID: 3, Endpoint: server.URL + "/push", P256dh: client.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"}
+	if err := db.Create(&sub).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	// The delivery target was chosen explicitly, so it ignores preferences.
+	if err := db.Create(&table.NotificationPreference{UserID: 3, Kind: constant.NotificationKindScheduledTaskRun}).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	if err := s.deliver(context.Background(), task, table.ScheduledTaskRun{}, target, "It is 09:00.", time.Now()); err != nil {
+		t.Fatalf("deliver() error: %v", err)
+	}
+	if pushes.Load() != 1 {
+		t.Fatalf("push service received %d messages, want 1", pushes.Load())
+	}
+	var count int64
+	if err := db.Model(&table.Notification{}).Count(&count).Error; err != nil || count != 0 {
+		t.Fatalf("web push delivery created %d notifications, want 0 (err = %v)", count, err)
+	}
+}
@@ -0,0 +1,630 @@
+package assistant
+
+import (
+	"aiguide/internal/pkg/constant"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+const (
+	// openAIModelID is the only model served by the OpenAI-compatible API:
+	// the assistant agent with all of its tools.
+	openAIModelID = "assistant"
+	// openAISessionPrefix marks the sessions of requests that are not stored.
+	// They are deleted when the request finishes.
+	openAISessionPrefix = "openai-"
+	// openAIKeepAliveInterval is how often a comment line is written to an
+	// idle stream so that proxies keep the connection open during long tool
+	// calls.
+	openAIKeepAliveInterval = 30 * time.Second
+)
+
+// ChatCompletionRequest is the request body of POST /v1/chat/completions.
+// Besides the OpenAI fields it accepts two extensions: SessionID continues a
+// stored conversation and IncludeToolEvents streams the agent's tool calls.
+type ChatCompletionRequest struct {
+	Model         string                  `json:"model"`
+	Messages      []ChatCompletionMessage `json:"messages"`
+	Stream        bool                    `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	// Store keeps the conversation as a regular session that shows up in the
+	// web app. Otherwise the session only lives for the request.
+	Store bool `json:"store"`
+
+	SessionID         string `json:"session_id"`
+	IncludeToolEvents bool   `json:"include_tool_events"`
+}
+
+// ChatCompletionMessage is a message of a chat completion request. Content is
+// either a string or an array of text and image_url parts.
+type ChatCompletionMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// chatCompletionContentPart is an element of an array message content.
+type chatCompletionContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+// ChatCompletionUsage reports the tokens of all model calls of a run.
+type ChatCompletionUsage struct {
+	PromptTokens     int32 `json:"prompt_tokens"`
+	CompletionTokens int32 `json:"completion_tokens"`
+	TotalTokens      int32 `json:"total_tokens"`
+}
+
+// ChatCompletionToolEvent is a tool call or tool result of the agent. It is
+// an extension: the tools run on the server, so they are not reported as
+// OpenAI tool_calls, which a client would be expected to execute.
+type ChatCompletionToolEvent struct {
+	Type       string         `json:"type"` // tool_call or tool_result
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+	ToolName   string         `json:"tool_name"`
+	Args       map[string]any `json:"args,omitempty"`
+	Result     map[string]any `json:"result,omitempty"`
+}
+
+// ChatCompletionMessageOutput is the assistant message of a completion.
+type ChatCompletionMessageOutput struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatCompletionChoice is the only choice of a non-streaming completion.
+type ChatCompletionChoice struct {
+	Index        int                         `json:"index"`
+	Message      ChatCompletionMessageOutput `json:"message"`
+	FinishReason string                      `json:"finish_reason"`
+}
+
+// ChatCompletionResponse is the response of a non-streaming request.
+type ChatCompletionResponse struct {
+	ID         string                    `json:"id"`
+	Object     string                    `json:"object"`
+	Created    int64                     `json:"created"`
+	Model      string                    `json:"model"`
+	Choices    []ChatCompletionChoice    `json:"choices"`
+	Usage      ChatCompletionUsage       `json:"usage"`
+	SessionID  string                    `json:"session_id,omitempty"`
+	ToolEvents []ChatCompletionToolEvent `json:"aiguide_tool_events,omitempty"`
+}
+
+// ChatCompletionDelta is the message delta of a stream chunk.
+type ChatCompletionDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ChatCompletionChunkChoice is the only choice of a stream chunk.
+type ChatCompletionChunkChoice struct {
+	Index        int                 `json:"index"`
+	Delta        ChatCompletionDelta `json:"delta"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+// ChatCompletionChunk is a chunk of a streaming response.
+type ChatCompletionChunk struct {
+	ID        string                      `json:"id"`
+	Object    string                      `json:"object"`
+	Created   int64                       `json:"created"`
+	Model     string                      `json:"model"`
+	Choices   []ChatCompletionChunkChoice `json:"choices"`
+	Usage     *ChatCompletionUsage        `json:"usage,omitempty"`
+	SessionID string                      `json:"session_id,omitempty"`
+	Event     *ChatCompletionToolEvent    `json:"aiguide_event,omitempty"`
+}
+
+// ListOpenAIModels lists the models of the OpenAI-compatible API.
+func (a *Assistant) ListOpenAIModels(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data": []gin.H{{
+			"id":       openAIModelID,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "aiguide",
+		}},
+	})
+}
+
+// CreateChatCompletion runs the assistant agent on an OpenAI chat completion
+// request. Earlier messages become the history of a new session, system
+// messages are passed as instructions with the last user message, and the
+// agent's final text is returned as the assistant message. API clients cannot
+// answer confirmation prompts, so tool calls the user's confirmation settings
+// require confirming fail instead of running (see createAPIRunner).
+func (a *Assistant) CreateChatCompletion(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		openAIError(ctx, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "unauthorized")
+		return
+	}
+	var req ChatCompletionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", "invalid request body: "+err.Error())
+		return
+	}
+	if req.Model != "" && req.Model != openAIModelID {
+		openAIError(ctx, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("the model %q does not exist, use %q", req.Model, openAIModelID))
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", "the last message must be a user message")
+		return
+	}
+
+	var (
+		instructions []string
+		history      []*genai.Content
+	)
+	for _, msg := range req.Messages[:len(req.Messages)-1] {
+		// Only the text of earlier messages is kept: their attachments would
+		// have to be uploaded again with every request.
+		text, _, err := parseChatCompletionContent(msg.Content)
+		if err != nil {
+			openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+			return
+		}
+		switch msg.Role {
+		case "system", "developer":
+			if text != "" {
+				instructions = append(instructions, text)
+			}
+		case "user", "assistant":
+			if text == "" {
+				continue
+			}
+			role := genai.Role(genai.RoleUser)
+			if msg.Role == "assistant" {
+				role = genai.RoleModel
+			}
+			history = append(history, genai.NewContentFromText(text, role))
+		case "tool":
+			// Tools run on the server; results of client tools are ignored.
+		default:
+			openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", fmt.Sprintf("unsupported message role %q", msg.Role))
+			return
+		}
+	}
+
+	text, images, err := parseChatCompletionContent(req.Messages[len(req.Messages)-1].Content)
+	if err != nil {
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+	if len(images) > maxUserFileCount {
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", fmt.Sprintf("too many images (max %d)", maxUserFileCount))
+		return
+	}
+
+	titleMessage := text
+	if titleMessage == "" {
+		titleMessage = fmt.Sprintf("用户发送了 %d 个文件", len(images))
+	}
+	userIDStr := strconv.Itoa(userID)
+	stored := req.Store || req.SessionID != ""
+	sessionID, isNew, ok := a.openAISession(ctx, userID, req, history, titleMessage)
+	if !ok {
+		return
+	}
+	if !stored {
+		defer func() {
+			err := a.session.Delete(context.WithoutCancel(ctx), &session.DeleteRequest{
+				AppName:   constant.AppNameAssistant.String(),
+				UserID:    userIDStr,
+				SessionID: sessionID,
+			})
+			if err != nil {
+				slog.Error("failed to delete openai api session", "err", err, "session_id", sessionID)
+			}
+		}()
+	}
+
+	// Unstored requests keep their files inline instead of saving them as
+	// file assets, so nothing outlives the request.
+	var (
+		db        = a.db
+		fileStore = a.fileStore
+	)
+	if !stored {
+		db, fileStore = nil, nil
+	}
+	var parts []*genai.Part
+	for _, dataURI := range images {
+		data, mimeType, err := parseDataURI(dataURI)
+		if err != nil {
+			openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+			return
+		}
+		parts, err = appendUserUploadPart(ctx, parts, db, fileStore, userIDStr, sessionID, "", data, mimeType, true)
+		if err != nil {
+			openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+			return
+		}
+	}
+	if len(instructions) > 0 {
+		text = "<instructions>\n" + strings.Join(instructions, "\n\n") + "\n</instructions>\n" + text
+	}
+	if text != "" {
+		parts = append([]*genai.Part{genai.NewPartFromText(text)}, parts...)
+	}
+	if err := ensureUserMessageParts(parts); err != nil {
+		openAIError(ctx, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+	if isNew {
+		if memoryContext, err := a.fetchUserMemories(userID); err != nil {
+			slog.Warn("fetchUserMemories failed, skipping memory injection", "err", err, "userID", userID)
+		} else if memoryContext != "" {
+			parts = prependMemoryContext(parts, memoryContext)
+		}
+	}
+
+	completion := &chatCompletionRun{
+		id:         "chatcmpl-" + randomString(24),
+		created:    time.Now().Unix(),
+		stream:     req.Stream,
+		toolEvents: req.IncludeToolEvents,
+		ctx:        ctx,
+	}
+	if stored {
+		completion.sessionID = sessionID
+	}
+	ctx.Set(constant.ContextKeySessionID, sessionID)
+	message := genai.NewContentFromParts(parts, genai.RoleUser)
+
+	if !req.Stream {
+		if err := completion.run(a, userIDStr, sessionID, message); err != nil {
+			openAIError(ctx, http.StatusInternalServerError, "server_error", "", err.Error())
+			return
+		}
+		ctx.JSON(http.StatusOK, completion.response())
+		return
+	}
+
+	a.setupSSEResponse(ctx)
+	stopKeepAlive := completion.startKeepAlive()
+	defer stopKeepAlive()
+	completion.write(completion.chunk(ChatCompletionDelta{Role: "assistant"}, nil))
+	if err := completion.run(a, userIDStr, sessionID, message); err != nil {
+		if ctx.Request.Context().Err() != nil {
+			return
+		}
+		completion.write(gin.H{"error": gin.H{"message": err.Error(), "type": "server_error"}})
+	} else {
+		stop := "stop"
+		completion.write(completion.chunk(ChatCompletionDelta{}, &stop))
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			chunk := completion.chunk(ChatCompletionDelta{}, nil)
+			chunk.Choices = []ChatCompletionChunkChoice{}
+			chunk.Usage = &completion.usage
+			completion.write(chunk)
+		}
+	}
+	completion.writeRaw("data: [DONE]\n\n")
+}
+
+// openAISession returns the session a chat completion runs in and whether it
+// was created. With a session_id it continues that session and the history in
+// the request is ignored; otherwise a new session is created and seeded with
+// history. It writes the error response when it fails.
+func (a *Assistant) openAISession(ctx *gin.Context, userID int, req ChatCompletionRequest, history []*genai.Content, titleMessage string) (string, bool, bool) {
+	userIDStr := strconv.Itoa(userID)
+	if req.SessionID != "" {
+		if err := a.ensureSessionOwnership(userID, req.SessionID); err != nil {
+			if errors.Is(err, errSessionNotFound) {
+				openAIError(ctx, http.StatusNotFound, "invalid_request_error", "session_not_found", "session not found")
+				return "", false, false
+			}
+			openAIError(ctx, http.StatusInternalServerError, "server_error", "", "failed to load session")
+			return "", false, false
+		}
+		if _, err := a.ensureSession(ctx, constant.AppNameAssistant.String(), userIDStr, req.SessionID); err != nil {
+			openAIError(ctx, http.StatusInternalServerError, "server_error", "", "failed to load session")
+			return "", false, false
+		}
+		return req.SessionID, false, true
+	}
+
+	sessionID := openAISessionPrefix + randomString(16)
+	if req.Store {
+		sessionID = generateSessionID()
+	}
+	created, err := a.session.Create(ctx, &session.CreateRequest{
+		AppName:   constant.AppNameAssistant.String(),
+		UserID:    userIDStr,
+		SessionID: sessionID,
+		State:     map[string]any{},
+	})
+	if err != nil {
+		slog.Error("failed to create openai api session", "err", err, "user_id", userID)
+		openAIError(ctx, http.StatusInternalServerError, "server_error", "", "failed to create session")
+		return "", false, false
+	}
+	fail := func(message string) (string, bool, bool) {
+		if err := a.session.Delete(context.WithoutCancel(ctx), &session.DeleteRequest{
+			AppName:   constant.AppNameAssistant.String(),
+			UserID:    userIDStr,
+			SessionID: sessionID,
+		}); err != nil {
+			slog.Error("failed to delete openai api session", "err", err, "session_id", sessionID)
+		}
+		openAIError(ctx, http.StatusInternalServerError, "server_error", "", message)
+		return "", false, false
+	}
+	for _, content := range history {
+		event := session.NewEvent("openai-history")
+		event.Author = "user"
+		if content.Role == genai.RoleModel {
+			event.Author = "assistant"
+		}
+		event.LLMResponse = model.LLMResponse{Content: content}
+		if err := a.session.AppendEvent(ctx, created.Session, event); err != nil {
+			slog.Error("failed to seed openai api session", "err", err, "session_id", sessionID)
+			return fail("failed to seed session history")
+		}
+	}
+	if req.Store {
+		if err := a.claimSessionMeta(sessionID, userID); err != nil {
+			return fail("failed to save session owner")
+		}
+		go func() {
+			if err := a.generateTitle(context.Background(), sessionID, titleMessage); err != nil {
+				slog.Error("a.generateTitle failed", "err", err)
+			}
+		}()
+	}
+	return sessionID, true, true
+}
+
+// parseChatCompletionContent returns the text and the data URIs of the images
+// of a message content. Remote image URLs are rejected: the server does not
+// fetch files on behalf of API clients.
+func parseChatCompletionContent(raw json.RawMessage) (string, []string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return "", nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		return strings.Trim(text, "\n\r"), nil, nil
+	}
+
+	var parts []chatCompletionContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, errors.New("message content must be a string or an array of content parts")
+	}
+	var (
+		texts  []string
+		images []string
+	)
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			if !strings.HasPrefix(part.ImageURL.URL, "data:") {
+				return "", nil, errors.New("image_url must be a base64 data URI")
+			}
+			images = append(images, part.ImageURL.URL)
+		default:
+			return "", nil, fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	return strings.Trim(strings.Join(texts, "\n"), "\n\r"), images, nil
+}
+
+// chatCompletionRun collects the output of one agent run and, for streaming
+// requests, writes it to the client as it arrives.
+type chatCompletionRun struct {
+	id         string
+	created    int64
+	sessionID  string
+	stream     bool
+	toolEvents bool
+	ctx        *gin.Context
+
+	mu     sync.Mutex // serializes writes with the keep-alive goroutine
+	output strings.Builder
+	// inSegment is set while partial text of a model response is streamed;
+	// the final event of the response repeats the aggregated text.
+	inSegment bool
+	usage     ChatCompletionUsage
+	events    []ChatCompletionToolEvent
+}
+
+// run runs message through the api runner and collects the reply text, the
+// tool events and the token usage.
+func (c *chatCompletionRun) run(a *Assistant, userID, sessionID string, message *genai.Content) error {
+	seenToolCalls := make(map[string]struct{})
+	seenFunctionResponses := make(map[string]struct{})
+	runConfig := agent.RunConfig{StreamingMode: agent.StreamingModeSSE}
+	for event, err := range a.apiRunner.Run(c.ctx, userID, sessionID, message, runConfig) {
+		if c.ctx.Request.Context().Err() != nil {
+			return c.ctx.Request.Context().Err()
+		}
+		if err != nil {
+			// Like the web chat, a response cut at the token limit is kept.
+			if strings.Contains(err.Error(), "last event is not final") {
+				return nil
+			}
+			slog.Error("failed to run agent", "err", err, "userID", userID, "sessionID", sessionID)
+			return fmt.Errorf("runner error: %w", err)
+		}
+		if event == nil {
+			continue
+		}
+		if !event.Partial && event.UsageMetadata != nil {
+			c.usage.PromptTokens += event.UsageMetadata.PromptTokenCount
+			c.usage.CompletionTokens += event.UsageMetadata.CandidatesTokenCount
+			c.usage.TotalTokens += event.UsageMetadata.TotalTokenCount
+		}
+		if event.Content == nil {
+			continue
+		}
+
+		var text strings.Builder
+		for _, part := range event.Content.Parts {
+			if part.Text != "" && !part.Thought && !isResearchIntermediateAgent(event.Author) {
+				text.WriteString(part.Text)
+			}
+			if call := part.FunctionCall; call != nil && !shouldHideToolCall(call.Name, event.Author) {
+				key := functionCallKey(call)
+				if _, seen := seenToolCalls[key]; !seen {
+					seenToolCalls[key] = struct{}{}
+					c.addToolEvent(ChatCompletionToolEvent{Type: "tool_call", ToolCallID: call.ID, ToolName: call.Name, Args: call.Args})
+				}
+			}
+			if response := part.FunctionResponse; response != nil {
+				key := functionResponseKey(response)
+				if _, seen := seenFunctionResponses[key]; !seen {
+					seenFunctionResponses[key] = struct{}{}
+					c.addToolEvent(ChatCompletionToolEvent{Type: "tool_result", ToolCallID: response.ID, ToolName: response.Name, Result: response.Response})
+				}
+			}
+		}
+		switch {
+		case event.Partial:
+			if text.Len() > 0 {
+				c.addText(text.String(), !c.inSegment)
+				c.inSegment = true
+			}
+		case c.inSegment:
+			// The aggregated text was already sent as partial deltas.
+			c.inSegment = false
+		case text.Len() > 0:
+			c.addText(text.String(), true)
+		}
+	}
+	return nil
+}
+
+// addText appends text to the reply, separating the replies of successive
+// model calls by a blank line.
+func (c *chatCompletionRun) addText(text string, newSegment bool) {
+	if newSegment && c.output.Len() > 0 {
+		text = "\n\n" + text
+	}
+	c.output.WriteString(text)
+	if c.stream {
+		c.write(c.chunk(ChatCompletionDelta{Content: text}, nil))
+	}
+}
+
+func (c *chatCompletionRun) addToolEvent(event ChatCompletionToolEvent) {
+	if !c.toolEvents {
+		return
+	}
+	if !c.stream {
+		c.events = append(c.events, event)
+		return
+	}
+	chunk := c.chunk(ChatCompletionDelta{}, nil)
+	chunk.Choices = []ChatCompletionChunkChoice{}
+	chunk.Event = &event
+	c.write(chunk)
+}
+
+func (c *chatCompletionRun) chunk(delta ChatCompletionDelta, finishReason *string) ChatCompletionChunk {
+	return ChatCompletionChunk{
+		ID:        c.id,
+		Object:    "chat.completion.chunk",
+		Created:   c.created,
+		Model:     openAIModelID,
+		Choices:   []ChatCompletionChunkChoice{{Delta: delta, FinishReason: finishReason}},
+		SessionID: c.sessionID,
+	}
+}
+
+func (c *chatCompletionRun) response() ChatCompletionResponse {
+	return ChatCompletionResponse{
+		ID:      c.id,
+		Object:  "chat.completion",
+		Created: c.created,
+		Model:   openAIModelID,
+		Choices: []ChatCompletionChoice{{
+			Message:      ChatCompletionMessageOutput{Role: "assistant", Content: c.output.String()},
+			FinishReason: "stop",
+		}},
+		Usage:      c.usage,
+		SessionID:  c.sessionID,
+		ToolEvents: c.events,
+	}
+}
+
+func (c *chatCompletionRun) write(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal chat completion chunk", "err", err)
+		return
+	}
+	c.writeRaw("data: " + string(data) + "\n\n")
+}
+
+func (c *chatCompletionRun) writeRaw(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx.Writer.WriteString(s)
+	c.ctx.Writer.Flush()
+}
+
+// startKeepAlive writes an SSE comment every openAIKeepAliveInterval. OpenAI
+// clients ignore comments, unlike the heartbeat events of the web chat. The
+// returned function stops it and waits, so nothing is written after the
+// handler returns.
+func (c *chatCompletionRun) startKeepAlive() func() {
+	keepAliveCtx, cancel := context.WithCancel(c.ctx.Request.Context())
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(openAIKeepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-keepAliveCtx.Done():
+				return
+			case <-ticker.C:
+				c.writeRaw(": keep-alive\n\n")
+			}
+		}
+	})
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// openAIError writes an error in the OpenAI error format, which OpenAI
+// clients display.
+func openAIError(ctx *gin.Context, status int, errType, code, message string) {
+	body := gin.H{"message": message, "type": errType}
+	if code != "" {
+		body["code"] = code
+	}
+	ctx.JSON(status, gin.H{"error": body})
+}
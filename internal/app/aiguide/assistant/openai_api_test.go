@@ -0,0 +1,315 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+// newFakeOpenAIRunner returns an assistant runner that streams its answer as
+// two partial events followed by the aggregated final event, after a tool
+// call. It records the texts of the session history it was run with.
+func newFakeOpenAIRunner(t *testing.T, svc session.Service, history *[]string) *runner.Runner {
+	t.Helper()
+	return newScriptedRunner(t, svc, constant.AppNameAssistant, func(ctx agent.InvocationContext) ([]model.LLMResponse, error) {
+		*history = nil
+		for event := range ctx.Session().Events().All() {
+			if event.Content != nil && len(event.Content.Parts) > 0 {
+				*history = append(*history, event.Author+": "+event.Content.Parts[0].Text)
+			}
+		}
+		return []model.LLMResponse{
+			{Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "c1", Name: "current_time"}}}}},
+			{Content: &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "c1", Name: "current_time", Response: map[string]any{"time": "09:00"}}}}}},
+			{Content: genai.NewContentFromText("It is ", genai.RoleModel), Partial: true},
+			{Content: genai.NewContentFromText("09:00.", genai.RoleModel), Partial: true},
+			{
+				Content:       genai.NewContentFromText("It is 09:00.", genai.RoleModel),
+				UsageMetadata: &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 12, CandidatesTokenCount: 4, TotalTokenCount: 16},
+			},
+		}, nil
+	})
+}
+
+func setupOpenAITestRouter(t *testing.T) (*gin.Engine, *gorm.DB, session.Service, *[]string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := setupSchedulerTestDB(t)
+	if err := db.AutoMigrate(&table.SessionMeta{}, &table.UserMemory{}); err != nil {
+		t.Fatalf("AutoMigrate() error: %v", err)
+	}
+	svc := session.InMemoryService()
+	history := new([]string)
+	a := &Assistant{db: db, session: svc, apiRunner: newFakeOpenAIRunner(t, svc, history)}
+	router := newProjectTestRouter(a, func(router *gin.Engine) {
+		router.GET("/v1/models", a.ListOpenAIModels)
+		router.POST("/v1/chat/completions", a.CreateChatCompletion)
+	})
+	return router, db, svc, history
+}
+
+func listTestSessions(t *testing.T, svc session.Service) []session.Session {
+	t.Helper()
+	resp, err := svc.List(context.Background(), &session.ListRequest{AppName: constant.AppNameAssistant.String(), UserID: "1"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	return resp.Sessions
+}
+
+func TestCreateChatCompletion(t *testing.T) {
+	router, _, svc, history := setupOpenAITestRouter(t)
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", map[string]any{
+		"model": "assistant",
+		"messages": []map[string]any{
+			{"role": "system", "content": "Answer briefly."},
+			{"role": "user", "content": "Hi"},
+			{"role": "assistant", "content": "Hello!"},
+			{"role": "user", "content": []map[string]any{{"type": "text", "text": "What time is it?"}}},
+		},
+		"include_tool_events": true,
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	var completion ChatCompletionResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &completion); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if completion.Object != "chat.completion" || len(completion.Choices) != 1 ||
+		completion.Choices[0].Message.Content != "It is 09:00." || completion.Usage.TotalTokens != 16 {
+		t.Fatalf("completion = %+v", completion)
+	}
+	if completion.SessionID != "" || len(completion.ToolEvents) != 2 || completion.ToolEvents[0].ToolName != "current_time" {
+		t.Fatalf("session id = %q, tool events = %+v", completion.SessionID, completion.ToolEvents)
+	}
+	if len(*history) != 3 || (*history)[0] != "user: Hi" || (*history)[1] != "assistant: Hello!" ||
+		!strings.Contains((*history)[2], "Answer briefly.") || !strings.HasSuffix((*history)[2], "What time is it?") {
+		t.Fatalf("history = %q", *history)
+	}
+	if sessions := listTestSessions(t, svc); len(sessions) != 0 {
+		t.Fatalf("sessions = %d, want the request session deleted", len(sessions))
+	}
+}
+
+func TestCreateChatCompletionStream(t *testing.T) {
+	router, _, _, _ := setupOpenAITestRouter(t)
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", map[string]any{
+		"messages":       []map[string]any{{"role": "user", "content": "What time is it?"}},
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	body := resp.Body.String()
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Fatalf("body = %s, want it to end with [DONE]", body)
+	}
+
+	var (
+		content strings.Builder
+		finish  string
+		usage   *ChatCompletionUsage
+	)
+	for line := range strings.SplitSeq(body, "\n\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("failed to decode chunk %s: %v", data, err)
+		}
+		if chunk.Object != "chat.completion.chunk" || chunk.Event != nil {
+			t.Fatalf("chunk = %s", data)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+			if choice.FinishReason != nil {
+				finish = *choice.FinishReason
+			}
+		}
+	}
+	if content.String() != "It is 09:00." || finish != "stop" || usage == nil || usage.PromptTokens != 12 {
+		t.Fatalf("content = %q, finish = %q, usage = %+v", content.String(), finish, usage)
+	}
+}
+
+func TestCreateChatCompletionStreamToolEvents(t *testing.T) {
+	router, _, _, _ := setupOpenAITestRouter(t)
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", map[string]any{
+		"messages":            []map[string]any{{"role": "user", "content": "What time is it?"}},
+		"stream":              true,
+		"include_tool_events": true,
+	})
+	body := resp.Body.String()
+	if !strings.Contains(body, `"aiguide_event":{"type":"tool_call","tool_call_id":"c1","tool_name":"current_time"}`) ||
+		!strings.Contains(body, `"aiguide_event":{"type":"tool_result","tool_call_id":"c1","tool_name":"current_time","result":{"time":"09:00"}}`) {
+		t.Fatalf("body = %s, want tool events", body)
+	}
+	if strings.Contains(body, `"tool_calls"`) {
+		t.Fatalf("body = %s, server tools must not be reported as OpenAI tool calls", body)
+	}
+}
+
+func TestCreateChatCompletionContinuesSession(t *testing.T) {
+	router, db, svc, history := setupOpenAITestRouter(t)
+	_, err := svc.Create(context.Background(), &session.CreateRequest{
+		AppName:   constant.AppNameAssistant.String(),
+		UserID:    "1",
+		SessionID: "session-1",
+		State:     map[string]any{},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := db.Create(&table.SessionMeta{SessionID: "session-1", UserID: 1, ThreadID: "session-1", Version: 1}).Error; err != nil {
+		t.Fatalf("failed to create session meta: %v", err)
+	}
+	if err := db.Create(&table.SessionMeta{SessionID: "session-2", UserID: 2, ThreadID: "session-2", Version: 1}).Error; err != nil {
+		t.Fatalf("failed to create session meta: %v", err)
+	}
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", map[string]any{
+		"messages":   []map[string]any{{"role": "user", "content": "What time is it?"}},
+		"session_id": "session-1",
+	})
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"session_id":"session-1"`) {
+		t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+	if len(*history) != 1 || (*history)[0] != "user: What time is it?" {
+		t.Fatalf("history = %q", *history)
+	}
+	if sessions := listTestSessions(t, svc); len(sessions) != 1 {
+		t.Fatalf("sessions = %d, want the continued session kept", len(sessions))
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", map[string]any{
+		"messages":   []map[string]any{{"role": "user", "content": "Hi"}},
+		"session_id": "session-2",
+	})
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 for a session of another user", resp.Code)
+	}
+}
+
+func TestCreateChatCompletionRejectsToolsNeedingConfirmation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupSchedulerTestDB(t)
+	if err := db.AutoMigrate(&table.SessionMeta{}, &table.UserMemory{}, &table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error: %v", err)
+	}
+	svc := session.InMemoryService()
+	var sentTo []string
+	a := &Assistant{db: db, session: svc, apiRunner: newConfirmingRunner(t, svc, constant.AppNameAssistant, tools.ConfirmationReject, &sentTo)}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Like APITokenAuth, expose the user and the db to the tools.
+		c.Set(constant.ContextKeyUserID, 1)
+		c.Set(constant.ContextKeyTx, db)
+		c.Next()
+	})
+	router.POST("/v1/chat/completions", a.CreateChatCompletion)
+	complete := func() string {
+		t.Helper()
+		resp := doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", map[string]any{
+			"model":    "assistant",
+			"messages": []map[string]any{{"role": "user", "content": "Tell bob"}},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+		}
+		var completion ChatCompletionResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &completion); err != nil || len(completion.Choices) != 1 {
+			t.Fatalf("completion = %+v, %v", completion, err)
+		}
+		return completion.Choices[0].Message.Content
+	}
+
+	if content := complete(); len(sentTo) != 0 || !strings.Contains(content, "requires confirmation in the web app") {
+		t.Fatalf("sent to %v, content %q; want send_email rejected by default", sentTo, content)
+	}
+
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 1, ToolName: "send_email", Required: false}).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	complete()
+	if len(sentTo) != 1 || sentTo[0] != "bob@example.com" {
+		t.Fatalf("sent to %v, want bob once confirmation is off", sentTo)
+	}
+}
+
+func TestCreateChatCompletionValidation(t *testing.T) {
+	router, _, _, _ := setupOpenAITestRouter(t)
+
+	tests := []struct {
+		name       string
+		body       map[string]any
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "unknown model",
+			body:       map[string]any{"model": "gpt-4o", "messages": []map[string]any{{"role": "user", "content": "Hi"}}},
+			wantStatus: http.StatusNotFound,
+			wantBody:   `"code":"model_not_found"`,
+		},
+		{
+			name:       "last message not from the user",
+			body:       map[string]any{"messages": []map[string]any{{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello"}}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "the last message must be a user message",
+		},
+		{
+			name: "remote image",
+			body: map[string]any{"messages": []map[string]any{{"role": "user", "content": []map[string]any{
+				{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/cat.png"}},
+			}}}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "image_url must be a base64 data URI",
+		},
+		{
+			name:       "empty message",
+			body:       map[string]any{"messages": []map[string]any{{"role": "user", "content": ""}}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "message or images required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doSessionTaskRequest(t, router, http.MethodPost, "/v1/chat/completions", tt.body)
+			if resp.Code != tt.wantStatus || !strings.Contains(resp.Body.String(), tt.wantBody) {
+				t.Fatalf("status = %d, body = %s; want %d containing %s", resp.Code, resp.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListOpenAIModels(t *testing.T) {
+	router, _, _, _ := setupOpenAITestRouter(t)
+
+	resp := doSessionTaskRequest(t, router, http.MethodGet, "/v1/models", nil)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"id":"assistant"`) {
+		t.Fatalf("status = %d, body = %s", resp.Code, resp.Body.String())
+	}
+}
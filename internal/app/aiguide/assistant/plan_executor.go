@@ -0,0 +1,515 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool/toolconfirmation"
+	"google.golang.org/genai"
+	"gorm.io/gorm"
+)
+
+// chatModePlan selects plan-and-execute mode in ChatRequest.Mode.
+const chatModePlan = "plan"
+
+const (
+	planMaxTasks         = 20
+	planMaxParallelTasks = 3
+	planTaskMaxAttempts  = 2
+	planTaskTimeout      = 10 * time.Minute
+	planResultMaxChars   = 4000
+)
+
+// Plan progress stages reported while a plan runs.
+const (
+	PlanStagePlanning      = "planning"
+	PlanStagePlanned       = "planned"
+	PlanStageTaskStarted   = "task_started"
+	PlanStageTaskRetrying  = "task_retrying"
+	PlanStageTaskConfirm   = "confirmation_required"
+	PlanStageTaskCompleted = "task_completed"
+	PlanStageTaskFailed    = "task_failed"
+	PlanStageFinished      = "finished"
+)
+
+// PlanProgress is emitted while a plan is created and executed so the UI can
+// render the task list and each task's state.
+type PlanProgress struct {
+	Stage   string              `json:"stage"`
+	TaskID  int                 `json:"task_id,omitempty"`
+	Title   string              `json:"title,omitempty"`
+	Status  constant.TaskStatus `json:"status,omitempty"`
+	Attempt int                 `json:"attempt,omitempty"`
+	Result  string              `json:"result,omitempty"`
+	Tasks   []table.Task        `json:"tasks,omitempty"` // the whole plan, sent with the planned and finished stages
+	Message string              `json:"message,omitempty"`
+	// Confirmation is the confirmation_required payload of a tool call the
+	// task is waiting on, sent with the confirmation_required stage.
+	Confirmation gin.H `json:"confirmation,omitempty"`
+}
+
+// PlanProgressReporter receives plan progress updates. It may be called from
+// several goroutines at once.
+type PlanProgressReporter func(PlanProgress)
+
+var errEmptyPlan = errors.New("planner created no tasks")
+
+// planExecutor runs plan-and-execute requests: the planner agent splits the
+// request into tasks, then the tasks run through the executor runner in
+// dependency order, independent tasks in parallel.
+//
+// The executor pauses confirmable tools. A paused task waits in confirmations
+// until the user answers through ResolveToolConfirmation, then resumes.
+type planExecutor struct {
+	db       *gorm.DB
+	session  session.Service
+	planner  *runner.Runner
+	executor *runner.Runner
+
+	mu            sync.Mutex
+	confirmations map[string]*planConfirmation // by confirmation ID
+}
+
+// planConfirmation is a confirmation request of a running plan task.
+type planConfirmation struct {
+	userID    int
+	sessionID string // the chat session streaming the plan
+	pending   *pendingConfirmation
+	decision  chan toolconfirmation.ToolConfirmation
+}
+
+// planTaskOutcome is the result of one task's final attempt.
+type planTaskOutcome struct {
+	taskID int
+	result string
+	err    error
+}
+
+// Run plans request for the chat session and executes the plan. It returns the
+// plan's tasks with their final status and result.
+func (e *planExecutor) Run(ctx context.Context, userID int, sessionID, request string, report PlanProgressReporter) ([]table.Task, error) {
+	if report == nil {
+		report = func(PlanProgress) {}
+	}
+	ctx = context.WithValue(ctx, constant.ContextKeyUserID, userID)
+	ctx = context.WithValue(ctx, constant.ContextKeyTx, e.db)
+	ctx = context.WithValue(ctx, constant.ContextKeySessionID, sessionID)
+
+	report(PlanProgress{Stage: PlanStagePlanning})
+	tasks, err := e.plan(ctx, userID, sessionID, request)
+	if err != nil {
+		return nil, err
+	}
+	report(PlanProgress{Stage: PlanStagePlanned, Tasks: tasks})
+
+	tasks = e.execute(ctx, userID, request, tasks, report)
+	report(PlanProgress{Stage: PlanStageFinished, Tasks: tasks})
+	return tasks, nil
+}
+
+// streamPlanExecution plans and executes a plan-mode chat request, streaming
+// plan_progress events. It returns message extended with the plan results for
+// the assistant's final answer, or nil after sending an error event.
+func (a *Assistant) streamPlanExecution(ctx *gin.Context, userID int, sessionID, request string, message *genai.Content) *genai.Content {
+	cancelHeartbeat := startHeartbeat(ctx, 30*time.Second)
+	defer cancelHeartbeat()
+
+	// 并行执行的任务会并发上报进度，由 sendSSE 串行化写入
+	report := func(progress PlanProgress) {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		default:
+		}
+
+		if progress.Confirmation != nil {
+			sendSSE(ctx, "confirmation_required", progress.Confirmation)
+		}
+		sendSSE(ctx, "plan_progress", progress)
+	}
+
+	tasks, err := a.planExecutor.Run(ctx, userID, sessionID, request, report)
+	if err != nil {
+		slog.Error("failed to run plan", "err", err, "userID", userID, "sessionID", sessionID)
+		sendSSE(ctx, "error", gin.H{"error": err.Error()})
+		return nil
+	}
+
+	parts := append(slices.Clone(message.Parts), genai.NewPartFromText(buildPlanResultsContext(tasks)))
+	return genai.NewContentFromParts(parts, genai.RoleUser)
+}
+
+// plan runs the planner in a session of its own and returns the tasks it
+// created in the chat session.
+func (e *planExecutor) plan(ctx context.Context, userID int, sessionID, request string) ([]table.Task, error) {
+	var lastTask table.Task
+	if err := e.db.Where("session_id = ?", sessionID).Order("id DESC").Limit(1).Find(&lastTask).Error; err != nil {
+		slog.Error("failed to query existing tasks", "session_id", sessionID, "err", err)
+		return nil, fmt.Errorf("failed to query existing tasks: %w", err)
+	}
+
+	plannerSessionID := fmt.Sprintf("plan-%s-%d", sessionID, time.Now().UnixMilli())
+	if _, err := e.runOnce(ctx, e.planner, constant.AppNamePlanner, userID, plannerSessionID, request, nil); err != nil {
+		return nil, fmt.Errorf("planner failed: %w", err)
+	}
+
+	var tasks []table.Task
+	if err := e.db.Where("session_id = ? AND id > ?", sessionID, lastTask.ID).Order("id ASC").Find(&tasks).Error; err != nil {
+		slog.Error("failed to load planned tasks", "session_id", sessionID, "err", err)
+		return nil, fmt.Errorf("failed to load planned tasks: %w", err)
+	}
+	if len(tasks) == 0 {
+		return nil, errEmptyPlan
+	}
+	if len(tasks) > planMaxTasks {
+		return nil, fmt.Errorf("planner created %d tasks (max %d)", len(tasks), planMaxTasks)
+	}
+	return tasks, nil
+}
+
+// execute walks the dependency DAG. A task starts once all of its
+// dependencies completed and fails without running when one of them failed.
+// Dependencies outside the plan are ignored.
+func (e *planExecutor) execute(ctx context.Context, userID int, request string, tasks []table.Task, report PlanProgressReporter) []table.Task {
+	byID := make(map[int]*table.Task, len(tasks))
+	for i := range tasks {
+		byID[tasks[i].ID] = &tasks[i]
+	}
+	deps := make(map[int][]int, len(tasks))
+	for _, task := range tasks {
+		ids, err := parseTaskDependsOn(task.DependsOn)
+		if err != nil {
+			slog.Warn("invalid task dependencies, ignoring", "task_id", task.ID, "depends_on", task.DependsOn, "err", err)
+		}
+		for _, id := range ids {
+			if _, ok := byID[id]; ok && id != task.ID {
+				deps[task.ID] = append(deps[task.ID], id)
+			}
+		}
+	}
+
+	// Higher priority first, then creation order.
+	order := slices.Clone(tasks)
+	slices.SortStableFunc(order, func(a, b table.Task) int { return int(b.Priority) - int(a.Priority) })
+
+	done := make(chan planTaskOutcome)
+	running := 0
+	for {
+		// Failing a task can unblock the failure of its dependents, so scan
+		// until nothing changes.
+		for changed := true; changed; {
+			changed = false
+			for _, candidate := range order {
+				task := byID[candidate.ID]
+				if task.Status != constant.TaskStatusPending {
+					continue
+				}
+				ready, failedDep := true, 0
+				for _, dep := range deps[task.ID] {
+					switch byID[dep].Status {
+					case constant.TaskStatusCompleted:
+					case constant.TaskStatusFailed:
+						failedDep = dep
+					default:
+						ready = false
+					}
+				}
+				switch {
+				case failedDep != 0:
+					e.finishTask(task, constant.TaskStatusFailed, fmt.Sprintf("skipped: dependency %d failed", failedDep), report)
+					changed = true
+				case ctx.Err() != nil:
+					e.finishTask(task, constant.TaskStatusFailed, "cancelled", report)
+					changed = true
+				case ready && running < planMaxParallelTasks:
+					task.Status = constant.TaskStatusInProgress
+					running++
+					go func(task table.Task, inputs map[int]string) {
+						result, err := e.runTask(ctx, userID, request, task, inputs, report)
+						done <- planTaskOutcome{taskID: task.ID, result: result, err: err}
+					}(*task, dependencyResults(byID, deps[task.ID]))
+				}
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		outcome := <-done
+		running--
+		if outcome.err != nil {
+			e.finishTask(byID[outcome.taskID], constant.TaskStatusFailed, outcome.err.Error(), report)
+		} else {
+			e.finishTask(byID[outcome.taskID], constant.TaskStatusCompleted, outcome.result, report)
+		}
+	}
+
+	// Whatever is still pending waits on itself through a cycle.
+	for i := range tasks {
+		if tasks[i].Status == constant.TaskStatusPending {
+			e.finishTask(&tasks[i], constant.TaskStatusFailed, "skipped: dependency cycle", report)
+		}
+	}
+	return tasks
+}
+
+// dependencyResults collects the results of the given completed tasks.
+func dependencyResults(byID map[int]*table.Task, ids []int) map[int]string {
+	results := make(map[int]string, len(ids))
+	for _, id := range ids {
+		results[id] = byID[id].Result
+	}
+	return results
+}
+
+// runTask runs one task, retrying failed attempts.
+func (e *planExecutor) runTask(ctx context.Context, userID int, request string, task table.Task, inputs map[int]string, report PlanProgressReporter) (string, error) {
+	prompt := buildPlanTaskPrompt(request, task, inputs)
+	var lastErr error
+	for attempt := 1; attempt <= planTaskMaxAttempts; attempt++ {
+		if err := e.db.Model(&table.Task{}).Where("id = ?", task.ID).Update("status", constant.TaskStatusInProgress).Error; err != nil {
+			slog.Error("failed to mark task in progress", "task_id", task.ID, "err", err)
+		}
+		report(PlanProgress{Stage: PlanStageTaskStarted, TaskID: task.ID, Title: task.Title, Status: constant.TaskStatusInProgress, Attempt: attempt})
+
+		taskCtx, cancel := context.WithTimeout(ctx, planTaskTimeout)
+		sessionID := fmt.Sprintf("plan-task-%d-%d-%d", task.ID, attempt, time.Now().UnixMilli())
+		confirm := func(author string, pending *pendingConfirmation) (toolconfirmation.ToolConfirmation, error) {
+			return e.awaitConfirmation(taskCtx, userID, task, attempt, author, pending, report)
+		}
+		result, err := e.runOnce(taskCtx, e.executor, constant.AppNameScheduler, userID, sessionID, prompt, confirm)
+		cancel()
+		if err == nil && strings.TrimSpace(result) == "" {
+			err = errors.New("task produced no result")
+		}
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+		slog.Warn("plan task attempt failed", "task_id", task.ID, "attempt", attempt, "err", err)
+		if attempt < planTaskMaxAttempts && ctx.Err() == nil {
+			report(PlanProgress{Stage: PlanStageTaskRetrying, TaskID: task.ID, Title: task.Title, Status: constant.TaskStatusInProgress, Attempt: attempt, Message: err.Error()})
+			continue
+		}
+		break
+	}
+	return "", lastErr
+}
+
+// finishTask records the final status and result of a task.
+func (e *planExecutor) finishTask(task *table.Task, status constant.TaskStatus, result string, report PlanProgressReporter) {
+	task.Status = status
+	task.Result = result
+	if err := e.db.Model(&table.Task{}).Where("id = ?", task.ID).
+		Updates(map[string]any{"status": status, "result": result}).Error; err != nil {
+		slog.Error("failed to save task result", "task_id", task.ID, "err", err)
+	}
+
+	stage := PlanStageTaskCompleted
+	if status == constant.TaskStatusFailed {
+		stage = PlanStageTaskFailed
+	}
+	report(PlanProgress{Stage: stage, TaskID: task.ID, Title: task.Title, Status: status, Result: truncateRunes(result, planResultMaxChars)})
+}
+
+// planConfirmFunc answers a confirmation request raised during a plan run.
+type planConfirmFunc func(author string, pending *pendingConfirmation) (toolconfirmation.ToolConfirmation, error)
+
+// runOnce runs message in a new session of r and returns the last text the
+// agents produced. When the run pauses for tool confirmations, confirm
+// answers each of them and the run resumes with the decisions; without
+// confirm a paused run fails.
+func (e *planExecutor) runOnce(ctx context.Context, r *runner.Runner, appName constant.AppName, userID int, sessionID, message string, confirm planConfirmFunc) (string, error) {
+	userIDStr := strconv.Itoa(userID)
+	if _, err := e.session.Create(ctx, &session.CreateRequest{
+		AppName:   appName.String(),
+		UserID:    userIDStr,
+		SessionID: sessionID,
+		State:     map[string]any{},
+	}); err != nil {
+		slog.Error("failed to create plan session", "app_name", appName, "session_id", sessionID, "err", err)
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	content := genai.NewContentFromText(message, genai.RoleUser)
+	runConfig := agent.RunConfig{StreamingMode: agent.StreamingModeNone}
+	var lastText string
+	for content != nil {
+		var responses []*genai.Part
+		for event, err := range r.Run(ctx, userIDStr, sessionID, content, runConfig) {
+			if err != nil {
+				return "", err
+			}
+			if event == nil || event.LLMResponse.Content == nil || event.Partial {
+				continue
+			}
+			var text strings.Builder
+			for _, part := range event.LLMResponse.Content.Parts {
+				if part.Text != "" && !part.Thought {
+					text.WriteString(part.Text)
+				}
+				pending, ok := parseConfirmationCall(part.FunctionCall)
+				if !ok {
+					continue
+				}
+				if confirm == nil {
+					return "", fmt.Errorf("%s requires confirmation", pending.OriginalCall.Name)
+				}
+				confirmation, err := confirm(event.Author, pending)
+				if err != nil {
+					return "", err
+				}
+				response, err := toConfirmationResponse(confirmation)
+				if err != nil {
+					return "", fmt.Errorf("failed to encode confirmation: %w", err)
+				}
+				responses = append(responses, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+					ID:       pending.ID,
+					Name:     toolconfirmation.FunctionCallName,
+					Response: response,
+				}})
+			}
+			if text.Len() > 0 {
+				lastText = text.String()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		content = nil
+		if len(responses) > 0 {
+			content = genai.NewContentFromParts(responses, genai.RoleUser)
+		}
+	}
+	return lastText, nil
+}
+
+// awaitConfirmation reports a task's confirmation request on the plan stream
+// and waits for the user's decision.
+func (e *planExecutor) awaitConfirmation(ctx context.Context, userID int, task table.Task, attempt int, author string, pending *pendingConfirmation, report PlanProgressReporter) (toolconfirmation.ToolConfirmation, error) {
+	chatSessionID, _ := ctx.Value(constant.ContextKeySessionID).(string)
+	waiter := &planConfirmation{
+		userID:    userID,
+		sessionID: chatSessionID,
+		pending:   pending,
+		decision:  make(chan toolconfirmation.ToolConfirmation, 1),
+	}
+	e.mu.Lock()
+	if e.confirmations == nil {
+		e.confirmations = make(map[string]*planConfirmation)
+	}
+	e.confirmations[pending.ID] = waiter
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.confirmations, pending.ID)
+		e.mu.Unlock()
+	}()
+
+	event := confirmationRequiredEvent(middleware.GetLocale(ctx), author, pending)
+	event["task_id"] = task.ID
+	slog.Info("plan task waiting for tool confirmation", "task_id", task.ID, "tool", pending.OriginalCall.Name)
+	report(PlanProgress{Stage: PlanStageTaskConfirm, TaskID: task.ID, Title: task.Title, Status: constant.TaskStatusInProgress, Attempt: attempt, Confirmation: event})
+
+	select {
+	case confirmation := <-waiter.decision:
+		return confirmation, nil
+	case <-ctx.Done():
+		return toolconfirmation.ToolConfirmation{}, fmt.Errorf("no decision on the %s call: %w", pending.OriginalCall.Name, ctx.Err())
+	}
+}
+
+// resolveConfirmation hands the user's decision to the plan task waiting on
+// confirmationID. It reports false when no task of the user's chat session is
+// waiting on it.
+func (e *planExecutor) resolveConfirmation(userID int, sessionID, confirmationID string, req ToolConfirmationRequest) bool {
+	e.mu.Lock()
+	waiter, ok := e.confirmations[confirmationID]
+	if ok && (waiter.userID != userID || waiter.sessionID != sessionID) {
+		ok = false
+	}
+	if ok {
+		delete(e.confirmations, confirmationID)
+	}
+	e.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	slog.Info("resolving plan task tool confirmation", "session_id", sessionID, "tool", waiter.pending.OriginalCall.Name, "decision", req.Decision)
+	waiter.decision <- newToolConfirmation(req, waiter.pending.Hint)
+	return true
+}
+
+// buildPlanTaskPrompt tells the executor which task of the plan to carry out
+// and hands it the results of the tasks it depends on.
+func buildPlanTaskPrompt(request string, task table.Task, inputs map[int]string) string {
+	var sb strings.Builder
+	sb.WriteString("You are carrying out one task of a plan made for the user's request below. ")
+	sb.WriteString("Complete only this task with the tools you need and reply with its result. ")
+	sb.WriteString("Its status is recorded automatically, do not call task_update.\n\n")
+	fmt.Fprintf(&sb, "## User request\n%s\n\n", request)
+	fmt.Fprintf(&sb, "## Task %d: %s\n%s\n", task.ID, task.Title, task.Description)
+	if len(inputs) > 0 {
+		ids := make([]int, 0, len(inputs))
+		for id := range inputs {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		sb.WriteString("\n## Results of the tasks this one depends on\n")
+		for _, id := range ids {
+			fmt.Fprintf(&sb, "### Task %d\n%s\n", id, truncateRunes(inputs[id], planResultMaxChars))
+		}
+	}
+	return sb.String()
+}
+
+// buildPlanResultsContext formats the executed plan for the assistant's final
+// answer. Like <user_context>, the block is stripped from the chat history.
+func buildPlanResultsContext(tasks []table.Task) string {
+	var sb strings.Builder
+	sb.WriteString("<plan_results>\n")
+	sb.WriteString("The request was split into the tasks below, which have already been executed. ")
+	sb.WriteString("Answer the request from these results without redoing the work, and mention tasks that failed.\n")
+	for _, task := range tasks {
+		fmt.Fprintf(&sb, "\n### Task %d [%s]: %s\n%s\n", task.ID, task.Status, task.Title, truncateRunes(task.Result, planResultMaxChars))
+	}
+	sb.WriteString("</plan_results>\n")
+	return sb.String()
+}
+
+// parseTaskDependsOn decodes the Task.DependsOn JSON array.
+func parseTaskDependsOn(raw string) ([]int, error) {
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	var ids []int
+	if err := json.Unmarshal([]byte(raw), &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
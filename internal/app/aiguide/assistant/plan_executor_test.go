@@ -0,0 +1,279 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"google.golang.org/genai"
+)
+
+var planTaskTitlePattern = regexp.MustCompile(`## Task \d+: (.+)`)
+
+// newFakeExecutorRunner returns a runner whose agent answers "done <title>",
+// fails tasks titled "broken" and fails the first attempt of "flaky".
+func newFakeExecutorRunner(t *testing.T, svc session.Service, prompts map[string]string) *runner.Runner {
+	t.Helper()
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	return newScriptedRunner(t, svc, constant.AppNameScheduler, func(ctx agent.InvocationContext) ([]model.LLMResponse, error) {
+		prompt := ctx.UserContent().Parts[0].Text
+		title := planTaskTitlePattern.FindStringSubmatch(prompt)[1]
+
+		mu.Lock()
+		attempts[title]++
+		attempt := attempts[title]
+		prompts[title] = prompt
+		mu.Unlock()
+
+		if title == "broken" || (title == "flaky" && attempt == 1) {
+			return nil, errors.New("tool failed")
+		}
+		return []model.LLMResponse{{Content: genai.NewContentFromText("done "+title, genai.RoleModel)}}, nil
+	})
+}
+
+func TestPlanExecutorWalksDependencies(t *testing.T) {
+	db := setupTestDB(t)
+	svc := session.InMemoryService()
+	prompts := map[string]string{}
+	e := &planExecutor{db: db, session: svc, executor: newFakeExecutorRunner(t, svc, prompts)}
+
+	create := func(title string, dependsOn ...int) table.Task {
+		deps := "[]"
+		if len(dependsOn) > 0 {
+			deps = strings.ReplaceAll(fmt.Sprint(dependsOn), " ", ",")
+		}
+		task := table.Task{SessionID: "s1", Title: title, Status: constant.TaskStatusPending, DependsOn: deps}
+		if err := db.Create(&task).Error; err != nil {
+			t.Fatalf("db.Create() error = %v", err)
+		}
+		return task
+	}
+	research := create("research")
+	flaky := create("flaky")
+	report := create("report", research.ID, flaky.ID)
+	broken := create("broken")
+	publish := create("publish", broken.ID)
+	cleanup := create("cleanup", publish.ID)
+
+	var mu sync.Mutex
+	var stages []string
+	tasks := e.execute(context.Background(), 1, "write a report", []table.Task{research, flaky, report, broken, publish, cleanup}, func(p PlanProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		stages = append(stages, p.Stage)
+	})
+
+	want := map[string]constant.TaskStatus{
+		"research": constant.TaskStatusCompleted,
+		"flaky":    constant.TaskStatusCompleted,
+		"report":   constant.TaskStatusCompleted,
+		"broken":   constant.TaskStatusFailed,
+		"publish":  constant.TaskStatusFailed,
+		"cleanup":  constant.TaskStatusFailed,
+	}
+	for _, task := range tasks {
+		if task.Status != want[task.Title] {
+			t.Errorf("task %q status = %s, want %s (result %q)", task.Title, task.Status, want[task.Title], task.Result)
+		}
+		var stored table.Task
+		if err := db.First(&stored, task.ID).Error; err != nil {
+			t.Fatalf("db.First() error = %v", err)
+		}
+		if stored.Status != task.Status || stored.Result != task.Result {
+			t.Errorf("stored task %q = %s %q, want %s %q", task.Title, stored.Status, stored.Result, task.Status, task.Result)
+		}
+	}
+
+	if !strings.Contains(prompts["report"], "done research") || !strings.Contains(prompts["report"], "done flaky") {
+		t.Errorf("report prompt lacks dependency results:\n%s", prompts["report"])
+	}
+	if _, ran := prompts["publish"]; ran {
+		t.Error("publish ran although its dependency failed")
+	}
+	if !strings.Contains(tasks[4].Result, fmt.Sprintf("dependency %d failed", broken.ID)) {
+		t.Errorf("publish result = %q", tasks[4].Result)
+	}
+	if !strings.Contains(strings.Join(stages, ","), PlanStageTaskRetrying) {
+		t.Errorf("stages = %v, want a retry", stages)
+	}
+}
+
+func TestPlanExecutorFailsDependencyCycle(t *testing.T) {
+	db := setupTestDB(t)
+	svc := session.InMemoryService()
+	e := &planExecutor{db: db, session: svc, executor: newFakeExecutorRunner(t, svc, map[string]string{})}
+
+	first := table.Task{SessionID: "s1", Title: "first", Status: constant.TaskStatusPending}
+	second := table.Task{SessionID: "s1", Title: "second", Status: constant.TaskStatusPending}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+	second.DependsOn = fmt.Sprintf("[%d]", first.ID)
+	if err := db.Create(&second).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+	first.DependsOn = fmt.Sprintf("[%d]", second.ID)
+
+	tasks := e.execute(context.Background(), 1, "loop", []table.Task{first, second}, func(PlanProgress) {})
+	for _, task := range tasks {
+		if task.Status != constant.TaskStatusFailed || task.Result != "skipped: dependency cycle" {
+			t.Errorf("task %q = %s %q, want failed by cycle", task.Title, task.Status, task.Result)
+		}
+	}
+}
+
+func TestStripInjectedContextRemovesPlanResults(t *testing.T) {
+	text := "Compare the offers\n" + buildPlanResultsContext([]table.Task{{Model: table.Model{ID: 1}, Title: "search", Status: constant.TaskStatusCompleted, Result: "found 3"}})
+	if got := stripInjectedContext(text); got != "Compare the offers\n" {
+		t.Fatalf("stripInjectedContext() = %q", got)
+	}
+}
+
+// confirmingModel asks to send an email and, once the send_email response is
+// in the history, replies with it.
+type confirmingModel struct{}
+
+func (confirmingModel) Name() string { return "confirming" }
+
+func (confirmingModel) GenerateContent(_ context.Context, req *model.LLMRequest, _ bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		last := req.Contents[len(req.Contents)-1]
+		for _, part := range last.Parts {
+			if part.FunctionResponse != nil && part.FunctionResponse.Name == "send_email" {
+				yield(&model.LLMResponse{Content: genai.NewContentFromText(fmt.Sprint("sent ", part.FunctionResponse.Response), genai.RoleModel)}, nil)
+				return
+			}
+		}
+		call := &genai.FunctionCall{ID: "call-1", Name: "send_email", Args: map[string]any{"to": "bob@example.com"}}
+		yield(&model.LLMResponse{Content: genai.NewContentFromFunctionCall(call.Name, call.Args, genai.RoleModel)}, nil)
+	}
+}
+
+// newConfirmingRunner returns a runner of app whose agent calls send_email
+// under the confirmation mode and records the recipients it sent to.
+// newFakeSendEmailTool returns a send_email tool that records the recipients
+// in sentTo instead of sending anything.
+func newFakeSendEmailTool(t *testing.T, sentTo *[]string) tool.Tool {
+	t.Helper()
+	sendEmail, err := functiontool.New(functiontool.Config{Name: "send_email", Description: "Send an email"},
+		func(_ tool.Context, input struct {
+			To string `json:"to"`
+		}) (map[string]any, error) {
+			*sentTo = append(*sentTo, input.To)
+			return map[string]any{"success": true}, nil
+		})
+	if err != nil {
+		t.Fatalf("functiontool.New() error = %v", err)
+	}
+	return sendEmail
+}
+
+func newConfirmingRunner(t *testing.T, svc session.Service, app constant.AppName, mode tools.ConfirmationMode, sentTo *[]string) *runner.Runner {
+	t.Helper()
+
+	executor, err := llmagent.New(llmagent.Config{
+		Name:                "executor",
+		Model:               confirmingModel{},
+		Tools:               []tool.Tool{newFakeSendEmailTool(t, sentTo)},
+		BeforeToolCallbacks: confirmationCallbacks(mode),
+	})
+	if err != nil {
+		t.Fatalf("llmagent.New() error = %v", err)
+	}
+	r, err := runner.New(runner.Config{AppName: app.String(), Agent: executor, SessionService: svc})
+	if err != nil {
+		t.Fatalf("runner.New() error = %v", err)
+	}
+	return r
+}
+
+func TestPlanExecutorWaitsForToolConfirmation(t *testing.T) {
+	db := setupTestDB(t)
+	svc := session.InMemoryService()
+	var sentTo []string
+	e := &planExecutor{db: db, session: svc, executor: newConfirmingRunner(t, svc, constant.AppNameScheduler, tools.ConfirmationAsk, &sentTo)}
+
+	task := table.Task{SessionID: "s1", Title: "notify bob", Status: constant.TaskStatusPending}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+
+	var confirmations []gin.H
+	ctx := context.WithValue(context.Background(), constant.ContextKeySessionID, "s1")
+	tasks := e.execute(ctx, 1, "tell bob", []table.Task{task}, func(p PlanProgress) {
+		if p.Stage != PlanStageTaskConfirm {
+			return
+		}
+		confirmations = append(confirmations, p.Confirmation)
+		id, _ := p.Confirmation["confirmation_id"].(string)
+		// Another user or chat session cannot answer the request.
+		if e.resolveConfirmation(2, "s1", id, ToolConfirmationRequest{Decision: ToolConfirmationApprove}) ||
+			e.resolveConfirmation(1, "s2", id, ToolConfirmationRequest{Decision: ToolConfirmationApprove}) {
+			t.Errorf("resolveConfirmation() accepted a decision from another session")
+		}
+		edit := ToolConfirmationRequest{SessionID: "s1", Decision: ToolConfirmationEdit, Args: map[string]any{"to": "carol@example.com"}}
+		if !e.resolveConfirmation(1, "s1", id, edit) {
+			t.Errorf("resolveConfirmation() = false, want the waiting task")
+		}
+	})
+
+	if len(confirmations) != 1 || confirmations[0]["tool_name"] != "send_email" || confirmations[0]["task_id"] != task.ID {
+		t.Fatalf("confirmations = %v, want one send_email request for the task", confirmations)
+	}
+	if len(sentTo) != 1 || sentTo[0] != "carol@example.com" {
+		t.Fatalf("sentTo = %v, want the edited recipient", sentTo)
+	}
+	if tasks[0].Status != constant.TaskStatusCompleted || !strings.Contains(tasks[0].Result, "sent") {
+		t.Fatalf("task = %s %q, want completed after confirmation", tasks[0].Status, tasks[0].Result)
+	}
+}
+
+func TestPlanExecutorFailsUnansweredConfirmation(t *testing.T) {
+	db := setupTestDB(t)
+	svc := session.InMemoryService()
+	var sentTo []string
+	e := &planExecutor{db: db, session: svc, executor: newConfirmingRunner(t, svc, constant.AppNameScheduler, tools.ConfirmationAsk, &sentTo)}
+
+	task := table.Task{SessionID: "s1", Title: "notify bob", Status: constant.TaskStatusPending}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+
+	// The user leaves without answering: the stream's context ends.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), constant.ContextKeySessionID, "s1"))
+	defer cancel()
+	tasks := e.execute(ctx, 1, "tell bob", []table.Task{task}, func(p PlanProgress) {
+		if p.Stage == PlanStageTaskConfirm {
+			cancel()
+		}
+	})
+
+	if len(sentTo) != 0 {
+		t.Fatalf("sentTo = %v, want no email without confirmation", sentTo)
+	}
+	if tasks[0].Status != constant.TaskStatusFailed || !strings.Contains(tasks[0].Result, "no decision") {
+		t.Fatalf("task = %s %q, want failed without a decision", tasks[0].Status, tasks[0].Result)
+	}
+	if len(e.confirmations) != 0 {
+		t.Fatalf("confirmations = %v, want none left waiting", e.confirmations)
+	}
+}
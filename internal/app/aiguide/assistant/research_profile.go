@@ -0,0 +1,356 @@
+package assistant
+
+import (
+	"aiguide/internal/pkg/constant"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+)
+
+// ResearchProfile controls how much work a single deep research run may do.
+type ResearchProfile struct {
+	Name string
+	// ResearcherCount is how many of the parallel researchers take part,
+	// in the order breadth → depth → verify.
+	ResearcherCount int
+	// MaxSearchCalls caps web_search + exa_search calls per researcher.
+	MaxSearchCalls int
+	// MaxFetchCalls caps web_fetch calls per researcher.
+	MaxFetchCalls int
+	// TimeBudget is the wall-clock budget for planning and researching,
+	// measured from the moment research_planner starts.
+	TimeBudget time.Duration
+}
+
+const (
+	ResearchProfileQuick      = "quick"
+	ResearchProfileStandard   = "standard"
+	ResearchProfileExhaustive = "exhaustive"
+
+	defaultResearchProfile = ResearchProfileStandard
+)
+
+var researchProfiles = map[string]ResearchProfile{
+	ResearchProfileQuick: {
+		Name:            ResearchProfileQuick,
+		ResearcherCount: 1,
+		MaxSearchCalls:  4,
+		MaxFetchCalls:   2,
+		TimeBudget:      3 * time.Minute,
+	},
+	ResearchProfileStandard: {
+		Name:            ResearchProfileStandard,
+		ResearcherCount: 3,
+		MaxSearchCalls:  8,
+		MaxFetchCalls:   5,
+		TimeBudget:      8 * time.Minute,
+	},
+	ResearchProfileExhaustive: {
+		Name:            ResearchProfileExhaustive,
+		ResearcherCount: 3,
+		MaxSearchCalls:  20,
+		MaxFetchCalls:   12,
+		TimeBudget:      20 * time.Minute,
+	},
+}
+
+// lookupResearchProfile returns the named profile. An empty name resolves to
+// the default profile.
+func lookupResearchProfile(name string) (ResearchProfile, bool) {
+	if name == "" {
+		name = defaultResearchProfile
+	}
+	p, ok := researchProfiles[name]
+	return p, ok
+}
+
+// ValidResearchProfile reports whether name is empty or a known profile.
+func ValidResearchProfile(name string) bool {
+	_, ok := lookupResearchProfile(name)
+	return ok
+}
+
+// Research progress stages sent to the client as "research_progress" events.
+const (
+	researchStageStarted         = "started"
+	researchStageSkipped         = "researcher_skipped"
+	researchStageBudgetExhausted = "budget_exhausted"
+	researchStageWritingReport   = "writing_report"
+)
+
+// ResearchProgress is emitted while a deep research run is in flight so the UI
+// can show which profile is active and how much of the budget has been used.
+type ResearchProgress struct {
+	Stage          string `json:"stage"`
+	Profile        string `json:"profile"`
+	Agent          string `json:"agent,omitempty"`
+	SearchCalls    int    `json:"search_calls,omitempty"`
+	MaxSearchCalls int    `json:"max_search_calls"`
+	FetchCalls     int    `json:"fetch_calls,omitempty"`
+	MaxFetchCalls  int    `json:"max_fetch_calls"`
+	ElapsedSeconds int    `json:"elapsed_seconds"`
+	BudgetSeconds  int    `json:"budget_seconds"`
+	Message        string `json:"message,omitempty"`
+}
+
+// ResearchProgressReporter receives research progress updates.
+type ResearchProgressReporter func(ResearchProgress)
+
+// ContextKeyResearchProgressReporter is the context key under which the chat
+// handler stores a ResearchProgressReporter.
+const ContextKeyResearchProgressReporter = "research_progress_reporter"
+
+func reportResearchProgress(ctx context.Context, progress ResearchProgress) {
+	if ctx == nil {
+		return
+	}
+	reporter, ok := ctx.Value(ContextKeyResearchProgressReporter).(ResearchProgressReporter)
+	if !ok || reporter == nil {
+		return
+	}
+	reporter(progress)
+}
+
+// researchBudget tracks usage for one deep research invocation.
+type researchBudget struct {
+	profile   ResearchProfile
+	startedAt time.Time
+
+	mu          sync.Mutex
+	searchCalls map[string]int
+	fetchCalls  map[string]int
+	exhausted   map[string]bool // researchers that ran out of budget
+	skipped     map[string]bool // researchers left out by the profile
+}
+
+func (b *researchBudget) progress(stage, agentName, message string) ResearchProgress {
+	return ResearchProgress{
+		Stage:          stage,
+		Profile:        b.profile.Name,
+		Agent:          agentName,
+		SearchCalls:    b.searchCalls[agentName],
+		MaxSearchCalls: b.profile.MaxSearchCalls,
+		FetchCalls:     b.fetchCalls[agentName],
+		MaxFetchCalls:  b.profile.MaxFetchCalls,
+		ElapsedSeconds: int(time.Since(b.startedAt).Seconds()),
+		BudgetSeconds:  int(b.profile.TimeBudget.Seconds()),
+		Message:        message,
+	}
+}
+
+// researchBudgetRetention is how long a budget is kept past its time budget
+// for the report writer. A run that ends without reaching the writer, e.g.
+// because it was cancelled or failed, leaves its budget behind; the next run
+// sweeps budgets older than that.
+const researchBudgetRetention = 30 * time.Minute
+
+func (b *researchBudget) timeExhausted() bool {
+	return time.Since(b.startedAt) >= b.profile.TimeBudget
+}
+
+// researchBudgetTracker enforces research profiles across the callbacks of
+// the deep research pipeline. Budgets are keyed by invocation ID so that
+// concurrent chats do not share counters.
+type researchBudgetTracker struct {
+	defaultProfile string
+	researchers    []string
+
+	mu      sync.Mutex
+	budgets map[string]*researchBudget
+}
+
+func newResearchBudgetTracker(defaultProfile string, researchers []string) *researchBudgetTracker {
+	return &researchBudgetTracker{
+		defaultProfile: defaultProfile,
+		researchers:    researchers,
+		budgets:        make(map[string]*researchBudget),
+	}
+}
+
+func (t *researchBudgetTracker) get(invocationID string) *researchBudget {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.budgets[invocationID]
+}
+
+// resolveProfile picks the profile requested for this run, falling back to
+// the configured default and finally to the built-in default.
+func (t *researchBudgetTracker) resolveProfile(ctx context.Context) ResearchProfile {
+	if name, ok := ctx.Value(constant.ContextKeyResearchProfile).(string); ok && name != "" {
+		if p, ok := lookupResearchProfile(name); ok {
+			return p
+		}
+		slog.Warn("unknown research profile, using default", "profile", name)
+	}
+	if p, ok := lookupResearchProfile(t.defaultProfile); ok {
+		return p
+	}
+	p, _ := lookupResearchProfile("")
+	return p
+}
+
+func (t *researchBudgetTracker) researcherIndex(name string) int {
+	for i, r := range t.researchers {
+		if r == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// startRun is the research_planner BeforeAgentCallback. It creates the budget
+// for this invocation.
+func (t *researchBudgetTracker) startRun(ctx agent.CallbackContext) (*genai.Content, error) {
+	profile := t.resolveProfile(ctx)
+	budget := &researchBudget{
+		profile:     profile,
+		startedAt:   time.Now(),
+		searchCalls: make(map[string]int),
+		fetchCalls:  make(map[string]int),
+		exhausted:   make(map[string]bool),
+		skipped:     make(map[string]bool),
+	}
+
+	t.mu.Lock()
+	for id, b := range t.budgets {
+		if time.Since(b.startedAt) > b.profile.TimeBudget+researchBudgetRetention {
+			delete(t.budgets, id)
+		}
+	}
+	t.budgets[ctx.InvocationID()] = budget
+	t.mu.Unlock()
+
+	slog.Info("deep research started", "profile", profile.Name, "invocation_id", ctx.InvocationID())
+	reportResearchProgress(ctx, budget.progress(researchStageStarted, "", fmt.Sprintf(
+		"%d researcher(s), %d searches and %d fetches each, %s budget",
+		profile.ResearcherCount, profile.MaxSearchCalls, profile.MaxFetchCalls, profile.TimeBudget)))
+	return nil, nil
+}
+
+// beforeResearcherModel is the researchers' BeforeModelCallback. It skips
+// researchers that are not part of the profile, stops researchers once the
+// time budget runs out, and tells the model what budget it has left.
+func (t *researchBudgetTracker) beforeResearcherModel(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+	budget := t.get(ctx.InvocationID())
+	if budget == nil {
+		return nil, nil
+	}
+	name := ctx.AgentName()
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	if idx := t.researcherIndex(name); idx >= budget.profile.ResearcherCount {
+		if !budget.skipped[name] {
+			budget.skipped[name] = true
+			reportResearchProgress(ctx, budget.progress(researchStageSkipped, name, "not part of this research profile"))
+		}
+		return &model.LLMResponse{
+			Content: genai.NewContentFromText("Skipped by the "+budget.profile.Name+" research profile.", genai.RoleModel),
+		}, nil
+	}
+
+	if budget.timeExhausted() {
+		if !budget.exhausted[name] {
+			budget.exhausted[name] = true
+			reportResearchProgress(ctx, budget.progress(researchStageBudgetExhausted, name, "time budget exhausted"))
+		}
+		return &model.LLMResponse{
+			Content: genai.NewContentFromText("Research time budget exhausted; handing findings collected so far to the report writer.", genai.RoleModel),
+		}, nil
+	}
+
+	remaining := budget.profile.TimeBudget - time.Since(budget.startedAt)
+	note := fmt.Sprintf("\n\n## Budget\n\nResearch profile: %s. You may call web_search/exa_search at most %d times (used %d) and web_fetch at most %d times (used %d). About %d seconds remain. Stay within the budget and summarize your findings before it runs out.",
+		budget.profile.Name,
+		budget.profile.MaxSearchCalls, budget.searchCalls[name],
+		budget.profile.MaxFetchCalls, budget.fetchCalls[name],
+		int(remaining.Seconds()))
+	appendSystemInstruction(req, note)
+	return nil, nil
+}
+
+// beforeResearcherTool is the researchers' BeforeToolCallback. Calls beyond
+// the per-researcher limits are short-circuited with an error result that
+// asks the model to wrap up.
+func (t *researchBudgetTracker) beforeResearcherTool(ctx tool.Context, tl tool.Tool, _ map[string]any) (map[string]any, error) {
+	budget := t.get(ctx.InvocationID())
+	if budget == nil {
+		return nil, nil
+	}
+	name := ctx.AgentName()
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+
+	var counter map[string]int
+	var limit int
+	switch tl.Name() {
+	case "web_search", "exa_search":
+		counter, limit = budget.searchCalls, budget.profile.MaxSearchCalls
+	case "web_fetch":
+		counter, limit = budget.fetchCalls, budget.profile.MaxFetchCalls
+	default:
+		return nil, nil
+	}
+
+	if counter[name] >= limit || budget.timeExhausted() {
+		if !budget.exhausted[name] {
+			budget.exhausted[name] = true
+			reportResearchProgress(ctx, budget.progress(researchStageBudgetExhausted, name, tl.Name()+" budget exhausted"))
+		}
+		return map[string]any{
+			"error": fmt.Sprintf("research budget exhausted for %s (profile %s). Do not call more tools; summarize the findings you already have.", tl.Name(), budget.profile.Name),
+		}, nil
+	}
+
+	counter[name]++
+	return nil, nil
+}
+
+// startReport is the report_writer BeforeAgentCallback.
+func (t *researchBudgetTracker) startReport(ctx agent.CallbackContext) (*genai.Content, error) {
+	budget := t.get(ctx.InvocationID())
+	if budget == nil {
+		return nil, nil
+	}
+
+	budget.mu.Lock()
+	message := "research complete, writing report"
+	if len(budget.exhausted) > 0 {
+		message = "budget exhausted, writing report"
+	}
+	progress := budget.progress(researchStageWritingReport, ctx.AgentName(), message)
+	budget.mu.Unlock()
+
+	reportResearchProgress(ctx, progress)
+	return nil, nil
+}
+
+// finishRun is the report_writer AfterAgentCallback. It releases the budget;
+// budgets of runs that never get here are swept by startRun.
+func (t *researchBudgetTracker) finishRun(ctx agent.CallbackContext) (*genai.Content, error) {
+	t.mu.Lock()
+	delete(t.budgets, ctx.InvocationID())
+	t.mu.Unlock()
+	return nil, nil
+}
+
+// appendSystemInstruction adds text to the request's system instruction.
+func appendSystemInstruction(req *model.LLMRequest, text string) {
+	if req.Config == nil {
+		req.Config = &genai.GenerateContentConfig{}
+	}
+	if req.Config.SystemInstruction == nil {
+		req.Config.SystemInstruction = genai.NewContentFromText(text, genai.RoleUser)
+		return
+	}
+	req.Config.SystemInstruction.Parts = append(req.Config.SystemInstruction.Parts, genai.NewPartFromText(text))
+}
@@ -0,0 +1,168 @@
+package assistant
+
+import (
+	"aiguide/internal/pkg/constant"
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+)
+
+// researchTestContext is a tool.Context (and therefore agent.CallbackContext)
+// with a fixed invocation ID and agent name.
+type researchTestContext struct {
+	liveToolContext
+	invocationID string
+	agentName    string
+}
+
+func (c *researchTestContext) InvocationID() string { return c.invocationID }
+func (c *researchTestContext) AgentName() string    { return c.agentName }
+
+type namedTestTool struct{ name string }
+
+func (t namedTestTool) Name() string        { return t.name }
+func (t namedTestTool) Description() string { return "" }
+func (t namedTestTool) IsLongRunning() bool { return false }
+
+var _ tool.Tool = namedTestTool{}
+
+func newResearchTestContext(ctx context.Context, agentName string) *researchTestContext {
+	return &researchTestContext{
+		liveToolContext: liveToolContext{Context: ctx},
+		invocationID:    "inv-1",
+		agentName:       agentName,
+	}
+}
+
+func TestLookupResearchProfile(t *testing.T) {
+	p, ok := lookupResearchProfile("")
+	if !ok || p.Name != ResearchProfileStandard {
+		t.Fatalf("lookupResearchProfile(\"\") = %q, %v; want standard", p.Name, ok)
+	}
+	if !ValidResearchProfile(ResearchProfileQuick) || !ValidResearchProfile(ResearchProfileExhaustive) {
+		t.Fatal("expected quick and exhaustive to be valid")
+	}
+	if ValidResearchProfile("bogus") {
+		t.Fatal("expected bogus profile to be invalid")
+	}
+}
+
+func TestResearchBudgetTracker_ToolLimits(t *testing.T) {
+	var progress []ResearchProgress
+	base := context.WithValue(context.Background(), constant.ContextKeyResearchProfile, ResearchProfileQuick)
+	base = context.WithValue(base, ContextKeyResearchProgressReporter, ResearchProgressReporter(func(p ResearchProgress) {
+		progress = append(progress, p)
+	}))
+
+	tracker := newResearchBudgetTracker("", []string{"researcher_breadth", "researcher_depth", "researcher_verify"})
+	if _, err := tracker.startRun(newResearchTestContext(base, "research_planner")); err != nil {
+		t.Fatalf("startRun() error = %v", err)
+	}
+
+	ctx := newResearchTestContext(base, "researcher_breadth")
+	quick := researchProfiles[ResearchProfileQuick]
+	for i := 0; i < quick.MaxFetchCalls; i++ {
+		result, err := tracker.beforeResearcherTool(ctx, namedTestTool{name: "web_fetch"}, nil)
+		if err != nil || result != nil {
+			t.Fatalf("call %d: beforeResearcherTool() = %v, %v; want pass-through", i, result, err)
+		}
+	}
+
+	result, err := tracker.beforeResearcherTool(ctx, namedTestTool{name: "web_fetch"}, nil)
+	if err != nil {
+		t.Fatalf("beforeResearcherTool() error = %v", err)
+	}
+	if result == nil || result["error"] == nil {
+		t.Fatalf("expected budget error after %d fetches, got %v", quick.MaxFetchCalls, result)
+	}
+
+	// Searches have their own counter and are still allowed.
+	if result, _ := tracker.beforeResearcherTool(ctx, namedTestTool{name: "web_search"}, nil); result != nil {
+		t.Fatalf("web_search should still be allowed, got %v", result)
+	}
+
+	if _, err := tracker.startReport(newResearchTestContext(base, "report_writer")); err != nil {
+		t.Fatalf("startReport() error = %v", err)
+	}
+
+	last := progress[len(progress)-1]
+	if last.Stage != researchStageWritingReport || last.Message != "budget exhausted, writing report" {
+		t.Fatalf("last progress = %+v, want budget exhausted writing_report", last)
+	}
+
+	if _, err := tracker.finishRun(newResearchTestContext(base, "report_writer")); err != nil {
+		t.Fatalf("finishRun() error = %v", err)
+	}
+	if tracker.get("inv-1") != nil {
+		t.Fatal("expected budget to be released after finishRun")
+	}
+}
+
+func TestResearchBudgetTracker_SkipsResearchersOutsideProfile(t *testing.T) {
+	base := context.WithValue(context.Background(), constant.ContextKeyResearchProfile, ResearchProfileQuick)
+	tracker := newResearchBudgetTracker("", []string{"researcher_breadth", "researcher_depth", "researcher_verify"})
+	if _, err := tracker.startRun(newResearchTestContext(base, "research_planner")); err != nil {
+		t.Fatalf("startRun() error = %v", err)
+	}
+
+	req := &model.LLMRequest{}
+	resp, err := tracker.beforeResearcherModel(newResearchTestContext(base, "researcher_breadth"), req)
+	if err != nil || resp != nil {
+		t.Fatalf("researcher_breadth should run, got %v, %v", resp, err)
+	}
+	if req.Config == nil || req.Config.SystemInstruction == nil {
+		t.Fatal("expected budget note appended to system instruction")
+	}
+
+	resp, err = tracker.beforeResearcherModel(newResearchTestContext(base, "researcher_depth"), &model.LLMRequest{})
+	if err != nil || resp == nil {
+		t.Fatalf("researcher_depth should be skipped by the quick profile, got %v, %v", resp, err)
+	}
+
+	// Skipped researchers did not run out of budget.
+	var progress []ResearchProgress
+	reportCtx := context.WithValue(base, ContextKeyResearchProgressReporter, ResearchProgressReporter(func(p ResearchProgress) {
+		progress = append(progress, p)
+	}))
+	if _, err := tracker.startReport(newResearchTestContext(reportCtx, "report_writer")); err != nil {
+		t.Fatalf("startReport() error = %v", err)
+	}
+	if len(progress) != 1 || progress[0].Message != "research complete, writing report" {
+		t.Fatalf("progress = %+v, want research complete", progress)
+	}
+}
+
+func TestResearchBudgetTracker_SweepsAbortedRuns(t *testing.T) {
+	tracker := newResearchBudgetTracker(ResearchProfileQuick, []string{"researcher_breadth"})
+	if _, err := tracker.startRun(newResearchTestContext(context.Background(), "research_planner")); err != nil {
+		t.Fatalf("startRun() error = %v", err)
+	}
+	// The run is cancelled before report_writer, so finishRun never runs.
+	aborted := tracker.get("inv-1")
+	aborted.startedAt = time.Now().Add(-aborted.profile.TimeBudget - researchBudgetRetention - time.Minute)
+
+	next := newResearchTestContext(context.Background(), "research_planner")
+	next.invocationID = "inv-2"
+	if _, err := tracker.startRun(next); err != nil {
+		t.Fatalf("startRun() error = %v", err)
+	}
+	if tracker.get("inv-1") != nil || tracker.get("inv-2") == nil {
+		t.Fatal("expected the aborted run's budget to be swept and the new one kept")
+	}
+}
+
+func TestResearchBudgetTracker_TimeBudget(t *testing.T) {
+	tracker := newResearchBudgetTracker(ResearchProfileStandard, []string{"researcher_breadth"})
+	if _, err := tracker.startRun(newResearchTestContext(context.Background(), "research_planner")); err != nil {
+		t.Fatalf("startRun() error = %v", err)
+	}
+	tracker.get("inv-1").startedAt = time.Now().Add(-time.Hour)
+
+	resp, err := tracker.beforeResearcherModel(newResearchTestContext(context.Background(), "researcher_breadth"), &model.LLMRequest{})
+	if err != nil || resp == nil {
+		t.Fatalf("expected researcher to stop once the time budget is spent, got %v, %v", resp, err)
+	}
+}
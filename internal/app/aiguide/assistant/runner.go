@@ -2,6 +2,7 @@ package assistant
 
 import (
 	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
 	"fmt"
 	"log/slog"
 
@@ -24,12 +25,18 @@ func (a *Assistant) baseAgentConfig() *Config {
 		OAuthConfig:     a.oauthConfig,
 		HTTPClient:      a.httpClient,
 		ThinkingBudget:  a.thinkingBudget,
+		ResearchProfile: a.researchProfile,
+		MCPToolsets:     a.mcpToolsets,
+		OpenAPIToolsets: a.openAPIToolsets,
+		CodeSandbox:     a.codeSandbox,
+		Notifications:   a.notifications,
 	}
 }
 
 func (a *Assistant) createRunner() (*runner.Runner, error) {
 	cfg := a.baseAgentConfig()
 	cfg.MockEmailIMAPConn = false
+	cfg.ToolConfirmation = tools.ConfirmationAsk
 
 	assistantAgent, err := NewAssistantAgent(cfg)
 	if err != nil {
@@ -50,10 +57,17 @@ func (a *Assistant) createRunner() (*runner.Runner, error) {
 	return r, nil
 }
 
-// createExecutorRunner creates a runner used by the scheduler. It uses the same
-// assistant agent so that scheduled tasks have access to all tools.
-func (a *Assistant) createExecutorRunner() (*runner.Runner, error) {
-	assistantAgent, err := NewAssistantAgent(a.baseAgentConfig())
+// createExecutorRunner creates a runner used by the scheduler, the trigger
+// watcher and the plan executor. It uses the same assistant agent so that
+// background runs have access to all tools. Plan tasks run while the user
+// watches the plan stream, so their runner pauses confirmable tools like the
+// chat does; event triggers and webhooks act on untrusted content, so theirs
+// denies them.
+func (a *Assistant) createExecutorRunner(confirmation tools.ConfirmationMode) (*runner.Runner, error) {
+	cfg := a.baseAgentConfig()
+	cfg.ToolConfirmation = confirmation
+
+	assistantAgent, err := NewAssistantAgent(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create assistant agent for executor: %w", err)
 	}
@@ -71,3 +85,51 @@ func (a *Assistant) createExecutorRunner() (*runner.Runner, error) {
 
 	return r, nil
 }
+
+// createPlannerRunner creates the runner of the planner agent, which breaks
+// plan-mode chat requests into tasks.
+func (a *Assistant) createPlannerRunner() (*runner.Runner, error) {
+	plannerAgent, err := NewPlannerAgent(&PlannerAgentConfig{Model: a.model, DB: a.db})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create planner agent: %w", err)
+	}
+
+	r, err := runner.New(runner.Config{
+		AppName:        constant.AppNamePlanner.String(),
+		Agent:          plannerAgent,
+		SessionService: a.session,
+	})
+	if err != nil {
+		slog.Error("failed to create planner runner", "err", err)
+		return nil, fmt.Errorf("failed to create planner runner: %w", err)
+	}
+
+	return r, nil
+}
+
+// createAPIRunner creates the runner of the non-web front-ends: the Telegram
+// and Slack bots and the OpenAI-compatible API. Its sessions are assistant
+// sessions, so these conversations also show up in the web app. Those clients
+// have no way to answer a confirmation prompt, so calls the user wants
+// confirmed fail and point the user to the web app.
+func (a *Assistant) createAPIRunner() (*runner.Runner, error) {
+	cfg := a.baseAgentConfig()
+	cfg.ToolConfirmation = tools.ConfirmationReject
+
+	assistantAgent, err := NewAssistantAgent(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create assistant agent for api: %w", err)
+	}
+
+	r, err := runner.New(runner.Config{
+		AppName:        constant.AppNameAssistant.String(),
+		Agent:          assistantAgent,
+		SessionService: a.session,
+	})
+	if err != nil {
+		slog.Error("failed to create api runner", "err", err)
+		return nil, fmt.Errorf("failed to create api runner: %w", err)
+	}
+
+	return r, nil
+}
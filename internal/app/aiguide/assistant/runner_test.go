@@ -0,0 +1,47 @@
+package assistant
+
+import (
+	"aiguide/internal/pkg/constant"
+	"iter"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+)
+
+// newScriptedRunner returns a runner of app whose agent, named after the
+// app, answers every invocation with the responses script returns for it.
+// A script error fails the run.
+func newScriptedRunner(t *testing.T, svc session.Service, app constant.AppName, script func(ctx agent.InvocationContext) ([]model.LLMResponse, error)) *runner.Runner {
+	t.Helper()
+	fake, err := agent.New(agent.Config{
+		Name: app.String(),
+		Run: func(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+			return func(yield func(*session.Event, error) bool) {
+				responses, err := script(ctx)
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				for _, response := range responses {
+					event := session.NewEvent(ctx.InvocationID())
+					event.Author = app.String()
+					event.LLMResponse = response
+					if !yield(event, nil) {
+						return
+					}
+				}
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("agent.New() error = %v", err)
+	}
+	r, err := runner.New(runner.Config{AppName: app.String(), Agent: fake, SessionService: svc})
+	if err != nil {
+		t.Fatalf("runner.New() error = %v", err)
+	}
+	return r
+}
@@ -0,0 +1,303 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/chatbot"
+	"aiguide/internal/pkg/constant"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// deliveryTimeout bounds each delivery of a run output.
+const deliveryTimeout = 30 * time.Second
+
+// Headers of outbound webhook deliveries. The signature is the hex-encoded
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the delivery secret.
+const (
+	webhookEventHeader     = "X-AIGuide-Event"
+	webhookTimestampHeader = "X-AIGuide-Timestamp"
+	webhookSignatureHeader = "X-AIGuide-Signature"
+	webhookEventRunOutput  = "scheduled_task.run_succeeded"
+)
+
+// ScheduledRunDelivery is the outcome of delivering a run output to one
+// target, stored as JSON in scheduled_task_run.deliveries.
+type ScheduledRunDelivery struct {
+	Channel constant.DeliveryChannel `json:"channel"`
+	Target  string                   `json:"target,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+}
+
+// scheduledRunWebhookPayload is the JSON body posted to webhook targets.
+type scheduledRunWebhookPayload struct {
+	Event      string                       `json:"event"`
+	TaskID     int                          `json:"task_id"`
+	TaskTitle  string                       `json:"task_title"`
+	RunID      int                          `json:"run_id"`
+	SessionID  string                       `json:"session_id"`
+	Trigger    constant.ScheduledRunTrigger `json:"trigger"`
+	Output     string                       `json:"output"`
+	FinishedAt time.Time                    `json:"finished_at"`
+}
+
+// deliverRunOutput sends the final output of a successful run to
+// target_email and to every delivery target of the task. A failed delivery
+// is logged and recorded but does not fail the run.
+func (s *Scheduler) deliverRunOutput(ctx context.Context, task table.ScheduledTask, run table.ScheduledTaskRun, output string, finishedAt time.Time) []ScheduledRunDelivery {
+	var targets []table.ScheduledTaskDelivery
+	if task.TargetEmail != "" {
+		targets = append(targets, table.ScheduledTaskDelivery{Channel: constant.DeliveryChannelEmail, Target: task.TargetEmail})
+	}
+	var rows []table.ScheduledTaskDelivery
+	if err := s.db.Where("scheduled_task_id = ?", task.ID).Order("id").Find(&rows).Error; err != nil {
+		slog.Error("scheduler: failed to load delivery targets", "err", err, "task_id", task.ID)
+	}
+	targets = append(targets, rows...)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// Deliver even when the scheduler is stopping: the run has already
+	// happened and its output would otherwise be lost.
+	deliverCtx := context.WithValue(context.WithoutCancel(ctx), constant.ContextKeyUserID, task.UserID)
+	deliverCtx = context.WithValue(deliverCtx, constant.ContextKeyTx, s.db)
+
+	results := make([]ScheduledRunDelivery, 0, len(targets))
+	for _, target := range targets {
+		result := ScheduledRunDelivery{Channel: target.Channel, Target: target.Target}
+		targetCtx, cancel := context.WithTimeout(deliverCtx, deliveryTimeout)
+		err := s.deliver(targetCtx, task, run, target, output, finishedAt)
+		cancel()
+		if err != nil {
+			slog.Error("scheduler: failed to deliver run output",
+				"err", err, "task_id", task.ID, "channel", target.Channel, "target", target.Target)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s *Scheduler) deliver(ctx context.Context, task table.ScheduledTask, run table.ScheduledTaskRun, target table.ScheduledTaskDelivery, output string, finishedAt time.Time) error {
+	title := fmt.Sprintf("定时任务结果：%s", task.Title)
+	switch target.Channel {
+	case constant.DeliveryChannelEmail:
+		if s.sendEmail == nil {
+			return errors.New("email delivery is not configured")
+		}
+		return s.sendEmail(ctx, target.Target, title, output)
+	case constant.DeliveryChannelInApp:
+		notification := table.Notification{
+			UserID: task.UserID,
+			Kind:   constant.NotificationKindScheduledTaskRun,
+			Title:  title,
+			Body:   output,
+			Link:   "/scheduled-tasks",
+		}
+		return s.notifications.Notify(ctx, notification)
+	case constant.DeliveryChannelWebPush:
+		pusher := s.notifications.WebPush()
+		if pusher == nil {
+			return errors.New("web push is not enabled")
+		}
+		_, err := pusher.Deliver(ctx, table.Notification{
+			UserID: task.UserID,
+			Kind:   constant.NotificationKindScheduledTaskRun,
+			Title:  title,
+			Body:   output,
+			Link:   "/scheduled-tasks",
+		})
+		return err
+	case constant.DeliveryChannelWebhook:
+		secret, err := s.decryptDeliverySecret(target)
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(scheduledRunWebhookPayload{
+			Event:      webhookEventRunOutput,
+			TaskID:     task.ID,
+			TaskTitle:  task.Title,
+			RunID:      run.ID,
+			SessionID:  run.SessionID,
+			Trigger:    run.Trigger,
+			Output:     output,
+			FinishedAt: finishedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+		timestamp := strconv.FormatInt(finishedAt.Unix(), 10)
+		headers := map[string]string{
+			webhookEventHeader:     webhookEventRunOutput,
+			webhookTimestampHeader: timestamp,
+			webhookSignatureHeader: "sha256=" + signWebhookPayload(secret, timestamp, body),
+		}
+		_, err = s.postJSON(ctx, target.Target, headers, body)
+		return err
+	case constant.DeliveryChannelChatBot:
+		token, err := s.decryptDeliverySecret(target)
+		if err != nil {
+			return err
+		}
+		return s.sendChatBotMessage(ctx, target.Provider, token, target.Target, title+"\n\n"+output)
+	default:
+		return fmt.Errorf("unsupported delivery channel: %s", target.Channel)
+	}
+}
+
+func (s *Scheduler) decryptDeliverySecret(target table.ScheduledTaskDelivery) (string, error) {
+	if s.cipher == nil {
+		return "", errors.New("secret cipher is not configured")
+	}
+	secret, err := s.cipher.Decrypt(target.Secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt delivery secret: %w", err)
+	}
+	return secret, nil
+}
+
+// signWebhookPayload returns the hex-encoded HMAC-SHA256 of
+// "<timestamp>.<body>". Receivers recompute it with the shared secret and
+// should reject stale timestamps to prevent replays.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendChatBotMessage posts text to a Telegram chat or Slack channel through
+// the bot API of provider.
+func (s *Scheduler) sendChatBotMessage(ctx context.Context, provider, token, chatID, text string) error {
+	var bot chatbot.Bot
+	switch provider {
+	case constant.ChatBotProviderTelegram:
+		bot = chatbot.NewTelegram(s.telegramAPIURL, token, s.httpClient)
+	case constant.ChatBotProviderSlack:
+		bot = chatbot.NewSlack(s.slackAPIURL, token, s.httpClient)
+	default:
+		return fmt.Errorf("unsupported chat bot provider: %s", provider)
+	}
+	_, err := bot.SendMessage(ctx, chatID, "", truncateRunes(text, bot.MessageLimit()))
+	return err
+}
+
+// errPrivateWebhookTarget is returned for webhook targets on loopback,
+// link-local or private networks, which users must not reach through the
+// server.
+var errPrivateWebhookTarget = errors.New("webhook target must be a public address")
+
+// publicAddress reports whether ip is outside the loopback, link-local,
+// private and unspecified ranges.
+func publicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// validateWebhookTarget rejects webhook urls whose host is, or resolves to, a
+// non-public address. Hosts that don't resolve are let through; the webhook
+// client checks the address it connects to again at send time.
+func validateWebhookTarget(ctx context.Context, target *url.URL) error {
+	host := strings.ToLower(target.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errPrivateWebhookTarget
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicAddress(ip) {
+			return errPrivateWebhookTarget
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr.IP) {
+			return errPrivateWebhookTarget
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns the client that posts webhook deliveries. Its
+// dialer refuses non-public addresses, which also covers redirects and
+// hosts that resolve differently than when the delivery was saved. It
+// connects directly, since behind a proxy the dialer would only see the
+// proxy's address.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+				return errPrivateWebhookTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return validateWebhookTarget(req.Context(), req.URL)
+		},
+	}
+}
+
+// postJSON posts body to target with the webhook client and returns the
+// response body. Non-2xx responses are errors.
+func (s *Scheduler) postJSON(ctx context.Context, target string, headers map[string]string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		// Drop the URL from the error: Telegram puts the bot token in it.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return response, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, truncateRunes(string(response), 200))
+	}
+	return response, nil
+}
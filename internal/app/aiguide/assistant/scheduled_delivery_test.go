@@ -0,0 +1,210 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/secret"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+func TestScheduler_Dispatch_DeliversOutput(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+	cipher, err := secret.NewCipher("test-key")
+	if err != nil {
+		t.Fatalf("secret.NewCipher() error: %v", err)
+	}
+	s.cipher = cipher
+
+	var emails []string
+	s.sendEmail = func(ctx context.Context, to, subject, body string) error {
+		emails = append(emails, to+"|"+subject+"|"+body)
+		return nil
+	}
+
+	var mu sync.Mutex
+	requests := map[string]*http.Request{}
+	bodies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests[r.URL.Path] = r
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/bottg-token/sendMessage":
+			w.Write([]byte(`{"ok":true}`))
+		case "/slack/chat.postMessage":
+			w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	s.webhookClient = server.Client()
+	s.telegramAPIURL = server.URL
+	s.slackAPIURL = server.URL + "/slack"
+
+	task := table.ScheduledTask{
+		UserID: 3, Title: "time check", Action: "what time is it", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Now(), TargetEmail: "owner@example.com",
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	encrypt := func(value string) string {
+		encrypted, err := cipher.Encrypt(value)
+		if err != nil {
+			t.Fatalf("Encrypt() error: %v", err)
+		}
+		return encrypted
+	}
+	deliveries := []table.ScheduledTaskDelivery{
+		{Channel: constant.DeliveryChannelInApp},
+		{Channel: constant.DeliveryChannelWebhook, Target: server.URL + "/hook", Secret: encrypt("hook-secret")},
+		{Channel: constant.DeliveryChannelChatBot, Provider: constant.ChatBotProviderTelegram, Target: "42", Secret: encrypt("tg-token")},
+		{Channel: constant.DeliveryChannelChatBot, Provider: constant.ChatBotProviderSlack, Target: "C1", Secret: encrypt("xoxb-token")},
+	}
+	for i := range deliveries {
+		deliveries[i].ScheduledTaskID = task.ID
+		deliveries[i].UserID = task.UserID
+		if err := db.Create(&deliveries[i]).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+
+	if err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule); err != nil {
+		t.Fatalf("dispatch() error: %v", err)
+	}
+
+	if len(emails) != 1 || !strings.HasPrefix(emails[0], "owner@example.com|") || !strings.HasSuffix(emails[0], "|It is 09:00.") {
+		t.Fatalf("emails = %q, want the output sent to target_email", emails)
+	}
+
+	// The in_app delivery doubles as the run notification.
+	var notifications []table.Notification
+	if err := db.Where("user_id = ?", task.UserID).Find(&notifications).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Kind != constant.NotificationKindScheduledTaskRun || notifications[0].Body != "It is 09:00." {
+		t.Fatalf("notifications = %+v, want the in-app delivery only", notifications)
+	}
+
+	hook := requests["/hook"]
+	if hook == nil {
+		t.Fatal("webhook was not called")
+	}
+	timestamp := hook.Header.Get(webhookTimestampHeader)
+	if got, want := hook.Header.Get(webhookSignatureHeader), "sha256="+signWebhookPayload("hook-secret", timestamp, bodies["/hook"]); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	var payload scheduledRunWebhookPayload
+	if err := json.Unmarshal(bodies["/hook"], &payload); err != nil {
+		t.Fatalf("failed to decode webhook payload: %v", err)
+	}
+	if payload.TaskID != task.ID || payload.Output != "It is 09:00." || payload.RunID == 0 {
+		t.Fatalf("payload = %+v", payload)
+	}
+
+	if !strings.Contains(string(bodies["/bottg-token/sendMessage"]), `"chat_id":"42"`) {
+		t.Fatalf("telegram body = %s", bodies["/bottg-token/sendMessage"])
+	}
+	if got := requests["/slack/chat.postMessage"].Header.Get("Authorization"); got != "Bearer xoxb-token" {
+		t.Fatalf("slack Authorization = %q", got)
+	}
+
+	var run table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).First(&run).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if run.Status != constant.ScheduledRunStatusSucceeded {
+		t.Fatalf("run status = %s, a failed delivery must not fail the run", run.Status)
+	}
+	var results []ScheduledRunDelivery
+	if err := json.Unmarshal([]byte(run.Deliveries), &results); err != nil {
+		t.Fatalf("failed to decode deliveries: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("got %d delivery results, want 5", len(results))
+	}
+	for i, result := range results {
+		wantErr := i == 4
+		if (result.Error != "") != wantErr {
+			t.Fatalf("delivery %d = %+v, want error only for slack", i, result)
+		}
+	}
+	if !strings.Contains(results[4].Error, "channel_not_found") {
+		t.Fatalf("slack delivery error = %q", results[4].Error)
+	}
+}
+
+func TestScheduler_Dispatch_SkipsDeliveryOnFailure(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+
+	task := table.ScheduledTask{
+		UserID: 3, Title: "broken", Action: "fail", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Now(),
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	delivery := table.ScheduledTaskDelivery{ScheduledTaskID: task.ID, UserID: task.UserID, Channel: constant.DeliveryChannelInApp}
+	if err := db.Create(&delivery).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	if err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerManual); err == nil {
+		t.Fatal("dispatch() expected error")
+	}
+
+	// The failure is announced, but nothing is delivered to the in_app target.
+	var notifications []table.Notification
+	if err := db.Find(&notifications).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Title != "定时任务执行失败：broken" {
+		t.Fatalf("notifications = %+v, want only the failure notice", notifications)
+	}
+}
+
+func TestScheduler_PostJSON_RefusesPrivateAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	s := newScheduler(setupSchedulerTestDB(t), nil, nil, 0)
+
+	// The target was saved while it resolved to a public address, or is
+	// reached through a redirect; the dialer still refuses loopback.
+	_, err := s.postJSON(context.Background(), server.URL+"/hook", nil, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), errPrivateWebhookTarget.Error()) {
+		t.Fatalf("postJSON() error = %v, want the private address refused", err)
+	}
+
+	// A public-looking server that redirects to a private address.
+	s.webhookClient.Transport = server.Client().Transport
+	redirect := httptest.NewServer(http.RedirectHandler("http://169.254.169.254/latest/meta-data", http.StatusFound))
+	defer redirect.Close()
+	_, err = s.postJSON(context.Background(), redirect.URL, nil, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), errPrivateWebhookTarget.Error()) {
+		t.Fatalf("postJSON() error = %v, want the redirect refused", err)
+	}
+	if called {
+		t.Fatal("webhook server was called despite its private address")
+	}
+}
@@ -2,10 +2,19 @@ package assistant
 
 import (
 	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/tools"
+	"cmp"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,19 +23,29 @@ import (
 
 // ScheduledTaskInfo is the API response shape for a single scheduled task.
 type ScheduledTaskInfo struct {
-	ID           int        `json:"id"`
-	Title        string     `json:"title"`
-	Action       string     `json:"action"`
-	ScheduleType string     `json:"schedule_type"`
-	RunAt        string     `json:"run_at"`
-	Weekday      int        `json:"weekday"`
-	Timezone     string     `json:"timezone"`
-	TargetEmail  string     `json:"target_email,omitempty"`
-	Enabled      bool       `json:"enabled"`
-	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
-	NextRunAt    time.Time  `json:"next_run_at"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID                  int        `json:"id"`
+	Title               string     `json:"title"`
+	Action              string     `json:"action"`
+	ScheduleType        string     `json:"schedule_type"`
+	RunAt               string     `json:"run_at"`
+	Weekday             int        `json:"weekday"`
+	MonthDay            int        `json:"month_day,omitempty"`
+	WeekOfMonth         int        `json:"week_of_month,omitempty"`
+	IntervalMinutes     int        `json:"interval_minutes,omitempty"`
+	CronExpr            string     `json:"cron_expr,omitempty"`
+	Timezone            string     `json:"timezone"`
+	TargetEmail         string     `json:"target_email,omitempty"`
+	Enabled             bool       `json:"enabled"`
+	MaxRuntimeMinutes   int        `json:"max_runtime_minutes"`
+	MaxRetries          int        `json:"max_retries"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	BlackoutDates       []string   `json:"blackout_dates"`
+	MissedRunPolicy     string     `json:"missed_run_policy"`
+	LastRunAt           *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt           time.Time  `json:"next_run_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
 }
 
 // ListScheduledTasksResponse is the response for listing scheduled tasks.
@@ -35,9 +54,90 @@ type ListScheduledTasksResponse struct {
 	Total int64               `json:"total"`
 }
 
-// UpdateScheduledTaskRequest supports toggling enabled status.
+// ScheduledTaskRunInfo is the API response shape for one execution of a
+// scheduled task. SessionID and AppName address the run's conversation in
+// the /:agentId/sessions routes.
+type ScheduledTaskRunInfo struct {
+	ID              int                          `json:"id"`
+	ScheduledTaskID int                          `json:"scheduled_task_id"`
+	Attempt         int                          `json:"attempt"`
+	Trigger         constant.ScheduledRunTrigger `json:"trigger"`
+	Status          constant.ScheduledRunStatus  `json:"status"`
+	StartedAt       time.Time                    `json:"started_at"`
+	FinishedAt      *time.Time                   `json:"finished_at,omitempty"`
+	Error           string                       `json:"error,omitempty"`
+	Output          string                       `json:"output"`
+	ToolCalls       []ScheduledRunToolCall       `json:"tool_calls"`
+	Deliveries      []ScheduledRunDelivery       `json:"deliveries"`
+	SessionID       string                       `json:"session_id"`
+	AppName         string                       `json:"app_name"`
+}
+
+// ListScheduledTaskRunsResponse is the response for listing task runs.
+type ListScheduledTaskRunsResponse struct {
+	Runs  []ScheduledTaskRunInfo `json:"runs"`
+	Total int64                  `json:"total"`
+}
+
+// ScheduledTaskDeliveryInfo is the API response shape for a delivery target.
+// The secret is never returned.
+type ScheduledTaskDeliveryInfo struct {
+	ID        int                      `json:"id"`
+	Channel   constant.DeliveryChannel `json:"channel"`
+	Provider  string                   `json:"provider,omitempty"`
+	Target    string                   `json:"target,omitempty"`
+	HasSecret bool                     `json:"has_secret"`
+	CreatedAt time.Time                `json:"created_at"`
+}
+
+// ListScheduledTaskDeliveriesResponse is the response for listing delivery
+// targets.
+type ListScheduledTaskDeliveriesResponse struct {
+	Deliveries []ScheduledTaskDeliveryInfo `json:"deliveries"`
+}
+
+// CreateScheduledTaskDeliveryRequest adds a delivery target. Target is the
+// email address (email), the URL (webhook) or the chat or channel id
+// (chat_bot); Secret is the HMAC signing secret (webhook) or the bot token
+// (chat_bot).
+type CreateScheduledTaskDeliveryRequest struct {
+	Channel  constant.DeliveryChannel `json:"channel"`
+	Provider string                   `json:"provider"`
+	Target   string                   `json:"target"`
+	Secret   string                   `json:"secret"`
+}
+
+// UpdateScheduledTaskRequest supports toggling enabled status and changing
+// the schedule. Omitted fields keep their current values.
 type UpdateScheduledTaskRequest struct {
-	Enabled *bool `json:"enabled"`
+	Enabled           *bool     `json:"enabled"`
+	ScheduleType      *string   `json:"schedule_type"`
+	RunAt             *string   `json:"run_at"`
+	Weekday           *int      `json:"weekday"`
+	MonthDay          *int      `json:"month_day"`
+	WeekOfMonth       *int      `json:"week_of_month"`
+	IntervalMinutes   *int      `json:"interval_minutes"`
+	CronExpr          *string   `json:"cron_expr"`
+	Timezone          *string   `json:"timezone"`
+	BlackoutDates     *[]string `json:"blackout_dates"`
+	MaxRuntimeMinutes *int      `json:"max_runtime_minutes"`
+	MaxRetries        *int      `json:"max_retries"`
+	FailureThreshold  *int      `json:"failure_threshold"`
+	MissedRunPolicy   *string   `json:"missed_run_policy"`
+}
+
+// hasScheduleChanges reports whether the request touches any field that
+// affects next_run_at.
+func (r UpdateScheduledTaskRequest) hasScheduleChanges() bool {
+	return r.ScheduleType != nil || r.RunAt != nil || r.Weekday != nil || r.MonthDay != nil ||
+		r.WeekOfMonth != nil || r.IntervalMinutes != nil || r.CronExpr != nil || r.Timezone != nil ||
+		r.BlackoutDates != nil
+}
+
+// hasPolicyChanges reports whether the request touches the failure or
+// missed-run policy.
+func (r UpdateScheduledTaskRequest) hasPolicyChanges() bool {
+	return r.MaxRuntimeMinutes != nil || r.MaxRetries != nil || r.FailureThreshold != nil || r.MissedRunPolicy != nil
 }
 
 // ListScheduledTasks returns all scheduled tasks for the current user.
@@ -80,13 +180,27 @@ func (a *Assistant) DeleteScheduledTask(ctx *gin.Context) {
 		return
 	}
 
-	result := a.db.Where("id = ? AND user_id = ?", taskID, userID).Delete(&table.ScheduledTask{})
-	if result.Error != nil {
-		slog.Error("failed to delete scheduled task", "err", result.Error, "user_id", userID, "task_id", taskID)
+	var rowsAffected int64
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", taskID, userID).Delete(&table.ScheduledTask{})
+		if result.Error != nil {
+			return result.Error
+		}
+		rowsAffected = result.RowsAffected
+		if rowsAffected == 0 {
+			return nil
+		}
+		if err := tx.Where("scheduled_task_id = ?", taskID).Delete(&table.ScheduledTaskDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("scheduled_task_id = ?", taskID).Delete(&table.ScheduledTaskRun{}).Error
+	})
+	if err != nil {
+		slog.Error("failed to delete scheduled task", "err", err, "user_id", userID, "task_id", taskID)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete scheduled task"})
 		return
 	}
-	if result.RowsAffected == 0 {
+	if rowsAffected == 0 {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "scheduled task not found"})
 		return
 	}
@@ -94,7 +208,265 @@ func (a *Assistant) DeleteScheduledTask(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"id": taskID})
 }
 
-// UpdateScheduledTask updates the enabled status of a scheduled task.
+// ListScheduledTaskRuns returns the run history of a scheduled task, newest
+// first. Supports limit and offset query parameters.
+func (a *Assistant) ListScheduledTaskRuns(ctx *gin.Context) {
+	userID, taskID, ok := a.ownedScheduledTaskID(ctx)
+	if !ok {
+		return
+	}
+
+	limit, offset := parsePagination(ctx)
+	query := a.db.Model(&table.ScheduledTaskRun{}).Where("scheduled_task_id = ? AND user_id = ?", taskID, userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.Error("failed to count scheduled task runs", "err", err, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load scheduled task runs"})
+		return
+	}
+	var runs []table.ScheduledTaskRun
+	if err := query.Order("started_at DESC, id DESC").Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		slog.Error("failed to query scheduled task runs", "err", err, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load scheduled task runs"})
+		return
+	}
+
+	response := make([]ScheduledTaskRunInfo, 0, len(runs))
+	for _, run := range runs {
+		response = append(response, newScheduledTaskRunInfo(run))
+	}
+	ctx.JSON(http.StatusOK, ListScheduledTaskRunsResponse{Runs: response, Total: total})
+}
+
+// ListScheduledTaskDeliveries returns the delivery targets of a scheduled
+// task. target_email is not included; it is part of the task itself.
+func (a *Assistant) ListScheduledTaskDeliveries(ctx *gin.Context) {
+	userID, taskID, ok := a.ownedScheduledTaskID(ctx)
+	if !ok {
+		return
+	}
+
+	var deliveries []table.ScheduledTaskDelivery
+	if err := a.db.Where("scheduled_task_id = ? AND user_id = ?", taskID, userID).Order("id").Find(&deliveries).Error; err != nil {
+		slog.Error("failed to query scheduled task deliveries", "err", err, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load delivery targets"})
+		return
+	}
+
+	response := make([]ScheduledTaskDeliveryInfo, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, newScheduledTaskDeliveryInfo(delivery))
+	}
+	ctx.JSON(http.StatusOK, ListScheduledTaskDeliveriesResponse{Deliveries: response})
+}
+
+// CreateScheduledTaskDelivery adds a delivery target to a scheduled task.
+// Secrets are encrypted before they are stored.
+func (a *Assistant) CreateScheduledTaskDelivery(ctx *gin.Context) {
+	userID, taskID, ok := a.ownedScheduledTaskID(ctx)
+	if !ok {
+		return
+	}
+
+	var req CreateScheduledTaskDeliveryRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind request body", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	req, err := validateScheduledTaskDeliveryRequest(ctx, req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	delivery := table.ScheduledTaskDelivery{
+		ScheduledTaskID: taskID,
+		UserID:          userID,
+		Channel:         req.Channel,
+		Provider:        req.Provider,
+		Target:          req.Target,
+	}
+	if req.Secret != "" {
+		if a.secretCipher == nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "secret storage is not configured"})
+			return
+		}
+		encrypted, err := a.secretCipher.Encrypt(req.Secret)
+		if err != nil {
+			slog.Error("failed to encrypt delivery secret", "err", err, "task_id", taskID)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save delivery target"})
+			return
+		}
+		delivery.Secret = encrypted
+	}
+	if err := a.db.Create(&delivery).Error; err != nil {
+		slog.Error("failed to create scheduled task delivery", "err", err, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save delivery target"})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newScheduledTaskDeliveryInfo(delivery))
+}
+
+// DeleteScheduledTaskDelivery removes a delivery target from a scheduled task.
+func (a *Assistant) DeleteScheduledTaskDelivery(ctx *gin.Context) {
+	userID, taskID, ok := a.ownedScheduledTaskID(ctx)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(ctx.Param("deliveryId"))
+	if err != nil || deliveryID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery id"})
+		return
+	}
+
+	result := a.db.Where("id = ? AND scheduled_task_id = ? AND user_id = ?", deliveryID, taskID, userID).
+		Delete(&table.ScheduledTaskDelivery{})
+	if result.Error != nil {
+		slog.Error("failed to delete scheduled task delivery", "err", result.Error, "task_id", taskID, "delivery_id", deliveryID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete delivery target"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "delivery target not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"id": deliveryID})
+}
+
+// ownedScheduledTaskID parses the :taskId parameter and checks that the task
+// belongs to the current user, writing the error response when it does not.
+func (a *Assistant) ownedScheduledTaskID(ctx *gin.Context) (int, int, bool) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, 0, false
+	}
+
+	taskID, err := strconv.Atoi(ctx.Param("taskId"))
+	if err != nil || taskID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+		return 0, 0, false
+	}
+
+	var count int64
+	if err := a.db.Model(&table.ScheduledTask{}).Where("id = ? AND user_id = ?", taskID, userID).Count(&count).Error; err != nil {
+		slog.Error("failed to find scheduled task", "err", err, "user_id", userID, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load scheduled task"})
+		return 0, 0, false
+	}
+	if count == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "scheduled task not found"})
+		return 0, 0, false
+	}
+	return userID, taskID, true
+}
+
+// validateScheduledTaskDeliveryRequest checks that req has the target and
+// secret its channel needs and drops the fields it does not use. Webhook
+// targets must be public addresses.
+func validateScheduledTaskDeliveryRequest(ctx context.Context, req CreateScheduledTaskDeliveryRequest) (CreateScheduledTaskDeliveryRequest, error) {
+	req.Target = strings.TrimSpace(req.Target)
+	switch req.Channel {
+	case constant.DeliveryChannelEmail:
+		address, err := mail.ParseAddress(req.Target)
+		if err != nil {
+			return req, fmt.Errorf("invalid email address: %s", req.Target)
+		}
+		req.Target, req.Provider, req.Secret = address.Address, "", ""
+	case constant.DeliveryChannelWebhook:
+		target, err := url.Parse(req.Target)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return req, fmt.Errorf("invalid webhook url, expected an http or https url")
+		}
+		if err := validateWebhookTarget(ctx, target); err != nil {
+			return req, err
+		}
+		if req.Secret == "" {
+			return req, fmt.Errorf("webhook delivery requires a signing secret")
+		}
+		req.Provider = ""
+	case constant.DeliveryChannelInApp, constant.DeliveryChannelWebPush:
+		req.Target, req.Provider, req.Secret = "", "", ""
+	case constant.DeliveryChannelChatBot:
+		if req.Provider != constant.ChatBotProviderTelegram && req.Provider != constant.ChatBotProviderSlack {
+			return req, fmt.Errorf("invalid chat bot provider: %s, expected telegram or slack", req.Provider)
+		}
+		if req.Target == "" {
+			return req, fmt.Errorf("chat bot delivery requires a chat or channel id as target")
+		}
+		if req.Secret == "" {
+			return req, fmt.Errorf("chat bot delivery requires the bot token as secret")
+		}
+	default:
+		return req, fmt.Errorf("invalid delivery channel: %s, expected email, webhook, in_app, web_push or chat_bot", req.Channel)
+	}
+	return req, nil
+}
+
+func newScheduledTaskDeliveryInfo(delivery table.ScheduledTaskDelivery) ScheduledTaskDeliveryInfo {
+	return ScheduledTaskDeliveryInfo{
+		ID:        delivery.ID,
+		Channel:   delivery.Channel,
+		Provider:  delivery.Provider,
+		Target:    delivery.Target,
+		HasSecret: delivery.Secret != "",
+		CreatedAt: delivery.CreatedAt,
+	}
+}
+
+// RunScheduledTask starts a run of a scheduled task immediately, outside of
+// its schedule. The run is recorded with trigger=manual and does not change
+// next_run_at or the consecutive failure count.
+func (a *Assistant) RunScheduledTask(ctx *gin.Context) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	taskID, err := strconv.Atoi(ctx.Param("taskId"))
+	if err != nil || taskID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+		return
+	}
+
+	var task table.ScheduledTask
+	if err := a.db.Where("id = ? AND user_id = ?", taskID, userID).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "scheduled task not found"})
+			return
+		}
+		slog.Error("failed to find scheduled task", "err", err, "user_id", userID, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load scheduled task"})
+		return
+	}
+
+	if a.scheduler == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "scheduler is not running"})
+		return
+	}
+	if err := a.scheduler.RunNow(task); err != nil {
+		if errors.Is(err, errSchedulerBusy) {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "all scheduler workers are busy, try again later"})
+			return
+		}
+		slog.Error("failed to run scheduled task", "err", err, "user_id", userID, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to run scheduled task"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"id": taskID})
+}
+
+// UpdateScheduledTask updates the enabled status, the schedule or the failure
+// policy of a scheduled task. Changes are validated the same way as the
+// scheduled_task_create tool; schedule changes recompute next_run_at.
+// Re-enabling a task resets its consecutive failure count.
 func (a *Assistant) UpdateScheduledTask(ctx *gin.Context) {
 	userID, ok := getContextUserID(ctx)
 	if !ok {
@@ -115,7 +487,7 @@ func (a *Assistant) UpdateScheduledTask(ctx *gin.Context) {
 		return
 	}
 
-	if req.Enabled == nil {
+	if req.Enabled == nil && !req.hasScheduleChanges() && !req.hasPolicyChanges() {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
 		return
 	}
@@ -131,30 +503,175 @@ func (a *Assistant) UpdateScheduledTask(ctx *gin.Context) {
 		return
 	}
 
-	task.Enabled = *req.Enabled
-	if err := a.db.Save(&task).Error; err != nil {
+	// Only the changed columns are written: the scheduler updates next_run_at,
+	// consecutive_failures and enabled of the same row while tasks run.
+	var columns []string
+	if req.hasScheduleChanges() || req.hasPolicyChanges() {
+		if columns, err = applyScheduledTaskUpdate(&task, req, time.Now()); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Enabled != nil {
+		if *req.Enabled && !task.Enabled {
+			task.ConsecutiveFailures = 0
+			columns = append(columns, "consecutive_failures")
+		}
+		task.Enabled = *req.Enabled
+		columns = append(columns, "enabled")
+	}
+	if err := a.db.Model(&task).Select(columns).Updates(&task).Error; err != nil {
 		slog.Error("failed to save scheduled task", "err", err, "user_id", userID, "task_id", taskID)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update scheduled task"})
 		return
 	}
+	if err := a.db.First(&task, task.ID).Error; err != nil {
+		slog.Error("failed to reload scheduled task", "err", err, "user_id", userID, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load scheduled task"})
+		return
+	}
 
 	ctx.JSON(http.StatusOK, newScheduledTaskInfo(task))
 }
 
+// applyScheduledTaskUpdate merges the schedule and policy fields of req into
+// task, validates the result and recomputes next_run_at when the schedule
+// changed. It returns the columns it set.
+func applyScheduledTaskUpdate(task *table.ScheduledTask, req UpdateScheduledTaskRequest, now time.Time) ([]string, error) {
+	input := tools.ScheduledTaskInputFromTable(*task)
+	if req.ScheduleType != nil && *req.ScheduleType != input.ScheduleType {
+		// run_at means something different for every schedule type, so it
+		// must be given again when the type changes.
+		input.ScheduleType = *req.ScheduleType
+		input.RunAt = ""
+	}
+	if req.RunAt != nil {
+		input.RunAt = *req.RunAt
+	}
+	if req.Weekday != nil {
+		input.Weekday = *req.Weekday
+	}
+	if req.MonthDay != nil {
+		input.MonthDay = *req.MonthDay
+	}
+	if req.WeekOfMonth != nil {
+		input.WeekOfMonth = *req.WeekOfMonth
+	}
+	if req.IntervalMinutes != nil {
+		input.IntervalMinutes = *req.IntervalMinutes
+	}
+	if req.CronExpr != nil {
+		input.CronExpr = *req.CronExpr
+	}
+	if req.Timezone != nil {
+		input.Timezone = *req.Timezone
+	}
+	if req.BlackoutDates != nil {
+		input.BlackoutDates = *req.BlackoutDates
+	}
+	if req.MaxRuntimeMinutes != nil {
+		input.MaxRuntimeMinutes = *req.MaxRuntimeMinutes
+	}
+	if req.MaxRetries != nil {
+		input.MaxRetries = *req.MaxRetries
+	}
+	if req.FailureThreshold != nil {
+		input.FailureThreshold = *req.FailureThreshold
+	}
+	if req.MissedRunPolicy != nil {
+		input.MissedRunPolicy = *req.MissedRunPolicy
+	}
+
+	normalized, err := tools.NormalizeScheduledTaskInput(input)
+	if err != nil {
+		return nil, err
+	}
+	task.MaxRuntimeMinutes = normalized.MaxRuntimeMinutes
+	task.MaxRetries = normalized.MaxRetries
+	task.FailureThreshold = normalized.FailureThreshold
+	task.MissedRunPolicy = normalized.MissedRunPolicy
+	columns := []string{"max_runtime_minutes", "max_retries", "failure_threshold", "missed_run_policy"}
+	if !req.hasScheduleChanges() {
+		return columns, nil
+	}
+
+	nextRunAt, err := tools.CalculateNextRunAt(now, normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	task.ScheduleType = normalized.ScheduleType
+	task.RunAt = normalized.RunAt
+	task.Weekday = normalized.Weekday
+	task.MonthDay = normalized.MonthDay
+	task.WeekOfMonth = normalized.WeekOfMonth
+	task.IntervalMinutes = normalized.IntervalMinutes
+	task.CronExpr = normalized.CronExpr
+	task.Timezone = normalized.Timezone
+	task.BlackoutDates = tools.EncodeBlackoutDates(normalized.BlackoutDates)
+	task.NextRunAt = nextRunAt
+	return append(columns, "schedule_type", "run_at", "weekday", "month_day", "week_of_month",
+		"interval_minutes", "cron_expr", "timezone", "blackout_dates", "next_run_at"), nil
+}
+
+func newScheduledTaskRunInfo(run table.ScheduledTaskRun) ScheduledTaskRunInfo {
+	toolCalls := []ScheduledRunToolCall{}
+	if run.ToolCalls != "" {
+		if err := json.Unmarshal([]byte(run.ToolCalls), &toolCalls); err != nil {
+			slog.Warn("failed to decode scheduled run tool calls", "err", err, "run_id", run.ID)
+		}
+	}
+	deliveries := []ScheduledRunDelivery{}
+	if run.Deliveries != "" {
+		if err := json.Unmarshal([]byte(run.Deliveries), &deliveries); err != nil {
+			slog.Warn("failed to decode scheduled run deliveries", "err", err, "run_id", run.ID)
+		}
+	}
+	return ScheduledTaskRunInfo{
+		ID:              run.ID,
+		ScheduledTaskID: run.ScheduledTaskID,
+		Attempt:         run.Attempt,
+		Trigger:         run.Trigger,
+		Status:          run.Status,
+		StartedAt:       run.StartedAt,
+		FinishedAt:      run.FinishedAt,
+		Error:           run.Error,
+		Output:          run.Output,
+		ToolCalls:       toolCalls,
+		Deliveries:      deliveries,
+		SessionID:       run.SessionID,
+		AppName:         constant.AppNameScheduler.String(),
+	}
+}
+
 func newScheduledTaskInfo(t table.ScheduledTask) ScheduledTaskInfo {
+	blackoutDates := tools.ScheduledTaskInputFromTable(t).BlackoutDates
+	if blackoutDates == nil {
+		blackoutDates = []string{}
+	}
 	return ScheduledTaskInfo{
-		ID:           t.ID,
-		Title:        t.Title,
-		Action:       t.Action,
-		ScheduleType: t.ScheduleType,
-		RunAt:        t.RunAt,
-		Weekday:      t.Weekday,
-		Timezone:     t.Timezone,
-		TargetEmail:  t.TargetEmail,
-		Enabled:      t.Enabled,
-		LastRunAt:    t.LastRunAt,
-		NextRunAt:    t.NextRunAt,
-		CreatedAt:    t.CreatedAt,
-		UpdatedAt:    t.UpdatedAt,
+		ID:                  t.ID,
+		Title:               t.Title,
+		Action:              t.Action,
+		ScheduleType:        t.ScheduleType,
+		RunAt:               t.RunAt,
+		Weekday:             t.Weekday,
+		MonthDay:            t.MonthDay,
+		WeekOfMonth:         t.WeekOfMonth,
+		IntervalMinutes:     t.IntervalMinutes,
+		CronExpr:            t.CronExpr,
+		Timezone:            t.Timezone,
+		TargetEmail:         t.TargetEmail,
+		Enabled:             t.Enabled,
+		MaxRuntimeMinutes:   cmp.Or(t.MaxRuntimeMinutes, tools.DefaultScheduledTaskMaxRuntimeMinutes),
+		MaxRetries:          t.MaxRetries,
+		FailureThreshold:    cmp.Or(t.FailureThreshold, tools.DefaultScheduledTaskFailureThreshold),
+		ConsecutiveFailures: t.ConsecutiveFailures,
+		BlackoutDates:       blackoutDates,
+		MissedRunPolicy:     cmp.Or(t.MissedRunPolicy, tools.MissedRunPolicyRunOnce),
+		LastRunAt:           t.LastRunAt,
+		NextRunAt:           t.NextRunAt,
+		CreatedAt:           t.CreatedAt,
+		UpdatedAt:           t.UpdatedAt,
 	}
 }
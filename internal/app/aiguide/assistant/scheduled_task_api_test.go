@@ -0,0 +1,383 @@
+package assistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/secret"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/session"
+	"gorm.io/gorm"
+)
+
+func TestUpdateScheduledTaskSchedule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := &Assistant{db: setupSchedulerTestDB(t)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.PATCH("/api/assistant/scheduled-tasks/:taskId", assistant.UpdateScheduledTask)
+	})
+
+	task := table.ScheduledTask{
+		UserID:       1,
+		Title:        "weekly report",
+		Action:       "send weekly report",
+		ScheduleType: "weekly",
+		RunAt:        "08:00",
+		Weekday:      3,
+		Timezone:     "UTC",
+		Enabled:      true,
+		NextRunAt:    time.Now().Add(time.Hour),
+	}
+	if err := assistant.db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	path := fmt.Sprintf("/api/assistant/scheduled-tasks/%d", task.ID)
+
+	resp := doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"schedule_type": "cron"})
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "cron_expr") {
+		t.Fatalf("cron without expression status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"schedule_type": "daily"})
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "HH:MM") {
+		t.Fatalf("daily without run_at status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{
+		"schedule_type": "cron",
+		"cron_expr":     "0 9 * * 1-5",
+		"timezone":      "Asia/Shanghai",
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var info ScheduledTaskInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if info.ScheduleType != "cron" || info.CronExpr != "0 9 * * 1-5" || info.RunAt != "" || info.Weekday != 0 {
+		t.Fatalf("updated task = %+v, want cron schedule with cleared weekly fields", info)
+	}
+	next := info.NextRunAt.In(time.FixedZone("CST", 8*3600))
+	if next.Hour() != 9 || next.Minute() != 0 || next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+		t.Fatalf("NextRunAt = %s, want a weekday at 09:00 Asia/Shanghai", next)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"max_retries": 9})
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "max_retries") {
+		t.Fatalf("invalid max_retries status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"max_retries": 2, "failure_threshold": 5})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("policy update status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var policy ScheduledTaskInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &policy); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if policy.MaxRetries != 2 || policy.FailureThreshold != 5 || !policy.NextRunAt.Equal(info.NextRunAt) {
+		t.Fatalf("policy update = %+v, want retries and threshold changed with next_run_at kept", policy)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"enabled": false})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("toggle status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var stored table.ScheduledTask
+	if err := assistant.db.First(&stored, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if stored.Enabled || stored.CronExpr != "0 9 * * 1-5" {
+		t.Fatalf("stored task = %+v, want disabled cron task", stored)
+	}
+}
+
+func TestUpdateScheduledTaskKeepsSchedulerColumns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := &Assistant{db: setupSchedulerTestDB(t)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.PATCH("/api/assistant/scheduled-tasks/:taskId", assistant.UpdateScheduledTask)
+	})
+
+	nextRunAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	task := table.ScheduledTask{
+		UserID: 1, Title: "hourly", Action: "a", ScheduleType: "interval", RunAt: nextRunAt.Format(time.RFC3339),
+		IntervalMinutes: 60, Timezone: "UTC", Enabled: true, NextRunAt: nextRunAt,
+	}
+	if err := assistant.db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	// A run finishes right after the handler loaded the task: the scheduler
+	// records a failure and advances next_run_at.
+	advanced := nextRunAt.Add(time.Hour)
+	var once sync.Once
+	err := assistant.db.Callback().Query().After("gorm:query").Register("test:scheduler_run", func(tx *gorm.DB) {
+		if tx.Statement.Table != "scheduled_tasks" {
+			return
+		}
+		once.Do(func() {
+			assistant.db.Session(&gorm.Session{NewDB: true}).Model(&table.ScheduledTask{}).Where("id = ?", task.ID).
+				UpdateColumns(map[string]any{"consecutive_failures": 2, "next_run_at": advanced})
+		})
+	})
+	if err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+
+	path := fmt.Sprintf("/api/assistant/scheduled-tasks/%d", task.ID)
+	if resp := doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"max_retries": 1}); resp.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var stored table.ScheduledTask
+	if err := assistant.db.First(&stored, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if stored.MaxRetries != 1 || stored.ConsecutiveFailures != 2 || !stored.NextRunAt.Equal(advanced) || !stored.Enabled {
+		t.Fatalf("stored task = %+v, want max_retries changed and the scheduler's columns kept", stored)
+	}
+}
+
+func TestListScheduledTaskRuns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := &Assistant{db: setupSchedulerTestDB(t)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/scheduled-tasks/:taskId/runs", assistant.ListScheduledTaskRuns)
+		router.DELETE("/api/assistant/scheduled-tasks/:taskId", assistant.DeleteScheduledTask)
+	})
+
+	own := table.ScheduledTask{UserID: 1, Title: "mine", Action: "a", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", NextRunAt: time.Now()}
+	other := table.ScheduledTask{UserID: 2, Title: "theirs", Action: "a", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", NextRunAt: time.Now()}
+	for _, task := range []*table.ScheduledTask{&own, &other} {
+		if err := assistant.db.Create(task).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+	start := time.Date(2026, 2, 25, 8, 0, 0, 0, time.UTC)
+	for i, status := range []constant.ScheduledRunStatus{constant.ScheduledRunStatusSucceeded, constant.ScheduledRunStatusFailed} {
+		run := table.ScheduledTaskRun{
+			ScheduledTaskID: own.ID,
+			UserID:          1,
+			SessionID:       fmt.Sprintf("scheduled-%d-%d", own.ID, i),
+			Status:          status,
+			StartedAt:       start.AddDate(0, 0, i),
+			ToolCalls:       `[{"name":"current_time"}]`,
+		}
+		if err := assistant.db.Create(&run).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+
+	resp := doSessionTaskRequest(t, router, http.MethodGet, fmt.Sprintf("/api/assistant/scheduled-tasks/%d/runs?limit=1", own.ID), nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("list status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var list ListScheduledTaskRunsResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if list.Total != 2 || len(list.Runs) != 1 {
+		t.Fatalf("list = %+v, want newest of 2 runs", list)
+	}
+	latest := list.Runs[0]
+	if latest.Status != constant.ScheduledRunStatusFailed || latest.AppName != "scheduler" || len(latest.ToolCalls) != 1 {
+		t.Fatalf("latest run = %+v", latest)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodGet, fmt.Sprintf("/api/assistant/scheduled-tasks/%d/runs", other.ID), nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("other user's runs status = %d, want 404", resp.Code)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodDelete, fmt.Sprintf("/api/assistant/scheduled-tasks/%d", own.ID), nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var remaining int64
+	assistant.db.Model(&table.ScheduledTaskRun{}).Where("scheduled_task_id = ?", own.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("%d runs left after deleting the task, want 0", remaining)
+	}
+}
+
+func TestUpdateScheduledTaskBlackoutAndMissedRunPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := &Assistant{db: setupSchedulerTestDB(t)}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.PATCH("/api/assistant/scheduled-tasks/:taskId", assistant.UpdateScheduledTask)
+	})
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	task := table.ScheduledTask{
+		UserID: 1, Title: "daily", Action: "a", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 8, 0, 0, 0, time.UTC),
+	}
+	if err := assistant.db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+	path := fmt.Sprintf("/api/assistant/scheduled-tasks/%d", task.ID)
+
+	resp := doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"missed_run_policy": "sometimes"})
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "missed_run_policy") {
+		t.Fatalf("invalid policy status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"blackout_dates": []string{"tomorrow"}})
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("invalid blackout status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+
+	blackout := fmt.Sprintf("%s/%s", tomorrow.Format(time.DateOnly), tomorrow.AddDate(0, 0, 1).Format(time.DateOnly))
+	resp = doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{
+		"blackout_dates":    []string{blackout},
+		"missed_run_policy": "skip",
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var info ScheduledTaskInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	want := task.NextRunAt.AddDate(0, 0, 2)
+	if len(info.BlackoutDates) != 1 || info.BlackoutDates[0] != blackout || info.MissedRunPolicy != "skip" || !info.NextRunAt.Equal(want) {
+		t.Fatalf("updated task = %+v, want next_run_at %s after the blackout", info, want)
+	}
+}
+
+func TestRunScheduledTask(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupSchedulerTestDB(t)
+	assistant := &Assistant{db: db}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.POST("/api/assistant/scheduled-tasks/:taskId/run", assistant.RunScheduledTask)
+	})
+
+	own := table.ScheduledTask{UserID: 1, Title: "mine", Action: "what time is it", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", NextRunAt: time.Now().Add(time.Hour)}
+	other := table.ScheduledTask{UserID: 2, Title: "theirs", Action: "a", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", NextRunAt: time.Now().Add(time.Hour)}
+	for _, task := range []*table.ScheduledTask{&own, &other} {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+	path := func(id int) string { return fmt.Sprintf("/api/assistant/scheduled-tasks/%d/run", id) }
+
+	resp := doSessionTaskRequest(t, router, http.MethodPost, path(own.ID), nil)
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("run without scheduler status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+
+	svc := session.InMemoryService()
+	assistant.scheduler = newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 1)
+
+	resp = doSessionTaskRequest(t, router, http.MethodPost, path(other.ID), nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("run of another user's task status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodPost, path(own.ID), nil)
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("run status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	assistant.scheduler.wg.Wait()
+
+	var run table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", own.ID).First(&run).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if run.Trigger != constant.ScheduledRunTriggerManual || run.Status != constant.ScheduledRunStatusSucceeded {
+		t.Fatalf("run = %+v, want a succeeded manual run", run)
+	}
+}
+
+func TestScheduledTaskDeliveries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cipher, err := secret.NewCipher("test-key")
+	if err != nil {
+		t.Fatalf("secret.NewCipher() error: %v", err)
+	}
+	assistant := &Assistant{db: setupSchedulerTestDB(t), secretCipher: cipher}
+	router := newProjectTestRouter(assistant, func(router *gin.Engine) {
+		router.GET("/api/assistant/scheduled-tasks/:taskId/deliveries", assistant.ListScheduledTaskDeliveries)
+		router.POST("/api/assistant/scheduled-tasks/:taskId/deliveries", assistant.CreateScheduledTaskDelivery)
+		router.DELETE("/api/assistant/scheduled-tasks/:taskId/deliveries/:deliveryId", assistant.DeleteScheduledTaskDelivery)
+	})
+
+	own := table.ScheduledTask{UserID: 1, Title: "mine", Action: "a", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", NextRunAt: time.Now()}
+	other := table.ScheduledTask{UserID: 2, Title: "theirs", Action: "a", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", NextRunAt: time.Now()}
+	for _, task := range []*table.ScheduledTask{&own, &other} {
+		if err := assistant.db.Create(task).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+	path := fmt.Sprintf("/api/assistant/scheduled-tasks/%d/deliveries", own.ID)
+
+	invalid := []map[string]any{
+		{"channel": "fax"},
+		{"channel": "email", "target": "not an address"},
+		{"channel": "webhook", "target": "ftp://example.com/hook", "secret": "s"},
+		{"channel": "webhook", "target": "https://example.com/hook"},
+		{"channel": "webhook", "target": "http://127.0.0.1:8080/hook", "secret": "s"},
+		{"channel": "webhook", "target": "http://localhost/hook", "secret": "s"},
+		{"channel": "webhook", "target": "http://169.254.169.254/latest/meta-data", "secret": "s"},
+		{"channel": "webhook", "target": "https://10.0.0.5/hook", "secret": "s"},
+		{"channel": "webhook", "target": "http://[::1]/hook", "secret": "s"},
+		{"channel": "chat_bot", "provider": "irc", "target": "#general", "secret": "t"},
+		{"channel": "chat_bot", "provider": "telegram", "target": "42"},
+	}
+	for _, body := range invalid {
+		resp := doSessionTaskRequest(t, router, http.MethodPost, path, body)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("create %v status = %d, body=%s", body, resp.Code, resp.Body.String())
+		}
+	}
+	resp := doSessionTaskRequest(t, router, http.MethodPost, fmt.Sprintf("/api/assistant/scheduled-tasks/%d/deliveries", other.ID),
+		map[string]any{"channel": "in_app"})
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("create on another user's task status = %d", resp.Code)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPost, path, map[string]any{
+		"channel": "webhook", "target": "https://example.com/hook", "secret": "hook-secret",
+	})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	if strings.Contains(resp.Body.String(), "hook-secret") {
+		t.Fatalf("response leaks the secret: %s", resp.Body.String())
+	}
+	var created ScheduledTaskDeliveryInfo
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if !created.HasSecret || created.Channel != constant.DeliveryChannelWebhook {
+		t.Fatalf("created = %+v", created)
+	}
+	var stored table.ScheduledTaskDelivery
+	if err := assistant.db.First(&stored, created.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if plain, err := cipher.Decrypt(stored.Secret); err != nil || plain != "hook-secret" || stored.Secret == "hook-secret" {
+		t.Fatalf("stored secret = %q, want the encrypted signing secret", stored.Secret)
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodGet, path, nil)
+	var list ListScheduledTaskDeliveriesResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil || len(list.Deliveries) != 1 {
+		t.Fatalf("list = %s, want one delivery", resp.Body.String())
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodDelete, fmt.Sprintf("%s/%d", path, created.ID), nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	resp = doSessionTaskRequest(t, router, http.MethodDelete, fmt.Sprintf("%s/%d", path, created.ID), nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("second delete status = %d", resp.Code)
+	}
+}
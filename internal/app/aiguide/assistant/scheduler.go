@@ -2,14 +2,26 @@ package assistant
 
 import (
 	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/chatbot"
 	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/notification"
+	"aiguide/internal/pkg/secret"
 	"aiguide/internal/pkg/tools"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/runner"
 	"google.golang.org/adk/session"
@@ -20,22 +32,102 @@ import (
 // schedulerPollInterval is how often the scheduler checks for due tasks.
 const schedulerPollInterval = time.Minute
 
+// schedulerMissedRunGrace is how late a run may start before it counts as
+// missed (e.g. because the server was down) and the task's missed-run policy
+// applies.
+const schedulerMissedRunGrace = 2 * schedulerPollInterval
+
+// schedulerCatchUpWindow bounds how far back run_all tasks catch up on
+// missed runs after a long outage.
+const schedulerCatchUpWindow = 7 * 24 * time.Hour
+
+// errSchedulerBusy is returned by RunNow when all worker slots are taken.
+var errSchedulerBusy = errors.New("scheduler: all workers are busy")
+
+// defaultSchedulerWorkers is the number of task runs one process executes
+// concurrently when no worker count is configured.
+const defaultSchedulerWorkers = 4
+
+// schedulerRetryInterval and schedulerMaxRetryInterval bound the exponential
+// backoff between retries of a failed run.
+const (
+	schedulerRetryInterval    = 30 * time.Second
+	schedulerMaxRetryInterval = 10 * time.Minute
+)
+
+// schedulerCancelGrace is how long a run that exceeded its max runtime gets
+// to stop after being cancelled. A run still going after that is abandoned
+// and not retried, so attempts of the same task never overlap.
+const schedulerCancelGrace = 10 * time.Second
+
 // Scheduler polls the database for due scheduled tasks and executes them
 // via the assistant runner. Each task runs in a fresh session so it has
 // full tool access (web search, email, etc.) just like an interactive chat.
+//
+// Several backend processes may run a Scheduler against the same database:
+// a task is only dispatched by the process whose conditional update claims
+// it, and each process runs at most `workers` tasks at a time, leaving the
+// rest due for other processes or the next tick.
 type Scheduler struct {
 	db      *gorm.DB
 	runner  *runner.Runner
 	session session.Service
+
+	// slots is a semaphore bounding concurrent dispatches.
+	slots chan struct{}
+	wg    sync.WaitGroup
+	// baseCtx is the context passed to Start; manual runs inherit it so they
+	// stop together with the scheduler.
+	baseCtx context.Context
+
+	// retryInterval is the initial backoff between retries of a failed run.
+	retryInterval time.Duration
+	// defaultMaxRuntime bounds runs of tasks without max_runtime_minutes.
+	defaultMaxRuntime time.Duration
+	// cancelGrace is how long a cancelled run gets to stop.
+	cancelGrace time.Duration
+	// sendEmail delivers run outputs and failure alerts by email; replaced
+	// in tests.
+	sendEmail func(ctx context.Context, to, subject, body string) error
+	// cipher decrypts webhook secrets and bot tokens of delivery targets.
+	cipher     *secret.Cipher
+	httpClient *http.Client
+	// webhookClient posts webhook deliveries and refuses private addresses;
+	// replaced in tests.
+	webhookClient *http.Client
+	// telegramAPIURL and slackAPIURL are the chat bot API endpoints.
+	telegramAPIURL string
+	slackAPIURL    string
+	// notifications receives in-app deliveries; the assistant replaces the
+	// process-local default with its shared hub.
+	notifications *notification.Hub
 }
 
-func newScheduler(db *gorm.DB, r *runner.Runner, s session.Service) *Scheduler {
-	return &Scheduler{db: db, runner: r, session: s}
+func newScheduler(db *gorm.DB, r *runner.Runner, s session.Service, workers int) *Scheduler {
+	if workers <= 0 {
+		workers = defaultSchedulerWorkers
+	}
+	return &Scheduler{
+		db:                db,
+		runner:            r,
+		session:           s,
+		slots:             make(chan struct{}, workers),
+		baseCtx:           context.Background(),
+		retryInterval:     schedulerRetryInterval,
+		defaultMaxRuntime: tools.DefaultScheduledTaskMaxRuntimeMinutes * time.Minute,
+		cancelGrace:       schedulerCancelGrace,
+		sendEmail:         tools.SendNotificationEmail,
+		webhookClient:     newWebhookClient(),
+		telegramAPIURL:    chatbot.TelegramAPIURL,
+		slackAPIURL:       chatbot.SlackAPIURL,
+		notifications:     notification.NewHub(db, nil),
+	}
 }
 
 // Start launches the scheduler loop as a background goroutine.
 // It stops when ctx is cancelled.
 func (s *Scheduler) Start(ctx context.Context) {
+	s.baseCtx = ctx
 	go s.loop(ctx)
 }
 
@@ -51,6 +143,7 @@ func (s *Scheduler) loop(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			s.wg.Wait()
 			slog.Info("scheduler: stopped")
 			return
 		case <-ticker.C:
@@ -59,30 +152,82 @@ func (s *Scheduler) loop(ctx context.Context) {
 	}
 }
 
-// tick queries for all enabled tasks whose next_run_at is in the past and
-// dispatches each one in its own goroutine.
+// tick queries for enabled tasks whose next_run_at is in the past, claims
+// as many as there are free worker slots and dispatches each claimed task on
+// a worker. Slots that fall on a blackout date, missed slots of tasks with
+// the skip policy, and slots of owners that can't run the assistant are
+// claimed without being dispatched.
 func (s *Scheduler) tick(ctx context.Context) {
+	free := cap(s.slots) - len(s.slots)
+	if free == 0 {
+		return
+	}
+
 	var tasks []table.ScheduledTask
 	now := time.Now()
 
-	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, now).Find(&tasks).Error; err != nil {
+	// Fetch a few more than the free slots so tasks claimed meanwhile by
+	// another process do not leave slots idle until the next tick.
+	if err := s.db.Where("enabled = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at ASC").Limit(free * 2).Find(&tasks).Error; err != nil {
 		slog.Error("scheduler: failed to query due tasks", "err", err)
 		return
 	}
 
 	for _, task := range tasks {
+		reason := skipReason(task, now)
+		if reason == "" {
+			// Scheduled runs bypass the HTTP middleware, so the owner is
+			// checked before every slot: slots of disabled or read-only
+			// owners are skipped and recorded like other skipped slots.
+			if err := middleware.VerifyUserCanRun(ctx, s.db, task.UserID); errors.Is(err, middleware.ErrUserCannotRun) {
+				reason = err.Error()
+			} else if err != nil {
+				slog.Error("scheduler: failed to verify task owner", "err", err, "task_id", task.ID, "user_id", task.UserID)
+				continue
+			}
+		}
+		if reason != "" {
+			claimed, err := s.advanceNextRunAt(task, now)
+			if err != nil {
+				slog.Error("scheduler: failed to advance next_run_at of skipped task",
+					"err", err, "task_id", task.ID, "title", task.Title)
+				continue
+			}
+			if claimed {
+				slog.Info("scheduler: skipped task run",
+					"task_id", task.ID, "title", task.Title, "due_at", task.NextRunAt, "reason", reason)
+				s.recordSkippedRun(ctx, task, reason, now)
+			}
+			continue
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			return
+		}
 
-		// Pre-advance next_run_at (or disable for once-tasks) before
-		// dispatching. This prevents double-dispatch if the task takes
-		// longer than one poll interval to complete.
-		if err := s.advanceNextRunAt(task, now); err != nil {
-			slog.Error("scheduler: failed to advance next_run_at, skipping task",
-				"err", err, "task_id", task.ID, "title", task.Title)
+		// Claim the task by advancing next_run_at (or disabling once-tasks)
+		// before dispatching. This prevents double-dispatch by other
+		// processes and by later ticks if the run outlasts a poll interval.
+		claimed, err := s.advanceNextRunAt(task, now)
+		if err != nil || !claimed {
+			<-s.slots
+			if err != nil {
+				slog.Error("scheduler: failed to advance next_run_at, skipping task",
+					"err", err, "task_id", task.ID, "title", task.Title)
+			}
 			continue
 		}
 
+		s.wg.Add(1)
 		go func() {
-			if err := s.dispatch(ctx, task); err != nil {
+			defer func() {
+				<-s.slots
+				s.wg.Done()
+			}()
+			if err := s.dispatch(ctx, task, constant.ScheduledRunTriggerSchedule); err != nil {
 				slog.Error("scheduler: task dispatch failed",
 					"err", err, "task_id", task.ID, "title", task.Title, "user_id", task.UserID)
 			}
@@ -90,131 +235,448 @@ func (s *Scheduler) tick(ctx context.Context) {
 	}
 }
 
-// advanceNextRunAt moves the task's next_run_at forward so the scheduler
-// does not pick it up again before it finishes. For once-tasks it sets
-// enabled=false instead.
-func (s *Scheduler) advanceNextRunAt(task table.ScheduledTask, now time.Time) error {
-	if task.ScheduleType == "once" {
-		return s.db.Model(&task).Update("enabled", false).Error
+// skipReason reports why the due slot of task should not run, or "" if it
+// should.
+func skipReason(task table.ScheduledTask, now time.Time) string {
+	input := tools.ScheduledTaskInputFromTable(task)
+	if tools.InBlackout(task.NextRunAt, input) {
+		return "the slot falls on a blackout date"
+	}
+	if input.MissedRunPolicy == tools.MissedRunPolicySkip && now.Sub(task.NextRunAt) > schedulerMissedRunGrace {
+		return "the slot was missed and the task skips missed runs"
+	}
+	return ""
+}
+
+// recordSkippedRun adds a skipped run for the slot of task that was just
+// claimed without being dispatched, so the run history shows why it did not
+// run. Once-tasks have no later slot and are disabled by the claim, so their
+// owner is also notified.
+func (s *Scheduler) recordSkippedRun(ctx context.Context, task table.ScheduledTask, reason string, now time.Time) {
+	run := table.ScheduledTaskRun{
+		ScheduledTaskID: task.ID,
+		UserID:          task.UserID,
+		Attempt:         1,
+		Trigger:         constant.ScheduledRunTriggerSchedule,
+		Status:          constant.ScheduledRunStatusSkipped,
+		StartedAt:       task.NextRunAt,
+		FinishedAt:      &now,
+		Error:           "skipped: " + reason,
+	}
+	if err := s.db.Create(&run).Error; err != nil {
+		slog.Error("scheduler: failed to record skipped run", "err", err, "task_id", task.ID)
 	}
 
-	input := tools.ScheduledTaskCreateInput{
-		ScheduleType: task.ScheduleType,
-		RunAt:        task.RunAt,
-		Weekday:      task.Weekday,
-		Timezone:     task.Timezone,
+	if task.ScheduleType != tools.ScheduleTypeOnce {
+		return
 	}
-	nextRunAt, err := tools.CalculateNextRunAt(now, input)
+	_ = s.notifications.Notify(context.WithoutCancel(ctx), table.Notification{
+		UserID: task.UserID,
+		Kind:   constant.NotificationKindScheduledTaskRun,
+		Title:  fmt.Sprintf("定时任务已跳过：%s", task.Title),
+		Body: fmt.Sprintf("定时任务「%s」计划于 %s 的执行已跳过，任务已停用。如仍需执行，请在定时任务页面修改时间后重新启用。\n\n原因：%s\n",
+			task.Title, task.NextRunAt.Format(time.RFC3339), reason),
+		Link: "/scheduled-tasks",
+	})
+}
+
+// advanceNextRunAt claims a due task by moving its next_run_at forward, or
+// by setting enabled=false for once-tasks. The update only applies while the
+// task is still enabled and next_run_at is unchanged since it was read, so
+// when several processes race for the same slot exactly one of them gets
+// claimed=true.
+//
+// Tasks with the run_all policy advance to the slot following the one just
+// claimed, so after an outage every missed slot (within
+// schedulerCatchUpWindow) stays due and runs on later ticks; other tasks
+// continue with the first slot after now.
+func (s *Scheduler) advanceNextRunAt(task table.ScheduledTask, now time.Time) (bool, error) {
+	claim := s.db.Model(&table.ScheduledTask{}).
+		Where("id = ? AND enabled = ? AND next_run_at = ?", task.ID, true, task.NextRunAt)
+
+	if task.ScheduleType == tools.ScheduleTypeOnce {
+		result := claim.Update("enabled", false)
+		return result.RowsAffected == 1, result.Error
+	}
+
+	input := tools.ScheduledTaskInputFromTable(task)
+	if input.ScheduleType == tools.ScheduleTypeInterval && input.RunAt == "" {
+		// Anchor intervals to the slot that just fired so runs do not drift
+		// by the polling delay.
+		input.RunAt = task.NextRunAt.Format(time.RFC3339)
+	}
+	from := now
+	if input.MissedRunPolicy == tools.MissedRunPolicyRunAll {
+		from = task.NextRunAt
+		if earliest := now.Add(-schedulerCatchUpWindow); from.Before(earliest) {
+			from = earliest
+		}
+	}
+	nextRunAt, err := tools.CalculateNextRunAt(from, input)
 	if err != nil {
-		return fmt.Errorf("failed to calculate next run time: %w", err)
+		return false, fmt.Errorf("failed to calculate next run time: %w", err)
 	}
 
-	return s.db.Model(&task).Update("next_run_at", nextRunAt).Error
+	result := claim.Update("next_run_at", nextRunAt)
+	return result.RowsAffected == 1, result.Error
+}
+
+// scheduledRunResponseLimit caps how much of each tool response is kept in
+// the run history.
+const scheduledRunResponseLimit = 2000
+
+// ScheduledRunToolCall is one tool call recorded in a scheduled task run.
+type ScheduledRunToolCall struct {
+	Name     string         `json:"name"`
+	Author   string         `json:"author,omitempty"`
+	Args     map[string]any `json:"args,omitempty"`
+	Response string         `json:"response,omitempty"`
 }
 
-// dispatch creates a dedicated session and runs the task action through the
-// assistant runner, then records last_run_at on success.
-func (s *Scheduler) dispatch(ctx context.Context, task table.ScheduledTask) error {
+// dispatch runs the task action, retrying failed runs with exponential
+// backoff up to the task's max_retries. Every attempt gets its own session and
+// scheduled_task_run record and is bounded by the task's max runtime; an
+// attempt that doesn't stop once cancelled is not retried. When all
+// attempts fail the consecutive failure counter is bumped, the task is
+// disabled once it reaches the threshold, and an alert is sent to
+// target_email. Manual runs are recorded in the run history but do not
+// affect the failure counter. Either way the owner gets an in-app
+// notification of the outcome.
+func (s *Scheduler) dispatch(ctx context.Context, task table.ScheduledTask, trigger constant.ScheduledRunTrigger) error {
 	if s.runner == nil || s.session == nil {
 		return fmt.Errorf("scheduler: runner and session are not initialized")
 	}
 
 	slog.Info("scheduler: dispatching task",
-		"task_id", task.ID, "title", task.Title, "user_id", task.UserID)
+		"task_id", task.ID, "title", task.Title, "user_id", task.UserID, "trigger", trigger)
 
-	// Inject the task owner's user_id and the shared db connection into the
-	// context so tools that call middleware.GetUserID() and middleware.GetTx()
-	// (e.g. send_email, manage_memory) resolve the correct values.
-	taskCtx := context.WithValue(ctx, constant.ContextKeyUserID, task.UserID)
-	taskCtx = context.WithValue(taskCtx, constant.ContextKeyTx, s.db)
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = s.retryInterval
+	policy.MaxInterval = schedulerMaxRetryInterval
+	policy.MaxElapsedTime = 0
+	retry := backoff.WithContext(backoff.WithMaxRetries(policy, uint64(task.MaxRetries)), ctx)
+
+	attempt := 0
+	var output string
+	var deliveries []ScheduledRunDelivery
+	runErr := backoff.RetryNotify(func() error {
+		attempt++
+		var err error
+		output, deliveries, err = s.runAttempt(ctx, task, trigger, attempt)
+		return err
+	}, retry, func(err error, wait time.Duration) {
+		slog.Warn("scheduler: run failed, retrying",
+			"err", err, "task_id", task.ID, "attempt", attempt, "retry_in", wait)
+	})
+
+	// Record last_run_at regardless of whether the run succeeded.
+	if err := s.db.Model(&task).Update("last_run_at", time.Now()).Error; err != nil {
+		slog.Error("scheduler: failed to update last_run_at",
+			"err", err, "task_id", task.ID)
+	}
+
+	if trigger == constant.ScheduledRunTriggerManual {
+		s.notifyRun(ctx, task, output, deliveries, runErr, false)
+		return runErr
+	}
+	if runErr != nil {
+		disabled := s.handleFailure(ctx, task, attempt, runErr)
+		s.notifyRun(ctx, task, output, deliveries, runErr, disabled)
+		return runErr
+	}
+
+	if task.ConsecutiveFailures > 0 {
+		if err := s.db.Model(&task).Update("consecutive_failures", 0).Error; err != nil {
+			slog.Error("scheduler: failed to reset consecutive_failures", "err", err, "task_id", task.ID)
+		}
+	}
+	slog.Info("scheduler: task completed successfully",
+		"task_id", task.ID, "title", task.Title, "user_id", task.UserID, "attempts", attempt)
+	s.notifyRun(ctx, task, output, deliveries, nil, false)
+	return nil
+}
 
-	// Create a fresh session for this execution so the task has its own
+// notifyRun announces a finished run to the owner of task, like
+// TriggerWatcher.notifyRun. A successful run whose output already went to an
+// in_app delivery target is not announced twice. Failures to notify are
+// logged by the hub and do not affect the run.
+func (s *Scheduler) notifyRun(ctx context.Context, task table.ScheduledTask, output string, deliveries []ScheduledRunDelivery, runErr error, disabled bool) {
+	if runErr == nil && slices.ContainsFunc(deliveries, func(d ScheduledRunDelivery) bool {
+		return d.Channel == constant.DeliveryChannelInApp && d.Error == ""
+	}) {
+		return
+	}
+	n := table.Notification{
+		UserID: task.UserID,
+		Kind:   constant.NotificationKindScheduledTaskRun,
+		Title:  fmt.Sprintf("定时任务已运行：%s", task.Title),
+		Body:   output,
+		Link:   "/scheduled-tasks",
+	}
+	if runErr != nil {
+		n.Title = fmt.Sprintf("定时任务执行失败：%s", task.Title)
+		n.Body = runErr.Error()
+	}
+	if disabled {
+		n.Title = fmt.Sprintf("定时任务已停用：%s", task.Title)
+		n.Body += "\n\n连续失败次数已达到阈值，任务已自动停用。请排查问题后在定时任务页面重新启用。"
+	}
+	_ = s.notifications.Notify(context.WithoutCancel(ctx), n)
+}
+
+// runAttempt executes the task once in a fresh session, bounded by the
+// task's max runtime, and records the outcome as a scheduled_task_run. It
+// returns the run output and the results of delivering it.
+func (s *Scheduler) runAttempt(ctx context.Context, task table.ScheduledTask, trigger constant.ScheduledRunTrigger, attempt int) (string, []ScheduledRunDelivery, error) {
+	// Each execution gets a fresh session so the task has its own
 	// conversation history and does not pollute an existing user session.
-	sessionID := fmt.Sprintf("scheduled-%d-%d", task.ID, time.Now().UnixMilli())
-	userIDStr := strconv.Itoa(task.UserID)
+	run := table.ScheduledTaskRun{
+		ScheduledTaskID: task.ID,
+		UserID:          task.UserID,
+		SessionID:       fmt.Sprintf("scheduled-%d-%d", task.ID, time.Now().UnixNano()),
+		Attempt:         attempt,
+		Trigger:         trigger,
+		Status:          constant.ScheduledRunStatusRunning,
+		StartedAt:       time.Now(),
+	}
+	if err := s.db.Create(&run).Error; err != nil {
+		slog.Error("scheduler: failed to create run record", "err", err, "task_id", task.ID)
+	}
+
+	maxRuntime := s.defaultMaxRuntime
+	if task.MaxRuntimeMinutes > 0 {
+		maxRuntime = time.Duration(task.MaxRuntimeMinutes) * time.Minute
+	}
+	runCtx, cancel := context.WithTimeout(ctx, maxRuntime)
+	defer cancel()
+
+	type result struct {
+		output    string
+		toolCalls []ScheduledRunToolCall
+		err       error
+	}
+	// Run in a goroutine so a tool that ignores cancellation cannot keep the
+	// scheduler waiting past the deadline.
+	done := make(chan result, 1)
+	go func() {
+		output, toolCalls, err := s.execute(runCtx, task, run.SessionID)
+		done <- result{output, toolCalls, err}
+	}()
+
+	var res result
+	stuck := false
+	select {
+	case res = <-done:
+	case <-runCtx.Done():
+		select {
+		case res = <-done:
+		case <-time.After(s.cancelGrace):
+			stuck = true
+		}
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		res.err = fmt.Errorf("run exceeded the max runtime of %s", maxRuntime)
+	} else if ctx.Err() != nil && res.err == nil {
+		res.err = ctx.Err()
+	}
+
+	finishedAt := time.Now()
+	var deliveries []ScheduledRunDelivery
+	if res.err == nil {
+		deliveries = s.deliverRunOutput(ctx, task, run, res.output, finishedAt)
+	}
+	s.finishRun(run, finishedAt, res.output, res.toolCalls, deliveries, res.err)
+	if stuck {
+		// The abandoned run may still be calling tools; a retry now would
+		// run alongside it.
+		slog.Warn("scheduler: run did not stop after cancellation, not retrying",
+			"task_id", task.ID, "attempt", attempt, "grace", s.cancelGrace)
+		return res.output, deliveries, backoff.Permanent(res.err)
+	}
+	return res.output, deliveries, res.err
+}
+
+// RunNow dispatches task immediately on a free worker without touching its
+// schedule. It returns errSchedulerBusy when every worker is taken.
+func (s *Scheduler) RunNow(task table.ScheduledTask) error {
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		return errSchedulerBusy
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			<-s.slots
+			s.wg.Done()
+		}()
+		if err := s.dispatch(s.baseCtx, task, constant.ScheduledRunTriggerManual); err != nil {
+			slog.Error("scheduler: manual task run failed",
+				"err", err, "task_id", task.ID, "title", task.Title, "user_id", task.UserID)
+		}
+	}()
+	return nil
+}
+
+// handleFailure bumps the consecutive failure counter, disables the task
+// once it reaches the threshold and sends an alert to target_email. It
+// reports whether the task was disabled.
+func (s *Scheduler) handleFailure(ctx context.Context, task table.ScheduledTask, attempts int, runErr error) bool {
+	failures := task.ConsecutiveFailures + 1
+	threshold := cmp.Or(task.FailureThreshold, tools.DefaultScheduledTaskFailureThreshold)
+	updates := map[string]any{"consecutive_failures": failures}
+	disabled := failures >= threshold
+	if disabled {
+		updates["enabled"] = false
+	}
+	if err := s.db.Model(&task).Updates(updates).Error; err != nil {
+		slog.Error("scheduler: failed to record failure", "err", err, "task_id", task.ID)
+	}
+	if disabled {
+		slog.Warn("scheduler: task disabled after consecutive failures",
+			"task_id", task.ID, "title", task.Title, "failures", failures)
+	}
+
+	if task.TargetEmail == "" || s.sendEmail == nil {
+		return disabled
+	}
+	subject := fmt.Sprintf("定时任务执行失败：%s", task.Title)
+	body := fmt.Sprintf("定时任务「%s」执行失败（共尝试 %d 次，已连续失败 %d 次）。\n\n错误信息：%s\n",
+		task.Title, attempts, failures, truncateRunes(runErr.Error(), scheduledRunResponseLimit))
+	if disabled {
+		body += fmt.Sprintf("\n连续失败次数已达到阈值 %d，任务已自动停用。请排查问题后在定时任务页面重新启用。\n", threshold)
+	}
+	alertCtx := context.WithValue(context.WithoutCancel(ctx), constant.ContextKeyUserID, task.UserID)
+	alertCtx = context.WithValue(alertCtx, constant.ContextKeyTx, s.db)
+	if err := s.sendEmail(alertCtx, task.TargetEmail, subject, body); err != nil {
+		slog.Error("scheduler: failed to send failure alert",
+			"err", err, "task_id", task.ID, "target_email", task.TargetEmail)
+	}
+	return disabled
+}
+
+// execute runs the task action in sessionID and returns the agent's final
+// text reply together with the tool calls it made.
+func (s *Scheduler) execute(ctx context.Context, task table.ScheduledTask, sessionID string) (string, []ScheduledRunToolCall, error) {
+	// The scheduler delivers the final reply to target_email and the other
+	// delivery targets itself, so the prompt is just the action.
+	return runBackgroundAgent(ctx, s.runner, s.session, s.db, task.UserID, sessionID, task.Action,
+		"task_id", task.ID, "title", task.Title)
+}
 
+// runBackgroundAgent runs prompt through r on behalf of userID in a new
+// scheduler session and returns the agent's final text reply together with
+// the tool calls it made. It is shared by the scheduler and event triggers;
+// logAttrs identify the caller in logs.
+func runBackgroundAgent(ctx context.Context, r *runner.Runner, svc session.Service, db *gorm.DB, userID int, sessionID, prompt string, logAttrs ...any) (string, []ScheduledRunToolCall, error) {
+	// Inject the owner's user_id and the shared db connection into the
+	// context so tools that call middleware.GetUserID() and middleware.GetTx()
+	// (e.g. send_email, manage_memory) resolve the correct values.
+	taskCtx := context.WithValue(ctx, constant.ContextKeyUserID, userID)
+	taskCtx = context.WithValue(taskCtx, constant.ContextKeyTx, db)
+
+	userIDStr := strconv.Itoa(userID)
 	createReq := &session.CreateRequest{
 		AppName:   constant.AppNameScheduler.String(),
 		UserID:    userIDStr,
 		SessionID: sessionID,
 		State:     map[string]any{},
 	}
-	if _, err := s.session.Create(taskCtx, createReq); err != nil {
-		return fmt.Errorf("failed to create session for scheduled task: %w", err)
+	if _, err := svc.Create(taskCtx, createReq); err != nil {
+		return "", nil, fmt.Errorf("failed to create session for background run: %w", err)
 	}
 
 	// Make session_id available in the context so tools that read it
 	// (e.g. scheduled_task_create) work correctly within this run.
 	taskCtx = context.WithValue(taskCtx, constant.ContextKeySessionID, sessionID)
-
-	// Build the prompt. If a target email was configured, append it so the
-	// executor agent knows where to deliver the result.
-	action := task.Action
-	if task.TargetEmail != "" {
-		action = fmt.Sprintf("%s\n请将结果发送到邮箱：%s", action, task.TargetEmail)
-	}
-	message := genai.NewContentFromText(action, genai.RoleUser)
+	message := genai.NewContentFromText(prompt, genai.RoleUser)
 
 	// Run the agent to completion, logging every event for observability.
 	runConfig := agent.RunConfig{StreamingMode: agent.StreamingModeNone}
-	var runErr error
+	var output string
+	var toolCalls []ScheduledRunToolCall
+	callIndex := map[string]int{}
 	eventCount := 0
-	for event, err := range s.runner.Run(taskCtx, userIDStr, sessionID, message, runConfig) {
+	for event, err := range r.Run(taskCtx, userIDStr, sessionID, message, runConfig) {
 		if err != nil {
-			runErr = err
-			slog.Error("scheduler: runner error",
-				"err", err, "task_id", task.ID, "title", task.Title)
-			break
+			slog.Error("scheduler: runner error", append([]any{"err", err}, logAttrs...)...)
+			return output, toolCalls, fmt.Errorf("runner error: %w", err)
 		}
-		if event == nil {
+		if event == nil || event.Content == nil || event.Partial {
 			continue
 		}
 		eventCount++
 
-		// Log function calls (tool invocations).
-		if event.Content != nil {
-			for _, part := range event.Content.Parts {
-				if part.FunctionCall != nil {
-					slog.Info("scheduler: tool call",
-						"task_id", task.ID, "author", event.Author,
-						"tool", part.FunctionCall.Name, "args", part.FunctionCall.Args)
-				}
-				if part.FunctionResponse != nil {
-					slog.Info("scheduler: tool result",
-						"task_id", task.ID, "author", event.Author,
-						"tool", part.FunctionResponse.Name, "response", part.FunctionResponse.Response)
-				}
+		var text strings.Builder
+		for _, part := range event.Content.Parts {
+			if part.FunctionCall != nil {
+				slog.Info("scheduler: tool call", append(logAttrs, "author", event.Author,
+					"tool", part.FunctionCall.Name, "args", part.FunctionCall.Args)...)
+				callIndex[part.FunctionCall.ID] = len(toolCalls)
+				toolCalls = append(toolCalls, ScheduledRunToolCall{
+					Name:   part.FunctionCall.Name,
+					Author: event.Author,
+					Args:   part.FunctionCall.Args,
+				})
 			}
-		}
-		// Log final text responses.
-		if event.LLMResponse.Content != nil && !event.LLMResponse.Partial {
-			for _, part := range event.LLMResponse.Content.Parts {
-				if part.Text != "" && !part.Thought {
-					slog.Info("scheduler: agent text",
-						"task_id", task.ID, "author", event.Author, "text", part.Text)
-				}
-				if part.FunctionCall != nil {
-					slog.Info("scheduler: llm tool call",
-						"task_id", task.ID, "author", event.Author,
-						"tool", part.FunctionCall.Name, "args", part.FunctionCall.Args)
+			if part.FunctionResponse != nil {
+				slog.Info("scheduler: tool result", append(logAttrs, "author", event.Author,
+					"tool", part.FunctionResponse.Name, "response", part.FunctionResponse.Response)...)
+				if i, ok := callIndex[part.FunctionResponse.ID]; ok {
+					response, _ := json.Marshal(part.FunctionResponse.Response)
+					toolCalls[i].Response = truncateRunes(string(response), scheduledRunResponseLimit)
 				}
 			}
+			if part.Text != "" && !part.Thought {
+				text.WriteString(part.Text)
+			}
+		}
+		// Keep the latest text reply as the run output.
+		if text.Len() > 0 {
+			slog.Info("scheduler: agent text", append(logAttrs, "author", event.Author, "text", text.String())...)
+			output = text.String()
 		}
 	}
-	slog.Info("scheduler: run finished", "task_id", task.ID, "event_count", eventCount)
+	slog.Info("scheduler: run finished", append(logAttrs, "event_count", eventCount)...)
+	return output, toolCalls, nil
+}
 
-	// Record last_run_at regardless of whether the run succeeded.
-	now := time.Now()
-	if err := s.db.Model(&task).Update("last_run_at", now).Error; err != nil {
-		slog.Error("scheduler: failed to update last_run_at",
-			"err", err, "task_id", task.ID)
+// finishRun stores the outcome of a run and of its deliveries. Failures are
+// only logged because the run itself has already happened.
+func (s *Scheduler) finishRun(run table.ScheduledTaskRun, finishedAt time.Time, output string, toolCalls []ScheduledRunToolCall, deliveries []ScheduledRunDelivery, runErr error) {
+	if run.ID == 0 {
+		return
 	}
 
+	updates := map[string]any{
+		"status":      constant.ScheduledRunStatusSucceeded,
+		"finished_at": finishedAt,
+		"output":      output,
+		"tool_calls":  "",
+		"deliveries":  "",
+	}
+	if len(toolCalls) > 0 {
+		data, err := json.Marshal(toolCalls)
+		if err != nil {
+			slog.Error("scheduler: failed to encode tool calls", "err", err, "run_id", run.ID)
+		} else {
+			updates["tool_calls"] = string(data)
+		}
+	}
+	if len(deliveries) > 0 {
+		data, err := json.Marshal(deliveries)
+		if err != nil {
+			slog.Error("scheduler: failed to encode deliveries", "err", err, "run_id", run.ID)
+		} else {
+			updates["deliveries"] = string(data)
+		}
+	}
 	if runErr != nil {
-		return fmt.Errorf("runner error: %w", runErr)
+		updates["status"] = constant.ScheduledRunStatusFailed
+		updates["error"] = runErr.Error()
+	}
+	if err := s.db.Model(&run).Updates(updates).Error; err != nil {
+		slog.Error("scheduler: failed to update run record", "err", err, "run_id", run.ID)
 	}
-
-	slog.Info("scheduler: task completed successfully",
-		"task_id", task.ID, "title", task.Title, "user_id", task.UserID)
-	return nil
 }
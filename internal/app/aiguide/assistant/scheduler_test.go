@@ -2,10 +2,21 @@ package assistant
 
 import (
 	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -18,16 +29,25 @@ func setupSchedulerTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("gorm.Open() error: %v", err)
 	}
 
-	if err := db.AutoMigrate(&table.ScheduledTask{}); err != nil {
+	if err := db.AutoMigrate(&table.User{}, &table.ScheduledTask{}, &table.ScheduledTaskRun{}, &table.ScheduledTaskDelivery{}, &table.Notification{},
+		&table.EventTrigger{}, &table.EventTriggerRun{}); err != nil {
 		t.Fatalf("AutoMigrate() error: %v", err)
 	}
+	// Tasks, triggers and bot links in the tests belong to these members.
+	owners := []table.User{
+		{Model: table.Model{ID: 1}, Role: constant.UserRoleMember},
+		{Model: table.Model{ID: 7}, Role: constant.UserRoleMember},
+	}
+	if err := db.Create(&owners).Error; err != nil {
+		t.Fatalf("failed to create users: %v", err)
+	}
 
 	return db
 }
 
 func TestScheduler_AdvanceNextRunAt_Daily(t *testing.T) {
 	db := setupSchedulerTestDB(t)
-	s := newScheduler(db, nil, nil)
+	s := newScheduler(db, nil, nil, 0)
 
 	now := time.Date(2026, 2, 25, 9, 0, 0, 0, time.UTC)
 	task := table.ScheduledTask{
@@ -44,8 +64,8 @@ func TestScheduler_AdvanceNextRunAt_Daily(t *testing.T) {
 		t.Fatalf("db.Create() error: %v", err)
 	}
 
-	if err := s.advanceNextRunAt(task, now); err != nil {
-		t.Fatalf("advanceNextRunAt() error: %v", err)
+	if claimed, err := s.advanceNextRunAt(task, now); err != nil || !claimed {
+		t.Fatalf("advanceNextRunAt() = %v, %v, want claimed", claimed, err)
 	}
 
 	var updated table.ScheduledTask
@@ -65,7 +85,7 @@ func TestScheduler_AdvanceNextRunAt_Daily(t *testing.T) {
 
 func TestScheduler_AdvanceNextRunAt_Once(t *testing.T) {
 	db := setupSchedulerTestDB(t)
-	s := newScheduler(db, nil, nil)
+	s := newScheduler(db, nil, nil, 0)
 
 	now := time.Now()
 	task := table.ScheduledTask{
@@ -82,8 +102,8 @@ func TestScheduler_AdvanceNextRunAt_Once(t *testing.T) {
 		t.Fatalf("db.Create() error: %v", err)
 	}
 
-	if err := s.advanceNextRunAt(task, now); err != nil {
-		t.Fatalf("advanceNextRunAt() error: %v", err)
+	if claimed, err := s.advanceNextRunAt(task, now); err != nil || !claimed {
+		t.Fatalf("advanceNextRunAt() = %v, %v, want claimed", claimed, err)
 	}
 
 	var updated table.ScheduledTask
@@ -98,7 +118,7 @@ func TestScheduler_AdvanceNextRunAt_Once(t *testing.T) {
 
 func TestScheduler_AdvanceNextRunAt_Weekly(t *testing.T) {
 	db := setupSchedulerTestDB(t)
-	s := newScheduler(db, nil, nil)
+	s := newScheduler(db, nil, nil, 0)
 
 	// 2026-02-25 is a Wednesday (weekday=3). Schedule weekly on Wednesday at 08:00.
 	// Now is 09:00 Wednesday → next should be next Wednesday.
@@ -118,8 +138,8 @@ func TestScheduler_AdvanceNextRunAt_Weekly(t *testing.T) {
 		t.Fatalf("db.Create() error: %v", err)
 	}
 
-	if err := s.advanceNextRunAt(task, now); err != nil {
-		t.Fatalf("advanceNextRunAt() error: %v", err)
+	if claimed, err := s.advanceNextRunAt(task, now); err != nil || !claimed {
+		t.Fatalf("advanceNextRunAt() = %v, %v, want claimed", claimed, err)
 	}
 
 	var updated table.ScheduledTask
@@ -133,6 +153,42 @@ func TestScheduler_AdvanceNextRunAt_Weekly(t *testing.T) {
 	}
 }
 
+func TestScheduler_AdvanceNextRunAt_Interval(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	s := newScheduler(db, nil, nil, 0)
+
+	// The slot fired at 09:00 but the scheduler only got to it at 09:00:40;
+	// the next run must stay aligned to the 30-minute grid.
+	slot := time.Date(2026, 2, 25, 9, 0, 0, 0, time.UTC)
+	now := slot.Add(40 * time.Second)
+	task := table.ScheduledTask{
+		UserID:          1,
+		Title:           "price check",
+		Action:          "check prices",
+		ScheduleType:    "interval",
+		IntervalMinutes: 30,
+		Timezone:        "UTC",
+		Enabled:         true,
+		NextRunAt:       slot,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	if claimed, err := s.advanceNextRunAt(task, now); err != nil || !claimed {
+		t.Fatalf("advanceNextRunAt() = %v, %v, want claimed", claimed, err)
+	}
+
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	expected := slot.Add(30 * time.Minute)
+	if !updated.NextRunAt.Equal(expected) {
+		t.Errorf("NextRunAt = %v, want %v", updated.NextRunAt, expected)
+	}
+}
+
 // TestScheduler_Tick_PicksUpDueTasks verifies that tick() queries for tasks
 // whose next_run_at is in the past (and advances them) without actually
 // invoking the runner (which is nil in this test).
@@ -143,7 +199,7 @@ func TestScheduler_Tick_PicksUpDueTasks(t *testing.T) {
 	// it skips dispatch. Here once-tasks are disabled synchronously before
 	// any goroutine is spawned, so we can assert on DB state directly.
 
-	s := newScheduler(db, nil, nil)
+	s := newScheduler(db, nil, nil, 0)
 
 	now := time.Now()
 
@@ -207,3 +263,556 @@ func TestScheduler_Tick_PicksUpDueTasks(t *testing.T) {
 			updatedFuture.NextRunAt, originalFutureNextRunAt)
 	}
 }
+
+// newFakeSchedulerRunner returns a runner whose agent calls current_time and
+// then replies with a summary. The action "fail" always fails, "flaky" fails
+// on its first attempt and "hang" blocks without honouring cancellation.
+func newFakeSchedulerRunner(t *testing.T, svc session.Service) *runner.Runner {
+	t.Helper()
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	hang := make(chan struct{})
+	t.Cleanup(func() { close(hang) })
+	return newScriptedRunner(t, svc, constant.AppNameScheduler, func(ctx agent.InvocationContext) ([]model.LLMResponse, error) {
+		action, _, _ := strings.Cut(ctx.UserContent().Parts[0].Text, "\n")
+		mu.Lock()
+		attempts[action]++
+		attempt := attempts[action]
+		mu.Unlock()
+
+		switch {
+		case action == "fail" || (action == "flaky" && attempt == 1):
+			return nil, errors.New("model unavailable")
+		case action == "hang":
+			<-hang
+			return nil, nil
+		}
+		return []model.LLMResponse{
+			{Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "c1", Name: "current_time", Args: map[string]any{"timezone": "UTC"}}}}}},
+			{Content: &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "c1", Name: "current_time", Response: map[string]any{"time": "09:00"}}}}}},
+			{Content: genai.NewContentFromText("It is 09:00.", genai.RoleModel)},
+		}, nil
+	})
+}
+
+func TestScheduler_Dispatch_RecordsRuns(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+
+	task := table.ScheduledTask{
+		UserID:       1,
+		Title:        "time check",
+		Action:       "what time is it",
+		ScheduleType: "daily",
+		RunAt:        "08:00",
+		Timezone:     "UTC",
+		Enabled:      true,
+		NextRunAt:    time.Now(),
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	if err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule); err != nil {
+		t.Fatalf("dispatch() error: %v", err)
+	}
+	task.Action = "fail"
+	if err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule); err == nil {
+		t.Fatal("dispatch() expected error for a failing run")
+	}
+
+	var runs []table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).Order("id").Find(&runs).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(runs))
+	}
+
+	ok := runs[0]
+	if ok.Status != constant.ScheduledRunStatusSucceeded || ok.Output != "It is 09:00." || ok.FinishedAt == nil {
+		t.Fatalf("successful run = %+v", ok)
+	}
+	if !strings.HasPrefix(ok.SessionID, "scheduled-") {
+		t.Fatalf("SessionID = %q, want scheduled-<id>-<ts>", ok.SessionID)
+	}
+	var toolCalls []ScheduledRunToolCall
+	if err := json.Unmarshal([]byte(ok.ToolCalls), &toolCalls); err != nil {
+		t.Fatalf("failed to decode tool calls: %v", err)
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Name != "current_time" || !strings.Contains(toolCalls[0].Response, "09:00") {
+		t.Fatalf("ToolCalls = %+v, want one current_time call with its response", toolCalls)
+	}
+	if _, err := svc.Get(context.Background(), &session.GetRequest{
+		AppName: constant.AppNameScheduler.String(), UserID: "1", SessionID: ok.SessionID,
+	}); err != nil {
+		t.Fatalf("run session not found: %v", err)
+	}
+
+	failed := runs[1]
+	if failed.Status != constant.ScheduledRunStatusFailed || !strings.Contains(failed.Error, "model unavailable") {
+		t.Fatalf("failed run = %+v", failed)
+	}
+
+	var notifications []table.Notification
+	if err := db.Where("user_id = ?", 1).Order("id").Find(&notifications).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(notifications) != 2 || notifications[0].Kind != constant.NotificationKindScheduledTaskRun ||
+		notifications[0].Title != "定时任务已运行：time check" || notifications[0].Body != "It is 09:00." ||
+		notifications[1].Title != "定时任务执行失败：time check" || !strings.Contains(notifications[1].Body, "model unavailable") {
+		t.Fatalf("notifications = %+v, want one per finished dispatch", notifications)
+	}
+}
+
+func TestScheduler_Dispatch_RetriesFailedRuns(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+	s.retryInterval = time.Millisecond
+
+	task := table.ScheduledTask{
+		UserID: 1, Title: "flaky", Action: "flaky", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Now(), MaxRetries: 2, ConsecutiveFailures: 1,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	if err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule); err != nil {
+		t.Fatalf("dispatch() error: %v", err)
+	}
+
+	var runs []table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).Order("id").Find(&runs).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Status != constant.ScheduledRunStatusFailed || runs[1].Status != constant.ScheduledRunStatusSucceeded || runs[1].Attempt != 2 {
+		t.Fatalf("runs = %+v, want a failed first attempt and a successful retry", runs)
+	}
+	if runs[0].SessionID == runs[1].SessionID {
+		t.Fatal("retry reused the session of the failed attempt")
+	}
+
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if updated.ConsecutiveFailures != 0 {
+		t.Fatalf("ConsecutiveFailures = %d, want reset to 0", updated.ConsecutiveFailures)
+	}
+}
+
+func TestScheduler_Dispatch_DisablesAfterThresholdAndAlerts(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+	s.retryInterval = time.Millisecond
+
+	type alert struct {
+		userID      any
+		to, subject string
+		body        string
+	}
+	var alerts []alert
+	s.sendEmail = func(ctx context.Context, to, subject, body string) error {
+		alerts = append(alerts, alert{ctx.Value(constant.ContextKeyUserID), to, subject, body})
+		return nil
+	}
+
+	task := table.ScheduledTask{
+		UserID: 7, Title: "report", Action: "fail", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Now(), TargetEmail: "owner@example.com",
+		MaxRetries: 1, FailureThreshold: 2,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := db.First(&task, task.ID).Error; err != nil {
+			t.Fatalf("db.First() error: %v", err)
+		}
+		if err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule); err == nil {
+			t.Fatal("dispatch() expected error")
+		}
+	}
+
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if updated.Enabled || updated.ConsecutiveFailures != 2 {
+		t.Fatalf("task = enabled %v, failures %d, want disabled after 2 failures", updated.Enabled, updated.ConsecutiveFailures)
+	}
+	var runCount int64
+	db.Model(&table.ScheduledTaskRun{}).Where("scheduled_task_id = ?", task.ID).Count(&runCount)
+	if runCount != 4 {
+		t.Fatalf("recorded %d runs, want 4 (2 dispatches x 2 attempts)", runCount)
+	}
+
+	if len(alerts) != 2 {
+		t.Fatalf("sent %d alerts, want 2", len(alerts))
+	}
+	last := alerts[1]
+	if last.to != "owner@example.com" || last.userID != 7 || !strings.Contains(last.subject, "report") {
+		t.Fatalf("alert = %+v", last)
+	}
+	if !strings.Contains(last.body, "model unavailable") || !strings.Contains(last.body, "自动停用") {
+		t.Fatalf("alert body = %q, want error summary and disable notice", last.body)
+	}
+	if strings.Contains(alerts[0].body, "自动停用") {
+		t.Fatalf("first alert body = %q, should not mention disabling", alerts[0].body)
+	}
+
+	var notifications []table.Notification
+	if err := db.Where("user_id = ?", 7).Order("id").Find(&notifications).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(notifications) != 2 || notifications[0].Title != "定时任务执行失败：report" ||
+		notifications[1].Title != "定时任务已停用：report" || !strings.Contains(notifications[1].Body, "自动停用") {
+		t.Fatalf("notifications = %+v, want a failure and then a disable notice", notifications)
+	}
+}
+
+func TestScheduler_Dispatch_EnforcesMaxRuntime(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+	s.defaultMaxRuntime = 50 * time.Millisecond
+	s.cancelGrace = 10 * time.Millisecond
+
+	task := table.ScheduledTask{
+		UserID: 1, Title: "stuck", Action: "hang", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Now(),
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	start := time.Now()
+	err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule)
+	if err == nil || !strings.Contains(err.Error(), "max runtime") {
+		t.Fatalf("dispatch() error = %v, want max runtime error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("dispatch() took %s despite the max runtime", elapsed)
+	}
+
+	var run table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).First(&run).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if run.Status != constant.ScheduledRunStatusFailed || run.FinishedAt == nil {
+		t.Fatalf("run = %+v, want a finished failed run", run)
+	}
+}
+
+func TestScheduler_Dispatch_DoesNotRetryStuckRuns(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 0)
+	s.retryInterval = time.Millisecond
+	s.defaultMaxRuntime = 50 * time.Millisecond
+	s.cancelGrace = 10 * time.Millisecond
+
+	task := table.ScheduledTask{
+		UserID: 1, Title: "stuck", Action: "hang", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: time.Now(), MaxRetries: 2,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	err := s.dispatch(context.Background(), task, constant.ScheduledRunTriggerSchedule)
+	if err == nil || !strings.Contains(err.Error(), "max runtime") {
+		t.Fatalf("dispatch() error = %v, want max runtime error", err)
+	}
+
+	// The first attempt ignores cancellation, so a retry would overlap it.
+	var runCount int64
+	db.Model(&table.ScheduledTaskRun{}).Where("scheduled_task_id = ?", task.ID).Count(&runCount)
+	if runCount != 1 {
+		t.Fatalf("recorded %d runs, want 1 with no retries while the first is still running", runCount)
+	}
+}
+
+func TestScheduler_AdvanceNextRunAt_ClaimsOnce(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	first := newScheduler(db, nil, nil, 0)
+	second := newScheduler(db, nil, nil, 0)
+
+	now := time.Now()
+	tasks := []table.ScheduledTask{
+		{UserID: 1, Title: "daily", Action: "a", ScheduleType: "daily", RunAt: "08:00", Timezone: "UTC", Enabled: true, NextRunAt: now.Add(-time.Minute)},
+		{UserID: 1, Title: "once", Action: "a", ScheduleType: "once", RunAt: now.Add(-time.Minute).Format(time.RFC3339), Timezone: "UTC", Enabled: true, NextRunAt: now.Add(-time.Minute)},
+	}
+	for i := range tasks {
+		if err := db.Create(&tasks[i]).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+
+	// Both processes loaded the same due rows; only the first claim wins.
+	for _, task := range tasks {
+		claimed, err := first.advanceNextRunAt(task, now)
+		if err != nil || !claimed {
+			t.Fatalf("first claim of %s = %v, %v, want claimed", task.Title, claimed, err)
+		}
+		claimed, err = second.advanceNextRunAt(task, now)
+		if err != nil || claimed {
+			t.Fatalf("second claim of %s = %v, %v, want not claimed", task.Title, claimed, err)
+		}
+	}
+}
+
+func TestScheduler_Tick_RespectsWorkerLimit(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	s := newScheduler(db, nil, nil, 2)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		task := table.ScheduledTask{
+			UserID: 1, Title: "due", Action: "a", ScheduleType: "daily", RunAt: "08:00",
+			Timezone: "UTC", Enabled: true, NextRunAt: now.Add(-time.Duration(3-i) * time.Minute),
+		}
+		if err := db.Create(&task).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+	}
+
+	// Occupy one of the two slots so only one task may be claimed.
+	s.slots <- struct{}{}
+	s.tick(context.Background())
+	s.wg.Wait()
+
+	var due int64
+	if err := db.Model(&table.ScheduledTask{}).Where("next_run_at <= ?", now).Count(&due).Error; err != nil {
+		t.Fatalf("db.Count() error: %v", err)
+	}
+	if due != 2 {
+		t.Fatalf("%d tasks still due, want 2 left for other workers", due)
+	}
+	if len(s.slots) != 1 {
+		t.Fatalf("%d slots held after dispatch finished, want 1", len(s.slots))
+	}
+}
+
+func TestScheduler_Tick_MissedRunPolicy(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	s := newScheduler(db, nil, nil, 0)
+
+	now := time.Now().UTC()
+	missed := now.Add(-3 * time.Hour).Truncate(time.Minute)
+	newTask := func(policy string) table.ScheduledTask {
+		task := table.ScheduledTask{
+			UserID: 1, Title: policy, Action: "a", ScheduleType: "interval", IntervalMinutes: 60,
+			RunAt: missed.Format(time.RFC3339), Timezone: "UTC", Enabled: true,
+			MissedRunPolicy: policy, NextRunAt: missed,
+		}
+		if err := db.Create(&task).Error; err != nil {
+			t.Fatalf("db.Create() error: %v", err)
+		}
+		return task
+	}
+	skip := newTask("skip")
+	runOnce := newTask("run_once")
+	runAll := newTask("run_all")
+
+	s.tick(context.Background())
+	s.wg.Wait()
+
+	var runs []table.ScheduledTaskRun
+	if err := db.Find(&runs).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	for _, run := range runs {
+		if run.ScheduledTaskID == skip.ID && run.Status != constant.ScheduledRunStatusSkipped {
+			t.Fatalf("skip task was dispatched: %+v", run)
+		}
+	}
+
+	nextRunAt := func(task table.ScheduledTask) time.Time {
+		var updated table.ScheduledTask
+		if err := db.First(&updated, task.ID).Error; err != nil {
+			t.Fatalf("db.First() error: %v", err)
+		}
+		return updated.NextRunAt
+	}
+	// skip and run_once continue with the first future slot.
+	for _, task := range []table.ScheduledTask{skip, runOnce} {
+		if got := nextRunAt(task); !got.After(now) || got.After(now.Add(time.Hour)) {
+			t.Errorf("%s NextRunAt = %v, want the next slot after %v", task.Title, got, now)
+		}
+	}
+	// run_all advances one slot at a time so the remaining missed runs stay due.
+	if got, want := nextRunAt(runAll), missed.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("run_all NextRunAt = %v, want %v", got, want)
+	}
+}
+
+func TestScheduler_Tick_SkipsBlackoutDates(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	s := newScheduler(db, nil, nil, 0)
+
+	now := time.Now().UTC()
+	dueAt := now.Add(-time.Minute)
+	task := table.ScheduledTask{
+		UserID: 1, Title: "holiday", Action: "a", ScheduleType: "daily", RunAt: dueAt.Format("15:04"),
+		Timezone: "UTC", Enabled: true, NextRunAt: dueAt,
+		BlackoutDates: `["` + dueAt.Format(time.DateOnly) + `"]`,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	s.tick(context.Background())
+	s.wg.Wait()
+
+	var runs []table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).Find(&runs).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Status != constant.ScheduledRunStatusSkipped || !strings.Contains(runs[0].Error, "blackout") {
+		t.Fatalf("runs = %+v, want one skipped run on the blackout date", runs)
+	}
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if updated.NextRunAt.Format(time.DateOnly) == dueAt.Format(time.DateOnly) || !updated.NextRunAt.After(now) {
+		t.Fatalf("NextRunAt = %v, want a slot after the blackout date", updated.NextRunAt)
+	}
+}
+
+func TestScheduler_Tick_SkipsReadOnlyOwner(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	// No runner: dispatching the task would fail the run instead of skipping it.
+	s := newScheduler(db, nil, nil, 0)
+	if err := db.Model(&table.User{}).Where("id = ?", 7).Update("role", constant.UserRoleReadOnly).Error; err != nil {
+		t.Fatalf("db.Update() error: %v", err)
+	}
+
+	now := time.Now().UTC()
+	task := table.ScheduledTask{
+		UserID: 7, Title: "report", Action: "a", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: now.Add(-time.Minute),
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	s.tick(context.Background())
+	s.wg.Wait()
+
+	var runs []table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).Find(&runs).Error; err != nil {
+		t.Fatalf("db.Find() error: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Status != constant.ScheduledRunStatusSkipped || !strings.Contains(runs[0].Error, "read-only") {
+		t.Fatalf("runs = %+v, want one skipped run naming the read-only owner", runs)
+	}
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if !updated.NextRunAt.After(now) || updated.ConsecutiveFailures != 0 {
+		t.Fatalf("task = %+v, want the slot claimed without counting a failure", updated)
+	}
+}
+
+func TestScheduler_Tick_RecordsSkippedOnceTask(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	s := newScheduler(db, nil, nil, 0)
+
+	dueAt := time.Now().UTC().Add(-time.Minute)
+	task := table.ScheduledTask{
+		UserID: 1, Title: "reminder", Action: "a", ScheduleType: "once", RunAt: dueAt.Format(time.RFC3339),
+		Timezone: "UTC", Enabled: true, NextRunAt: dueAt,
+		BlackoutDates: `["` + dueAt.Format(time.DateOnly) + `"]`,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	s.tick(context.Background())
+	s.wg.Wait()
+
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if updated.Enabled {
+		t.Fatal("once task is still enabled after its only slot was skipped")
+	}
+	var run table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).First(&run).Error; err != nil {
+		t.Fatalf("no run recorded for the skipped slot: %v", err)
+	}
+	if run.Status != constant.ScheduledRunStatusSkipped || run.FinishedAt == nil {
+		t.Fatalf("run = %+v, want a finished skipped run", run)
+	}
+	var notification table.Notification
+	if err := db.Where("user_id = ?", task.UserID).First(&notification).Error; err != nil {
+		t.Fatalf("owner was not notified of the skipped run: %v", err)
+	}
+	if notification.Kind != constant.NotificationKindScheduledTaskRun || !strings.Contains(notification.Body, "blackout") {
+		t.Fatalf("notification = %+v, want a scheduled task run notice naming the blackout", notification)
+	}
+
+	// A second tick must not record the slot again.
+	s.tick(context.Background())
+	s.wg.Wait()
+	var count int64
+	if err := db.Model(&table.ScheduledTaskRun{}).Where("scheduled_task_id = ?", task.ID).Count(&count).Error; err != nil {
+		t.Fatalf("db.Count() error: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("got %d runs, want the skipped slot recorded once", count)
+	}
+}
+
+func TestScheduler_RunNow(t *testing.T) {
+	db := setupSchedulerTestDB(t)
+	svc := session.InMemoryService()
+	s := newScheduler(db, newFakeSchedulerRunner(t, svc), svc, 1)
+
+	nextRunAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	task := table.ScheduledTask{
+		UserID: 1, Title: "manual", Action: "fail", ScheduleType: "daily", RunAt: "08:00",
+		Timezone: "UTC", Enabled: true, NextRunAt: nextRunAt,
+	}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("db.Create() error: %v", err)
+	}
+
+	s.slots <- struct{}{}
+	if err := s.RunNow(task); !errors.Is(err, errSchedulerBusy) {
+		t.Fatalf("RunNow() with no free worker = %v, want errSchedulerBusy", err)
+	}
+	<-s.slots
+
+	if err := s.RunNow(task); err != nil {
+		t.Fatalf("RunNow() error: %v", err)
+	}
+	s.wg.Wait()
+
+	var run table.ScheduledTaskRun
+	if err := db.Where("scheduled_task_id = ?", task.ID).First(&run).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if run.Trigger != constant.ScheduledRunTriggerManual || run.Status != constant.ScheduledRunStatusFailed {
+		t.Fatalf("run = %+v, want a failed manual run", run)
+	}
+
+	// Manual runs leave the schedule and the failure counter alone.
+	var updated table.ScheduledTask
+	if err := db.First(&updated, task.ID).Error; err != nil {
+		t.Fatalf("db.First() error: %v", err)
+	}
+	if !updated.NextRunAt.Equal(nextRunAt) || updated.ConsecutiveFailures != 0 || !updated.Enabled {
+		t.Fatalf("task = %+v, want schedule and failure counter unchanged", updated)
+	}
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/adk/session"
+	"gorm.io/gorm"
 )
 
 const defaultImageMimeType = "image/png"
@@ -412,8 +413,8 @@ func buildMessageEvents(events session.Events, locale string) []MessageEvent {
 					continue
 				}
 				text := part.Text
-				// 移除自动注入的用户记忆上下文，不暴露给前端
-				text = stripUserContext(text)
+				// 移除自动注入的用户记忆和计划执行结果，不暴露给前端
+				text = stripInjectedContext(text)
 				// 解析文件名元数据
 				if parsedText, parsedFileNames, ok := extractFileNamesMetadata(text); ok {
 					text = parsedText
@@ -583,22 +584,27 @@ func isDuplicateRetryUserMessage(allMessages []MessageEvent, current MessageEven
 		slices.Equal(last.Files, current.Files)
 }
 
-// stripUserContext 移除消息文本中自动注入的 <user_context> 块
-func stripUserContext(text string) string {
-	const openTag = "<user_context>\n"
-	const closeTag = "</user_context>\n"
-	for {
-		start := strings.Index(text, openTag)
-		if start == -1 {
-			break
-		}
-		end := strings.Index(text[start:], closeTag)
-		if end == -1 {
-			// 没有闭合标签，截断到 openTag 之前
-			text = text[:start]
-			break
+// injectedContextTags 是服务端自动注入到用户消息中的上下文块标签
+var injectedContextTags = []string{"user_context", "plan_results"}
+
+// stripInjectedContext 移除消息文本中自动注入的 <user_context>、<plan_results> 等块
+func stripInjectedContext(text string) string {
+	for _, tag := range injectedContextTags {
+		openTag := "<" + tag + ">\n"
+		closeTag := "</" + tag + ">\n"
+		for {
+			start := strings.Index(text, openTag)
+			if start == -1 {
+				break
+			}
+			end := strings.Index(text[start:], closeTag)
+			if end == -1 {
+				// 没有闭合标签，截断到 openTag 之前
+				text = text[:start]
+				break
+			}
+			text = text[:start] + text[start+end+len(closeTag):]
 		}
-		text = text[:start] + text[start+end+len(closeTag):]
 	}
 	return text
 }
@@ -672,6 +678,13 @@ func (a *Assistant) CreateSession(ctx *gin.Context) {
 		return
 	}
 
+	if authUserID, ok := getContextUserID(ctx); ok {
+		if err := a.claimSessionMeta(sessionID, authUserID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session owner"})
+			return
+		}
+	}
+
 	if req.ProjectID != 0 {
 		if err := a.upsertSessionProjectMeta(sessionID, req.ProjectID); err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session project"})
@@ -721,6 +734,51 @@ func (a *Assistant) DeleteSession(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "session deleted successfully"})
 }
 
+var errSessionNotFound = errors.New("session not found")
+
+// claimSessionMeta 为新会话创建记录所属用户的元数据。
+// 已有的元数据保持原归属：历史会话的归属由迁移按 ADK 会话表回填，不能被先访问的用户认领
+func (a *Assistant) claimSessionMeta(sessionID string, userID int) error {
+	meta := table.SessionMeta{
+		SessionID: sessionID,
+		UserID:    userID,
+		ThreadID:  sessionID,
+		Version:   1,
+	}
+	if err := a.db.Where("session_id = ?", sessionID).FirstOrCreate(&meta).Error; err != nil {
+		slog.Error("failed to create session meta", "err", err, "session_id", sessionID)
+		return fmt.Errorf("failed to create session meta: %w", err)
+	}
+	return nil
+}
+
+// ensureSessionOwnership 通过会话元数据校验会话属于该用户。
+// 没有元数据的会话回退到 ADK 会话表确认并补写；迁移后仍未归属的元数据不属于任何用户。
+func (a *Assistant) ensureSessionOwnership(userID int, sessionID string) error {
+	var meta table.SessionMeta
+	err := a.db.Where("session_id = ?", sessionID).First(&meta).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Error("failed to find session meta", "err", err, "session_id", sessionID)
+		return fmt.Errorf("failed to find session meta: %w", err)
+	}
+	if err == nil {
+		if meta.UserID != userID {
+			return errSessionNotFound
+		}
+		return nil
+	}
+
+	var count int64
+	if err := a.db.Table("sessions").Where("id = ? AND user_id = ?", sessionID, strconv.Itoa(userID)).Count(&count).Error; err != nil {
+		slog.Error("failed to query session owner", "err", err, "session_id", sessionID)
+		return fmt.Errorf("failed to query session owner: %w", err)
+	}
+	if count == 0 {
+		return errSessionNotFound
+	}
+	return a.claimSessionMeta(sessionID, userID)
+}
+
 // generateSessionID 生成唯一的会话 ID
 func generateSessionID() string {
 	return "session-" + time.Now().Format("20060102-150405") + "-" + randomString(8)
@@ -251,6 +251,7 @@ func (a *Assistant) createEditedSessionMeta(parentSessionID, newSessionID, messa
 	newVersion := parentVersion + 1
 	newMeta := table.SessionMeta{
 		SessionID:           newSessionID,
+		UserID:              parentMeta.UserID,
 		Title:               parentMeta.Title,
 		ThreadID:            threadID,
 		ProjectID:           parentMeta.ProjectID,
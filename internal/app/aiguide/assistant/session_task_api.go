@@ -0,0 +1,467 @@
+package assistant
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errInvalidTaskRelation = errors.New("invalid task relation")
+
+// taskMutatingTools 是会修改任务状态的工具，其结果触发 task_updated 事件
+var taskMutatingTools = map[string]bool{
+	"task_create": true,
+	"task_update": true,
+}
+
+// SessionTask 会话任务的响应结构，Children 为按 ParentID 组织的子任务，DependsOn 为依赖边
+type SessionTask struct {
+	ID          int                   `json:"id"`
+	ParentID    int                   `json:"parent_id"`
+	Title       string                `json:"title"`
+	Description string                `json:"description"`
+	Status      constant.TaskStatus   `json:"status"`
+	Priority    constant.TaskPriority `json:"priority"`
+	DependsOn   []int                 `json:"depends_on"`
+	Position    int                   `json:"position"`
+	Result      string                `json:"result,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	Children    []*SessionTask        `json:"children,omitempty"`
+}
+
+func newSessionTask(task table.Task) *SessionTask {
+	dependsOn, err := parseTaskDependsOn(task.DependsOn)
+	if err != nil {
+		slog.Warn("invalid task dependencies", "task_id", task.ID, "depends_on", task.DependsOn, "err", err)
+	}
+	if dependsOn == nil {
+		dependsOn = []int{}
+	}
+	return &SessionTask{
+		ID:          task.ID,
+		ParentID:    task.ParentID,
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      task.Status,
+		Priority:    task.Priority,
+		DependsOn:   dependsOn,
+		Position:    task.Position,
+		Result:      task.Result,
+		CreatedAt:   task.CreatedAt,
+		UpdatedAt:   task.UpdatedAt,
+	}
+}
+
+// buildSessionTaskTree 按 ParentID 组织任务树，父任务不在列表中的任务作为根节点
+func buildSessionTaskTree(tasks []table.Task) []*SessionTask {
+	nodes := make(map[int]*SessionTask, len(tasks))
+	for _, task := range tasks {
+		nodes[task.ID] = newSessionTask(task)
+	}
+
+	roots := make([]*SessionTask, 0, len(tasks))
+	for _, task := range tasks {
+		node := nodes[task.ID]
+		if parent, ok := nodes[task.ParentID]; ok && task.ParentID != task.ID {
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// ListSessionTasks 返回会话的任务树
+// GET /api/assistant/sessions/:sessionId/tasks
+func (a *Assistant) ListSessionTasks(ctx *gin.Context) {
+	sessionID, ok := a.sessionTaskAccess(ctx)
+	if !ok {
+		return
+	}
+
+	tasks, err := a.loadSessionTasks(sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load tasks"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"tasks": buildSessionTaskTree(tasks),
+		"count": len(tasks),
+	})
+}
+
+// GetSessionTask 返回会话中的单个任务
+// GET /api/assistant/sessions/:sessionId/tasks/:taskId
+func (a *Assistant) GetSessionTask(ctx *gin.Context) {
+	sessionID, ok := a.sessionTaskAccess(ctx)
+	if !ok {
+		return
+	}
+
+	task, ok := a.findSessionTask(ctx, sessionID)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSessionTask(task))
+}
+
+type CreateSessionTaskRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	ParentID    int    `json:"parent_id"`
+	DependsOn   []int  `json:"depends_on"`
+	Priority    int    `json:"priority"`
+}
+
+// CreateSessionTask 在会话中添加任务，新任务排在最后
+// POST /api/assistant/sessions/:sessionId/tasks
+func (a *Assistant) CreateSessionTask(ctx *gin.Context) {
+	sessionID, ok := a.sessionTaskAccess(ctx)
+	if !ok {
+		return
+	}
+
+	var req CreateSessionTaskRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind create task request", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		return
+	}
+	priority := constant.TaskPriority(req.Priority)
+	if !priority.Valid() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority"})
+		return
+	}
+
+	tasks, err := a.loadSessionTasks(sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create task"})
+		return
+	}
+	task := table.Task{
+		SessionID:   sessionID,
+		ParentID:    req.ParentID,
+		Title:       title,
+		Description: req.Description,
+		Status:      constant.TaskStatusPending,
+		Priority:    priority,
+		DependsOn:   "[]",
+	}
+	if err := validateTaskRelations(tasks, task, req.DependsOn); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DependsOn != nil {
+		dependsOn, _ := json.Marshal(req.DependsOn)
+		task.DependsOn = string(dependsOn)
+	}
+	for _, existing := range tasks {
+		task.Position = max(task.Position, existing.Position+1)
+	}
+
+	if err := a.db.Create(&task).Error; err != nil {
+		slog.Error("failed to create task", "err", err, "session_id", sessionID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create task"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSessionTask(task))
+}
+
+type UpdateSessionTaskRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Status      *string `json:"status"`
+	Result      *string `json:"result"`
+	Priority    *int    `json:"priority"`
+	ParentID    *int    `json:"parent_id"`
+	DependsOn   *[]int  `json:"depends_on"`
+}
+
+// UpdateSessionTask 更新任务的状态、内容或依赖，未提供的字段保持不变
+// PATCH /api/assistant/sessions/:sessionId/tasks/:taskId
+func (a *Assistant) UpdateSessionTask(ctx *gin.Context) {
+	sessionID, ok := a.sessionTaskAccess(ctx)
+	if !ok {
+		return
+	}
+
+	task, ok := a.findSessionTask(ctx, sessionID)
+	if !ok {
+		return
+	}
+
+	var req UpdateSessionTaskRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind update task request", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+			return
+		}
+		updates["title"] = title
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Status != nil {
+		status := constant.TaskStatus(*req.Status)
+		if !status.Valid() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+			return
+		}
+		updates["status"] = status
+	}
+	if req.Result != nil {
+		updates["result"] = *req.Result
+	}
+	if req.Priority != nil {
+		priority := constant.TaskPriority(*req.Priority)
+		if !priority.Valid() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority"})
+			return
+		}
+		updates["priority"] = priority
+	}
+	if req.ParentID != nil || req.DependsOn != nil {
+		tasks, err := a.loadSessionTasks(sessionID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+			return
+		}
+		dependsOn, err := parseTaskDependsOn(task.DependsOn)
+		if err != nil {
+			dependsOn = nil
+		}
+		if req.DependsOn != nil {
+			dependsOn = *req.DependsOn
+			encoded, _ := json.Marshal(dependsOn)
+			updates["depends_on"] = string(encoded)
+		}
+		if req.ParentID != nil {
+			task.ParentID = *req.ParentID
+			updates["parent_id"] = task.ParentID
+		}
+		if err := validateTaskRelations(tasks, task, dependsOn); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if len(updates) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no updates provided"})
+		return
+	}
+
+	if err := a.db.Model(&table.Task{}).Where("id = ? AND session_id = ?", task.ID, sessionID).Updates(updates).Error; err != nil {
+		slog.Error("failed to update task", "err", err, "task_id", task.ID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+		return
+	}
+	if err := a.db.First(&task, task.ID).Error; err != nil {
+		slog.Error("failed to reload task", "err", err, "task_id", task.ID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update task"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newSessionTask(task))
+}
+
+type ReorderSessionTasksRequest struct {
+	TaskIDs []int `json:"task_ids" binding:"required"`
+}
+
+// ReorderSessionTasks 按给定顺序重排任务，未列出的任务保持原有位置
+// PUT /api/assistant/sessions/:sessionId/tasks/order
+func (a *Assistant) ReorderSessionTasks(ctx *gin.Context) {
+	sessionID, ok := a.sessionTaskAccess(ctx)
+	if !ok {
+		return
+	}
+
+	var req ReorderSessionTasksRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		slog.Error("failed to bind reorder tasks request", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	tasks, err := a.loadSessionTasks(sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder tasks"})
+		return
+	}
+	for i, id := range req.TaskIDs {
+		if slices.Index(req.TaskIDs, id) != i || !slices.ContainsFunc(tasks, func(t table.Task) bool { return t.ID == id }) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid task id: %d", id)})
+			return
+		}
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.TaskIDs {
+			if err := tx.Model(&table.Task{}).Where("id = ? AND session_id = ?", id, sessionID).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to reorder tasks", "err", err, "session_id", sessionID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reorder tasks"})
+		return
+	}
+
+	a.ListSessionTasks(ctx)
+}
+
+// sendTaskUpdated 在任务工具修改任务后推送 task_updated 事件，只推送属于当前会话的任务
+func (a *Assistant) sendTaskUpdated(ctx *gin.Context, sessionID string, response map[string]any) {
+	var taskID int
+	switch v := response["task_id"].(type) {
+	case float64:
+		taskID = int(v)
+	case int:
+		taskID = v
+	}
+	if taskID <= 0 {
+		return
+	}
+
+	var task table.Task
+	if err := a.db.Where("id = ? AND session_id = ?", taskID, sessionID).First(&task).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("failed to load updated task", "err", err, "task_id", taskID)
+		}
+		return
+	}
+
+	sendSSE(ctx, "task_updated", newSessionTask(task))
+}
+
+// sessionTaskAccess 校验当前用户拥有路由中的会话，失败时写入错误响应
+func (a *Assistant) sessionTaskAccess(ctx *gin.Context) (string, bool) {
+	userID, ok := getContextUserID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", false
+	}
+
+	sessionID := ctx.Param("sessionId")
+	if err := a.ensureSessionOwnership(userID, sessionID); err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return "", false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify session"})
+		return "", false
+	}
+	return sessionID, true
+}
+
+func (a *Assistant) findSessionTask(ctx *gin.Context, sessionID string) (table.Task, bool) {
+	var task table.Task
+	taskID, err := strconv.Atoi(ctx.Param("taskId"))
+	if err != nil || taskID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid task id"})
+		return task, false
+	}
+
+	if err := a.db.Where("id = ? AND session_id = ?", taskID, sessionID).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+			return task, false
+		}
+		slog.Error("failed to find task", "err", err, "task_id", taskID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load task"})
+		return task, false
+	}
+	return task, true
+}
+
+func (a *Assistant) loadSessionTasks(sessionID string) ([]table.Task, error) {
+	var tasks []table.Task
+	if err := a.db.Where("session_id = ?", sessionID).Order("position ASC, id ASC").Find(&tasks).Error; err != nil {
+		slog.Error("failed to query tasks", "err", err, "session_id", sessionID)
+		return nil, fmt.Errorf("failed to query tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// validateTaskRelations 校验 task 的父任务和依赖都属于同一会话，且不形成环
+func validateTaskRelations(tasks []table.Task, task table.Task, dependsOn []int) error {
+	byID := make(map[int]table.Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+
+	if task.ParentID != 0 {
+		if _, ok := byID[task.ParentID]; !ok {
+			return fmt.Errorf("%w: parent_id %d", errInvalidTaskRelation, task.ParentID)
+		}
+		seen := map[int]bool{}
+		for id := task.ParentID; id != 0 && !seen[id]; id = byID[id].ParentID {
+			if id == task.ID {
+				return fmt.Errorf("%w: parent_id %d", errInvalidTaskRelation, task.ParentID)
+			}
+			seen[id] = true
+		}
+	}
+
+	deps := map[int][]int{task.ID: dependsOn}
+	for _, id := range dependsOn {
+		if _, ok := byID[id]; !ok || id == task.ID {
+			return fmt.Errorf("%w: depends_on %d", errInvalidTaskRelation, id)
+		}
+	}
+	for _, t := range tasks {
+		if t.ID != task.ID {
+			deps[t.ID], _ = parseTaskDependsOn(t.DependsOn)
+		}
+	}
+
+	// 新建任务（ID 为 0）不会被其他任务依赖，不可能成环
+	if task.ID == 0 {
+		return nil
+	}
+	visited := map[int]bool{}
+	stack := slices.Clone(dependsOn)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == task.ID {
+			return fmt.Errorf("%w: dependency cycle", errInvalidTaskRelation)
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, deps[id]...)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package assistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aiguide/internal/app/aiguide/migration"
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/session"
+)
+
+func newSessionTaskTestRouter(assistant *Assistant) *gin.Engine {
+	return newProjectTestRouter(assistant, func(router *gin.Engine) {
+		group := router.Group("/api/assistant/sessions/:sessionId/tasks")
+		group.GET("", assistant.ListSessionTasks)
+		group.POST("", assistant.CreateSessionTask)
+		group.PUT("/order", assistant.ReorderSessionTasks)
+		group.GET("/:taskId", assistant.GetSessionTask)
+		group.PATCH("/:taskId", assistant.UpdateSessionTask)
+	})
+}
+
+func doSessionTaskRequest(t *testing.T, router *gin.Engine, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestSessionTaskAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := setupProjectTestAssistant(t)
+	router := newSessionTaskTestRouter(assistant)
+	if err := assistant.claimSessionMeta("s1", 1); err != nil {
+		t.Fatalf("claimSessionMeta() error = %v", err)
+	}
+
+	create := func(body map[string]any) SessionTask {
+		t.Helper()
+		resp := doSessionTaskRequest(t, router, http.MethodPost, "/api/assistant/sessions/s1/tasks", body)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("create status = %d, body=%s", resp.Code, resp.Body.String())
+		}
+		var task SessionTask
+		if err := json.Unmarshal(resp.Body.Bytes(), &task); err != nil {
+			t.Fatalf("failed to unmarshal task: %v", err)
+		}
+		return task
+	}
+	root := create(map[string]any{"title": "Plan trip"})
+	flights := create(map[string]any{"title": "Book flights", "parent_id": root.ID})
+	hotel := create(map[string]any{"title": "Book hotel", "parent_id": root.ID, "depends_on": []int{flights.ID}})
+	if hotel.Position <= flights.Position || hotel.Status != constant.TaskStatusPending {
+		t.Fatalf("hotel = %+v, want pending task after flights", hotel)
+	}
+
+	path := fmt.Sprintf("/api/assistant/sessions/s1/tasks/%d", flights.ID)
+	if resp := doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"depends_on": []int{hotel.ID}}); resp.Code != http.StatusBadRequest {
+		t.Fatalf("cyclic update status = %d, want 400", resp.Code)
+	}
+	resp := doSessionTaskRequest(t, router, http.MethodPatch, path, map[string]any{"status": "completed", "result": "BA 117"})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+
+	resp = doSessionTaskRequest(t, router, http.MethodPut, "/api/assistant/sessions/s1/tasks/order", map[string]any{"task_ids": []int{hotel.ID, flights.ID}})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("reorder status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var list struct {
+		Tasks []*SessionTask `json:"tasks"`
+		Count int            `json:"count"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal list: %v", err)
+	}
+	if list.Count != 3 || len(list.Tasks) != 1 || list.Tasks[0].ID != root.ID {
+		t.Fatalf("list = %+v, want a single root", list)
+	}
+	children := list.Tasks[0].Children
+	if len(children) != 2 || children[0].ID != hotel.ID || children[1].Status != constant.TaskStatusCompleted || children[1].Result != "BA 117" {
+		t.Fatalf("children = %+v, want hotel then completed flights", children)
+	}
+	if len(children[0].DependsOn) != 1 || children[0].DependsOn[0] != flights.ID {
+		t.Fatalf("hotel depends_on = %v", children[0].DependsOn)
+	}
+}
+
+func TestSessionTaskAPIChecksOwnership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assistant := setupProjectTestAssistant(t)
+	router := newSessionTaskTestRouter(assistant)
+
+	if err := assistant.claimSessionMeta("other", 2); err != nil {
+		t.Fatalf("claimSessionMeta() error = %v", err)
+	}
+	task := table.Task{SessionID: "other", Title: "secret", Status: constant.TaskStatusPending}
+	if err := assistant.db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/sessions/other/tasks", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("list of another user's session status = %d, want 404", resp.Code)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/sessions/missing/tasks", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("list of unknown session status = %d, want 404", resp.Code)
+	}
+
+	// 历史会话的元数据没有记录所属用户时不能被认领，由迁移按 ADK 会话表回填
+	if _, err := assistant.session.Create(context.Background(), &session.CreateRequest{
+		AppName:   constant.AppNameAssistant.String(),
+		UserID:    "1",
+		SessionID: "legacy",
+	}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := assistant.db.Create(&table.SessionMeta{SessionID: "legacy", ThreadID: "legacy", Version: 1}).Error; err != nil {
+		t.Fatalf("failed to create session meta: %v", err)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/sessions/legacy/tasks", nil); resp.Code != http.StatusNotFound {
+		t.Fatalf("list of unowned legacy session status = %d, want 404", resp.Code)
+	}
+	if err := assistant.claimSessionMeta("legacy", 2); err != nil {
+		t.Fatalf("claimSessionMeta() error = %v", err)
+	}
+	if err := migration.New(assistant.db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if resp := doSessionTaskRequest(t, router, http.MethodGet, "/api/assistant/sessions/legacy/tasks", nil); resp.Code != http.StatusOK {
+		t.Fatalf("list of legacy session status = %d, body=%s", resp.Code, resp.Body.String())
+	}
+	var meta table.SessionMeta
+	if err := assistant.db.Where("session_id = ?", "legacy").First(&meta).Error; err != nil || meta.UserID != 1 {
+		t.Fatalf("legacy session meta = %+v, err = %v, want user 1", meta, err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -33,6 +34,10 @@ type ChatRequest struct {
 	Images    []string `json:"images,omitempty"`
 	FileNames []string `json:"file_names,omitempty"` // 文件名列表，与 Images 数组对应
 	ProjectID int      `json:"project_id"`
+	// ResearchProfile 深度研究档位（quick / standard / exhaustive），留空使用服务端默认值
+	ResearchProfile string `json:"research_profile,omitempty"`
+	// Mode 为 plan 时先由规划 Agent 拆解任务并按依赖执行，再汇总回答；留空为普通对话
+	Mode string `json:"mode,omitempty"`
 }
 
 const (
@@ -80,9 +85,22 @@ func (a *Assistant) Chat(ctx *gin.Context) {
 
 	userID := strconv.Itoa(req.UserID)
 	sessionID := req.SessionID
+	appName := agentAppName(ctx.Param("agentId"))
 	// Only trim leading and trailing newlines, preserving internal line breaks
 	messageText := strings.Trim(req.Message, "\n\r")
 
+	if !ValidResearchProfile(req.ResearchProfile) {
+		slog.Error("invalid research profile", "research_profile", req.ResearchProfile)
+		ctx.JSON(400, gin.H{"error": "invalid research_profile"})
+		return
+	}
+
+	if req.Mode != "" && (req.Mode != chatModePlan || appName != constant.AppNameAssistant.String()) {
+		slog.Error("invalid chat mode", "mode", req.Mode, "app_name", appName)
+		ctx.JSON(400, gin.H{"error": "invalid mode"})
+		return
+	}
+
 	if len(req.Images) > maxUserFileCount {
 		slog.Error("too many images", "count", len(req.Images), "max", maxUserFileCount)
 		ctx.JSON(400, gin.H{"error": fmt.Sprintf("too many images (max %d)", maxUserFileCount)})
@@ -102,12 +120,29 @@ func (a *Assistant) Chat(ctx *gin.Context) {
 		titleMessage = fmt.Sprintf("用户发送了 %d 个文件", len(req.Images))
 	}
 
+	authUserID, _ := getContextUserID(ctx)
+	agentRunner, err := a.runnerForAgent(ctx, appName, authUserID)
+	if err != nil {
+		if errors.Is(err, errAgentNotFound) {
+			ctx.JSON(404, gin.H{"error": "agent not found"})
+			return
+		}
+		ctx.JSON(500, gin.H{"error": "failed to load agent"})
+		return
+	}
+
 	// 检查或创建 session
-	isNewSession, err := a.ensureSession(ctx, userID, sessionID)
+	isNewSession, err := a.ensureSession(ctx, appName, userID, sessionID)
 	if err != nil {
 		ctx.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	if authUserID > 0 {
+		if err := a.claimSessionMeta(sessionID, authUserID); err != nil {
+			ctx.JSON(500, gin.H{"error": "failed to save session owner"})
+			return
+		}
+	}
 
 	// 新会话时自动注入用户记忆上下文
 	if isNewSession {
@@ -152,8 +187,26 @@ func (a *Assistant) Chat(ctx *gin.Context) {
 	a.setupSSEResponse(ctx)
 
 	ctx.Set(constant.ContextKeySessionID, sessionID)
+	if req.ResearchProfile != "" {
+		ctx.Set(constant.ContextKeyResearchProfile, req.ResearchProfile)
+	}
 
-	a.streamAgentEvents(ctx, a.runner, userID, sessionID, message, runConfig)
+	if req.Mode == chatModePlan {
+		if message = a.streamPlanExecution(ctx, authUserID, sessionID, messageText, message); message == nil {
+			return
+		}
+	}
+
+	a.streamAgentEvents(ctx, agentRunner, userID, sessionID, message, runConfig)
+}
+
+// agentAppName returns the session app name of the agent addressed by the
+// agentId route parameter; routes without it target the assistant.
+func agentAppName(agentID string) string {
+	if agentID == "" {
+		return constant.AppNameAssistant.String()
+	}
+	return agentID
 }
 
 func parseDataURI(dataURI string) ([]byte, string, error) {
@@ -214,29 +267,45 @@ func parseDataURI(dataURI string) ([]byte, string, error) {
 		slog.Error("empty file data after decoding")
 		return nil, "", errors.New("empty file data")
 	}
-	maxSize := maxUserImageSizeBytes
-	if mimeType == pdfMimeType {
-		if !bytes.HasPrefix(decoded, []byte("%PDF-")) {
-			slog.Error("invalid PDF data")
-			return nil, "", errors.New("invalid PDF data")
-		}
-		maxSize = maxUserPDFSizeBytes
-	} else if tools.IsSupportedAudioMimeType(mimeType) {
-		maxSize = maxUserAudioSizeBytes
-	}
-	if len(decoded) > maxSize {
-		slog.Error("file size exceeds limit", "size", len(decoded), "max", maxSize)
-		return nil, "", fmt.Errorf("file size exceeds %d bytes", maxSize)
+	if err := validateUserUpload(decoded, mimeType); err != nil {
+		return nil, "", err
 	}
 
 	return decoded, mimeType, nil
 }
 
+// userUploadSizeLimit returns the largest accepted upload of mimeType in
+// bytes.
+func userUploadSizeLimit(mimeType string) int {
+	switch {
+	case mimeType == pdfMimeType:
+		return maxUserPDFSizeBytes
+	case tools.IsSupportedAudioMimeType(mimeType):
+		return maxUserAudioSizeBytes
+	default:
+		return maxUserImageSizeBytes
+	}
+}
+
+// validateUserUpload checks the size of an uploaded file and that PDFs look
+// like PDFs. mimeType must be one of allowedUserUploadMimeTypes.
+func validateUserUpload(data []byte, mimeType string) error {
+	if mimeType == pdfMimeType && !bytes.HasPrefix(data, []byte("%PDF-")) {
+		slog.Error("invalid PDF data")
+		return errors.New("invalid PDF data")
+	}
+	if maxSize := userUploadSizeLimit(mimeType); len(data) > maxSize {
+		slog.Error("file size exceeds limit", "size", len(data), "max", maxSize)
+		return fmt.Errorf("file size exceeds %d bytes", maxSize)
+	}
+	return nil
+}
+
 // ensureSession 确保 session 存在，不存在则创建
 // 返回 isNew=true 表示新创建的 session
-func (a *Assistant) ensureSession(ctx *gin.Context, userID, sessionID string) (isNew bool, err error) {
+func (a *Assistant) ensureSession(ctx *gin.Context, appName, userID, sessionID string) (isNew bool, err error) {
 	sessionGetReq := &session.GetRequest{
-		AppName:   constant.AppNameAssistant.String(),
+		AppName:   appName,
 		UserID:    userID,
 		SessionID: sessionID,
 	}
@@ -249,7 +318,7 @@ func (a *Assistant) ensureSession(ctx *gin.Context, userID, sessionID string) (i
 
 		// Session 不存在，创建新的 session
 		sessionCreateReq := &session.CreateRequest{
-			AppName:   constant.AppNameAssistant.String(),
+			AppName:   appName,
 			UserID:    userID,
 			SessionID: sessionID,
 			State:     map[string]any{},
@@ -263,7 +332,7 @@ func (a *Assistant) ensureSession(ctx *gin.Context, userID, sessionID string) (i
 		// 创建后验证 session 是否成功保存
 		// 这有助于捕捉数据库同步或创建失败的情况
 		if _, err := a.session.Get(ctx, sessionGetReq); err != nil {
-			slog.Error("failed to verify session after creation", "err", err, "appName", constant.AppNameAssistant.String(), "userID", userID, "sessionID", sessionID)
+			slog.Error("failed to verify session after creation", "err", err, "appName", appName, "userID", userID, "sessionID", sessionID)
 			return false, fmt.Errorf("failed to verify session after creation: %w", err)
 		}
 
@@ -281,10 +350,27 @@ func (a *Assistant) setupSSEResponse(ctx *gin.Context) {
 	ctx.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	ctx.Writer.Header().Set("Content-Encoding", "none")
 
+	// 同一响应的所有 SSE 写入共用一把锁，见 sendSSE
+	ctx.Set(contextKeySSEWriteMu, &sync.Mutex{})
+
 	// 强制把响应头发送给客户端，建立连接
 	ctx.Writer.Flush()
 }
 
+// contextKeySSEWriteMu 保存当前响应的 SSE 写入锁
+const contextKeySSEWriteMu = "sse_write_mu"
+
+// sendSSE 发送 SSE 事件并立即刷新。主事件循环、心跳、并行研究者与计划任务
+// 会在不同 goroutine 中写入同一响应，所有写入都经过 setupSSEResponse 创建的锁串行化
+func sendSSE(ctx *gin.Context, event string, data any) {
+	if mu, ok := ctx.Value(contextKeySSEWriteMu).(*sync.Mutex); ok {
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	ctx.SSEvent(event, data)
+	ctx.Writer.Flush()
+}
+
 // streamAgentEvents 处理 agent 的流式事件并发送给客户端
 func (a *Assistant) streamAgentEvents(
 	ctx *gin.Context,
@@ -310,12 +396,22 @@ func (a *Assistant) streamAgentEvents(
 		default:
 		}
 
-		ctx.SSEvent("tool_progress", gin.H{
+		sendSSE(ctx, "tool_progress", gin.H{
 			"author":      author,
 			"tool_name":   "audio_transcribe",
 			"tool_result": progress,
 		})
-		ctx.Writer.Flush()
+	}))
+
+	// 深度研究的并行研究者会并发上报进度，由 sendSSE 串行化写入
+	ctx.Set(ContextKeyResearchProgressReporter, ResearchProgressReporter(func(progress ResearchProgress) {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		default:
+		}
+
+		sendSSE(ctx, "research_progress", progress)
 	}))
 
 	// 启动心跳，防止长时间无响应导致连接超时
@@ -352,8 +448,7 @@ func (a *Assistant) streamAgentEvents(
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				errorMsg = "Session 不存在或已被删除，请重新创建"
 			}
-			ctx.SSEvent("error", gin.H{"error": errorMsg})
-			ctx.Writer.Flush()
+			sendSSE(ctx, "error", gin.H{"error": errorMsg})
 			return
 		}
 
@@ -379,8 +474,7 @@ func (a *Assistant) streamAgentEvents(
 						"content":    part.Text,
 						"is_thought": isThought,
 					}
-					ctx.SSEvent("data", data)
-					ctx.Writer.Flush()
+					sendSSE(ctx, "data", data)
 				}
 			}
 		}
@@ -392,6 +486,16 @@ func (a *Assistant) streamAgentEvents(
 
 			for _, part := range content.Parts {
 				if part.FunctionCall != nil {
+					// 需要用户确认的工具调用：发送 confirmation_required，本次运行随后结束，
+					// 用户通过确认接口批准、修改或拒绝后再恢复运行
+					if pending, ok := parseConfirmationCall(part.FunctionCall); ok {
+						callKey := functionCallKey(part.FunctionCall)
+						if _, seen := seenToolCalls[callKey]; !seen {
+							seenToolCalls[callKey] = struct{}{}
+							sendSSE(ctx, "confirmation_required", confirmationRequiredEvent(locale, event.Author, pending))
+						}
+						continue
+					}
 					if shouldHideToolCall(part.FunctionCall.Name, event.Author) {
 						continue
 					}
@@ -406,8 +510,7 @@ func (a *Assistant) streamAgentEvents(
 							"tool_label":   label,
 							"tool_args":    part.FunctionCall.Args,
 						}
-						ctx.SSEvent("tool_call", data)
-						ctx.Writer.Flush()
+						sendSSE(ctx, "tool_call", data)
 					}
 				}
 
@@ -427,13 +530,16 @@ func (a *Assistant) streamAgentEvents(
 						author = "model"
 					}
 
-					ctx.SSEvent("tool_result", gin.H{
+					sendSSE(ctx, "tool_result", gin.H{
 						"author":       author,
 						"tool_call_id": part.FunctionResponse.ID,
 						"tool_name":    part.FunctionResponse.Name,
 						"tool_result":  response,
 					})
-					ctx.Writer.Flush()
+
+					if taskMutatingTools[part.FunctionResponse.Name] {
+						a.sendTaskUpdated(ctx, sessionID, response)
+					}
 
 					// 将 map[string]any 转换为 ImageGenOutput
 					var output tools.ImageGenOutput
@@ -443,8 +549,7 @@ func (a *Assistant) streamAgentEvents(
 								"author": author,
 								"images": output.Images,
 							}
-							ctx.SSEvent("data", data)
-							ctx.Writer.Flush()
+							sendSSE(ctx, "data", data)
 						}
 					}
 
@@ -456,8 +561,7 @@ func (a *Assistant) streamAgentEvents(
 								"author": author,
 								"videos": videoOutput.Videos,
 							}
-							ctx.SSEvent("data", data)
-							ctx.Writer.Flush()
+							sendSSE(ctx, "data", data)
 						}
 					}
 				}
@@ -466,8 +570,7 @@ func (a *Assistant) streamAgentEvents(
 	}
 
 	// 循环结束后，发送结束标记
-	ctx.SSEvent("stop", gin.H{"status": "done"})
-	ctx.Writer.Flush()
+	sendSSE(ctx, "stop", gin.H{"status": "done"})
 }
 
 // startHeartbeat 启动心跳 goroutine，防止 SSE 连接因长时间无响应而超时
@@ -485,8 +588,7 @@ func startHeartbeat(ctx *gin.Context, interval time.Duration) context.CancelFunc
 				return
 			case <-ticker.C:
 				// 发送心跳事件（客户端应忽略此事件）
-				ctx.SSEvent("heartbeat", gin.H{"timestamp": time.Now().Unix()})
-				ctx.Writer.Flush()
+				sendSSE(ctx, "heartbeat", gin.H{"timestamp": time.Now().Unix()})
 			}
 		}
 	}()
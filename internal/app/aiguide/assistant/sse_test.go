@@ -7,9 +7,12 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"google.golang.org/genai"
 )
 
@@ -315,3 +318,35 @@ func TestToolCallLabel(t *testing.T) {
 		})
 	}
 }
+
+func TestSendSSESerializesWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	(&Assistant{}).setupSSEResponse(ctx)
+
+	// 模拟主事件循环、心跳与并行研究者同时写入
+	const writers, events = 8, 50
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range events {
+				sendSSE(ctx, "data", gin.H{"writer": i, "seq": j, "content": strings.Repeat("x", 256)})
+			}
+		}()
+	}
+	wg.Wait()
+
+	frames := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	if len(frames) != writers*events {
+		t.Fatalf("frames = %d, want %d", len(frames), writers*events)
+	}
+	for _, frame := range frames {
+		if !strings.HasPrefix(frame, "event:data\ndata:{") || strings.Count(frame, "event:") != 1 {
+			t.Fatalf("interleaved frame: %q", frame)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"google.golang.org/adk/model"
 	"google.golang.org/adk/tool"
 	"google.golang.org/genai"
+
+	"aiguide/internal/pkg/tools"
 )
 
 //go:embed web_agent_prompt.md
@@ -29,6 +31,12 @@ var taskAgentInstruction string
 //go:embed system_agent_prompt.md
 var systemAgentInstruction string
 
+//go:embed mcp_agent_prompt.md
+var mcpAgentInstruction string
+
+//go:embed api_agent_prompt.md
+var apiAgentInstruction string
+
 type toolPartition struct {
 	Common   []tool.Tool
 	Web      []tool.Tool
@@ -38,10 +46,12 @@ type toolPartition struct {
 	Task     []tool.Tool
 	System   []tool.Tool
 	Research []tool.Tool
+	MCP      []tool.Toolset // tools discovered from MCP servers at run time
+	API      []tool.Toolset // tools generated from OpenAPI documents
 }
 
-func partitionTools(allTools []tool.Tool) toolPartition {
-	var p toolPartition
+func partitionTools(allTools []tool.Tool, mcpToolsets, apiToolsets []tool.Toolset) toolPartition {
+	p := toolPartition{MCP: mcpToolsets, API: apiToolsets}
 	for _, t := range allTools {
 		switch t.Name() {
 		case "current_time":
@@ -60,6 +70,9 @@ func partitionTools(allTools []tool.Tool) toolPartition {
 			p.Media = append(p.Media, t)
 		case "file_download", "file_list", "file_get":
 			p.File = append(p.File, t)
+		case "code_execute":
+			p.Common = append(p.Common, t)
+			p.File = append(p.File, t)
 		case "task_list", "task_get", "task_update",
 			"scheduled_task_create", "scheduled_task_list":
 			p.Task = append(p.Task, t)
@@ -72,12 +85,15 @@ func partitionTools(allTools []tool.Tool) toolPartition {
 	return p
 }
 
-func buildSubAgents(p toolPartition, m model.LLM, thinkingBudget int32) ([]agent.Agent, error) {
+// buildSubAgents creates the domain sub-agents. confirmation selects how
+// their side-effecting tools are confirmed (see confirmationCallbacks).
+func buildSubAgents(p toolPartition, m model.LLM, thinkingBudget int32, researchProfile string, confirmation tools.ConfirmationMode) ([]agent.Agent, error) {
 	type subAgentDef struct {
 		name        string
 		description string
 		instruction string
 		tools       []tool.Tool
+		toolsets    []tool.Toolset
 	}
 
 	defs := []subAgentDef{
@@ -101,7 +117,7 @@ func buildSubAgents(p toolPartition, m model.LLM, thinkingBudget int32) ([]agent
 		},
 		{
 			name:        "file_agent",
-			description: "Downloads files from URLs and manages the user's file storage",
+			description: "Downloads files from URLs, manages the user's file storage and analyzes files with code",
 			instruction: fileAgentInstruction,
 			tools:       p.File,
 		},
@@ -117,14 +133,28 @@ func buildSubAgents(p toolPartition, m model.LLM, thinkingBudget int32) ([]agent
 			instruction: systemAgentInstruction,
 			tools:       p.System,
 		},
+		{
+			name:        "mcp_agent",
+			description: "Uses tools provided by external MCP (Model Context Protocol) servers",
+			instruction: mcpAgentInstruction,
+			toolsets:    p.MCP,
+		},
+		{
+			name:        "api_agent",
+			description: "Calls REST APIs imported from OpenAPI documents",
+			instruction: apiAgentInstruction,
+			toolsets:    p.API,
+		},
 	}
 
+	beforeToolCallbacks := confirmationCallbacks(confirmation)
+
 	agents := make([]agent.Agent, 0, len(defs))
 	for _, def := range defs {
-		if len(def.tools) == 0 {
+		if len(def.tools) == 0 && len(def.toolsets) == 0 {
 			continue
 		}
-		a, err := createSubAgent(def.name, def.description, def.instruction, def.tools, m, thinkingBudget)
+		a, err := createSubAgent(def.name, def.description, def.instruction, def.tools, def.toolsets, m, thinkingBudget, beforeToolCallbacks)
 		if err != nil {
 			return nil, err
 		}
@@ -132,7 +162,7 @@ func buildSubAgents(p toolPartition, m model.LLM, thinkingBudget int32) ([]agent
 	}
 	// Build the deep research agent using workflow agents (SequentialAgent + LoopAgent).
 	if len(p.Research) > 0 {
-		deepResearch, err := buildDeepResearchAgent(p.Research, m, thinkingBudget)
+		deepResearch, err := buildDeepResearchAgent(p.Research, m, thinkingBudget, researchProfile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to build deep_research_agent: %w", err)
 		}
@@ -142,6 +172,21 @@ func buildSubAgents(p toolPartition, m model.LLM, thinkingBudget int32) ([]agent
 	return agents, nil
 }
 
+// confirmationCallbacks returns the BeforeToolCallbacks that apply mode to
+// an agent's tools.
+func confirmationCallbacks(mode tools.ConfirmationMode) []llmagent.BeforeToolCallback {
+	switch mode {
+	case tools.ConfirmationAsk:
+		return []llmagent.BeforeToolCallback{tools.ConfirmToolCall}
+	case tools.ConfirmationDeny:
+		return []llmagent.BeforeToolCallback{tools.DenyConfirmableToolCall}
+	case tools.ConfirmationReject:
+		return []llmagent.BeforeToolCallback{tools.RejectUnconfirmedToolCall}
+	default:
+		return nil
+	}
+}
+
 func newThinkingConfig(budget int32) *genai.ThinkingConfig {
 	cfg := &genai.ThinkingConfig{
 		IncludeThoughts: true,
@@ -152,7 +197,7 @@ func newThinkingConfig(budget int32) *genai.ThinkingConfig {
 	return cfg
 }
 
-func createSubAgent(name, description, instruction string, tools []tool.Tool, m model.LLM, thinkingBudget int32) (agent.Agent, error) {
+func createSubAgent(name, description, instruction string, subAgentTools []tool.Tool, toolsets []tool.Toolset, m model.LLM, thinkingBudget int32, beforeToolCallbacks []llmagent.BeforeToolCallback) (agent.Agent, error) {
 	cfg := llmagent.Config{
 		Name:        name,
 		Model:       m,
@@ -161,7 +206,9 @@ func createSubAgent(name, description, instruction string, tools []tool.Tool, m
 		GenerateContentConfig: &genai.GenerateContentConfig{
 			ThinkingConfig: newThinkingConfig(thinkingBudget),
 		},
-		Tools: tools,
+		Tools:               subAgentTools,
+		Toolsets:            toolsets,
+		BeforeToolCallbacks: beforeToolCallbacks,
 	}
 	a, err := llmagent.New(cfg)
 	if err != nil {
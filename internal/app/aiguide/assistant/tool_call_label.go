@@ -70,6 +70,8 @@ func toolCallLabelZH(name string, args map[string]any) string {
 		return "正在转写音频"
 	case "manage_memory":
 		return "正在管理记忆"
+	case "adk_request_confirmation":
+		return "等待用户确认"
 	default:
 		return fmt.Sprintf("调用 %s", name)
 	}
@@ -131,6 +133,8 @@ func toolCallLabelEN(name string, args map[string]any) string {
 		return "Transcribing audio"
 	case "manage_memory":
 		return "Managing memory"
+	case "adk_request_confirmation":
+		return "Waiting for your confirmation"
 	default:
 		return fmt.Sprintf("Calling %s", name)
 	}
@@ -0,0 +1,232 @@
+package assistant
+
+import (
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/tools"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool/toolconfirmation"
+	"google.golang.org/genai"
+)
+
+// Tool confirmation decisions accepted by ResolveToolConfirmation.
+const (
+	ToolConfirmationApprove = "approve"
+	ToolConfirmationEdit    = "edit"
+	ToolConfirmationReject  = "reject"
+)
+
+var (
+	errConfirmationNotFound = errors.New("confirmation not found")
+	errConfirmationResolved = errors.New("confirmation already resolved")
+)
+
+// ToolConfirmationRequest is the body of the confirmation endpoint.
+type ToolConfirmationRequest struct {
+	SessionID string         `json:"session_id" binding:"required"`
+	Decision  string         `json:"decision" binding:"required"`
+	Args      map[string]any `json:"args,omitempty"` // required when decision is "edit"
+}
+
+// pendingConfirmation is an adk_request_confirmation call still waiting for
+// the user's answer.
+type pendingConfirmation struct {
+	ID           string
+	OriginalCall *genai.FunctionCall
+	Hint         string
+}
+
+// parseConfirmationCall extracts the original tool call and hint from an
+// adk_request_confirmation function call. The arguments are typed values for
+// events produced in this process and JSON maps for events loaded from the
+// session store.
+func parseConfirmationCall(call *genai.FunctionCall) (*pendingConfirmation, bool) {
+	if call == nil || call.Name != toolconfirmation.FunctionCallName {
+		return nil, false
+	}
+	original, err := toolconfirmation.OriginalCallFrom(call)
+	if err != nil {
+		slog.Error("failed to parse original function call from confirmation request", "call_id", call.ID, "err", err)
+		return nil, false
+	}
+
+	var hint string
+	switch tc := call.Args["toolConfirmation"].(type) {
+	case toolconfirmation.ToolConfirmation:
+		hint = tc.Hint
+	case *toolconfirmation.ToolConfirmation:
+		if tc != nil {
+			hint = tc.Hint
+		}
+	case map[string]any:
+		hint, _ = tc["hint"].(string)
+	}
+
+	return &pendingConfirmation{ID: call.ID, OriginalCall: original, Hint: hint}, true
+}
+
+// confirmationRequiredEvent builds the payload of the "confirmation_required"
+// SSE event.
+func confirmationRequiredEvent(locale, author string, pending *pendingConfirmation) gin.H {
+	return gin.H{
+		"author":          author,
+		"confirmation_id": pending.ID,
+		"tool_call_id":    pending.OriginalCall.ID,
+		"tool_name":       pending.OriginalCall.Name,
+		"tool_label":      toolCallLabel(locale, pending.OriginalCall.Name, pending.OriginalCall.Args),
+		"tool_args":       pending.OriginalCall.Args,
+		"hint":            pending.Hint,
+	}
+}
+
+// findPendingConfirmation looks up an unanswered confirmation request in the
+// session history.
+func findPendingConfirmation(events session.Events, confirmationID string) (*pendingConfirmation, error) {
+	var pending *pendingConfirmation
+	for event := range events.All() {
+		if event.Content == nil {
+			continue
+		}
+		for _, part := range event.Content.Parts {
+			if part.FunctionCall != nil && part.FunctionCall.ID == confirmationID {
+				if p, ok := parseConfirmationCall(part.FunctionCall); ok {
+					pending = p
+				}
+			}
+			if pending != nil && part.FunctionResponse != nil && part.FunctionResponse.ID == confirmationID {
+				return nil, errConfirmationResolved
+			}
+		}
+	}
+	if pending == nil {
+		return nil, errConfirmationNotFound
+	}
+	return pending, nil
+}
+
+// ResolveToolConfirmation approves, edits or rejects a pending tool call and
+// resumes the paused run, streaming the remaining events over SSE like Chat.
+func (a *Assistant) ResolveToolConfirmation(ctx *gin.Context) {
+	var req ToolConfirmationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind tool confirmation request", "err", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		slog.Error("user not authenticated in ResolveToolConfirmation")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	switch req.Decision {
+	case ToolConfirmationApprove, ToolConfirmationReject:
+	case ToolConfirmationEdit:
+		if len(req.Args) == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "args are required when editing a tool call"})
+			return
+		}
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "decision must be approve, edit or reject"})
+		return
+	}
+
+	confirmationID := ctx.Param("confirmationId")
+	// 计划模式中任务的确认请求由仍在进行的计划流等待，直接把决定交给它
+	if a.planExecutor != nil && a.planExecutor.resolveConfirmation(userID, req.SessionID, confirmationID, req) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "resolved"})
+		return
+	}
+
+	appName := agentAppName(ctx.Param("agentId"))
+	agentRunner, err := a.runnerForAgent(ctx, appName, userID)
+	if err != nil {
+		if errors.Is(err, errAgentNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agent"})
+		return
+	}
+
+	resp, err := a.session.Get(ctx, &session.GetRequest{
+		AppName:   appName,
+		UserID:    strconv.Itoa(userID),
+		SessionID: req.SessionID,
+	})
+	if err != nil {
+		slog.Error("failed to load session for tool confirmation", "session_id", req.SessionID, "user_id", userID, "err", err)
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	pending, err := findPendingConfirmation(resp.Session.Events(), confirmationID)
+	if err != nil {
+		if errors.Is(err, errConfirmationResolved) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := toConfirmationResponse(newToolConfirmation(req, pending.Hint))
+	if err != nil {
+		slog.Error("failed to encode tool confirmation response", "err", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode confirmation"})
+		return
+	}
+
+	slog.Info("resolving tool confirmation", "session_id", req.SessionID, "tool", pending.OriginalCall.Name, "decision", req.Decision)
+	message := genai.NewContentFromParts([]*genai.Part{{
+		FunctionResponse: &genai.FunctionResponse{
+			ID:       confirmationID,
+			Name:     toolconfirmation.FunctionCallName,
+			Response: response,
+		},
+	}}, genai.RoleUser)
+
+	a.setupSSEResponse(ctx)
+	ctx.Set(constant.ContextKeySessionID, req.SessionID)
+
+	a.streamAgentEvents(ctx, agentRunner, strconv.Itoa(userID), req.SessionID, message, agent.RunConfig{
+		StreamingMode: agent.StreamingModeSSE,
+	})
+}
+
+// newToolConfirmation turns the user's decision into the ToolConfirmation
+// answering a request with the given hint.
+func newToolConfirmation(req ToolConfirmationRequest, hint string) toolconfirmation.ToolConfirmation {
+	confirmation := toolconfirmation.ToolConfirmation{
+		Hint:      hint,
+		Confirmed: req.Decision != ToolConfirmationReject,
+	}
+	if req.Decision == ToolConfirmationEdit {
+		confirmation.Payload = tools.ToolConfirmationPayload{Args: req.Args}
+	}
+	return confirmation
+}
+
+// toConfirmationResponse encodes a ToolConfirmation as the JSON object ADK
+// expects in an adk_request_confirmation function response.
+func toConfirmationResponse(confirmation toolconfirmation.ToolConfirmation) (map[string]any, error) {
+	data, err := json.Marshal(confirmation)
+	if err != nil {
+		return nil, err
+	}
+	var response map[string]any
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
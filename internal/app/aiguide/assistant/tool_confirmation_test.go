@@ -0,0 +1,110 @@
+package assistant
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool/toolconfirmation"
+	"google.golang.org/genai"
+)
+
+func confirmationCallEvent(id string, args map[string]any) *session.Event {
+	return &session.Event{
+		Author: "system_agent",
+		LLMResponse: model.LLMResponse{
+			Content: genai.NewContentFromParts([]*genai.Part{{
+				FunctionCall: &genai.FunctionCall{
+					ID:   id,
+					Name: toolconfirmation.FunctionCallName,
+					Args: args,
+				},
+			}}, genai.RoleModel),
+		},
+	}
+}
+
+func TestParseConfirmationCallHandlesStoredAndLiveArgs(t *testing.T) {
+	live := &genai.FunctionCall{
+		ID:   "confirm-1",
+		Name: toolconfirmation.FunctionCallName,
+		Args: map[string]any{
+			"originalFunctionCall": &genai.FunctionCall{ID: "call-1", Name: "ssh_execute", Args: map[string]any{"command": "uptime"}},
+			"toolConfirmation":     toolconfirmation.ToolConfirmation{Hint: "please confirm"},
+		},
+	}
+	pending, ok := parseConfirmationCall(live)
+	if !ok {
+		t.Fatal("parseConfirmationCall() failed for live args")
+	}
+	if pending.OriginalCall.Name != "ssh_execute" || pending.Hint != "please confirm" {
+		t.Fatalf("unexpected pending confirmation %+v", pending)
+	}
+
+	stored := &genai.FunctionCall{
+		ID:   "confirm-2",
+		Name: toolconfirmation.FunctionCallName,
+		Args: map[string]any{
+			"originalFunctionCall": map[string]any{"id": "call-2", "name": "send_email", "args": map[string]any{"subject": "hi"}},
+			"toolConfirmation":     map[string]any{"hint": "stored hint", "confirmed": false},
+		},
+	}
+	pending, ok = parseConfirmationCall(stored)
+	if !ok {
+		t.Fatal("parseConfirmationCall() failed for stored args")
+	}
+	if pending.OriginalCall.Name != "send_email" || pending.OriginalCall.ID != "call-2" || pending.Hint != "stored hint" {
+		t.Fatalf("unexpected pending confirmation %+v", pending)
+	}
+
+	if _, ok := parseConfirmationCall(&genai.FunctionCall{Name: "ssh_execute"}); ok {
+		t.Fatal("parseConfirmationCall() accepted a regular tool call")
+	}
+}
+
+func TestFindPendingConfirmation(t *testing.T) {
+	args := map[string]any{
+		"originalFunctionCall": map[string]any{"id": "call-1", "name": "ssh_execute", "args": map[string]any{"command": "uptime"}},
+		"toolConfirmation":     map[string]any{"hint": "confirm"},
+	}
+	events := testEvents{confirmationCallEvent("confirm-1", args)}
+
+	pending, err := findPendingConfirmation(events, "confirm-1")
+	if err != nil {
+		t.Fatalf("findPendingConfirmation() error = %v", err)
+	}
+	if pending.OriginalCall.Name != "ssh_execute" {
+		t.Fatalf("unexpected original call %+v", pending.OriginalCall)
+	}
+
+	if _, err := findPendingConfirmation(events, "missing"); !errors.Is(err, errConfirmationNotFound) {
+		t.Fatalf("expected errConfirmationNotFound, got %v", err)
+	}
+
+	answered := append(events, &session.Event{
+		Author: "user",
+		LLMResponse: model.LLMResponse{
+			Content: genai.NewContentFromParts([]*genai.Part{{
+				FunctionResponse: &genai.FunctionResponse{
+					ID:       "confirm-1",
+					Name:     toolconfirmation.FunctionCallName,
+					Response: map[string]any{"confirmed": true},
+				},
+			}}, genai.RoleUser),
+		},
+	})
+	if _, err := findPendingConfirmation(answered, "confirm-1"); !errors.Is(err, errConfirmationResolved) {
+		t.Fatalf("expected errConfirmationResolved, got %v", err)
+	}
+}
+
+func TestToConfirmationResponse(t *testing.T) {
+	response, err := toConfirmationResponse(toolconfirmation.ToolConfirmation{Confirmed: true})
+	if err != nil {
+		t.Fatalf("toConfirmationResponse() error = %v", err)
+	}
+	if response["confirmed"] != true {
+		t.Fatalf("expected confirmed=true, got %v", response)
+	}
+}
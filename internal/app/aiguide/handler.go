@@ -1,6 +1,7 @@
 package aiguide
 
 import (
+	"aiguide/internal/app/aiguide/table"
 	"aiguide/internal/pkg/auth"
 	"log/slog"
 	"net/http"
@@ -46,6 +47,18 @@ func (a *AIGuide) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// 已删除或被禁用的用户不再续期
+	var count int64
+	if err := a.db.Model(&table.User{}).Where("id = ? AND disabled_at IS NULL", claims.UserID).Count(&count).Error; err != nil {
+		slog.Error("failed to look up user", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh token"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is disabled"})
+		return
+	}
+
 	// 重建用户信息用于生成新令牌
 	user := &auth.GoogleUser{
 		ID:    claims.GoogleUserID,
@@ -0,0 +1,189 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/middleware"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errIdentityInUse 身份已关联到其他用户
+var errIdentityInUse = errors.New("identity is linked to another user")
+
+// errLastIdentity 不能解除最后一个登录身份
+var errLastIdentity = errors.New("cannot unlink the last identity")
+
+// UserIdentityResponse 已关联的登录身份
+type UserIdentityResponse struct {
+	ID          int       `json:"id"`
+	Provider    string    `json:"provider"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func createUserIdentity(db *gorm.DB, userID int, identity *auth.Identity) error {
+	link := table.UserIdentity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Name:     identity.Name,
+	}
+	if err := db.Create(&link).Error; err != nil {
+		slog.Error("failed to create user identity", "provider", identity.Provider, "err", err)
+		return fmt.Errorf("failed to create user identity: %w", err)
+	}
+	return nil
+}
+
+// linkIdentity 将身份关联到用户，身份已属于其他用户时返回 errIdentityInUse。
+// 关联 Google 身份时同时保存日历使用的 Google 账号与 refresh_token。
+func linkIdentity(db *gorm.DB, userID int, identity *auth.Identity) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var link table.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		switch {
+		case err == nil:
+			if link.UserID != userID {
+				return errIdentityInUse
+			}
+			if err := tx.Model(&link).Updates(map[string]any{"email": identity.Email, "name": identity.Name}).Error; err != nil {
+				return fmt.Errorf("failed to update user identity: %w", err)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := createUserIdentity(tx, userID, identity); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("failed to find user identity: %w", err)
+		}
+
+		if identity.Provider != auth.ProviderGoogle {
+			return nil
+		}
+		updates := map[string]any{"google_user_id": identity.Subject}
+		if identity.RefreshToken != "" {
+			updates["google_oauth_refresh_token"] = identity.RefreshToken
+		}
+		if err := tx.Model(&table.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update google account: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListIdentities 列出当前用户已关联的登录身份
+func (a *AIGuide) ListIdentities(c *gin.Context) {
+	userID, existed := middleware.GetUserID(c)
+	if !existed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+
+	var links []table.UserIdentity
+	if err := a.db.Where("user_id = ?", userID).Order("id").Find(&links).Error; err != nil {
+		slog.Error("failed to list user identities", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list identities"})
+		return
+	}
+
+	identities := make([]UserIdentityResponse, 0, len(links))
+	for _, link := range links {
+		displayName := link.Provider
+		if link.Provider == auth.ProviderLocal {
+			displayName = "Password"
+		} else if p := a.loginProvider(link.Provider); p != nil {
+			displayName = p.DisplayName()
+		}
+		identities = append(identities, UserIdentityResponse{
+			ID:          link.ID,
+			Provider:    link.Provider,
+			DisplayName: displayName,
+			Email:       link.Email,
+			Name:        link.Name,
+			CreatedAt:   link.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// LinkIdentity 开始关联新的登录身份，返回提供方的授权地址，回调时关联到当前用户
+func (a *AIGuide) LinkIdentity(c *gin.Context) {
+	provider := a.loginProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown login provider"})
+		return
+	}
+
+	url, ok := a.authCodeURL(c, provider)
+	if !ok {
+		return
+	}
+	secure := a.secureCookie()
+	c.SetCookie("oauth_link", "1", 600, "/", "", secure, true)
+	c.SetCookie("oauth_return_to", "/settings/login-methods", 600, "/", "", secure, true)
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+// DeleteIdentity 解除登录身份的关联，至少保留一个登录方式
+func (a *AIGuide) DeleteIdentity(c *gin.Context) {
+	userID, existed := middleware.GetUserID(c)
+	if !existed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		var link table.UserIdentity
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&link).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&table.UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return errLastIdentity
+		}
+		if err := tx.Delete(&link).Error; err != nil {
+			return err
+		}
+		if link.Provider == auth.ProviderLocal {
+			// 解除密码登录方式时删除密码凭据
+			return tx.Where("user_id = ?", userID).Delete(&table.LocalCredential{}).Error
+		}
+		if link.Provider != auth.ProviderGoogle {
+			return nil
+		}
+		// 解除的 Google 账号不再用于日历工具
+		return tx.Model(&table.User{}).
+			Where("id = ? AND google_user_id = ?", userID, link.Subject).
+			Updates(map[string]any{"google_user_id": "", "google_oauth_refresh_token": ""}).Error
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "identity unlinked"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+	case errors.Is(err, errLastIdentity):
+		c.JSON(http.StatusConflict, gin.H{"error": "cannot unlink the last login method"})
+	default:
+		slog.Error("failed to unlink identity", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink identity"})
+	}
+}
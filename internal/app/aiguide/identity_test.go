@@ -0,0 +1,342 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/migration"
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// fakeLoginProvider 返回固定身份的登录提供方
+type fakeLoginProvider struct {
+	name     string
+	identity auth.Identity
+}
+
+func (p *fakeLoginProvider) Name() string        { return p.name }
+func (p *fakeLoginProvider) DisplayName() string { return strings.ToUpper(p.name) }
+
+func (p *fakeLoginProvider) AuthCodeURL(_ context.Context, state, _ string) (string, error) {
+	return "https://idp.example.com/auth?state=" + state, nil
+}
+
+func (p *fakeLoginProvider) Exchange(context.Context, string, string, string) (*auth.Identity, error) {
+	identity := p.identity
+	identity.Provider = p.name
+	return &identity, nil
+}
+
+func setupLoginTest(t *testing.T, allowedEmails []string, providers ...auth.Provider) (*AIGuide, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	// 与服务端一样使用单数表名，迁移中的原生 SQL 才能被测试覆盖
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := migration.New(db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := importAllowedEmails(db, allowedEmails); err != nil {
+		t.Fatalf("failed to import allowed emails: %v", err)
+	}
+
+	secureCookie := false
+	a := &AIGuide{
+		config:         &Config{SecureCookie: &secureCookie, FrontendURL: "http://app"},
+		db:             db,
+		authService:    auth.NewAuthService(&auth.Config{JWTSecret: "test-secret"}),
+		loginProviders: providers,
+	}
+	router := gin.New()
+	router.GET("/api/auth/providers", a.ListLoginProviders)
+	router.GET("/api/auth/login/:provider", a.Login)
+	router.GET("/api/auth/login/google/reauth", a.GoogleReauth)
+	router.GET("/api/auth/callback/:provider", a.OAuthCallback)
+	router.POST("/api/auth/local/login", a.LocalLogin)
+	router.POST("/api/auth/local/register", a.LocalRegister)
+	router.POST("/api/auth/local/password-reset", a.RequestPasswordReset)
+	router.POST("/api/auth/local/password-reset/confirm", a.ConfirmPasswordReset)
+	authed := router.Group("/api/auth", middleware.Auth(db, a.authService))
+	authed.GET("/identities", a.ListIdentities)
+	authed.POST("/identities/:provider", a.LinkIdentity)
+	authed.DELETE("/identities/:id", a.DeleteIdentity)
+	authed.PUT("/local/password", a.ChangePassword)
+	adminOnly := middleware.RequireRole(constant.UserRoleAdmin)
+	authed.POST("/local/accounts", adminOnly, a.CreateLocalAccount)
+	authed.GET("/invites", adminOnly, a.ListInvites)
+	authed.POST("/invites", adminOnly, a.CreateInvite)
+	authed.DELETE("/invites/:id", adminOnly, a.DeleteInvite)
+	admin := router.Group("/api/admin", middleware.Auth(db, a.authService), adminOnly)
+	admin.GET("/users", a.ListUsers)
+	admin.PATCH("/users/:id", a.UpdateUser)
+	admin.DELETE("/users/:id", a.DeleteUser)
+	admin.GET("/users/:id/usage", a.GetUserUsage)
+	admin.POST("/users/:id/quota/reset", a.ResetUserQuota)
+	admin.GET("/allowed-emails", a.ListAllowedEmails)
+	admin.POST("/allowed-emails", a.AddAllowedEmail)
+	admin.DELETE("/allowed-emails/:id", a.DeleteAllowedEmail)
+	return a, router
+}
+
+func doLoginRequest(router *gin.Engine, method, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// doCallback 模拟提供方回调，附带匹配的 state cookie
+func doCallback(router *gin.Engine, provider string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	cookies = append(cookies, &http.Cookie{Name: "oauth_state", Value: "state-1"})
+	return doLoginRequest(router, http.MethodGet, "/api/auth/callback/"+provider+"?state=state-1&code=code-1", cookies...)
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestListLoginProviders(t *testing.T) {
+	_, router := setupLoginTest(t, nil, &fakeLoginProvider{name: "github"}, &fakeLoginProvider{name: "keycloak"})
+
+	w := doLoginRequest(router, http.MethodGet, "/api/auth/providers")
+	var resp struct {
+		Providers []struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+		} `json:"providers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Providers) != 2 || resp.Providers[1].Name != "keycloak" || resp.Providers[1].DisplayName != "KEYCLOAK" {
+		t.Errorf("providers = %+v", resp.Providers)
+	}
+
+	w = doLoginRequest(router, http.MethodGet, "/api/auth/login/github")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if responseCookie(w, "oauth_state") == nil || responseCookie(w, "oauth_verifier") == nil {
+		t.Error("login did not set state and PKCE verifier cookies")
+	}
+
+	if w := doLoginRequest(router, http.MethodGet, "/api/auth/login/unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown provider status = %d, want 404", w.Code)
+	}
+}
+
+func TestOAuthCallbackCreatesUserWithIdentity(t *testing.T) {
+	github := &fakeLoginProvider{name: "github", identity: auth.Identity{Subject: "42", Email: "octo@example.com", EmailVerified: true, Name: "Octo"}}
+	a, router := setupLoginTest(t, nil, github)
+
+	w := doCallback(router, "github")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "http://app" {
+		t.Fatalf("callback status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+	authCookie := responseCookie(w, "auth_token")
+	if authCookie == nil {
+		t.Fatal("callback did not set auth_token cookie")
+	}
+	claims, err := a.authService.ValidateJWT(authCookie.Value)
+	if err != nil {
+		t.Fatalf("invalid auth token: %v", err)
+	}
+
+	var user table.User
+	if err := a.db.First(&user, claims.UserID).Error; err != nil {
+		t.Fatalf("user not created: %v", err)
+	}
+	if user.GoogleEmail != "octo@example.com" || user.GoogleName != "Octo" || user.GoogleUserID != "" {
+		t.Errorf("user = %+v", user)
+	}
+
+	// 再次登录使用同一用户
+	doCallback(router, "github")
+	var users, identities int64
+	a.db.Model(&table.User{}).Count(&users)
+	a.db.Model(&table.UserIdentity{}).Where("user_id = ? AND provider = ? AND subject = ?", user.ID, "github", "42").Count(&identities)
+	if users != 1 || identities != 1 {
+		t.Errorf("users = %d, identities = %d, want 1 and 1", users, identities)
+	}
+}
+
+func TestOAuthCallbackAllowedEmails(t *testing.T) {
+	unverified := &fakeLoginProvider{name: "github", identity: auth.Identity{Subject: "1", Email: "boss@example.com"}}
+	verified := &fakeLoginProvider{name: "keycloak", identity: auth.Identity{Subject: "2", Email: "boss@example.com", EmailVerified: true}}
+	_, router := setupLoginTest(t, []string{"boss@example.com"}, unverified, verified)
+
+	// 未验证的邮箱不能用于匹配 allowed_emails
+	w := doCallback(router, "github")
+	if w.Header().Get("Location") != "http://app/login?error=unauthorized" {
+		t.Errorf("unverified email location = %q, want unauthorized", w.Header().Get("Location"))
+	}
+
+	w = doCallback(router, "keycloak")
+	if responseCookie(w, "auth_token") == nil {
+		t.Errorf("verified email was rejected, location = %q", w.Header().Get("Location"))
+	}
+}
+
+func TestOAuthCallbackLinksIdentity(t *testing.T) {
+	keycloak := &fakeLoginProvider{name: "keycloak", identity: auth.Identity{Subject: "kc-1", Email: "alice@corp.example.com", EmailVerified: true}}
+	github := &fakeLoginProvider{name: "github", identity: auth.Identity{Subject: "gh-1", Email: "alice@example.com", EmailVerified: true}}
+	a, router := setupLoginTest(t, nil, keycloak, github)
+
+	authCookie := responseCookie(doCallback(router, "keycloak"), "auth_token")
+
+	// 开始关联 GitHub，回调时关联到当前用户
+	w := doLoginRequest(router, http.MethodPost, "/api/auth/identities/github", authCookie)
+	if w.Code != http.StatusOK || responseCookie(w, "oauth_link") == nil {
+		t.Fatalf("link status = %d, body = %s", w.Code, w.Body.String())
+	}
+	w = doCallback(router, "github", authCookie, &http.Cookie{Name: "oauth_link", Value: "1"})
+	if w.Code != http.StatusFound || responseCookie(w, "auth_token") != nil {
+		t.Fatalf("link callback status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// 之后可以使用 GitHub 登录同一用户
+	githubCookie := responseCookie(doCallback(router, "github"), "auth_token")
+	claims, err := a.authService.ValidateJWT(githubCookie.Value)
+	if err != nil {
+		t.Fatalf("invalid auth token: %v", err)
+	}
+	keycloakClaims, _ := a.authService.ValidateJWT(authCookie.Value)
+	if claims.UserID != keycloakClaims.UserID {
+		t.Errorf("github login user = %d, want %d", claims.UserID, keycloakClaims.UserID)
+	}
+
+	w = doLoginRequest(router, http.MethodGet, "/api/auth/identities", authCookie)
+	var resp struct {
+		Identities []UserIdentityResponse `json:"identities"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode identities: %v", err)
+	}
+	if len(resp.Identities) != 2 || resp.Identities[1].Provider != "github" || resp.Identities[1].DisplayName != "GITHUB" {
+		t.Errorf("identities = %+v", resp.Identities)
+	}
+}
+
+func TestOAuthCallbackLinkIdentityInUse(t *testing.T) {
+	keycloak := &fakeLoginProvider{name: "keycloak", identity: auth.Identity{Subject: "kc-1"}}
+	github := &fakeLoginProvider{name: "github", identity: auth.Identity{Subject: "gh-1"}}
+	_, router := setupLoginTest(t, nil, keycloak, github)
+
+	// GitHub 身份已属于另一个用户
+	doCallback(router, "github")
+	authCookie := responseCookie(doCallback(router, "keycloak"), "auth_token")
+
+	w := doCallback(router, "github", authCookie, &http.Cookie{Name: "oauth_link", Value: "1"},
+		&http.Cookie{Name: "oauth_return_to", Value: "/settings/login-methods"})
+	if w.Header().Get("Location") != "http://app/settings/login-methods?error=identity_in_use" {
+		t.Errorf("location = %q, want identity_in_use", w.Header().Get("Location"))
+	}
+
+	// 登录已过期时不能关联
+	w = doCallback(router, "github", &http.Cookie{Name: "oauth_link", Value: "1"})
+	if w.Header().Get("Location") != "http://app/login?error=session_expired" {
+		t.Errorf("location = %q, want session_expired", w.Header().Get("Location"))
+	}
+}
+
+func TestDeleteIdentity(t *testing.T) {
+	keycloak := &fakeLoginProvider{name: "keycloak", identity: auth.Identity{Subject: "kc-1"}}
+	google := &fakeLoginProvider{name: auth.ProviderGoogle, identity: auth.Identity{Subject: "g-1", RefreshToken: "refresh"}}
+	a, router := setupLoginTest(t, nil, keycloak, google)
+
+	authCookie := responseCookie(doCallback(router, "keycloak"), "auth_token")
+	var keycloakIdentity table.UserIdentity
+	a.db.Where("provider = ?", "keycloak").First(&keycloakIdentity)
+
+	if w := doLoginRequest(router, http.MethodDelete, "/api/auth/identities/"+strconv.Itoa(keycloakIdentity.ID), authCookie); w.Code != http.StatusConflict {
+		t.Errorf("delete last identity status = %d, want 409", w.Code)
+	}
+
+	doCallback(router, auth.ProviderGoogle, authCookie, &http.Cookie{Name: "oauth_link", Value: "1"})
+	var user table.User
+	a.db.First(&user, keycloakIdentity.UserID)
+	if user.GoogleUserID != "g-1" || user.GoogleOAuthRefreshToken != "refresh" {
+		t.Fatalf("linked google account not saved: %+v", user)
+	}
+
+	var googleIdentity table.UserIdentity
+	a.db.Where("provider = ?", auth.ProviderGoogle).First(&googleIdentity)
+	if w := doLoginRequest(router, http.MethodDelete, "/api/auth/identities/"+strconv.Itoa(googleIdentity.ID), authCookie); w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, body = %s", w.Code, w.Body.String())
+	}
+	a.db.First(&user, keycloakIdentity.UserID)
+	if user.GoogleUserID != "" || user.GoogleOAuthRefreshToken != "" {
+		t.Errorf("unlinked google account was kept: %+v", user)
+	}
+}
+
+func TestMigrationBackfillsGoogleIdentities(t *testing.T) {
+	a, router := setupLoginTest(t, nil, &fakeLoginProvider{name: auth.ProviderGoogle, identity: auth.Identity{Subject: "legacy"}})
+	legacy := table.User{GoogleUserID: "legacy", GoogleEmail: "old@example.com"}
+	if err := a.db.Create(&legacy).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := migration.New(a.db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	authCookie := responseCookie(doCallback(router, auth.ProviderGoogle), "auth_token")
+	claims, err := a.authService.ValidateJWT(authCookie.Value)
+	if err != nil {
+		t.Fatalf("invalid auth token: %v", err)
+	}
+	if claims.UserID != legacy.ID {
+		t.Errorf("google login user = %d, want existing user %d", claims.UserID, legacy.ID)
+	}
+}
+
+func TestNewLoginProviders(t *testing.T) {
+	authService := auth.NewAuthService(&auth.Config{JWTSecret: "test-secret"})
+	providers, err := newLoginProviders(&Config{
+		GoogleClientID: "google",
+		GitHubLogin:    GitHubLogin{ClientID: "github"},
+		OIDCProviders:  []OIDCLogin{{Name: "keycloak", Issuer: "https://kc.example.com/realms/corp", ClientID: "aiguide"}},
+	}, authService)
+	if err != nil {
+		t.Fatalf("newLoginProviders() error = %v", err)
+	}
+	var names []string
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	if strings.Join(names, ",") != "google,github,keycloak" {
+		t.Errorf("providers = %v", names)
+	}
+
+	for _, invalid := range []OIDCLogin{
+		{Name: "github", Issuer: "https://kc.example.com", ClientID: "aiguide"},
+		{Name: "Key Cloak", Issuer: "https://kc.example.com", ClientID: "aiguide"},
+		{Name: "keycloak", ClientID: "aiguide"},
+	} {
+		if _, err := newLoginProviders(&Config{OIDCProviders: []OIDCLogin{invalid}}, authService); err == nil {
+			t.Errorf("newLoginProviders(%+v) succeeded, want error", invalid)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 邀请码有效期（天）
+const (
+	defaultInviteDays = 7
+	maxInviteDays     = 30
+)
+
+// InviteResponse 邀请码信息，邀请码本身只在创建时返回一次
+type InviteResponse struct {
+	ID        int        `json:"id"`
+	Prefix    string     `json:"prefix"`
+	Email     string     `json:"email"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type createInviteRequest struct {
+	Email         string `json:"email"`           // 留空表示任意邮箱可用
+	ExpiresInDays int    `json:"expires_in_days"` // 默认 7 天
+}
+
+func toInviteResponse(invite *table.InviteCode) InviteResponse {
+	return InviteResponse{
+		ID:        invite.ID,
+		Prefix:    invite.Prefix,
+		Email:     invite.Email,
+		ExpiresAt: invite.ExpiresAt,
+		UsedAt:    invite.UsedAt,
+		CreatedAt: invite.CreatedAt,
+	}
+}
+
+// ListInvites 列出当前用户创建的邀请码
+func (a *AIGuide) ListInvites(c *gin.Context) {
+	userID, existed := middleware.GetUserID(c)
+	if !existed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+
+	var invites []table.InviteCode
+	if err := a.db.Where("created_by = ?", userID).Order("id DESC").Find(&invites).Error; err != nil {
+		slog.Error("failed to list invite codes", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list invites"})
+		return
+	}
+	resp := make([]InviteResponse, 0, len(invites))
+	for i := range invites {
+		resp = append(resp, toInviteResponse(&invites[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"invites": resp})
+}
+
+// CreateInvite 创建注册本地账号的邀请码
+func (a *AIGuide) CreateInvite(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	userID, existed := middleware.GetUserID(c)
+	if !existed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	var req createInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultInviteDays
+	}
+	if days < 1 || days > maxInviteDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be between 1 and " + strconv.Itoa(maxInviteDays)})
+		return
+	}
+	email := ""
+	if strings.TrimSpace(req.Email) != "" {
+		var ok bool
+		if email, ok = normalizeEmail(req.Email); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+			return
+		}
+	}
+
+	code, hash, err := auth.GenerateInviteCode()
+	if err != nil {
+		slog.Error("failed to generate invite code", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+	invite := table.InviteCode{
+		CreatedBy: userID,
+		CodeHash:  hash,
+		Prefix:    code[:strings.IndexByte(code, '-')],
+		Email:     email,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+	if err := a.db.Create(&invite).Error; err != nil {
+		slog.Error("failed to create invite code", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"invite": toInviteResponse(&invite), "code": code})
+}
+
+// DeleteInvite 删除当前用户创建的邀请码，未使用的邀请码随之失效
+func (a *AIGuide) DeleteInvite(c *gin.Context) {
+	userID, existed := middleware.GetUserID(c)
+	if !existed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	result := a.db.Where("id = ? AND created_by = ?", id, userID).Delete(&table.InviteCode{})
+	if result.Error != nil {
+		slog.Error("failed to delete invite code", "err", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete invite"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invite not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "invite deleted"})
+}
@@ -0,0 +1,658 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/middleware"
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 本地账号的注册方式
+const (
+	registrationInvite = "invite"
+	registrationOpen   = "open"
+	registrationClosed = "closed"
+)
+
+const (
+	maxFailedLogins       = 5                  // 连续失败次数达到后锁定登录
+	loginLockDuration     = 15 * time.Minute   // 登录锁定时长
+	passwordResetTTL      = time.Hour          // 密码重置链接有效期
+	passwordResetInterval = time.Minute        // 同一账号发送重置邮件的最小间隔
+	accountSetupTTL       = 7 * 24 * time.Hour // 为他人创建账户时设置密码链接的有效期
+	registrationLinkTTL   = 24 * time.Hour     // 开放注册时邮件中设置密码链接的有效期
+)
+
+var (
+	errEmailTaken         = errors.New("email is already registered")
+	errInvalidInvite      = errors.New("invalid or expired invite code")
+	errRegistrationClosed = errors.New("registration is closed")
+	errEmailNotAllowed    = errors.New("email is not allowed")
+	errInvalidResetToken  = errors.New("invalid or expired token")
+	errRegistrationRetry  = errors.New("registration requires email confirmation, please retry")
+)
+
+type localLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type localRegisterRequest struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Name       string `json:"name"`
+	InviteCode string `json:"invite_code"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type createLocalAccountRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// validateLocalAccounts 校验本地账号配置
+func validateLocalAccounts(cfg LocalAccounts) error {
+	switch cfg.Registration {
+	case "", registrationInvite, registrationOpen, registrationClosed:
+		return nil
+	default:
+		return fmt.Errorf("invalid local_accounts.registration %q, must be invite, open or closed", cfg.Registration)
+	}
+}
+
+// registrationMode 返回本地账号的注册方式，默认凭邀请码注册
+func (a *AIGuide) registrationMode() string {
+	return cmp.Or(a.config.LocalAccounts.Registration, registrationInvite)
+}
+
+// frontendURL 返回前端地址，未配置时使用本地开发地址
+func (a *AIGuide) frontendURL() string {
+	return cmp.Or(a.config.FrontendURL, "http://localhost:3000")
+}
+
+// localAccountsEnabled 未启用本地账号时返回 404
+func (a *AIGuide) localAccountsEnabled(c *gin.Context) bool {
+	if !a.config.LocalAccounts.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "local accounts are disabled"})
+		return false
+	}
+	return true
+}
+
+// normalizeEmail 校验邮箱格式并转为小写，不接受带显示名称的地址
+func normalizeEmail(email string) (string, bool) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
+
+// createLocalUser 创建本地账号：用户、密码凭据与 local 登录身份，passwordHash 为空时需通过设置链接设置密码
+func createLocalUser(tx *gorm.DB, email, name, passwordHash string) (*table.User, error) {
+	var count int64
+	if err := tx.Model(&table.LocalCredential{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check email: %w", err)
+	}
+	if count > 0 {
+		return nil, errEmailTaken
+	}
+
+	user := table.User{GoogleEmail: email, GoogleName: name}
+	if err := createUser(tx, &user); err != nil {
+		return nil, err
+	}
+	if err := addLocalCredential(tx, user.ID, email, name, passwordHash); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// addLocalCredential 为已有用户添加密码凭据与 local 登录身份
+func addLocalCredential(tx *gorm.DB, userID int, email, name, passwordHash string) error {
+	var count int64
+	if err := tx.Model(&table.UserIdentity{}).
+		Where("provider = ? AND subject = ?", auth.ProviderLocal, email).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+	if count > 0 {
+		return errEmailTaken
+	}
+
+	cred := table.LocalCredential{UserID: userID, Email: email, PasswordHash: passwordHash}
+	if err := tx.Create(&cred).Error; err != nil {
+		return fmt.Errorf("failed to create local credential: %w", err)
+	}
+	return createUserIdentity(tx, userID, &auth.Identity{
+		Provider: auth.ProviderLocal,
+		Subject:  email,
+		Email:    email,
+		Name:     name,
+	})
+}
+
+// useInviteCode 将邀请码标记为已被 userID 使用，邀请码无效、过期、已使用或限定了其他邮箱时返回 errInvalidInvite
+func useInviteCode(tx *gorm.DB, code, email string, userID int, now time.Time) error {
+	if strings.TrimSpace(code) == "" {
+		return errInvalidInvite
+	}
+	var invite table.InviteCode
+	err := tx.Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", auth.HashInviteCode(code), now).First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errInvalidInvite
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find invite code: %w", err)
+	}
+	if invite.Email != "" && invite.Email != email {
+		return errInvalidInvite
+	}
+
+	// 条件更新避免同一邀请码被并发使用两次
+	result := tx.Model(&table.InviteCode{}).
+		Where("id = ? AND used_at IS NULL", invite.ID).
+		Updates(map[string]any{"used_at": now, "used_by": userID})
+	if result.Error != nil {
+		return fmt.Errorf("failed to use invite code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidInvite
+	}
+	return nil
+}
+
+// createPasswordResetToken 创建一次性的设置密码令牌，返回前端设置密码页面的链接
+func (a *AIGuide) createPasswordResetToken(db *gorm.DB, userID int, ttl time.Duration) (string, time.Time, error) {
+	token, hash, err := auth.GenerateOneTimeToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(ttl)
+	record := table.PasswordResetToken{UserID: userID, TokenHash: hash, ExpiresAt: expiresAt}
+	if err := db.Create(&record).Error; err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return a.frontendURL() + "/reset-password?token=" + url.QueryEscape(token), expiresAt, nil
+}
+
+// sendEmailAsync 在后台发送系统邮件，避免 SMTP 耗时暴露账号是否存在
+func (a *AIGuide) sendEmailAsync(to, subject, body string) {
+	go func() {
+		if err := a.sendSystemEmail(to, subject, body); err != nil {
+			slog.Error("failed to send system email", "subject", subject, "err", err)
+		}
+	}()
+}
+
+// LocalLogin 使用邮箱和密码登录，成功后签发与 OAuth 登录相同的令牌对
+func (a *AIGuide) LocalLogin(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	var req localLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	email, _ := normalizeEmail(req.Email)
+	var cred table.LocalCredential
+	err := a.db.Where("email = ?", email).First(&cred).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Error("failed to find local credential", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+	if err != nil || cred.PasswordHash == "" {
+		// 账号不存在或尚未设置密码时同样计算一次哈希，避免通过耗时探测账号
+		auth.CompareDummyPassword(req.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
+		return
+	}
+
+	now := time.Now()
+	if cred.LockedUntil != nil && cred.LockedUntil.After(now) {
+		c.Header("Retry-After", strconv.Itoa(int(cred.LockedUntil.Sub(now).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts, try again later"})
+		return
+	}
+
+	ok, err := auth.VerifyPassword(cred.PasswordHash, req.Password)
+	if err != nil {
+		slog.Error("failed to verify password", "user_id", cred.UserID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+	if !ok {
+		updates := map[string]any{"failed_attempts": gorm.Expr("failed_attempts + 1")}
+		if cred.FailedAttempts+1 >= maxFailedLogins {
+			slog.Warn("local account locked after failed logins", "user_id", cred.UserID)
+			updates = map[string]any{"failed_attempts": 0, "locked_until": now.Add(loginLockDuration)}
+		}
+		if err := a.db.Model(&cred).Updates(updates).Error; err != nil {
+			slog.Error("failed to record failed login", "user_id", cred.UserID, "err", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid email or password"})
+		return
+	}
+
+	updates := map[string]any{"failed_attempts": 0, "locked_until": nil}
+	if auth.PasswordNeedsRehash(cred.PasswordHash) {
+		// 导入的 bcrypt 或旧参数的哈希在登录成功后升级
+		if hash, err := auth.HashPassword(req.Password); err == nil {
+			updates["password_hash"] = hash
+		}
+	}
+	if err := a.db.Model(&cred).Updates(updates).Error; err != nil {
+		slog.Error("failed to update local credential", "user_id", cred.UserID, "err", err)
+	}
+
+	var user table.User
+	if err := a.db.First(&user, cred.UserID).Error; err != nil {
+		slog.Error("failed to find user", "user_id", cred.UserID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
+		return
+	}
+	// 与 OAuth 登录相同，只允许列表中的邮箱登录，管理员除外；本地邮箱未经提供方验证，只按账户邮箱匹配
+	allowedEmails, err := a.allowedEmails()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to login"})
+		return
+	}
+	if !loginAllowed(allowedEmails, &user, &auth.Identity{Provider: auth.ProviderLocal, Subject: cred.Email, Email: cred.Email}) {
+		slog.Warn("local login attempt from unauthorized email", "user_id", user.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": errEmailNotAllowed.Error()})
+		return
+	}
+	if !a.setLoginCookies(c, &user) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": user.ID})
+}
+
+// LocalRegister 注册本地账号。首个账户无需邀请码；之后按配置的注册方式校验邀请码或允许登录的邮箱。
+// 开放注册时不接受提交的密码，而是向邮箱发送设置密码的链接，确认邮箱属于注册者后账户才能登录
+func (a *AIGuide) LocalRegister(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	var req localRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+		return
+	}
+
+	mode := a.registrationMode()
+	var userCount int64
+	if err := a.db.Model(&table.User{}).Count(&userCount).Error; err != nil {
+		slog.Error("failed to count users", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register"})
+		return
+	}
+	confirmEmail := mode == registrationOpen && userCount > 0
+	var hash string
+	if confirmEmail {
+		if a.sendSystemEmail == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "registration is not available, smtp is not configured"})
+			return
+		}
+	} else {
+		if err := auth.ValidatePassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 哈希计算较慢，放在事务之外
+		var err error
+		if hash, err = auth.HashPassword(req.Password); err != nil {
+			slog.Error("failed to hash password", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register"})
+			return
+		}
+	}
+	name := cmp.Or(strings.TrimSpace(req.Name), email[:strings.IndexByte(email, '@')])
+
+	var user *table.User
+	var link string
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var userCount int64
+		if err := tx.Model(&table.User{}).Count(&userCount).Error; err != nil {
+			return err
+		}
+		if userCount > 0 {
+			switch {
+			case mode == registrationClosed:
+				return errRegistrationClosed
+			case mode == registrationOpen && !confirmEmail:
+				// 首个账户已由并发的请求创建
+				return errRegistrationRetry
+			}
+			// 凭邀请码注册同样受允许列表限制，邀请码发出后邮箱可能已被移出列表
+			var allowed []string
+			if err := tx.Model(&table.AllowedEmail{}).Pluck("email", &allowed).Error; err != nil {
+				return err
+			}
+			if len(allowed) > 0 && !emailListed(allowed, email) {
+				return errEmailNotAllowed
+			}
+		}
+
+		var err error
+		if user, err = createLocalUser(tx, email, name, hash); err != nil {
+			return err
+		}
+		if confirmEmail {
+			link, _, err = a.createPasswordResetToken(tx, user.ID, registrationLinkTTL)
+			return err
+		}
+		if userCount > 0 && mode == registrationInvite {
+			return useInviteCode(tx, req.InviteCode, email, user.ID, time.Now())
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errRegistrationClosed), errors.Is(err, errEmailNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errInvalidInvite):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errEmailTaken), errors.Is(err, errRegistrationRetry):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		slog.Error("failed to register local account", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to register"})
+		return
+	}
+
+	if confirmEmail {
+		a.sendEmailAsync(email, "完成 AIGuide 注册", fmt.Sprintf(
+			"请在 %d 小时内打开以下链接设置密码，完成注册：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件。",
+			int(registrationLinkTTL.Hours()), link))
+		c.JSON(http.StatusAccepted, gin.H{"message": "a link to set the password has been sent to the email"})
+		return
+	}
+	if !a.setLoginCookies(c, user) {
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"user_id": user.ID})
+}
+
+// RequestPasswordReset 发送密码重置邮件。无论账号是否存在都返回相同响应
+func (a *AIGuide) RequestPasswordReset(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	if a.sendSystemEmail == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "password reset is not available, smtp is not configured"})
+		return
+	}
+	var req passwordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	resp := gin.H{"message": "if the account exists, a password reset email has been sent"}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	var cred table.LocalCredential
+	if err := a.db.Where("email = ?", email).First(&cred).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Error("failed to find local credential", "err", err)
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// 限制发送频率，避免被用来向他人邮箱发送大量邮件
+	var recent int64
+	if err := a.db.Model(&table.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", cred.UserID, time.Now().Add(-passwordResetInterval)).
+		Count(&recent).Error; err != nil || recent > 0 {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	link, _, err := a.createPasswordResetToken(a.db, cred.UserID, passwordResetTTL)
+	if err != nil {
+		slog.Error("failed to create password reset token", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+	a.sendEmailAsync(email, "重置 AIGuide 密码", fmt.Sprintf(
+		"请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n如果不是你本人操作，请忽略这封邮件。",
+		int(passwordResetTTL.Minutes()), link))
+	c.JSON(http.StatusOK, resp)
+}
+
+// ConfirmPasswordReset 使用重置令牌设置新密码，同时解除登录锁定并使该用户其他未使用的令牌失效
+func (a *AIGuide) ConfirmPasswordReset(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	var req passwordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		slog.Error("failed to hash password", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	now := time.Now()
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		var token table.PasswordResetToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", auth.HashAPIToken(req.Token), now).First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+		// 使用令牌的同时使该用户其他未使用的令牌失效
+		result := tx.Model(&table.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Model(&table.LocalCredential{}).Where("user_id = ?", token.UserID).
+			Updates(map[string]any{"password_hash": hash, "failed_attempts": 0, "locked_until": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 密码登录方式已被解除
+			return errInvalidResetToken
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+	case errors.Is(err, errInvalidResetToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		slog.Error("failed to reset password", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+	}
+}
+
+// ChangePassword 修改当前用户的密码。已有密码时需校验当前密码；
+// 通过 OAuth 登录的用户首次设置密码时，以账户邮箱添加密码登录方式
+func (a *AIGuide) ChangePassword(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	userID, existed := middleware.GetUserID(c)
+	if !existed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cred table.LocalCredential
+	err := a.db.Where("user_id = ?", userID).First(&cred).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Error("failed to find local credential", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+	if err == nil && cred.PasswordHash != "" {
+		ok, err := auth.VerifyPassword(cred.PasswordHash, req.CurrentPassword)
+		if err != nil {
+			slog.Error("failed to verify password", "user_id", userID, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "current password is incorrect"})
+			return
+		}
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		slog.Error("failed to hash password", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+
+	if cred.ID != 0 {
+		if err := a.db.Model(&cred).Updates(map[string]any{"password_hash": hash, "failed_attempts": 0, "locked_until": nil}).Error; err != nil {
+			slog.Error("failed to update password", "user_id", userID, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+		return
+	}
+
+	var user table.User
+	if err := a.db.First(&user, userID).Error; err != nil {
+		slog.Error("failed to find user", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+	email, ok := normalizeEmail(user.GoogleEmail)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account has no valid email"})
+		return
+	}
+	err = a.db.Transaction(func(tx *gorm.DB) error {
+		return addLocalCredential(tx, userID, email, user.GoogleName, hash)
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+	case errors.Is(err, errEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		slog.Error("failed to add local credential", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+	}
+}
+
+// CreateLocalAccount 为他人创建本地账号，返回设置密码的链接；配置了 SMTP 时同时发送到对方邮箱
+func (a *AIGuide) CreateLocalAccount(c *gin.Context) {
+	if !a.localAccountsEnabled(c) {
+		return
+	}
+	var req createLocalAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+		return
+	}
+	name := cmp.Or(strings.TrimSpace(req.Name), email[:strings.IndexByte(email, '@')])
+
+	var (
+		user      *table.User
+		link      string
+		expiresAt time.Time
+	)
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if user, err = createLocalUser(tx, email, name, ""); err != nil {
+			return err
+		}
+		link, expiresAt, err = a.createPasswordResetToken(tx, user.ID, accountSetupTTL)
+		return err
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		slog.Error("failed to create local account", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create account"})
+		return
+	}
+
+	if a.sendSystemEmail != nil {
+		a.sendEmailAsync(email, "你的 AIGuide 账户已创建", fmt.Sprintf(
+			"已为你创建 AIGuide 账户，登录邮箱为 %s。\n\n请在 %d 天内打开以下链接设置密码：\n\n%s",
+			email, int(accountSetupTTL.Hours()/24), link))
+	}
+	c.JSON(http.StatusCreated, gin.H{"user_id": user.ID, "setup_url": link, "expires_at": expiresAt})
+}
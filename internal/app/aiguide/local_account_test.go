@@ -0,0 +1,435 @@
+package aiguide
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// doJSONRequest 发送 JSON 请求，附带指定的 cookie
+func doJSONRequest(router *gin.Engine, method, path string, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func setupLocalAccountTest(t *testing.T, registration string) (*AIGuide, *gin.Engine) {
+	t.Helper()
+	a, router := setupLoginTest(t, nil)
+	a.config.LocalAccounts = LocalAccounts{Enabled: true, Registration: registration}
+	return a, router
+}
+
+func registerLocal(router *gin.Engine, email, password, inviteCode string) *httptest.ResponseRecorder {
+	return doJSONRequest(router, http.MethodPost, "/api/auth/local/register", gin.H{
+		"email": email, "password": password, "invite_code": inviteCode,
+	})
+}
+
+func loginLocal(router *gin.Engine, email, password string) *httptest.ResponseRecorder {
+	return doJSONRequest(router, http.MethodPost, "/api/auth/local/login", gin.H{"email": email, "password": password})
+}
+
+func TestLocalRegisterWithInvite(t *testing.T) {
+	a, router := setupLocalAccountTest(t, "")
+
+	// 首个账户无需邀请码
+	w := registerLocal(router, "Admin@Example.com", "admin-password", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("bootstrap register status = %d, body = %s", w.Code, w.Body.String())
+	}
+	adminCookie := responseCookie(w, "auth_token")
+	if adminCookie == nil || responseCookie(w, "refresh_token") == nil {
+		t.Fatal("register did not set token cookies")
+	}
+	var cred table.LocalCredential
+	if err := a.db.First(&cred).Error; err != nil || cred.Email != "admin@example.com" {
+		t.Fatalf("credential = %+v, err = %v", cred, err)
+	}
+	var identities int64
+	a.db.Model(&table.UserIdentity{}).Where("provider = ? AND subject = ?", auth.ProviderLocal, "admin@example.com").Count(&identities)
+	if identities != 1 {
+		t.Errorf("local identities = %d, want 1", identities)
+	}
+
+	if w := registerLocal(router, "bob@example.com", "bob-password", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("register without invite status = %d, want 400", w.Code)
+	}
+
+	w = doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{}, adminCookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create invite status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var invite struct {
+		Code   string         `json:"code"`
+		Invite InviteResponse `json:"invite"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &invite); err != nil {
+		t.Fatalf("failed to decode invite: %v", err)
+	}
+	if !strings.HasPrefix(invite.Code, invite.Invite.Prefix+"-") {
+		t.Errorf("code = %q, prefix = %q", invite.Code, invite.Invite.Prefix)
+	}
+
+	if w := registerLocal(router, "bob@example.com", "bob-password", strings.ToLower(invite.Code)); w.Code != http.StatusCreated {
+		t.Fatalf("register with invite status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := registerLocal(router, "carol@example.com", "carol-password", invite.Code); w.Code != http.StatusBadRequest {
+		t.Errorf("reused invite status = %d, want 400", w.Code)
+	}
+
+	var used table.InviteCode
+	a.db.First(&used, invite.Invite.ID)
+	if used.UsedAt == nil || used.UsedBy == 0 {
+		t.Errorf("invite not marked used: %+v", used)
+	}
+}
+
+func TestLocalRegisterModes(t *testing.T) {
+	a, router := setupLocalAccountTest(t, registrationClosed)
+	if w := registerLocal(router, "admin@example.com", "admin-password", ""); w.Code != http.StatusCreated {
+		t.Fatalf("bootstrap register status = %d", w.Code)
+	}
+	if w := registerLocal(router, "bob@example.com", "bob-password", ""); w.Code != http.StatusForbidden {
+		t.Errorf("closed register status = %d, want 403", w.Code)
+	}
+
+	a.config.LocalAccounts.Registration = registrationOpen
+	if w := registerLocal(router, "bob@example.com", "", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("open register without smtp status = %d, want 503", w.Code)
+	}
+	emails := make(chan string, 4)
+	a.sendSystemEmail = func(to, _, body string) error {
+		emails <- to + "\n" + body
+		return nil
+	}
+	if err := importAllowedEmails(a.db, []string{"Bob@example.com"}); err != nil {
+		t.Fatalf("importAllowedEmails() error = %v", err)
+	}
+	if w := registerLocal(router, "eve@example.com", "eve-password", ""); w.Code != http.StatusForbidden {
+		t.Errorf("open register with disallowed email status = %d, want 403", w.Code)
+	}
+	w := registerLocal(router, "bob@example.com", "bob-password", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("open register status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if responseCookie(w, "auth_token") != nil {
+		t.Error("open register logged in before the email was confirmed")
+	}
+	if w := registerLocal(router, "BOB@example.com", "bob-password", ""); w.Code != http.StatusConflict {
+		t.Errorf("duplicate register status = %d, want 409", w.Code)
+	}
+	// 通过邮件中的链接设置密码之前无法登录，提交的密码不会生效
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unconfirmed login status = %d, want 401", w.Code)
+	}
+
+	var email string
+	select {
+	case email = <-emails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("registration email not sent")
+	}
+	match := resetLinkPattern.FindStringSubmatch(email)
+	if !strings.HasPrefix(email, "bob@example.com\n") || match == nil {
+		t.Fatalf("email = %q", email)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	confirm := gin.H{"token": token, "password": "bob-new-password"}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset/confirm", confirm); w.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := loginLocal(router, "bob@example.com", "bob-new-password"); w.Code != http.StatusOK {
+		t.Errorf("confirmed login status = %d, want 200", w.Code)
+	}
+
+	a.config.LocalAccounts.Enabled = false
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusNotFound {
+		t.Errorf("disabled login status = %d, want 404", w.Code)
+	}
+}
+
+func TestLocalLogin(t *testing.T) {
+	a, router := setupLocalAccountTest(t, "")
+	w := registerLocal(router, "admin@example.com", "admin-password", "")
+	var registered struct {
+		UserID int `json:"user_id"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &registered)
+
+	w = loginLocal(router, "ADMIN@example.com", "admin-password")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	claims, err := a.authService.ValidateJWT(responseCookie(w, "auth_token").Value)
+	if err != nil || claims.UserID != registered.UserID {
+		t.Errorf("claims = %+v, err = %v, want user %d", claims, err, registered.UserID)
+	}
+
+	if w := loginLocal(router, "nobody@example.com", "admin-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown email status = %d, want 401", w.Code)
+	}
+
+	for i := range maxFailedLogins {
+		if w := loginLocal(router, "admin@example.com", "wrong-password"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d status = %d, want 401", i, w.Code)
+		}
+	}
+	w = loginLocal(router, "admin@example.com", "admin-password")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("locked login status = %d, want 429 with Retry-After", w.Code)
+	}
+
+	// 锁定到期后可以再次登录
+	a.db.Model(&table.LocalCredential{}).Where("user_id = ?", registered.UserID).Update("locked_until", time.Now().Add(-time.Second))
+	if w := loginLocal(router, "admin@example.com", "admin-password"); w.Code != http.StatusOK {
+		t.Errorf("login after lock status = %d, want 200", w.Code)
+	}
+}
+
+func TestLocalLoginHonorsAllowlist(t *testing.T) {
+	_, router, adminCookie, _ := setupAdminTest(t)
+	w := doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{}, adminCookie)
+	var invite struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &invite); err != nil {
+		t.Fatalf("create invite status = %d, err = %v", w.Code, err)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": "dave@example.com", "confirm": true}, adminCookie); w.Code != http.StatusCreated {
+		t.Fatalf("add allowed email status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusForbidden || responseCookie(w, "auth_token") != nil {
+		t.Errorf("unlisted login status = %d, want 403", w.Code)
+	}
+	if w := loginLocal(router, "admin@example.com", "admin-password"); w.Code != http.StatusOK {
+		t.Errorf("admin login status = %d, want 200", w.Code)
+	}
+	// 邀请码在邮箱移出允许列表前发出，同样不能用于注册
+	if w := registerLocal(router, "carol@example.com", "carol-password", invite.Code); w.Code != http.StatusForbidden {
+		t.Errorf("unlisted register with invite status = %d, want 403", w.Code)
+	}
+
+	if w := doJSONRequest(router, http.MethodPost, "/api/admin/allowed-emails", gin.H{"email": "bob@example.com"}, adminCookie); w.Code != http.StatusCreated {
+		t.Fatalf("add allowed email status = %d", w.Code)
+	}
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusOK {
+		t.Errorf("listed login status = %d, want 200", w.Code)
+	}
+}
+
+func TestLocalLoginRehashesBcrypt(t *testing.T) {
+	a, router := setupLocalAccountTest(t, "")
+	registerLocal(router, "admin@example.com", "admin-password", "")
+	// 模拟从其他系统导入的 bcrypt 哈希
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("imported-password"), bcrypt.MinCost)
+	a.db.Model(&table.LocalCredential{}).Where("email = ?", "admin@example.com").Update("password_hash", string(bcryptHash))
+
+	if w := loginLocal(router, "admin@example.com", "imported-password"); w.Code != http.StatusOK {
+		t.Fatalf("bcrypt login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var cred table.LocalCredential
+	a.db.Where("email = ?", "admin@example.com").First(&cred)
+	if auth.PasswordNeedsRehash(cred.PasswordHash) {
+		t.Errorf("password hash = %q, want argon2id after login", cred.PasswordHash)
+	}
+}
+
+var resetLinkPattern = regexp.MustCompile(`http://app/reset-password\?token=(\S+)`)
+
+func TestPasswordReset(t *testing.T) {
+	a, router := setupLocalAccountTest(t, "")
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset", gin.H{"email": "admin@example.com"}); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("reset without smtp status = %d, want 503", w.Code)
+	}
+
+	emails := make(chan string, 4)
+	a.sendSystemEmail = func(to, _, body string) error {
+		emails <- to + "\n" + body
+		return nil
+	}
+	registerLocal(router, "admin@example.com", "admin-password", "")
+
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset", gin.H{"email": "nobody@example.com"}); w.Code != http.StatusOK {
+		t.Errorf("reset for unknown email status = %d, want 200", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset", gin.H{"email": "admin@example.com"}); w.Code != http.StatusOK {
+		t.Fatalf("reset status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var email string
+	select {
+	case email = <-emails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset email not sent")
+	}
+	match := resetLinkPattern.FindStringSubmatch(email)
+	if !strings.HasPrefix(email, "admin@example.com\n") || match == nil {
+		t.Fatalf("email = %q", email)
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	// 一分钟内重复申请不再发送
+	doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset", gin.H{"email": "admin@example.com"})
+	select {
+	case email := <-emails:
+		t.Errorf("unexpected second email: %q", email)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	confirm := gin.H{"token": token, "password": "new-password"}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset/confirm", confirm); w.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset/confirm", confirm); w.Code != http.StatusBadRequest {
+		t.Errorf("reused token status = %d, want 400", w.Code)
+	}
+	if w := loginLocal(router, "admin@example.com", "admin-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("old password status = %d, want 401", w.Code)
+	}
+	if w := loginLocal(router, "admin@example.com", "new-password"); w.Code != http.StatusOK {
+		t.Errorf("new password status = %d, want 200", w.Code)
+	}
+}
+
+func TestCreateLocalAccount(t *testing.T) {
+	_, router := setupLocalAccountTest(t, registrationClosed)
+	adminCookie := responseCookie(registerLocal(router, "admin@example.com", "admin-password", ""), "auth_token")
+
+	w := doJSONRequest(router, http.MethodPost, "/api/auth/local/accounts", gin.H{"email": "bob@example.com", "name": "Bob"}, adminCookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create account status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		SetupURL string `json:"setup_url"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	match := resetLinkPattern.FindStringSubmatch(created.SetupURL)
+	if match == nil {
+		t.Fatalf("setup_url = %q", created.SetupURL)
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	// 设置密码前无法登录
+	if w := loginLocal(router, "bob@example.com", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("login before setup status = %d, want 401", w.Code)
+	}
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/local/accounts", gin.H{"email": "bob@example.com"}, adminCookie); w.Code != http.StatusConflict {
+		t.Errorf("duplicate account status = %d, want 409", w.Code)
+	}
+
+	doJSONRequest(router, http.MethodPost, "/api/auth/local/password-reset/confirm", gin.H{"token": token, "password": "bob-password"})
+	if w := loginLocal(router, "bob@example.com", "bob-password"); w.Code != http.StatusOK {
+		t.Errorf("login after setup status = %d, want 200", w.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	github := &fakeLoginProvider{name: "github", identity: auth.Identity{Subject: "42", Email: "Octo@example.com", EmailVerified: true, Name: "Octo"}}
+	a, router := setupLoginTest(t, nil, github)
+	a.config.LocalAccounts = LocalAccounts{Enabled: true}
+	authCookie := responseCookie(doCallback(router, "github"), "auth_token")
+
+	// OAuth 用户首次设置密码时无需当前密码，以账户邮箱添加密码登录方式
+	w := doJSONRequest(router, http.MethodPut, "/api/auth/local/password", gin.H{"new_password": "first-password"}, authCookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set password status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := loginLocal(router, "octo@example.com", "first-password"); w.Code != http.StatusOK {
+		t.Errorf("login with new password status = %d, want 200", w.Code)
+	}
+	w = doLoginRequest(router, http.MethodGet, "/api/auth/identities", authCookie)
+	if !strings.Contains(w.Body.String(), `"provider":"local"`) || !strings.Contains(w.Body.String(), `"display_name":"Password"`) {
+		t.Errorf("identities = %s, want local identity", w.Body.String())
+	}
+
+	w = doJSONRequest(router, http.MethodPut, "/api/auth/local/password", gin.H{"current_password": "wrong-password", "new_password": "second-password"}, authCookie)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("wrong current password status = %d, want 403", w.Code)
+	}
+	w = doJSONRequest(router, http.MethodPut, "/api/auth/local/password", gin.H{"current_password": "first-password", "new_password": "second-password"}, authCookie)
+	if w.Code != http.StatusOK {
+		t.Errorf("change password status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 解除密码登录方式时删除密码凭据
+	var link table.UserIdentity
+	a.db.Where("provider = ?", auth.ProviderLocal).First(&link)
+	if w := doLoginRequest(router, http.MethodDelete, "/api/auth/identities/"+strconv.Itoa(link.ID), authCookie); w.Code != http.StatusOK {
+		t.Fatalf("unlink status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := loginLocal(router, "octo@example.com", "second-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("login after unlink status = %d, want 401", w.Code)
+	}
+}
+
+func TestInvites(t *testing.T) {
+	_, router := setupLocalAccountTest(t, "")
+	adminCookie := responseCookie(registerLocal(router, "admin@example.com", "admin-password", ""), "auth_token")
+
+	if w := doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{"expires_in_days": 31}, adminCookie); w.Code != http.StatusBadRequest {
+		t.Errorf("invite with long expiry status = %d, want 400", w.Code)
+	}
+	w := doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{}, adminCookie)
+	var created struct {
+		Code   string         `json:"code"`
+		Invite InviteResponse `json:"invite"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if days := time.Until(created.Invite.ExpiresAt).Hours() / 24; days < 6.9 || days > 7.1 {
+		t.Errorf("invite expires in %.1f days, want 7", days)
+	}
+
+	w = doLoginRequest(router, http.MethodGet, "/api/auth/invites", adminCookie)
+	if strings.Contains(w.Body.String(), created.Code) || !strings.Contains(w.Body.String(), created.Invite.Prefix) {
+		t.Errorf("invites = %s, want prefix only", w.Body.String())
+	}
+
+	if w := doLoginRequest(router, http.MethodDelete, "/api/auth/invites/"+strconv.Itoa(created.Invite.ID), adminCookie); w.Code != http.StatusOK {
+		t.Fatalf("delete invite status = %d", w.Code)
+	}
+	if w := registerLocal(router, "bob@example.com", "bob-password", created.Code); w.Code != http.StatusBadRequest {
+		t.Errorf("register with deleted invite status = %d, want 400", w.Code)
+	}
+
+	// 限定邮箱的邀请码只能由该邮箱使用
+	w = doJSONRequest(router, http.MethodPost, "/api/auth/invites", gin.H{"email": "Bob@example.com", "expires_in_days": 1}, adminCookie)
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Invite.Email != "bob@example.com" {
+		t.Errorf("invite email = %q, want normalized", created.Invite.Email)
+	}
+	if w := registerLocal(router, "eve@example.com", "eve-password", created.Code); w.Code != http.StatusBadRequest {
+		t.Errorf("register with invite for other email status = %d, want 400", w.Code)
+	}
+	if w := registerLocal(router, "bob@example.com", "bob-password", created.Code); w.Code != http.StatusCreated {
+		t.Errorf("register with invite status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestValidateLocalAccounts(t *testing.T) {
+	for _, mode := range []string{"", registrationInvite, registrationOpen, registrationClosed} {
+		if err := validateLocalAccounts(LocalAccounts{Registration: mode}); err != nil {
+			t.Errorf("validateLocalAccounts(%q) error = %v", mode, err)
+		}
+	}
+	if err := validateLocalAccounts(LocalAccounts{Registration: "public"}); err == nil {
+		t.Error("validateLocalAccounts(public) error = nil, want error")
+	}
+}
@@ -3,16 +3,73 @@ package aiguide
 import (
 	"aiguide/internal/app/aiguide/table"
 	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"regexp"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
 	"gorm.io/gorm"
 )
 
+// oidcProviderNamePattern OIDC 提供方名称出现在回调路由中，仅允许小写字母、数字、- 和 _
+var oidcProviderNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// loginHTTPClient 访问 GitHub 与 OIDC 提供方使用的 HTTP 客户端
+var loginHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// newLoginProviders 根据配置创建已启用的登录提供方
+func newLoginProviders(config *Config, authService *auth.AuthService) ([]auth.Provider, error) {
+	var providers []auth.Provider
+	if config.GoogleClientID != "" {
+		providers = append(providers, auth.NewGoogleProvider(authService))
+	}
+	if config.GitHubLogin.ClientID != "" {
+		providers = append(providers, auth.NewGitHubProvider(auth.GitHubConfig{
+			ClientID:     config.GitHubLogin.ClientID,
+			ClientSecret: config.GitHubLogin.ClientSecret,
+			RedirectURL:  config.GitHubLogin.RedirectURL,
+		}, loginHTTPClient))
+	}
+
+	names := map[string]bool{auth.ProviderGoogle: true, auth.ProviderGitHub: true, auth.ProviderLocal: true}
+	for _, p := range config.OIDCProviders {
+		if !oidcProviderNamePattern.MatchString(p.Name) || names[p.Name] {
+			return nil, fmt.Errorf("invalid or duplicate oidc provider name %q", p.Name)
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider %s: issuer and client_id are required", p.Name)
+		}
+		names[p.Name] = true
+		providers = append(providers, auth.NewOIDCProvider(auth.OIDCConfig{
+			Name:         p.Name,
+			DisplayName:  p.DisplayName,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, loginHTTPClient))
+	}
+	return providers, nil
+}
+
+// loginProvider 按名称查找已启用的登录提供方，未启用时返回 nil
+func (a *AIGuide) loginProvider(name string) auth.Provider {
+	for _, p := range a.loginProviders {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
 // setOAuthStateCookie generates a CSRF state token and stores it in a cookie.
 // Returns the state value for use in the OAuth URL, or an error.
 func (a *AIGuide) setOAuthStateCookie(c *gin.Context) (string, error) {
@@ -25,22 +82,69 @@ func (a *AIGuide) setOAuthStateCookie(c *gin.Context) (string, error) {
 	return state, nil
 }
 
-// GoogleLogin 处理 Google 登录请求
-func (a *AIGuide) GoogleLogin(c *gin.Context) {
-	state, err := a.setOAuthStateCookie(c)
+// startOAuth generates the state and the PKCE verifier of an authorization
+// request and stores both in cookies for the callback.
+func (a *AIGuide) startOAuth(c *gin.Context) (state, verifier string, err error) {
+	state, err = a.setOAuthStateCookie(c)
+	if err != nil {
+		return "", "", err
+	}
+	verifier = oauth2.GenerateVerifier()
+	c.SetCookie("oauth_verifier", verifier, 600, "/", "", a.secureCookie(), true)
+	return state, verifier, nil
+}
+
+// authCodeURL 开始授权流程并返回提供方的授权地址，失败时已写入错误响应
+func (a *AIGuide) authCodeURL(c *gin.Context, provider auth.Provider) (string, bool) {
+	state, verifier, err := a.startOAuth(c)
 	if err != nil {
 		slog.Error("failed to generate state token", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate state"})
+		return "", false
+	}
+	url, err := provider.AuthCodeURL(c.Request.Context(), state, verifier)
+	if err != nil {
+		slog.Error("failed to build auth url", "provider", provider.Name(), "err", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "login provider unavailable"})
+		return "", false
+	}
+	return url, true
+}
+
+// ListLoginProviders 返回已启用的登录提供方与本地账号设置，供登录页显示登录方式
+func (a *AIGuide) ListLoginProviders(c *gin.Context) {
+	providers := make([]gin.H, 0, len(a.loginProviders))
+	for _, p := range a.loginProviders {
+		providers = append(providers, gin.H{"name": p.Name(), "display_name": p.DisplayName()})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"providers": providers,
+		"local_accounts": gin.H{
+			"enabled":        a.config.LocalAccounts.Enabled,
+			"registration":   a.registrationMode(),
+			"password_reset": a.sendSystemEmail != nil,
+		},
+	})
+}
+
+// Login 处理登录请求，返回所选提供方的授权地址
+func (a *AIGuide) Login(c *gin.Context) {
+	provider := a.loginProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown login provider"})
 		return
 	}
 
-	url := a.authService.GetAuthURL(state)
+	url, ok := a.authCodeURL(c, provider)
+	if !ok {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"url": url})
 }
 
 // GoogleReauth 触发强制重新授权，用于存量用户补充 Calendar scope。
 func (a *AIGuide) GoogleReauth(c *gin.Context) {
-	state, err := a.setOAuthStateCookie(c)
+	state, verifier, err := a.startOAuth(c)
 	if err != nil {
 		slog.Error("failed to generate state token", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate state"})
@@ -48,15 +152,17 @@ func (a *AIGuide) GoogleReauth(c *gin.Context) {
 	}
 
 	secure := a.secureCookie()
-	// Mark this as a reauth so GoogleCallback can redirect back to the settings page.
+	// Mark this as a reauth so OAuthCallback can redirect back to the settings page.
 	c.SetCookie("oauth_return_to", "/settings/google-calendar", 600, "/", "", secure, true)
+	// Link the Google account to the signed-in user, who may have signed up with another provider.
+	c.SetCookie("oauth_link", "1", 600, "/", "", secure, true)
 
-	url := a.authService.GetAuthURLWithForceConsent(state)
+	url := a.authService.GetAuthURLWithForceConsent(state, oauth2.S256ChallengeOption(verifier))
 	c.Redirect(http.StatusFound, url)
 }
 
-// GoogleCallback 处理 Google OAuth 回调
-func (a *AIGuide) GoogleCallback(c *gin.Context) {
+// OAuthCallback 处理登录提供方的 OAuth 回调
+func (a *AIGuide) OAuthCallback(c *gin.Context) {
 	// 验证 state
 	stateCookie, err := c.Cookie("oauth_state")
 	if err != nil {
@@ -72,9 +178,22 @@ func (a *AIGuide) GoogleCallback(c *gin.Context) {
 		return
 	}
 
-	// 清除 state cookie
+	// 清除 state、PKCE 校验码与关联标记 cookie
 	secure := a.secureCookie()
 	c.SetCookie("oauth_state", "", -1, "/", "", secure, true)
+	verifier, _ := c.Cookie("oauth_verifier")
+	c.SetCookie("oauth_verifier", "", -1, "/", "", secure, true)
+	_, err = c.Cookie("oauth_link")
+	linking := err == nil
+	if linking {
+		c.SetCookie("oauth_link", "", -1, "/", "", secure, true)
+	}
+
+	provider := a.loginProvider(c.Param("provider"))
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown login provider"})
+		return
+	}
 
 	// 获取授权码
 	code := c.Query("code")
@@ -84,129 +203,226 @@ func (a *AIGuide) GoogleCallback(c *gin.Context) {
 		return
 	}
 
-	// 交换令牌
-	token, err := a.authService.ExchangeCode(c.Request.Context(), code)
+	// 交换令牌并获取用户身份
+	identity, err := provider.Exchange(c.Request.Context(), code, state, verifier)
 	if err != nil {
-		slog.Error("failed to exchange token", "err", err)
+		slog.Error("failed to exchange token", "provider", provider.Name(), "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to exchange token"})
 		return
 	}
 
-	// 获取用户信息
-	user, err := a.authService.GetGoogleUser(c.Request.Context(), token)
-	if err != nil {
-		slog.Error("failed to get user info", "err", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user info"})
-		return
-	}
-
-	// 验证是否在允许登录的邮箱列表中
-	frontendURL := a.config.FrontendURL
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3000"
-	}
+	frontendURL := a.frontendURL()
 
-	// Determine redirect target: reauth flows return to the settings page.
+	// Determine redirect target: reauth and link flows return to the settings page.
 	returnTo := frontendURL
 	if returnToCookie, err := c.Cookie("oauth_return_to"); err == nil && returnToCookie != "" {
 		returnTo = frontendURL + returnToCookie
 		c.SetCookie("oauth_return_to", "", -1, "/", "", secure, true)
 	}
 
-	// 如果 allowed_emails 为空，则允许所有人登录
-	allowed := len(a.config.AllowedEmails) == 0 || slices.Contains(a.config.AllowedEmails, user.Email)
-	if !allowed {
-		slog.Error("login attempt from unauthorized email", "email", user.Email)
+	if linking {
+		a.finishLinkIdentity(c, identity, frontendURL, returnTo)
+		return
+	}
+
+	dbUser, err := findIdentityUser(a.db, identity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save user info"})
+		return
+	}
+
+	// 验证是否在允许登录的邮箱列表中
+	allowedEmails, err := a.allowedEmails()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check allowed emails"})
+		return
+	}
+	if !loginAllowed(allowedEmails, dbUser, identity) {
+		slog.Error("login attempt from unauthorized email", "provider", identity.Provider, "email", identity.Email)
 		c.Redirect(http.StatusFound, frontendURL+"/login?error=unauthorized")
 		return
 	}
+	if dbUser != nil && dbUser.DisabledAt != nil {
+		slog.Warn("login attempt from disabled user", "user_id", dbUser.ID)
+		c.Redirect(http.StatusFound, frontendURL+"/login?error=disabled")
+		return
+	}
 
 	// 保存用户信息到数据库
-	dbUser, err := saveUser(a.db, user, token.RefreshToken)
+	dbUser, err = saveIdentityUser(a.db, dbUser, identity)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save user info"})
 		return
 	}
 
+	if !a.setLoginCookies(c, dbUser) {
+		return
+	}
+
+	// 重定向到前端
+	c.Redirect(http.StatusFound, returnTo)
+}
+
+// setLoginCookies 为用户生成访问令牌和刷新令牌并写入 cookie，失败时已写入错误响应
+func (a *AIGuide) setLoginCookies(c *gin.Context, user *table.User) bool {
 	// 生成访问令牌和刷新令牌，使用内部用户 ID
-	tokenPair, err := a.authService.GenerateTokenPair(dbUser.ID, user)
+	tokenPair, err := a.authService.GenerateTokenPair(user.ID, &auth.GoogleUser{
+		ID:    user.GoogleUserID,
+		Email: user.GoogleEmail,
+		Name:  user.GoogleName,
+	})
 	if err != nil {
 		slog.Error("failed to generate token pair", "err", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate tokens"})
-		return
+		return false
 	}
 
+	secure := a.secureCookie()
 	// 设置访问令牌 cookie (15分钟)
 	c.SetCookie("auth_token", tokenPair.AccessToken, 900, "/", "", secure, true)
 	// 设置刷新令牌 cookie (7天)，路径限制为 /api/auth 以减少暴露
 	c.SetCookie("refresh_token", tokenPair.RefreshToken, 604800, "/api/auth", "", secure, true)
 
-	// 重定向到前端
+	// UpdateColumn 不修改 updated_at，登录不算作账户资料被修改
+	if err := a.db.Model(user).UpdateColumn("last_login_at", time.Now()).Error; err != nil {
+		slog.Warn("failed to update last login time", "user_id", user.ID, "err", err)
+	}
+	return true
+}
+
+// finishLinkIdentity 将身份关联到当前登录的用户，当前用户取自 auth_token cookie
+func (a *AIGuide) finishLinkIdentity(c *gin.Context, identity *auth.Identity, frontendURL, returnTo string) {
+	token, _ := c.Cookie("auth_token")
+	claims, err := a.authService.ValidateJWT(token)
+	if err != nil {
+		c.Redirect(http.StatusFound, frontendURL+"/login?error=session_expired")
+		return
+	}
+
+	if err := linkIdentity(a.db, claims.UserID, identity); err != nil {
+		if errors.Is(err, errIdentityInUse) {
+			c.Redirect(http.StatusFound, returnTo+"?error=identity_in_use")
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to link identity"})
+		return
+	}
 	c.Redirect(http.StatusFound, returnTo)
 }
 
-func saveUser(db *gorm.DB, user *auth.GoogleUser, refreshToken string) (*table.User, error) {
+// loginAllowed 判断是否允许登录，允许列表为空时允许所有人。
+// 只接受提供方验证过的邮箱；已关联的身份也可凭账户邮箱登录。
+// 管理员始终允许登录，避免修改允许列表后把自己锁在外面。
+func loginAllowed(allowedEmails []string, user *table.User, identity *auth.Identity) bool {
+	if len(allowedEmails) == 0 || (user != nil && user.Role == constant.UserRoleAdmin) {
+		return true
+	}
+	if user != nil && emailListed(allowedEmails, user.GoogleEmail) {
+		return true
+	}
+	return identity.EmailVerified && emailListed(allowedEmails, identity.Email)
+}
+
+// emailListed 判断邮箱是否在列表中，忽略大小写
+func emailListed(emails []string, email string) bool {
+	return slices.ContainsFunc(emails, func(e string) bool { return strings.EqualFold(e, email) })
+}
+
+// findIdentityUser 查找身份已关联的用户并更新身份记录中的邮箱与名称，未关联时返回 nil
+func findIdentityUser(db *gorm.DB, identity *auth.Identity) (*table.User, error) {
+	var link table.UserIdentity
+	err := db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("failed to find user identity", "err", err)
+		return nil, fmt.Errorf("failed to find user identity: %w", err)
+	}
+
 	var u table.User
-	if err := db.Where("google_user_id = ?", user.ID).First(&u).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			slog.Error("failed to find user by google id", "err", err)
-			return nil, fmt.Errorf("failed to find user by google id: %w", err)
-		}
+	if err := db.First(&u, link.UserID).Error; err != nil {
+		slog.Error("failed to find linked user", "userID", link.UserID, "err", err)
+		return nil, fmt.Errorf("failed to find linked user: %w", err)
+	}
+	if err := db.Model(&link).Updates(map[string]any{"email": identity.Email, "name": identity.Name}).Error; err != nil {
+		slog.Error("failed to update user identity", "err", err)
+		return nil, fmt.Errorf("failed to update user identity: %w", err)
+	}
+	return &u, nil
+}
 
+// saveIdentityUser 保存登录用户的信息，user 为 nil 时创建新用户并关联身份。
+// 账户资料只在创建时以及使用 Google 登录时更新，Google 登录同时保存日历使用的 refresh_token。
+func saveIdentityUser(db *gorm.DB, user *table.User, identity *auth.Identity) (*table.User, error) {
+	if user == nil {
 		// Download avatar image
-		avatarData, mimeType, err := downloadAvatar(user.Picture)
+		avatarData, mimeType, err := downloadAvatar(identity.Picture)
 		if err != nil {
-			slog.Warn("failed to download avatar", "err", err, "url", user.Picture)
+			slog.Warn("failed to download avatar", "err", err, "url", identity.Picture)
 			// Continue without avatar data - store the URL anyway
 		}
 
-		u = table.User{
-			GoogleUserID:            user.ID,
-			GoogleEmail:             user.Email,
-			GoogleName:              user.Name,
-			Picture:                 user.Picture,
-			AvatarData:              avatarData,
-			AvatarMimeType:          mimeType,
-			GoogleOAuthRefreshToken: refreshToken,
-		}
-
-		if err := db.Create(&u).Error; err != nil {
-			slog.Error("failed to create user record", "err", err)
-			return nil, fmt.Errorf("failed to create user record: %w", err)
+		u := table.User{
+			GoogleEmail:    identity.Email,
+			GoogleName:     identity.Name,
+			Picture:        identity.Picture,
+			AvatarData:     avatarData,
+			AvatarMimeType: mimeType,
 		}
-	} else {
-		// Update existing user info with only the fields that may have changed.
-		// Using Updates(map) instead of Save avoids overwriting all columns (including
-		// large AvatarData) and prevents accidental zero-value overwrites.
-		oldPictureURL := u.Picture
-		updates := map[string]any{
-			"google_email": user.Email,
-			"google_name":  user.Name,
-			"picture":      user.Picture,
+		if identity.Provider == auth.ProviderGoogle {
+			u.GoogleUserID = identity.Subject
+			u.GoogleOAuthRefreshToken = identity.RefreshToken
 		}
 
-		if len(u.AvatarData) == 0 || oldPictureURL != user.Picture {
-			avatarData, mimeType, err := downloadAvatar(user.Picture)
-			if err != nil {
-				slog.Warn("failed to download avatar", "err", err, "url", user.Picture)
-			} else {
-				updates["avatar_data"] = avatarData
-				updates["avatar_mime_type"] = mimeType
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := createUser(tx, &u); err != nil {
+				return err
 			}
+			return createUserIdentity(tx, u.ID, identity)
+		})
+		if err != nil {
+			return nil, err
 		}
+		return &u, nil
+	}
 
-		// Google only issues a refresh_token on first authorization or after revocation.
-		// Only update when a new token is present to avoid clearing an existing one.
-		if refreshToken != "" {
-			updates["google_oauth_refresh_token"] = refreshToken
-			slog.Info("saveUser: persisting new Google OAuth refresh token", "userID", u.ID)
-		}
+	if identity.Provider != auth.ProviderGoogle {
+		return user, nil
+	}
+
+	// Update existing user info with only the fields that may have changed.
+	// Using Updates(map) instead of Save avoids overwriting all columns (including
+	// large AvatarData) and prevents accidental zero-value overwrites.
+	oldPictureURL := user.Picture
+	updates := map[string]any{
+		"google_user_id": identity.Subject,
+		"google_email":   identity.Email,
+		"google_name":    identity.Name,
+		"picture":        identity.Picture,
+	}
 
-		if err := db.Model(&u).Updates(updates).Error; err != nil {
-			slog.Error("failed to update user record", "err", err)
-			return nil, fmt.Errorf("failed to update user record: %w", err)
+	if len(user.AvatarData) == 0 || oldPictureURL != identity.Picture {
+		avatarData, mimeType, err := downloadAvatar(identity.Picture)
+		if err != nil {
+			slog.Warn("failed to download avatar", "err", err, "url", identity.Picture)
+		} else {
+			updates["avatar_data"] = avatarData
+			updates["avatar_mime_type"] = mimeType
 		}
 	}
 
-	return &u, nil
+	// Google only issues a refresh_token on first authorization or after revocation.
+	// Only update when a new token is present to avoid clearing an existing one.
+	if identity.RefreshToken != "" {
+		updates["google_oauth_refresh_token"] = identity.RefreshToken
+		slog.Info("saveIdentityUser: persisting new Google OAuth refresh token", "userID", user.ID)
+	}
+
+	if err := db.Model(user).Updates(updates).Error; err != nil {
+		slog.Error("failed to update user record", "err", err)
+		return nil, fmt.Errorf("failed to update user record: %w", err)
+	}
+
+	return user, nil
 }
@@ -2,14 +2,18 @@ package migration
 
 import (
 	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/secret"
 	"fmt"
 	"log/slog"
+	"strconv"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Migrator struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *secret.Cipher
 }
 
 func New(db *gorm.DB) *Migrator {
@@ -18,11 +22,163 @@ func New(db *gorm.DB) *Migrator {
 	}
 }
 
+// WithCipher sets the cipher used to encrypt credentials stored in plain text
+// by earlier versions. Without it those rows are left untouched.
+func (m *Migrator) WithCipher(cipher *secret.Cipher) *Migrator {
+	m.cipher = cipher
+	return m
+}
+
 func (m *Migrator) Run() error {
 	models := table.GetAllModels()
 	if err := m.db.AutoMigrate(models...); err != nil {
 		slog.Error("failed to run database auto migration", "err", err)
 		return fmt.Errorf("failed to run database auto migration: %w", err)
 	}
+	if err := m.backfillGoogleIdentities(); err != nil {
+		slog.Error("failed to backfill google identities", "err", err)
+		return fmt.Errorf("failed to backfill google identities: %w", err)
+	}
+	if err := m.promoteFirstAdmin(); err != nil {
+		slog.Error("failed to promote first admin", "err", err)
+		return fmt.Errorf("failed to promote first admin: %w", err)
+	}
+	if err := m.encryptMCPHeaders(); err != nil {
+		slog.Error("failed to encrypt mcp headers", "err", err)
+		return fmt.Errorf("failed to encrypt mcp headers: %w", err)
+	}
+	if err := m.backfillSessionOwners(); err != nil {
+		slog.Error("failed to backfill session owners", "err", err)
+		return fmt.Errorf("failed to backfill session owners: %w", err)
+	}
+	return nil
+}
+
+// adkSessionsTable is the table in which the ADK session service stores
+// sessions; its user_id column holds the owner's ID as a string.
+const adkSessionsTable = "sessions"
+
+// backfillSessionOwners records the owner of session metadata created before
+// owners were tracked, taking it from the ADK session with the same ID.
+// Metadata without a session, or whose ID several users have sessions under,
+// stays unowned.
+func (m *Migrator) backfillSessionOwners() error {
+	if !m.db.Migrator().HasTable(adkSessionsTable) {
+		return nil
+	}
+	var metas []table.SessionMeta
+	if err := m.db.Select("id", "session_id").Where("user_id = 0").Find(&metas).Error; err != nil {
+		return err
+	}
+	for _, meta := range metas {
+		var owners []string
+		if err := m.db.Table(adkSessionsTable).Where("id = ?", meta.SessionID).Distinct().Pluck("user_id", &owners).Error; err != nil {
+			return err
+		}
+		if len(owners) != 1 {
+			slog.Warn("cannot determine session owner, leaving it unowned", "session_id", meta.SessionID, "owners", len(owners))
+			continue
+		}
+		userID, err := strconv.Atoi(owners[0])
+		if err != nil || userID <= 0 {
+			slog.Warn("invalid session owner, leaving it unowned", "session_id", meta.SessionID, "user_id", owners[0])
+			continue
+		}
+		if err := m.db.Model(&table.SessionMeta{}).Where("id = ?", meta.ID).UpdateColumn("user_id", userID).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// encryptMCPHeaders encrypts the MCP server headers stored in plain text
+// before they were encrypted. An empty JSON object becomes an empty string.
+func (m *Migrator) encryptMCPHeaders() error {
+	if m.cipher == nil {
+		return nil
+	}
+	var configs []table.MCPServerConfig
+	if err := m.db.Select("id", "headers").Where("headers <> ''").Find(&configs).Error; err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		if secret.IsEncrypted(cfg.Headers) {
+			continue
+		}
+		headers := ""
+		if cfg.Headers != "{}" {
+			encrypted, err := m.cipher.Encrypt(cfg.Headers)
+			if err != nil {
+				return err
+			}
+			headers = encrypted
+		}
+		// UpdateColumn keeps updated_at, which the per-user toolset uses to
+		// detect edits; a migrated row has the same headers as before.
+		if err := m.db.Model(&table.MCPServerConfig{}).Where("id = ?", cfg.ID).UpdateColumn("headers", headers).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promoteFirstAdmin makes the oldest user an admin in deployments created
+// before roles existed, so someone can manage users.
+func (m *Migrator) promoteFirstAdmin() error {
+	users, err := m.table(&table.User{})
+	if err != nil {
+		return err
+	}
+	return m.db.Exec(`UPDATE ? SET role = 'admin'
+		WHERE id = (SELECT MIN(id) FROM ?)
+		AND NOT EXISTS (SELECT 1 FROM ? WHERE role = 'admin')`, users, users, users).Error
+}
+
+// backfillGoogleIdentities creates the login identity of users who signed up
+// with Google before identities were tracked in user_identities.
+func (m *Migrator) backfillGoogleIdentities() error {
+	users, err := m.table(&table.User{})
+	if err != nil {
+		return err
+	}
+	identities, err := m.table(&table.UserIdentity{})
+	if err != nil {
+		return err
+	}
+	return m.db.Exec(`INSERT INTO ? (user_id, provider, subject, email, name, created_at, updated_at)
+		SELECT u.id, 'google', u.google_user_id, u.google_email, u.google_name, u.created_at, u.updated_at
+		FROM ? u
+		WHERE u.google_user_id <> ''
+		AND NOT EXISTS (
+			SELECT 1 FROM ? i WHERE i.provider = 'google' AND i.subject = u.google_user_id
+		)`, identities, users, identities).Error
+}
+
+// RunOnce runs fn in a transaction unless the data migration called name has
+// run before, and records that it has. Use it for imports that must not be
+// repeated once their rows are edited or removed.
+func RunOnce(db *gorm.DB, name string, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&table.DataMigration{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check data migration %s: %w", name, err)
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Create(&table.DataMigration{Name: name}).Error
+	})
+}
+
+// table returns the table of model under the database's naming strategy, for
+// use in raw statements.
+func (m *Migrator) table(model any) (clause.Table, error) {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(model); err != nil {
+		return clause.Table{}, fmt.Errorf("failed to parse %T: %w", model, err)
+	}
+	return clause.Table{Name: stmt.Schema.Table}, nil
+}
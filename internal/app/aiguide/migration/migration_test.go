@@ -0,0 +1,103 @@
+package migration
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/secret"
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestEncryptMCPHeaders(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := New(db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	configs := []table.MCPServerConfig{
+		{UserID: 1, Name: "legacy", URL: "https://mcp.example.com", Headers: `{"Authorization":"Bearer t"}`},
+		{UserID: 1, Name: "empty", URL: "https://mcp.example.com", Headers: "{}"},
+		{UserID: 1, Name: "none", URL: "https://mcp.example.com"},
+	}
+	if err := db.Create(&configs).Error; err != nil {
+		t.Fatalf("failed to create configs: %v", err)
+	}
+
+	cipher, err := secret.NewCipher("test-key")
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	// A second run must not encrypt the rows again.
+	for range 2 {
+		if err := New(db).WithCipher(cipher).Run(); err != nil {
+			t.Fatalf("failed to migrate: %v", err)
+		}
+	}
+
+	var stored []table.MCPServerConfig
+	db.Order("id").Find(&stored)
+	plain, err := cipher.Decrypt(stored[0].Headers)
+	if err != nil || plain != configs[0].Headers {
+		t.Errorf("legacy headers decrypt to %q, err = %v", plain, err)
+	}
+	if stored[1].Headers != "" || stored[2].Headers != "" {
+		t.Errorf("empty headers = %q, %q; want empty", stored[1].Headers, stored[2].Headers)
+	}
+}
+
+func TestBackfillGoogleIdentitiesWithSingularTables(t *testing.T) {
+	// The server names tables in the singular; raw statements must follow it.
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(table.GetAllModels()...); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	user := table.User{GoogleUserID: "g-1", GoogleEmail: "old@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	m := New(db)
+	for range 2 {
+		if err := m.backfillGoogleIdentities(); err != nil {
+			t.Fatalf("backfillGoogleIdentities() error = %v", err)
+		}
+	}
+
+	var identities []table.UserIdentity
+	db.Find(&identities)
+	if len(identities) != 1 || identities[0].UserID != user.ID || identities[0].Subject != "g-1" {
+		t.Errorf("identities = %+v, want one google identity for the user", identities)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := New(db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	runs := 0
+	if err := RunOnce(db, "test", func(*gorm.DB) error { return errors.New("boom") }); err == nil {
+		t.Fatal("RunOnce() error = nil, want the migration error")
+	}
+	// A failed migration is not recorded and runs again.
+	for range 2 {
+		if err := RunOnce(db, "test", func(*gorm.DB) error { runs++; return nil }); err != nil {
+			t.Fatalf("RunOnce() error = %v", err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("migration ran %d times, want once", runs)
+	}
+}
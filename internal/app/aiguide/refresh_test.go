@@ -1,14 +1,19 @@
 package aiguide
 
 import (
+	"aiguide/internal/app/aiguide/migration"
+	"aiguide/internal/app/aiguide/table"
 	"aiguide/internal/pkg/auth"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestRefreshTokenEndpoint(t *testing.T) {
@@ -34,12 +39,25 @@ func TestRefreshTokenEndpoint(t *testing.T) {
 		t.Fatalf("Failed to generate token pair: %v", err)
 	}
 
+	// 创建测试数据库与用户
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := migration.New(db).Run(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := db.Create(&table.User{Model: table.Model{ID: internalUserID}}).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
 	// 创建 AIGuide 实例（仅用于测试）
 	secureCookieDefault := true
 	aiGuide := &AIGuide{
 		config: &Config{
 			SecureCookie: &secureCookieDefault,
 		},
+		db:          db,
 		authService: authService,
 	}
 
@@ -177,6 +195,22 @@ func TestRefreshTokenEndpoint(t *testing.T) {
 			t.Errorf("Expected status 400, got %d", w.Code)
 		}
 	})
+
+	// 测试场景 6: 用户已被禁用
+	t.Run("refresh for disabled user", func(t *testing.T) {
+		if err := db.Model(&table.User{}).Where("id = ?", internalUserID).Update("disabled_at", time.Now()).Error; err != nil {
+			t.Fatalf("failed to disable user: %v", err)
+		}
+		req, _ := http.NewRequest("POST", "/api/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: tokenPair.RefreshToken})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", w.Code)
+		}
+	})
 }
 
 func TestLogoutHandlerClearsBothCookies(t *testing.T) {
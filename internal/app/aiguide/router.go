@@ -2,10 +2,13 @@ package aiguide
 
 import (
 	"aiguide/internal/app/aiguide/setting"
+	"aiguide/internal/pkg/constant"
 	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/secret"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
 	"gorm.io/gorm"
 )
 
@@ -19,9 +22,16 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 	api.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
-	api.GET("/auth/login/google", a.GoogleLogin)
+	// 登录：provider 为 google、github 或配置的 OIDC 提供方名称
+	api.GET("/auth/providers", a.ListLoginProviders)
+	api.GET("/auth/login/:provider", a.Login)
 	api.GET("/auth/login/google/reauth", a.GoogleReauth)
-	api.GET("/auth/callback/google", a.GoogleCallback)
+	api.GET("/auth/callback/:provider", a.OAuthCallback)
+	// 本地账号（邮箱密码）登录、注册与密码重置，未启用 local_accounts 时返回 404
+	api.POST("/auth/local/login", a.LocalLogin)
+	api.POST("/auth/local/register", a.LocalRegister)
+	api.POST("/auth/local/password-reset", a.RequestPasswordReset)
+	api.POST("/auth/local/password-reset/confirm", a.ConfirmPasswordReset)
 	api.POST("/auth/logout", a.Logout)
 	api.POST("/auth/refresh", a.RefreshToken)
 	api.GET("/auth/avatar/:userId", a.GetAvatar)
@@ -29,7 +39,28 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 	// Public shared conversation endpoint (no authentication required)
 	api.GET("/share/:shareId", a.assistant.GetSharedConversation)
 
-	// 应用认证中间件到后续所有接口
+	// 入站 Webhook，使用触发器自身的密钥令牌认证
+	api.POST("/webhooks/:triggerId", a.assistant.ReceiveWebhook)
+
+	// 聊天机器人回调，Telegram 使用 Webhook 密钥令牌、Slack 使用请求签名认证
+	api.POST("/chat-bots/telegram/webhook", a.assistant.TelegramWebhook)
+	api.POST("/chat-bots/slack/events", a.assistant.SlackEvents)
+
+	// MCP 服务端点（Streamable HTTP），使用 JWT 或 API 令牌认证
+	mcpHandler := mcpauth.RequireBearerToken(middleware.MCPTokenVerifier(a.db, a.authService), nil)(a.assistant.MCPHandler())
+	api.Any("/mcp", gin.WrapH(mcpHandler))
+
+	// OpenAI 兼容接口，使用 API 令牌认证，便于接入 OpenAI SDK 等第三方客户端
+	openAI := engine.Group("/v1")
+	openAI.Use(middleware.APITokenAuth(a.db))
+	if a.rateLimitConfig != nil {
+		openAI.Use(middleware.RateLimiter(a.redisClient, a.rateLimitConfig))
+	}
+	openAI.Use(middleware.DenyReadOnlyWrites(), middleware.RequireScope(constant.APITokenScopeChat))
+	openAI.GET("/models", a.assistant.ListOpenAIModels)
+	openAI.POST("/chat/completions", a.assistant.CreateChatCompletion)
+
+	// 应用认证中间件到后续所有接口，接受 JWT 与 API 令牌
 	api.Use(middleware.Auth(a.db, a.authService))
 
 	// 需要认证的用户信息接口
@@ -38,25 +69,36 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 	if a.rateLimitConfig != nil {
 		api.Use(middleware.RateLimiter(a.redisClient, a.rateLimitConfig))
 	}
+	// 只读成员只能查看，不能发起对话或修改数据
+	api.Use(middleware.DenyReadOnlyWrites())
+	adminRole := middleware.RequireRole(constant.UserRoleAdmin)
+	writeRole := middleware.RequireRole(constant.UserRoleAdmin, constant.UserRoleMember)
 
-	// Agent 聊天路由
-	api.POST("/assistant/chats/:id", a.assistant.Chat)
+	// API 令牌按权限范围访问接口，未归入其他范围的接口需要 admin 权限
+	chatScope := middleware.RequireScope(constant.APITokenScopeChat)
+	adminScope := middleware.RequireScope(constant.APITokenScopeAdmin)
+
+	// Agent 聊天路由，agentId 为 assistant 或自定义 Agent 的 custom-<id>
+	api.POST("/:agentId/chats/:id", chatScope, a.assistant.Chat)
+	// 批准、修改或拒绝等待确认的工具调用，并以 SSE 恢复运行
+	api.POST("/:agentId/chats/:id/confirmations/:confirmationId", chatScope, a.assistant.ResolveToolConfirmation)
 
 	// Text-to-speech streaming endpoint
-	api.POST("/assistant/tts/stream", a.assistant.TextToSpeechStream)
+	api.POST("/assistant/tts/stream", chatScope, a.assistant.TextToSpeechStream)
 
 	// Real-time voice conversation via Gemini Live API (WebSocket)
-	api.GET("/assistant/live", a.assistant.VoiceCall)
+	// WebSocket 握手是 GET 请求，DenyReadOnlyWrites 不会拦截，需单独排除只读成员
+	api.GET("/assistant/live", chatScope, writeRole, a.assistant.VoiceCall)
 
 	// Share management routes (authenticated)
-	shareGroup := api.Group("/assistant/share")
+	shareGroup := api.Group("/assistant/share", chatScope)
 	{
 		shareGroup.POST("", a.assistant.CreateShare)
 		shareGroup.GET("", a.assistant.ListShares)
 		shareGroup.DELETE("/:shareId", a.assistant.DeleteShare)
 	}
 
-	memoryGroup := api.Group("/assistant/memories")
+	memoryGroup := api.Group("/assistant/memories", middleware.RequireScope(constant.APITokenScopeMemories))
 	{
 		memoryGroup.GET("", a.assistant.ListMemories)
 		memoryGroup.POST("", a.assistant.CreateMemory)
@@ -65,19 +107,76 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 		memoryGroup.DELETE("/:memoryId", a.assistant.DeleteMemory)
 	}
 
-	scheduledTaskGroup := api.Group("/assistant/scheduled-tasks")
+	customAgentGroup := api.Group("/assistant/custom-agents", chatScope)
+	{
+		customAgentGroup.GET("", a.assistant.ListCustomAgents)
+		customAgentGroup.POST("", a.assistant.CreateCustomAgent)
+		customAgentGroup.GET("/options", a.assistant.GetCustomAgentOptions)
+		customAgentGroup.GET("/:customAgentId", a.assistant.GetCustomAgent)
+		customAgentGroup.PATCH("/:customAgentId", a.assistant.UpdateCustomAgent)
+		customAgentGroup.DELETE("/:customAgentId", a.assistant.DeleteCustomAgent)
+	}
+
+	scheduledTaskGroup := api.Group("/assistant/scheduled-tasks", middleware.RequireScope(constant.APITokenScopeScheduledTasks))
 	{
 		scheduledTaskGroup.GET("", a.assistant.ListScheduledTasks)
+		scheduledTaskGroup.GET("/:taskId/runs", a.assistant.ListScheduledTaskRuns)
+		scheduledTaskGroup.POST("/:taskId/run", a.assistant.RunScheduledTask)
+		scheduledTaskGroup.GET("/:taskId/deliveries", a.assistant.ListScheduledTaskDeliveries)
+		scheduledTaskGroup.POST("/:taskId/deliveries", a.assistant.CreateScheduledTaskDelivery)
+		scheduledTaskGroup.DELETE("/:taskId/deliveries/:deliveryId", a.assistant.DeleteScheduledTaskDelivery)
 		scheduledTaskGroup.PATCH("/:taskId", a.assistant.UpdateScheduledTask)
 		scheduledTaskGroup.DELETE("/:taskId", a.assistant.DeleteScheduledTask)
 	}
 
-	fileGroup := api.Group("/assistant/files")
+	triggerGroup := api.Group("/assistant/triggers", middleware.RequireScope(constant.APITokenScopeScheduledTasks))
+	{
+		triggerGroup.GET("", a.assistant.ListEventTriggers)
+		triggerGroup.POST("", a.assistant.CreateEventTrigger)
+		triggerGroup.GET("/:triggerId/runs", a.assistant.ListEventTriggerRuns)
+		triggerGroup.POST("/:triggerId/token", a.assistant.RotateWebhookToken)
+		triggerGroup.PATCH("/:triggerId", a.assistant.UpdateEventTrigger)
+		triggerGroup.DELETE("/:triggerId", a.assistant.DeleteEventTrigger)
+	}
+
+	// 站内通知：列表、标记已读与 SSE 实时推送
+	notificationGroup := api.Group("/assistant/notifications", adminScope)
+	{
+		notificationGroup.GET("", a.assistant.ListNotifications)
+		notificationGroup.GET("/stream", a.assistant.StreamNotifications)
+		notificationGroup.POST("/read", a.assistant.MarkAllNotificationsRead)
+		notificationGroup.POST("/:notificationId/read", a.assistant.MarkNotificationRead)
+		// 浏览器推送：VAPID 公钥、设备订阅与按类型的推送偏好
+		notificationGroup.GET("/push", a.assistant.GetWebPushStatus)
+		notificationGroup.POST("/push/subscriptions", a.assistant.CreateWebPushSubscription)
+		notificationGroup.DELETE("/push/subscriptions/:subscriptionId", a.assistant.DeleteWebPushSubscription)
+		notificationGroup.GET("/preferences", a.assistant.ListNotificationPreferences)
+		notificationGroup.PUT("/preferences", a.assistant.UpdateNotificationPreferences)
+	}
+
+	// 聊天机器人：生成配对码、查看与解除已关联的聊天账号
+	chatBotGroup := api.Group("/assistant/chat-bots", adminScope)
+	{
+		chatBotGroup.GET("", a.assistant.GetChatBotStatus)
+		chatBotGroup.POST("/pairing-codes", a.assistant.CreateChatBotPairingCode)
+		chatBotGroup.DELETE("/links/:linkId", a.assistant.DeleteChatBotLink)
+	}
+
+	sessionTaskGroup := api.Group("/assistant/sessions/:sessionId/tasks", chatScope)
+	{
+		sessionTaskGroup.GET("", a.assistant.ListSessionTasks)
+		sessionTaskGroup.POST("", a.assistant.CreateSessionTask)
+		sessionTaskGroup.PUT("/order", a.assistant.ReorderSessionTasks)
+		sessionTaskGroup.GET("/:taskId", a.assistant.GetSessionTask)
+		sessionTaskGroup.PATCH("/:taskId", a.assistant.UpdateSessionTask)
+	}
+
+	fileGroup := api.Group("/assistant/files", middleware.RequireScope(constant.APITokenScopeFiles))
 	{
 		fileGroup.GET("/:fileId/download", a.assistant.DownloadFile)
 	}
 
-	projectGroup := api.Group("/assistant/projects")
+	projectGroup := api.Group("/assistant/projects", chatScope)
 	{
 		projectGroup.GET("", a.assistant.ListProjects)
 		projectGroup.POST("", a.assistant.CreateProject)
@@ -86,7 +185,7 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 	}
 
 	// 会话管理路由
-	agentGroup := api.Group("/:agentId/sessions")
+	agentGroup := api.Group("/:agentId/sessions", chatScope)
 	{
 		agentGroup.GET("", a.assistant.ListSessions)
 		agentGroup.POST("", a.assistant.CreateSession)
@@ -96,9 +195,43 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 		agentGroup.DELETE("/:sessionId", a.assistant.DeleteSession)
 	}
 
-	registerSettingRoutes(a.db, api)
+	registerSettingRoutes(a.db, a.cipher, api.Group("", adminScope))
 
-	calendarGroup := api.Group("/calendar")
+	// 已关联的登录身份：一个用户可以使用多个提供方登录
+	identityGroup := api.Group("/auth/identities", adminScope)
+	{
+		identityGroup.GET("", a.ListIdentities)
+		identityGroup.POST("/:provider", a.LinkIdentity)
+		identityGroup.DELETE("/:id", a.DeleteIdentity)
+	}
+
+	// 本地账号管理：设置密码；为他人创建账户与邀请码仅限管理员
+	localGroup := api.Group("/auth/local", adminScope)
+	{
+		localGroup.PUT("/password", a.ChangePassword)
+		localGroup.POST("/accounts", adminRole, a.CreateLocalAccount)
+	}
+	inviteGroup := api.Group("/auth/invites", adminScope, adminRole)
+	{
+		inviteGroup.GET("", a.ListInvites)
+		inviteGroup.POST("", a.CreateInvite)
+		inviteGroup.DELETE("/:id", a.DeleteInvite)
+	}
+
+	// 用户管理：角色、禁用、删除、用量与允许登录的邮箱，仅限管理员
+	adminGroup := api.Group("/admin", adminScope, adminRole)
+	{
+		adminGroup.GET("/users", a.ListUsers)
+		adminGroup.PATCH("/users/:id", a.UpdateUser)
+		adminGroup.DELETE("/users/:id", a.DeleteUser)
+		adminGroup.GET("/users/:id/usage", a.GetUserUsage)
+		adminGroup.POST("/users/:id/quota/reset", a.ResetUserQuota)
+		adminGroup.GET("/allowed-emails", a.ListAllowedEmails)
+		adminGroup.POST("/allowed-emails", a.AddAllowedEmail)
+		adminGroup.DELETE("/allowed-emails/:id", a.DeleteAllowedEmail)
+	}
+
+	calendarGroup := api.Group("/calendar", adminScope)
 	{
 		calendarGroup.GET("/status", a.GetCalendarStatus)
 		calendarGroup.DELETE("/status", a.RevokeCalendarAccess)
@@ -107,8 +240,8 @@ func (a *AIGuide) initRouter(engine *gin.Engine) error {
 	return nil
 }
 
-func registerSettingRoutes(db *gorm.DB, api *gin.RouterGroup) {
-	s := setting.New(db)
+func registerSettingRoutes(db *gorm.DB, cipher *secret.Cipher, api *gin.RouterGroup) {
+	s := setting.New(db, cipher)
 	emailServerConfig := api.Group("/email_server_configs")
 	{
 		emailServerConfig.POST("", s.CreateEmailServerConfig)
@@ -126,4 +259,39 @@ func registerSettingRoutes(db *gorm.DB, api *gin.RouterGroup) {
 		sshServerConfig.PUT("/:id", s.UpdateSSHServerConfig)
 		sshServerConfig.DELETE("/:id", s.DeleteSSHServerConfig)
 	}
+
+	toolConfirmationSettings := api.Group("/tool_confirmation_settings")
+	{
+		toolConfirmationSettings.GET("", s.ListToolConfirmationSettings)
+		toolConfirmationSettings.PUT("", s.UpdateToolConfirmationSettings)
+	}
+
+	apiTokens := api.Group("/api_tokens")
+	{
+		apiTokens.POST("", s.CreateAPIToken)
+		apiTokens.GET("", s.ListAPITokens)
+		apiTokens.GET("/:id", s.GetAPIToken)
+		apiTokens.PUT("/:id", s.UpdateAPIToken)
+		apiTokens.POST("/:id/revoke", s.RevokeAPIToken)
+		apiTokens.DELETE("/:id", s.DeleteAPIToken)
+	}
+
+	mcpServerConfig := api.Group("/mcp_server_configs")
+	{
+		mcpServerConfig.POST("", s.CreateMCPServerConfig)
+		mcpServerConfig.GET("", s.ListMCPServerConfigs)
+		mcpServerConfig.GET("/:id", s.GetMCPServerConfig)
+		mcpServerConfig.PUT("/:id", s.UpdateMCPServerConfig)
+		mcpServerConfig.DELETE("/:id", s.DeleteMCPServerConfig)
+	}
+
+	openAPIToolConfig := api.Group("/openapi_tool_configs")
+	{
+		openAPIToolConfig.POST("", s.CreateOpenAPIToolConfig)
+		openAPIToolConfig.POST("/preview", s.PreviewOpenAPISpec)
+		openAPIToolConfig.GET("", s.ListOpenAPIToolConfigs)
+		openAPIToolConfig.GET("/:id", s.GetOpenAPIToolConfig)
+		openAPIToolConfig.PUT("/:id", s.UpdateOpenAPIToolConfig)
+		openAPIToolConfig.DELETE("/:id", s.DeleteOpenAPIToolConfig)
+	}
 }
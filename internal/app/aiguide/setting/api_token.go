@@ -0,0 +1,296 @@
+package setting
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiTokenDisplayPrefixLen is how many leading characters of a token are kept
+// so users can tell their tokens apart.
+const apiTokenDisplayPrefixLen = 12
+
+// APITokenRequest is the request body for creating or updating an API token.
+// A nil ExpiresAt never expires.
+type APITokenRequest struct {
+	Name      string                   `json:"name" binding:"required"`
+	Scopes    []constant.APITokenScope `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time               `json:"expires_at"`
+}
+
+// APITokenResponse is the response body for API token endpoints. Token is
+// only set in the create response; it cannot be retrieved later.
+type APITokenResponse struct {
+	ID         int                      `json:"id"`
+	Name       string                   `json:"name"`
+	Prefix     string                   `json:"prefix"`
+	Token      string                   `json:"token,omitempty"`
+	Scopes     []constant.APITokenScope `json:"scopes"`
+	ExpiresAt  *time.Time               `json:"expires_at"`
+	LastUsedAt *time.Time               `json:"last_used_at"`
+	RevokedAt  *time.Time               `json:"revoked_at"`
+	CreatedAt  time.Time                `json:"created_at"`
+}
+
+func toAPITokenResponse(t table.APIToken) APITokenResponse {
+	return APITokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     auth.ParseAPITokenScopes(t.Scopes),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+// validateAPITokenRequest checks the scopes and expiry of req and returns the
+// scopes encoded for storage.
+func validateAPITokenRequest(req APITokenRequest) (string, error) {
+	if len(req.Scopes) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+	seen := make(map[constant.APITokenScope]bool, len(req.Scopes))
+	scopes := make([]constant.APITokenScope, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !scope.Valid() {
+			return "", errors.New("invalid scope: " + scope.String())
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return "", errors.New("expires_at must be in the future")
+	}
+	data, err := json.Marshal(scopes)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// findAPIToken loads the authenticated user's token of the id route
+// parameter, writing the error response when it fails.
+func (s *Setting) findAPIToken(c *gin.Context, userID int) (table.APIToken, bool) {
+	var token table.APIToken
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse api token id", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return token, false
+	}
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return token, false
+		}
+		slog.Error("failed to find api token", "id", id, "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load token"})
+		return token, false
+	}
+	return token, true
+}
+
+// CreateAPIToken creates a new API token for the authenticated user.
+func (s *Setting) CreateAPIToken(c *gin.Context) {
+	var req APITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind create api token request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in CreateAPIToken")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	scopes, err := validateAPITokenRequest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		return
+	}
+
+	apiToken := table.APIToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: hash,
+		Prefix:    token[:apiTokenDisplayPrefixLen],
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.db.Create(&apiToken).Error; err != nil {
+		slog.Error("failed to create api token", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token: " + err.Error()})
+		return
+	}
+
+	response := toAPITokenResponse(apiToken)
+	response.Token = token
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListAPITokens returns the authenticated user's API tokens without their secrets.
+func (s *Setting) ListAPITokens(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in ListAPITokens")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var tokens []table.APIToken
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		slog.Error("failed to query api tokens", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tokens: " + err.Error()})
+		return
+	}
+
+	response := make([]APITokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		response = append(response, toAPITokenResponse(t))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": response})
+}
+
+// GetAPIToken returns a single API token of the authenticated user.
+func (s *Setting) GetAPIToken(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in GetAPIToken")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	token, ok := s.findAPIToken(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, toAPITokenResponse(token))
+}
+
+// UpdateAPIToken renames an API token and replaces its scopes and expiry.
+// Revoked tokens cannot be changed.
+func (s *Setting) UpdateAPIToken(c *gin.Context) {
+	var req APITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind update api token request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in UpdateAPIToken")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	scopes, err := validateAPITokenRequest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, ok := s.findAPIToken(c, userID)
+	if !ok {
+		return
+	}
+	if token.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "token is revoked"})
+		return
+	}
+
+	token.Name = req.Name
+	token.Scopes = scopes
+	token.ExpiresAt = req.ExpiresAt
+	if err := s.db.Save(&token).Error; err != nil {
+		slog.Error("failed to save api token", "id", token.ID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update token: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAPITokenResponse(token))
+}
+
+// RevokeAPIToken revokes an API token. Unlike deleting it, the token stays
+// listed with its last use.
+func (s *Setting) RevokeAPIToken(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in RevokeAPIToken")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	token, ok := s.findAPIToken(c, userID)
+	if !ok {
+		return
+	}
+	if token.RevokedAt == nil {
+		now := time.Now()
+		if err := s.db.Model(&token).Update("revoked_at", now).Error; err != nil {
+			slog.Error("failed to revoke api token", "id", token.ID, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token: " + err.Error()})
+			return
+		}
+		token.RevokedAt = &now
+	}
+
+	c.JSON(http.StatusOK, toAPITokenResponse(token))
+}
+
+// DeleteAPIToken deletes an API token by ID, which also revokes it.
+func (s *Setting) DeleteAPIToken(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in DeleteAPIToken")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse api token id for deletion", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&table.APIToken{})
+	if result.Error != nil {
+		slog.Error("failed to delete api token", "id", id, "user_id", userID, "err", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete token: " + result.Error.Error()})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		slog.Error("API token not found for deletion", "id", id, "user_id", userID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successfully"})
+}
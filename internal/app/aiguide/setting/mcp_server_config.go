@@ -0,0 +1,253 @@
+package setting
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MCPServerConfigRequest is the request body for creating/updating an MCP server config.
+type MCPServerConfigRequest struct {
+	Name    string            `json:"name"    binding:"required"`
+	URL     string            `json:"url"     binding:"required"`
+	Headers map[string]string `json:"headers"`
+	Enabled *bool             `json:"enabled"` // defaults to true
+}
+
+// MCPServerConfigResponse is the response body for MCP server config endpoints.
+// Header values may contain credentials, so only the header names are listed.
+type MCPServerConfigResponse struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	HeaderNames []string  `json:"header_names"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s *Setting) toMCPResponse(cfg table.MCPServerConfig) MCPServerConfigResponse {
+	headers, err := tools.ParseMCPHeaders(cfg.Headers, s.cipher)
+	if err != nil {
+		slog.Warn("failed to parse stored mcp headers", "config_id", cfg.ID, "err", err)
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return MCPServerConfigResponse{
+		ID:          cfg.ID,
+		Name:        cfg.Name,
+		URL:         cfg.URL,
+		HeaderNames: names,
+		Enabled:     cfg.Enabled,
+		CreatedAt:   cfg.CreatedAt,
+		UpdatedAt:   cfg.UpdatedAt,
+	}
+}
+
+// validateMCPServerURL only accepts absolute http(s) URLs.
+func validateMCPServerURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// CreateMCPServerConfig creates a new MCP server config for the authenticated user.
+func (s *Setting) CreateMCPServerConfig(c *gin.Context) {
+	var req MCPServerConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind create mcp config request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in CreateMCPServerConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	if !validateMCPServerURL(req.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+
+	headers, err := tools.EncryptMCPHeaders(req.Headers, s.cipher)
+	if err != nil {
+		slog.Error("failed to encrypt mcp headers", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save headers"})
+		return
+	}
+
+	cfg := table.MCPServerConfig{
+		UserID:  userID,
+		Name:    req.Name,
+		URL:     req.URL,
+		Headers: headers,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+
+	if err := s.db.Create(&cfg).Error; err != nil {
+		slog.Error("failed to create mcp server config", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s.toMCPResponse(cfg))
+}
+
+// ListMCPServerConfigs returns all MCP server configs for the authenticated user.
+func (s *Setting) ListMCPServerConfigs(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in ListMCPServerConfigs")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var configs []table.MCPServerConfig
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&configs).Error; err != nil {
+		slog.Error("failed to query mcp server configs", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list configs: " + err.Error()})
+		return
+	}
+
+	response := make([]MCPServerConfigResponse, 0, len(configs))
+	for _, cfg := range configs {
+		response = append(response, s.toMCPResponse(cfg))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"configs": response})
+}
+
+// GetMCPServerConfig returns a single MCP server config by ID.
+func (s *Setting) GetMCPServerConfig(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in GetMCPServerConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse mcp config id", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var cfg table.MCPServerConfig
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&cfg).Error; err != nil {
+		slog.Error("failed to find mcp server config", "config_id", id, "user_id", userID, "err", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "config not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.toMCPResponse(cfg))
+}
+
+// UpdateMCPServerConfig updates an existing MCP server config. Headers are
+// only replaced when the request includes them.
+func (s *Setting) UpdateMCPServerConfig(c *gin.Context) {
+	var req MCPServerConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind update mcp config request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in UpdateMCPServerConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse mcp config id for update", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if !validateMCPServerURL(req.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+
+	var cfg table.MCPServerConfig
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&cfg).Error; err != nil {
+		slog.Error("failed to find mcp config for update", "config_id", id, "user_id", userID, "err", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "config not found"})
+		return
+	}
+
+	cfg.Name = req.Name
+	cfg.URL = req.URL
+	if req.Headers != nil {
+		headers, err := tools.EncryptMCPHeaders(req.Headers, s.cipher)
+		if err != nil {
+			slog.Error("failed to encrypt mcp headers", "config_id", cfg.ID, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save headers"})
+			return
+		}
+		cfg.Headers = headers
+	}
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+
+	if err := s.db.Save(&cfg).Error; err != nil {
+		slog.Error("failed to save mcp server config", "config_id", cfg.ID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.toMCPResponse(cfg))
+}
+
+// DeleteMCPServerConfig deletes an MCP server config by ID.
+func (s *Setting) DeleteMCPServerConfig(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in DeleteMCPServerConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse mcp config id for deletion", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&table.MCPServerConfig{})
+	if result.Error != nil {
+		slog.Error("failed to delete mcp server config", "id", id, "user_id", userID, "err", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete config: " + result.Error.Error()})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		slog.Error("MCP server config not found for deletion", "id", id, "user_id", userID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "config not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successfully"})
+}
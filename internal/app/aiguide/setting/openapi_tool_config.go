@@ -0,0 +1,301 @@
+package setting
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIToolConfigRequest is the request body for creating/updating an OpenAPI tool config.
+type OpenAPIToolConfigRequest struct {
+	Name         string   `json:"name"          binding:"required"`
+	Spec         string   `json:"spec"          binding:"required"`
+	BaseURL      string   `json:"base_url"`
+	AuthType     string   `json:"auth_type"`
+	AuthHeader   string   `json:"auth_header"`
+	AuthUsername string   `json:"auth_username"`
+	AuthSecret   string   `json:"auth_secret"` // kept unchanged on update when empty
+	Operations   []string `json:"operations"`  // empty selects all operations
+	Enabled      *bool    `json:"enabled"`     // defaults to true
+}
+
+// OpenAPISpecPreviewRequest is the request body for previewing a document's operations.
+type OpenAPISpecPreviewRequest struct {
+	Spec string `json:"spec" binding:"required"`
+}
+
+// OpenAPIToolConfigResponse is the response body for OpenAPI tool config endpoints.
+// The auth secret is never returned; the spec is only returned by the
+// single-item GET endpoint so the edit form can pre-populate it.
+type OpenAPIToolConfigResponse struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Spec          string    `json:"spec,omitempty"`
+	BaseURL       string    `json:"base_url"`
+	AuthType      string    `json:"auth_type"`
+	AuthHeader    string    `json:"auth_header"`
+	AuthUsername  string    `json:"auth_username"`
+	HasAuthSecret bool      `json:"has_auth_secret"`
+	Operations    []string  `json:"operations"`
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func toOpenAPIResponse(cfg table.OpenAPIToolConfig, withSpec bool) OpenAPIToolConfigResponse {
+	ops, err := tools.ParseOpenAPIOperations(cfg.Operations)
+	if err != nil {
+		slog.Warn("failed to parse stored openapi operations", "config_id", cfg.ID, "err", err)
+	}
+	if ops == nil {
+		ops = []string{}
+	}
+	response := OpenAPIToolConfigResponse{
+		ID:            cfg.ID,
+		Name:          cfg.Name,
+		BaseURL:       cfg.BaseURL,
+		AuthType:      cfg.AuthType,
+		AuthHeader:    cfg.AuthHeader,
+		AuthUsername:  cfg.AuthUsername,
+		HasAuthSecret: cfg.AuthSecret != "",
+		Operations:    ops,
+		Enabled:       cfg.Enabled,
+		CreatedAt:     cfg.CreatedAt,
+		UpdatedAt:     cfg.UpdatedAt,
+	}
+	if withSpec {
+		response.Spec = cfg.Spec
+	}
+	return response
+}
+
+// applyOpenAPIRequest copies req onto cfg, encrypting a new auth secret, and
+// checks that the resulting config builds tools.
+func (s *Setting) applyOpenAPIRequest(cfg *table.OpenAPIToolConfig, req OpenAPIToolConfigRequest) error {
+	authType := req.AuthType
+	if authType == "" {
+		authType = tools.OpenAPIAuthNone
+	}
+	cfg.Operations = ""
+	if len(req.Operations) > 0 {
+		operations, err := json.Marshal(req.Operations)
+		if err != nil {
+			return err
+		}
+		cfg.Operations = string(operations)
+	}
+
+	cfg.Name = req.Name
+	cfg.Spec = req.Spec
+	cfg.BaseURL = req.BaseURL
+	cfg.AuthType = authType
+	cfg.AuthHeader = req.AuthHeader
+	cfg.AuthUsername = req.AuthUsername
+	if req.AuthSecret != "" {
+		encrypted, err := s.cipher.Encrypt(req.AuthSecret)
+		if err != nil {
+			return err
+		}
+		cfg.AuthSecret = encrypted
+	}
+	if authType == tools.OpenAPIAuthNone {
+		cfg.AuthSecret = ""
+	}
+
+	toolCfg, err := tools.OpenAPIConfigFromTable(*cfg, s.cipher)
+	if err != nil {
+		return err
+	}
+	_, err = tools.NewOpenAPITools(toolCfg, tools.UserOpenAPIToolPrefix, nil)
+	return err
+}
+
+// PreviewOpenAPISpec parses a document and lists its operations so the user
+// can pick which ones to expose.
+func (s *Setting) PreviewOpenAPISpec(c *gin.Context) {
+	var req OpenAPISpecPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind openapi preview request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	spec, err := tools.ParseOpenAPISpec([]byte(req.Spec))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, spec)
+}
+
+// CreateOpenAPIToolConfig registers a new OpenAPI document for the authenticated user.
+func (s *Setting) CreateOpenAPIToolConfig(c *gin.Context) {
+	var req OpenAPIToolConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind create openapi config request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in CreateOpenAPIToolConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	cfg := table.OpenAPIToolConfig{
+		UserID:  userID,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if err := s.applyOpenAPIRequest(&cfg, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid config: " + err.Error()})
+		return
+	}
+
+	if err := s.db.Create(&cfg).Error; err != nil {
+		slog.Error("failed to create openapi tool config", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toOpenAPIResponse(cfg, true))
+}
+
+// ListOpenAPIToolConfigs returns all OpenAPI tool configs for the authenticated user.
+func (s *Setting) ListOpenAPIToolConfigs(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in ListOpenAPIToolConfigs")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var configs []table.OpenAPIToolConfig
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&configs).Error; err != nil {
+		slog.Error("failed to query openapi tool configs", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list configs: " + err.Error()})
+		return
+	}
+
+	response := make([]OpenAPIToolConfigResponse, 0, len(configs))
+	for _, cfg := range configs {
+		response = append(response, toOpenAPIResponse(cfg, false))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"configs": response})
+}
+
+// GetOpenAPIToolConfig returns a single OpenAPI tool config by ID, including its document.
+func (s *Setting) GetOpenAPIToolConfig(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in GetOpenAPIToolConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse openapi config id", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var cfg table.OpenAPIToolConfig
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&cfg).Error; err != nil {
+		slog.Error("failed to find openapi tool config", "config_id", id, "user_id", userID, "err", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "config not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toOpenAPIResponse(cfg, true))
+}
+
+// UpdateOpenAPIToolConfig updates an existing OpenAPI tool config.
+func (s *Setting) UpdateOpenAPIToolConfig(c *gin.Context) {
+	var req OpenAPIToolConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind update openapi config request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in UpdateOpenAPIToolConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse openapi config id for update", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var cfg table.OpenAPIToolConfig
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&cfg).Error; err != nil {
+		slog.Error("failed to find openapi config for update", "config_id", id, "user_id", userID, "err", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "config not found"})
+		return
+	}
+
+	if err := s.applyOpenAPIRequest(&cfg, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid config: " + err.Error()})
+		return
+	}
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+
+	if err := s.db.Save(&cfg).Error; err != nil {
+		slog.Error("failed to save openapi tool config", "config_id", cfg.ID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update config: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toOpenAPIResponse(cfg, true))
+}
+
+// DeleteOpenAPIToolConfig deletes an OpenAPI tool config by ID.
+func (s *Setting) DeleteOpenAPIToolConfig(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in DeleteOpenAPIToolConfig")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		slog.Error("failed to parse openapi config id for deletion", "id", c.Param("id"), "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&table.OpenAPIToolConfig{})
+	if result.Error != nil {
+		slog.Error("failed to delete openapi tool config", "id", id, "user_id", userID, "err", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete config: " + result.Error.Error()})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		slog.Error("OpenAPI tool config not found for deletion", "id", id, "user_id", userID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "config not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successfully"})
+}
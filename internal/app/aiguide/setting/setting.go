@@ -1,14 +1,20 @@
 package setting
 
-import "gorm.io/gorm"
+import (
+	"aiguide/internal/pkg/secret"
+
+	"gorm.io/gorm"
+)
 
 type Setting struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *secret.Cipher
 }
 
-func New(db *gorm.DB) *Setting {
+func New(db *gorm.DB, cipher *secret.Cipher) *Setting {
 	s := &Setting{
-		db: db,
+		db:     db,
+		cipher: cipher,
 	}
 
 	return s
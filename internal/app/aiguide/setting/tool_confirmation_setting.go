@@ -0,0 +1,118 @@
+package setting
+
+import (
+	"log/slog"
+	"net/http"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/tools"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ToolConfirmationSettingItem describes whether one tool requires confirmation.
+type ToolConfirmationSettingItem struct {
+	ToolName string `json:"tool_name" binding:"required"`
+	Required bool   `json:"required"`
+}
+
+// ToolConfirmationSettingsRequest is the request body for updating tool confirmation settings.
+type ToolConfirmationSettingsRequest struct {
+	Settings []ToolConfirmationSettingItem `json:"settings" binding:"required,dive"`
+}
+
+// loadToolConfirmationSettings returns one item per confirmable tool, filling
+// in the default (required) for tools the user has not configured.
+func (s *Setting) loadToolConfirmationSettings(userID int) ([]ToolConfirmationSettingItem, error) {
+	var rows []table.ToolConfirmationSetting
+	if err := s.db.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		stored[row.ToolName] = row.Required
+	}
+
+	items := make([]ToolConfirmationSettingItem, 0, len(tools.ConfirmableToolNames))
+	for _, name := range tools.ConfirmableToolNames {
+		required, ok := stored[name]
+		if !ok {
+			required = true
+		}
+		items = append(items, ToolConfirmationSettingItem{ToolName: name, Required: required})
+	}
+	return items, nil
+}
+
+// ListToolConfirmationSettings returns which tools require confirmation for the authenticated user.
+func (s *Setting) ListToolConfirmationSettings(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in ListToolConfirmationSettings")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	items, err := s.loadToolConfirmationSettings(userID)
+	if err != nil {
+		slog.Error("failed to query tool confirmation settings", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list settings: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": items})
+}
+
+// UpdateToolConfirmationSettings sets which tools require confirmation for the authenticated user.
+// Tools not present in the request keep their current setting.
+func (s *Setting) UpdateToolConfirmationSettings(c *gin.Context) {
+	var req ToolConfirmationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Error("failed to bind tool confirmation settings request", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		slog.Error("user not authenticated in UpdateToolConfirmationSettings")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	rows := make([]table.ToolConfirmationSetting, 0, len(req.Settings))
+	for _, item := range req.Settings {
+		if !tools.IsConfirmableTool(item.ToolName) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported tool: " + item.ToolName})
+			return
+		}
+		rows = append(rows, table.ToolConfirmationSetting{
+			UserID:   userID,
+			ToolName: item.ToolName,
+			Required: item.Required,
+		})
+	}
+
+	if len(rows) > 0 {
+		if err := s.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "tool_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"required", "updated_at"}),
+		}).Create(&rows).Error; err != nil {
+			slog.Error("failed to save tool confirmation settings", "user_id", userID, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update settings: " + err.Error()})
+			return
+		}
+	}
+
+	items, err := s.loadToolConfirmationSettings(userID)
+	if err != nil {
+		slog.Error("failed to query tool confirmation settings", "user_id", userID, "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list settings: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"settings": items})
+}
@@ -17,19 +17,83 @@ type Model struct {
 type User struct {
 	Model
 
-	GoogleUserID            string `gorm:"column:google_user_id"`
-	GoogleEmail             string `gorm:"column:google_email"`
-	GoogleName              string `gorm:"column:google_name"`
-	Picture                 string `gorm:"column:picture"`                    // Original URL from Google
-	AvatarData              []byte `gorm:"column:avatar_data"`                // Stored avatar image bytes (up to 5MB). NOTE: Storing images in the database increases backup sizes and can impact performance. For large deployments, consider using external storage (e.g., filesystem, S3) and storing only the path here.
-	AvatarMimeType          string `gorm:"column:avatar_mime_type"`           // MIME type of the stored avatar (e.g., "image/jpeg", "image/png")
-	GoogleOAuthRefreshToken string `gorm:"column:google_oauth_refresh_token"` // Google OAuth refresh token for Calendar API access (plain text; encrypt in production)
+	GoogleUserID            string            `gorm:"column:google_user_id"`                                  // Empty for users who never signed in with Google
+	GoogleEmail             string            `gorm:"column:google_email"`                                    // Account email; for users created by another provider, the email from their first login
+	GoogleName              string            `gorm:"column:google_name"`                                     // Display name, sourced like GoogleEmail
+	Picture                 string            `gorm:"column:picture"`                                         // Original avatar URL from the login provider
+	AvatarData              []byte            `gorm:"column:avatar_data"`                                     // Stored avatar image bytes (up to 5MB). NOTE: Storing images in the database increases backup sizes and can impact performance. For large deployments, consider using external storage (e.g., filesystem, S3) and storing only the path here.
+	AvatarMimeType          string            `gorm:"column:avatar_mime_type"`                                // MIME type of the stored avatar (e.g., "image/jpeg", "image/png")
+	GoogleOAuthRefreshToken string            `gorm:"column:google_oauth_refresh_token"`                      // Google OAuth refresh token for Calendar API access (plain text; encrypt in production)
+	Role                    constant.UserRole `gorm:"column:role;type:varchar(16);not null;default:'member'"` // admin, member or read_only; the first user becomes admin
+	DisabledAt              *time.Time        `gorm:"column:disabled_at"`                                     // Disabled users can't sign in and their tokens are rejected
+	LastLoginAt             *time.Time        `gorm:"column:last_login_at"`
+}
+
+// AllowedEmail restricts sign-in to the listed emails, managed by admins at
+// runtime. When the table is empty, anyone can sign in; once an email is
+// listed, the last one can't be removed.
+type AllowedEmail struct {
+	Model
+
+	Email     string `gorm:"column:email;type:varchar(255);not null;uniqueIndex"` // Lowercased
+	CreatedBy int    `gorm:"column:created_by;not null;default:0"`                // Admin who added it; 0 when imported from the config file
+}
+
+// UserIdentity links an account at a login provider (Google, GitHub or an
+// OIDC provider) to a user, so one user can sign in with several providers.
+type UserIdentity struct {
+	Model
+
+	UserID   int    `gorm:"column:user_id;not null;index"`
+	Provider string `gorm:"column:provider;type:varchar(64);not null;uniqueIndex:idx_user_identity_subject"` // google, github or the configured OIDC provider name
+	Subject  string `gorm:"column:subject;type:varchar(255);not null;uniqueIndex:idx_user_identity_subject"` // Stable user id at the provider (OIDC sub)
+	Email    string `gorm:"column:email;type:varchar(255);not null;default:''"`                              // Email reported at the last login, shown in the identity list
+	Name     string `gorm:"column:name;type:varchar(255);not null;default:''"`
+}
+
+// LocalCredential holds the password of a local account, for deployments
+// without access to an OAuth provider. The user also has a "local"
+// UserIdentity whose subject is the login email.
+type LocalCredential struct {
+	Model
+
+	UserID         int        `gorm:"column:user_id;not null;uniqueIndex"`
+	Email          string     `gorm:"column:email;type:varchar(255);not null;uniqueIndex"`        // Lowercased login email
+	PasswordHash   string     `gorm:"column:password_hash;type:varchar(255);not null;default:''"` // argon2id PHC string (bcrypt accepted for imported accounts); empty until the password is set
+	FailedAttempts int        `gorm:"column:failed_attempts;not null;default:0"`                  // Consecutive failed logins, reset on success
+	LockedUntil    *time.Time `gorm:"column:locked_until"`                                        // Login is refused until then after too many failures
+}
+
+// InviteCode allows registering a local account. Only the SHA-256 hash of
+// the code is stored; each code can be used once.
+type InviteCode struct {
+	Model
+
+	CreatedBy int        `gorm:"column:created_by;not null;index"`
+	CodeHash  string     `gorm:"column:code_hash;type:varchar(64);not null;uniqueIndex"`
+	Prefix    string     `gorm:"column:prefix;type:varchar(16);not null;default:''"` // First group of the code, shown to identify it
+	Email     string     `gorm:"column:email;type:varchar(255);not null;default:''"` // When set, only this email can register with the code
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	UsedBy    int        `gorm:"column:used_by;not null;default:0"` // User registered with the code
+}
+
+// PasswordResetToken is a one-time link to set the password of a local
+// account, sent by email or handed out when an account is created for someone.
+type PasswordResetToken struct {
+	Model
+
+	UserID    int        `gorm:"column:user_id;not null;index"`
+	TokenHash string     `gorm:"column:token_hash;type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
 }
 
 type SessionMeta struct {
 	Model
 
 	SessionID           string `gorm:"column:session_id;uniqueIndex"`
+	UserID              int    `gorm:"column:user_id;not null;default:0;index"` // 会话所属用户，0 表示历史数据尚未归属
 	Title               string `gorm:"column:title"`
 	ThreadID            string `gorm:"column:thread_id;index"`
 	ProjectID           int    `gorm:"column:project_id;not null;default:0;index"`
@@ -83,6 +147,80 @@ type SSHServerConfig struct {
 	IsDefault  bool          `gorm:"column:is_default;default:false"`                  // Whether this is the user's default SSH server
 }
 
+// MCPServerConfig is a user-declared MCP server reachable over streamable HTTP.
+// Only HTTP servers can be added per user; stdio servers spawn local processes
+// and are limited to the YAML config.
+type MCPServerConfig struct {
+	Model
+
+	UserID  int    `gorm:"column:user_id;not null;uniqueIndex:idx_mcp_server_user_name"` // Associated user ID
+	Name    string `gorm:"column:name;not null;uniqueIndex:idx_mcp_server_user_name"`    // Display name, also used in tool names
+	URL     string `gorm:"column:url;not null"`                                          // Streamable HTTP endpoint
+	Headers string `gorm:"column:headers;type:text;not null;default:''"`                 // Encrypted JSON object of extra HTTP headers, e.g. Authorization; see tools.EncryptMCPHeaders
+	Enabled bool   `gorm:"column:enabled;not null"`                                      // Whether the server's tools are offered to the assistant
+}
+
+// OpenAPIToolConfig is a REST API registered from an OpenAPI 3 document whose
+// operations are offered to the user's assistant as tools. APIs shared by all
+// users are declared in the YAML config instead.
+type OpenAPIToolConfig struct {
+	Model
+
+	UserID       int    `gorm:"column:user_id;not null;uniqueIndex:idx_openapi_tool_user_name"` // Associated user ID
+	Name         string `gorm:"column:name;not null;uniqueIndex:idx_openapi_tool_user_name"`    // Display name, also used in tool names
+	Spec         string `gorm:"column:spec;type:text;not null"`                                 // OpenAPI document (JSON or YAML)
+	BaseURL      string `gorm:"column:base_url;not null;default:''"`                            // Overrides the document's first server URL
+	AuthType     string `gorm:"column:auth_type;not null;default:'none'"`                       // none, header, bearer or basic
+	AuthHeader   string `gorm:"column:auth_header;not null;default:''"`                         // Header name for header auth
+	AuthUsername string `gorm:"column:auth_username;not null;default:''"`                       // User name for basic auth
+	AuthSecret   string `gorm:"column:auth_secret;type:text;not null;default:''"`               // Encrypted header value, token or password
+	Operations   string `gorm:"column:operations;type:text;not null;default:''"`                // JSON array of selected operation IDs; empty selects all
+	Enabled      bool   `gorm:"column:enabled;not null"`                                        // Whether the API's tools are offered to the assistant
+}
+
+// APIToken is a long-lived token a user creates for programmatic access, e.g.
+// from scripts or MCP clients. Only the SHA-256 hash of the token is stored.
+// Revoked tokens are kept so that their last use stays visible.
+type APIToken struct {
+	Model
+
+	UserID     int        `gorm:"column:user_id;not null;index"`               // Associated user ID
+	Name       string     `gorm:"column:name;not null"`                        // Display name, e.g. "laptop MCP client"
+	TokenHash  string     `gorm:"column:token_hash;not null;uniqueIndex"`      // Hex SHA-256 of the token
+	Prefix     string     `gorm:"column:prefix;not null"`                      // First characters of the token, shown to identify it
+	Scopes     string     `gorm:"column:scopes;type:text;not null;default:''"` // JSON array of constant.APITokenScope; empty for tokens created before scopes
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`                           // Nil never expires
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`                         // Last authenticated request, updated at most once a minute
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`                           // Set when the user revokes the token
+}
+
+// CustomAgent is a user-defined persona with its own instruction, model and a
+// whitelist of the assistant's tools and sub-agents. Chats address it as
+// "custom-<id>" in the /:agentId routes.
+type CustomAgent struct {
+	Model
+
+	UserID         int    `gorm:"column:user_id;not null;uniqueIndex:idx_custom_agent_user_name"` // Owner
+	Name           string `gorm:"column:name;not null;uniqueIndex:idx_custom_agent_user_name"`    // Display name
+	Description    string `gorm:"column:description;not null;default:''"`                         // Short summary shown in the agent picker
+	Instruction    string `gorm:"column:instruction;type:text;not null"`                          // System instruction of the root agent
+	ModelName      string `gorm:"column:model_name;not null;default:''"`                          // Gemini model; empty uses the server default
+	ThinkingBudget int32  `gorm:"column:thinking_budget;not null;default:0"`                      // Thinking token budget; 0 uses the server default
+	Tools          string `gorm:"column:tools;type:text;not null;default:''"`                     // JSON array of tool names the agent may call directly
+	SubAgents      string `gorm:"column:sub_agents;type:text;not null;default:''"`                // JSON array of sub-agent names it may delegate to
+}
+
+// ToolConfirmationSetting records whether a side-effecting tool must be
+// confirmed by the user before it runs. Tools without a row default to
+// requiring confirmation.
+type ToolConfirmationSetting struct {
+	Model
+
+	UserID   int    `gorm:"column:user_id;not null;uniqueIndex:idx_tool_confirmation_user_tool"`
+	ToolName string `gorm:"column:tool_name;not null;uniqueIndex:idx_tool_confirmation_user_tool"`
+	Required bool   `gorm:"column:required;not null"`
+}
+
 // UserMemory 用户记忆，用于跨会话记住用户特征
 type UserMemory struct {
 	Model
@@ -106,24 +244,198 @@ type Task struct {
 	DependsOn   string                `gorm:"column:depends_on" json:"depends_on"`                          // JSON array of task IDs
 	Priority    constant.TaskPriority `gorm:"column:priority;type:int;default:0" json:"priority"`           // 0=low, 1=medium, 2=high
 	Result      string                `gorm:"column:result" json:"result,omitempty"`                        // 任务执行结果
+	Position    int                   `gorm:"column:position;not null;default:0" json:"position"`           // 同级任务的展示顺序，越小越靠前
 }
 
 // ScheduledTask represents a user-defined timed task.
 type ScheduledTask struct {
 	Model
 
-	UserID       int        `gorm:"column:user_id;not null;index" json:"user_id"`
-	SessionID    string     `gorm:"column:session_id;index" json:"session_id"`
-	Title        string     `gorm:"column:title;not null" json:"title"`
-	Action       string     `gorm:"column:action;type:text;not null" json:"action"`
-	ScheduleType string     `gorm:"column:schedule_type;type:varchar(20);not null;index" json:"schedule_type"` // once, daily, weekly
-	RunAt        string     `gorm:"column:run_at;not null" json:"run_at"`                                      // once=RFC3339, daily/weekly=HH:MM
-	Weekday      int        `gorm:"column:weekday" json:"weekday"`                                             // only for weekly: 0(Sun)-6(Sat)
-	Timezone     string     `gorm:"column:timezone;not null" json:"timezone"`
-	TargetEmail  string     `gorm:"column:target_email" json:"target_email,omitempty"`
-	Enabled      bool       `gorm:"column:enabled;default:true;index" json:"enabled"`
-	LastRunAt    *time.Time `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
-	NextRunAt    time.Time  `gorm:"column:next_run_at;not null;index" json:"next_run_at"`
+	UserID          int    `gorm:"column:user_id;not null;index" json:"user_id"`
+	SessionID       string `gorm:"column:session_id;index" json:"session_id"`
+	Title           string `gorm:"column:title;not null" json:"title"`
+	Action          string `gorm:"column:action;type:text;not null" json:"action"`
+	ScheduleType    string `gorm:"column:schedule_type;type:varchar(20);not null;index" json:"schedule_type"` // once, daily, weekly, workdays, monthly, interval, cron
+	RunAt           string `gorm:"column:run_at;not null" json:"run_at"`                                      // once/interval=RFC3339, daily/weekly/workdays/monthly=HH:MM
+	Weekday         int    `gorm:"column:weekday" json:"weekday"`                                             // weekly and monthly nth weekday: 0(Sun)-6(Sat)
+	MonthDay        int    `gorm:"column:month_day;not null;default:0" json:"month_day,omitempty"`            // monthly by day: 1-31, clamped to month end
+	WeekOfMonth     int    `gorm:"column:week_of_month;not null;default:0" json:"week_of_month,omitempty"`    // monthly by weekday: 1-4, -1=last
+	IntervalMinutes int    `gorm:"column:interval_minutes;not null;default:0" json:"interval_minutes,omitempty"`
+	CronExpr        string `gorm:"column:cron_expr;type:varchar(100)" json:"cron_expr,omitempty"` // standard 5-field expression
+	Timezone        string `gorm:"column:timezone;not null" json:"timezone"`
+	TargetEmail     string `gorm:"column:target_email" json:"target_email,omitempty"`
+	Enabled         bool   `gorm:"column:enabled;default:true;index" json:"enabled"`
+	// Failure handling: zero values fall back to the scheduler defaults.
+	MaxRuntimeMinutes   int        `gorm:"column:max_runtime_minutes;not null;default:0" json:"max_runtime_minutes,omitempty"`
+	MaxRetries          int        `gorm:"column:max_retries;not null;default:0" json:"max_retries,omitempty"`
+	FailureThreshold    int        `gorm:"column:failure_threshold;not null;default:0" json:"failure_threshold,omitempty"` // consecutive failures before the task is disabled
+	ConsecutiveFailures int        `gorm:"column:consecutive_failures;not null;default:0" json:"consecutive_failures"`
+	BlackoutDates       string     `gorm:"column:blackout_dates;type:text;not null;default:''" json:"blackout_dates,omitempty"`              // JSON array of YYYY-MM-DD or YYYY-MM-DD/YYYY-MM-DD in the task timezone
+	MissedRunPolicy     string     `gorm:"column:missed_run_policy;type:varchar(20);not null;default:''" json:"missed_run_policy,omitempty"` // run_once (empty), skip or run_all
+	LastRunAt           *time.Time `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
+	NextRunAt           time.Time  `gorm:"column:next_run_at;not null;index" json:"next_run_at"`
+}
+
+// ScheduledTaskRun records one execution of a scheduled task. Each run has
+// its own scheduler session so the full conversation can be opened later.
+type ScheduledTaskRun struct {
+	Model
+
+	ScheduledTaskID int                          `gorm:"column:scheduled_task_id;not null;index"`
+	UserID          int                          `gorm:"column:user_id;not null;index"`
+	SessionID       string                       `gorm:"column:session_id;not null;index"`  // scheduled-<task id>-<unix ns>
+	Attempt         int                          `gorm:"column:attempt;not null;default:1"` // 1 for the first try, incremented on each retry
+	Trigger         constant.ScheduledRunTrigger `gorm:"column:trigger_type;type:varchar(20);not null;default:'schedule'"`
+	Status          constant.ScheduledRunStatus  `gorm:"column:status;type:varchar(20);not null;index"`
+	StartedAt       time.Time                    `gorm:"column:started_at;not null"`
+	FinishedAt      *time.Time                   `gorm:"column:finished_at"`
+	Error           string                       `gorm:"column:error;type:text;not null;default:''"`
+	Output          string                       `gorm:"column:output;type:text;not null;default:''"`     // Final text reply of the agent
+	ToolCalls       string                       `gorm:"column:tool_calls;type:text;not null;default:''"` // JSON array of tool calls made during the run
+	Deliveries      string                       `gorm:"column:deliveries;type:text;not null;default:''"` // JSON array of delivery results for the run output
+}
+
+// ScheduledTaskDelivery is an extra target that receives the output of every
+// successful run of a scheduled task, in addition to target_email.
+type ScheduledTaskDelivery struct {
+	Model
+
+	ScheduledTaskID int                      `gorm:"column:scheduled_task_id;not null;index"`
+	UserID          int                      `gorm:"column:user_id;not null;index"`
+	Channel         constant.DeliveryChannel `gorm:"column:channel;type:varchar(20);not null"`
+	Provider        string                   `gorm:"column:provider;type:varchar(20);not null;default:''"` // chat_bot: telegram or slack
+	Target          string                   `gorm:"column:target;type:varchar(512);not null;default:''"`  // email address, webhook URL or chat id; empty for in_app
+	Secret          string                   `gorm:"column:secret;type:text;not null;default:''"`          // Encrypted webhook signing secret or bot token
+}
+
+// EventTrigger runs an agent action when something happens: a new email
+// matching a filter, a change of a web page, a new item in an RSS/Atom
+// feed or a call of its inbound webhook. Sources other than webhooks are
+// polled every poll_interval_minutes.
+type EventTrigger struct {
+	Model
+
+	UserID              int                       `gorm:"column:user_id;not null;index"`
+	Title               string                    `gorm:"column:title;not null"`
+	Kind                constant.EventTriggerKind `gorm:"column:kind;type:varchar(20);not null"`
+	Action              string                    `gorm:"column:action;type:text;not null"`                  // Prompt; the event details are appended, webhooks use it as a template
+	URL                 string                    `gorm:"column:url;type:varchar(1024);not null;default:''"` // web_page and feed
+	EmailConfigName     string                    `gorm:"column:email_config_name;not null;default:''"`      // email: empty uses the default config
+	Mailbox             string                    `gorm:"column:mailbox;not null;default:''"`                // email: empty is INBOX
+	FromFilter          string                    `gorm:"column:from_filter;not null;default:''"`            // email: substring of the From header
+	SubjectFilter       string                    `gorm:"column:subject_filter;not null;default:''"`         // email: substring of the Subject header
+	PollIntervalMinutes int                       `gorm:"column:poll_interval_minutes;not null;default:0"`   // 0 uses the default
+	Enabled             bool                      `gorm:"column:enabled;not null;default:false;index"`
+	State               string                    `gorm:"column:state;type:text;not null;default:''"` // JSON dedup state of the source, e.g. last seen UID
+	LastCheckedAt       *time.Time                `gorm:"column:last_checked_at"`
+	LastError           string                    `gorm:"column:last_error;type:text;not null;default:''"`
+	NextCheckAt         time.Time                 `gorm:"column:next_check_at;not null;index"`
+	TokenHash           string                    `gorm:"column:token_hash;type:varchar(64);not null;default:'';index"` // webhook: SHA-256 of the secret token
+	TokenPrefix         string                    `gorm:"column:token_prefix;type:varchar(16);not null;default:''"`     // webhook: leading characters shown to the user
+}
+
+// EventTriggerRun records one agent run started by an event trigger.
+type EventTriggerRun struct {
+	Model
+
+	EventTriggerID int                         `gorm:"column:event_trigger_id;not null;index"`
+	UserID         int                         `gorm:"column:user_id;not null;index"`
+	SessionID      string                      `gorm:"column:session_id;not null;index"`                       // trigger-<trigger id>-<unix ns>
+	EventKey       string                      `gorm:"column:event_key;type:varchar(512);not null;default:''"` // Email UID, page content hash or feed item id
+	EventSummary   string                      `gorm:"column:event_summary;not null;default:''"`
+	Status         constant.ScheduledRunStatus `gorm:"column:status;type:varchar(20);not null;index"`
+	StartedAt      time.Time                   `gorm:"column:started_at;not null"`
+	FinishedAt     *time.Time                  `gorm:"column:finished_at"`
+	Error          string                      `gorm:"column:error;type:text;not null;default:''"`
+	Output         string                      `gorm:"column:output;type:text;not null;default:''"`
+	ToolCalls      string                      `gorm:"column:tool_calls;type:text;not null;default:''"` // JSON array of tool calls made during the run
+}
+
+// Notification is an in-app message shown to a user, e.g. the result of a
+// scheduled task run.
+type Notification struct {
+	Model
+
+	UserID int                       `gorm:"column:user_id;not null;index"`
+	Kind   constant.NotificationKind `gorm:"column:kind;type:varchar(32);not null"`
+	Title  string                    `gorm:"column:title;not null"`
+	Body   string                    `gorm:"column:body;type:text;not null;default:''"`
+	Link   string                    `gorm:"column:link;type:varchar(512);not null;default:''"` // Frontend path opened from the notification
+	ReadAt *time.Time                `gorm:"column:read_at;index"`
+}
+
+// WebPushSubscription is the browser push subscription of one device of a
+// user. An endpoint belongs to one user; subscribing again moves it.
+type WebPushSubscription struct {
+	Model
+
+	UserID        int        `gorm:"column:user_id;not null;index"`
+	Endpoint      string     `gorm:"column:endpoint;type:varchar(1024);not null;uniqueIndex"`
+	P256dh        string     `gorm:"column:p256dh;type:varchar(128);not null"`
+	Auth          string     `gorm:"column:auth;type:varchar(64);not null"`
+	DeviceName    string     `gorm:"column:device_name;type:varchar(255);not null;default:''"` // Shown in the device list, e.g. the browser user agent
+	LastSuccessAt *time.Time `gorm:"column:last_success_at"`
+	FailureCount  int        `gorm:"column:failure_count;not null;default:0"` // Consecutive failed deliveries
+}
+
+// NotificationPreference records whether notifications of one kind are
+// pushed to the user's browsers. Kinds without a row are pushed.
+type NotificationPreference struct {
+	Model
+
+	UserID  int                       `gorm:"column:user_id;not null;uniqueIndex:idx_notification_preference_user_kind"`
+	Kind    constant.NotificationKind `gorm:"column:kind;type:varchar(32);not null;uniqueIndex:idx_notification_preference_user_kind"`
+	WebPush bool                      `gorm:"column:web_push;not null"`
+}
+
+// WebPushKey is the generated VAPID key pair used when none is configured.
+// There is at most one row.
+type WebPushKey struct {
+	Model
+
+	PublicKey  string `gorm:"column:public_key;type:varchar(128);not null"`
+	PrivateKey string `gorm:"column:private_key;type:text;not null"` // Encrypted with the secret cipher
+}
+
+// DataMigration records a one-time data migration that has run, so it is not
+// repeated after the rows it created are edited or removed.
+type DataMigration struct {
+	Model
+
+	Name string `gorm:"column:name;type:varchar(128);not null;uniqueIndex"`
+}
+
+// ChatBotLink links the account of an external chat platform user to a user,
+// established by sending a pairing code to the bot.
+type ChatBotLink struct {
+	Model
+
+	UserID         int    `gorm:"column:user_id;not null;index"`
+	Provider       string `gorm:"column:provider;type:varchar(20);not null;uniqueIndex:idx_chat_bot_link_external"`         // telegram or slack
+	ExternalUserID string `gorm:"column:external_user_id;type:varchar(64);not null;uniqueIndex:idx_chat_bot_link_external"` // Telegram user id or Slack member id
+	ExternalName   string `gorm:"column:external_name;type:varchar(255);not null;default:''"`                               // Platform user name, shown in the link list
+}
+
+// ChatBotThread maps a chat, or a thread within it, to the session holding
+// the conversation of one linked user there.
+type ChatBotThread struct {
+	Model
+
+	Provider  string `gorm:"column:provider;type:varchar(20);not null;uniqueIndex:idx_chat_bot_thread"`
+	ChatID    string `gorm:"column:chat_id;type:varchar(64);not null;uniqueIndex:idx_chat_bot_thread"`
+	ThreadID  string `gorm:"column:thread_id;type:varchar(64);not null;default:'';uniqueIndex:idx_chat_bot_thread"` // Telegram topic or Slack thread ts; empty outside threads
+	UserID    int    `gorm:"column:user_id;not null;uniqueIndex:idx_chat_bot_thread"`
+	SessionID string `gorm:"column:session_id;type:varchar(64);not null"`
+}
+
+// ChatBotPairingCode is a short-lived code a user sends to a bot to link
+// their chat account. Only the SHA-256 hash of the code is stored.
+type ChatBotPairingCode struct {
+	Model
+
+	UserID    int       `gorm:"column:user_id;not null;index"`
+	CodeHash  string    `gorm:"column:code_hash;type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index"`
 }
 
 // SharedConversation represents a shared conversation link
@@ -228,13 +540,35 @@ type AudioTranscriptChunk struct {
 func GetAllModels() []any {
 	return []any{
 		&User{},
+		&UserIdentity{},
+		&AllowedEmail{},
+		&LocalCredential{},
+		&InviteCode{},
+		&PasswordResetToken{},
 		&SessionMeta{},
 		&Project{},
 		&EmailServerConfig{},
 		&SSHServerConfig{},
+		&ToolConfirmationSetting{},
+		&MCPServerConfig{},
+		&APIToken{},
+		&OpenAPIToolConfig{},
+		&CustomAgent{},
 		&UserMemory{},
 		&Task{},
 		&ScheduledTask{},
+		&ScheduledTaskRun{},
+		&ScheduledTaskDelivery{},
+		&Notification{},
+		&WebPushSubscription{},
+		&NotificationPreference{},
+		&WebPushKey{},
+		&DataMigration{},
+		&EventTrigger{},
+		&EventTriggerRun{},
+		&ChatBotLink{},
+		&ChatBotThread{},
+		&ChatBotPairingCode{},
 		&SharedConversation{},
 		&FileAsset{},
 		&PDFTextPage{},
@@ -37,5 +37,6 @@ func (a *AIGuide) GetUser(c *gin.Context) {
 		"email":   user.GoogleEmail,
 		"name":    user.GoogleName,
 		"picture": avatarURL,
+		"role":    user.Role,
 	})
 }
@@ -1,13 +1,17 @@
 package auth
 
 import (
+	"aiguide/internal/pkg/constant"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -79,17 +83,14 @@ func NewAuthService(config *Config) *AuthService {
 }
 
 // GetAuthURL 获取 Google OAuth 认证 URL
-func (s *AuthService) GetAuthURL(state string) string {
-	return s.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+func (s *AuthService) GetAuthURL(state string, opts ...oauth2.AuthCodeOption) string {
+	return s.oauthConfig.AuthCodeURL(state, append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)...)
 }
 
 // GetAuthURLWithForceConsent 强制显示授权对话框以获取新的 refresh_token。
 // 用于存量用户补充 Calendar scope 的重新授权场景。
-func (s *AuthService) GetAuthURLWithForceConsent(state string) string {
-	return s.oauthConfig.AuthCodeURL(state,
-		oauth2.AccessTypeOffline,
-		oauth2.SetAuthURLParam("prompt", "consent"),
-	)
+func (s *AuthService) GetAuthURLWithForceConsent(state string, opts ...oauth2.AuthCodeOption) string {
+	return s.GetAuthURL(state, append([]oauth2.AuthCodeOption{oauth2.SetAuthURLParam("prompt", "consent")}, opts...)...)
 }
 
 // GetOAuthConfig 返回 OAuth2 配置，供工具层代表用户调用 Google API 使用。
@@ -98,8 +99,8 @@ func (s *AuthService) GetOAuthConfig() *oauth2.Config {
 }
 
 // ExchangeCode 使用授权码交换访问令牌
-func (s *AuthService) ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
-	return s.oauthConfig.Exchange(ctx, code)
+func (s *AuthService) ExchangeCode(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	return s.oauthConfig.Exchange(ctx, code, opts...)
 }
 
 // GetGoogleUser 从 Google 获取用户信息
@@ -244,3 +245,102 @@ func GenerateStateToken() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
+
+// APITokenPrefix 标识 API 令牌，用于与 JWT 区分
+const APITokenPrefix = "aig_"
+
+// GenerateAPIToken 生成随机 API 令牌，返回明文令牌（仅展示一次）及其哈希（用于存储）
+func GenerateAPIToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("failed to generate random api token", "err", err)
+		return "", "", err
+	}
+	token = APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken 返回令牌的 SHA-256 十六进制哈希，数据库中只保存哈希（API 令牌与一次性令牌共用）
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateOneTimeToken 生成随机一次性令牌（如密码重置链接），返回明文令牌及其哈希（用于存储）
+func GenerateOneTimeToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("failed to generate random one-time token", "err", err)
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAPIToken(token), nil
+}
+
+// inviteCodeAlphabet 邀请码字符集，去掉了容易混淆的 0/O、1/I/L
+const inviteCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// GenerateInviteCode 生成形如 K7QF-2MXA-9PND 的邀请码，返回邀请码及其哈希（用于存储）
+func GenerateInviteCode() (code string, hash string, err error) {
+	// 舍弃超出字符集整数倍的随机字节，避免取模带来的字符分布偏差
+	limit := byte(256 / len(inviteCodeAlphabet) * len(inviteCodeAlphabet))
+	var sb strings.Builder
+	b := make([]byte, 1)
+	for n := 0; n < 12; {
+		if _, err := rand.Read(b); err != nil {
+			slog.Error("failed to generate random invite code", "err", err)
+			return "", "", err
+		}
+		if b[0] >= limit {
+			continue
+		}
+		if n > 0 && n%4 == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(inviteCodeAlphabet[int(b[0])%len(inviteCodeAlphabet)])
+		n++
+	}
+	code = sb.String()
+	return code, HashInviteCode(code), nil
+}
+
+// HashInviteCode 返回邀请码的哈希，忽略大小写与分隔符
+func HashInviteCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	return HashAPIToken(normalized)
+}
+
+// IsAPIToken 判断令牌是否为 API 令牌（而非 JWT）
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// ParseAPITokenScopes 解析数据库中以 JSON 数组保存的权限范围，忽略无效项
+// 引入权限范围之前创建的令牌没有记录，它们当时只用于 MCP，因此视为仅有 chat 权限
+func ParseAPITokenScopes(raw string) []constant.APITokenScope {
+	if raw == "" {
+		return []constant.APITokenScope{constant.APITokenScopeChat}
+	}
+	var scopes []constant.APITokenScope
+	if err := json.Unmarshal([]byte(raw), &scopes); err != nil {
+		slog.Error("failed to parse api token scopes", "err", err)
+		return nil
+	}
+	valid := scopes[:0]
+	for _, scope := range scopes {
+		if scope.Valid() {
+			valid = append(valid, scope)
+		}
+	}
+	return valid
+}
+
+// HasAPITokenScope 判断权限范围是否包含 scope，admin 包含全部权限
+func HasAPITokenScope(scopes []constant.APITokenScope, scope constant.APITokenScope) bool {
+	for _, s := range scopes {
+		if s == scope || s == constant.APITokenScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"aiguide/internal/pkg/constant"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -356,3 +358,65 @@ func TestGetOAuthConfig_ReturnsNonNilWithClientID(t *testing.T) {
 		t.Errorf("GetOAuthConfig() ClientID = %q, want %q", oauthConfig.ClientID, config.ClientID)
 	}
 }
+
+func TestGenerateAPIToken(t *testing.T) {
+	token, hash, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken failed: %v", err)
+	}
+
+	if !IsAPIToken(token) {
+		t.Errorf("Expected token with prefix %q, got %q", APITokenPrefix, token)
+	}
+	if hash != HashAPIToken(token) {
+		t.Error("Expected returned hash to match HashAPIToken(token)")
+	}
+	if hash == token {
+		t.Error("Expected hash to differ from the plain token")
+	}
+	if IsAPIToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("Expected JWT not to be detected as API token")
+	}
+}
+
+func TestParseAPITokenScopes(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []constant.APITokenScope
+	}{
+		{"", []constant.APITokenScope{constant.APITokenScopeChat}},
+		{`["memories","bogus","files"]`, []constant.APITokenScope{constant.APITokenScopeMemories, constant.APITokenScopeFiles}},
+		{"not json", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseAPITokenScopes(tt.raw); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseAPITokenScopes(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	admin := []constant.APITokenScope{constant.APITokenScopeAdmin}
+	if !HasAPITokenScope(admin, constant.APITokenScopeFiles) {
+		t.Error("HasAPITokenScope() admin should include every scope")
+	}
+	if HasAPITokenScope([]constant.APITokenScope{constant.APITokenScopeChat}, constant.APITokenScopeFiles) {
+		t.Error("HasAPITokenScope() chat should not include files")
+	}
+}
+
+func TestGenerateInviteCode(t *testing.T) {
+	code, hash, err := GenerateInviteCode()
+	if err != nil {
+		t.Fatalf("GenerateInviteCode() error = %v", err)
+	}
+	parts := strings.Split(code, "-")
+	if len(parts) != 3 || len(parts[0]) != 4 || len(parts[1]) != 4 || len(parts[2]) != 4 {
+		t.Errorf("code = %q, want XXXX-XXXX-XXXX", code)
+	}
+	if strings.ContainsAny(code, "01IOL") {
+		t.Errorf("code = %q contains ambiguous characters", code)
+	}
+	// 用户输入时忽略大小写与分隔符
+	if HashInviteCode(" "+strings.ToLower(strings.ReplaceAll(code, "-", ""))+" ") != hash {
+		t.Error("HashInviteCode() differs for lowercase code without dashes")
+	}
+}
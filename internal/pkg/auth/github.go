@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// ProviderGitHub GitHub 登录提供方标识
+const ProviderGitHub = "github"
+
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubConfig GitHub OAuth App 配置
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Endpoint 与 APIURL 用于 GitHub Enterprise，留空时使用 github.com
+	Endpoint oauth2.Endpoint
+	APIURL   string
+}
+
+// GitHubProvider GitHub OAuth 登录提供方
+type GitHubProvider struct {
+	oauthConfig *oauth2.Config
+	apiURL      string
+	httpClient  *http.Client
+}
+
+// NewGitHubProvider 创建 GitHub 登录提供方，httpClient 为空时使用默认客户端
+func NewGitHubProvider(config GitHubConfig, httpClient *http.Client) *GitHubProvider {
+	endpoint := config.Endpoint
+	if endpoint.AuthURL == "" {
+		endpoint = github.Endpoint
+	}
+	apiURL := strings.TrimSuffix(config.APIURL, "/")
+	if apiURL == "" {
+		apiURL = defaultGitHubAPIURL
+	}
+	return &GitHubProvider{
+		oauthConfig: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint:     endpoint,
+		},
+		apiURL:     apiURL,
+		httpClient: httpClient,
+	}
+}
+
+// Name 返回提供方标识
+func (p *GitHubProvider) Name() string { return ProviderGitHub }
+
+// DisplayName 返回登录按钮上显示的名称
+func (p *GitHubProvider) DisplayName() string { return "GitHub" }
+
+// AuthCodeURL 返回 GitHub 授权地址
+func (p *GitHubProvider) AuthCodeURL(_ context.Context, state, verifier string) (string, error) {
+	return p.oauthConfig.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange 交换授权码并获取 GitHub 用户信息
+func (p *GitHubProvider) Exchange(ctx context.Context, code, _, verifier string) (*Identity, error) {
+	ctx = withHTTPClient(ctx, p.httpClient)
+	token, err := p.oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+	client := p.oauthConfig.Client(ctx, token)
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := p.get(ctx, client, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("github user response has no id")
+	}
+
+	identity := &Identity{
+		Provider: ProviderGitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Email:    user.Email,
+		Name:     user.Name,
+		Picture:  user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	// 公开邮箱未经验证，优先使用已验证的主邮箱
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(ctx, client, "/user/emails", &emails); err != nil {
+		slog.Warn("failed to fetch github emails", "err", err)
+		return identity, nil
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email = e.Email
+			identity.EmailVerified = true
+			break
+		}
+	}
+	return identity, nil
+}
+
+func (p *GitHubProvider) get(ctx context.Context, client *http.Client, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call github api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github api %s returned status=%d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode github api response: %w", err)
+	}
+	return nil
+}
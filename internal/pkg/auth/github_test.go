@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func newFakeGitHubServer(t *testing.T, emails []map[string]any) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code_verifier") != "verifier-1" {
+			http.Error(w, `{"error":"bad_verification_code"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/api/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":         42,
+			"login":      "octocat",
+			"email":      "public@example.com",
+			"avatar_url": "https://avatars.example.com/42",
+		})
+	})
+	mux.HandleFunc("/api/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if emails == nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(emails)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestGitHubProvider(server *httptest.Server) *GitHubProvider {
+	return NewGitHubProvider(GitHubConfig{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  server.URL + "/login/oauth/authorize",
+			TokenURL: server.URL + "/login/oauth/access_token",
+		},
+		APIURL: server.URL + "/api/",
+	}, server.Client())
+}
+
+func TestGitHubProviderExchange(t *testing.T) {
+	server := newFakeGitHubServer(t, []map[string]any{
+		{"email": "old@example.com", "primary": false, "verified": true},
+		{"email": "octo@example.com", "primary": true, "verified": true},
+	})
+	p := newTestGitHubProvider(server)
+
+	identity, err := p.Exchange(context.Background(), "code", "state", "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := Identity{
+		Provider:      ProviderGitHub,
+		Subject:       "42",
+		Email:         "octo@example.com",
+		EmailVerified: true,
+		Name:          "octocat",
+		Picture:       "https://avatars.example.com/42",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestGitHubProviderExchangeWithoutEmailScope(t *testing.T) {
+	server := newFakeGitHubServer(t, nil)
+	p := newTestGitHubProvider(server)
+
+	identity, err := p.Exchange(context.Background(), "code", "state", "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	// 公开邮箱可由用户随意填写，不能视为已验证
+	if identity.Email != "public@example.com" || identity.EmailVerified {
+		t.Errorf("identity = %+v, want unverified public email", *identity)
+	}
+}
+
+func TestGitHubProviderExchangeRequiresVerifier(t *testing.T) {
+	server := newFakeGitHubServer(t, nil)
+	p := newTestGitHubProvider(server)
+
+	if _, err := p.Exchange(context.Background(), "code", "state", "wrong"); err == nil {
+		t.Error("Exchange() with wrong PKCE verifier succeeded, want error")
+	}
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeOIDCServer 模拟的 OIDC 提供方，token 端点签发的 ID Token 声明由测试设置
+type fakeOIDCServer struct {
+	*httptest.Server
+	key          *rsa.PrivateKey
+	claims       jwt.MapClaims
+	issuer       string // 覆盖发现文档中的 issuer，默认为服务器地址
+	wantVerifier string
+	jwksRequests int
+}
+
+func newFakeOIDCServer(t *testing.T) *fakeOIDCServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	s := &fakeOIDCServer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 cmp.Or(s.issuer, s.URL),
+			"authorization_endpoint": s.URL + "/auth",
+			"token_endpoint":         s.URL + "/token",
+			"userinfo_endpoint":      s.URL + "/userinfo",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwksRequests++
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code_verifier") != s.wantVerifier {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, s.claims)
+		token.Header["kid"] = "k1"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("failed to sign id token: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"sub":            "user-1",
+			"email":          "alice@example.com",
+			"email_verified": "true",
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeOIDCServer) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:        "keycloak",
+		DisplayName: "Keycloak",
+		Issuer:      s.URL + "/",
+		ClientID:    "aiguide",
+		RedirectURL: "http://localhost:8080/api/auth/callback/keycloak",
+	}, s.Client())
+}
+
+func (s *fakeOIDCServer) validClaims(state string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            "aiguide",
+		"sub":            "user-1",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          stateNonce(state),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func TestOIDCProviderAuthCodeURL(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := s.provider()
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth url: %v", err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(authURL, s.URL+"/auth?") {
+		t.Errorf("auth url = %s, want authorization endpoint", authURL)
+	}
+	if q.Get("nonce") != stateNonce("state-1") {
+		t.Errorf("nonce = %q, want derived from state", q.Get("nonce"))
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Errorf("missing PKCE challenge in %s", authURL)
+	}
+	if q.Get("scope") != "openid email profile" {
+		t.Errorf("scope = %q, want default scopes", q.Get("scope"))
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := s.provider()
+	s.wantVerifier = "verifier-1"
+	s.claims = s.validClaims("state-1")
+
+	identity, err := p.Exchange(context.Background(), "code", "state-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := Identity{Provider: "keycloak", Subject: "user-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	// 第二次登录复用缓存的 JWKS
+	if _, err := p.Exchange(context.Background(), "code", "state-1", "verifier-1"); err != nil {
+		t.Fatalf("second Exchange() error = %v", err)
+	}
+	if s.jwksRequests != 1 {
+		t.Errorf("jwks requests = %d, want 1", s.jwksRequests)
+	}
+}
+
+func TestOIDCProviderExchangeUserinfoFallback(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := s.provider()
+	s.wantVerifier = "verifier-1"
+	s.claims = s.validClaims("state-1")
+	delete(s.claims, "email")
+	delete(s.claims, "email_verified")
+
+	identity, err := p.Exchange(context.Background(), "code", "state-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if identity.Email != "alice@example.com" || !identity.EmailVerified {
+		t.Errorf("identity = %+v, want email from userinfo", *identity)
+	}
+}
+
+func TestOIDCProviderExchangeRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(s *fakeOIDCServer, claims jwt.MapClaims)
+		state  string
+	}{
+		{name: "nonce from another state", state: "state-2"},
+		{name: "wrong audience", mutate: func(_ *fakeOIDCServer, c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "wrong issuer", mutate: func(_ *fakeOIDCServer, c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", mutate: func(_ *fakeOIDCServer, c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "missing subject", mutate: func(_ *fakeOIDCServer, c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeOIDCServer(t)
+			p := s.provider()
+			s.wantVerifier = "verifier-1"
+			s.claims = s.validClaims("state-1")
+			if tt.mutate != nil {
+				tt.mutate(s, s.claims)
+			}
+			state := tt.state
+			if state == "" {
+				state = "state-1"
+			}
+			if _, err := p.Exchange(context.Background(), "code", state, "verifier-1"); err == nil {
+				t.Error("Exchange() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchangeRequiresVerifier(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	p := s.provider()
+	s.wantVerifier = "verifier-1"
+	s.claims = s.validClaims("state-1")
+
+	if _, err := p.Exchange(context.Background(), "code", "state-1", "other-verifier"); err == nil {
+		t.Error("Exchange() with wrong PKCE verifier succeeded, want error")
+	}
+}
+
+func TestOIDCProviderDiscoveryIssuerMismatch(t *testing.T) {
+	s := newFakeOIDCServer(t)
+	s.issuer = "https://evil.example.com"
+
+	if _, err := s.provider().AuthCodeURL(context.Background(), "state", "verifier"); err == nil {
+		t.Error("AuthCodeURL() succeeded with mismatched issuer, want error")
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ec key: %v", err)
+	}
+	point, err := ecKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("failed to encode ec key: %v", err)
+	}
+	key, err := parseJWK(jsonWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+	})
+	if err != nil {
+		t.Fatalf("parseJWK(EC) error = %v", err)
+	}
+	if !key.(*ecdsa.PublicKey).Equal(&ecKey.PublicKey) {
+		t.Error("parsed EC key does not match")
+	}
+
+	if _, err := parseJWK(jsonWebKey{Kty: "oct"}); err == nil {
+		t.Error("parseJWK(oct) succeeded, want error")
+	}
+	if _, err := parseJWK(jsonWebKey{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}); err == nil {
+		t.Error("parseJWK() with short coordinates succeeded, want error")
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("hash = %s, want argon2id PHC string", hash)
+	}
+	if PasswordNeedsRehash(hash) {
+		t.Error("PasswordNeedsRehash() = true for a hash with current parameters")
+	}
+
+	other, _ := HashPassword("correct horse battery")
+	if other == hash {
+		t.Error("two hashes of the same password are equal, want random salt")
+	}
+
+	ok, err := VerifyPassword(hash, "correct horse battery")
+	if err != nil || !ok {
+		t.Errorf("VerifyPassword(correct) = %v, %v", ok, err)
+	}
+	ok, err = VerifyPassword(hash, "wrong password")
+	if err != nil || ok {
+		t.Errorf("VerifyPassword(wrong) = %v, %v", ok, err)
+	}
+}
+
+func TestVerifyPasswordBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("imported-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt error = %v", err)
+	}
+
+	ok, err := VerifyPassword(string(hash), "imported-password")
+	if err != nil || !ok {
+		t.Errorf("VerifyPassword(bcrypt) = %v, %v", ok, err)
+	}
+	if ok, _ := VerifyPassword(string(hash), "other"); ok {
+		t.Error("VerifyPassword(bcrypt, wrong) = true")
+	}
+	if !PasswordNeedsRehash(string(hash)) {
+		t.Error("PasswordNeedsRehash(bcrypt) = false, want true")
+	}
+}
+
+func TestVerifyPasswordInvalidHash(t *testing.T) {
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1$salt", "$argon2id$v=18$m=65536,t=3,p=2$c2FsdA$a2V5"} {
+		if _, err := VerifyPassword(hash, "password"); err == nil {
+			t.Errorf("VerifyPassword(%q) error = nil, want error", hash)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{"short", false},
+		{"12345678", true},
+		{"密码长度足够八个字符", true},
+		{strings.Repeat("a", MaxPasswordLength+1), false},
+	}
+	for _, tt := range tests {
+		if err := ValidatePassword(tt.password); (err == nil) != tt.valid {
+			t.Errorf("ValidatePassword(%q) error = %v, want valid=%v", tt.password, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// ProviderGoogle Google 登录提供方标识
+const ProviderGoogle = "google"
+
+// ProviderLocal 本地账号（邮箱密码）的身份标识，不对应 Provider 实现
+const ProviderLocal = "local"
+
+// Identity 表示从登录提供方获取的用户身份
+type Identity struct {
+	Provider      string // 提供方标识，如 google、github 或 OIDC 配置名称
+	Subject       string // 提供方内唯一且稳定的用户 ID
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	// RefreshToken 提供方签发的 refresh_token，仅 Google 登录时保存（日历工具使用）
+	RefreshToken string
+}
+
+// Provider 登录提供方，Google、GitHub 与通用 OIDC 都实现该接口
+type Provider interface {
+	// Name 返回提供方标识，用于登录和回调路由
+	Name() string
+	// DisplayName 返回登录按钮上显示的名称
+	DisplayName() string
+	// AuthCodeURL 返回授权地址，verifier 为 PKCE 校验码
+	AuthCodeURL(ctx context.Context, state, verifier string) (string, error)
+	// Exchange 使用授权码交换令牌并获取用户身份，state 与 verifier 必须与 AuthCodeURL 时一致
+	Exchange(ctx context.Context, code, state, verifier string) (*Identity, error)
+}
+
+// GoogleProvider 将 AuthService 适配为登录提供方
+type GoogleProvider struct {
+	service *AuthService
+}
+
+// NewGoogleProvider 创建 Google 登录提供方
+func NewGoogleProvider(service *AuthService) *GoogleProvider {
+	return &GoogleProvider{service: service}
+}
+
+// Name 返回提供方标识
+func (p *GoogleProvider) Name() string { return ProviderGoogle }
+
+// DisplayName 返回登录按钮上显示的名称
+func (p *GoogleProvider) DisplayName() string { return "Google" }
+
+// AuthCodeURL 返回 Google 授权地址
+func (p *GoogleProvider) AuthCodeURL(_ context.Context, state, verifier string) (string, error) {
+	return p.service.GetAuthURL(state, oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange 交换授权码并获取 Google 用户信息
+func (p *GoogleProvider) Exchange(ctx context.Context, code, _, verifier string) (*Identity, error) {
+	token, err := p.service.ExchangeCode(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+	user, err := p.service.GetGoogleUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Provider:      ProviderGoogle,
+		Subject:       user.ID,
+		Email:         user.Email,
+		EmailVerified: user.VerifiedEmail,
+		Name:          user.Name,
+		Picture:       user.Picture,
+		RefreshToken:  token.RefreshToken,
+	}, nil
+}
+
+// withHTTPClient 让 oauth2 使用指定的 HTTP 客户端（测试中指向模拟的身份提供方）
+func withHTTPClient(ctx context.Context, client *http.Client) context.Context {
+	if client == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
+
+// stateNonce 由 state 派生 OIDC nonce，回调时无需额外保存
+func stateNonce(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,173 @@
+// Package chatbot talks to the Telegram Bot API and the Slack Web API and
+// parses the updates both platforms send to the assistant's bot endpoints.
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// responseLimit caps the API responses read into memory.
+const responseLimit = 1 << 20
+
+// ErrFileTooLarge is returned by DownloadFile when a file exceeds the size
+// limit of the caller.
+var ErrFileTooLarge = errors.New("file is too large")
+
+// Message is a chat message received by a bot.
+type Message struct {
+	Provider string
+	ChatID   string
+	// ThreadID is the Telegram forum topic or the Slack thread the message
+	// belongs to; empty for messages outside threads.
+	ThreadID string
+	// ReplyThreadID is where replies go: ThreadID, or for Slack channel
+	// mentions the message itself, which starts a new thread.
+	ReplyThreadID string
+	SenderID      string
+	SenderName    string
+	Text          string
+	Files         []File
+}
+
+// File is an attachment of a received message. It is downloaded on demand.
+type File struct {
+	// ID is the Telegram file_id; URL the Slack private download URL.
+	ID       string
+	URL      string
+	Name     string
+	MimeType string
+	Size     int64
+}
+
+// Bot sends messages on one chat platform.
+type Bot interface {
+	// Provider returns constant.ChatBotProviderTelegram or
+	// constant.ChatBotProviderSlack.
+	Provider() string
+	// MessageLimit is the longest text one message may hold, in runes.
+	MessageLimit() int
+	// SendMessage posts text to chatID, in threadID when set, and returns
+	// the id of the new message.
+	SendMessage(ctx context.Context, chatID, threadID, text string) (string, error)
+	// EditMessage replaces the text of a message sent by the bot.
+	EditMessage(ctx context.Context, chatID, messageID, text string) error
+	// DownloadFile fetches an attachment of a received message, failing
+	// with ErrFileTooLarge beyond maxSize bytes.
+	DownloadFile(ctx context.Context, file File, maxSize int64) ([]byte, error)
+}
+
+// SplitMessage splits text into chunks of at most limit runes, preferring
+// to break at line ends.
+func SplitMessage(text string, limit int) []string {
+	var chunks []string
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i-1] == '\n' {
+				cut = i
+				break
+			}
+		}
+		chunks = append(chunks, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	if len(runes) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
+
+// postJSON posts payload to target and decodes the {"ok": ...} envelope
+// shared by the Telegram and Slack APIs into out. errorField names the
+// field holding the reason of a failure.
+func postJSON(ctx context.Context, client *http.Client, target string, headers map[string]string, payload any, errorField string, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response, status, err := do(client, req, responseLimit)
+	if err != nil {
+		return err
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(response, &envelope); err != nil {
+		return fmt.Errorf("invalid chat bot response (status %d): %w", status, err)
+	}
+	var ok bool
+	_ = json.Unmarshal(envelope["ok"], &ok)
+	if !ok {
+		var reason any
+		_ = json.Unmarshal(envelope[errorField], &reason)
+		return fmt.Errorf("chat bot api error: %v", reason)
+	}
+	if out != nil {
+		if err := json.Unmarshal(response, out); err != nil {
+			return fmt.Errorf("invalid chat bot response: %w", err)
+		}
+	}
+	return nil
+}
+
+// do sends req and returns at most limit bytes of the response body. It
+// fails with ErrFileTooLarge when the body is longer.
+func do(client *http.Client, req *http.Request, limit int64) ([]byte, int, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// Drop the URL from the error: Telegram puts the bot token in it.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, resp.StatusCode, ErrFileTooLarge
+	}
+	return data, resp.StatusCode, nil
+}
+
+// download fetches target with the given headers, up to maxSize bytes.
+func download(ctx context.Context, client *http.Client, target string, headers map[string]string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	data, status, err := do(client, req, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("file download returned %d: %s", status, strings.TrimSpace(string(data[:min(len(data), 200)])))
+	}
+	return data, nil
+}
@@ -0,0 +1,215 @@
+package chatbot
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiguide/internal/pkg/constant"
+)
+
+// SlackAPIURL is the endpoint of the Slack Web API.
+const SlackAPIURL = "https://slack.com/api"
+
+const (
+	// slackMessageLimit keeps messages below the 4000 characters Slack
+	// recommends for the text field.
+	slackMessageLimit = 3900
+	// slackRequestMaxAge rejects replayed Events API requests.
+	slackRequestMaxAge = 5 * time.Minute
+)
+
+// Headers of Events API requests.
+const (
+	SlackSignatureHeader = "X-Slack-Signature"
+	SlackTimestampHeader = "X-Slack-Request-Timestamp"
+	// SlackRetryHeader is set when Slack redelivers an event it considers
+	// unacknowledged.
+	SlackRetryHeader = "X-Slack-Retry-Num"
+)
+
+// slackMention matches user mentions such as <@U012AB3CD>.
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// Slack is a Slack app bot.
+type Slack struct {
+	apiURL     string
+	token      string
+	httpClient *http.Client
+}
+
+// NewSlack creates a bot calling the Web API at apiURL, SlackAPIURL when
+// empty, with a bot token (xoxb-...).
+func NewSlack(apiURL, token string, httpClient *http.Client) *Slack {
+	if apiURL == "" {
+		apiURL = SlackAPIURL
+	}
+	return &Slack{apiURL: strings.TrimRight(apiURL, "/"), token: token, httpClient: httpClient}
+}
+
+// Provider implements Bot.
+func (s *Slack) Provider() string {
+	return constant.ChatBotProviderSlack
+}
+
+// MessageLimit implements Bot.
+func (s *Slack) MessageLimit() int {
+	return slackMessageLimit
+}
+
+// SendMessage implements Bot. threadID is the ts of the thread root.
+func (s *Slack) SendMessage(ctx context.Context, chatID, threadID, text string) (string, error) {
+	payload := map[string]any{"channel": chatID, "text": text}
+	if threadID != "" {
+		payload["thread_ts"] = threadID
+	}
+	var response struct {
+		TS string `json:"ts"`
+	}
+	if err := s.call(ctx, "chat.postMessage", payload, &response); err != nil {
+		return "", err
+	}
+	return response.TS, nil
+}
+
+// EditMessage implements Bot.
+func (s *Slack) EditMessage(ctx context.Context, chatID, messageID, text string) error {
+	return s.call(ctx, "chat.update", map[string]any{"channel": chatID, "ts": messageID, "text": text}, nil)
+}
+
+// DownloadFile implements Bot. The bot token is only sent to Slack hosts.
+func (s *Slack) DownloadFile(ctx context.Context, file File, maxSize int64) ([]byte, error) {
+	if file.Size > maxSize {
+		return nil, ErrFileTooLarge
+	}
+	if !s.trustedFileHost(file.URL) {
+		return nil, fmt.Errorf("refusing to download slack file from %q", file.URL)
+	}
+	return download(ctx, s.httpClient, file.URL, map[string]string{"Authorization": "Bearer " + s.token}, maxSize)
+}
+
+// trustedFileHost reports whether target is served by Slack, or by the
+// configured API host.
+func (s *Slack) trustedFileHost(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if api, err := url.Parse(s.apiURL); err == nil && u.Host == api.Host {
+		return true
+	}
+	host := u.Hostname()
+	return u.Scheme == "https" && (host == "slack.com" || strings.HasSuffix(host, ".slack.com"))
+}
+
+func (s *Slack) call(ctx context.Context, method string, payload, out any) error {
+	headers := map[string]string{"Authorization": "Bearer " + s.token}
+	return postJSON(ctx, s.httpClient, s.apiURL+"/"+method, headers, payload, "error", out)
+}
+
+// VerifySlackRequest checks the v0 signature of an Events API request: the
+// HMAC-SHA256 of "v0:<timestamp>:<body>" keyed with the signing secret.
+func VerifySlackRequest(signingSecret string, header http.Header, body []byte, now time.Time) error {
+	if signingSecret == "" {
+		return errors.New("slack signing secret is not configured")
+	}
+	timestamp := header.Get(SlackTimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid slack request timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return errors.New("stale slack request")
+	}
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(header.Get(SlackSignatureHeader)), []byte(want)) {
+		return errors.New("invalid slack signature")
+	}
+	return nil
+}
+
+type slackRequest struct {
+	Type      string      `json:"type"`
+	Challenge string      `json:"challenge"`
+	Event     *slackEvent `json:"event"`
+}
+
+type slackEvent struct {
+	Type        string      `json:"type"`
+	Subtype     string      `json:"subtype"`
+	Channel     string      `json:"channel"`
+	ChannelType string      `json:"channel_type"`
+	User        string      `json:"user"`
+	BotID       string      `json:"bot_id"`
+	Text        string      `json:"text"`
+	TS          string      `json:"ts"`
+	ThreadTS    string      `json:"thread_ts"`
+	Files       []slackFile `json:"files"`
+}
+
+type slackFile struct {
+	Name               string `json:"name"`
+	MimeType           string `json:"mimetype"`
+	Size               int64  `json:"size"`
+	URLPrivateDownload string `json:"url_private_download"`
+}
+
+// ParseSlackEvent decodes an Events API request. url_verification requests
+// return their challenge. The bot answers direct messages and mentions in
+// channels; other events, including the bot's own messages, return nil.
+func ParseSlackEvent(body []byte) (*Message, string, error) {
+	var request slackRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, "", fmt.Errorf("invalid slack event: %w", err)
+	}
+	if request.Type == "url_verification" {
+		return nil, request.Challenge, nil
+	}
+	e := request.Event
+	if request.Type != "event_callback" || e == nil || e.User == "" || e.BotID != "" ||
+		(e.Subtype != "" && e.Subtype != "file_share") {
+		return nil, "", nil
+	}
+
+	msg := &Message{
+		Provider: constant.ChatBotProviderSlack,
+		ChatID:   e.Channel,
+		ThreadID: e.ThreadTS,
+		SenderID: e.User,
+		Text:     strings.TrimSpace(unescapeSlackText(slackMention.ReplaceAllString(e.Text, ""))),
+	}
+	switch {
+	case e.Type == "message" && e.ChannelType == "im":
+		msg.ReplyThreadID = e.ThreadTS
+	case e.Type == "app_mention":
+		// A mention outside a thread starts one, so every mention gets its
+		// own conversation.
+		msg.ReplyThreadID = cmp.Or(e.ThreadTS, e.TS)
+		msg.ThreadID = msg.ReplyThreadID
+	default:
+		return nil, "", nil
+	}
+	for _, f := range e.Files {
+		msg.Files = append(msg.Files, File{URL: f.URLPrivateDownload, Name: f.Name, MimeType: f.MimeType, Size: f.Size})
+	}
+	return msg, "", nil
+}
+
+// unescapeSlackText reverts the escaping Slack applies to message text.
+func unescapeSlackText(text string) string {
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
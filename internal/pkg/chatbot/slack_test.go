@@ -0,0 +1,122 @@
+package chatbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackBot(t *testing.T) {
+	calls := map[string]map[string]any{}
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.URL.Path == "/files/report.pdf" {
+			w.Write([]byte("%PDF-1.4"))
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		calls[strings.TrimPrefix(r.URL.Path, "/api/")] = body
+		if body["channel"] == "C404" {
+			w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"ts":"1700000000.000200"}`))
+	}))
+	defer server.Close()
+	bot := NewSlack(server.URL+"/api", "xoxb-token", nil)
+	ctx := context.Background()
+
+	ts, err := bot.SendMessage(ctx, "D1", "1700000000.000100", "hello")
+	if err != nil || ts != "1700000000.000200" {
+		t.Fatalf("SendMessage() = %q, %v", ts, err)
+	}
+	if calls["chat.postMessage"]["thread_ts"] != "1700000000.000100" || authorizations[0] != "Bearer xoxb-token" {
+		t.Fatalf("chat.postMessage body = %v, authorization = %q", calls["chat.postMessage"], authorizations[0])
+	}
+	if err := bot.EditMessage(ctx, "D1", ts, "done"); err != nil || calls["chat.update"]["ts"] != ts {
+		t.Fatalf("EditMessage() error = %v, body = %v", err, calls["chat.update"])
+	}
+	if _, err := bot.SendMessage(ctx, "C404", "", "hello"); err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Fatalf("SendMessage() error = %v, want channel_not_found", err)
+	}
+
+	data, err := bot.DownloadFile(ctx, File{URL: server.URL + "/files/report.pdf"}, 1024)
+	if err != nil || string(data) != "%PDF-1.4" {
+		t.Fatalf("DownloadFile() = %q, %v", data, err)
+	}
+	if _, err := bot.DownloadFile(ctx, File{URL: "https://attacker.example/steal"}, 1024); err == nil {
+		t.Fatal("DownloadFile() expected error for a host other than Slack")
+	}
+}
+
+func TestVerifySlackRequest(t *testing.T) {
+	body := []byte(`{"type":"event_callback"}`)
+	now := time.Unix(1700000000, 0)
+	sign := func(timestamp string) http.Header {
+		mac := hmac.New(sha256.New, []byte("signing"))
+		mac.Write([]byte("v0:" + timestamp + ":"))
+		mac.Write(body)
+		header := http.Header{}
+		header.Set(SlackTimestampHeader, timestamp)
+		header.Set(SlackSignatureHeader, "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return header
+	}
+
+	header := sign(strconv.FormatInt(now.Unix(), 10))
+	if err := VerifySlackRequest("signing", header, body, now); err != nil {
+		t.Fatalf("VerifySlackRequest() error = %v", err)
+	}
+	if err := VerifySlackRequest("other", header, body, now); err == nil {
+		t.Fatal("VerifySlackRequest() expected error for a wrong secret")
+	}
+	if err := VerifySlackRequest("signing", header, []byte(`{}`), now); err == nil {
+		t.Fatal("VerifySlackRequest() expected error for a modified body")
+	}
+	stale := sign(strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10))
+	if err := VerifySlackRequest("signing", stale, body, now); err == nil {
+		t.Fatal("VerifySlackRequest() expected error for a stale request")
+	}
+}
+
+func TestParseSlackEvent(t *testing.T) {
+	if msg, challenge, err := ParseSlackEvent([]byte(`{"type":"url_verification","challenge":"abc"}`)); err != nil || msg != nil || challenge != "abc" {
+		t.Fatalf("url_verification = %+v, %q, %v", msg, challenge, err)
+	}
+
+	mention := `{"type":"event_callback","event":{"type":"app_mention","channel":"C1","user":"U1",
+		"text":"<@UBOT> compare &lt;a&gt; &amp; b","ts":"1.1","files":[{"name":"a.pdf","mimetype":"application/pdf","size":9,"url_private_download":"https://files.slack.com/a.pdf"}]}}`
+	msg, _, err := ParseSlackEvent([]byte(mention))
+	if err != nil || msg == nil {
+		t.Fatalf("ParseSlackEvent() = %+v, %v", msg, err)
+	}
+	if msg.ChatID != "C1" || msg.ThreadID != "1.1" || msg.ReplyThreadID != "1.1" || msg.Text != "compare <a> & b" ||
+		len(msg.Files) != 1 || msg.Files[0].URL != "https://files.slack.com/a.pdf" {
+		t.Fatalf("mention = %+v", msg)
+	}
+
+	direct := `{"type":"event_callback","event":{"type":"message","channel_type":"im","channel":"D1","user":"U1","text":"hi","ts":"2.2"}}`
+	msg, _, err = ParseSlackEvent([]byte(direct))
+	if err != nil || msg == nil || msg.ThreadID != "" || msg.ReplyThreadID != "" || msg.Text != "hi" {
+		t.Fatalf("direct message = %+v, %v", msg, err)
+	}
+
+	for _, ignored := range []string{
+		`{"type":"event_callback","event":{"type":"message","channel_type":"im","channel":"D1","bot_id":"B1","text":"echo","ts":"3.3"}}`,
+		`{"type":"event_callback","event":{"type":"message","channel_type":"channel","channel":"C1","user":"U1","text":"chatter","ts":"4.4"}}`,
+		`{"type":"event_callback","event":{"type":"message","subtype":"message_changed","channel_type":"im","channel":"D1","user":"U1","ts":"5.5"}}`,
+	} {
+		if msg, _, err := ParseSlackEvent([]byte(ignored)); err != nil || msg != nil {
+			t.Fatalf("ParseSlackEvent(%s) = %+v, %v, want nil", ignored, msg, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package chatbot
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"aiguide/internal/pkg/constant"
+)
+
+// TelegramAPIURL is the endpoint of the Telegram Bot API.
+const TelegramAPIURL = "https://api.telegram.org"
+
+// TelegramSecretHeader carries the secret_token registered with setWebhook
+// on every webhook call.
+const TelegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// telegramMessageLimit is the Telegram limit of 4096 characters per message,
+// with some headroom.
+const telegramMessageLimit = 4000
+
+// Telegram is a Telegram bot.
+type Telegram struct {
+	apiURL     string
+	token      string
+	httpClient *http.Client
+}
+
+// NewTelegram creates a bot calling the Bot API at apiURL, TelegramAPIURL
+// when empty.
+func NewTelegram(apiURL, token string, httpClient *http.Client) *Telegram {
+	if apiURL == "" {
+		apiURL = TelegramAPIURL
+	}
+	return &Telegram{apiURL: strings.TrimRight(apiURL, "/"), token: token, httpClient: httpClient}
+}
+
+// Provider implements Bot.
+func (t *Telegram) Provider() string {
+	return constant.ChatBotProviderTelegram
+}
+
+// MessageLimit implements Bot.
+func (t *Telegram) MessageLimit() int {
+	return telegramMessageLimit
+}
+
+// SendMessage implements Bot. threadID is a forum topic id.
+func (t *Telegram) SendMessage(ctx context.Context, chatID, threadID, text string) (string, error) {
+	payload := map[string]any{"chat_id": chatID, "text": text}
+	if threadID != "" {
+		topic, err := strconv.Atoi(threadID)
+		if err != nil {
+			return "", fmt.Errorf("invalid telegram topic id: %s", threadID)
+		}
+		payload["message_thread_id"] = topic
+	}
+	var response struct {
+		Result struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"result"`
+	}
+	if err := t.call(ctx, "sendMessage", payload, &response); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(response.Result.MessageID, 10), nil
+}
+
+// EditMessage implements Bot.
+func (t *Telegram) EditMessage(ctx context.Context, chatID, messageID, text string) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid telegram message id: %s", messageID)
+	}
+	err = t.call(ctx, "editMessageText", map[string]any{"chat_id": chatID, "message_id": id, "text": text}, nil)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// DownloadFile implements Bot. Files are resolved with getFile; the Bot API
+// serves files of up to 20 MB.
+func (t *Telegram) DownloadFile(ctx context.Context, file File, maxSize int64) ([]byte, error) {
+	if file.Size > maxSize {
+		return nil, ErrFileTooLarge
+	}
+	var response struct {
+		Result struct {
+			FilePath string `json:"file_path"`
+		} `json:"result"`
+	}
+	if err := t.call(ctx, "getFile", map[string]any{"file_id": file.ID}, &response); err != nil {
+		return nil, err
+	}
+	if response.Result.FilePath == "" {
+		return nil, errors.New("telegram did not return a file path")
+	}
+	target := fmt.Sprintf("%s/file/bot%s/%s", t.apiURL, t.token, strings.TrimLeft(response.Result.FilePath, "/"))
+	return download(ctx, t.httpClient, target, nil, maxSize)
+}
+
+// SetWebhook registers webhookURL for updates. Telegram sends secret in the
+// TelegramSecretHeader of every call.
+func (t *Telegram) SetWebhook(ctx context.Context, webhookURL, secret string) error {
+	return t.call(ctx, "setWebhook", map[string]any{
+		"url":             webhookURL,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message"},
+	}, nil)
+}
+
+func (t *Telegram) call(ctx context.Context, method string, payload, out any) error {
+	target := fmt.Sprintf("%s/bot%s/%s", t.apiURL, t.token, method)
+	return postJSON(ctx, t.httpClient, target, nil, payload, "description", out)
+}
+
+// VerifyTelegramRequest checks the secret token of a webhook call.
+func VerifyTelegramRequest(secret string, header http.Header) error {
+	got := header.Get(TelegramSecretHeader)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+		return errors.New("invalid telegram secret token")
+	}
+	return nil
+}
+
+type telegramUpdate struct {
+	Message *telegramMessage `json:"message"`
+}
+
+type telegramMessage struct {
+	MessageThreadID int64 `json:"message_thread_id"`
+	IsTopicMessage  bool  `json:"is_topic_message"`
+	From            *struct {
+		ID        int64  `json:"id"`
+		IsBot     bool   `json:"is_bot"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Username  string `json:"username"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text     string          `json:"text"`
+	Caption  string          `json:"caption"`
+	Document *telegramFile   `json:"document"`
+	Audio    *telegramFile   `json:"audio"`
+	Voice    *telegramFile   `json:"voice"`
+	Photo    []telegramPhoto `json:"photo"`
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int64  `json:"file_size"`
+}
+
+type telegramPhoto struct {
+	FileID   string `json:"file_id"`
+	FileSize int64  `json:"file_size"`
+}
+
+// ParseTelegramUpdate decodes a webhook update. It returns nil for updates
+// that carry no message from a user, such as edits or bot messages.
+func ParseTelegramUpdate(body []byte) (*Message, error) {
+	var update telegramUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, fmt.Errorf("invalid telegram update: %w", err)
+	}
+	m := update.Message
+	if m == nil || m.From == nil || m.From.IsBot {
+		return nil, nil
+	}
+
+	msg := &Message{
+		Provider:   constant.ChatBotProviderTelegram,
+		ChatID:     strconv.FormatInt(m.Chat.ID, 10),
+		SenderID:   strconv.FormatInt(m.From.ID, 10),
+		SenderName: cmp.Or(m.From.Username, strings.TrimSpace(m.From.FirstName+" "+m.From.LastName)),
+		Text:       strings.TrimSpace(m.Text + m.Caption),
+	}
+	if m.IsTopicMessage && m.MessageThreadID != 0 {
+		msg.ThreadID = strconv.FormatInt(m.MessageThreadID, 10)
+	}
+	msg.ReplyThreadID = msg.ThreadID
+
+	for _, f := range []*telegramFile{m.Document, m.Audio, m.Voice} {
+		if f == nil {
+			continue
+		}
+		name := f.FileName
+		if name == "" {
+			name = "voice" + extensionFor(f.MimeType)
+		}
+		msg.Files = append(msg.Files, File{ID: f.FileID, Name: name, MimeType: f.MimeType, Size: f.FileSize})
+	}
+	// Photos come in several sizes, the largest last.
+	if len(m.Photo) > 0 {
+		photo := m.Photo[len(m.Photo)-1]
+		msg.Files = append(msg.Files, File{ID: photo.FileID, Name: "photo.jpg", MimeType: "image/jpeg", Size: photo.FileSize})
+	}
+	return msg, nil
+}
+
+// extensionFor returns the file extension for the audio types of voice
+// messages, which have no file name.
+func extensionFor(mimeType string) string {
+	switch mimeType {
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4":
+		return ".m4a"
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeTelegram serves the Bot API methods used by the bot and records
+// the decoded request bodies by method.
+func newFakeTelegram(t *testing.T) (*httptest.Server, map[string]map[string]any) {
+	t.Helper()
+	calls := map[string]map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file/bottoken/voice/file_1.ogg" {
+			w.Write([]byte("OggS audio"))
+			return
+		}
+		method, ok := strings.CutPrefix(r.URL.Path, "/bottoken/")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"ok":false,"description":"Not Found"}`))
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		calls[method] = body
+		switch method {
+		case "sendMessage":
+			w.Write([]byte(`{"ok":true,"result":{"message_id":17}}`))
+		case "editMessageText":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: message is not modified"}`))
+		case "getFile":
+			w.Write([]byte(`{"ok":true,"result":{"file_path":"voice/file_1.ogg"}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func TestTelegramBot(t *testing.T) {
+	server, calls := newFakeTelegram(t)
+	bot := NewTelegram(server.URL, "token", nil)
+	ctx := context.Background()
+
+	id, err := bot.SendMessage(ctx, "42", "7", "hello")
+	if err != nil || id != "17" {
+		t.Fatalf("SendMessage() = %q, %v", id, err)
+	}
+	if calls["sendMessage"]["chat_id"] != "42" || calls["sendMessage"]["message_thread_id"] != float64(7) {
+		t.Fatalf("sendMessage body = %v", calls["sendMessage"])
+	}
+	if err := bot.EditMessage(ctx, "42", id, "hello"); err != nil {
+		t.Fatalf("EditMessage() of an unchanged message error = %v", err)
+	}
+
+	data, err := bot.DownloadFile(ctx, File{ID: "f1", Size: 10}, 100)
+	if err != nil || string(data) != "OggS audio" {
+		t.Fatalf("DownloadFile() = %q, %v", data, err)
+	}
+	if _, err := bot.DownloadFile(ctx, File{ID: "f1"}, 4); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("DownloadFile() beyond the limit error = %v, want ErrFileTooLarge", err)
+	}
+
+	err = bot.SetWebhook(ctx, "https://example.com/hook", "secret")
+	if err == nil || !strings.Contains(err.Error(), "chat not found") || strings.Contains(err.Error(), "token") {
+		t.Fatalf("SetWebhook() error = %v, want the api description without the token", err)
+	}
+}
+
+func TestParseTelegramUpdate(t *testing.T) {
+	body := `{"update_id":1,"message":{"message_id":5,"message_thread_id":9,"is_topic_message":true,
+		"from":{"id":1001,"is_bot":false,"first_name":"Ada","username":"ada"},
+		"chat":{"id":-200,"type":"supergroup"},"caption":" summarize ",
+		"voice":{"file_id":"v1","mime_type":"audio/ogg","file_size":2048},
+		"photo":[{"file_id":"small","file_size":10},{"file_id":"large","file_size":100}]}}`
+	msg, err := ParseTelegramUpdate([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseTelegramUpdate() error = %v", err)
+	}
+	if msg.ChatID != "-200" || msg.ThreadID != "9" || msg.ReplyThreadID != "9" || msg.SenderID != "1001" ||
+		msg.SenderName != "ada" || msg.Text != "summarize" {
+		t.Fatalf("message = %+v", msg)
+	}
+	if len(msg.Files) != 2 || msg.Files[0].Name != "voice.ogg" || msg.Files[0].MimeType != "audio/ogg" || msg.Files[1].ID != "large" {
+		t.Fatalf("files = %+v", msg.Files)
+	}
+
+	for _, ignored := range []string{
+		`{"update_id":2,"edited_message":{"text":"x"}}`,
+		`{"update_id":3,"message":{"from":{"id":1,"is_bot":true},"chat":{"id":1},"text":"x"}}`,
+	} {
+		if msg, err := ParseTelegramUpdate([]byte(ignored)); err != nil || msg != nil {
+			t.Fatalf("ParseTelegramUpdate(%s) = %+v, %v, want nil", ignored, msg, err)
+		}
+	}
+}
+
+func TestVerifyTelegramRequest(t *testing.T) {
+	header := http.Header{}
+	header.Set(TelegramSecretHeader, "s3cret")
+	if err := VerifyTelegramRequest("s3cret", header); err != nil {
+		t.Fatalf("VerifyTelegramRequest() error = %v", err)
+	}
+	if err := VerifyTelegramRequest("other", header); err == nil {
+		t.Fatal("VerifyTelegramRequest() expected error for a wrong secret")
+	}
+	if err := VerifyTelegramRequest("", http.Header{}); err == nil {
+		t.Fatal("VerifyTelegramRequest() expected error without a configured secret")
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	if got := SplitMessage("", 10); len(got) != 1 || got[0] != "" {
+		t.Fatalf("SplitMessage(empty) = %q", got)
+	}
+	got := SplitMessage("line one\nline two\nline three", 12)
+	if strings.Join(got, "") != "line one\nline two\nline three" || len(got) != 3 || got[0] != "line one\n" {
+		t.Fatalf("SplitMessage() = %q", got)
+	}
+	for _, chunk := range SplitMessage(strings.Repeat("长", 25), 10) {
+		if len([]rune(chunk)) > 10 {
+			t.Fatalf("chunk %q exceeds the limit", chunk)
+		}
+	}
+}
@@ -8,6 +8,9 @@ const (
 	ContextKeyGoogleUserID    string = "google_user_id"
 	ContextKeyGoogleUserEmail string = "google_user_email"
 	ContextKeyUserName        string = "user_name"
+	ContextKeyResearchProfile string = "research_profile"
+	ContextKeyAPITokenScopes  string = "api_token_scopes"
+	ContextKeyUserRole        string = "user_role"
 )
 
 const (
@@ -24,6 +27,7 @@ func (a AppName) String() string {
 const (
 	AppNameAssistant AppName = "assistant"
 	AppNameScheduler AppName = "scheduler"
+	AppNamePlanner   AppName = "planner"
 )
 
 // TaskStatus 任务状态类型
@@ -120,6 +124,63 @@ func (a MemoryAction) String() string {
 	return string(a)
 }
 
+// APITokenScope API 令牌的权限范围
+type APITokenScope string
+
+const (
+	APITokenScopeChat           APITokenScope = "chat"            // 对话、会话、项目、MCP 与 OpenAI 兼容接口
+	APITokenScopeFiles          APITokenScope = "files"           // 文件下载
+	APITokenScopeMemories       APITokenScope = "memories"        // 用户记忆
+	APITokenScopeScheduledTasks APITokenScope = "scheduled_tasks" // 定时任务与事件触发器
+	APITokenScopeAdmin          APITokenScope = "admin"           // 全部接口，包括设置与令牌管理
+)
+
+// APITokenScopes 全部 API 令牌权限范围
+var APITokenScopes = []APITokenScope{
+	APITokenScopeChat,
+	APITokenScopeFiles,
+	APITokenScopeMemories,
+	APITokenScopeScheduledTasks,
+	APITokenScopeAdmin,
+}
+
+// Valid 检查权限范围是否有效
+func (s APITokenScope) Valid() bool {
+	switch s {
+	case APITokenScopeChat, APITokenScopeFiles, APITokenScopeMemories, APITokenScopeScheduledTasks, APITokenScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// String 返回权限范围的字符串表示
+func (s APITokenScope) String() string {
+	return string(s)
+}
+
+// UserRole 用户角色
+type UserRole string
+
+const (
+	UserRoleAdmin    UserRole = "admin"     // 管理员：管理用户、允许登录的邮箱与邀请码
+	UserRoleMember   UserRole = "member"    // 普通成员
+	UserRoleReadOnly UserRole = "read_only" // 只读成员：只能查看已有数据，不能发起对话或修改数据
+)
+
+// Valid 检查角色是否有效
+func (r UserRole) Valid() bool {
+	switch r {
+	case UserRoleAdmin, UserRoleMember, UserRoleReadOnly:
+		return true
+	}
+	return false
+}
+
+// String 返回角色的字符串表示
+func (r UserRole) String() string {
+	return string(r)
+}
+
 // FileAssetKind 文件资产类型
 type FileAssetKind string
 
@@ -186,6 +247,62 @@ func (s PDFJobStatus) String() string {
 	return string(s)
 }
 
+// ScheduledRunStatus 定时任务单次执行状态
+type ScheduledRunStatus string
+
+const (
+	ScheduledRunStatusRunning   ScheduledRunStatus = "running"
+	ScheduledRunStatusSucceeded ScheduledRunStatus = "succeeded"
+	ScheduledRunStatusFailed    ScheduledRunStatus = "failed"
+	ScheduledRunStatusSkipped   ScheduledRunStatus = "skipped" // 时段落在停用日期或已错过且策略为跳过，未执行
+)
+
+// ScheduledRunTrigger 定时任务执行的触发方式
+type ScheduledRunTrigger string
+
+const (
+	ScheduledRunTriggerSchedule ScheduledRunTrigger = "schedule"
+	ScheduledRunTriggerManual   ScheduledRunTrigger = "manual"
+)
+
+// DeliveryChannel 定时任务执行结果的投递渠道
+type DeliveryChannel string
+
+const (
+	DeliveryChannelEmail   DeliveryChannel = "email"
+	DeliveryChannelWebhook DeliveryChannel = "webhook"
+	DeliveryChannelInApp   DeliveryChannel = "in_app"
+	DeliveryChannelChatBot DeliveryChannel = "chat_bot"
+	// DeliveryChannelWebPush 仅推送到用户已订阅的浏览器，不写入站内通知
+	DeliveryChannelWebPush DeliveryChannel = "web_push"
+)
+
+// 聊天机器人投递渠道支持的平台
+const (
+	ChatBotProviderTelegram = "telegram"
+	ChatBotProviderSlack    = "slack"
+)
+
+// EventTriggerKind 事件触发器类型
+type EventTriggerKind string
+
+const (
+	EventTriggerKindEmail   EventTriggerKind = "email"
+	EventTriggerKindWebPage EventTriggerKind = "web_page"
+	EventTriggerKindFeed    EventTriggerKind = "feed"
+	EventTriggerKindWebhook EventTriggerKind = "webhook" // 由外部系统调用入站 Webhook 触发，不轮询
+)
+
+// NotificationKind 站内通知类型
+type NotificationKind string
+
+const (
+	NotificationKindScheduledTaskRun   NotificationKind = "scheduled_task_run"
+	NotificationKindEventTriggerRun    NotificationKind = "event_trigger_run"   // 事件触发器或 Webhook 的后台运行结束
+	NotificationKindAudioTranscription NotificationKind = "audio_transcription" // 分段转写的长音频完成或失败
+	NotificationKindVideoGeneration    NotificationKind = "video_generation"    // 视频生成完成或失败
+)
+
 // AudioJobStatus audio transcription job status.
 type AudioJobStatus string
 
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiTokenTouchInterval 限制 last_used_at 的写入频率，避免每个请求都写数据库
+const apiTokenTouchInterval = time.Minute
+
+// errInvalidAPIToken 表示令牌不存在、已撤销或已过期
+var errInvalidAPIToken = errors.New("invalid api token")
+
+// verifyAPIToken 校验 API 令牌未被撤销且未过期，并记录最近使用时间
+func verifyAPIToken(ctx context.Context, db *gorm.DB, token string) (*table.APIToken, error) {
+	var apiToken table.APIToken
+	if err := db.WithContext(ctx).Where("token_hash = ?", auth.HashAPIToken(token)).Limit(1).Find(&apiToken).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up api token: %w", err)
+	}
+	now := time.Now()
+	if apiToken.ID == 0 || apiToken.RevokedAt != nil || (apiToken.ExpiresAt != nil && !apiToken.ExpiresAt.After(now)) {
+		return nil, errInvalidAPIToken
+	}
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= apiTokenTouchInterval {
+		// UpdateColumn 不修改 updated_at，最近使用不算作令牌被修改
+		if err := db.WithContext(ctx).Model(&apiToken).UpdateColumn("last_used_at", now).Error; err != nil {
+			slog.Warn("failed to update api token last used time", "err", err, "token_id", apiToken.ID)
+		}
+	}
+	return &apiToken, nil
+}
+
+// APITokenAuth 仅接受 API 令牌（Authorization: Bearer aig_...）的认证中间件
+// 用于 OpenAI 兼容接口，错误响应使用 OpenAI 的错误格式，便于其客户端展示
+func APITokenAuth(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		token = strings.TrimSpace(token)
+		if !ok || !auth.IsAPIToken(token) {
+			abortInvalidAPIKey(c, "missing api token: pass an AIGuide API token as a Bearer token")
+			return
+		}
+
+		apiToken, err := verifyAPIToken(c, db, token)
+		if errors.Is(err, errInvalidAPIToken) {
+			abortInvalidAPIKey(c, "invalid api token")
+			return
+		}
+		if err != nil {
+			slog.Error("failed to verify api token", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": "failed to verify api token", "type": "server_error"}})
+			c.Abort()
+			return
+		}
+
+		role, err := activeUserRole(c, db, apiToken.UserID)
+		if errors.Is(err, errUserInactive) {
+			abortInvalidAPIKey(c, "account is disabled")
+			return
+		}
+		if err != nil {
+			slog.Error("failed to verify api token user", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{"message": "failed to verify api token", "type": "server_error"}})
+			c.Abort()
+			return
+		}
+
+		c.Set(constant.ContextKeyUserID, apiToken.UserID)
+		c.Set(constant.ContextKeyUserRole, role)
+		c.Set(constant.ContextKeyAPITokenScopes, auth.ParseAPITokenScopes(apiToken.Scopes))
+		c.Set(constant.ContextKeyTx, db)
+		c.Next()
+	}
+}
+
+func abortInvalidAPIKey(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": gin.H{
+		"message": message,
+		"type":    "invalid_request_error",
+		"code":    "invalid_api_key",
+	}})
+	c.Abort()
+}
+
+// RequireScope 要求 API 令牌具有指定的权限范围，admin 权限可访问全部接口
+// 通过 JWT（网页登录）认证的请求不受限制
+func RequireScope(scope constant.APITokenScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(constant.ContextKeyAPITokenScopes)
+		if !ok {
+			c.Next()
+			return
+		}
+		scopes, _ := value.([]constant.APITokenScope)
+		if !auth.HasAPITokenScope(scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("api token lacks the %s scope", scope)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAPITokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	apiToken, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken() error = %v", err)
+	}
+	record := table.APIToken{UserID: 3, Name: "cli", TokenHash: hash, Prefix: apiToken[:8]}
+	if err := db.Create(&record).Error; err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	revokedToken := createTestAPIToken(t, db, table.APIToken{RevokedAt: &past})
+	expiredToken := createTestAPIToken(t, db, table.APIToken{ExpiresAt: &past})
+
+	router := gin.New()
+	router.Use(APITokenAuth(db))
+	router.GET("/v1/models", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt(constant.ContextKeyUserID)})
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantBody      string
+	}{
+		{"api token", "Bearer " + apiToken, http.StatusOK, `"user_id":3`},
+		{"missing", "", http.StatusUnauthorized, `"code":"invalid_api_key"`},
+		{"unknown api token", "Bearer " + auth.APITokenPrefix + "unknown", http.StatusUnauthorized, `"invalid api token"`},
+		{"revoked api token", "Bearer " + revokedToken, http.StatusUnauthorized, `"invalid api token"`},
+		{"expired api token", "Bearer " + expiredToken, http.StatusUnauthorized, `"invalid api token"`},
+		{"jwt", "Bearer eyJhbGciOiJIUzI1NiJ9.e30.sig", http.StatusUnauthorized, `"code":"invalid_api_key"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			if resp.Code != tt.wantStatus || !strings.Contains(resp.Body.String(), tt.wantBody) {
+				t.Fatalf("status = %d, body = %s; want %d containing %s", resp.Code, resp.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	if err := db.First(&record, record.ID).Error; err != nil || record.LastUsedAt == nil {
+		t.Fatalf("last_used_at = %v, %v; want it recorded", record.LastUsedAt, err)
+	}
+}
+
+// newTestDB returns an in-memory database with the users 3 and 5 that own
+// the test tokens.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&table.APIToken{}, &table.User{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	for _, id := range []int{3, 5} {
+		if err := db.Create(&table.User{Model: table.Model{ID: id}, Role: constant.UserRoleMember}).Error; err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	return db
+}
+
+// createTestAPIToken stores a token with the fields of base and returns the
+// plaintext token.
+func createTestAPIToken(t *testing.T, db *gorm.DB, base table.APIToken) string {
+	t.Helper()
+	token, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken() error = %v", err)
+	}
+	base.TokenHash, base.Prefix = hash, token[:8]
+	if base.UserID == 0 {
+		base.UserID = 3
+	}
+	if err := db.Create(&base).Error; err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+	return token
+}
+
+func TestAuthScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	authService := auth.NewAuthService(&auth.Config{JWTSecret: "test-secret"})
+	jwtToken, err := authService.GenerateAccessToken(5, &auth.GoogleUser{ID: "g5", Email: "u5@example.com"})
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	memoriesToken := createTestAPIToken(t, db, table.APIToken{Scopes: `["memories"]`})
+	adminToken := createTestAPIToken(t, db, table.APIToken{Scopes: `["admin"]`})
+	legacyToken := createTestAPIToken(t, db, table.APIToken{})
+
+	router := gin.New()
+	router.Use(Auth(db, authService))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/memories", RequireScope(constant.APITokenScopeMemories), ok)
+	router.GET("/chat", RequireScope(constant.APITokenScopeChat), ok)
+
+	tests := []struct {
+		token      string
+		path       string
+		wantStatus int
+	}{
+		{jwtToken, "/memories", http.StatusNoContent},
+		{memoriesToken, "/memories", http.StatusNoContent},
+		{memoriesToken, "/chat", http.StatusForbidden},
+		{adminToken, "/chat", http.StatusNoContent},
+		{legacyToken, "/chat", http.StatusNoContent},
+		{legacyToken, "/memories", http.StatusForbidden},
+		{auth.APITokenPrefix + "unknown", "/chat", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != tt.wantStatus {
+			t.Fatalf("GET %s with %.12s: status = %d, want %d", tt.path, tt.token, resp.Code, tt.wantStatus)
+		}
+	}
+}
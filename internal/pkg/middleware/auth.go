@@ -3,6 +3,8 @@ package middleware
 import (
 	"aiguide/internal/pkg/auth"
 	"aiguide/internal/pkg/constant"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -10,7 +12,8 @@ import (
 	"gorm.io/gorm"
 )
 
-// AuthMiddleware 认证中间件
+// Auth 认证中间件，接受网页登录的 JWT（Cookie 或 Authorization 头）
+// 以及 Authorization 头中的 API 令牌
 func Auth(db *gorm.DB, authService *auth.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从 Cookie 或 Authorization 头获取 token
@@ -29,6 +32,30 @@ func Auth(db *gorm.DB, authService *auth.AuthService) gin.HandlerFunc {
 			return
 		}
 
+		// API 令牌：记录权限范围，由 RequireScope 按路由校验
+		if auth.IsAPIToken(token) {
+			apiToken, err := verifyAPIToken(c, db, token)
+			if errors.Is(err, errInvalidAPIToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				slog.Error("failed to verify api token", "err", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify token"})
+				c.Abort()
+				return
+			}
+			if !setUserRole(c, db, apiToken.UserID) {
+				return
+			}
+			c.Set(constant.ContextKeyUserID, apiToken.UserID)
+			c.Set(constant.ContextKeyAPITokenScopes, auth.ParseAPITokenScopes(apiToken.Scopes))
+			c.Set(constant.ContextKeyTx, db)
+			c.Next()
+			return
+		}
+
 		// 验证 token
 		claims, err := authService.ValidateJWT(token)
 		if err != nil {
@@ -37,6 +64,11 @@ func Auth(db *gorm.DB, authService *auth.AuthService) gin.HandlerFunc {
 			return
 		}
 
+		// 用户被禁用或删除后，未过期的访问令牌同样失效
+		if !setUserRole(c, db, claims.UserID) {
+			return
+		}
+
 		// 将用户信息存储到上下文中
 		c.Set(constant.ContextKeyUserID, claims.UserID)             // Internal database user ID
 		c.Set(constant.ContextKeyGoogleUserID, claims.GoogleUserID) // Google user ID
@@ -58,3 +58,10 @@ func GetLocale(ctx context.Context) string {
 
 	return locale
 }
+
+// GetUserRole 从上下文中获取用户角色
+func GetUserRole(ctx context.Context) (constant.UserRole, bool) {
+	role, ok := ctx.Value(constant.ContextKeyUserRole).(constant.UserRole)
+
+	return role, ok
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
+	"gorm.io/gorm"
+)
+
+// apiTokenVerificationTTL is the expiration reported to the MCP SDK for API
+// tokens without an expiry. The SDK rejects tokens without one; since every
+// request is verified again, a short window is enough.
+const apiTokenVerificationTTL = time.Hour
+
+// MCPTokenVerifier 校验 MCP 端点的 Bearer 令牌
+// 接受与 Auth 相同的 JWT 访问令牌，以及用户创建的 API 令牌
+func MCPTokenVerifier(db *gorm.DB, authService *auth.AuthService) mcpauth.TokenVerifier {
+	return func(ctx context.Context, token string, _ *http.Request) (*mcpauth.TokenInfo, error) {
+		if auth.IsAPIToken(token) {
+			apiToken, err := verifyAPIToken(ctx, db, token)
+			if errors.Is(err, errInvalidAPIToken) {
+				return nil, mcpauth.ErrInvalidToken
+			}
+			if err != nil {
+				return nil, err
+			}
+			// MCP 端点调用助手的工具，需要 chat 权限
+			if !auth.HasAPITokenScope(auth.ParseAPITokenScopes(apiToken.Scopes), constant.APITokenScopeChat) {
+				return nil, fmt.Errorf("%w: api token lacks the %s scope", mcpauth.ErrInvalidToken, constant.APITokenScopeChat)
+			}
+			if err := verifyMCPUser(ctx, db, apiToken.UserID); err != nil {
+				return nil, err
+			}
+			expiration := time.Now().Add(apiTokenVerificationTTL)
+			if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(expiration) {
+				expiration = *apiToken.ExpiresAt
+			}
+			return &mcpauth.TokenInfo{
+				UserID:     strconv.Itoa(apiToken.UserID),
+				Expiration: expiration,
+			}, nil
+		}
+
+		claims, err := authService.ValidateJWT(token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", mcpauth.ErrInvalidToken, err)
+		}
+		if err := verifyMCPUser(ctx, db, claims.UserID); err != nil {
+			return nil, err
+		}
+		info := &mcpauth.TokenInfo{UserID: strconv.Itoa(claims.UserID)}
+		if claims.ExpiresAt != nil {
+			info.Expiration = claims.ExpiresAt.Time
+		}
+		return info, nil
+	}
+}
+
+// verifyMCPUser 拒绝已禁用或删除的用户；MCP 工具可以修改数据，只读成员也不能使用
+func verifyMCPUser(ctx context.Context, db *gorm.DB, userID int) error {
+	role, err := activeUserRole(ctx, db, userID)
+	if errors.Is(err, errUserInactive) {
+		return fmt.Errorf("%w: %v", mcpauth.ErrInvalidToken, err)
+	}
+	if err != nil {
+		return err
+	}
+	if role == constant.UserRoleReadOnly {
+		return fmt.Errorf("%w: read-only accounts can't use mcp", mcpauth.ErrInvalidToken)
+	}
+	return nil
+}
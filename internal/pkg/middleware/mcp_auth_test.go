@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"context"
+	"errors"
+	"testing"
+
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+func TestMCPTokenVerifier(t *testing.T) {
+	db := newTestDB(t)
+
+	apiToken, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken() error = %v", err)
+	}
+	if err := db.Create(&table.APIToken{UserID: 3, Name: "cli", TokenHash: hash, Prefix: apiToken[:8]}).Error; err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+
+	authService := auth.NewAuthService(&auth.Config{JWTSecret: "test-secret"})
+	jwtToken, err := authService.GenerateAccessToken(5, &auth.GoogleUser{ID: "g5", Email: "u5@example.com"})
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+
+	verify := MCPTokenVerifier(db, authService)
+	ctx := context.Background()
+
+	info, err := verify(ctx, apiToken, nil)
+	if err != nil || info.UserID != "3" {
+		t.Fatalf("verify(api token) = %+v, %v; want user 3", info, err)
+	}
+
+	info, err = verify(ctx, jwtToken, nil)
+	if err != nil || info.UserID != "5" || info.Expiration.IsZero() {
+		t.Fatalf("verify(jwt) = %+v, %v; want user 5 with expiration", info, err)
+	}
+
+	filesToken, filesHash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken() error = %v", err)
+	}
+	if err := db.Create(&table.APIToken{UserID: 3, Name: "files", TokenHash: filesHash, Prefix: filesToken[:8], Scopes: `["files"]`}).Error; err != nil {
+		t.Fatalf("failed to create api token: %v", err)
+	}
+
+	for _, token := range []string{auth.APITokenPrefix + "unknown", "not-a-jwt", filesToken} {
+		if _, err := verify(ctx, token, nil); !errors.Is(err, mcpauth.ErrInvalidToken) {
+			t.Fatalf("verify(%q) error = %v, want ErrInvalidToken", token, err)
+		}
+	}
+}
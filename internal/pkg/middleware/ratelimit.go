@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"aiguide/internal/pkg/redis"
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -80,3 +81,23 @@ func rateLimitKey(c *gin.Context) string {
 	return fmt.Sprintf("ratelimit:ip:%s:%s:%s",
 		c.ClientIP(), c.Request.Method, c.FullPath())
 }
+
+// ResetRateLimit 清除用户在所有接口上的限流计数，使其立即恢复全部配额
+func ResetRateLimit(ctx context.Context, rdb *redis.Client, userID int) error {
+	// redis_rate 以 "rate:" 前缀保存 rateLimitKey 生成的 key
+	iter := rdb.Raw().Scan(ctx, 0, fmt.Sprintf("rate:ratelimit:user:%d:*", userID), 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan rate limit keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := rdb.Raw().Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete rate limit keys: %w", err)
+	}
+	return nil
+}
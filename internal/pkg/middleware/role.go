@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errUserInactive 用户已删除或已被禁用
+var errUserInactive = errors.New("user is disabled or deleted")
+
+// activeUserRole 查询用户角色，用户已删除或已被禁用时返回 errUserInactive
+// 每个请求都查询一次，禁用或修改角色后立即生效，无需等待访问令牌过期
+func activeUserRole(ctx context.Context, db *gorm.DB, userID int) (constant.UserRole, error) {
+	var user table.User
+	if err := db.WithContext(ctx).Select("id", "role", "disabled_at").Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return "", fmt.Errorf("failed to look up user: %w", err)
+	}
+	if user.ID == 0 || user.DisabledAt != nil {
+		return "", errUserInactive
+	}
+	return user.Role, nil
+}
+
+// ErrUserCannotRun 用户已删除、被禁用或为只读成员，不能以其身份运行助手
+var ErrUserCannotRun = errors.New("account can't run the assistant")
+
+// VerifyUserCanRun 校验用户可用且不是只读成员，不能运行时返回包装 ErrUserCannotRun 的错误
+// 机器人对话、定时任务、事件触发器与 Webhook 不经过 HTTP 中间件，每次运行前调用，禁用或改为只读后立即停止代其运行
+func VerifyUserCanRun(ctx context.Context, db *gorm.DB, userID int) error {
+	role, err := activeUserRole(ctx, db, userID)
+	if errors.Is(err, errUserInactive) {
+		return fmt.Errorf("%w: %v", ErrUserCannotRun, err)
+	}
+	if err != nil {
+		return err
+	}
+	if role == constant.UserRoleReadOnly {
+		return fmt.Errorf("%w: user is read-only", ErrUserCannotRun)
+	}
+	return nil
+}
+
+// setUserRole 校验用户可用并将角色写入上下文，失败时已写入错误响应
+func setUserRole(c *gin.Context, db *gorm.DB, userID int) bool {
+	role, err := activeUserRole(c, db, userID)
+	if errors.Is(err, errUserInactive) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is disabled"})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify user"})
+		c.Abort()
+		return false
+	}
+	c.Set(constant.ContextKeyUserRole, role)
+	return true
+}
+
+// RequireRole 只允许指定角色访问，需在 Auth 之后使用
+func RequireRole(roles ...constant.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := GetUserRole(c)
+		if !slices.Contains(roles, role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyReadOnlyWrites 只读成员只能调用 GET 等安全方法，需在 Auth 之后使用
+// /api/auth 下的账号自助接口（如修改密码、关联登录方式）除外
+func DenyReadOnlyWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := GetUserRole(c)
+		if role != constant.UserRoleReadOnly || isSafeMethod(c.Request.Method) || strings.HasPrefix(c.Request.URL.Path, "/api/auth/") {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "read-only account"})
+		c.Abort()
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
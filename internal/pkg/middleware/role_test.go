@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/auth"
+	"aiguide/internal/pkg/constant"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+func TestAuthRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	now := time.Now()
+	users := []table.User{
+		{Model: table.Model{ID: 10}, Role: constant.UserRoleAdmin},
+		{Model: table.Model{ID: 11}, Role: constant.UserRoleReadOnly},
+		{Model: table.Model{ID: 12}, Role: constant.UserRoleMember, DisabledAt: &now},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("failed to create users: %v", err)
+	}
+	authService := auth.NewAuthService(&auth.Config{JWTSecret: "test-secret"})
+	token := func(userID int) string {
+		t.Helper()
+		jwtToken, err := authService.GenerateAccessToken(userID, &auth.GoogleUser{})
+		if err != nil {
+			t.Fatalf("GenerateAccessToken() error = %v", err)
+		}
+		return jwtToken
+	}
+	disabledAPIToken := createTestAPIToken(t, db, table.APIToken{UserID: 12})
+
+	router := gin.New()
+	router.Use(Auth(db, authService), DenyReadOnlyWrites())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/api/admin/users", RequireRole(constant.UserRoleAdmin), ok)
+	router.GET("/api/sessions", ok)
+	router.POST("/api/sessions", ok)
+	router.PUT("/api/auth/local/password", ok)
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"admin route as admin", token(10), http.MethodGet, "/api/admin/users", http.StatusNoContent},
+		{"admin route as member", token(5), http.MethodGet, "/api/admin/users", http.StatusForbidden},
+		{"member write", token(5), http.MethodPost, "/api/sessions", http.StatusNoContent},
+		{"read-only read", token(11), http.MethodGet, "/api/sessions", http.StatusNoContent},
+		{"read-only write", token(11), http.MethodPost, "/api/sessions", http.StatusForbidden},
+		{"read-only account settings", token(11), http.MethodPut, "/api/auth/local/password", http.StatusNoContent},
+		{"disabled user", token(12), http.MethodGet, "/api/sessions", http.StatusUnauthorized},
+		{"disabled user api token", disabledAPIToken, http.MethodGet, "/api/sessions", http.StatusUnauthorized},
+		{"deleted user", token(99), http.MethodGet, "/api/sessions", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			if resp.Code != tt.wantStatus {
+				t.Fatalf("status = %d, body = %s; want %d", resp.Code, resp.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+
+	verify := MCPTokenVerifier(db, authService)
+	for _, userID := range []int{11, 12} {
+		if _, err := verify(context.Background(), token(userID), nil); !errors.Is(err, mcpauth.ErrInvalidToken) {
+			t.Errorf("verify(user %d) error = %v, want ErrInvalidToken", userID, err)
+		}
+	}
+
+	if err := VerifyUserCanRun(context.Background(), db, 10); err != nil {
+		t.Errorf("VerifyUserCanRun(admin) error = %v", err)
+	}
+	for _, userID := range []int{11, 12, 99} {
+		if err := VerifyUserCanRun(context.Background(), db, userID); !errors.Is(err, ErrUserCannotRun) {
+			t.Errorf("VerifyUserCanRun(user %d) error = %v, want ErrUserCannotRun", userID, err)
+		}
+	}
+}
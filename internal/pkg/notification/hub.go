@@ -0,0 +1,184 @@
+// Package notification stores in-app notifications and pushes new ones to
+// the live connections and the subscribed browsers of their user.
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/redis"
+
+	"gorm.io/gorm"
+)
+
+// Channel is the Redis pub/sub channel new notifications are fanned out on,
+// so a user connected to any instance receives them.
+const Channel = "aiguide:notifications"
+
+// subscriberBuffer is the number of pending messages kept per subscriber.
+// Messages for a subscriber that falls further behind are dropped; clients
+// reload the list when they reconnect.
+const subscriberBuffer = 16
+
+// Message is a new notification as pushed to subscribers.
+type Message struct {
+	ID        int                       `json:"id"`
+	UserID    int                       `json:"user_id"`
+	Kind      constant.NotificationKind `json:"kind"`
+	Title     string                    `json:"title"`
+	Body      string                    `json:"body"`
+	Link      string                    `json:"link"`
+	CreatedAt time.Time                 `json:"created_at"`
+}
+
+// Hub saves notifications and delivers them to subscribers. Without Redis
+// it only reaches subscribers of the current process. With web push enabled
+// notifications are also pushed to the user's browsers.
+type Hub struct {
+	db    *gorm.DB
+	redis *redis.Client
+
+	webPush atomic.Pointer[WebPusher]
+	// pushes tracks web push deliveries in flight.
+	pushes sync.WaitGroup
+
+	mu          sync.Mutex
+	subscribers map[int]map[chan Message]struct{}
+}
+
+// NewHub creates a hub. rdb may be nil for a single-instance setup.
+func NewHub(db *gorm.DB, rdb *redis.Client) *Hub {
+	return &Hub{
+		db:          db,
+		redis:       rdb,
+		subscribers: make(map[int]map[chan Message]struct{}),
+	}
+}
+
+// Notify saves n and pushes it to the subscribers of its user. Only a
+// failure to save is returned; push failures are logged.
+func (h *Hub) Notify(ctx context.Context, n table.Notification) error {
+	if err := h.db.WithContext(ctx).Create(&n).Error; err != nil {
+		slog.Error("failed to create notification", "err", err, "user_id", n.UserID, "kind", n.Kind)
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	// The notification is saved; push it even if the caller's context ends.
+	h.publish(context.WithoutCancel(ctx), Message{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Kind:      n.Kind,
+		Title:     n.Title,
+		Body:      n.Body,
+		Link:      n.Link,
+		CreatedAt: n.CreatedAt,
+	})
+	if pusher := h.webPush.Load(); pusher != nil {
+		h.pushes.Go(func() {
+			pusher.Push(context.WithoutCancel(ctx), n)
+		})
+	}
+	return nil
+}
+
+// SetWebPush enables web push through pusher.
+func (h *Hub) SetWebPush(pusher *WebPusher) {
+	h.webPush.Store(pusher)
+}
+
+// WebPush returns the web pusher, or nil when web push is disabled.
+func (h *Hub) WebPush() *WebPusher {
+	return h.webPush.Load()
+}
+
+// Start subscribes to the Redis channel and fans messages out to local
+// subscribers until ctx is cancelled. It does nothing without Redis.
+func (h *Hub) Start(ctx context.Context) {
+	client := h.redis.Raw()
+	if client == nil {
+		return
+	}
+	pubsub := client.Subscribe(ctx, Channel)
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-messages:
+				if !ok {
+					return
+				}
+				var msg Message
+				if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+					slog.Warn("invalid notification message", "err", err)
+					continue
+				}
+				h.dispatch(msg)
+			}
+		}
+	}()
+}
+
+// Subscribe registers a subscriber for the notifications of userID. The
+// returned function unregisters it and must be called once done.
+func (h *Hub) Subscribe(userID int) (<-chan Message, func()) {
+	ch := make(chan Message, subscriberBuffer)
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan Message]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+		})
+	}
+}
+
+// publish sends msg through Redis, or straight to the local subscribers
+// when Redis is not configured or not reachable.
+func (h *Hub) publish(ctx context.Context, msg Message) {
+	client := h.redis.Raw()
+	if client == nil {
+		h.dispatch(msg)
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.Error("failed to encode notification message", "err", err, "notification_id", msg.ID)
+		return
+	}
+	if err := client.Publish(ctx, Channel, data).Err(); err != nil {
+		slog.Warn("failed to publish notification, delivering locally", "err", err, "notification_id", msg.ID)
+		h.dispatch(msg)
+	}
+}
+
+// dispatch hands msg to the local subscribers of its user without blocking.
+func (h *Hub) dispatch(msg Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[msg.UserID] {
+		select {
+		case ch <- msg:
+		default:
+			slog.Warn("notification subscriber is full, dropping message", "user_id", msg.UserID, "notification_id", msg.ID)
+		}
+	}
+}
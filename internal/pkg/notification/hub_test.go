@@ -0,0 +1,91 @@
+package notification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupHubTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	if err := db.AutoMigrate(&table.Notification{}); err != nil {
+		t.Fatalf("db.AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+func TestHubNotify(t *testing.T) {
+	db := setupHubTestDB(t)
+	hub := NewHub(db, nil)
+
+	messages, cancel := hub.Subscribe(7)
+	other, cancelOther := hub.Subscribe(8)
+	defer cancelOther()
+
+	err := hub.Notify(context.Background(), table.Notification{
+		UserID: 7,
+		Kind:   constant.NotificationKindScheduledTaskRun,
+		Title:  "done",
+		Link:   "/scheduled-tasks",
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	select {
+	case msg := <-messages:
+		if msg.ID == 0 || msg.UserID != 7 || msg.Title != "done" || msg.Link != "/scheduled-tasks" || msg.CreatedAt.IsZero() {
+			t.Fatalf("message = %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber did not receive the notification")
+	}
+	select {
+	case msg := <-other:
+		t.Fatalf("subscriber of another user received %+v", msg)
+	default:
+	}
+
+	var count int64
+	if err := db.Model(&table.Notification{}).Where("user_id = ?", 7).Count(&count).Error; err != nil {
+		t.Fatalf("db.Count() error = %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("got %d notifications, want 1", count)
+	}
+
+	cancel()
+	cancel()
+	if err := hub.Notify(context.Background(), table.Notification{UserID: 7, Kind: constant.NotificationKindScheduledTaskRun, Title: "again"}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	select {
+	case msg := <-messages:
+		t.Fatalf("cancelled subscriber received %+v", msg)
+	default:
+	}
+}
+
+func TestHubDispatchDoesNotBlock(t *testing.T) {
+	hub := NewHub(nil, nil)
+	messages, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	for i := range subscriberBuffer + 5 {
+		hub.dispatch(Message{ID: i + 1, UserID: 1})
+	}
+	if len(messages) != subscriberBuffer {
+		t.Fatalf("got %d buffered messages, want %d", len(messages), subscriberBuffer)
+	}
+}
@@ -0,0 +1,217 @@
+package notification
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/secret"
+	"aiguide/internal/pkg/webpush"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds lists the notification kinds users can turn web push off for.
+var Kinds = []constant.NotificationKind{
+	constant.NotificationKindScheduledTaskRun,
+	constant.NotificationKindEventTriggerRun,
+	constant.NotificationKindAudioTranscription,
+	constant.NotificationKindVideoGeneration,
+}
+
+const (
+	// pushTTL is how long push services keep a message for an offline device.
+	pushTTL = 24 * time.Hour
+	// pushTimeout bounds the deliveries of one notification.
+	pushTimeout = 30 * time.Second
+	// maxPushFailures removes a subscription after that many consecutive
+	// failed deliveries.
+	maxPushFailures = 5
+	// pushBodyLimit caps the body shown by the browser, in runes.
+	pushBodyLimit = 800
+)
+
+// ErrNoPushSubscriptions is returned by Deliver when the user has not
+// subscribed any browser.
+var ErrNoPushSubscriptions = errors.New("no browser is subscribed to push notifications")
+
+// pushPayload is the JSON message the service worker displays.
+type pushPayload struct {
+	ID    int                       `json:"id"`
+	Kind  constant.NotificationKind `json:"kind"`
+	Title string                    `json:"title"`
+	Body  string                    `json:"body"`
+	Link  string                    `json:"link,omitempty"`
+}
+
+// WebPusher sends notifications to the browsers their user subscribed,
+// honouring the user's notification preferences.
+type WebPusher struct {
+	db     *gorm.DB
+	sender *webpush.Sender
+}
+
+// NewWebPusher creates a pusher sending through sender.
+func NewWebPusher(db *gorm.DB, sender *webpush.Sender) *WebPusher {
+	return &WebPusher{db: db, sender: sender}
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with.
+func (p *WebPusher) PublicKey() string {
+	return p.sender.PublicKey()
+}
+
+// Push delivers n to the browsers of its user unless the user turned web
+// push off for its kind. Failures are logged.
+func (p *WebPusher) Push(ctx context.Context, n table.Notification) {
+	enabled, err := WebPushEnabled(p.db, n.UserID, n.Kind)
+	if err != nil {
+		slog.Error("failed to load notification preference", "err", err, "user_id", n.UserID, "kind", n.Kind)
+		return
+	}
+	if !enabled {
+		return
+	}
+	if _, err := p.Deliver(ctx, n); err != nil && !errors.Is(err, ErrNoPushSubscriptions) {
+		slog.Warn("failed to push notification", "err", err, "user_id", n.UserID, "notification_id", n.ID)
+	}
+}
+
+// Deliver sends n to every subscription of its user, regardless of the
+// notification preferences, and returns how many push services accepted
+// it. It fails when none did. Subscriptions the push service reports gone,
+// or that keep failing, are removed.
+func (p *WebPusher) Deliver(ctx context.Context, n table.Notification) (int, error) {
+	var subscriptions []table.WebPushSubscription
+	if err := p.db.Where("user_id = ?", n.UserID).Find(&subscriptions).Error; err != nil {
+		slog.Error("failed to load push subscriptions", "err", err, "user_id", n.UserID)
+		return 0, fmt.Errorf("failed to load push subscriptions: %w", err)
+	}
+	if len(subscriptions) == 0 {
+		return 0, ErrNoPushSubscriptions
+	}
+	payload, err := encodePushPayload(n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode push payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	delivered := 0
+	var lastErr error
+	for _, sub := range subscriptions {
+		err := p.sender.Send(ctx, webpush.Subscription{Endpoint: sub.Endpoint, P256dh: sub.P256dh, Auth: sub.Auth}, payload, pushTTL)
+		if err != nil {
+			lastErr = err
+		}
+		switch {
+		case err == nil:
+			delivered++
+			if err := p.db.Model(&sub).Updates(map[string]any{"last_success_at": time.Now(), "failure_count": 0}).Error; err != nil {
+				slog.Warn("failed to update push subscription", "err", err, "subscription_id", sub.ID)
+			}
+		case errors.Is(err, webpush.ErrSubscriptionGone) || sub.FailureCount+1 >= maxPushFailures:
+			slog.Info("removing push subscription", "reason", err, "subscription_id", sub.ID, "user_id", sub.UserID)
+			if err := p.db.Delete(&sub).Error; err != nil {
+				slog.Warn("failed to delete push subscription", "err", err, "subscription_id", sub.ID)
+			}
+		default:
+			slog.Warn("failed to send push message", "err", err, "subscription_id", sub.ID)
+			if err := p.db.Model(&sub).Update("failure_count", gorm.Expr("failure_count + 1")).Error; err != nil {
+				slog.Warn("failed to update push subscription", "err", err, "subscription_id", sub.ID)
+			}
+		}
+	}
+	if delivered == 0 {
+		return 0, fmt.Errorf("no push service accepted the message: %w", lastErr)
+	}
+	return delivered, nil
+}
+
+// WebPushEnabled reports whether notifications of kind are pushed to the
+// browsers of userID. Push is on unless the user turned it off.
+func WebPushEnabled(db *gorm.DB, userID int, kind constant.NotificationKind) (bool, error) {
+	var preferences []table.NotificationPreference
+	if err := db.Where("user_id = ? AND kind = ?", userID, kind).Limit(1).Find(&preferences).Error; err != nil {
+		return false, err
+	}
+	if len(preferences) == 0 {
+		return true, nil
+	}
+	return preferences[0].WebPush, nil
+}
+
+// LoadVAPIDKeys returns the stored VAPID key pair, generating and storing
+// one on first use. Instances starting together settle on the first stored
+// pair, so subscriptions stay valid whichever instance sends.
+func LoadVAPIDKeys(db *gorm.DB, cipher *secret.Cipher) (webpush.Keys, error) {
+	if cipher == nil {
+		return webpush.Keys{}, errors.New("a secret cipher is required to store vapid keys")
+	}
+
+	var stored []table.WebPushKey
+	if err := db.Order("id").Limit(1).Find(&stored).Error; err != nil {
+		return webpush.Keys{}, fmt.Errorf("failed to load vapid keys: %w", err)
+	}
+	if len(stored) == 0 {
+		keys, err := webpush.GenerateKeys()
+		if err != nil {
+			return webpush.Keys{}, err
+		}
+		encrypted, err := cipher.Encrypt(keys.PrivateKey)
+		if err != nil {
+			return webpush.Keys{}, fmt.Errorf("failed to encrypt vapid key: %w", err)
+		}
+		row := table.WebPushKey{PublicKey: keys.PublicKey, PrivateKey: encrypted}
+		row.ID = 1
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return webpush.Keys{}, fmt.Errorf("failed to store vapid keys: %w", err)
+		}
+		slog.Info("generated vapid keys for web push")
+		if err := db.Order("id").Limit(1).Find(&stored).Error; err != nil || len(stored) == 0 {
+			return webpush.Keys{}, fmt.Errorf("failed to load vapid keys: %w", cmp.Or(err, gorm.ErrRecordNotFound))
+		}
+	}
+
+	privateKey, err := cipher.Decrypt(stored[0].PrivateKey)
+	if err != nil {
+		return webpush.Keys{}, fmt.Errorf("failed to decrypt vapid key: %w", err)
+	}
+	return webpush.Keys{PublicKey: stored[0].PublicKey, PrivateKey: privateKey}, nil
+}
+
+// encodePushPayload encodes n for the service worker, shortening the body
+// so the message fits into a single push record.
+func encodePushPayload(n table.Notification) ([]byte, error) {
+	payload := pushPayload{
+		ID:    n.ID,
+		Kind:  n.Kind,
+		Title: truncateRunes(n.Title, 120),
+		Body:  truncateRunes(n.Body, pushBodyLimit),
+		Link:  n.Link,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > webpush.MaxPayloadSize {
+		payload.Body = ""
+		return json.Marshal(payload)
+	}
+	return data, nil
+}
+
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,147 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/secret"
+	"aiguide/internal/pkg/webpush"
+
+	"gorm.io/gorm"
+)
+
+func setupWebPushTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupHubTestDB(t)
+	if err := db.AutoMigrate(&table.WebPushSubscription{}, &table.NotificationPreference{}, &table.WebPushKey{}); err != nil {
+		t.Fatalf("db.AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+func TestLoadVAPIDKeys(t *testing.T) {
+	db := setupWebPushTestDB(t)
+	cipher, err := secret.NewCipher("test-secret")
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+
+	first, err := LoadVAPIDKeys(db, cipher)
+	if err != nil {
+		t.Fatalf("LoadVAPIDKeys() error = %v", err)
+	}
+	second, err := LoadVAPIDKeys(db, cipher)
+	if err != nil {
+		t.Fatalf("LoadVAPIDKeys() error = %v", err)
+	}
+	if first != second || first.PublicKey == "" {
+		t.Fatalf("keys changed between loads: %+v != %+v", first, second)
+	}
+
+	var stored table.WebPushKey
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatalf("db.First() error = %v", err)
+	}
+	if stored.PrivateKey == first.PrivateKey {
+		t.Fatal("private key is stored in plaintext")
+	}
+	if _, err := webpush.NewSender(first, "mailto:admin@example.com", nil); err != nil {
+		t.Fatalf("NewSender() with loaded keys error = %v", err)
+	}
+}
+
+func TestHubWebPush(t *testing.T) {
+	db := setupWebPushTestDB(t)
+	keys, err := webpush.GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+	sender, err := webpush.NewSender(keys, "mailto:admin@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+
+	var mu sync.Mutex
+	received := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/flaky":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	device, _ := webpush.GenerateKeys()
+	flaky := table.WebPushSubscription{UserID: 1, Endpoint: server.URL + "/flaky", P256dh: device.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg", FailureCount: maxPushFailures - 2}
+	for _, sub := range []table.WebPushSubscription{
+		{UserID: 1, Endpoint: server.URL + "/ok", P256dh: device.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg", FailureCount: 2},
+		{UserID: 1, Endpoint: server.URL + "/gone", P256dh: device.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"},
+		flaky,
+		{UserID: 2, Endpoint: server.URL + "/other", P256dh: device.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"},
+	} {
+		if err := db.Create(&sub).Error; err != nil {
+			t.Fatalf("db.Create() error = %v", err)
+		}
+	}
+	if err := db.Create(&table.NotificationPreference{UserID: 1, Kind: constant.NotificationKindVideoGeneration, WebPush: false}).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+
+	hub := NewHub(db, nil)
+	hub.SetWebPush(NewWebPusher(db, sender))
+	notify := func(kind constant.NotificationKind) {
+		t.Helper()
+		if err := hub.Notify(context.Background(), table.Notification{UserID: 1, Kind: kind, Title: "done", Body: strings.Repeat("长", 2000)}); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		hub.pushes.Wait()
+	}
+
+	notify(constant.NotificationKindVideoGeneration)
+	if len(received) != 0 {
+		t.Fatalf("muted kind was pushed: %v", received)
+	}
+
+	notify(constant.NotificationKindScheduledTaskRun)
+	if received["/ok"] != 1 || received["/gone"] != 1 || received["/flaky"] != 1 || received["/other"] != 0 {
+		t.Fatalf("received = %v", received)
+	}
+	var subs []table.WebPushSubscription
+	if err := db.Order("id").Find(&subs).Error; err != nil {
+		t.Fatalf("db.Find() error = %v", err)
+	}
+	if len(subs) != 3 || subs[0].FailureCount != 0 || subs[0].LastSuccessAt == nil || subs[1].Endpoint != flaky.Endpoint || subs[1].FailureCount != maxPushFailures-1 {
+		t.Fatalf("subscriptions after push = %+v", subs)
+	}
+
+	notify(constant.NotificationKindScheduledTaskRun)
+	if err := db.Where("endpoint = ?", flaky.Endpoint).Find(&subs).Error; err != nil {
+		t.Fatalf("db.Find() error = %v", err)
+	}
+	if len(subs) != 0 {
+		t.Fatal("subscription that keeps failing was not removed")
+	}
+}
+
+func TestEncodePushPayloadFits(t *testing.T) {
+	data, err := encodePushPayload(table.Notification{Title: strings.Repeat("<", 500), Body: strings.Repeat("<", 5000)})
+	if err != nil {
+		t.Fatalf("encodePushPayload() error = %v", err)
+	}
+	if len(data) > webpush.MaxPayloadSize {
+		t.Fatalf("payload of %d bytes exceeds %d", len(data), webpush.MaxPayloadSize)
+	}
+}
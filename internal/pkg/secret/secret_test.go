@@ -0,0 +1,50 @@
+package secret
+
+import "testing"
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := NewCipher("test-key")
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+
+	encrypted, err := c.Encrypt("s3cret-token")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if encrypted == "s3cret-token" {
+		t.Fatal("Encrypt() returned the plaintext")
+	}
+
+	again, _ := c.Encrypt("s3cret-token")
+	if again == encrypted {
+		t.Fatal("Encrypt() should use a fresh nonce for each call")
+	}
+
+	decrypted, err := c.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if decrypted != "s3cret-token" {
+		t.Fatalf("Decrypt() = %q, want s3cret-token", decrypted)
+	}
+}
+
+func TestCipherRejectsWrongKeyAndPlaintext(t *testing.T) {
+	c, _ := NewCipher("key-a")
+	other, _ := NewCipher("key-b")
+
+	encrypted, _ := c.Encrypt("value")
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Fatal("Decrypt() with a different key should fail")
+	}
+	if _, err := c.Decrypt("plain value"); err == nil {
+		t.Fatal("Decrypt() of an unencrypted value should fail")
+	}
+	if got, err := c.Decrypt(""); err != nil || got != "" {
+		t.Fatalf("Decrypt(\"\") = %q, %v; want empty", got, err)
+	}
+	if _, err := NewCipher(""); err == nil {
+		t.Fatal("NewCipher(\"\") should fail")
+	}
+}
@@ -89,6 +89,9 @@ type AudioToolService struct {
 	fileStore   storage.FileStore
 	genaiClient *genai.Client
 	workDir     string
+	// notifier announces the outcome of transcriptions split into several
+	// chunks, which can take many minutes; nil disables it.
+	notifier Notifier
 }
 
 type audioChunkWindow struct {
@@ -104,11 +107,12 @@ func IsSupportedAudioMimeType(mimeType string) bool {
 	return ok
 }
 
-func NewAudioTranscribeTool(db *gorm.DB, fileStore storage.FileStore, genaiClient *genai.Client, workDir string) (tool.Tool, error) {
+func NewAudioTranscribeTool(db *gorm.DB, fileStore storage.FileStore, genaiClient *genai.Client, workDir string, notifier Notifier) (tool.Tool, error) {
 	service, err := newAudioToolService(db, fileStore, genaiClient, workDir)
 	if err != nil {
 		return nil, err
 	}
+	service.notifier = notifier
 
 	config := functiontool.Config{
 		Name:        "audio_transcribe",
@@ -279,6 +283,7 @@ func (s *AudioToolService) transcribe(ctx context.Context, input AudioTranscribe
 			if err := extractAudioChunk(normalizedPath, chunkPath, window.startMs, window.endMs-window.startMs); err != nil {
 				s.persistChunkFailure(job.ID, window, err)
 				s.failJob(job.ID, err)
+				s.notifyTranscription(ctx, userID, sessionID, asset, len(windows), err)
 				return nil, err
 			}
 		}
@@ -287,10 +292,12 @@ func (s *AudioToolService) transcribe(ctx context.Context, input AudioTranscribe
 		if err != nil {
 			s.persistChunkFailure(job.ID, window, err)
 			s.failJob(job.ID, err)
+			s.notifyTranscription(ctx, userID, sessionID, asset, len(windows), err)
 			return nil, err
 		}
 		if err := s.persistChunkSuccess(job.ID, window, chunkText); err != nil {
 			s.failJob(job.ID, err)
+			s.notifyTranscription(ctx, userID, sessionID, asset, len(windows), err)
 			return nil, err
 		}
 		transcripts = append(transcripts, chunkText)
@@ -329,6 +336,7 @@ func (s *AudioToolService) transcribe(ctx context.Context, input AudioTranscribe
 		slog.Error("failed to complete audio job", "job_id", job.ID, "err", err)
 		return nil, fmt.Errorf("failed to complete audio job: %w", err)
 	}
+	s.notifyTranscription(ctx, userID, sessionID, asset, len(windows), nil)
 
 	return &AudioTranscribeOutput{
 		Success:    true,
@@ -495,6 +503,27 @@ func (s *AudioToolService) markJobRunning(jobID int) error {
 	return nil
 }
 
+// notifyTranscription announces the outcome of a transcription split into
+// several chunks. Short transcriptions finish while the user is waiting and
+// are not announced.
+func (s *AudioToolService) notifyTranscription(ctx context.Context, userID int, sessionID string, asset *table.FileAsset, chunkCount int, cause error) {
+	if chunkCount <= 1 {
+		return
+	}
+	n := table.Notification{
+		UserID: userID,
+		Kind:   constant.NotificationKindAudioTranscription,
+		Title:  fmt.Sprintf("音频转写完成：%s", asset.OriginalName),
+		Body:   fmt.Sprintf("已转写 %d 个分段。", chunkCount),
+		Link:   sessionLink(sessionID),
+	}
+	if cause != nil {
+		n.Title = fmt.Sprintf("音频转写失败：%s", asset.OriginalName)
+		n.Body = cause.Error()
+	}
+	sendNotification(ctx, s.notifier, n)
+}
+
 func (s *AudioToolService) failJob(jobID int, cause error) {
 	if cause == nil {
 		return
@@ -9,7 +9,7 @@ func TestNewAudioTranscribeTool(t *testing.T) {
 	db := setupPDFTestDB(t)
 	store := setupPDFTestStore(t)
 
-	audioTool, err := NewAudioTranscribeTool(db, store, nil, t.TempDir())
+	audioTool, err := NewAudioTranscribeTool(db, store, nil, t.TempDir(), nil)
 	if err != nil {
 		t.Fatalf("NewAudioTranscribeTool() error = %v", err)
 	}
@@ -0,0 +1,727 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/storage"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"gorm.io/gorm"
+)
+
+// Languages accepted by code_execute.
+const (
+	CodeLanguagePython     = "python"
+	CodeLanguageJavaScript = "javascript"
+)
+
+const (
+	defaultCodeTimeout      = 30 * time.Second
+	defaultCodeMemoryBytes  = 512 << 20
+	defaultCodeMaxFileBytes = 20 << 20
+	maxCodeSourceBytes      = 100 << 10
+	maxCodeInputFiles       = 10
+	maxCodeOutputFiles      = 10
+	maxCodeStreamBytes      = 32 << 10
+	defaultCodeMaxProcesses = 64
+	codeOpenFilesLimit      = 256
+)
+
+// codeSystemPaths are bound read-only into every sandbox root when they
+// exist. They hold the interpreters, their shared libraries and the few
+// files under /etc the dynamic loader needs.
+var codeSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/alternatives", "/etc/localtime", "/etc/fonts",
+}
+
+// codeDevices are bound into the sandbox's /dev.
+var codeDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// CodeSandboxConfig configures the code_execute sandbox. Each run gets its
+// own user, mount, network, PID, IPC and UTS namespaces and pivots into a
+// fresh root that only holds read-only system directories, the run's own
+// workspace at /work and its script at /src. The program runs without
+// capabilities, and rlimits bound CPU time, memory, file sizes and the
+// number of processes.
+type CodeSandboxConfig struct {
+	PythonPath    string        // Python 3 interpreter; default python3 from PATH
+	NodePath      string        // Node.js binary; default node from PATH
+	WorkDir       string        // parent of the per-run workspaces; default <tmp>/aiguide-code
+	Timeout       time.Duration // wall-clock limit per run; default 30s
+	MemoryBytes   int64         // data segment limit per run; default 512 MiB
+	MaxFileBytes  int64         // largest file a run may write; default 20 MiB
+	MaxProcesses  int           // processes and threads per run; default 64
+	ReadOnlyPaths []string      // extra directories bound read-only, e.g. a virtualenv outside /usr
+	HiddenPaths   []string      // directories masked even when they sit under a bound path; WorkDir and the server's working directory are always masked
+}
+
+type CodeExecuteInput struct {
+	Language string `json:"language" jsonschema:"Programming language: python or javascript"`
+	Code     string `json:"code" jsonschema:"Complete program to run. Print results to stdout. Input files are in the current directory; files written to the current directory are saved for the user"`
+	FileIDs  []int  `json:"file_ids,omitempty" jsonschema:"IDs of the user's files to copy into the working directory, e.g. uploaded CSVs"`
+}
+
+type CodeExecuteFile struct {
+	FileID       int    `json:"file_id"`
+	FileName     string `json:"file_name"`
+	MimeType     string `json:"mime_type"`
+	SizeBytes    int64  `json:"size_bytes"`
+	DownloadPath string `json:"download_path"`
+}
+
+type CodeExecuteOutput struct {
+	Success         bool              `json:"success"`
+	ExitCode        int               `json:"exit_code"`
+	TimedOut        bool              `json:"timed_out,omitempty"`
+	Stdout          string            `json:"stdout"`
+	Stderr          string            `json:"stderr"`
+	StdoutTruncated bool              `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool              `json:"stderr_truncated,omitempty"`
+	InputFiles      []string          `json:"input_files,omitempty"`
+	Files           []CodeExecuteFile `json:"files,omitempty"`
+	Message         string            `json:"message"`
+}
+
+type codeSandbox struct {
+	db            *gorm.DB
+	fileStore     storage.FileStore
+	interpreters  map[string]string // language -> interpreter path
+	workDir       string
+	timeout       time.Duration
+	memoryBytes   int64
+	maxFileBytes  int64
+	maxProcesses  int
+	readOnlyPaths []string // system paths plus configured ones, all absolute
+	hiddenPaths   []string
+}
+
+// NewCodeExecuteTool creates the code_execute tool. It fails when the
+// platform cannot provide the sandbox or no interpreter runs inside it.
+func NewCodeExecuteTool(db *gorm.DB, fileStore storage.FileStore, cfg CodeSandboxConfig) (tool.Tool, error) {
+	sandbox, err := newCodeSandbox(db, fileStore, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	config := functiontool.Config{
+		Name: "code_execute",
+		Description: "Run a Python or JavaScript program in an isolated sandbox without network access and return its stdout and stderr. " +
+			"Use it for calculations and for analyzing the user's files (e.g. CSV, JSON, Excel): pass their IDs in file_ids and open them by name from the current directory. " +
+			"Files the program writes to the current directory (charts, cleaned data) are saved as new files for the user. " +
+			"Available languages: " + strings.Join(sandbox.languages(), ", ") + ".",
+	}
+
+	handler := func(ctx tool.Context, input CodeExecuteInput) (*CodeExecuteOutput, error) {
+		return sandbox.execute(ctx, input)
+	}
+
+	return functiontool.New(config, handler)
+}
+
+func newCodeSandbox(db *gorm.DB, fileStore storage.FileStore, cfg CodeSandboxConfig) (*codeSandbox, error) {
+	if db == nil {
+		slog.Error("db is nil")
+		return nil, fmt.Errorf("database connection is required")
+	}
+	if fileStore == nil {
+		slog.Error("fileStore is nil")
+		return nil, fmt.Errorf("file store is required")
+	}
+	if !codeSandboxSupported {
+		return nil, fmt.Errorf("code sandbox is not supported on this platform")
+	}
+
+	s := &codeSandbox{
+		db:           db,
+		fileStore:    fileStore,
+		interpreters: make(map[string]string),
+		workDir:      cfg.WorkDir,
+		timeout:      cfg.Timeout,
+		memoryBytes:  cfg.MemoryBytes,
+		maxFileBytes: cfg.MaxFileBytes,
+		maxProcesses: cfg.MaxProcesses,
+	}
+	if s.workDir == "" {
+		s.workDir = filepath.Join(os.TempDir(), "aiguide-code")
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultCodeTimeout
+	}
+	if s.memoryBytes <= 0 {
+		s.memoryBytes = defaultCodeMemoryBytes
+	}
+	if s.maxFileBytes <= 0 {
+		s.maxFileBytes = defaultCodeMaxFileBytes
+	}
+	if s.maxProcesses <= 0 {
+		s.maxProcesses = defaultCodeMaxProcesses
+	}
+
+	workDir, err := filepath.Abs(s.workDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid code work directory: %w", err)
+	}
+	s.workDir = workDir
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	for _, p := range append([]string{workDir, cwd}, cfg.HiddenPaths...) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hidden path %q: %w", p, err)
+		}
+		if !slices.Contains(s.hiddenPaths, abs) {
+			s.hiddenPaths = append(s.hiddenPaths, abs)
+		}
+	}
+	s.readOnlyPaths = slices.Clone(codeSystemPaths)
+	for _, p := range cfg.ReadOnlyPaths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read-only path %q: %w", p, err)
+		}
+		s.readOnlyPaths = append(s.readOnlyPaths, abs)
+	}
+	if err := os.MkdirAll(s.workDir, 0700); err != nil {
+		slog.Error("failed to create code work directory", "work_dir", s.workDir, "err", err)
+		return nil, fmt.Errorf("failed to create code work directory: %w", err)
+	}
+
+	candidates := map[string]string{
+		CodeLanguagePython:     cmp.Or(cfg.PythonPath, "python3"),
+		CodeLanguageJavaScript: cmp.Or(cfg.NodePath, "node"),
+	}
+	for language, name := range candidates {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			slog.Warn("code interpreter not found", "language", language, "interpreter", name)
+			continue
+		}
+		if err := s.probe(path); err != nil {
+			slog.Warn("code interpreter does not run in the sandbox", "language", language, "interpreter", path, "err", err)
+			continue
+		}
+		s.interpreters[language] = path
+	}
+	if len(s.interpreters) == 0 {
+		return nil, fmt.Errorf("no code interpreter runs in the sandbox")
+	}
+	return s, nil
+}
+
+func (s *codeSandbox) languages() []string {
+	languages := make([]string, 0, len(s.interpreters))
+	for language := range s.interpreters {
+		languages = append(languages, language)
+	}
+	slices.Sort(languages)
+	return languages
+}
+
+// probe runs the interpreter's --version inside the sandbox.
+func (s *codeSandbox) probe(interpreter string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	workspace, err := s.newWorkspace()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workspace)
+
+	var output bytes.Buffer
+	cmd := s.command(ctx, workspace, interpreter, "--version")
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// newWorkspace creates a per-run workspace under workDir with the mount
+// point of the sandbox root, the program's working directory and the
+// directory holding its script.
+func (s *codeSandbox) newWorkspace() (string, error) {
+	workspace := filepath.Join(s.workDir, uuid.NewString())
+	for _, dir := range []string{"root", "work", "src"} {
+		if err := os.MkdirAll(filepath.Join(workspace, dir), 0700); err != nil {
+			slog.Error("failed to create code workspace", "workspace", workspace, "err", err)
+			return "", fmt.Errorf("failed to create code workspace: %w", err)
+		}
+	}
+	return workspace, nil
+}
+
+// command builds the sandboxed command. A shell inside the namespaces mounts
+// a tmpfs at workspace/root, binds the read-only paths, the devices, the
+// workspace's work and src directories and a private /proc into it, masks the
+// hidden paths and pivots into it. It then applies the rlimits and execs args
+// through setpriv, which drops every capability so the program cannot undo
+// the mounts.
+func (s *codeSandbox) command(ctx context.Context, workspace string, args ...string) *exec.Cmd {
+	root := filepath.Join(workspace, "root")
+	uid, gid := codeSandboxIdentity()
+
+	var script strings.Builder
+	line := func(format string, a ...any) {
+		fmt.Fprintf(&script, format+"\n", a...)
+	}
+	bind := func(source, target string, readOnly bool) {
+		line("mount --bind %s %s", shellQuote(source), shellQuote(target))
+		if readOnly {
+			line("mount -o remount,bind,ro,nosuid,nodev %s", shellQuote(target))
+		}
+	}
+
+	line("set -e")
+	line("mount --make-rprivate /")
+	line("mount -t tmpfs -o size=1m,mode=0755 tmpfs %s", shellQuote(root))
+	var bound []string
+	for _, p := range s.readOnlyPaths {
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		target := filepath.Join(root, p)
+		line("mkdir -p %s", shellQuote(filepath.Dir(target)))
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				continue
+			}
+			line("ln -s %s %s", shellQuote(link), shellQuote(target))
+			continue
+		case info.IsDir():
+			line("mkdir -p %s", shellQuote(target))
+		default:
+			line("touch %s", shellQuote(target))
+		}
+		bind(p, target, true)
+		bound = append(bound, p)
+	}
+	line("mkdir -p %s", shellQuote(filepath.Join(root, "dev")))
+	for _, dev := range codeDevices {
+		line("touch %s", shellQuote(filepath.Join(root, dev)))
+		bind(dev, filepath.Join(root, dev), false)
+	}
+	for _, p := range s.hiddenPaths {
+		if !pathUnderAny(p, bound) {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || !info.IsDir() {
+			continue
+		}
+		line("mount -t tmpfs -o size=16k,mode=0555 tmpfs %s", shellQuote(filepath.Join(root, p)))
+	}
+	line("mkdir %s %s %s %s", shellQuote(filepath.Join(root, "work")), shellQuote(filepath.Join(root, "src")),
+		shellQuote(filepath.Join(root, "proc")), shellQuote(filepath.Join(root, ".oldroot")))
+	if uid != 0 {
+		line("chown -R %d:%d %s %s", uid, gid, shellQuote(filepath.Join(workspace, "work")), shellQuote(filepath.Join(workspace, "src")))
+	}
+	bind(filepath.Join(workspace, "work"), filepath.Join(root, "work"), false)
+	bind(filepath.Join(workspace, "src"), filepath.Join(root, "src"), true)
+	line("mount -t proc -o nosuid,nodev,noexec proc %s", shellQuote(filepath.Join(root, "proc")))
+	line("mount -o remount,ro %s", shellQuote(root))
+	line("cd %s", shellQuote(root))
+	line("pivot_root . .oldroot")
+	line("umount -l /.oldroot")
+	line("cd /work")
+	line("ulimit -t %d", int(s.timeout.Seconds())+1)
+	line("ulimit -d %d", s.memoryBytes/1024)
+	line("ulimit -f %d", s.maxFileBytes/1024)
+	line("ulimit -n %d", codeOpenFilesLimit)
+	// dash names RLIMIT_NPROC -p, bash and busybox -u.
+	line("ulimit -u %[1]d 2>/dev/null || ulimit -p %[1]d", s.maxProcesses)
+	line("ulimit -c 0")
+	groups := "--keep-groups"
+	if uid != 0 {
+		groups = "--clear-groups"
+	}
+	fmt.Fprintf(&script, `exec setpriv --reuid=%d --regid=%d %s --inh-caps=-all --bounding-set=-all --no-new-privs -- "$@"`, uid, gid, groups)
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", script.String(), "sh"}, args...)...)
+	cmd.Dir = workspace
+	cmd.Env = []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin",
+		"HOME=/work",
+		"TMPDIR=/work",
+		"LANG=C.UTF-8",
+		"PYTHONDONTWRITEBYTECODE=1",
+		"PYTHONUNBUFFERED=1",
+		"MPLBACKEND=Agg",
+	}
+	cmd.SysProcAttr = codeSandboxSysProcAttr()
+	cmd.WaitDelay = 2 * time.Second
+	return cmd
+}
+
+// pathUnderAny reports whether p is one of roots or inside one of them.
+func pathUnderAny(p string, roots []string) bool {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, p); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (s *codeSandbox) execute(ctx context.Context, input CodeExecuteInput) (*CodeExecuteOutput, error) {
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok || userID <= 0 {
+		slog.Error("user_id not found in context")
+		return nil, fmt.Errorf("user_id not found in context")
+	}
+	sessionID, ok := ctx.Value(constant.ContextKeySessionID).(string)
+	if !ok || strings.TrimSpace(sessionID) == "" {
+		slog.Error("session_id not found in context")
+		return nil, fmt.Errorf("session_id not found in context")
+	}
+
+	language := strings.ToLower(strings.TrimSpace(input.Language))
+	if language == "js" || language == "node" {
+		language = CodeLanguageJavaScript
+	}
+	interpreter, ok := s.interpreters[language]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q, available: %s", input.Language, strings.Join(s.languages(), ", "))
+	}
+	if strings.TrimSpace(input.Code) == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+	if len(input.Code) > maxCodeSourceBytes {
+		return nil, fmt.Errorf("code exceeds %d bytes", maxCodeSourceBytes)
+	}
+	if len(input.FileIDs) > maxCodeInputFiles {
+		return nil, fmt.Errorf("too many input files (max %d)", maxCodeInputFiles)
+	}
+
+	workspace, err := s.newWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	workDir := filepath.Join(workspace, "work")
+	defer func() {
+		if err := os.RemoveAll(workspace); err != nil {
+			slog.Warn("os.RemoveAll() error", "workspace", workspace, "err", err)
+		}
+	}()
+
+	inputs, err := s.seedInputs(ctx, userID, input.FileIDs, workDir)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := snapshotFiles(workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The script is read-only at /src inside the sandbox.
+	scriptName := "main.py"
+	args := []string{interpreter, "/src/" + scriptName}
+	if language == CodeLanguageJavaScript {
+		scriptName = "main.js"
+		args = []string{interpreter, fmt.Sprintf("--max-old-space-size=%d", s.memoryBytes>>20), "/src/" + scriptName}
+	}
+	scriptPath := filepath.Join(workspace, "src", scriptName)
+	if err := os.WriteFile(scriptPath, []byte(input.Code), 0600); err != nil {
+		slog.Error("failed to write code file", "path", scriptPath, "err", err)
+		return nil, fmt.Errorf("failed to write code file: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	stdout := &cappedBuffer{limit: maxCodeStreamBytes}
+	stderr := &cappedBuffer{limit: maxCodeStreamBytes}
+	cmd := s.command(runCtx, workspace, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	slog.Info("executing code", "user_id", userID, "session_id", sessionID, "language", language, "input_files", len(inputs))
+	runErr := cmd.Run()
+	timedOut := errors.Is(runCtx.Err(), context.DeadlineExceeded)
+	exitCode := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) && !timedOut {
+			slog.Error("failed to run code", "user_id", userID, "language", language, "err", runErr)
+			return nil, fmt.Errorf("failed to run code: %w", runErr)
+		}
+		exitCode = -1
+		if exitErr != nil {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	files, err := s.saveOutputs(ctx, userID, sessionID, workDir, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &CodeExecuteOutput{
+		Success:         runErr == nil,
+		ExitCode:        exitCode,
+		TimedOut:        timedOut,
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+		InputFiles:      inputs,
+		Files:           files,
+	}
+	switch {
+	case timedOut:
+		output.Message = fmt.Sprintf("Execution timed out after %s", s.timeout)
+	case runErr != nil:
+		output.Message = fmt.Sprintf("Program exited with code %d", exitCode)
+	default:
+		output.Message = fmt.Sprintf("Program finished and produced %d file(s)", len(files))
+	}
+	return output, nil
+}
+
+// seedInputs copies the user's files into dir and returns their names there.
+func (s *codeSandbox) seedInputs(ctx context.Context, userID int, fileIDs []int, dir string) ([]string, error) {
+	if len(fileIDs) == 0 {
+		return nil, nil
+	}
+
+	var assets []table.FileAsset
+	if err := s.db.Where("id IN ? AND user_id = ? AND status = ?", fileIDs, userID, constant.FileAssetStatusReady).
+		Find(&assets).Error; err != nil {
+		slog.Error("failed to query code input files", "user_id", userID, "err", err)
+		return nil, fmt.Errorf("failed to load input files: %w", err)
+	}
+
+	names := make([]string, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		idx := slices.IndexFunc(assets, func(a table.FileAsset) bool { return a.ID == id })
+		if idx < 0 {
+			return nil, fmt.Errorf("file %d not found", id)
+		}
+		asset := assets[idx]
+
+		name := codeFileName(asset.OriginalName, asset.ID)
+		if slices.Contains(names, name) {
+			ext := filepath.Ext(name)
+			name = strings.TrimSuffix(name, ext) + "-" + strconv.Itoa(asset.ID) + ext
+		}
+		if err := s.copyAsset(ctx, asset, filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s *codeSandbox) copyAsset(ctx context.Context, asset table.FileAsset, destination string) error {
+	rc, err := s.fileStore.Open(ctx, asset.StoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to open stored file: %w", err)
+	}
+	defer rc.Close()
+
+	file, err := os.Create(destination)
+	if err != nil {
+		slog.Error("failed to create code input file", "path", destination, "err", err)
+		return fmt.Errorf("failed to create input file: %w", err)
+	}
+	if _, err := io.Copy(file, rc); err != nil {
+		file.Close()
+		slog.Error("failed to write code input file", "path", destination, "err", err)
+		return fmt.Errorf("failed to write input file: %w", err)
+	}
+	return file.Close()
+}
+
+// codeFileName returns a safe file name for an asset inside the workspace.
+func codeFileName(originalName string, id int) string {
+	name := filepath.Base(strings.TrimSpace(originalName))
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, ".") {
+		name = "file-" + strconv.Itoa(id) + name
+	}
+	return name
+}
+
+type codeFileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshotFiles records the regular files in dir so outputs can be told apart
+// from unchanged inputs.
+func snapshotFiles(dir string) (map[string]codeFileState, error) {
+	snapshot := make(map[string]codeFileState)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		snapshot[path] = codeFileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan workspace: %w", err)
+	}
+	return snapshot, nil
+}
+
+// saveOutputs stores new or modified regular files in dir as generated assets.
+// Symlinks, hidden files and caches are ignored.
+func (s *codeSandbox) saveOutputs(ctx context.Context, userID int, sessionID, dir string, before map[string]codeFileState) ([]CodeExecuteFile, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "__pycache__" || d.Name() == "node_modules") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if prev, ok := before[path]; ok && prev.size == info.Size() && prev.modTime.Equal(info.ModTime()) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to scan code workspace", "dir", dir, "err", err)
+		return nil, fmt.Errorf("failed to scan workspace: %w", err)
+	}
+	if len(paths) > maxCodeOutputFiles {
+		slog.Warn("code produced too many files, keeping the first ones", "count", len(paths), "max", maxCodeOutputFiles)
+		paths = paths[:maxCodeOutputFiles]
+	}
+
+	files := make([]CodeExecuteFile, 0, len(paths))
+	for _, path := range paths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		fileName := strings.ReplaceAll(filepath.ToSlash(rel), "/", "_")
+		mimeType := detectCodeFileMimeType(path)
+
+		meta, err := s.fileStore.Save(ctx, storage.SaveInput{
+			UserID:     userID,
+			SessionID:  sessionID,
+			FileName:   fileName,
+			MimeType:   mimeType,
+			SourcePath: path,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save output file: %w", err)
+		}
+		asset := table.FileAsset{
+			UserID:       userID,
+			SessionID:    sessionID,
+			Kind:         constant.FileAssetKindGenerated,
+			MimeType:     mimeType,
+			OriginalName: fileName,
+			StoragePath:  meta.StoragePath,
+			SizeBytes:    meta.SizeBytes,
+			SHA256:       meta.SHA256,
+			Status:       constant.FileAssetStatusReady,
+		}
+		if err := s.db.Create(&asset).Error; err != nil {
+			slog.Error("failed to create code output file asset", "err", err, "file_name", fileName)
+			return nil, fmt.Errorf("failed to persist file asset: %w", err)
+		}
+		files = append(files, CodeExecuteFile{
+			FileID:       asset.ID,
+			FileName:     fileName,
+			MimeType:     mimeType,
+			SizeBytes:    asset.SizeBytes,
+			DownloadPath: buildFileDownloadPath(asset.ID),
+		})
+	}
+	return files, nil
+}
+
+func detectCodeFileMimeType(path string) string {
+	if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+		if mediaType, _, err := mime.ParseMediaType(byExt); err == nil {
+			return mediaType
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// cappedBuffer keeps the first limit bytes written to it.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
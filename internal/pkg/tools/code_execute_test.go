@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/storage"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupCodeSandbox(t *testing.T) (*codeSandbox, context.Context) {
+	t.Helper()
+
+	out, err := exec.Command("python3", "-c", "import sys; print(sys.executable, sys.base_prefix)").Output()
+	if err != nil {
+		t.Skipf("python3 not available: %v", err)
+	}
+	python, prefix, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	db := setupPDFTestDB(t)
+	sandbox, err := newCodeSandbox(db, setupPDFTestStore(t), CodeSandboxConfig{
+		PythonPath:    python,
+		WorkDir:       t.TempDir(),
+		Timeout:       5 * time.Second,
+		MaxProcesses:  16,
+		ReadOnlyPaths: []string{prefix},
+	})
+	if err != nil {
+		t.Skipf("code sandbox not available: %v", err)
+	}
+	if _, ok := sandbox.interpreters[CodeLanguagePython]; !ok {
+		t.Skip("python does not run in the sandbox")
+	}
+
+	ctx := context.WithValue(context.Background(), constant.ContextKeyUserID, 7)
+	ctx = context.WithValue(ctx, constant.ContextKeySessionID, "session-code")
+	return sandbox, ctx
+}
+
+func TestCodeExecuteSavesOutputFiles(t *testing.T) {
+	sandbox, ctx := setupCodeSandbox(t)
+
+	source := t.TempDir() + "/numbers.csv"
+	if err := os.WriteFile(source, []byte("1\n2\n3\n"), 0600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	meta, err := sandbox.fileStore.Save(ctx, storage.SaveInput{UserID: 7, SessionID: "session-code", FileName: "numbers.csv", MimeType: "text/csv", SourcePath: source})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	input := table.FileAsset{UserID: 7, SessionID: "session-code", Kind: constant.FileAssetKindUploaded, MimeType: "text/csv", OriginalName: "numbers.csv", StoragePath: meta.StoragePath, Status: constant.FileAssetStatusReady}
+	if err := sandbox.db.Create(&input).Error; err != nil {
+		t.Fatalf("db.Create() error = %v", err)
+	}
+
+	output, err := sandbox.execute(ctx, CodeExecuteInput{
+		Language: CodeLanguagePython,
+		Code: "total = sum(int(line) for line in open('numbers.csv'))\n" +
+			"print('total', total)\n" +
+			"open('result.txt', 'w').write(str(total))\n",
+		FileIDs: []int{input.ID},
+	})
+	if err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	if !output.Success || strings.TrimSpace(output.Stdout) != "total 6" {
+		t.Fatalf("output = %+v", output)
+	}
+	if len(output.Files) != 1 || output.Files[0].FileName != "result.txt" {
+		t.Fatalf("output.Files = %+v, want only result.txt", output.Files)
+	}
+
+	var asset table.FileAsset
+	if err := sandbox.db.First(&asset, output.Files[0].FileID).Error; err != nil {
+		t.Fatalf("db.First() error = %v", err)
+	}
+	if asset.Kind != constant.FileAssetKindGenerated || asset.UserID != 7 || asset.SizeBytes != 1 {
+		t.Fatalf("asset = %+v", asset)
+	}
+}
+
+func TestCodeExecuteIsolation(t *testing.T) {
+	sandbox, ctx := setupCodeSandbox(t)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd() error = %v", err)
+	}
+	// 只读目录中被屏蔽的子目录、其他运行的工作区、服务端源码与 /etc 下的配置都不可见
+	shared := t.TempDir()
+	if err := os.MkdirAll(shared+"/hidden", 0700); err != nil {
+		t.Fatalf("os.MkdirAll() error = %v", err)
+	}
+	for _, name := range []string{"visible.txt", "hidden/secret.txt"} {
+		if err := os.WriteFile(filepath.Join(shared, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("os.WriteFile() error = %v", err)
+		}
+	}
+	sandbox.readOnlyPaths = append(sandbox.readOnlyPaths, shared)
+	sandbox.hiddenPaths = append(sandbox.hiddenPaths, shared+"/hidden")
+	paths := []string{sandbox.workDir, cwd + "/code_execute.go", "/etc/passwd", shared + "/hidden/secret.txt"}
+
+	code := "import os, socket\n" +
+		"print(os.getpid())\n" +
+		"print(os.getcwd())\n"
+	for _, p := range paths {
+		code += "print(os.path.exists(" + pyQuote(p) + "))\n"
+	}
+	code += "print(os.path.exists(" + pyQuote(shared+"/visible.txt") + "))\n"
+	code += "socket.create_connection(('1.1.1.1', 80), timeout=2)\n"
+	output, err := sandbox.execute(ctx, CodeExecuteInput{Language: CodeLanguagePython, Code: code})
+	if err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	if output.Success || !strings.Contains(output.Stderr, "OSError") && !strings.Contains(output.Stderr, "unreachable") {
+		t.Fatalf("network access was not blocked: %+v", output)
+	}
+	lines := strings.Fields(output.Stdout)
+	if len(lines) != len(paths)+3 || lines[0] != "1" || lines[1] != "/work" || lines[len(lines)-1] != "True" {
+		t.Fatalf("stdout = %q, want PID 1 in /work and the read-only path visible", output.Stdout)
+	}
+	for i, p := range paths {
+		if lines[i+2] != "False" {
+			t.Errorf("%s is visible in the sandbox", p)
+		}
+	}
+}
+
+func TestCodeExecuteReadOnlyRoot(t *testing.T) {
+	sandbox, ctx := setupCodeSandbox(t)
+
+	// 程序没有任何权限，不能写入根目录、卸载或重新挂载
+	output, err := sandbox.execute(ctx, CodeExecuteInput{
+		Language: CodeLanguagePython,
+		Code: "import os, subprocess\n" +
+			"for path in ['/usr/pwned', '/pwned', '/src/pwned']:\n" +
+			"    try:\n" +
+			"        open(path, 'w')\n" +
+			"        print('wrote', path)\n" +
+			"    except OSError:\n" +
+			"        pass\n" +
+			"print(subprocess.run(['mount', '-o', 'remount,rw', '/'], capture_output=True).returncode != 0)\n",
+	})
+	if err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	if strings.TrimSpace(output.Stdout) != "True" {
+		t.Fatalf("output = %+v, want read-only root", output)
+	}
+}
+
+func TestCodeExecuteProcessLimit(t *testing.T) {
+	sandbox, ctx := setupCodeSandbox(t)
+
+	output, err := sandbox.execute(ctx, CodeExecuteInput{
+		Language: CodeLanguagePython,
+		Code: "import os, time\n" +
+			"count = 0\n" +
+			"for _ in range(100):\n" +
+			"    try:\n" +
+			"        if os.fork() == 0:\n" +
+			"            time.sleep(3)\n" +
+			"            os._exit(0)\n" +
+			"        count += 1\n" +
+			"    except OSError:\n" +
+			"        break\n" +
+			"print(count)\n",
+	})
+	if err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(output.Stdout))
+	if err != nil || count >= sandbox.maxProcesses {
+		t.Fatalf("output = %+v, want fork to fail below %d processes", output, sandbox.maxProcesses)
+	}
+}
+
+func TestCodeExecuteTimeout(t *testing.T) {
+	sandbox, ctx := setupCodeSandbox(t)
+	sandbox.timeout = time.Second
+
+	start := time.Now()
+	output, err := sandbox.execute(ctx, CodeExecuteInput{Language: CodeLanguagePython, Code: "while True:\n    pass\n"})
+	if err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	if !output.TimedOut || output.Success {
+		t.Fatalf("output = %+v, want timeout", output)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("execute() took %s", elapsed)
+	}
+}
+
+func pyQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
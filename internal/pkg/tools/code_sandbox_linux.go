@@ -0,0 +1,46 @@
+//go:build linux
+
+package tools
+
+import (
+	"os"
+	"syscall"
+)
+
+const codeSandboxSupported = true
+
+// codeSandboxNobody is the user and group programs run as when the server
+// itself runs as root. The kernel never applies RLIMIT_NPROC to the host's
+// root user, so the process limit only holds for another user.
+const codeSandboxNobody = 65534
+
+// codeSandboxIdentity returns the user and group, inside the namespace, that
+// programs run as.
+func codeSandboxIdentity() (uid, gid int) {
+	if os.Getuid() == 0 {
+		return codeSandboxNobody, codeSandboxNobody
+	}
+	return 0, 0
+}
+
+// codeSandboxSysProcAttr starts the process in fresh user, mount, network,
+// PID, IPC and UTS namespaces, mapping the server's user to root inside so
+// the wrapper shell can build the sandbox root. A root server also maps
+// nobody so the program can switch to it.
+func codeSandboxSysProcAttr() *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	if os.Getuid() == 0 {
+		nobody := syscall.SysProcIDMap{ContainerID: codeSandboxNobody, HostID: codeSandboxNobody, Size: 1}
+		attr.UidMappings = append(attr.UidMappings, nobody)
+		attr.GidMappings = append(attr.GidMappings, nobody)
+		attr.GidMappingsEnableSetgroups = true
+	}
+	return attr
+}
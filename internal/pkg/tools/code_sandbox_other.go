@@ -0,0 +1,16 @@
+//go:build !linux
+
+package tools
+
+import "syscall"
+
+// The code sandbox relies on Linux namespaces.
+const codeSandboxSupported = false
+
+func codeSandboxIdentity() (uid, gid int) {
+	return 0, 0
+}
+
+func codeSandboxSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/middleware"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"google.golang.org/adk/tool"
+)
+
+// ConfirmableToolNames lists the side-effecting tools that can be gated behind
+// a human-in-the-loop confirmation. Users toggle them individually via
+// /api/tool_confirmation_settings; a tool without a stored setting requires
+// confirmation.
+var ConfirmableToolNames = []string{"ssh_execute", "send_email", "manage_calendar"}
+
+// calendarMutatingActions are the manage_calendar actions that change data.
+// Read-only actions never require confirmation.
+var calendarMutatingActions = map[string]bool{
+	"create_event": true,
+	"update_event": true,
+	"delete_event": true,
+}
+
+// ConfirmationMode selects how an agent handles calls of confirmable tools.
+type ConfirmationMode int
+
+const (
+	// ConfirmationOff runs confirmable tools without asking, for runs the
+	// owner set up in advance such as scheduled tasks.
+	ConfirmationOff ConfirmationMode = iota
+	// ConfirmationAsk pauses confirmable tools until the user decides (see
+	// ConfirmToolCall).
+	ConfirmationAsk
+	// ConfirmationDeny fails every side-effecting call of a confirmable tool
+	// (see DenyConfirmableToolCall), for runs driven by untrusted content.
+	ConfirmationDeny
+	// ConfirmationReject fails the calls the user wants confirmed (see
+	// RejectUnconfirmedToolCall), for clients that cannot show a prompt.
+	ConfirmationReject
+)
+
+// ToolConfirmationPayload is attached to a confirmation request and echoed
+// back when the user approves. Args holds the arguments the tool will run
+// with, which the user may have edited.
+type ToolConfirmationPayload struct {
+	Args map[string]any `json:"args"`
+}
+
+// IsConfirmableTool reports whether name is one of ConfirmableToolNames.
+func IsConfirmableTool(name string) bool {
+	return slices.Contains(ConfirmableToolNames, name)
+}
+
+// callNeedsConfirmation reports whether this particular call of a confirmable
+// tool has side effects worth confirming.
+func callNeedsConfirmation(toolName string, args map[string]any) bool {
+	if toolName == "manage_calendar" {
+		action, _ := args["action"].(string)
+		return calendarMutatingActions[action]
+	}
+	return IsConfirmableTool(toolName)
+}
+
+// ToolConfirmationRequired reports whether the user in ctx wants toolName to
+// be confirmed. It defaults to true when no setting is stored or the setting
+// cannot be read.
+func ToolConfirmationRequired(ctx context.Context, toolName string) bool {
+	tx, ok := middleware.GetTx(ctx)
+	if !ok {
+		return true
+	}
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		return true
+	}
+
+	var settings []table.ToolConfirmationSetting
+	if err := tx.Where("user_id = ? AND tool_name = ?", userID, toolName).Limit(1).Find(&settings).Error; err != nil {
+		slog.Error("failed to query tool confirmation setting", "user_id", userID, "tool_name", toolName, "err", err)
+		return true
+	}
+	if len(settings) == 0 {
+		return true
+	}
+	return settings[0].Required
+}
+
+// ConfirmToolCall is a BeforeToolCallback that pauses confirmable tools until
+// the user approves, edits or rejects the call.
+//
+// On the first call it requests a confirmation through ADK, which ends the
+// run and emits an adk_request_confirmation function call to the client.
+// When the run resumes with the user's decision, a rejected call is answered
+// without running the tool, and an approved call runs with the (possibly
+// edited) arguments from the confirmation payload.
+func ConfirmToolCall(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	if !IsConfirmableTool(t.Name()) {
+		return nil, nil
+	}
+
+	if confirmation := ctx.ToolConfirmation(); confirmation != nil {
+		if !confirmation.Confirmed {
+			slog.Info("tool call rejected by user", "tool", t.Name(), "function_call_id", ctx.FunctionCallID())
+			return map[string]any{
+				"success": false,
+				"error":   fmt.Sprintf("the user rejected the %s call; do not retry it unless the user asks", t.Name()),
+			}, nil
+		}
+		if edited := confirmedArgs(confirmation.Payload); edited != nil {
+			maps.DeleteFunc(args, func(string, any) bool { return true })
+			maps.Copy(args, edited)
+		}
+		return nil, nil
+	}
+
+	if !callNeedsConfirmation(t.Name(), args) || !ToolConfirmationRequired(ctx, t.Name()) {
+		return nil, nil
+	}
+
+	hint := fmt.Sprintf("%s wants to run with the arguments below. Approve, edit or reject it.", t.Name())
+	if err := ctx.RequestConfirmation(hint, ToolConfirmationPayload{Args: maps.Clone(args)}); err != nil {
+		slog.Error("failed to request tool confirmation", "tool", t.Name(), "err", err)
+		return nil, fmt.Errorf("failed to request confirmation for %s: %w", t.Name(), err)
+	}
+	// End the run here; it resumes once the user answers.
+	ctx.Actions().SkipSummarization = true
+
+	return map[string]any{
+		"success": false,
+		"status":  "awaiting_confirmation",
+		"message": "waiting for the user to approve, edit or reject this call",
+	}, nil
+}
+
+// DenyConfirmableToolCall is a BeforeToolCallback for runs whose prompt
+// carries untrusted content, such as event triggers and webhooks. Nobody is
+// there to confirm a call, and the content may try to steer the agent, so
+// every side-effecting call of a confirmable tool fails without running,
+// whatever the user's confirmation settings say.
+func DenyConfirmableToolCall(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	if !callNeedsConfirmation(t.Name(), args) {
+		return nil, nil
+	}
+	slog.Warn("tool call denied in an unattended run", "tool", t.Name(), "function_call_id", ctx.FunctionCallID())
+	return map[string]any{
+		"success": false,
+		"error": fmt.Sprintf("%s requires confirmation in the web app and cannot run in this background run; "+
+			"do not retry it, report what you would have done instead", t.Name()),
+	}, nil
+}
+
+// RejectUnconfirmedToolCall is a BeforeToolCallback for clients that cannot
+// answer a confirmation prompt, such as the chat bots. A call that the user's
+// settings require confirming fails without running, so the policy holds
+// outside the web app; the other calls run as usual.
+func RejectUnconfirmedToolCall(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	if !callNeedsConfirmation(t.Name(), args) || !ToolConfirmationRequired(ctx, t.Name()) {
+		return nil, nil
+	}
+	slog.Info("tool call rejected: confirmation is not possible in this client", "tool", t.Name(), "function_call_id", ctx.FunctionCallID())
+	return map[string]any{
+		"success": false,
+		"error": fmt.Sprintf("%s requires confirmation in the web app; do not retry it here, tell the user to make this "+
+			"request in the web app or to turn off confirmation for %s in the settings", t.Name(), t.Name()),
+	}, nil
+}
+
+// confirmedArgs extracts edited arguments from a confirmation payload. The
+// payload is either a ToolConfirmationPayload or its JSON-decoded map form.
+func confirmedArgs(payload any) map[string]any {
+	var args map[string]any
+	switch p := payload.(type) {
+	case ToolConfirmationPayload:
+		args = p.Args
+	case *ToolConfirmationPayload:
+		if p != nil {
+			args = p.Args
+		}
+	case map[string]any:
+		args, _ = p["args"].(map[string]any)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"context"
+	"testing"
+
+	"golang.org/x/oauth2"
+	adksession "google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/toolconfirmation"
+)
+
+// confirmationToolContext records confirmation requests and can replay a
+// user decision.
+type confirmationToolContext struct {
+	fakeToolContext
+	confirmation *toolconfirmation.ToolConfirmation
+	requested    []any
+}
+
+func (c *confirmationToolContext) ToolConfirmation() *toolconfirmation.ToolConfirmation {
+	return c.confirmation
+}
+
+func (c *confirmationToolContext) RequestConfirmation(_ string, payload any) error {
+	c.requested = append(c.requested, payload)
+	return nil
+}
+
+func newConfirmationToolContext(ctx context.Context) *confirmationToolContext {
+	return &confirmationToolContext{
+		fakeToolContext: fakeToolContext{Context: ctx, actions: &adksession.EventActions{}},
+	}
+}
+
+func newSSHExecuteToolForTest(t *testing.T) tool.Tool {
+	t.Helper()
+	sshTool, err := NewSSHExecuteTool()
+	if err != nil {
+		t.Fatalf("NewSSHExecuteTool() error = %v", err)
+	}
+	return sshTool
+}
+
+func TestConfirmToolCallRequestsConfirmation(t *testing.T) {
+	toolCtx := newConfirmationToolContext(context.Background())
+	args := map[string]any{"command": "rm -rf /tmp/cache"}
+
+	result, err := ConfirmToolCall(toolCtx, newSSHExecuteToolForTest(t), args)
+	if err != nil {
+		t.Fatalf("ConfirmToolCall() error = %v", err)
+	}
+	if result["status"] != "awaiting_confirmation" {
+		t.Fatalf("ConfirmToolCall() result = %v, want awaiting_confirmation", result)
+	}
+	if len(toolCtx.requested) != 1 {
+		t.Fatalf("expected one confirmation request, got %d", len(toolCtx.requested))
+	}
+	payload, ok := toolCtx.requested[0].(ToolConfirmationPayload)
+	if !ok || payload.Args["command"] != "rm -rf /tmp/cache" {
+		t.Fatalf("unexpected confirmation payload %#v", toolCtx.requested[0])
+	}
+	if !toolCtx.actions.SkipSummarization {
+		t.Fatal("expected SkipSummarization to end the run")
+	}
+}
+
+func TestConfirmToolCallSkipsReadOnlyCalendarActions(t *testing.T) {
+	toolCtx := newConfirmationToolContext(context.Background())
+	calendarTool, err := NewCalendarTool(nil, &oauth2.Config{}, nil)
+	if err != nil {
+		t.Fatalf("NewCalendarTool() error = %v", err)
+	}
+
+	result, err := ConfirmToolCall(toolCtx, calendarTool, map[string]any{"action": "list_events"})
+	if err != nil || result != nil {
+		t.Fatalf("ConfirmToolCall() = %v, %v; want pass-through", result, err)
+	}
+
+	result, _ = ConfirmToolCall(toolCtx, calendarTool, map[string]any{"action": "delete_event", "event_id": "e1"})
+	if result == nil || len(toolCtx.requested) != 1 {
+		t.Fatalf("expected delete_event to require confirmation, got %v", result)
+	}
+}
+
+func TestConfirmToolCallHonorsUserSetting(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 7, ToolName: "ssh_execute", Required: false}).Error; err != nil {
+		t.Fatalf("create setting: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), constant.ContextKeyTx, db)
+	ctx = context.WithValue(ctx, constant.ContextKeyUserID, 7)
+	toolCtx := newConfirmationToolContext(ctx)
+
+	result, err := ConfirmToolCall(toolCtx, newSSHExecuteToolForTest(t), map[string]any{"command": "uptime"})
+	if err != nil || result != nil {
+		t.Fatalf("ConfirmToolCall() = %v, %v; want pass-through when disabled", result, err)
+	}
+
+	otherUser := context.WithValue(ctx, constant.ContextKeyUserID, 8)
+	if !ToolConfirmationRequired(otherUser, "ssh_execute") {
+		t.Fatal("expected confirmation to default to required for users without a setting")
+	}
+}
+
+func TestConfirmToolCallAppliesDecision(t *testing.T) {
+	sshTool := newSSHExecuteToolForTest(t)
+
+	rejected := newConfirmationToolContext(context.Background())
+	rejected.confirmation = &toolconfirmation.ToolConfirmation{Confirmed: false}
+	result, err := ConfirmToolCall(rejected, sshTool, map[string]any{"command": "reboot"})
+	if err != nil {
+		t.Fatalf("ConfirmToolCall() error = %v", err)
+	}
+	if result == nil || result["success"] != false {
+		t.Fatalf("expected rejection result, got %v", result)
+	}
+
+	edited := newConfirmationToolContext(context.Background())
+	edited.confirmation = &toolconfirmation.ToolConfirmation{
+		Confirmed: true,
+		Payload:   map[string]any{"args": map[string]any{"command": "uptime"}},
+	}
+	args := map[string]any{"command": "reboot", "server_name": "prod"}
+	result, err = ConfirmToolCall(edited, sshTool, args)
+	if err != nil || result != nil {
+		t.Fatalf("ConfirmToolCall() = %v, %v; want pass-through after approval", result, err)
+	}
+	if args["command"] != "uptime" || len(args) != 1 {
+		t.Fatalf("expected edited args to replace the originals, got %v", args)
+	}
+}
+
+func TestDenyConfirmableToolCall(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	// Untrusted runs deny the call even when the user turned confirmation off.
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 7, ToolName: "ssh_execute", Required: false}).Error; err != nil {
+		t.Fatalf("create setting: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), constant.ContextKeyTx, db)
+	ctx = context.WithValue(ctx, constant.ContextKeyUserID, 7)
+	toolCtx := newConfirmationToolContext(ctx)
+
+	result, err := DenyConfirmableToolCall(toolCtx, newSSHExecuteToolForTest(t), map[string]any{"command": "uptime"})
+	if err != nil {
+		t.Fatalf("DenyConfirmableToolCall() error = %v", err)
+	}
+	if result == nil || result["success"] != false || len(toolCtx.requested) != 0 {
+		t.Fatalf("DenyConfirmableToolCall() = %v, want a denial without a confirmation request", result)
+	}
+
+	calendarTool, err := NewCalendarTool(nil, &oauth2.Config{}, nil)
+	if err != nil {
+		t.Fatalf("NewCalendarTool() error = %v", err)
+	}
+	result, err = DenyConfirmableToolCall(toolCtx, calendarTool, map[string]any{"action": "list_events"})
+	if err != nil || result != nil {
+		t.Fatalf("DenyConfirmableToolCall() = %v, %v; want read-only calls to pass through", result, err)
+	}
+}
+
+func TestRejectUnconfirmedToolCallHonorsUserSetting(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.ToolConfirmationSetting{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	if err := db.Create(&table.ToolConfirmationSetting{UserID: 7, ToolName: "ssh_execute", Required: false}).Error; err != nil {
+		t.Fatalf("create setting: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), constant.ContextKeyTx, db)
+	sshTool := newSSHExecuteToolForTest(t)
+
+	required := newConfirmationToolContext(context.WithValue(ctx, constant.ContextKeyUserID, 8))
+	result, err := RejectUnconfirmedToolCall(required, sshTool, map[string]any{"command": "uptime"})
+	if err != nil {
+		t.Fatalf("RejectUnconfirmedToolCall() error = %v", err)
+	}
+	if result == nil || result["success"] != false || len(required.requested) != 0 {
+		t.Fatalf("RejectUnconfirmedToolCall() = %v, want a rejection without a confirmation request", result)
+	}
+
+	optedOut := newConfirmationToolContext(context.WithValue(ctx, constant.ContextKeyUserID, 7))
+	result, err = RejectUnconfirmedToolCall(optedOut, sshTool, map[string]any{"command": "uptime"})
+	if err != nil || result != nil {
+		t.Fatalf("RejectUnconfirmedToolCall() = %v, %v; want pass-through when confirmation is off", result, err)
+	}
+}
@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"gorm.io/gorm"
+)
+
+// maxNewEmailsPerPoll bounds how many new messages one poll of a mailbox
+// fetches; older ones are skipped.
+const maxNewEmailsPerPoll = 20
+
+// feedFetchTimeout bounds downloading a feed.
+const feedFetchTimeout = 30 * time.Second
+
+// EmailWatchFilter selects the messages an email trigger reacts to. Empty
+// fields match everything.
+type EmailWatchFilter struct {
+	ConfigName string // Email server config name; empty uses the default config
+	Mailbox    string // Defaults to INBOX
+	From       string // Substring of the From header
+	Subject    string // Substring of the Subject header
+}
+
+// EmailWatchState is the position of an email trigger in its mailbox.
+type EmailWatchState struct {
+	UIDValidity uint32 `json:"uid_validity"`
+	LastUID     uint32 `json:"last_uid"`
+}
+
+// FetchNewEmails returns the messages matching filter that arrived after
+// state, oldest first, together with the new state. The first poll (or a
+// poll after the mailbox UIDVALIDITY changed) only records the current
+// position and returns no messages, so existing mail does not fire.
+func FetchNewEmails(ctx context.Context, db *gorm.DB, userID int, filter EmailWatchFilter, state EmailWatchState) ([]EmailMessage, EmailWatchState, error) {
+	query := db.WithContext(ctx).Where("user_id = ?", userID)
+	if filter.ConfigName != "" {
+		query = query.Where("name = ?", filter.ConfigName)
+	}
+	var cfg table.EmailServerConfig
+	if err := query.Order("is_default DESC, created_at DESC").First(&cfg).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, state, fmt.Errorf("email server config not found")
+		}
+		return nil, state, fmt.Errorf("failed to load email server config: %w", err)
+	}
+
+	client, err := connectToIMAP(cfg.Server, cfg.Username, cfg.Password)
+	if err != nil {
+		return nil, state, err
+	}
+	defer client.Close()
+
+	mailbox := filter.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	selectData, err := client.Select(mailbox, nil).Wait()
+	if err != nil {
+		return nil, state, fmt.Errorf("failed to select mailbox %s: %w", mailbox, err)
+	}
+
+	if state.UIDValidity != selectData.UIDValidity || state.LastUID == 0 {
+		baseline := EmailWatchState{UIDValidity: selectData.UIDValidity}
+		if selectData.UIDNext > 0 {
+			baseline.LastUID = uint32(selectData.UIDNext) - 1
+		}
+		return nil, baseline, nil
+	}
+
+	criteria := &imap.SearchCriteria{
+		UID: []imap.UIDSet{{imap.UIDRange{Start: imap.UID(state.LastUID + 1), Stop: 0}}},
+	}
+	if filter.From != "" {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "From", Value: filter.From})
+	}
+	if filter.Subject != "" {
+		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: "Subject", Value: filter.Subject})
+	}
+	searchData, err := client.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		return nil, state, fmt.Errorf("failed to search mailbox: %w", err)
+	}
+
+	// "UID n:*" always matches the newest message, even when n is larger,
+	// so filter out what was already seen.
+	var uids []imap.UID
+	for _, uid := range searchData.AllUIDs() {
+		if uint32(uid) > state.LastUID {
+			uids = append(uids, uid)
+		}
+	}
+
+	next := state
+	if selectData.UIDNext > 0 {
+		next.LastUID = max(state.LastUID, uint32(selectData.UIDNext)-1)
+	}
+	if len(uids) == 0 {
+		return nil, next, nil
+	}
+	if len(uids) > maxNewEmailsPerPoll {
+		uids = uids[len(uids)-maxNewEmailsPerPoll:]
+	}
+
+	messages, _, err := fetchEmails(client, uids)
+	if err != nil {
+		return nil, state, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	for _, message := range messages {
+		next.LastUID = max(next.LastUID, message.UID)
+	}
+	return messages, next, nil
+}
+
+// FetchWebPageText returns the title and readable text of a web page,
+// using the same readability pipeline as the web_fetch tool.
+func FetchWebPageText(ctx context.Context, rawURL string) (string, string, error) {
+	output, err := executeWebFetch(ctx, WebFetchInput{URL: rawURL})
+	if err != nil {
+		return "", "", err
+	}
+	if !output.Success {
+		return "", "", errors.New(output.Error)
+	}
+	return output.Title, output.TextContent, nil
+}
+
+// FeedItem is one entry of an RSS or Atom feed.
+type FeedItem struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Link      string `json:"link,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Published string `json:"published,omitempty"`
+}
+
+// FetchFeedItems downloads and parses an RSS 2.0 or Atom feed. Items are
+// returned in document order, which is newest first for most feeds.
+func FetchFeedItems(ctx context.Context, client *http.Client, feedURL string) ([]FeedItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create feed request: %w", err)
+	}
+	req.Header.Set("User-Agent", webFetchUserAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch feed: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+	return ParseFeed(data)
+}
+
+type rssDocument struct {
+	XMLName xml.Name `xml:"rss"`
+	Items   []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+type atomDocument struct {
+	XMLName xml.Name `xml:"feed"`
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// ParseFeed parses an RSS 2.0 or Atom document. Items without a guid or id
+// are identified by their link, then by their title.
+func ParseFeed(data []byte) ([]FeedItem, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	var items []FeedItem
+	switch root.XMLName.Local {
+	case "rss":
+		var doc rssDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid rss feed: %w", err)
+		}
+		for _, item := range doc.Items {
+			items = append(items, FeedItem{
+				ID:        firstNonEmpty(item.GUID, item.Link, item.Title),
+				Title:     strings.TrimSpace(item.Title),
+				Link:      strings.TrimSpace(item.Link),
+				Summary:   strings.TrimSpace(item.Description),
+				Published: strings.TrimSpace(item.PubDate),
+			})
+		}
+	case "feed":
+		var doc atomDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid atom feed: %w", err)
+		}
+		for _, entry := range doc.Entries {
+			var link string
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			items = append(items, FeedItem{
+				ID:        firstNonEmpty(entry.ID, link, entry.Title),
+				Title:     strings.TrimSpace(entry.Title),
+				Link:      strings.TrimSpace(link),
+				Summary:   strings.TrimSpace(firstNonEmpty(entry.Summary, entry.Content)),
+				Published: strings.TrimSpace(firstNonEmpty(entry.Published, entry.Updated)),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed format: <%s>", root.XMLName.Local)
+	}
+	return items, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseFeed_RSS(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Blog</title>
+<item><guid>post-2</guid><title>Second</title><link>https://example.com/2</link><description>two</description><pubDate>Tue, 02 Jun 2026 08:00:00 GMT</pubDate></item>
+<item><title>First</title><link>https://example.com/1</link></item>
+</channel></rss>`)
+
+	items, err := ParseFeed(data)
+	if err != nil {
+		t.Fatalf("ParseFeed() error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].ID != "post-2" || items[0].Title != "Second" || items[0].Summary != "two" {
+		t.Errorf("items[0] = %+v", items[0])
+	}
+	if items[1].ID != "https://example.com/1" {
+		t.Errorf("items[1].ID = %q, want the link as fallback id", items[1].ID)
+	}
+}
+
+func TestParseFeed_Atom(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Releases</title>
+<entry><id>tag:example.com,2026:v2</id><title>v2</title>
+<link rel="self" href="https://example.com/self"/><link href="https://example.com/v2"/>
+<content>notes</content><updated>2026-06-02T08:00:00Z</updated></entry>
+</feed>`)
+
+	items, err := ParseFeed(data)
+	if err != nil {
+		t.Fatalf("ParseFeed() error: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	want := FeedItem{ID: "tag:example.com,2026:v2", Title: "v2", Link: "https://example.com/v2", Summary: "notes", Published: "2026-06-02T08:00:00Z"}
+	if items[0] != want {
+		t.Errorf("items[0] = %+v, want %+v", items[0], want)
+	}
+}
+
+func TestParseFeed_Invalid(t *testing.T) {
+	for _, data := range []string{"not xml", "<html><body/></html>"} {
+		if _, err := ParseFeed([]byte(data)); err == nil {
+			t.Errorf("ParseFeed(%q) expected error", data)
+		}
+	}
+}
+
+func TestFetchFeedItems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss><channel><item><guid>a</guid><title>A</title></item></channel></rss>`))
+	}))
+	defer server.Close()
+
+	items, err := FetchFeedItems(context.Background(), server.Client(), server.URL+"/feed")
+	if err != nil {
+		t.Fatalf("FetchFeedItems() error: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "a" {
+		t.Fatalf("items = %+v", items)
+	}
+
+	if _, err := FetchFeedItems(context.Background(), server.Client(), server.URL+"/missing"); err == nil {
+		t.Fatal("FetchFeedItems() expected error for HTTP 404")
+	}
+}
@@ -0,0 +1,412 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+)
+
+// MCP transports supported by MCPServerConfig.
+const (
+	MCPTransportStdio = "stdio"
+	MCPTransportHTTP  = "http"
+)
+
+// MCPToolPrefix prefixes the names of all tools exposed from MCP servers so
+// they never collide with built-in tools.
+const MCPToolPrefix = "mcp_"
+
+// maxToolNameLength is the function name limit imposed by Gemini.
+const maxToolNameLength = 64
+
+// MCPServerConfig describes an external Model Context Protocol server.
+type MCPServerConfig struct {
+	// Name identifies the server and becomes part of each tool name.
+	Name string
+	// Transport is "stdio" (spawn Command) or "http" (streamable HTTP at URL).
+	Transport string
+
+	Command string
+	Args    []string
+	Env     map[string]string
+
+	URL     string
+	Headers map[string]string
+}
+
+// Validate checks that the fields required by the transport are present.
+func (c MCPServerConfig) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("mcp server name is required")
+	}
+	switch c.Transport {
+	case MCPTransportStdio:
+		if c.Command == "" {
+			return fmt.Errorf("mcp server %q: command is required for stdio transport", c.Name)
+		}
+	case MCPTransportHTTP:
+		if c.URL == "" {
+			return fmt.Errorf("mcp server %q: url is required for http transport", c.Name)
+		}
+	default:
+		return fmt.Errorf("mcp server %q: unsupported transport %q (want stdio or http)", c.Name, c.Transport)
+	}
+	return nil
+}
+
+// mcpRefreshableErrors trigger a reconnect and a single retry.
+var mcpRefreshableErrors = []error{
+	mcp.ErrConnectionClosed,
+	mcp.ErrSessionMissing,
+	io.ErrClosedPipe,
+	io.EOF,
+}
+
+func isMCPConnectionError(err error) bool {
+	for _, target := range mcpRefreshableErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MCPToolset exposes the tools of one MCP server as ADK tools.
+//
+// Tools are discovered when Connect is called at startup and cached. The cache
+// is refreshed after the server sends notifications/tools/list_changed and
+// after a reconnect. Broken connections are re-established transparently on
+// the next list or call.
+type MCPToolset struct {
+	cfg        MCPServerConfig
+	namePrefix string
+	httpClient *http.Client
+	client     *mcp.Client
+
+	mu      sync.Mutex
+	session *mcp.ClientSession
+	tools   []tool.Tool
+	stale   bool
+}
+
+// NewMCPToolset creates a toolset for cfg. namePrefix is prepended to every
+// tool name and defaults to MCPToolPrefix. httpClient is used for the http
+// transport and may be nil.
+func NewMCPToolset(cfg MCPServerConfig, namePrefix string, httpClient *http.Client) (*MCPToolset, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if namePrefix == "" {
+		namePrefix = MCPToolPrefix
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	s := &MCPToolset{
+		cfg:        cfg,
+		namePrefix: namePrefix,
+		httpClient: httpClient,
+		stale:      true,
+	}
+	s.client = mcp.NewClient(&mcp.Implementation{Name: "aiguide", Version: "1.0.0"}, &mcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *mcp.ToolListChangedRequest) {
+			slog.Info("mcp tool list changed", "server", cfg.Name)
+			s.mu.Lock()
+			s.stale = true
+			s.mu.Unlock()
+		},
+	})
+	return s, nil
+}
+
+// Name implements tool.Toolset.
+func (s *MCPToolset) Name() string {
+	return s.namePrefix + sanitizeToolName(s.cfg.Name)
+}
+
+// ServerName returns the configured server name.
+func (s *MCPToolset) ServerName() string {
+	return s.cfg.Name
+}
+
+// Connect establishes the session and discovers the server's tools.
+func (s *MCPToolset) Connect(ctx context.Context) error {
+	_, err := s.refreshTools(ctx)
+	return err
+}
+
+// Tools implements tool.Toolset. It returns the cached tools, refreshing them
+// first if the server announced a change. If the refresh fails the last known
+// tools are returned so that one unavailable server does not break the agent.
+func (s *MCPToolset) Tools(ctx agent.ReadonlyContext) ([]tool.Tool, error) {
+	s.mu.Lock()
+	stale, cached := s.stale, s.tools
+	s.mu.Unlock()
+	if !stale {
+		return cached, nil
+	}
+
+	tools, err := s.refreshTools(ctx)
+	if err != nil {
+		slog.Error("failed to refresh mcp tools, using cached list", "server", s.cfg.Name, "err", err)
+		return cached, nil
+	}
+	return tools, nil
+}
+
+// Close shuts down the session, terminating stdio servers.
+func (s *MCPToolset) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session == nil {
+		return nil
+	}
+	err := s.session.Close()
+	s.session = nil
+	return err
+}
+
+func (s *MCPToolset) newTransport() mcp.Transport {
+	if s.cfg.Transport == MCPTransportStdio {
+		cmd := exec.Command(s.cfg.Command, s.cfg.Args...)
+		cmd.Env = os.Environ()
+		for k, v := range s.cfg.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		return &mcp.CommandTransport{Command: cmd}
+	}
+
+	httpClient := s.httpClient
+	if len(s.cfg.Headers) > 0 {
+		base := httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		clone := *httpClient
+		clone.Transport = &headerRoundTripper{base: base, headers: s.cfg.Headers}
+		httpClient = &clone
+	}
+	return &mcp.StreamableClientTransport{Endpoint: s.cfg.URL, HTTPClient: httpClient}
+}
+
+// getSession returns the live session, connecting if necessary.
+func (s *MCPToolset) getSession(ctx context.Context) (*mcp.ClientSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session != nil {
+		return s.session, nil
+	}
+	return s.connectLocked(ctx)
+}
+
+// reconnect replaces a broken session. If another goroutine already
+// reconnected, its session is reused.
+func (s *MCPToolset) reconnect(ctx context.Context, broken *mcp.ClientSession) (*mcp.ClientSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session != nil && s.session != broken {
+		return s.session, nil
+	}
+	if s.session != nil {
+		if err := s.session.Close(); err != nil {
+			slog.Warn("failed to close broken mcp session", "server", s.cfg.Name, "err", err)
+		}
+		s.session = nil
+	}
+	slog.Info("reconnecting to mcp server", "server", s.cfg.Name)
+	// Tools may have changed while we were disconnected.
+	s.stale = true
+	return s.connectLocked(ctx)
+}
+
+func (s *MCPToolset) connectLocked(ctx context.Context) (*mcp.ClientSession, error) {
+	session, err := s.client.Connect(ctx, s.newTransport(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mcp server %q: %w", s.cfg.Name, err)
+	}
+	s.session = session
+	return session, nil
+}
+
+// withMCPSession runs fn, reconnecting and retrying once on connection errors.
+func withMCPSession[T any](ctx context.Context, s *MCPToolset, fn func(*mcp.ClientSession) (T, error)) (T, error) {
+	session, err := s.getSession(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	result, err := fn(session)
+	if err == nil || !isMCPConnectionError(err) {
+		return result, err
+	}
+
+	session, rerr := s.reconnect(ctx, session)
+	if rerr != nil {
+		var zero T
+		return zero, fmt.Errorf("%w (reconnect failed: %v)", err, rerr)
+	}
+	return fn(session)
+}
+
+func (s *MCPToolset) refreshTools(ctx context.Context) ([]tool.Tool, error) {
+	mcpTools, err := withMCPSession(ctx, s, func(session *mcp.ClientSession) ([]*mcp.Tool, error) {
+		var all []*mcp.Tool
+		cursor := ""
+		for {
+			resp, err := session.ListTools(ctx, &mcp.ListToolsParams{Cursor: cursor})
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, resp.Tools...)
+			if resp.NextCursor == "" {
+				return all, nil
+			}
+			cursor = resp.NextCursor
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tools of mcp server %q: %w", s.cfg.Name, err)
+	}
+
+	tools := make([]tool.Tool, 0, len(mcpTools))
+	for _, t := range mcpTools {
+		tools = append(tools, s.wrapTool(t))
+	}
+
+	s.mu.Lock()
+	s.tools = tools
+	s.stale = false
+	s.mu.Unlock()
+
+	slog.Info("mcp tools discovered", "server", s.cfg.Name, "count", len(tools))
+	return tools, nil
+}
+
+func (s *MCPToolset) wrapTool(t *mcp.Tool) *mcpTool {
+	name := s.Name() + "__" + sanitizeToolName(t.Name)
+	if len(name) > maxToolNameLength {
+		name = name[:maxToolNameLength]
+	}
+	description := t.Description
+	if description == "" {
+		description = t.Title
+	}
+	description = fmt.Sprintf("[MCP server %s] %s", s.cfg.Name, description)
+
+	decl := &genai.FunctionDeclaration{
+		Name:        name,
+		Description: description,
+	}
+	// Keep the interface nil when the schema is missing so it is omitted from
+	// the request instead of being sent as null.
+	if t.InputSchema != nil {
+		decl.ParametersJsonSchema = t.InputSchema
+	}
+
+	return &mcpTool{
+		name:        name,
+		remoteName:  t.Name,
+		description: description,
+		declaration: decl,
+		set:         s,
+	}
+}
+
+func (s *MCPToolset) callTool(ctx context.Context, name string, args any) (*mcp.CallToolResult, error) {
+	return withMCPSession(ctx, s, func(session *mcp.ClientSession) (*mcp.CallToolResult, error) {
+		return session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+	})
+}
+
+// mcpTool is a single tool of an MCP server.
+type mcpTool struct {
+	name        string
+	remoteName  string
+	description string
+	declaration *genai.FunctionDeclaration
+	set         *MCPToolset
+}
+
+func (t *mcpTool) Name() string        { return t.name }
+func (t *mcpTool) Description() string { return t.description }
+func (t *mcpTool) IsLongRunning() bool { return false }
+
+func (t *mcpTool) Declaration() *genai.FunctionDeclaration {
+	return t.declaration
+}
+
+// ProcessRequest adds the tool's declaration to the LLM request.
+func (t *mcpTool) ProcessRequest(_ tool.Context, req *model.LLMRequest) error {
+	return addFunctionDeclaration(req, t, t.declaration)
+}
+
+// Run calls the remote tool and converts its result into a tool response.
+func (t *mcpTool) Run(ctx tool.Context, args any) (map[string]any, error) {
+	res, err := t.set.callTool(ctx, t.remoteName, args)
+	if err != nil {
+		slog.Error("failed to call mcp tool", "server", t.set.cfg.Name, "tool", t.remoteName, "err", err)
+		return nil, fmt.Errorf("failed to call mcp tool %q: %w", t.remoteName, err)
+	}
+
+	text := mcpResultText(res)
+	if res.IsError {
+		if text == "" {
+			text = "tool execution failed"
+		}
+		return map[string]any{"success": false, "error": text}, nil
+	}
+	if res.StructuredContent != nil {
+		return map[string]any{"success": true, "output": res.StructuredContent}, nil
+	}
+	return map[string]any{"success": true, "output": text}, nil
+}
+
+func mcpResultText(res *mcp.CallToolResult) string {
+	var sb strings.Builder
+	for _, c := range res.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			if sb.Len() > 0 {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
+
+var toolNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// sanitizeToolName maps a server, API or operation name onto the characters allowed in
+// function names.
+func sanitizeToolName(name string) string {
+	return strings.Trim(toolNameInvalidChars.ReplaceAllString(name, "_"), "_")
+}
+
+// headerRoundTripper adds static headers (e.g. Authorization) to requests.
+type headerRoundTripper struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	return h.base.RoundTrip(req)
+}
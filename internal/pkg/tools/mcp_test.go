@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/secret"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	adksession "google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+)
+
+type echoInput struct {
+	Text string `json:"text"`
+}
+
+func newTestMCPServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo", Description: "Echo the input"},
+		func(_ context.Context, _ *mcp.CallToolRequest, in echoInput) (*mcp.CallToolResult, any, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "echo: " + in.Text}}}, nil, nil
+		})
+	return server
+}
+
+// swappableHandler lets a test replace the MCP server, dropping all sessions
+// as a server restart would.
+type swappableHandler struct {
+	handler    atomic.Pointer[http.Handler]
+	authHeader atomic.Value
+}
+
+func (h *swappableHandler) set(server *mcp.Server) {
+	var handler http.Handler = mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)
+	h.handler.Store(&handler)
+}
+
+func (h *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.authHeader.Store(r.Header.Get("Authorization"))
+	(*h.handler.Load()).ServeHTTP(w, r)
+}
+
+// newTestMCPHTTPServer registers the server shutdown as a cleanup so that it
+// runs after the toolset's session is closed; otherwise the open SSE stream
+// blocks httptest.Server.Close.
+func newTestMCPHTTPServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestMCPToolset(t *testing.T, url string) *MCPToolset {
+	t.Helper()
+	set, err := NewMCPToolset(MCPServerConfig{
+		Name:      "test server",
+		Transport: MCPTransportHTTP,
+		URL:       url,
+		Headers:   map[string]string{"Authorization": "Bearer secret"},
+	}, "", nil)
+	if err != nil {
+		t.Fatalf("NewMCPToolset() error = %v", err)
+	}
+	t.Cleanup(func() { _ = set.Close() })
+	return set
+}
+
+func mcpToolContext(ctx context.Context) *fakeToolContext {
+	return &fakeToolContext{Context: ctx, actions: &adksession.EventActions{}}
+}
+
+func findMCPTool(t *testing.T, set tool.Toolset, ctx *fakeToolContext, name string) tool.Tool {
+	t.Helper()
+	found, err := set.Tools(ctx)
+	if err != nil {
+		t.Fatalf("Tools() error = %v", err)
+	}
+	for _, ft := range found {
+		if ft.Name() == name {
+			return ft
+		}
+	}
+	return nil
+}
+
+func runMCPTool(t *testing.T, ctx *fakeToolContext, mt tool.Tool, args map[string]any) map[string]any {
+	t.Helper()
+	runnable, ok := mt.(interface {
+		Run(tool.Context, any) (map[string]any, error)
+	})
+	if !ok {
+		t.Fatalf("tool %q is not runnable", mt.Name())
+	}
+	result, err := runnable.Run(ctx, args)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	return result
+}
+
+func TestMCPServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     MCPServerConfig
+		wantErr bool
+	}{
+		{"stdio", MCPServerConfig{Name: "fs", Transport: MCPTransportStdio, Command: "npx"}, false},
+		{"http", MCPServerConfig{Name: "wiki", Transport: MCPTransportHTTP, URL: "http://localhost/mcp"}, false},
+		{"missing name", MCPServerConfig{Transport: MCPTransportHTTP, URL: "http://localhost/mcp"}, true},
+		{"stdio without command", MCPServerConfig{Name: "fs", Transport: MCPTransportStdio}, true},
+		{"http without url", MCPServerConfig{Name: "wiki", Transport: MCPTransportHTTP}, true},
+		{"unknown transport", MCPServerConfig{Name: "x", Transport: "sse"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMCPToolsetDiscoversAndCallsTools(t *testing.T) {
+	handler := &swappableHandler{}
+	handler.set(newTestMCPServer())
+	srv := newTestMCPHTTPServer(t, handler)
+
+	set := newTestMCPToolset(t, srv.URL)
+	if set.Name() != "mcp_test_server" {
+		t.Fatalf("Name() = %q, want mcp_test_server", set.Name())
+	}
+	if err := set.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	toolCtx := mcpToolContext(context.Background())
+	echo := findMCPTool(t, set, toolCtx, "mcp_test_server__echo")
+	if echo == nil {
+		t.Fatal("echo tool not discovered")
+	}
+	if !strings.Contains(echo.Description(), "[MCP server test server]") {
+		t.Fatalf("Description() = %q, want server prefix", echo.Description())
+	}
+
+	result := runMCPTool(t, toolCtx, echo, map[string]any{"text": "hi"})
+	if result["success"] != true || result["output"] != "echo: hi" {
+		t.Fatalf("Run() result = %v", result)
+	}
+	if got, _ := handler.authHeader.Load().(string); got != "Bearer secret" {
+		t.Fatalf("Authorization header = %q, want configured header", got)
+	}
+}
+
+func TestMCPToolsetRefreshesOnListChanged(t *testing.T) {
+	server := newTestMCPServer()
+	handler := &swappableHandler{}
+	handler.set(server)
+	srv := newTestMCPHTTPServer(t, handler)
+
+	set := newTestMCPToolset(t, srv.URL)
+	if err := set.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	server.AddTool(&mcp.Tool{Name: "ping", InputSchema: map[string]any{"type": "object"}},
+		func(context.Context, *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "pong"}}}, nil
+		})
+
+	toolCtx := mcpToolContext(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for findMCPTool(t, set, toolCtx, "mcp_test_server__ping") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("tool list was not refreshed after notifications/tools/list_changed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMCPToolsetReconnectsAfterServerRestart(t *testing.T) {
+	handler := &swappableHandler{}
+	handler.set(newTestMCPServer())
+	srv := newTestMCPHTTPServer(t, handler)
+
+	set := newTestMCPToolset(t, srv.URL)
+	toolCtx := mcpToolContext(context.Background())
+	echo := findMCPTool(t, set, toolCtx, "mcp_test_server__echo")
+	if echo == nil {
+		t.Fatal("echo tool not discovered")
+	}
+
+	// A restarted server no longer knows the old session ID.
+	handler.set(newTestMCPServer())
+
+	result := runMCPTool(t, toolCtx, echo, map[string]any{"text": "again"})
+	if result["output"] != "echo: again" {
+		t.Fatalf("Run() after restart = %v", result)
+	}
+}
+
+func TestUserMCPToolsetLoadsEnabledServers(t *testing.T) {
+	handler := &swappableHandler{}
+	handler.set(newTestMCPServer())
+	srv := newTestMCPHTTPServer(t, handler)
+
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.MCPServerConfig{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	cipher, err := secret.NewCipher("test-key")
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	headers, err := EncryptMCPHeaders(map[string]string{"Authorization": "Bearer user"}, cipher)
+	if err != nil {
+		t.Fatalf("EncryptMCPHeaders() error = %v", err)
+	}
+	configs := []table.MCPServerConfig{
+		{UserID: 1, Name: "mine", URL: srv.URL, Headers: headers, Enabled: true},
+		{UserID: 1, Name: "disabled", URL: srv.URL, Enabled: false},
+		{UserID: 2, Name: "theirs", URL: srv.URL, Enabled: true},
+	}
+	if err := db.Create(&configs).Error; err != nil {
+		t.Fatalf("create configs: %v", err)
+	}
+
+	set := NewUserMCPToolset(db, cipher, nil)
+	t.Cleanup(func() { _ = set.Close() })
+
+	ctx := context.WithValue(context.Background(), constant.ContextKeyUserID, 1)
+	found, err := set.Tools(mcpToolContext(ctx))
+	if err != nil {
+		t.Fatalf("Tools() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Name() != "mcp_u_mine__echo" {
+		names := make([]string, 0, len(found))
+		for _, ft := range found {
+			names = append(names, ft.Name())
+		}
+		t.Fatalf("Tools() = %v, want [mcp_u_mine__echo]", names)
+	}
+	if got, _ := handler.authHeader.Load().(string); got != "Bearer user" {
+		t.Fatalf("Authorization header = %q, want stored header", got)
+	}
+
+	anonymous, err := set.Tools(mcpToolContext(context.Background()))
+	if err != nil || len(anonymous) != 0 {
+		t.Fatalf("Tools() without user = %v, %v; want none", anonymous, err)
+	}
+}
+
+func TestSanitizeToolName(t *testing.T) {
+	if got := sanitizeToolName(" My Server/v2 "); got != "My_Server_v2" {
+		t.Fatalf("sanitizeToolName() = %q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/secret"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/tool"
+	"gorm.io/gorm"
+)
+
+// UserMCPToolPrefix prefixes tools of per-user MCP servers so they cannot
+// shadow servers declared in the YAML config.
+const UserMCPToolPrefix = MCPToolPrefix + "u_"
+
+// EncryptMCPHeaders encodes headers for the headers column of
+// table.MCPServerConfig. They often carry bearer tokens, so the JSON is
+// encrypted; no headers are stored as an empty string.
+func EncryptMCPHeaders(headers map[string]string, cipher *secret.Cipher) (string, error) {
+	if len(headers) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(headers)
+	if err != nil {
+		return "", fmt.Errorf("invalid mcp headers: %w", err)
+	}
+	return cipher.Encrypt(string(raw))
+}
+
+// ParseMCPHeaders decrypts and decodes the headers column of
+// table.MCPServerConfig.
+func ParseMCPHeaders(raw string, cipher *secret.Cipher) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	plain, err := cipher.Decrypt(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt mcp headers: %w", err)
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(plain), &headers); err != nil {
+		return nil, fmt.Errorf("invalid mcp headers: %w", err)
+	}
+	return headers, nil
+}
+
+// UserMCPToolset exposes the MCP servers the current user added in settings.
+// The user is resolved from the invocation context on every call to Tools,
+// and one MCPToolset per stored server is kept until the row changes.
+type UserMCPToolset struct {
+	db         *gorm.DB
+	cipher     *secret.Cipher
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	sets map[int]*userMCPEntry
+}
+
+type userMCPEntry struct {
+	userID    int
+	updatedAt time.Time
+	set       *MCPToolset
+}
+
+// NewUserMCPToolset creates the per-user MCP toolset. cipher decrypts the
+// stored headers.
+func NewUserMCPToolset(db *gorm.DB, cipher *secret.Cipher, httpClient *http.Client) *UserMCPToolset {
+	return &UserMCPToolset{
+		db:         db,
+		cipher:     cipher,
+		httpClient: httpClient,
+		sets:       make(map[int]*userMCPEntry),
+	}
+}
+
+// Name implements tool.Toolset.
+func (u *UserMCPToolset) Name() string {
+	return "user_mcp_servers"
+}
+
+// Tools implements tool.Toolset. Servers that cannot be reached are skipped
+// so that one broken server does not hide the others.
+func (u *UserMCPToolset) Tools(ctx agent.ReadonlyContext) ([]tool.Tool, error) {
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		return nil, nil
+	}
+	db := u.db
+	if tx, ok := middleware.GetTx(ctx); ok {
+		db = tx
+	}
+	if db == nil {
+		return nil, nil
+	}
+
+	var configs []table.MCPServerConfig
+	if err := db.Where("user_id = ? AND enabled = ?", userID, true).Order("id").Find(&configs).Error; err != nil {
+		slog.Error("failed to query user mcp servers", "user_id", userID, "err", err)
+		return nil, nil
+	}
+	u.pruneDeleted(userID, configs)
+
+	var result []tool.Tool
+	for _, cfg := range configs {
+		set, err := u.toolsetFor(cfg)
+		if err != nil {
+			slog.Error("failed to create user mcp toolset", "user_id", userID, "server", cfg.Name, "err", err)
+			continue
+		}
+		tools, err := set.Tools(ctx)
+		if err != nil {
+			slog.Error("failed to list user mcp tools", "user_id", userID, "server", cfg.Name, "err", err)
+			continue
+		}
+		result = append(result, tools...)
+	}
+	return result, nil
+}
+
+// toolsetFor returns the cached toolset for cfg, replacing it when the stored
+// row has been updated since it was created.
+func (u *UserMCPToolset) toolsetFor(cfg table.MCPServerConfig) (*MCPToolset, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if entry, ok := u.sets[cfg.ID]; ok {
+		if entry.updatedAt.Equal(cfg.UpdatedAt) {
+			return entry.set, nil
+		}
+		if err := entry.set.Close(); err != nil {
+			slog.Warn("failed to close outdated user mcp session", "server", cfg.Name, "err", err)
+		}
+		delete(u.sets, cfg.ID)
+	}
+
+	headers, err := ParseMCPHeaders(cfg.Headers, u.cipher)
+	if err != nil {
+		return nil, err
+	}
+	set, err := NewMCPToolset(MCPServerConfig{
+		Name:      cfg.Name,
+		Transport: MCPTransportHTTP,
+		URL:       cfg.URL,
+		Headers:   headers,
+	}, UserMCPToolPrefix, u.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	u.sets[cfg.ID] = &userMCPEntry{userID: cfg.UserID, updatedAt: cfg.UpdatedAt, set: set}
+	return set, nil
+}
+
+// pruneDeleted closes the sessions of servers the user deleted or disabled.
+func (u *UserMCPToolset) pruneDeleted(userID int, configs []table.MCPServerConfig) {
+	active := make(map[int]bool, len(configs))
+	for _, cfg := range configs {
+		active[cfg.ID] = true
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, entry := range u.sets {
+		if entry.userID != userID || active[id] {
+			continue
+		}
+		if err := entry.set.Close(); err != nil {
+			slog.Warn("failed to close removed user mcp session", "server", entry.set.ServerName(), "err", err)
+		}
+		delete(u.sets, id)
+	}
+}
+
+// Close shuts down all cached sessions.
+func (u *UserMCPToolset) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, entry := range u.sets {
+		if err := entry.set.Close(); err != nil {
+			slog.Warn("failed to close user mcp session", "server", entry.set.ServerName(), "err", err)
+		}
+		delete(u.sets, id)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+
+	"aiguide/internal/app/aiguide/table"
+)
+
+// Notifier publishes in-app notifications, e.g. when a long running tool
+// finishes after the user has left the conversation.
+type Notifier interface {
+	Notify(ctx context.Context, n table.Notification) error
+}
+
+// sendNotification publishes n through notifier. A nil notifier disables
+// notifications; failures are logged and never fail the tool call.
+func sendNotification(ctx context.Context, notifier Notifier, n table.Notification) {
+	if notifier == nil || n.UserID <= 0 {
+		return
+	}
+	if err := notifier.Notify(ctx, n); err != nil {
+		slog.Warn("failed to send notification", "err", err, "user_id", n.UserID, "kind", n.Kind)
+	}
+}
+
+// sessionLink returns the frontend path of a chat session.
+func sessionLink(sessionID string) string {
+	if sessionID == "" {
+		return ""
+	}
+	return "/chat/" + sessionID
+}
@@ -0,0 +1,681 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+	"gopkg.in/yaml.v3"
+)
+
+// Authentication schemes supported for OpenAPI tools.
+const (
+	OpenAPIAuthNone   = "none"
+	OpenAPIAuthHeader = "header" // AuthSecret sent in the AuthHeader header
+	OpenAPIAuthBearer = "bearer" // Authorization: Bearer <AuthSecret>
+	OpenAPIAuthBasic  = "basic"  // Authorization: Basic AuthUsername:AuthSecret
+)
+
+// OpenAPIToolPrefix prefixes the names of tools generated from OpenAPI
+// documents declared in the YAML config.
+const OpenAPIToolPrefix = "api_"
+
+const (
+	openAPIMaxSchemaDepth      = 8
+	openAPIMaxDescriptionLen   = 1024
+	openAPIMaxResponseBytes    = 64 * 1024
+	openAPIRequestTimeout      = 60 * time.Second
+	openAPIBodyArgName         = "body"
+	openAPIDefaultJSONMimeType = "application/json"
+)
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+// OpenAPIConfig describes a REST API whose operations become tools.
+type OpenAPIConfig struct {
+	// Name identifies the API and becomes part of each tool name.
+	Name string
+	// Spec is the OpenAPI 3 document, in JSON or YAML.
+	Spec []byte
+	// BaseURL overrides the first server URL of the document.
+	BaseURL string
+
+	AuthType     string
+	AuthHeader   string // header name for OpenAPIAuthHeader, e.g. X-API-Key
+	AuthUsername string // user name for OpenAPIAuthBasic
+	AuthSecret   string // header value, bearer token or basic password
+
+	// Operations lists the operation IDs to expose. Empty exposes all.
+	Operations []string
+}
+
+// Validate checks the fields that do not depend on the document.
+func (c OpenAPIConfig) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("openapi tool name is required")
+	}
+	switch c.AuthType {
+	case "", OpenAPIAuthNone, OpenAPIAuthBearer, OpenAPIAuthBasic:
+	case OpenAPIAuthHeader:
+		if c.AuthHeader == "" {
+			return fmt.Errorf("openapi tool %q: auth header name is required for header auth", c.Name)
+		}
+	default:
+		return fmt.Errorf("openapi tool %q: unsupported auth type %q (want none, header, bearer or basic)", c.Name, c.AuthType)
+	}
+	return nil
+}
+
+// OpenAPISpec is the subset of an OpenAPI 3 document needed to build tools.
+type OpenAPISpec struct {
+	Title      string             `json:"title"`
+	Version    string             `json:"version"`
+	ServerURL  string             `json:"server_url"`
+	Operations []OpenAPIOperation `json:"operations"`
+}
+
+// OpenAPIOperation is a single HTTP operation of the document.
+type OpenAPIOperation struct {
+	ID          string `json:"operation_id"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"-"`
+
+	Parameters      []OpenAPIParameter `json:"-"`
+	BodySchema      map[string]any     `json:"-"`
+	BodyContentType string             `json:"-"`
+	BodyRequired    bool               `json:"-"`
+}
+
+// OpenAPIParameter is a path, query or header parameter.
+type OpenAPIParameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      map[string]any
+}
+
+// ParseOpenAPISpec parses an OpenAPI 3 document in JSON or YAML. Local $refs
+// (#/components/...) are resolved; schemas are converted to plain JSON
+// Schema suitable for function declarations.
+func ParseOpenAPISpec(data []byte) (*OpenAPISpec, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %w", err)
+	}
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q: only OpenAPI 3 is supported", version)
+	}
+
+	r := &openAPIResolver{doc: doc}
+	spec := &OpenAPISpec{}
+	if info, ok := doc["info"].(map[string]any); ok {
+		spec.Title, _ = info["title"].(string)
+		spec.Version = fmt.Sprint(info["version"])
+	}
+	if servers, ok := doc["servers"].([]any); ok && len(servers) > 0 {
+		if server, ok := servers[0].(map[string]any); ok {
+			spec.ServerURL, _ = server["url"].(string)
+		}
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	pathKeys := make([]string, 0, len(paths))
+	for p := range paths {
+		pathKeys = append(pathKeys, p)
+	}
+	slices.Sort(pathKeys)
+
+	seen := make(map[string]bool)
+	for _, path := range pathKeys {
+		item := r.resolve(paths[path])
+		if item == nil {
+			continue
+		}
+		shared := r.parameters(item["parameters"])
+		for _, method := range openAPIMethods {
+			raw := r.resolve(item[method])
+			if raw == nil {
+				continue
+			}
+			op := r.operation(method, path, raw, shared)
+			if seen[op.ID] {
+				return nil, fmt.Errorf("duplicate operation id %q", op.ID)
+			}
+			seen[op.ID] = true
+			spec.Operations = append(spec.Operations, op)
+		}
+	}
+	if len(spec.Operations) == 0 {
+		return nil, errors.New("openapi document has no operations")
+	}
+	return spec, nil
+}
+
+// openAPIResolver resolves local references within one document.
+type openAPIResolver struct {
+	doc map[string]any
+}
+
+// resolve follows $ref chains and returns the referenced object, or nil if
+// node is not an object or a reference cannot be resolved.
+func (r *openAPIResolver) resolve(node any) map[string]any {
+	for range openAPIMaxSchemaDepth {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		node = r.lookup(ref)
+	}
+	return nil
+}
+
+// lookup evaluates a local JSON pointer such as #/components/schemas/Pet.
+func (r *openAPIResolver) lookup(ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		slog.Warn("ignoring non-local openapi reference", "ref", ref)
+		return nil
+	}
+	var node any = r.doc
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[token]
+	}
+	return node
+}
+
+func (r *openAPIResolver) operation(method, path string, raw map[string]any, shared []OpenAPIParameter) OpenAPIOperation {
+	op := OpenAPIOperation{
+		Method: strings.ToUpper(method),
+		Path:   path,
+	}
+	op.ID, _ = raw["operationId"].(string)
+	if op.ID == "" {
+		op.ID = sanitizeToolName(method + "_" + path)
+	}
+	op.Summary, _ = raw["summary"].(string)
+	op.Description, _ = raw["description"].(string)
+
+	// Operation-level parameters override path-level ones with the same name and location.
+	params := r.parameters(raw["parameters"])
+	for _, p := range shared {
+		if !slices.ContainsFunc(params, func(o OpenAPIParameter) bool { return o.Name == p.Name && o.In == p.In }) {
+			params = append(params, p)
+		}
+	}
+	op.Parameters = params
+
+	if body := r.resolve(raw["requestBody"]); body != nil {
+		op.BodyRequired, _ = body["required"].(bool)
+		if content, ok := body["content"].(map[string]any); ok {
+			op.BodyContentType = pickOpenAPIContentType(content)
+			if media := r.resolve(content[op.BodyContentType]); media != nil {
+				op.BodySchema = r.schema(media["schema"], 0)
+			}
+		}
+	}
+	return op
+}
+
+func (r *openAPIResolver) parameters(node any) []OpenAPIParameter {
+	list, _ := node.([]any)
+	params := make([]OpenAPIParameter, 0, len(list))
+	for _, item := range list {
+		p := r.resolve(item)
+		if p == nil {
+			continue
+		}
+		param := OpenAPIParameter{}
+		param.Name, _ = p["name"].(string)
+		param.In, _ = p["in"].(string)
+		param.Description, _ = p["description"].(string)
+		param.Required, _ = p["required"].(bool)
+		if param.Name == "" || param.In == "cookie" {
+			continue
+		}
+		if param.In == "path" {
+			param.Required = true
+		}
+		param.Schema = r.schema(p["schema"], 0)
+		if param.Description != "" {
+			param.Schema["description"] = param.Description
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// openAPISchemaKeywords are copied verbatim from OpenAPI schemas.
+var openAPISchemaKeywords = []string{
+	"type", "format", "description", "title", "enum", "default",
+	"minimum", "maximum", "minLength", "maxLength", "pattern", "minItems", "maxItems",
+}
+
+// schema converts an OpenAPI schema object into JSON Schema. Recursive
+// schemas are cut off at openAPIMaxSchemaDepth.
+func (r *openAPIResolver) schema(node any, depth int) map[string]any {
+	s := r.resolve(node)
+	if s == nil || depth >= openAPIMaxSchemaDepth {
+		return map[string]any{}
+	}
+
+	out := make(map[string]any)
+	for _, key := range openAPISchemaKeywords {
+		if v, ok := s[key]; ok {
+			out[key] = v
+		}
+	}
+	if props, ok := s["properties"].(map[string]any); ok {
+		converted := make(map[string]any, len(props))
+		for name, prop := range props {
+			converted[name] = r.schema(prop, depth+1)
+		}
+		out["properties"] = converted
+	}
+	if required, ok := s["required"].([]any); ok {
+		out["required"] = required
+	}
+	if items, ok := s["items"]; ok {
+		out["items"] = r.schema(items, depth+1)
+	}
+	switch ap := s["additionalProperties"].(type) {
+	case bool:
+		out["additionalProperties"] = ap
+	case map[string]any:
+		out["additionalProperties"] = r.schema(ap, depth+1)
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if variants, ok := s[key].([]any); ok {
+			converted := make([]any, 0, len(variants))
+			for _, v := range variants {
+				converted = append(converted, r.schema(v, depth+1))
+			}
+			out["anyOf"] = converted
+		}
+	}
+	// allOf is mostly used for composition; merge the parts into one object.
+	if parts, ok := s["allOf"].([]any); ok {
+		for _, part := range parts {
+			mergeOpenAPISchema(out, r.schema(part, depth+1))
+		}
+	}
+	if _, ok := out["type"]; !ok {
+		if _, ok := out["properties"]; ok {
+			out["type"] = "object"
+		}
+	}
+	return out
+}
+
+func mergeOpenAPISchema(dst, src map[string]any) {
+	for key, value := range src {
+		switch key {
+		case "properties":
+			props, _ := dst["properties"].(map[string]any)
+			if props == nil {
+				props = make(map[string]any)
+			}
+			for name, prop := range value.(map[string]any) {
+				props[name] = prop
+			}
+			dst["properties"] = props
+		case "required":
+			existing, _ := dst["required"].([]any)
+			dst["required"] = append(existing, value.([]any)...)
+		default:
+			if _, ok := dst[key]; !ok {
+				dst[key] = value
+			}
+		}
+	}
+}
+
+func pickOpenAPIContentType(content map[string]any) string {
+	if _, ok := content[openAPIDefaultJSONMimeType]; ok {
+		return openAPIDefaultJSONMimeType
+	}
+	keys := make([]string, 0, len(content))
+	for k := range content {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		if strings.Contains(k, "json") {
+			return k
+		}
+	}
+	if len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// NewOpenAPITools parses cfg.Spec and returns one tool per selected
+// operation. namePrefix is prepended to every tool name and defaults to
+// OpenAPIToolPrefix. httpClient may be nil.
+func NewOpenAPITools(cfg OpenAPIConfig, namePrefix string, httpClient *http.Client) ([]tool.Tool, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	spec, err := ParseOpenAPISpec(cfg.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("openapi tool %q: %w", cfg.Name, err)
+	}
+	if namePrefix == "" {
+		namePrefix = OpenAPIToolPrefix
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = spec.ServerURL
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("openapi tool %q: base url %q must be an absolute URL", cfg.Name, baseURL)
+	}
+
+	operations, err := selectOpenAPIOperations(spec.Operations, cfg.Operations)
+	if err != nil {
+		return nil, fmt.Errorf("openapi tool %q: %w", cfg.Name, err)
+	}
+
+	tools := make([]tool.Tool, 0, len(operations))
+	for _, op := range operations {
+		tools = append(tools, newOpenAPITool(cfg, namePrefix, strings.TrimRight(baseURL, "/"), op, httpClient))
+	}
+	return tools, nil
+}
+
+func selectOpenAPIOperations(all []OpenAPIOperation, selected []string) ([]OpenAPIOperation, error) {
+	if len(selected) == 0 {
+		return all, nil
+	}
+	result := make([]OpenAPIOperation, 0, len(selected))
+	for _, id := range selected {
+		idx := slices.IndexFunc(all, func(op OpenAPIOperation) bool { return op.ID == id })
+		if idx < 0 {
+			return nil, fmt.Errorf("operation %q not found in document", id)
+		}
+		result = append(result, all[idx])
+	}
+	return result, nil
+}
+
+func newOpenAPITool(cfg OpenAPIConfig, namePrefix, baseURL string, op OpenAPIOperation, httpClient *http.Client) *openAPITool {
+	name := namePrefix + sanitizeToolName(cfg.Name) + "__" + sanitizeToolName(op.ID)
+	if len(name) > maxToolNameLength {
+		name = name[:maxToolNameLength]
+	}
+
+	summary := op.Summary
+	if op.Description != "" && op.Description != summary {
+		summary = strings.TrimSpace(summary + "\n" + op.Description)
+	}
+	description := fmt.Sprintf("[API %s] %s %s", cfg.Name, op.Method, op.Path)
+	if summary != "" {
+		description += ": " + summary
+	}
+	if len(description) > openAPIMaxDescriptionLen {
+		description = description[:openAPIMaxDescriptionLen]
+	}
+
+	properties := make(map[string]any)
+	required := []string{}
+	for _, p := range op.Parameters {
+		if _, dup := properties[p.Name]; dup {
+			continue
+		}
+		properties[p.Name] = p.Schema
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	if op.BodyContentType != "" {
+		body := op.BodySchema
+		if body == nil {
+			body = map[string]any{}
+		}
+		properties[openAPIBodyArgName] = body
+		if op.BodyRequired {
+			required = append(required, openAPIBodyArgName)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return &openAPITool{
+		name:        name,
+		description: description,
+		declaration: &genai.FunctionDeclaration{
+			Name:                 name,
+			Description:          description,
+			ParametersJsonSchema: schema,
+		},
+		cfg:        cfg,
+		baseURL:    baseURL,
+		op:         op,
+		httpClient: httpClient,
+	}
+}
+
+// openAPITool calls one operation of a REST API.
+type openAPITool struct {
+	name        string
+	description string
+	declaration *genai.FunctionDeclaration
+	cfg         OpenAPIConfig
+	baseURL     string
+	op          OpenAPIOperation
+	httpClient  *http.Client
+}
+
+func (t *openAPITool) Name() string        { return t.name }
+func (t *openAPITool) Description() string { return t.description }
+func (t *openAPITool) IsLongRunning() bool { return false }
+
+func (t *openAPITool) Declaration() *genai.FunctionDeclaration {
+	return t.declaration
+}
+
+// ProcessRequest adds the tool's declaration to the LLM request.
+func (t *openAPITool) ProcessRequest(_ tool.Context, req *model.LLMRequest) error {
+	return addFunctionDeclaration(req, t, t.declaration)
+}
+
+// Run performs the HTTP request and returns the status code and body.
+func (t *openAPITool) Run(ctx tool.Context, args any) (map[string]any, error) {
+	m, _ := args.(map[string]any)
+	reqCtx, cancel := context.WithTimeout(ctx, openAPIRequestTimeout)
+	defer cancel()
+	req, err := t.buildRequest(reqCtx, m)
+	if err != nil {
+		return map[string]any{"success": false, "error": err.Error()}, nil
+	}
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		slog.Error("openapi request failed", "api", t.cfg.Name, "operation", t.op.ID, "err", err)
+		return map[string]any{"success": false, "error": fmt.Sprintf("request failed: %v", err)}, nil
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, openAPIMaxResponseBytes+1))
+	if err != nil {
+		return map[string]any{"success": false, "error": fmt.Sprintf("failed to read response: %v", err)}, nil
+	}
+	truncated := len(data) > openAPIMaxResponseBytes
+	if truncated {
+		data = data[:openAPIMaxResponseBytes]
+	}
+
+	result := map[string]any{
+		"success":     resp.StatusCode < 400,
+		"status_code": resp.StatusCode,
+	}
+	var body any
+	if !truncated && json.Unmarshal(data, &body) == nil {
+		result["body"] = body
+	} else {
+		result["body"] = string(data)
+	}
+	if truncated {
+		result["truncated"] = true
+	}
+	return result, nil
+}
+
+func (t *openAPITool) buildRequest(ctx context.Context, args map[string]any) (*http.Request, error) {
+	path := t.op.Path
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range t.op.Parameters {
+		value, ok := args[p.Name]
+		if !ok || value == nil {
+			if p.Required {
+				return nil, fmt.Errorf("missing required parameter %q", p.Name)
+			}
+			continue
+		}
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(openAPIParamString(value)))
+		case "query":
+			if list, ok := value.([]any); ok {
+				for _, item := range list {
+					query.Add(p.Name, openAPIParamString(item))
+				}
+			} else {
+				query.Set(p.Name, openAPIParamString(value))
+			}
+		case "header":
+			header.Set(p.Name, openAPIParamString(value))
+		}
+	}
+
+	target := t.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if value, ok := args[openAPIBodyArgName]; ok && value != nil && t.op.BodyContentType != "" {
+		encoded, err := encodeOpenAPIBody(t.op.BodyContentType, value)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+		header.Set("Content-Type", t.op.BodyContentType)
+	} else if t.op.BodyRequired {
+		return nil, fmt.Errorf("missing required parameter %q", openAPIBodyArgName)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, t.op.Method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json, */*")
+
+	switch t.cfg.AuthType {
+	case OpenAPIAuthHeader:
+		req.Header.Set(t.cfg.AuthHeader, t.cfg.AuthSecret)
+	case OpenAPIAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+t.cfg.AuthSecret)
+	case OpenAPIAuthBasic:
+		req.SetBasicAuth(t.cfg.AuthUsername, t.cfg.AuthSecret)
+	}
+	return req, nil
+}
+
+func encodeOpenAPIBody(contentType string, value any) ([]byte, error) {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return json.Marshal(value)
+	case contentType == "application/x-www-form-urlencoded":
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil, errors.New("form body must be an object")
+		}
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, openAPIParamString(v))
+		}
+		return []byte(form.Encode()), nil
+	default:
+		if s, ok := value.(string); ok {
+			return []byte(s), nil
+		}
+		return json.Marshal(value)
+	}
+}
+
+func openAPIParamString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// OpenAPIToolset exposes the tools generated from one OpenAPI document.
+type OpenAPIToolset struct {
+	name  string
+	tools []tool.Tool
+}
+
+// NewOpenAPIToolset builds the tools for cfg once.
+func NewOpenAPIToolset(cfg OpenAPIConfig, httpClient *http.Client) (*OpenAPIToolset, error) {
+	tools, err := NewOpenAPITools(cfg, OpenAPIToolPrefix, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAPIToolset{name: OpenAPIToolPrefix + sanitizeToolName(cfg.Name), tools: tools}, nil
+}
+
+// Name implements tool.Toolset.
+func (s *OpenAPIToolset) Name() string { return s.name }
+
+// Tools implements tool.Toolset.
+func (s *OpenAPIToolset) Tools(agent.ReadonlyContext) ([]tool.Tool, error) {
+	return s.tools, nil
+}
@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/constant"
+	"aiguide/internal/pkg/secret"
+)
+
+const testPetStoreSpec = `
+openapi: 3.0.3
+info:
+  title: Pet Store
+  version: "1.0"
+servers:
+  - url: https://pets.example.com/v1
+paths:
+  /pets/{petId}:
+    parameters:
+      - $ref: '#/components/parameters/PetID'
+    get:
+      operationId: getPet
+      summary: Get a pet
+      parameters:
+        - name: verbose
+          in: query
+          schema:
+            type: boolean
+  /pets:
+    post:
+      operationId: createPet
+      summary: Create a pet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+components:
+  parameters:
+    PetID:
+      name: petId
+      in: path
+      required: true
+      schema:
+        type: string
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        tag:
+          type: string
+`
+
+func TestParseOpenAPISpec(t *testing.T) {
+	spec, err := ParseOpenAPISpec([]byte(testPetStoreSpec))
+	if err != nil {
+		t.Fatalf("ParseOpenAPISpec() error = %v", err)
+	}
+	if spec.Title != "Pet Store" || spec.ServerURL != "https://pets.example.com/v1" {
+		t.Fatalf("spec = %+v", spec)
+	}
+	if len(spec.Operations) != 2 {
+		t.Fatalf("operations = %+v, want 2", spec.Operations)
+	}
+
+	ops := map[string]OpenAPIOperation{}
+	for _, op := range spec.Operations {
+		ops[op.ID] = op
+	}
+	get := ops["getPet"]
+	if get.Method != http.MethodGet || len(get.Parameters) != 2 {
+		t.Fatalf("getPet = %+v, want GET with path and query parameters", get)
+	}
+	create := ops["createPet"]
+	if create.BodyContentType != "application/json" || !create.BodyRequired {
+		t.Fatalf("createPet = %+v, want a required JSON body", create)
+	}
+	if props, _ := create.BodySchema["properties"].(map[string]any); props["name"] == nil {
+		t.Fatalf("createPet body schema = %+v, want resolved $ref", create.BodySchema)
+	}
+}
+
+func TestNewOpenAPIToolsSelectsOperations(t *testing.T) {
+	cfg := OpenAPIConfig{Name: "pets", Spec: []byte(testPetStoreSpec), Operations: []string{"getPet"}}
+	got, err := NewOpenAPITools(cfg, "", nil)
+	if err != nil {
+		t.Fatalf("NewOpenAPITools() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Name() != "api_pets__getPet" {
+		t.Fatalf("tools = %v, want only api_pets__getPet", got)
+	}
+
+	cfg.Operations = []string{"deletePet"}
+	if _, err := NewOpenAPITools(cfg, "", nil); err == nil {
+		t.Fatal("NewOpenAPITools() with unknown operation should fail")
+	}
+}
+
+func TestOpenAPIToolRun(t *testing.T) {
+	var gotPath, gotQuery, gotAuth string
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotAuth = r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("X-API-Key")
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			_ = json.Unmarshal(data, &gotBody)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"Rex"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := OpenAPIConfig{
+		Name:       "pets",
+		Spec:       []byte(testPetStoreSpec),
+		BaseURL:    srv.URL + "/v1",
+		AuthType:   OpenAPIAuthHeader,
+		AuthHeader: "X-API-Key",
+		AuthSecret: "s3cret",
+	}
+	set, err := NewOpenAPIToolset(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewOpenAPIToolset() error = %v", err)
+	}
+	toolCtx := mcpToolContext(context.Background())
+
+	get := findMCPTool(t, set, toolCtx, "api_pets__getPet")
+	result := runMCPTool(t, toolCtx, get, map[string]any{"petId": "a/b", "verbose": true})
+	if result["success"] != true || result["status_code"] != http.StatusOK {
+		t.Fatalf("Run() = %+v", result)
+	}
+	if body, _ := result["body"].(map[string]any); body["name"] != "Rex" {
+		t.Fatalf("Run() body = %+v", result["body"])
+	}
+	if gotPath != "/v1/pets/a%2Fb" || gotQuery != "verbose=true" || gotAuth != "s3cret" {
+		t.Fatalf("request path=%q query=%q auth=%q", gotPath, gotQuery, gotAuth)
+	}
+
+	create := findMCPTool(t, set, toolCtx, "api_pets__createPet")
+	runMCPTool(t, toolCtx, create, map[string]any{"body": map[string]any{"name": "Tom"}})
+	if gotPath != "/v1/pets" || gotBody["name"] != "Tom" {
+		t.Fatalf("request path=%q body=%+v", gotPath, gotBody)
+	}
+}
+
+func TestUserOpenAPIToolsetDecryptsSecret(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	cipher, err := secret.NewCipher("test-key")
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	encrypted, err := cipher.Encrypt("user-token")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	db := setupTestDB(t)
+	if err := db.AutoMigrate(&table.OpenAPIToolConfig{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	configs := []table.OpenAPIToolConfig{
+		{UserID: 1, Name: "mine", Spec: testPetStoreSpec, BaseURL: srv.URL, AuthType: OpenAPIAuthBearer, AuthSecret: encrypted, Operations: `["getPet"]`, Enabled: true},
+		{UserID: 1, Name: "disabled", Spec: testPetStoreSpec, BaseURL: srv.URL, Enabled: false},
+		{UserID: 2, Name: "other", Spec: testPetStoreSpec, BaseURL: srv.URL, Enabled: true},
+	}
+	if err := db.Create(&configs).Error; err != nil {
+		t.Fatalf("failed to create configs: %v", err)
+	}
+
+	set := NewUserOpenAPIToolset(db, cipher, nil)
+	ctx := context.WithValue(context.Background(), constant.ContextKeyUserID, 1)
+	toolCtx := mcpToolContext(ctx)
+	found, err := set.Tools(toolCtx)
+	if err != nil {
+		t.Fatalf("Tools() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Name() != "api_u_mine__getPet" {
+		t.Fatalf("Tools() = %v, want only api_u_mine__getPet", found)
+	}
+
+	result := runMCPTool(t, toolCtx, found[0], map[string]any{"petId": "1"})
+	if result["status_code"] != http.StatusNoContent {
+		t.Fatalf("Run() = %+v", result)
+	}
+	if gotAuth != "Bearer user-token" {
+		t.Fatalf("Authorization = %q, want decrypted bearer token", gotAuth)
+	}
+}
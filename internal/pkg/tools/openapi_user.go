@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"aiguide/internal/app/aiguide/table"
+	"aiguide/internal/pkg/middleware"
+	"aiguide/internal/pkg/secret"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/tool"
+	"gorm.io/gorm"
+)
+
+// UserOpenAPIToolPrefix prefixes tools of per-user APIs so they cannot shadow
+// APIs declared in the YAML config.
+const UserOpenAPIToolPrefix = OpenAPIToolPrefix + "u_"
+
+// ParseOpenAPIOperations decodes the operations column of table.OpenAPIToolConfig.
+func ParseOpenAPIOperations(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var ops []string
+	if err := json.Unmarshal([]byte(raw), &ops); err != nil {
+		return nil, fmt.Errorf("invalid openapi operations: %w", err)
+	}
+	return ops, nil
+}
+
+// OpenAPIConfigFromTable converts a stored config, decrypting its secret.
+func OpenAPIConfigFromTable(row table.OpenAPIToolConfig, cipher *secret.Cipher) (OpenAPIConfig, error) {
+	ops, err := ParseOpenAPIOperations(row.Operations)
+	if err != nil {
+		return OpenAPIConfig{}, err
+	}
+	authSecret, err := cipher.Decrypt(row.AuthSecret)
+	if err != nil {
+		return OpenAPIConfig{}, fmt.Errorf("failed to decrypt auth secret: %w", err)
+	}
+	return OpenAPIConfig{
+		Name:         row.Name,
+		Spec:         []byte(row.Spec),
+		BaseURL:      row.BaseURL,
+		AuthType:     row.AuthType,
+		AuthHeader:   row.AuthHeader,
+		AuthUsername: row.AuthUsername,
+		AuthSecret:   authSecret,
+		Operations:   ops,
+	}, nil
+}
+
+// UserOpenAPIToolset exposes the OpenAPI tools the current user registered in
+// settings. Tools are rebuilt only when a stored config changes.
+type UserOpenAPIToolset struct {
+	db         *gorm.DB
+	cipher     *secret.Cipher
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[int]userOpenAPIEntry
+}
+
+type userOpenAPIEntry struct {
+	updatedAt time.Time
+	tools     []tool.Tool
+}
+
+// NewUserOpenAPIToolset creates the per-user OpenAPI toolset.
+func NewUserOpenAPIToolset(db *gorm.DB, cipher *secret.Cipher, httpClient *http.Client) *UserOpenAPIToolset {
+	return &UserOpenAPIToolset{
+		db:         db,
+		cipher:     cipher,
+		httpClient: httpClient,
+		cache:      make(map[int]userOpenAPIEntry),
+	}
+}
+
+// Name implements tool.Toolset.
+func (u *UserOpenAPIToolset) Name() string {
+	return "user_openapi_tools"
+}
+
+// Tools implements tool.Toolset. Configs that fail to build are skipped.
+func (u *UserOpenAPIToolset) Tools(ctx agent.ReadonlyContext) ([]tool.Tool, error) {
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		return nil, nil
+	}
+	db := u.db
+	if tx, ok := middleware.GetTx(ctx); ok {
+		db = tx
+	}
+	if db == nil {
+		return nil, nil
+	}
+
+	var configs []table.OpenAPIToolConfig
+	if err := db.Where("user_id = ? AND enabled = ?", userID, true).Order("id").Find(&configs).Error; err != nil {
+		slog.Error("failed to query user openapi tools", "user_id", userID, "err", err)
+		return nil, nil
+	}
+
+	var result []tool.Tool
+	for _, cfg := range configs {
+		tools, err := u.toolsFor(cfg)
+		if err != nil {
+			slog.Error("failed to build user openapi tools", "user_id", userID, "api", cfg.Name, "err", err)
+			continue
+		}
+		result = append(result, tools...)
+	}
+	return result, nil
+}
+
+func (u *UserOpenAPIToolset) toolsFor(row table.OpenAPIToolConfig) ([]tool.Tool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if entry, ok := u.cache[row.ID]; ok && entry.updatedAt.Equal(row.UpdatedAt) {
+		return entry.tools, nil
+	}
+
+	cfg, err := OpenAPIConfigFromTable(row, u.cipher)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := NewOpenAPITools(cfg, UserOpenAPIToolPrefix, u.httpClient)
+	if err != nil {
+		return nil, err
+	}
+	u.cache[row.ID] = userOpenAPIEntry{updatedAt: row.UpdatedAt, tools: tools}
+	return tools, nil
+}
@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchDays bounds how far ahead cron and calendar schedules are
+// searched. Four years covers expressions that only match on Feb 29.
+const cronSearchDays = 366*4 + 31
+
+var cronMonthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// cronSchedule is a parsed standard 5-field cron expression
+// (minute hour day-of-month month day-of-week). Each field is a bitset of
+// the values it matches.
+type cronSchedule struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+// parseCronExpr parses a standard 5-field cron expression. Fields accept
+// "*", single values, ranges (1-5), lists (1,3,5) and steps (*/15, 1-10/2);
+// month and day-of-week also accept three-letter English names, and 7 is an
+// alias for Sunday.
+func parseCronExpr(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+
+	var schedule cronSchedule
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], "minute", 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], "hour", 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], "day-of-month", 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], "month", 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], "day-of-week", 0, 7, cronWeekdayNames); err != nil {
+		return nil, err
+	}
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow = schedule.dow&^(1<<7) | 1
+	}
+	schedule.domStar = strings.HasPrefix(fields[2], "*")
+	schedule.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return &schedule, nil
+}
+
+func parseCronField(field, name string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in cron %s field", stepPart, name)
+			}
+			step = n
+		}
+
+		var start, end int
+		switch {
+		case rangePart == "*":
+			start, end = min, max
+		case strings.Contains(rangePart, "-"):
+			lo, hi, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(lo, name, min, max, names); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(hi, name, min, max, names); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q in cron %s field, start is after end", rangePart, name)
+			}
+		default:
+			value, err := parseCronValue(rangePart, name, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			start, end = value, value
+			if hasStep {
+				end = max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value, name string, min, max int, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToUpper(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in cron %s field", value, name)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d out of range in cron %s field, expected %d-%d", n, name, min, max)
+	}
+	return n, nil
+}
+
+// matchesDay reports whether the calendar day of t matches the expression.
+// Like standard cron, when both day-of-month and day-of-week are restricted
+// a day matches if either of them does.
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	if c.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	domMatch := c.dom&(1<<t.Day()) != 0
+	dowMatch := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first time strictly after now that matches the
+// expression in location.
+func (c *cronSchedule) next(now time.Time, location *time.Location) (time.Time, error) {
+	nowInLocation := now.In(location)
+	for i := 0; i <= cronSearchDays; i++ {
+		day := time.Date(nowInLocation.Year(), nowInLocation.Month(), nowInLocation.Day()+i, 12, 0, 0, 0, location)
+		if !c.matchesDay(day) {
+			continue
+		}
+
+		// Wall-clock times skipped by a DST jump are moved forward, so keep
+		// the earliest candidate rather than the first.
+		var best time.Time
+		for h := 0; h < 24; h++ {
+			if c.hour&(1<<h) == 0 {
+				continue
+			}
+			for m := 0; m < 60; m++ {
+				if c.minute&(1<<m) == 0 {
+					continue
+				}
+				candidate := wallClock(day.Year(), day.Month(), day.Day(), h, m, location)
+				if candidate.After(now) && (best.IsZero() || candidate.Before(best)) {
+					best = candidate
+				}
+			}
+		}
+		if !best.IsZero() {
+			return best, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cron expression never matches a valid date")
+}
+
+// nextWallClock returns the first time strictly after now whose local
+// wall-clock time is hour:minute on a day accepted by matchDay. Days are
+// stepped in calendar terms so the local run time stays fixed across DST
+// transitions.
+func nextWallClock(now time.Time, location *time.Location, hour, minute int, matchDay func(time.Time) bool) (time.Time, error) {
+	nowInLocation := now.In(location)
+	for i := 0; i <= cronSearchDays; i++ {
+		day := time.Date(nowInLocation.Year(), nowInLocation.Month(), nowInLocation.Day()+i, 12, 0, 0, 0, location)
+		candidate := wallClock(day.Year(), day.Month(), day.Day(), hour, minute, location)
+		if candidate.After(now) && matchDay(day) {
+			return candidate, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("schedule never matches a valid date")
+}
+
+// wallClock returns the instant of the given local wall-clock time. A time
+// that falls into a DST gap is moved forward by the size of the gap (02:30
+// becomes 03:30), matching cron; during a DST overlap the time fires once.
+func wallClock(year int, month time.Month, day, hour, minute int, location *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, location)
+	if t.Hour() == hour && t.Minute() == minute {
+		return t
+	}
+	// Interpret the skipped time with the offset in effect before the gap.
+	_, offset := time.Date(year, month, day-1, hour, minute, 0, 0, location).Zone()
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC).Add(-time.Duration(offset) * time.Second).In(location)
+}
+
+// daysInMonth returns the number of days in t's month.
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronExpr_Invalid(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"* * * *", "must have 5 fields"},
+		{"60 * * * *", "out of range in cron minute field"},
+		{"* 24 * * *", "out of range in cron hour field"},
+		{"* * 0 * *", "out of range in cron day-of-month field"},
+		{"* * * FOO *", "invalid value"},
+		{"*/0 * * * *", "invalid step"},
+		{"10-5 * * * *", "start is after end"},
+	}
+	for _, tt := range tests {
+		_, err := parseCronExpr(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseCronExpr(%q) error = %v, want containing %q", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2026-02-25 is a Wednesday.
+	now := time.Date(2026, 2, 25, 9, 10, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 2, 25, 9, 15, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 2, 25, 9, 30, 0, 0, time.UTC)},
+		{"0 8 * * SAT,SUN", time.Date(2026, 2, 28, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 7 * * 7", time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)},
+		// Day-of-month and day-of-week both restricted: either matches.
+		{"0 6 13 * 5", time.Date(2026, 2, 27, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCronExpr(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCronExpr(%q) error: %v", tt.expr, err)
+		}
+		got, err := schedule.next(now, time.UTC)
+		if err != nil {
+			t.Fatalf("next(%q) error: %v", tt.expr, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronScheduleNext_NeverMatches(t *testing.T) {
+	schedule, err := parseCronExpr("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parseCronExpr() error: %v", err)
+	}
+	if _, err := schedule.next(time.Now(), time.UTC); err == nil {
+		t.Fatal("next() expected error for an expression that never matches")
+	}
+}
+
+func TestCronScheduleNext_DST(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	schedule, err := parseCronExpr("30 2 * * *")
+	if err != nil {
+		t.Fatalf("parseCronExpr() error: %v", err)
+	}
+
+	// 02:30 does not exist on 2026-03-08; the run moves to 03:30 EDT.
+	now := time.Date(2026, 3, 8, 0, 0, 0, 0, location)
+	got, err := schedule.next(now, location)
+	if err != nil {
+		t.Fatalf("next() error: %v", err)
+	}
+	want := time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("next() = %s, want %s", got, want)
+	}
+
+	got, err = schedule.next(got, location)
+	if err != nil {
+		t.Fatalf("next() error: %v", err)
+	}
+	want = time.Date(2026, 3, 9, 6, 30, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("next() after the transition = %s, want %s", got, want)
+	}
+}
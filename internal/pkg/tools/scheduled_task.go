@@ -3,8 +3,10 @@ package tools
 import (
 	"aiguide/internal/app/aiguide/table"
 	"aiguide/internal/pkg/middleware"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"google.golang.org/adk/tool"
@@ -12,14 +14,99 @@ import (
 	"gorm.io/gorm"
 )
 
+// Supported schedule types for scheduled tasks.
+const (
+	ScheduleTypeOnce     = "once"
+	ScheduleTypeDaily    = "daily"
+	ScheduleTypeWeekly   = "weekly"
+	ScheduleTypeWorkdays = "workdays"
+	ScheduleTypeMonthly  = "monthly"
+	ScheduleTypeInterval = "interval"
+	ScheduleTypeCron     = "cron"
+)
+
+// Missed-run policies decide what happens to runs that came due while no
+// scheduler was running, e.g. during a restart.
+const (
+	MissedRunPolicyRunOnce = "run_once" // run once to catch up, then continue with the next future slot
+	MissedRunPolicySkip    = "skip"     // drop missed runs and wait for the next future slot
+	MissedRunPolicyRunAll  = "run_all"  // run every missed slot in turn
+)
+
+// maxBlackoutSkips bounds how many consecutive blackout ranges
+// CalculateNextRunAt jumps over.
+const maxBlackoutSkips = 100
+
+// Failure handling limits of scheduled tasks. Zero values on a task fall back
+// to the defaults.
+const (
+	DefaultScheduledTaskMaxRuntimeMinutes = 30
+	DefaultScheduledTaskFailureThreshold  = 3
+	maxScheduledTaskRuntimeMinutes        = 240
+	maxScheduledTaskRetries               = 5
+	maxScheduledTaskFailureThreshold      = 20
+)
+
 type ScheduledTaskCreateInput struct {
-	Title        string `json:"title" jsonschema:"定时任务标题"`
-	Action       string `json:"action" jsonschema:"任务执行内容，例如：每天汇总市场新闻并发送到邮箱"`
-	ScheduleType string `json:"schedule_type,omitempty" jsonschema:"调度类型：daily(默认) / weekly / once"`
-	RunAt        string `json:"run_at" jsonschema:"执行时间：daily/weekly 使用 HH:MM，once 使用 RFC3339"`
-	Weekday      int    `json:"weekday,omitempty" jsonschema:"仅 weekly 需要，0=周日,1=周一,...,6=周六"`
-	Timezone     string `json:"timezone,omitempty" jsonschema:"时区，默认 Asia/Shanghai"`
-	TargetEmail  string `json:"target_email,omitempty" jsonschema:"可选，目标邮箱地址"`
+	Title             string   `json:"title" jsonschema:"定时任务标题"`
+	Action            string   `json:"action" jsonschema:"任务执行内容，例如：每天汇总市场新闻并发送到邮箱"`
+	ScheduleType      string   `json:"schedule_type,omitempty" jsonschema:"调度类型：daily(默认) / weekly / workdays(周一至周五) / monthly / interval(每隔N分钟) / cron / once"`
+	RunAt             string   `json:"run_at,omitempty" jsonschema:"执行时间：daily/weekly/workdays/monthly 使用 HH:MM，once 使用 RFC3339；interval 可选填 RFC3339 首次执行时间；cron 不需要"`
+	Weekday           int      `json:"weekday,omitempty" jsonschema:"weekly 及 monthly 按第N个星期几时需要，0=周日,1=周一,...,6=周六"`
+	MonthDay          int      `json:"month_day,omitempty" jsonschema:"monthly 按日期执行时填写 1-31，当月没有该日期时在月末执行"`
+	WeekOfMonth       int      `json:"week_of_month,omitempty" jsonschema:"monthly 按第N个星期几执行时填写 1-4，-1 表示最后一个；与 month_day 二选一"`
+	IntervalMinutes   int      `json:"interval_minutes,omitempty" jsonschema:"interval 的间隔分钟数，例如每2小时填 120"`
+	CronExpr          string   `json:"cron_expr,omitempty" jsonschema:"cron 类型的标准5段表达式：分 时 日 月 周，例如 '30 9 * * 1-5'"`
+	Timezone          string   `json:"timezone,omitempty" jsonschema:"时区，默认 Asia/Shanghai"`
+	TargetEmail       string   `json:"target_email,omitempty" jsonschema:"可选，目标邮箱地址；每次执行的最终结果会自动发送到该邮箱，执行失败时也会向该邮箱发送告警"`
+	MaxRuntimeMinutes int      `json:"max_runtime_minutes,omitempty" jsonschema:"可选，单次执行的最长分钟数，默认 30，最大 240"`
+	MaxRetries        int      `json:"max_retries,omitempty" jsonschema:"可选，执行失败后的重试次数（指数退避），默认 0，最大 5"`
+	FailureThreshold  int      `json:"failure_threshold,omitempty" jsonschema:"可选，连续失败多少次后自动停用任务，默认 3"`
+	BlackoutDates     []string `json:"blackout_dates,omitempty" jsonschema:"可选，暂停执行的日期（按任务时区），格式 YYYY-MM-DD 或日期范围 YYYY-MM-DD/YYYY-MM-DD，例如节假日"`
+	MissedRunPolicy   string   `json:"missed_run_policy,omitempty" jsonschema:"可选，服务停机期间错过的执行如何处理：run_once(默认，补执行一次) / skip(跳过) / run_all(逐次补执行)"`
+}
+
+// ScheduledTaskInputFromTable rebuilds the schedule input of a stored task.
+func ScheduledTaskInputFromTable(task table.ScheduledTask) ScheduledTaskCreateInput {
+	return ScheduledTaskCreateInput{
+		Title:             task.Title,
+		Action:            task.Action,
+		ScheduleType:      task.ScheduleType,
+		RunAt:             task.RunAt,
+		Weekday:           task.Weekday,
+		MonthDay:          task.MonthDay,
+		WeekOfMonth:       task.WeekOfMonth,
+		IntervalMinutes:   task.IntervalMinutes,
+		CronExpr:          task.CronExpr,
+		Timezone:          task.Timezone,
+		TargetEmail:       task.TargetEmail,
+		MaxRuntimeMinutes: task.MaxRuntimeMinutes,
+		MaxRetries:        task.MaxRetries,
+		FailureThreshold:  task.FailureThreshold,
+		BlackoutDates:     decodeBlackoutDates(task.BlackoutDates),
+		MissedRunPolicy:   task.MissedRunPolicy,
+	}
+}
+
+// EncodeBlackoutDates serializes blackout dates for table.ScheduledTask.
+func EncodeBlackoutDates(dates []string) string {
+	if len(dates) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(dates)
+	return string(data)
+}
+
+func decodeBlackoutDates(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var dates []string
+	if err := json.Unmarshal([]byte(value), &dates); err != nil {
+		slog.Warn("failed to decode blackout dates", "err", err)
+		return nil
+	}
+	return dates
 }
 
 type ScheduledTaskCreateOutput struct {
@@ -32,7 +119,7 @@ type ScheduledTaskCreateOutput struct {
 func NewScheduledTaskCreateTool(db *gorm.DB) (tool.Tool, error) {
 	config := functiontool.Config{
 		Name:        "scheduled_task_create",
-		Description: "创建定时任务。支持每天/每周/一次性执行。适用于'每天早上8点发送市场快讯到邮箱'这类需求。重要：once 类型的 run_at 必须是未来的 RFC3339 时间；如不确定当前时间，请先调用 current_time 工具。",
+		Description: "创建定时任务。支持每天/每周/工作日/每月/每隔N分钟/cron 表达式/一次性执行。适用于'每天早上8点发送市场快讯到邮箱'、'每月最后一个周五汇总报表'这类需求。重要：once 类型的 run_at 必须是未来的 RFC3339 时间；如不确定当前时间，请先调用 current_time 工具。",
 	}
 
 	handler := func(ctx tool.Context, input ScheduledTaskCreateInput) (*ScheduledTaskCreateOutput, error) {
@@ -57,7 +144,7 @@ func NewScheduledTaskCreateTool(db *gorm.DB) (tool.Tool, error) {
 
 		sessionID, _ := ctx.Value("session_id").(string)
 
-		normalizedInput, err := normalizeScheduledTaskInput(input)
+		normalizedInput, err := NormalizeScheduledTaskInput(input)
 		if err != nil {
 			slog.Warn("normalizeScheduledTaskInput() error", "err", err)
 			return &ScheduledTaskCreateOutput{
@@ -77,17 +164,26 @@ func NewScheduledTaskCreateTool(db *gorm.DB) (tool.Tool, error) {
 		}
 
 		scheduledTask := &table.ScheduledTask{
-			UserID:       userID,
-			SessionID:    sessionID,
-			Title:        normalizedInput.Title,
-			Action:       normalizedInput.Action,
-			ScheduleType: normalizedInput.ScheduleType,
-			RunAt:        normalizedInput.RunAt,
-			Weekday:      normalizedInput.Weekday,
-			Timezone:     normalizedInput.Timezone,
-			TargetEmail:  normalizedInput.TargetEmail,
-			Enabled:      true,
-			NextRunAt:    nextRunAt,
+			UserID:            userID,
+			SessionID:         sessionID,
+			Title:             normalizedInput.Title,
+			Action:            normalizedInput.Action,
+			ScheduleType:      normalizedInput.ScheduleType,
+			RunAt:             normalizedInput.RunAt,
+			Weekday:           normalizedInput.Weekday,
+			MonthDay:          normalizedInput.MonthDay,
+			WeekOfMonth:       normalizedInput.WeekOfMonth,
+			IntervalMinutes:   normalizedInput.IntervalMinutes,
+			CronExpr:          normalizedInput.CronExpr,
+			Timezone:          normalizedInput.Timezone,
+			TargetEmail:       normalizedInput.TargetEmail,
+			MaxRuntimeMinutes: normalizedInput.MaxRuntimeMinutes,
+			MaxRetries:        normalizedInput.MaxRetries,
+			FailureThreshold:  normalizedInput.FailureThreshold,
+			BlackoutDates:     EncodeBlackoutDates(normalizedInput.BlackoutDates),
+			MissedRunPolicy:   normalizedInput.MissedRunPolicy,
+			Enabled:           true,
+			NextRunAt:         nextRunAt,
 		}
 
 		if err := db.Create(scheduledTask).Error; err != nil {
@@ -147,7 +243,10 @@ func NewScheduledTaskListTool(db *gorm.DB) (tool.Tool, error) {
 	return functiontool.New(config, handler)
 }
 
-func normalizeScheduledTaskInput(input ScheduledTaskCreateInput) (ScheduledTaskCreateInput, error) {
+// NormalizeScheduledTaskInput fills in defaults, validates the schedule
+// parameters for the chosen schedule type and clears fields the type does
+// not use.
+func NormalizeScheduledTaskInput(input ScheduledTaskCreateInput) (ScheduledTaskCreateInput, error) {
 	if input.Title == "" {
 		return input, fmt.Errorf("title is required")
 	}
@@ -155,30 +254,98 @@ func normalizeScheduledTaskInput(input ScheduledTaskCreateInput) (ScheduledTaskC
 		return input, fmt.Errorf("action is required")
 	}
 	if input.ScheduleType == "" {
-		input.ScheduleType = "daily"
+		input.ScheduleType = ScheduleTypeDaily
 	}
 	if input.Timezone == "" {
 		input.Timezone = "Asia/Shanghai"
 	}
+	input.CronExpr = strings.TrimSpace(input.CronExpr)
 
 	_, err := time.LoadLocation(input.Timezone)
 	if err != nil {
 		return input, fmt.Errorf("invalid timezone: %w", err)
 	}
+	if input.MaxRuntimeMinutes < 0 || input.MaxRuntimeMinutes > maxScheduledTaskRuntimeMinutes {
+		return input, fmt.Errorf("invalid max_runtime_minutes, expected 1-%d or 0 for the default", maxScheduledTaskRuntimeMinutes)
+	}
+	if input.MaxRetries < 0 || input.MaxRetries > maxScheduledTaskRetries {
+		return input, fmt.Errorf("invalid max_retries, expected 0-%d", maxScheduledTaskRetries)
+	}
+	if input.FailureThreshold < 0 || input.FailureThreshold > maxScheduledTaskFailureThreshold {
+		return input, fmt.Errorf("invalid failure_threshold, expected 1-%d or 0 for the default", maxScheduledTaskFailureThreshold)
+	}
+	switch input.MissedRunPolicy {
+	case "":
+		input.MissedRunPolicy = MissedRunPolicyRunOnce
+	case MissedRunPolicyRunOnce, MissedRunPolicySkip, MissedRunPolicyRunAll:
+	default:
+		return input, fmt.Errorf("invalid missed_run_policy: %s, expected run_once, skip or run_all", input.MissedRunPolicy)
+	}
+	if _, err := parseBlackoutDates(input.BlackoutDates); err != nil {
+		return input, err
+	}
+
+	weekday, monthDay, weekOfMonth := input.Weekday, input.MonthDay, input.WeekOfMonth
+	intervalMinutes, cronExpr := input.IntervalMinutes, input.CronExpr
+	input.Weekday, input.MonthDay, input.WeekOfMonth = 0, 0, 0
+	input.IntervalMinutes, input.CronExpr = 0, ""
 
 	switch input.ScheduleType {
-	case "daily":
+	case ScheduleTypeDaily, ScheduleTypeWorkdays:
 		if _, err := time.Parse("15:04", input.RunAt); err != nil {
-			return input, fmt.Errorf("invalid run_at for daily schedule, expected HH:MM")
+			return input, fmt.Errorf("invalid run_at for %s schedule, expected HH:MM", input.ScheduleType)
 		}
-	case "weekly":
+	case ScheduleTypeWeekly:
 		if _, err := time.Parse("15:04", input.RunAt); err != nil {
 			return input, fmt.Errorf("invalid run_at for weekly schedule, expected HH:MM")
 		}
-		if input.Weekday < 0 || input.Weekday > 6 {
+		if weekday < 0 || weekday > 6 {
 			return input, fmt.Errorf("invalid weekday for weekly schedule, expected 0-6")
 		}
-	case "once":
+		input.Weekday = weekday
+	case ScheduleTypeMonthly:
+		if _, err := time.Parse("15:04", input.RunAt); err != nil {
+			return input, fmt.Errorf("invalid run_at for monthly schedule, expected HH:MM")
+		}
+		switch {
+		case monthDay != 0 && weekOfMonth != 0:
+			return input, fmt.Errorf("monthly schedule accepts either month_day or week_of_month, not both")
+		case monthDay != 0:
+			if monthDay < 1 || monthDay > 31 {
+				return input, fmt.Errorf("invalid month_day for monthly schedule, expected 1-31")
+			}
+			input.MonthDay = monthDay
+		case weekOfMonth != 0:
+			if weekOfMonth < -1 || weekOfMonth > 4 {
+				return input, fmt.Errorf("invalid week_of_month for monthly schedule, expected 1-4 or -1 for the last week")
+			}
+			if weekday < 0 || weekday > 6 {
+				return input, fmt.Errorf("invalid weekday for monthly schedule, expected 0-6")
+			}
+			input.WeekOfMonth, input.Weekday = weekOfMonth, weekday
+		default:
+			return input, fmt.Errorf("monthly schedule requires month_day or week_of_month")
+		}
+	case ScheduleTypeInterval:
+		if intervalMinutes <= 0 {
+			return input, fmt.Errorf("interval schedule requires a positive interval_minutes")
+		}
+		if input.RunAt != "" {
+			if _, err := time.Parse(time.RFC3339, input.RunAt); err != nil {
+				return input, fmt.Errorf("invalid run_at for interval schedule, expected RFC3339 start time or empty")
+			}
+		}
+		input.IntervalMinutes = intervalMinutes
+	case ScheduleTypeCron:
+		if cronExpr == "" {
+			return input, fmt.Errorf("cron schedule requires cron_expr")
+		}
+		if _, err := parseCronExpr(cronExpr); err != nil {
+			return input, fmt.Errorf("invalid cron_expr: %w", err)
+		}
+		input.CronExpr = cronExpr
+		input.RunAt = ""
+	case ScheduleTypeOnce:
 		if _, err := time.Parse(time.RFC3339, input.RunAt); err != nil {
 			return input, fmt.Errorf("invalid run_at for once schedule, expected RFC3339")
 		}
@@ -192,30 +359,87 @@ func normalizeScheduledTaskInput(input ScheduledTaskCreateInput) (ScheduledTaskC
 // CalculateNextRunAt computes the next execution time for a scheduled task
 // given the current time and the task's schedule parameters.
 // It is exported so the scheduler can re-compute next_run_at after each dispatch.
+// Calendar-based schedules are evaluated on the wall clock of the task's
+// timezone, so a daily 08:00 task stays at 08:00 local time across DST
+// changes; interval schedules count elapsed time.
+// Runs never land on the task's blackout dates.
 func CalculateNextRunAt(now time.Time, input ScheduledTaskCreateInput) (time.Time, error) {
 	location, err := time.LoadLocation(input.Timezone)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to load timezone: %w", err)
 	}
-	nowInLocation := now.In(location)
+	blackouts, err := parseBlackoutDates(input.BlackoutDates)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next, err := nextScheduledRunAt(now, input, location)
+	for i := 0; err == nil && i < maxBlackoutSkips; i++ {
+		end, blocked := blackoutEnd(next.In(location), blackouts)
+		if !blocked {
+			return next, nil
+		}
+		if input.ScheduleType == ScheduleTypeOnce {
+			return time.Time{}, fmt.Errorf("run_at falls on a blackout date")
+		}
+		// Continue with the first slot at or after the end of the blackout.
+		next, err = nextScheduledRunAt(end.Add(-time.Nanosecond), input, location)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("no run time outside the blackout dates")
+}
 
+// InBlackout reports whether t falls on one of the task's blackout dates.
+func InBlackout(t time.Time, input ScheduledTaskCreateInput) bool {
+	location, err := time.LoadLocation(input.Timezone)
+	if err != nil {
+		return false
+	}
+	blackouts, err := parseBlackoutDates(input.BlackoutDates)
+	if err != nil {
+		return false
+	}
+	_, blocked := blackoutEnd(t.In(location), blackouts)
+	return blocked
+}
+
+// nextScheduledRunAt returns the first slot of the schedule after now,
+// ignoring blackout dates.
+func nextScheduledRunAt(now time.Time, input ScheduledTaskCreateInput, location *time.Location) (time.Time, error) {
 	switch input.ScheduleType {
-	case "daily":
-		runTime, _ := time.Parse("15:04", input.RunAt)
-		candidate := time.Date(nowInLocation.Year(), nowInLocation.Month(), nowInLocation.Day(), runTime.Hour(), runTime.Minute(), 0, 0, location)
-		if !candidate.After(nowInLocation) {
-			candidate = candidate.Add(24 * time.Hour)
+	case ScheduleTypeDaily, ScheduleTypeWeekly, ScheduleTypeWorkdays, ScheduleTypeMonthly:
+		runTime, err := time.Parse("15:04", input.RunAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid run_at, expected HH:MM")
 		}
-		return candidate, nil
-	case "weekly":
-		runTime, _ := time.Parse("15:04", input.RunAt)
-		delta := (input.Weekday - int(nowInLocation.Weekday()) + 7) % 7
-		candidate := time.Date(nowInLocation.Year(), nowInLocation.Month(), nowInLocation.Day(), runTime.Hour(), runTime.Minute(), 0, 0, location).AddDate(0, 0, delta)
-		if !candidate.After(nowInLocation) {
-			candidate = candidate.AddDate(0, 0, 7)
+		return nextWallClock(now, location, runTime.Hour(), runTime.Minute(), scheduleDayMatcher(input))
+	case ScheduleTypeInterval:
+		if input.IntervalMinutes <= 0 {
+			return time.Time{}, fmt.Errorf("interval_minutes must be positive")
 		}
-		return candidate, nil
-	case "once":
+		interval := time.Duration(input.IntervalMinutes) * time.Minute
+		if input.RunAt == "" {
+			return now.Add(interval), nil
+		}
+		// Keep runs aligned to the start time instead of drifting by the
+		// scheduler's polling delay.
+		start, err := time.Parse(time.RFC3339, input.RunAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid run_at, expected RFC3339")
+		}
+		if start.After(now) {
+			return start, nil
+		}
+		return start.Add((now.Sub(start)/interval + 1) * interval), nil
+	case ScheduleTypeCron:
+		schedule, err := parseCronExpr(input.CronExpr)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid cron_expr: %w", err)
+		}
+		return schedule.next(now, location)
+	case ScheduleTypeOnce:
 		candidate, _ := time.Parse(time.RFC3339, input.RunAt)
 		if !candidate.After(now) {
 			return time.Time{}, fmt.Errorf("run_at must be in the future")
@@ -226,6 +450,82 @@ func CalculateNextRunAt(now time.Time, input ScheduledTaskCreateInput) (time.Tim
 	}
 }
 
+// blackoutRange is an inclusive range of local dates formatted as
+// YYYY-MM-DD, which compare correctly as strings.
+type blackoutRange struct {
+	start, end string
+}
+
+// parseBlackoutDates parses entries of the form YYYY-MM-DD or
+// YYYY-MM-DD/YYYY-MM-DD.
+func parseBlackoutDates(dates []string) ([]blackoutRange, error) {
+	ranges := make([]blackoutRange, 0, len(dates))
+	for _, entry := range dates {
+		start, end, isRange := strings.Cut(strings.TrimSpace(entry), "/")
+		if !isRange {
+			end = start
+		}
+		startDate, err := time.Parse(time.DateOnly, start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout date %q, expected YYYY-MM-DD or YYYY-MM-DD/YYYY-MM-DD", entry)
+		}
+		endDate, err := time.Parse(time.DateOnly, end)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout date %q, expected YYYY-MM-DD or YYYY-MM-DD/YYYY-MM-DD", entry)
+		}
+		if endDate.Before(startDate) {
+			return nil, fmt.Errorf("invalid blackout range %q, end is before start", entry)
+		}
+		ranges = append(ranges, blackoutRange{start: start, end: end})
+	}
+	return ranges, nil
+}
+
+// blackoutEnd reports whether the local date of t is blacked out and, if
+// so, returns the local midnight after the blackout range ends.
+func blackoutEnd(t time.Time, ranges []blackoutRange) (time.Time, bool) {
+	day := t.Format(time.DateOnly)
+	for _, r := range ranges {
+		if day < r.start || day > r.end {
+			continue
+		}
+		end, _ := time.Parse(time.DateOnly, r.end)
+		return time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, t.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// scheduleDayMatcher returns the day filter of a calendar-based schedule.
+func scheduleDayMatcher(input ScheduledTaskCreateInput) func(time.Time) bool {
+	switch input.ScheduleType {
+	case ScheduleTypeWeekly:
+		return func(day time.Time) bool {
+			return int(day.Weekday()) == input.Weekday
+		}
+	case ScheduleTypeWorkdays:
+		return func(day time.Time) bool {
+			return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday
+		}
+	case ScheduleTypeMonthly:
+		if input.WeekOfMonth != 0 {
+			return func(day time.Time) bool {
+				if int(day.Weekday()) != input.Weekday {
+					return false
+				}
+				if input.WeekOfMonth == -1 {
+					return day.Day()+7 > daysInMonth(day)
+				}
+				return (day.Day()-1)/7+1 == input.WeekOfMonth
+			}
+		}
+		return func(day time.Time) bool {
+			return day.Day() == min(input.MonthDay, daysInMonth(day))
+		}
+	default:
+		return func(time.Time) bool { return true }
+	}
+}
+
 // mustLoadLocation loads a time.Location, falling back to UTC on error.
 func mustLoadLocation(name string) *time.Location {
 	loc, err := time.LoadLocation(name)
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"aiguide/internal/app/aiguide/table"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,9 +52,9 @@ func TestNormalizeScheduledTaskInput_Daily(t *testing.T) {
 		RunAt:  "08:00",
 	}
 
-	output, err := normalizeScheduledTaskInput(input)
+	output, err := NormalizeScheduledTaskInput(input)
 	if err != nil {
-		t.Fatalf("normalizeScheduledTaskInput() error: %v", err)
+		t.Fatalf("NormalizeScheduledTaskInput() error: %v", err)
 	}
 	if output.ScheduleType != "daily" {
 		t.Fatalf("expected default schedule_type=daily, got %s", output.ScheduleType)
@@ -82,3 +83,199 @@ func TestCalculateNextRunAt_Daily(t *testing.T) {
 		t.Fatalf("calculateNextRunAt()=%s, expected %s", nextRunAt, expected)
 	}
 }
+
+func TestNormalizeScheduledTaskInput_Errors(t *testing.T) {
+	base := ScheduledTaskCreateInput{Title: "报表", Action: "汇总报表", Timezone: "UTC"}
+	tests := []struct {
+		name    string
+		modify  func(*ScheduledTaskCreateInput)
+		wantErr string
+	}{
+		{"monthly without day", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType, in.RunAt = ScheduleTypeMonthly, "09:00"
+		}, "requires month_day or week_of_month"},
+		{"monthly with both", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType, in.RunAt, in.MonthDay, in.WeekOfMonth = ScheduleTypeMonthly, "09:00", 1, 1
+		}, "not both"},
+		{"monthly bad day", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType, in.RunAt, in.MonthDay = ScheduleTypeMonthly, "09:00", 32
+		}, "invalid month_day"},
+		{"monthly bad week", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType, in.RunAt, in.WeekOfMonth = ScheduleTypeMonthly, "09:00", 5
+		}, "invalid week_of_month"},
+		{"interval without minutes", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType = ScheduleTypeInterval
+		}, "positive interval_minutes"},
+		{"cron without expression", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType = ScheduleTypeCron
+		}, "requires cron_expr"},
+		{"cron bad expression", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType, in.CronExpr = ScheduleTypeCron, "0 25 * * *"
+		}, "invalid cron_expr"},
+		{"workdays bad time", func(in *ScheduledTaskCreateInput) {
+			in.ScheduleType, in.RunAt = ScheduleTypeWorkdays, "9am"
+		}, "expected HH:MM"},
+		{"runtime too long", func(in *ScheduledTaskCreateInput) {
+			in.RunAt, in.MaxRuntimeMinutes = "09:00", 600
+		}, "invalid max_runtime_minutes"},
+		{"too many retries", func(in *ScheduledTaskCreateInput) {
+			in.RunAt, in.MaxRetries = "09:00", 10
+		}, "invalid max_retries"},
+		{"negative threshold", func(in *ScheduledTaskCreateInput) {
+			in.RunAt, in.FailureThreshold = "09:00", -1
+		}, "invalid failure_threshold"},
+		{"bad missed run policy", func(in *ScheduledTaskCreateInput) {
+			in.RunAt, in.MissedRunPolicy = "09:00", "later"
+		}, "invalid missed_run_policy"},
+		{"bad blackout date", func(in *ScheduledTaskCreateInput) {
+			in.RunAt, in.BlackoutDates = "09:00", []string{"2026/03/01"}
+		}, "invalid blackout date"},
+		{"reversed blackout range", func(in *ScheduledTaskCreateInput) {
+			in.RunAt, in.BlackoutDates = "09:00", []string{"2026-03-05/2026-03-01"}
+		}, "end is before start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := base
+			tt.modify(&input)
+			_, err := NormalizeScheduledTaskInput(input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NormalizeScheduledTaskInput() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeScheduledTaskInput_ClearsUnusedFields(t *testing.T) {
+	output, err := NormalizeScheduledTaskInput(ScheduledTaskCreateInput{
+		Title:        "报表",
+		Action:       "汇总报表",
+		ScheduleType: ScheduleTypeCron,
+		RunAt:        "08:00",
+		Weekday:      3,
+		CronExpr:     " 0 9 * * 1 ",
+	})
+	if err != nil {
+		t.Fatalf("NormalizeScheduledTaskInput() error: %v", err)
+	}
+	if output.RunAt != "" || output.Weekday != 0 || output.CronExpr != "0 9 * * 1" {
+		t.Fatalf("unexpected normalized input: %+v", output)
+	}
+}
+
+func TestCalculateNextRunAt_Schedules(t *testing.T) {
+	// 2026-02-25 is a Wednesday.
+	now := time.Date(2026, 2, 27, 9, 0, 0, 0, time.UTC) // Friday
+	tests := []struct {
+		name  string
+		input ScheduledTaskCreateInput
+		want  time.Time
+	}{
+		{"workdays skips weekend", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeWorkdays, RunAt: "08:00"},
+			time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)},
+		{"monthly day clamps to month end", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeMonthly, RunAt: "10:00", MonthDay: 31},
+			time.Date(2026, 2, 28, 10, 0, 0, 0, time.UTC)},
+		{"monthly second tuesday", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeMonthly, RunAt: "10:00", WeekOfMonth: 2, Weekday: 2},
+			time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)},
+		{"monthly last friday", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeMonthly, RunAt: "10:00", WeekOfMonth: -1, Weekday: 5},
+			time.Date(2026, 2, 27, 10, 0, 0, 0, time.UTC)},
+		{"interval without start", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeInterval, IntervalMinutes: 90},
+			time.Date(2026, 2, 27, 10, 30, 0, 0, time.UTC)},
+		{"interval aligned to start", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeInterval, IntervalMinutes: 120, RunAt: "2026-02-27T06:15:00Z"},
+			time.Date(2026, 2, 27, 10, 15, 0, 0, time.UTC)},
+		{"cron", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeCron, CronExpr: "0 */6 * * *"},
+			time.Date(2026, 2, 27, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Timezone = "UTC"
+			got, err := CalculateNextRunAt(now, tt.input)
+			if err != nil {
+				t.Fatalf("CalculateNextRunAt() error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("CalculateNextRunAt() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateNextRunAt_DailyAcrossDST(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	input := ScheduledTaskCreateInput{ScheduleType: ScheduleTypeDaily, RunAt: "08:00", Timezone: "Europe/Berlin"}
+
+	// Clocks go back on 2026-10-25; the next run must still be 08:00 local.
+	now := time.Date(2026, 10, 24, 9, 0, 0, 0, location)
+	got, err := CalculateNextRunAt(now, input)
+	if err != nil {
+		t.Fatalf("CalculateNextRunAt() error: %v", err)
+	}
+	want := time.Date(2026, 10, 25, 8, 0, 0, 0, location)
+	if !got.Equal(want) || got.Sub(now) != 24*time.Hour {
+		t.Fatalf("CalculateNextRunAt() = %s, want %s 24h later", got, want)
+	}
+}
+
+func TestCalculateNextRunAt_DailyInDSTGap(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	input := ScheduledTaskCreateInput{ScheduleType: ScheduleTypeDaily, RunAt: "02:30", Timezone: "America/New_York"}
+
+	// 02:30 is skipped on 2026-03-08, so the run happens at 03:30 EDT.
+	now := time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC) // 00:00 EST
+	got, err := CalculateNextRunAt(now, input)
+	if err != nil {
+		t.Fatalf("CalculateNextRunAt() error: %v", err)
+	}
+	want := time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Fatalf("CalculateNextRunAt() = %s, want %s", got, want)
+	}
+}
+
+func TestCalculateNextRunAt_SkipsBlackoutDates(t *testing.T) {
+	now := time.Date(2026, 2, 27, 9, 0, 0, 0, time.UTC) // Friday
+	tests := []struct {
+		name  string
+		input ScheduledTaskCreateInput
+		want  time.Time
+	}{
+		{"single day", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeDaily, RunAt: "08:00",
+			BlackoutDates: []string{"2026-02-28"}},
+			time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{"range", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeWorkdays, RunAt: "08:00",
+			BlackoutDates: []string{"2026-03-02/2026-03-04"}},
+			time.Date(2026, 3, 5, 8, 0, 0, 0, time.UTC)},
+		{"adjacent ranges", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeDaily, RunAt: "08:00",
+			BlackoutDates: []string{"2026-02-28", "2026-03-01/2026-03-02"}},
+			time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC)},
+		{"interval resumes after range", ScheduledTaskCreateInput{ScheduleType: ScheduleTypeInterval, IntervalMinutes: 1440,
+			RunAt: "2026-02-26T06:00:00Z", BlackoutDates: []string{"2026-02-28"}},
+			time.Date(2026, 3, 1, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Timezone = "UTC"
+			got, err := CalculateNextRunAt(now, tt.input)
+			if err != nil {
+				t.Fatalf("CalculateNextRunAt() error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("CalculateNextRunAt() = %s, want %s", got, tt.want)
+			}
+			if InBlackout(got, tt.input) {
+				t.Fatalf("InBlackout(%s) = true for the returned run time", got)
+			}
+		})
+	}
+
+	once := ScheduledTaskCreateInput{ScheduleType: ScheduleTypeOnce, RunAt: "2026-03-01T08:00:00Z",
+		Timezone: "UTC", BlackoutDates: []string{"2026-03-01"}}
+	if _, err := CalculateNextRunAt(now, once); err == nil || !strings.Contains(err.Error(), "blackout") {
+		t.Fatalf("CalculateNextRunAt(once in blackout) error = %v, want blackout error", err)
+	}
+}
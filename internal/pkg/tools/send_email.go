@@ -2,8 +2,10 @@ package tools
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"mime"
@@ -55,6 +57,44 @@ func NewSendEmailTool() (tool.Tool, error) {
 	return functiontool.New(config, handler)
 }
 
+// SendNotificationEmail sends a plain-text email to a single recipient with
+// the user's default email server config. Like the send_email tool, ctx must
+// carry the db and user id.
+func SendNotificationEmail(ctx context.Context, to, subject, body string) error {
+	output, err := sendEmail(ctx, SendEmailInput{To: []string{to}, Subject: subject, Body: body})
+	if err != nil {
+		return err
+	}
+	if !output.Success {
+		return errors.New(cmp.Or(output.Error, output.Message))
+	}
+	return nil
+}
+
+// SMTPConfig is the server-level SMTP account used for system mail such as
+// password resets, independent of the email configs users save themselves.
+type SMTPConfig struct {
+	Server   string
+	Username string // Also used as the sender address
+	Password string
+	FromName string
+}
+
+// SendSystemEmail sends a plain-text email to a single recipient through the
+// server-level SMTP account.
+func SendSystemEmail(config SMTPConfig, to, subject, body string) error {
+	recipients, err := normalizeEmailAddresses([]string{to})
+	if err != nil {
+		return err
+	}
+	input := SendEmailInput{To: recipients, Subject: subject, Body: body}
+	message, err := buildEmailMessage(config.Username, config.FromName, input, recipients)
+	if err != nil {
+		return fmt.Errorf("failed to build email message: %w", err)
+	}
+	return sendSMTPMessage(config.Server, config.Username, config.Password, recipients, message)
+}
+
 func sendEmail(ctx context.Context, input SendEmailInput) (*SendEmailOutput, error) {
 	validatedInput, err := validateSendEmailInput(input)
 	if err != nil {
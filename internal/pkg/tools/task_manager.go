@@ -88,6 +88,7 @@ type TaskUpdateInput struct {
 }
 
 type TaskUpdateOutput struct {
+	TaskID  int    `json:"task_id"`
 	Message string `json:"message"`
 }
 
@@ -137,6 +138,7 @@ func NewTaskUpdateTool(db *gorm.DB) (tool.Tool, error) {
 
 		slog.Info("task updated", "task_id", input.TaskID, "status", input.Status)
 		return &TaskUpdateOutput{
+			TaskID:  input.TaskID,
 			Message: fmt.Sprintf("Task %d updated successfully", input.TaskID),
 		}, nil
 	}
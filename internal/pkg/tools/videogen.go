@@ -59,21 +59,21 @@ type VideoGenOutput struct {
 }
 
 // NewVideoGenTool 创建视频生成工具
-func NewVideoGenTool(client *genai.Client, db *gorm.DB, fileStore storage.FileStore, mockMode bool) (tool.Tool, error) {
+func NewVideoGenTool(client *genai.Client, db *gorm.DB, fileStore storage.FileStore, mockMode bool, notifier Notifier) (tool.Tool, error) {
 	config := functiontool.Config{
 		Name:        "generate_video",
 		Description: "生成 AI 视频。根据用户的文字描述生成相应的视频。支持指定宽高比（16:9, 9:16）、分辨率（720p, 1080p）、时长（4/6/8秒）等参数。视频生成需要较长时间（约30秒到数分钟），请耐心等待。",
 	}
 
 	handler := func(ctx tool.Context, input VideoGenInput) (*VideoGenOutput, error) {
-		return generateVideo(ctx, client, db, fileStore, input, mockMode)
+		return generateVideo(ctx, client, db, fileStore, input, mockMode, notifier)
 	}
 
 	return functiontool.New(config, handler)
 }
 
 // generateVideo 生成视频
-func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileStore storage.FileStore, input VideoGenInput, mockMode bool) (*VideoGenOutput, error) {
+func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileStore storage.FileStore, input VideoGenInput, mockMode bool, notifier Notifier) (*VideoGenOutput, error) {
 	if input.Prompt == "" {
 		slog.Error("视频描述不能为空")
 		return &VideoGenOutput{
@@ -144,7 +144,14 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 		}, nil
 	}
 
-	// 轮询等待视频生成完成
+	output := waitForVideos(ctx, client, db, fileStore, operation)
+	notifyVideoResult(ctx, notifier, input.Prompt, output)
+	return output, nil
+}
+
+// waitForVideos 轮询等待视频生成完成，并保存生成的视频
+func waitForVideos(ctx context.Context, client *genai.Client, db *gorm.DB, fileStore storage.FileStore, operation *genai.GenerateVideosOperation) *VideoGenOutput {
+	var err error
 	pollInterval := 10 * time.Second
 	maxWait := 10 * time.Minute
 	startTime := time.Now()
@@ -155,7 +162,7 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 			return &VideoGenOutput{
 				Success: false,
 				Error:   "视频生成超时，请稍后重试",
-			}, nil
+			}
 		}
 
 		slog.Info("等待视频生成完成...", "elapsed", time.Since(startTime).Round(time.Second))
@@ -167,7 +174,7 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 			return &VideoGenOutput{
 				Success: false,
 				Error:   fmt.Sprintf("查询视频生成状态失败: %v", err),
-			}, nil
+			}
 		}
 	}
 
@@ -177,7 +184,7 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 		return &VideoGenOutput{
 			Success: false,
 			Error:   fmt.Sprintf("视频生成失败: %v", operation.Error),
-		}, nil
+		}
 	}
 
 	if operation.Response == nil || len(operation.Response.GeneratedVideos) == 0 {
@@ -185,7 +192,7 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 		return &VideoGenOutput{
 			Success: false,
 			Error:   "没有生成任何视频",
-		}, nil
+		}
 	}
 
 	// 下载并保存视频
@@ -247,7 +254,7 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 		return &VideoGenOutput{
 			Success: false,
 			Error:   "视频下载或保存失败",
-		}, nil
+		}
 	}
 
 	message := fmt.Sprintf("成功生成 %d 个视频", len(videoURLs))
@@ -257,7 +264,26 @@ func generateVideo(ctx context.Context, client *genai.Client, db *gorm.DB, fileS
 		Success: true,
 		Videos:  videoURLs,
 		Message: message,
-	}, nil
+	}
+}
+
+// notifyVideoResult 发送视频生成结果的站内通知。视频生成耗时较长，
+// 用户可能已离开当前会话
+func notifyVideoResult(ctx context.Context, notifier Notifier, prompt string, output *VideoGenOutput) {
+	userID, _ := middleware.GetUserID(ctx)
+	sessionID, _ := ctx.Value(constant.ContextKeySessionID).(string)
+	n := table.Notification{
+		UserID: userID,
+		Kind:   constant.NotificationKindVideoGeneration,
+		Title:  "视频生成完成",
+		Body:   fmt.Sprintf("%s\n\n%s", output.Message, prompt),
+		Link:   sessionLink(sessionID),
+	}
+	if !output.Success {
+		n.Title = "视频生成失败"
+		n.Body = fmt.Sprintf("%s\n\n%s", output.Error, prompt)
+	}
+	sendNotification(ctx, notifier, n)
 }
 
 // generateMockVideo 生成模拟视频数据用于开发测试
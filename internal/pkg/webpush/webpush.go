@@ -0,0 +1,285 @@
+// Package webpush sends Web Push messages: VAPID authentication (RFC 8292)
+// and aes128gcm payload encryption (RFC 8291).
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// recordSize is the aes128gcm record size; messages use a single record.
+	recordSize = 4096
+	// headerSize is the aes128gcm header: salt, record size, key id length
+	// and the 65 byte application server public key.
+	headerSize = 16 + 4 + 1 + 65
+	// MaxPayloadSize is the largest payload that keeps the request body
+	// within the 4096 bytes every push service accepts.
+	MaxPayloadSize = recordSize - headerSize - 16 - 1
+	// vapidTokenLifetime is the validity of VAPID tokens; RFC 8292 caps it
+	// at 24 hours.
+	vapidTokenLifetime = 12 * time.Hour
+)
+
+// ErrSubscriptionGone is returned by Send when the push service reports that
+// the subscription expired or was removed; it should be deleted.
+var ErrSubscriptionGone = errors.New("push subscription is no longer valid")
+
+// Keys is a VAPID key pair in the base64url encoding browsers use: the
+// uncompressed P-256 public key and the raw private scalar.
+type Keys struct {
+	PublicKey  string
+	PrivateKey string
+}
+
+// Subscription is a browser push subscription as returned by
+// PushManager.subscribe().
+type Subscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// GenerateKeys creates a new VAPID key pair.
+func GenerateKeys() (Keys, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Keys{}, fmt.Errorf("failed to generate vapid key: %w", err)
+	}
+	raw, err := key.Bytes()
+	if err != nil {
+		return Keys{}, fmt.Errorf("failed to encode vapid key: %w", err)
+	}
+	public, err := key.PublicKey.Bytes()
+	if err != nil {
+		return Keys{}, fmt.Errorf("failed to encode vapid public key: %w", err)
+	}
+	return Keys{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(public),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(raw),
+	}, nil
+}
+
+// Validate checks that sub has an https endpoint, a P-256 public key and a
+// 16 byte auth secret, as browsers create them.
+func (sub Subscription) Validate() error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.New("push endpoint must be an https url")
+	}
+	publicKey, err := decodeBase64(sub.P256dh)
+	if err != nil {
+		return errors.New("invalid p256dh key")
+	}
+	if _, err := ecdh.P256().NewPublicKey(publicKey); err != nil {
+		return errors.New("invalid p256dh key")
+	}
+	if auth, err := decodeBase64(sub.Auth); err != nil || len(auth) != 16 {
+		return errors.New("invalid auth secret, expected 16 bytes")
+	}
+	return nil
+}
+
+// Sender delivers encrypted messages to push services.
+type Sender struct {
+	httpClient *http.Client
+	subject    string
+	publicKey  string
+	privateKey *ecdsa.PrivateKey
+}
+
+// NewSender creates a sender signing with keys. subject is the contact of
+// the application server, a mailto: or https: URL.
+func NewSender(keys Keys, subject string, httpClient *http.Client) (*Sender, error) {
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, fmt.Errorf("vapid subject must be a mailto: or https: URL, got %q", subject)
+	}
+	raw, err := decodeBase64(keys.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	public, err := privateKey.PublicKey.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	if keys.PublicKey != "" && keys.PublicKey != base64.RawURLEncoding.EncodeToString(public) {
+		return nil, errors.New("vapid public key does not match the private key")
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Sender{
+		httpClient: httpClient,
+		subject:    subject,
+		publicKey:  base64.RawURLEncoding.EncodeToString(public),
+		privateKey: privateKey,
+	}, nil
+}
+
+// PublicKey returns the VAPID public key browsers pass to
+// PushManager.subscribe() as applicationServerKey.
+func (s *Sender) PublicKey() string {
+	return s.publicKey
+}
+
+// Send encrypts payload for sub and posts it to the push service. ttl is how
+// long the push service keeps an undelivered message.
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		return fmt.Errorf("invalid push endpoint %q", sub.Endpoint)
+	}
+	body, err := Encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	token, err := s.vapidToken(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, s.publicKey))
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push message: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrSubscriptionGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// vapidToken signs the RFC 8292 JWT for the push service at audience.
+func (s *Sender) vapidToken(audience string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": audience,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": s.subject,
+	})
+	signed, err := token.SignedString(s.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign vapid token: %w", err)
+	}
+	return signed, nil
+}
+
+// Encrypt encrypts payload for sub with a fresh sender key and salt, and
+// returns the aes128gcm request body.
+func Encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate push key: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate push salt: %w", err)
+	}
+	return encrypt(sub, payload, serverKey, salt)
+}
+
+func encrypt(sub Subscription, payload []byte, serverKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("push payload of %d bytes exceeds %d bytes", len(payload), MaxPayloadSize)
+	}
+	clientPublic, err := decodeBase64(sub.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription p256dh key: %w", err)
+	}
+	clientKey, err := ecdh.P256().NewPublicKey(clientPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription p256dh key: %w", err)
+	}
+	authSecret, err := decodeBase64(sub.Auth)
+	if err != nil || len(authSecret) == 0 {
+		return nil, errors.New("invalid subscription auth secret")
+	}
+
+	sharedSecret, err := serverKey.ECDH(clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive push secret: %w", err)
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	// RFC 8291 section 3.4: combine the shared secret with the auth secret,
+	// then derive the content encryption key and nonce (RFC 8188).
+	keyInfo := "WebPush: info\x00" + string(clientPublic) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, headerSize+len(payload)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(serverPublic)))
+	body = append(body, serverPublic...)
+	// A single, final record: the payload followed by the 0x02 delimiter.
+	record := append(append(make([]byte, 0, len(payload)+1), payload...), 0x02)
+	return gcm.Seal(body, nonce, record, nil), nil
+}
+
+// decodeBase64 decodes the base64url keys of push subscriptions, with or
+// without padding; standard base64 is accepted as well.
+func decodeBase64(value string) ([]byte, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	value = strings.NewReplacer("+", "-", "/", "_").Replace(value)
+	return base64.RawURLEncoding.DecodeString(value)
+}
@@ -0,0 +1,167 @@
+package webpush
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestEncryptRFC8291 checks the example of RFC 8291 appendix A.
+func TestEncryptRFC8291(t *testing.T) {
+	serverRaw, _ := decodeBase64("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw")
+	serverKey, err := ecdh.P256().NewPrivateKey(serverRaw)
+	if err != nil {
+		t.Fatalf("NewPrivateKey() error = %v", err)
+	}
+	salt, _ := decodeBase64("DGv6ra1nlYgDCS1FRnbzlw")
+	sub := Subscription{
+		Endpoint: "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV",
+		P256dh:   "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+		Auth:     "BTBZMqHH6r4Tts7J_aSIgg",
+	}
+
+	body, err := encrypt(sub, []byte("When I grow up, I want to be a watermelon"), serverKey, salt)
+	if err != nil {
+		t.Fatalf("encrypt() error = %v", err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := base64.RawURLEncoding.EncodeToString(body); got != want {
+		t.Fatalf("encrypt() = %s\nwant %s", got, want)
+	}
+}
+
+func TestEncryptRejectsInvalidInput(t *testing.T) {
+	keys, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+	valid := Subscription{P256dh: keys.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"}
+
+	if _, err := Encrypt(valid, make([]byte, MaxPayloadSize+1)); err == nil {
+		t.Fatal("Encrypt() expected error for an oversized payload")
+	}
+	if _, err := Encrypt(Subscription{P256dh: "bm90IGEga2V5", Auth: valid.Auth}, []byte("x")); err == nil {
+		t.Fatal("Encrypt() expected error for an invalid p256dh key")
+	}
+	body, err := Encrypt(valid, make([]byte, MaxPayloadSize))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if len(body) != 4096 {
+		t.Fatalf("len(body) = %d, want 4096", len(body))
+	}
+}
+
+func TestSubscriptionValidate(t *testing.T) {
+	client, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+	valid := Subscription{Endpoint: "https://push.example.net/abc", P256dh: client.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	invalid := map[string]Subscription{
+		"http endpoint":  {Endpoint: "http://push.example.net/abc", P256dh: valid.P256dh, Auth: valid.Auth},
+		"private key":    {Endpoint: valid.Endpoint, P256dh: client.PrivateKey, Auth: valid.Auth},
+		"short auth":     {Endpoint: valid.Endpoint, P256dh: valid.P256dh, Auth: "c2hvcnQ"},
+		"missing fields": {Endpoint: valid.Endpoint},
+	}
+	for name, sub := range invalid {
+		if err := sub.Validate(); err == nil {
+			t.Errorf("Validate() with %s expected error", name)
+		}
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	keys, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+	other, _ := GenerateKeys()
+
+	if _, err := NewSender(keys, "admin@example.com", nil); err == nil {
+		t.Fatal("NewSender() expected error for a subject without scheme")
+	}
+	if _, err := NewSender(Keys{PublicKey: other.PublicKey, PrivateKey: keys.PrivateKey}, "mailto:admin@example.com", nil); err == nil {
+		t.Fatal("NewSender() expected error for mismatched keys")
+	}
+	sender, err := NewSender(Keys{PrivateKey: keys.PrivateKey}, "mailto:admin@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+	if sender.PublicKey() != keys.PublicKey {
+		t.Fatalf("PublicKey() = %q, want %q", sender.PublicKey(), keys.PublicKey)
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	keys, err := GenerateKeys()
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+	sender, err := NewSender(keys, "mailto:admin@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+	publicRaw, _ := decodeBase64(keys.PublicKey)
+	vapidPublic, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), publicRaw)
+	if err != nil {
+		t.Fatalf("ParseUncompressedPublicKey() error = %v", err)
+	}
+	client, _ := GenerateKeys()
+
+	status := http.StatusCreated
+	var got *http.Request
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sub := Subscription{Endpoint: server.URL + "/push/abc", P256dh: client.PublicKey, Auth: "BTBZMqHH6r4Tts7J_aSIgg"}
+	if err := sender.Send(context.Background(), sub, []byte(`{"title":"hi"}`), time.Hour); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got.Header.Get("Content-Encoding") != "aes128gcm" || got.Header.Get("TTL") != "3600" || len(gotBody) != headerSize+len(`{"title":"hi"}`)+17 {
+		t.Fatalf("request headers = %v, body length = %d", got.Header, len(gotBody))
+	}
+
+	auth, ok := strings.CutPrefix(got.Header.Get("Authorization"), "vapid t=")
+	token, k, found := strings.Cut(auth, ", k=")
+	if !ok || !found || k != keys.PublicKey {
+		t.Fatalf("Authorization = %q", got.Header.Get("Authorization"))
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return vapidPublic, nil },
+		jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(server.URL)); err != nil {
+		t.Fatalf("vapid token is invalid: %v", err)
+	}
+	if claims["sub"] != "mailto:admin@example.com" {
+		t.Fatalf("claims = %v", claims)
+	}
+
+	status = http.StatusGone
+	if err := sender.Send(context.Background(), sub, []byte("x"), time.Hour); !errors.Is(err, ErrSubscriptionGone) {
+		t.Fatalf("Send() error = %v, want ErrSubscriptionGone", err)
+	}
+	status = http.StatusTooManyRequests
+	if err := sender.Send(context.Background(), sub, []byte("x"), time.Hour); err == nil || errors.Is(err, ErrSubscriptionGone) {
+		t.Fatalf("Send() error = %v, want a retryable error", err)
+	}
+}